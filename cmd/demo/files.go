@@ -1,13 +1,14 @@
 package main
 
 import (
-	"io/ioutil"
 	"os"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
 )
 
 
-const NewFileFlag = os.O_CREATE | os.O_WRONLY
-const OwnerRWOnly os.FileMode = 0600
+const NewFileFlag = resource.NewFileFlag
+const OwnerRWOnly = resource.OwnerRWOnly
 
 
 func writeFile1(path, content string) error {
@@ -67,7 +68,7 @@ func writeFile1_WithErrorHandling(path, content string) error {
 
 
 func writeFile2(path, content string) error {
-	return NewFileResource(path, NewFileFlag, OwnerRWOnly)(
+	return resource.NewFileResource(path, NewFileFlag, OwnerRWOnly).Use(
 		func(file *os.File) error {
 			_, err := file.Write([]byte(content))
 			if err != nil {
@@ -81,8 +82,8 @@ func writeFile2(path, content string) error {
 }
 
 
-func writeFile3(fr FileResource, content string) error {
-	return fr(func(file *os.File) error {
+func writeFile3(fr resource.FileResource, content string) error {
+	return fr.Use(func(file *os.File) error {
 		_, err := file.Write([]byte(content))
 		if err != nil {
 			return err
@@ -94,49 +95,16 @@ func writeFile3(fr FileResource, content string) error {
 }
 
 
-
-////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
-
-
-
-
-
-type FileResourceCallback = func (fd *os.File) error
-type FileResource = func(callback FileResourceCallback) error
-
-// func NewFileResource(path string, flags int, perm os.FileMode, callback FileResourceCallback) error {
-
-func NewFileResource(path string, flags int, perm os.FileMode) FileResource {
-
-	return func(callback FileResourceCallback) error {
-
-		file, err := os.OpenFile(path, flags, perm)
-		if err != nil {
-			return err
-		}
-
-		err = callback(file)
-
+// writeFile3Func is writeFile3 written for the function form FileResource had before it became an interface,
+// which still compiles: fr.Use of any FileResource is a FileResourceFunc.
+func writeFile3Func(fr resource.FileResourceFunc, content string) error {
+	return fr(func(file *os.File) error {
+		_, err := file.Write([]byte(content))
 		if err != nil {
-			// try to close, but return user's error anyway
-			// or maybe combine in one error
-			_ = file.Close()
 			return err
-		} else {
-			return file.Close()
 		}
-	}
+		// more content to the God of content
+		_, err = file.Write([]byte(content))
+		return err
+	})
 }
-
-var TempFileResource FileResource =
-	func(callback FileResourceCallback) error {
-
-		file, err := ioutil.TempFile("", "")
-		if err != nil {
-			return err
-		}
-		defer file.Close()
-		defer os.Remove(file.Name())
-
-		return callback(file)
-	}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/group"
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const usage = `usage: demo [flags] [files|sql|csv|group|drain|soak|plan]...
+
+Runs the given demos, all of them but drain, soak and plan when none is given, only plan with -plan.
+csv exports the names table of the database to names.csv in -dir, and imports it back
+skipping the names already there.
+drain runs tasks until SIGINT or SIGTERM, then waits for the running ones.
+soak runs -workers workers using files and the database for -duration, and fails on errors or leaks.
+plan runs the steps of the -plan file, see PlanStep.
+
+flags:
+`
+
+func main() {
+	if err := mainErr(os.Args[1:], os.Stdout); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(1)
+	}
+}
+
+type demoConfig struct {
+	dir    string // where the files demo writes its files
+	dbPath string // relative paths are inside dir
+
+	soakDuration time.Duration
+	soakWorkers  int
+
+	planPath string
+}
+
+// mainErr runs the demos of args, reporting to stdout.
+func mainErr(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("demo", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), usage)
+		flags.PrintDefaults()
+	}
+	dir := flags.String("dir", ".", "output directory for the demo files")
+	dbPath := flags.String("db", "demo.sqlite", "sqlite database path, relative to -dir")
+	cleanup := flags.Bool("cleanup", false, "work in a temporary directory inside -dir and remove it afterwards")
+	formatName := flags.String("format", "table", "output format: table or json")
+	soakDuration := flags.Duration("duration", 10*time.Second, "how long soak runs")
+	soakWorkers := flags.Int("workers", 8, "how many workers soak runs")
+	planPath := flags.String("plan", "", "JSON plan file plan runs")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	format, err := ParseFormat(*formatName)
+	if err != nil {
+		flags.Usage()
+		return err
+	}
+
+	commands := flags.Args()
+	if len(commands) == 0 && *planPath != "" {
+		commands = []string{"plan"}
+	} else if len(commands) == 0 {
+		commands = []string{"group", "files", "sql", "csv"}
+	}
+	for _, command := range commands {
+		if _, ok := demos[command]; !ok {
+			flags.Usage()
+			return fmt.Errorf("unknown command %q", command)
+		}
+	}
+
+	run := func(dir string) error {
+		config := demoConfig{dir: dir, dbPath: *dbPath, soakDuration: *soakDuration, soakWorkers: *soakWorkers, planPath: *planPath}
+		if !filepath.IsAbs(config.dbPath) {
+			config.dbPath = filepath.Join(dir, config.dbPath)
+		}
+		return NewReporter(stdout, format).Use(func(r *Reporter) error {
+			for _, command := range commands {
+				r.Section(command)
+				err := demos[command](r, config)
+				if err != nil {
+					return fmt.Errorf("%s: %w", command, err)
+				}
+			}
+			return nil
+		})
+	}
+
+	if *cleanup {
+		return resource.NewTempDirResource(*dir, "demo-*").Use(run)
+	}
+	return run(*dir)
+}
+
+var demos = map[string]func(r *Reporter, config demoConfig) error{
+	"group": groupDemo,
+	"files": filesDemo,
+	"sql":   sqlDemo,
+	"csv":   csvDemo,
+	"drain": drainDemo,
+	"soak":  soakDemo,
+	"plan":  planDemo,
+}
+
+func groupDemo(r *Reporter, _ demoConfig) error {
+	result := group.RunGroupCollect(10, func(i int) string {
+		return strings.Repeat("*", i)
+	})
+	r.KV("result", result)
+	return nil
+}
+
+func drainDemo(r *Reporter, _ demoConfig) error {
+	return resource.WithSignalContext().Use(func(ctx context.Context) error {
+		g := group.Drainable(group.NewBoundedSpawner(4))
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		for i := 1; ctx.Err() == nil; i++ {
+			select {
+			case <-ctx.Done():
+			case <-ticker.C:
+				err := g.TryRun(func() {
+					time.Sleep(time.Second)
+					r.KV("done", fmt.Sprintf("task %d", i))
+				})
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		r.KV("draining", true)
+		drainCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		return g.Drain(drainCtx)
+	})
+}
+
+func filesDemo(_ *Reporter, config demoConfig) error {
+	var err error
+
+	test1 := filepath.Join(config.dir, "test1.txt")
+	err = writeFile1(test1, "test1")
+	if err != nil {
+		return err
+	}
+
+	content, err := resource.UseValue(resource.NewReadFileResource(test1), io.ReadAll)
+	if err != nil {
+		return err
+	}
+	if string(content) != "test1test1" {
+		return fmt.Errorf("%s: unexpected content %q", test1, content)
+	}
+
+	err = writeFile2(filepath.Join(config.dir, "test2.txt"), "test2")
+	if err != nil {
+		return err
+	}
+
+	file := resource.NewFileResource(filepath.Join(config.dir, "test3.txt"), os.O_CREATE|os.O_WRONLY, 0600)
+
+	err = writeFile3(file, "test3")
+	if err != nil {
+		return err
+	}
+
+	err = writeFile3Func(file.Use, "test3")
+	if err != nil {
+		return err
+	}
+
+	err = writeFile3(resource.TempFileResource, "whatever")
+	if err != nil {
+		return err
+	}
+
+	tempFile := resource.NewTempFileResource("", "demo-*")
+	return tempFile.Use(func(fd1 *os.File) error {
+		return tempFile.Use(func(fd2 *os.File) error {
+			_, err := fd1.Write([]byte("hi!"))
+			if err != nil {
+				return err
+			}
+			_, err = fd2.Write([]byte("hi!"))
+			return err
+		})
+	})
+}
+
+// sqlDemo holds the lock of the database, so that demos running in the same directory take turns.
+func sqlDemo(r *Reporter, config demoConfig) error {
+	return resource.WithDBLock(config.dbPath, func() error {
+		return sqlDemoLocked(r, config)
+	})
+}
+
+func sqlDemoLocked(r *Reporter, config demoConfig) error {
+	db := resource.NewDBResource("sqlite3", config.dbPath)
+
+	return db.Use(func(db *sql.DB) error {
+		err := initDB(db)
+		if err != nil {
+			return err
+		}
+
+		result1, err := helloSql_Cool(db, "MessageBird")
+		if err != nil {
+			return err
+		}
+		r.KV("cool", result1)
+
+		result2, err := helloSql_NotCoolAtAll(db, "Twilio")
+		if err != nil {
+			return err
+		}
+		r.KV("not cool at all", result2)
+
+		summary, err := namesSummary(db)
+		if err != nil {
+			return err
+		}
+		r.KV("names", summary)
+
+		return nil
+	})
+}
+
+func csvDemo(r *Reporter, config demoConfig) error {
+	db := resource.NewDBResource("sqlite3", config.dbPath)
+	_, err := resource.Exec(resource.FromUsable(db), createTableQuery)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(config.dir, "names.csv")
+	exported, err := ExportNamesCSV(db, path)
+	if err != nil {
+		return err
+	}
+	imported, err := ImportNamesCSV(db, path, SkipDuplicateNames())
+	if err != nil {
+		return err
+	}
+	r.KV("file", path)
+	r.KV("exported", exported)
+	r.KV("imported", imported)
+	return nil
+}
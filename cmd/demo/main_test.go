@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+func runDemo(t *testing.T, args ...string) string {
+	t.Helper()
+	var out bytes.Buffer
+	err := mainErr(args, &out)
+	if err != nil {
+		t.Fatalf("demo %s: %v\n%s", strings.Join(args, " "), err, out.String())
+	}
+	return out.String()
+}
+
+func dirEntries(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+func TestGroupCommand(t *testing.T) {
+	out := runDemo(t, "-dir", t.TempDir(), "group")
+	if want := "== group ==\nresult: [ * ** *** **** ***** ****** ******* ******** *********]\n"; out != want {
+		t.Errorf("output = %q, want %q", out, want)
+	}
+}
+
+func TestFilesCommand(t *testing.T) {
+	dir := t.TempDir()
+	runDemo(t, "-dir", dir, "files")
+	if got, want := dirEntries(t, dir), []string{"test1.txt", "test2.txt", "test3.txt"}; !slices.Equal(got, want) {
+		t.Errorf("files = %q, want %q", got, want)
+	}
+	content, err := os.ReadFile(filepath.Join(dir, "test1.txt"))
+	if err != nil || string(content) != "test1test1" {
+		t.Errorf("test1.txt = %q, %v", content, err)
+	}
+}
+
+func TestSQLCommand(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(t.TempDir(), "names.sqlite")
+	out := runDemo(t, "-dir", dir, "-db", dbPath, "sql")
+	if !strings.Contains(out, "cool: Hello, #1\n") || !strings.Contains(out, "names: 1, last #1\n") {
+		t.Errorf("output = %q", out)
+	}
+	out = runDemo(t, "-dir", dir, "-db", dbPath, "sql")
+	if !strings.Contains(out, "names: 2, last #2\n") {
+		t.Errorf("second run output = %q", out)
+	}
+	if _, err := os.Stat(dbPath); err != nil {
+		t.Errorf("database not at -db: %v", err)
+	}
+	if got := dirEntries(t, dir); len(got) != 0 {
+		t.Errorf("files %q left in -dir with an absolute -db", got)
+	}
+}
+
+func TestCleanup(t *testing.T) {
+	dir := t.TempDir()
+	out := runDemo(t, "-dir", dir, "-cleanup", "group", "files", "sql", "csv")
+	if !strings.Contains(out, "== csv ==") {
+		t.Errorf("output = %q", out)
+	}
+	if got := dirEntries(t, dir); len(got) != 0 {
+		t.Errorf("files %q left with -cleanup", got)
+	}
+}
+
+func TestUnknownCommand(t *testing.T) {
+	err := mainErr([]string{"-dir", t.TempDir(), "nope"}, new(bytes.Buffer))
+	if err == nil || !strings.Contains(err.Error(), `"nope"`) {
+		t.Errorf("mainErr = %v, want an unknown command error", err)
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the demo")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("no go tool to build the demo")
+	}
+	demo := filepath.Join(t.TempDir(), "demo")
+	build := exec.Command(goTool, "build", "-o", demo, ".")
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("go build: %v\n%s", err, out)
+	}
+
+	err = exec.Command(demo, "-dir", t.TempDir(), "nope").Run()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+		t.Errorf("demo with an unknown command exited with %v, want exit status 1", err)
+	}
+}
+
+func TestMainPrints(t *testing.T) {
+	args := os.Args
+	t.Cleanup(func() {
+		os.Args = args
+	})
+	os.Args = []string{"demo", "-dir", t.TempDir(), "group"}
+	stdout, stderr, err := resource.CaptureOutput(func() error {
+		main()
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := runDemo(t, "-dir", t.TempDir(), "group"); stdout != want || stderr != "" {
+		t.Errorf("main printed %q and %q to stderr, want %q", stdout, stderr, want)
+	}
+}
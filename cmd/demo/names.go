@@ -0,0 +1,195 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+var namesCSVHeader = []string{"id", "name"}
+
+// importChunk is how many names ImportNamesCSV inserts per transaction.
+const importChunk = 100
+
+// ExportNamesCSV writes the names table to a CSV file at path, with an id,name header,
+// and returns how many rows it wrote. A failed export leaves path as it was.
+func ExportNamesCSV(db resource.DBResource, path string) (int, error) {
+	return resource.UseValue(resource.FromUsable(db), func(db *sql.DB) (int, error) {
+		count := 0
+		file := resource.NewCSVFileResource(path, OwnerRWOnly, resource.CSVHeader(namesCSVHeader...), resource.CSVAtomic())
+		err := file.Use(func(w *csv.Writer) error {
+			return resource.QueryRows(db, "SELECT id, name FROM names ORDER BY id").Use(func(rows *sql.Rows) error {
+				for rows.Next() {
+					var id int64
+					var name string
+					err := rows.Scan(&id, &name)
+					if err != nil {
+						return err
+					}
+					err = w.Write([]string{strconv.FormatInt(id, 10), name})
+					if err != nil {
+						return err
+					}
+					count++
+				}
+				return rows.Err()
+			})
+		})
+		if err != nil {
+			return 0, err
+		}
+		return count, nil
+	})
+}
+
+type importOptions struct {
+	skipDuplicates bool
+}
+
+// ImportOption configures ImportNamesCSV.
+type ImportOption func(options *importOptions)
+
+// SkipDuplicateNames skips the names already in the table, or earlier in the file, instead of inserting them again.
+func SkipDuplicateNames() ImportOption {
+	return func(options *importOptions) {
+		options.skipDuplicates = true
+	}
+}
+
+// ImportNamesCSV inserts the names of a CSV file written by ExportNamesCSV into the names table
+// and returns how many it inserted. The ids of the file are ignored, the table assigns new ones.
+//
+// The names are inserted importChunk at a time, one transaction per chunk:
+// when a chunk fails, the chunks before it stay inserted.
+// Malformed rows fail the import with their line number.
+func ImportNamesCSV(db resource.DBResource, path string, opts ...ImportOption) (int, error) {
+	var options importOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return resource.UseValue(resource.FromUsable(db), func(db *sql.DB) (int, error) {
+		inserted := 0
+		seen := make(map[string]bool)
+		flush := func(chunk []string) error {
+			n, err := insertNames(db, chunk, options.skipDuplicates)
+			inserted += n
+			return err
+		}
+
+		err := resource.NewReadFileResource(path).Use(func(file io.Reader) error {
+			r := csv.NewReader(file)
+			r.FieldsPerRecord = len(namesCSVHeader)
+			header, err := r.Read()
+			if err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			if strings.Join(header, ",") != strings.Join(namesCSVHeader, ",") {
+				return fmt.Errorf("%s:1: header %q, want %q", path, header, namesCSVHeader)
+			}
+
+			var chunk []string
+			for {
+				record, err := r.Read()
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				if err != nil {
+					// a csv.ParseError, which tells the line
+					return fmt.Errorf("%s: %w", path, err)
+				}
+				line, _ := r.FieldPos(1)
+				name := record[1]
+				if name == "" {
+					return fmt.Errorf("%s:%d: empty name", path, line)
+				}
+				if options.skipDuplicates {
+					if seen[name] {
+						continue
+					}
+					seen[name] = true
+				}
+
+				chunk = append(chunk, name)
+				if len(chunk) == importChunk {
+					err = flush(chunk)
+					if err != nil {
+						return err
+					}
+					chunk = chunk[:0]
+				}
+			}
+			return flush(chunk)
+		})
+		return inserted, err
+	})
+}
+
+// insertNames inserts names in a single statement of a transaction of its own, without those already
+// in the table when skipDuplicates is set, and returns how many it inserted.
+func insertNames(db *sql.DB, names []string, skipDuplicates bool) (int, error) {
+	if len(names) == 0 {
+		return 0, nil
+	}
+	return resource.UseValue(resource.RunTransaction(db), func(tx *sql.Tx) (int, error) {
+		if skipDuplicates {
+			var err error
+			names, err = newNames(tx, names)
+			if err != nil || len(names) == 0 {
+				return 0, err
+			}
+		}
+
+		values := make([]string, len(names))
+		args := make([]any, len(names))
+		for i, name := range names {
+			values[i] = "(?)"
+			args[i] = name
+		}
+		_, err := tx.Exec("INSERT INTO names (name) VALUES "+strings.Join(values, ", "), args...)
+		if err != nil {
+			return 0, err
+		}
+		return len(names), nil
+	})
+}
+
+// newNames returns the names which aren't in the table yet.
+func newNames(tx *sql.Tx, names []string) ([]string, error) {
+	placeholders := make([]string, len(names))
+	args := make([]any, len(names))
+	for i, name := range names {
+		placeholders[i] = "?"
+		args[i] = name
+	}
+	existing := make(map[string]bool)
+	query := "SELECT name FROM names WHERE name IN (" + strings.Join(placeholders, ", ") + ")"
+	err := resource.QueryRows(tx, query, args...).Use(func(rows *sql.Rows) error {
+		for rows.Next() {
+			var name string
+			err := rows.Scan(&name)
+			if err != nil {
+				return err
+			}
+			existing[name] = true
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var fresh []string
+	for _, name := range names {
+		if !existing[name] {
+			fresh = append(fresh, name)
+		}
+	}
+	return fresh, nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+// newNamesDB returns the resource of a new database with the names table in a test directory.
+func newNamesDB(t *testing.T) resource.DBResource {
+	t.Helper()
+	db := resource.NewDBResource("sqlite3", filepath.Join(t.TempDir(), "names.db"))
+	_, err := resource.Exec(resource.FromUsable(db), createTableQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// tableNames returns the names of the table in id order.
+func tableNames(t *testing.T, db resource.DBResource) []string {
+	t.Helper()
+	names, err := resource.UseValue(resource.FromUsable(db), func(db *sql.DB) ([]string, error) {
+		var names []string
+		err := resource.QueryRows(db, "SELECT name FROM names ORDER BY id").Use(func(rows *sql.Rows) error {
+			for rows.Next() {
+				var name string
+				err := rows.Scan(&name)
+				if err != nil {
+					return err
+				}
+				names = append(names, name)
+			}
+			return rows.Err()
+		})
+		return names, err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return names
+}
+
+func TestNamesCSVRoundTrip(t *testing.T) {
+	db := newNamesDB(t)
+	var want []string
+	for i := range 2*importChunk + 50 {
+		want = append(want, fmt.Sprintf("name %d", i))
+	}
+	want = append(want, `with "quotes"`, "with, comma", "with\nnewline")
+	for _, name := range want {
+		_, err := resource.Exec(resource.FromUsable(db), addNameQuery, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "names.csv")
+	exported, err := ExportNamesCSV(db, path)
+	if err != nil || exported != len(want) {
+		t.Fatalf("ExportNamesCSV = %d, %v, want %d", exported, err, len(want))
+	}
+	_, err = resource.Exec(resource.FromUsable(db), "DELETE FROM names")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	imported, err := ImportNamesCSV(db, path)
+	if err != nil || imported != len(want) {
+		t.Fatalf("ImportNamesCSV = %d, %v, want %d", imported, err, len(want))
+	}
+	if got := tableNames(t, db); !slices.Equal(got, want) {
+		t.Errorf("%d names after the round trip, want the %d exported in order", len(got), len(want))
+	}
+}
+
+func TestImportNamesCSVSkipsDuplicates(t *testing.T) {
+	db := newNamesDB(t)
+	path := filepath.Join(t.TempDir(), "names.csv")
+	err := os.WriteFile(path, []byte("id,name\n1,alice\n2,bob\n3,alice\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	imported, err := ImportNamesCSV(db, path, SkipDuplicateNames())
+	if err != nil || imported != 2 {
+		t.Errorf("first ImportNamesCSV = %d, %v, want 2", imported, err)
+	}
+	imported, err = ImportNamesCSV(db, path, SkipDuplicateNames())
+	if err != nil || imported != 0 {
+		t.Errorf("second ImportNamesCSV = %d, %v, want 0", imported, err)
+	}
+	if got := tableNames(t, db); !slices.Equal(got, []string{"alice", "bob"}) {
+		t.Errorf("names = %q", got)
+	}
+
+	imported, err = ImportNamesCSV(db, path)
+	if err != nil || imported != 3 {
+		t.Errorf("ImportNamesCSV without skipping = %d, %v, want 3", imported, err)
+	}
+}
+
+func TestImportNamesCSVMalformed(t *testing.T) {
+	for _, test := range []struct {
+		name, content, want string
+	}{
+		{"header", "number,name\n1,alice\n", "names.csv:1: header"},
+		{"fields", "id,name\n1,alice\n2\n", "line 3"},
+		{"quote", "id,name\n1,alice\n2,bob\n3,\"carol\n", "line 4"},
+		{"empty name", "id,name\n1,alice\n2,\n", "names.csv:3: empty name"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			db := newNamesDB(t)
+			path := filepath.Join(t.TempDir(), "names.csv")
+			err := os.WriteFile(path, []byte(test.content), 0o600)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = ImportNamesCSV(db, path)
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("ImportNamesCSV = %v, want an error with %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestExportNamesCSVFailureLeavesTheFile(t *testing.T) {
+	db := newNamesDB(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "names.csv")
+	err := os.WriteFile(path, []byte("previous export\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = resource.Exec(resource.FromUsable(db), "DROP TABLE names")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = ExportNamesCSV(db, path)
+	if err == nil {
+		t.Fatal("ExportNamesCSV without the names table succeeded")
+	}
+	content, err := os.ReadFile(path)
+	if err != nil || string(content) != "previous export\n" {
+		t.Errorf("file after the failed export = %q, %v, want it as it was", content, err)
+	}
+	if entries := dirEntries(t, dir); len(entries) != 1 {
+		t.Errorf("files = %q, want no partial export left", entries)
+	}
+}
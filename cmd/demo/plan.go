@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Q69K/using-cps-in-golang/cps/group"
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+// PlanStep is a step of a plan file, a JSON array of steps:
+//
+//	[
+//		{"type": "write", "path": "hello.txt", "content": "hello"},
+//		{"type": "query", "query": "INSERT INTO names (name) VALUES (?)", "args": ["plan"]},
+//		{"type": "spawn", "tasks": 4}
+//	]
+//
+// write creates a new file, relative to -dir, query runs a statement on the -db database
+// and spawn runs parallel tasks.
+type PlanStep struct {
+	Type    string `json:"type"`
+	Path    string `json:"path,omitempty"`
+	Content string `json:"content,omitempty"`
+	Query   string `json:"query,omitempty"`
+	Args    []any  `json:"args,omitempty"`
+	Tasks   int    `json:"tasks,omitempty"`
+
+	line int
+}
+
+// PlanError is a step of a plan file failing validation.
+type PlanError struct {
+	Path string
+	Line int
+	Step int // starting from 1
+	Err  error
+}
+
+func (e *PlanError) Error() string {
+	return fmt.Sprintf("%s:%d: step %d: %v", e.Path, e.Line, e.Step, e.Err)
+}
+
+func (e *PlanError) Unwrap() error {
+	return e.Err
+}
+
+// ParsePlan reads and validates the plan file at path. Every invalid step is reported, none is run.
+func ParsePlan(path string) ([]PlanStep, error) {
+	data, err := resource.UseValue(resource.NewReadFileResource(path), func(r io.Reader) ([]byte, error) {
+		return io.ReadAll(r)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	token, err := dec.Token()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if token != json.Delim('[') {
+		return nil, fmt.Errorf("%s: a plan is an array of steps", path)
+	}
+
+	var steps []PlanStep
+	var errs []error
+	for dec.More() {
+		line := lineAt(data, dec.InputOffset())
+		var raw json.RawMessage
+		err := dec.Decode(&raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+
+		step := PlanStep{line: line}
+		stepDec := json.NewDecoder(bytes.NewReader(raw))
+		stepDec.DisallowUnknownFields()
+		err = stepDec.Decode(&step)
+		if err == nil {
+			err = step.validate()
+		}
+		if err != nil {
+			errs = append(errs, &PlanError{Path: path, Line: line, Step: len(steps) + 1, Err: err})
+		}
+		steps = append(steps, step)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return steps, nil
+}
+
+// lineAt is the line of the first value at or after offset in data.
+func lineAt(data []byte, offset int64) int {
+	for offset < int64(len(data)) && strings.IndexByte(" \t\r\n,", data[offset]) >= 0 {
+		offset++
+	}
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
+
+func (s PlanStep) validate() error {
+	switch s.Type {
+	case "write":
+		if s.Path == "" {
+			return errors.New("write step without path")
+		}
+	case "query":
+		if s.Query == "" {
+			return errors.New("query step without query")
+		}
+	case "spawn":
+		if s.Tasks < 1 {
+			return errors.New("spawn step without tasks")
+		}
+	case "":
+		return errors.New("step without type")
+	default:
+		return fmt.Errorf("unknown step type %q, want write, query or spawn", s.Type)
+	}
+	return nil
+}
+
+// planRun runs the steps of a plan, every step holding its resource while the next ones run:
+// when a step fails, the files written before are removed and the queries rolled back.
+type planRun struct {
+	config demoConfig
+	steps  []PlanStep
+	rows   [][]string
+
+	db *sql.DB
+	tx *sql.Tx // of the first query step, shared by the next ones
+}
+
+func planDemo(r *Reporter, config demoConfig) error {
+	if config.planPath == "" {
+		return errors.New("plan needs -plan")
+	}
+	steps, err := ParsePlan(config.planPath)
+	if err != nil {
+		return err
+	}
+
+	run := &planRun{config: config, steps: steps}
+	err = run.withDB(func() error {
+		return run.from(0)
+	})
+	r.Rows([]string{"step", "type", "result"}, run.rows)
+	return err
+}
+
+// withDB opens the database for fn when a step needs it.
+func (run *planRun) withDB(fn func() error) error {
+	for _, step := range run.steps {
+		if step.Type == "query" {
+			return resource.NewDBResource("sqlite3", run.config.dbPath).Use(func(db *sql.DB) error {
+				run.db = db
+				return fn()
+			})
+		}
+	}
+	return fn()
+}
+
+// from runs the steps from i on.
+func (run *planRun) from(i int) error {
+	if i == len(run.steps) {
+		return nil
+	}
+	step := run.steps[i]
+	report := func(result string) {
+		run.rows = append(run.rows, []string{strconv.Itoa(i + 1), step.Type, result})
+	}
+	next := func() error {
+		return run.from(i + 1)
+	}
+
+	var err error
+	switch step.Type {
+	case "write":
+		err = run.write(step, report, next)
+	case "query":
+		err = run.query(step, report, next)
+	case "spawn":
+		err = run.spawn(step, report, next)
+	}
+	var failed *planStepError
+	if err != nil && !errors.As(err, &failed) {
+		return &planStepError{step: i + 1, line: step.line, err: err}
+	}
+	return err
+}
+
+// planStepError is the error of the step which failed, the next ones not having run.
+type planStepError struct {
+	step, line int
+	err        error
+}
+
+func (e *planStepError) Error() string {
+	return fmt.Sprintf("step %d (line %d): %v", e.step, e.line, e.err)
+}
+
+func (e *planStepError) Unwrap() error {
+	return e.err
+}
+
+// write creates the file of the step, removed if a next step fails.
+func (run *planRun) write(step PlanStep, report func(string), next func() error) error {
+	path := step.Path
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(run.config.dir, path)
+	}
+	err := resource.NewFileResource(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, OwnerRWOnly).Use(func(file *os.File) error {
+		_, err := file.WriteString(step.Content)
+		return err
+	})
+	if err != nil {
+		report("failed")
+		return err
+	}
+	report(fmt.Sprintf("wrote %d bytes to %s", len(step.Content), path))
+
+	err = next()
+	if err != nil {
+		removeErr := os.Remove(path)
+		if removeErr != nil {
+			return errors.Join(err, removeErr)
+		}
+	}
+	return err
+}
+
+// query runs the query of the step in the transaction of the plan, started by the first query step
+// and committed once all the steps succeeded.
+func (run *planRun) query(step PlanStep, report func(string), next func() error) error {
+	if run.tx != nil {
+		return run.runQuery(run.tx, step, report, next)
+	}
+	return resource.RunTransaction(run.db).Use(func(tx *sql.Tx) error {
+		run.tx = tx
+		defer func() {
+			run.tx = nil
+		}()
+		return run.runQuery(tx, step, report, next)
+	})
+}
+
+func (run *planRun) runQuery(tx *sql.Tx, step PlanStep, report func(string), next func() error) error {
+	verb, _, _ := strings.Cut(strings.TrimSpace(step.Query), " ")
+	if strings.EqualFold(verb, "SELECT") || strings.EqualFold(verb, "WITH") {
+		rows := 0
+		err := resource.QueryRows(tx, step.Query, step.Args...).Use(func(r *sql.Rows) error {
+			for r.Next() {
+				rows++
+			}
+			return r.Err()
+		})
+		if err != nil {
+			report("failed")
+			return err
+		}
+		report(fmt.Sprintf("%d rows", rows))
+		return next()
+	}
+
+	result, err := tx.Exec(step.Query, step.Args...)
+	if err != nil {
+		report("failed")
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		report("failed")
+		return err
+	}
+	report(fmt.Sprintf("%d rows affected", affected))
+	return next()
+}
+
+// spawn runs the tasks of the step in parallel.
+func (run *planRun) spawn(step PlanStep, report func(string), next func() error) error {
+	done := group.RunGroupCollect(step.Tasks, func(i int) int {
+		return i + 1
+	})
+	report(fmt.Sprintf("%d tasks done", len(done)))
+	return next()
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// runPlan runs testdata/plans/name.json in a new directory, checking the output and the error
+// against testdata/plans/name.golden, the directory written as $DIR.
+func runPlan(t *testing.T, name string) (dir string, err error) {
+	t.Helper()
+	dir = t.TempDir()
+	var out bytes.Buffer
+	err = mainErr([]string{"-dir", dir, "-plan", filepath.Join("testdata", "plans", name+".json")}, &out)
+	got := out.String()
+	if err != nil {
+		got += "error: " + err.Error() + "\n"
+	}
+	checkGolden(t, filepath.Join("plans", name+".golden"), strings.ReplaceAll(got, dir, "$DIR"))
+	return dir, err
+}
+
+// countNames counts the rows of the names table of the database at path.
+func countNames(t *testing.T, path string) (int, error) {
+	t.Helper()
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var n int
+	err = db.QueryRow("SELECT count(*) FROM names").Scan(&n)
+	return n, err
+}
+
+func TestPlanSteps(t *testing.T) {
+	dir, err := runPlan(t, "steps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(filepath.Join(dir, "hello.txt"))
+	if err != nil || string(content) != "hello, plan" {
+		t.Errorf("hello.txt = %q, %v", content, err)
+	}
+	if n, err := countNames(t, filepath.Join(dir, "demo.sqlite")); err != nil || n != 2 {
+		t.Errorf("%d names, %v, want the 2 inserted committed", n, err)
+	}
+}
+
+func TestPlanValidation(t *testing.T) {
+	dir, err := runPlan(t, "invalid")
+	var planErr *PlanError
+	if !errors.As(err, &planErr) || planErr.Step != 2 || planErr.Line != 3 {
+		t.Fatalf("error = %v, want the *PlanError of step 2 first", err)
+	}
+	if entries := dirEntries(t, dir); len(entries) != 0 {
+		t.Errorf("files = %q, want no step run", entries)
+	}
+}
+
+func TestPlanFailureCleansUp(t *testing.T) {
+	dir, err := runPlan(t, "failing")
+	var stepErr *planStepError
+	if !errors.As(err, &stepErr) || stepErr.step != 4 || stepErr.line != 5 {
+		t.Fatalf("error = %v, want the failure of step 4", err)
+	}
+	// the files written before are removed, the table created before rolled back
+	if entries := dirEntries(t, dir); !slices.Equal(entries, []string{"demo.sqlite"}) {
+		t.Errorf("files = %q, want only the database", entries)
+	}
+	if _, err := countNames(t, filepath.Join(dir, "demo.sqlite")); err == nil || !strings.Contains(err.Error(), "no such table") {
+		t.Errorf("count of names = %v, want the table creation rolled back", err)
+	}
+}
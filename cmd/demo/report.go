@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+// Format is how a Reporter renders its output.
+type Format int
+
+const (
+	// FormatTable is for humans: aligned key/value lines and tables, written as they are reported.
+	FormatTable Format = iota
+	// FormatJSON is a single JSON document written when the reporter is released.
+	FormatJSON
+)
+
+// ParseFormat parses the name of a format, "table" or "json".
+func ParseFormat(name string) (Format, error) {
+	switch name {
+	case "table":
+		return FormatTable, nil
+	case "json":
+		return FormatJSON, nil
+	default:
+		return 0, fmt.Errorf("unknown format %q, want table or json", name)
+	}
+}
+
+// Reporter collects the results of the demos in sections. It is safe for concurrent use.
+type Reporter struct {
+	format Format
+	w      *bufio.Writer
+
+	mu       sync.Mutex
+	sections []*reportSection
+	err      error // the first invalid call, or write error
+}
+
+type reportSection struct {
+	Name   string         `json:"name"`
+	Values []reportValue  `json:"values,omitempty"`
+	Tables []*reportTable `json:"tables,omitempty"`
+}
+
+type reportValue struct {
+	Key   string `json:"key"`
+	Value any    `json:"value"`
+}
+
+type reportTable struct {
+	Headers []string   `json:"headers"`
+	Rows    [][]string `json:"rows"`
+}
+
+// NewReporter gives the callback a reporter writing to w in format.
+// On release it writes what's left and returns the first invalid call or write error, if any;
+// when the callback fails the JSON document isn't written.
+func NewReporter(w io.Writer, format Format) resource.Resource[*Reporter] {
+	return resource.Resource[*Reporter]{
+		Use: func(callback func(r *Reporter) error) error {
+			r := &Reporter{format: format, w: bufio.NewWriter(w), sections: []*reportSection{}}
+			err := callback(r)
+			if err != nil {
+				_ = r.w.Flush()
+				return err
+			}
+			return r.close()
+		},
+		Description: "reporter",
+	}
+}
+
+// Section starts a new section, which the next values and rows belong to.
+func (r *Reporter) Section(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sections = append(r.sections, &reportSection{Name: name})
+	if r.format == FormatTable {
+		if len(r.sections) > 1 {
+			r.write("\n")
+		}
+		r.write("== " + name + " ==\n")
+	}
+}
+
+// KV reports a value of the current section.
+func (r *Reporter) KV(key string, value any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	section := r.current()
+	if section == nil {
+		return
+	}
+	section.Values = append(section.Values, reportValue{Key: key, Value: value})
+	if r.format == FormatTable {
+		r.write(fmt.Sprintf("%s: %v\n", key, value))
+	}
+}
+
+// Rows reports a table of the current section; every row must have one cell per header.
+func (r *Reporter) Rows(headers []string, rows [][]string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	section := r.current()
+	if section == nil {
+		return
+	}
+	for i, row := range rows {
+		if len(row) != len(headers) {
+			r.fail(fmt.Errorf("report %s: row %d has %d cells for %d headers", section.Name, i, len(row), len(headers)))
+			return
+		}
+	}
+	section.Tables = append(section.Tables, &reportTable{Headers: headers, Rows: rows})
+	if r.format == FormatTable {
+		var b strings.Builder
+		tw := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.Join(headers, "\t"))
+		for _, row := range rows {
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+		_ = tw.Flush()
+		r.write(b.String())
+	}
+}
+
+// current is the last section, failing the report when there is none.
+func (r *Reporter) current() *reportSection {
+	if len(r.sections) == 0 {
+		r.fail(errors.New("report: value outside of a section"))
+		return nil
+	}
+	return r.sections[len(r.sections)-1]
+}
+
+// write writes s right away: the table format is streamed, for the demos reporting progress.
+func (r *Reporter) write(s string) {
+	_, err := r.w.WriteString(s)
+	if err == nil {
+		err = r.w.Flush()
+	}
+	r.fail(err)
+}
+
+func (r *Reporter) fail(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+func (r *Reporter) close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		_ = r.w.Flush()
+		return r.err
+	}
+	if r.format == FormatJSON {
+		enc := json.NewEncoder(r.w)
+		enc.SetIndent("", "  ")
+		err := enc.Encode(struct {
+			Sections []*reportSection `json:"sections"`
+		}{r.sections})
+		if err != nil {
+			return err
+		}
+	}
+	return r.w.Flush()
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of testdata")
+
+// checkGolden compares got with testdata/name, rewriting it instead with -update.
+func checkGolden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		err := os.WriteFile(path, []byte(got), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(want) {
+		t.Errorf("output differs from %s:\n%s\nwant:\n%s", path, got, want)
+	}
+}
+
+// report reports the sections of the golden files.
+func report(r *Reporter) error {
+	r.Section("files")
+	r.KV("written", 3)
+	r.KV("dir", "/tmp/demo")
+	r.Rows([]string{"name", "size"}, [][]string{{"test1.txt", "10"}, {"a longer name.txt", "1024"}})
+	r.Section("sql")
+	r.KV("cool", "Hello, #1")
+	r.KV("exported", true)
+	return nil
+}
+
+func TestReporterGolden(t *testing.T) {
+	for _, test := range []struct {
+		format Format
+		golden string
+	}{
+		{FormatTable, "report.table.golden"},
+		{FormatJSON, "report.json.golden"},
+	} {
+		t.Run(test.golden, func(t *testing.T) {
+			var out bytes.Buffer
+			err := NewReporter(&out, test.format).Use(report)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, test.golden, out.String())
+			if test.format == FormatJSON && !json.Valid(out.Bytes()) {
+				t.Error("invalid JSON")
+			}
+		})
+	}
+}
+
+func TestReporterInvalidCalls(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		callback func(r *Reporter) error
+		want     string
+	}{
+		{"value outside of a section", func(r *Reporter) error {
+			r.KV("key", 1)
+			return nil
+		}, "value outside of a section"},
+		{"row of the wrong size", func(r *Reporter) error {
+			r.Section("files")
+			r.Rows([]string{"name", "size"}, [][]string{{"a", "1"}, {"b"}})
+			return nil
+		}, "report files: row 1 has 1 cells for 2 headers"},
+	} {
+		for _, format := range []Format{FormatTable, FormatJSON} {
+			var out bytes.Buffer
+			err := NewReporter(&out, format).Use(test.callback)
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("%s in format %d: Use = %v, want %q", test.name, format, err, test.want)
+			}
+			if format == FormatJSON && out.Len() != 0 {
+				t.Errorf("%s: JSON %q written", test.name, out.String())
+			}
+		}
+	}
+}
+
+func TestReporterCallbackFailure(t *testing.T) {
+	errDemo := errors.New("demo failed")
+	for _, format := range []Format{FormatTable, FormatJSON} {
+		var out bytes.Buffer
+		err := NewReporter(&out, format).Use(func(r *Reporter) error {
+			r.Section("sql")
+			r.KV("cool", "Hello, #1")
+			return errDemo
+		})
+		if !errors.Is(err, errDemo) {
+			t.Errorf("Use = %v, want the error of the callback", err)
+		}
+		// the table streamed so far is kept, the JSON document isn't written
+		if got, want := out.String(), map[Format]string{FormatTable: "== sql ==\ncool: Hello, #1\n"}[format]; got != want {
+			t.Errorf("format %d: output = %q, want %q", format, got, want)
+		}
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestReporterWriteError(t *testing.T) {
+	for _, format := range []Format{FormatTable, FormatJSON} {
+		err := NewReporter(failingWriter{}, format).Use(report)
+		if err == nil || !strings.Contains(err.Error(), "disk full") {
+			t.Errorf("format %d: Use = %v, want the write error", format, err)
+		}
+	}
+}
+
+func TestFormatFlag(t *testing.T) {
+	out := runDemo(t, "-dir", t.TempDir(), "-format", "json", "group")
+	var doc struct {
+		Sections []struct {
+			Name   string `json:"name"`
+			Values []struct {
+				Key   string `json:"key"`
+				Value any    `json:"value"`
+			} `json:"values"`
+		} `json:"sections"`
+	}
+	err := json.Unmarshal([]byte(out), &doc)
+	if err != nil {
+		t.Fatalf("output %q: %v", out, err)
+	}
+	if len(doc.Sections) != 1 || doc.Sections[0].Name != "group" || len(doc.Sections[0].Values) != 1 || doc.Sections[0].Values[0].Key != "result" {
+		t.Errorf("document = %+v, want the result of the group section", doc)
+	}
+
+	_, err = ParseFormat("yaml")
+	if err == nil {
+		t.Error("ParseFormat of yaml succeeded")
+	}
+	err = mainErr([]string{"-dir", t.TempDir(), "-format", "yaml", "group"}, new(bytes.Buffer))
+	if err == nil || !strings.Contains(err.Error(), `"yaml"`) {
+		t.Errorf("mainErr = %v, want the unknown format", err)
+	}
+}
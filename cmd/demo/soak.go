@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/group"
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+	"github.com/Q69K/using-cps-in-golang/cps/sqlerr"
+)
+
+const createSoakTableQuery = `
+	CREATE TABLE IF NOT EXISTS soak (
+		worker INTEGER NOT NULL,
+		n INTEGER NOT NULL
+	)
+`
+
+// soakRetry retries the transactions failing with a busy database, as sqlerr tells sqlite3 errors.
+var soakRetry = func() resource.RetryPolicy {
+	policy := resource.ExponentialBackoff(time.Millisecond, 100*time.Millisecond, 20, 0.5)
+	policy.Classify = sqlerr.IsBusy
+	return policy
+}()
+
+// soakDemo runs workers until the duration is over, each one writing and reading back a file of its own,
+// then inserting and counting rows through a shared database, and fails on errors or leaked resources.
+func soakDemo(r *Reporter, config demoConfig) error {
+	stats := resource.NewStatsCollector()
+	resource.SetStatsCollector(stats)
+	defer resource.SetStatsCollector(nil)
+
+	shared := resource.NewSharedDBResource("sqlite3", config.dbPath)
+	defer shared.Shutdown()
+	_, err := resource.Exec(resource.FromUsable[*sql.DB](shared), createSoakTableQuery)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.soakDuration)
+	defer cancel()
+
+	var iterations atomic.Int64
+	var mu sync.Mutex
+	var errs []error
+	workers := group.NewBoundedSpawner(config.soakWorkers)
+	for worker := range config.soakWorkers {
+		workers.Run(func() {
+			defer os.Remove(filepath.Join(config.dir, fmt.Sprintf("soak-%d.txt", worker)))
+			for n := 0; ctx.Err() == nil; n++ {
+				err := soakOnce(ctx, shared, config.dir, worker, n)
+				if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+					mu.Lock()
+					errs = append(errs, fmt.Errorf("worker %d: %w", worker, err))
+					mu.Unlock()
+					return
+				}
+				iterations.Add(1)
+			}
+		})
+	}
+	workers.Wait()
+
+	r.KV("workers", config.soakWorkers)
+	r.KV("duration", config.soakDuration.String())
+	r.KV("iterations", iterations.Load())
+	r.KV("errors", len(errs))
+	r.Rows(soakStatsRows(stats.Stats()))
+
+	leakErr := resource.VerifyNoneOpen()
+	if leakErr != nil {
+		errs = append(errs, leakErr)
+	}
+	return errors.Join(errs...)
+}
+
+func soakOnce(ctx context.Context, shared *resource.SharedDBResource, dir string, worker, n int) error {
+	content := fmt.Sprintf("worker %d iteration %d", worker, n)
+	path := filepath.Join(dir, fmt.Sprintf("soak-%d.txt", worker))
+	err := resource.NewFileResource(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, OwnerRWOnly).Use(func(file *os.File) error {
+		_, err := io.WriteString(file, content)
+		if err != nil {
+			return err
+		}
+		_, err = file.Seek(0, io.SeekStart)
+		if err != nil {
+			return err
+		}
+		read, err := io.ReadAll(file)
+		if err != nil {
+			return err
+		}
+		if string(read) != content {
+			return fmt.Errorf("%s: read back %q, wrote %q", file.Name(), read, content)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return shared.Use(func(db *sql.DB) error {
+		return resource.RunTransactionRetry(ctx, db, soakRetry).Use(func(tx *sql.Tx) error {
+			_, err := tx.Exec("INSERT INTO soak (worker, n) VALUES (?, ?)", worker, n)
+			if err != nil {
+				return err
+			}
+			var count int
+			err = tx.QueryRow("SELECT COUNT(*) FROM soak WHERE worker = ?", worker).Scan(&count)
+			if err != nil {
+				return err
+			}
+			if count < n+1 {
+				return fmt.Errorf("%d rows of worker %d after %d inserts", count, worker, n+1)
+			}
+			return nil
+		})
+	})
+}
+
+func soakStatsRows(stats map[string]resource.ResourceStats) ([]string, [][]string) {
+	kinds := make([]string, 0, len(stats))
+	for kind := range stats {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	headers := []string{"kind", "acquisitions", "acquire failures", "use failures", "release failures", "open"}
+	var rows [][]string
+	for _, kind := range kinds {
+		s := stats[kind]
+		rows = append(rows, []string{kind,
+			strconv.FormatInt(s.Acquisitions, 10), strconv.FormatInt(s.AcquireFailures, 10),
+			strconv.FormatInt(s.UseFailures, 10), strconv.FormatInt(s.ReleaseFailures, 10),
+			strconv.FormatInt(s.Open, 10)})
+	}
+	return headers, rows
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestSoak is a miniature soak run, for the race detector to watch the shared database,
+// the bounded spawner and the busy retries together.
+func TestSoak(t *testing.T) {
+	dir := t.TempDir()
+	out := runDemo(t, "-dir", dir, "-duration", "2s", "-workers", "8", "soak")
+	if !strings.Contains(out, "workers: 8\n") || !strings.Contains(out, "errors: 0\n") {
+		t.Errorf("output = %q, want 8 workers without errors", out)
+	}
+	match := regexp.MustCompile(`iterations: (\d+)\n`).FindStringSubmatch(out)
+	if match == nil {
+		t.Fatalf("output = %q, want the iterations", out)
+	}
+	if n, _ := strconv.Atoi(match[1]); n < 8 {
+		t.Errorf("%d iterations, want at least one per worker", n)
+	}
+	// a file per iteration, none failing or left open
+	if stats := regexp.MustCompile(`(?m)^file\s+(\d+)\s+0\s+0\s+0\s+0$`).FindStringSubmatch(out); stats == nil || stats[1] != match[1] {
+		t.Errorf("output = %q, want the stats of the %s files without failures", out, match[1])
+	}
+	if got := dirEntries(t, dir); len(got) != 1 || got[0] != "demo.sqlite" {
+		t.Errorf("files %q left, want only the database", got)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+const addNameQuery = "INSERT INTO names (name) VALUES (?)"
+const createTableQuery = `
+	CREATE TABLE IF NOT EXISTS names (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name VARCHAR NOT NULL
+	)
+`
+
+
+func initDB(db *sql.DB) error {
+	_, err := db.Exec(createTableQuery)
+	return err
+}
+
+
+func helloSql_NotCoolAtAll(db *sql.DB, name string) (string, error) {
+	// too much bad code to write here
+	return "", nil
+}
+
+
+func helloSql_Cool(db *sql.DB, name string) (string, error) {
+	return resource.UseValue(resource.RunTransaction(db), func(tx *sql.Tx) (string, error) {
+
+		id, err := resource.ExecReturningID(tx, addNameQuery, name)
+		if err != nil {
+			return "", err
+		}
+
+		return fmt.Sprintf("Hello, #%d", id), nil
+	})
+}
+
+// namesSummary counts the names and finds the last id in one snapshot, so both agree
+// even if names are inserted meanwhile.
+func namesSummary(db *sql.DB) (string, error) {
+	var count, last int64
+	err := resource.WithSnapshot(db, func(q resource.Queryer) error {
+		err := q.QueryRowContext(context.Background(), "SELECT count(*) FROM names").Scan(&count)
+		if err != nil {
+			return err
+		}
+		return q.QueryRowContext(context.Background(), "SELECT coalesce(max(id), 0) FROM names").Scan(&last)
+	})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d, last #%d", count, last), nil
+}
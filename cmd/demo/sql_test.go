@@ -0,0 +1,64 @@
+package main
+
+import (
+	"database/sql"
+	"sync"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+	"github.com/Q69K/using-cps-in-golang/cps/resource/resourcetest"
+)
+
+var namesSchema = []resource.Migration{{Version: 1, Name: "names", Up: createTableQuery}}
+
+func TestHelloSqlCool(t *testing.T) {
+	resourcetest.WithTestDB(t, namesSchema, func(db *sql.DB) {
+		for _, want := range []string{"Hello, #1", "Hello, #2"} {
+			got, err := helloSql_Cool(db, "gopher")
+			if err != nil || got != want {
+				t.Errorf("helloSql_Cool = %q, %v, want %q", got, err, want)
+			}
+		}
+		summary, err := namesSummary(db)
+		if err != nil || summary != "2, last #2" {
+			t.Errorf("namesSummary = %q, %v", summary, err)
+		}
+	})
+}
+
+func TestHelloSqlCoolConcurrent(t *testing.T) {
+	resourcetest.WithTestDB(t, namesSchema, func(db *sql.DB) {
+		var wg sync.WaitGroup
+		for range 10 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := helloSql_Cool(db, "gopher")
+				if err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+		summary, err := namesSummary(db)
+		if err != nil || summary != "10, last #10" {
+			t.Errorf("namesSummary = %q, %v", summary, err)
+		}
+	}, resourcetest.SharedMemory())
+}
+
+func TestHelloSqlCoolRollsBack(t *testing.T) {
+	resourcetest.WithTestDB(t, namesSchema, func(db *sql.DB) {
+		_, err := db.Exec("DROP TABLE names")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = helloSql_Cool(db, "gopher")
+		if err == nil {
+			t.Error("helloSql_Cool without the names table succeeded")
+		}
+		if inUse := db.Stats().InUse; inUse != 0 {
+			t.Errorf("%d connections still in use", inUse)
+		}
+	})
+}
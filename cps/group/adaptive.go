@@ -0,0 +1,186 @@
+package group
+
+import (
+	"sync"
+	"time"
+)
+
+// Load is a load signal of an adaptive spawner: the latency of the recent tasks.
+type Load struct {
+	Latency time.Duration
+}
+
+// ConcurrencyStats is the state of an adaptive spawner.
+type ConcurrencyStats struct {
+	Limit   int
+	Active  int
+	Waiting int           // Run calls blocked for a slot
+	Latency time.Duration // the last load signal
+}
+
+// AdaptiveSpawner is a bounded spawner whose limit follows the load.
+type AdaptiveSpawner interface {
+	SafeWaitGroup
+	// Observe returns the current limit and load, for dashboards.
+	Observe() ConcurrencyStats
+}
+
+// AdaptiveOption configures NewAdaptiveSpawner.
+type AdaptiveOption func(s *adaptiveSpawner)
+
+// AdaptInterval sets how often the limit is re-evaluated, every 100ms by default.
+func AdaptInterval(d time.Duration) AdaptiveOption {
+	return func(s *adaptiveSpawner) {
+		s.interval = d
+	}
+}
+
+// AdaptClock makes the spawner measure the task latencies and tick with clock, for deterministic tests.
+func AdaptClock(clock Clock) AdaptiveOption {
+	return func(s *adaptiveSpawner) {
+		s.clock = clock
+	}
+}
+
+// latencyTolerance is how much slower than the best load seen the tasks may get before the limit shrinks.
+const latencyTolerance = 2
+
+// NewAdaptiveSpawner creates a group running at most a limit of tasks at a time, like NewBoundedSpawner,
+// whose limit starts at min and moves between min and max: it shrinks by a quarter when the latency
+// of probe climbs to twice the best latency seen, and grows by one when the latency is close to the best
+// while tasks wait for a slot. A nil probe measures the latency of the tasks themselves, as a moving average.
+//
+// The limit is re-evaluated on a ticker run by the group while it has tasks running or waiting.
+func NewAdaptiveSpawner(min, max int, probe func() Load, opts ...AdaptiveOption) AdaptiveSpawner {
+	if min < 1 {
+		min = 1
+	}
+	if max < min {
+		max = min
+	}
+	s := &adaptiveSpawner{
+		swg:      NewSafeWaitGroup(),
+		min:      min,
+		max:      max,
+		limit:    min,
+		probe:    probe,
+		interval: 100 * time.Millisecond,
+	}
+	s.slot = sync.NewCond(&s.mu)
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.clock = clockOr(s.clock)
+	if s.probe == nil {
+		s.probe = s.latency
+	}
+	return s
+}
+
+type adaptiveSpawner struct {
+	swg      SafeWaitGroup
+	min, max int
+	probe    func() Load
+	interval time.Duration
+	clock    Clock
+
+	mu      sync.Mutex
+	slot    *sync.Cond
+	limit   int
+	active  int
+	waiting int
+	ewma    time.Duration // of the task latencies
+	best    time.Duration // the best load signal seen
+	last    time.Duration // the last load signal
+	ticking bool
+}
+
+func (s *adaptiveSpawner) Run(task func()) {
+	s.mu.Lock()
+	if !s.ticking {
+		s.ticking = true
+		go s.tick()
+	}
+	s.waiting++
+	for s.active >= s.limit {
+		s.slot.Wait()
+	}
+	s.waiting--
+	s.active++
+	s.mu.Unlock()
+
+	s.swg.Run(func() {
+		started := s.clock.Now()
+		defer s.done(started)
+		task()
+	})
+}
+
+func (s *adaptiveSpawner) done(started time.Time) {
+	latency := s.clock.Now().Sub(started)
+	s.mu.Lock()
+	s.active--
+	if s.ewma == 0 {
+		s.ewma = latency
+	} else {
+		s.ewma += (latency - s.ewma) / 5
+	}
+	s.mu.Unlock()
+	s.slot.Signal()
+}
+
+func (s *adaptiveSpawner) Wait() {
+	s.swg.Wait()
+}
+
+func (s *adaptiveSpawner) Observe() ConcurrencyStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return ConcurrencyStats{Limit: s.limit, Active: s.active, Waiting: s.waiting, Latency: s.last}
+}
+
+func (s *adaptiveSpawner) latency() Load {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return Load{Latency: s.ewma}
+}
+
+// tick re-evaluates the limit until the group is idle.
+func (s *adaptiveSpawner) tick() {
+	ticker := s.clock.NewTicker(s.interval)
+	defer ticker.Stop()
+	for range ticker.C() {
+		if !s.adapt() {
+			return
+		}
+	}
+}
+
+// adapt re-evaluates the limit and tells whether the group is still busy;
+// when it's not, the ticker is considered stopped.
+func (s *adaptiveSpawner) adapt() bool {
+	load := s.probe()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if load.Latency > 0 {
+		s.last = load.Latency
+		if s.best == 0 || load.Latency < s.best {
+			s.best = load.Latency
+		}
+		switch {
+		case load.Latency >= s.best*latencyTolerance:
+			s.limit = max(s.min, min(s.limit-1, s.limit*3/4))
+			// what is slow now sets the bar for the smaller limit, or the limit would shrink to min
+			s.best += (load.Latency - s.best) / 4
+		case load.Latency < s.best*5/4 && s.waiting > 0 && s.limit < s.max:
+			s.limit++
+			s.slot.Broadcast()
+		}
+	}
+	if s.active == 0 && s.waiting == 0 {
+		s.ticking = false
+		return false
+	}
+	return true
+}
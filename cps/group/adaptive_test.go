@@ -0,0 +1,130 @@
+package group_test
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/group"
+)
+
+func TestAdaptiveSpawnerGrowsOnClock(t *testing.T) {
+	clock := newFakeClock()
+	s := group.NewAdaptiveSpawner(1, 2, nil, group.AdaptInterval(time.Second), group.AdaptClock(clock))
+	firstStarted := make(chan struct{})
+	first := make(chan struct{})
+	rest := make(chan struct{})
+	s.Run(func() {
+		close(firstStarted)
+		<-first
+	})
+	for range 2 {
+		go s.Run(func() {
+			<-rest
+		})
+	}
+	eventually(t, func() bool {
+		return s.Observe().Waiting == 2
+	})
+
+	<-firstStarted
+	clock.BlockUntilTimers(1)
+	clock.Advance(50 * time.Millisecond)
+	close(first)
+	eventually(t, func() bool {
+		stats := s.Observe()
+		return stats.Active == 1 && stats.Waiting == 1
+	})
+
+	// the tick measures the 50ms of the first task, the best latency so far, while a task waits
+	clock.Advance(time.Second - 50*time.Millisecond)
+	eventually(t, func() bool {
+		return s.Observe().Limit == 2
+	})
+	if stats := s.Observe(); stats.Latency != 50*time.Millisecond {
+		t.Fatalf("got %+v, want the latency of the first task", stats)
+	}
+	close(rest)
+	s.Wait()
+}
+
+func TestAdaptiveSpawnerConvergesDownOnLatencySpike(t *testing.T) {
+	clock := newFakeClock()
+	var s group.AdaptiveSpawner
+	probed := make(chan int)
+	// a synthetic workload which is fast up to 4 tasks at a time and slows down with every task beyond
+	probe := func() group.Load {
+		limit := s.Observe().Limit
+		probed <- limit
+		latency := 10 * time.Millisecond
+		if limit > 4 {
+			latency *= time.Duration(limit - 3)
+		}
+		return group.Load{Latency: latency}
+	}
+	s = group.NewAdaptiveSpawner(1, 16, probe, group.AdaptInterval(time.Second), group.AdaptClock(clock))
+
+	release := make(chan struct{})
+	for range 32 {
+		go s.Run(func() {
+			<-release
+		})
+	}
+	eventually(t, func() bool {
+		stats := s.Observe()
+		return stats.Active == 1 && stats.Waiting == 31
+	})
+
+	clock.BlockUntilTimers(1)
+	var limits []int
+	for range 40 {
+		clock.Advance(time.Second)
+		limits = append(limits, <-probed)
+	}
+	grew, shrank := false, false
+	for i, limit := range limits {
+		if limit > 5 {
+			t.Fatalf("limits %v, want at most 5, where the latency spikes", limits)
+		}
+		if i > 0 {
+			grew = grew || limit > limits[i-1]
+			shrank = shrank || limit < limits[i-1]
+		}
+	}
+	if !grew || !shrank {
+		t.Errorf("limits %v, want the limit to grow to the spike, then shrink back", limits)
+	}
+	if last := limits[len(limits)-1]; last < 3 || last > 5 {
+		t.Errorf("limit %d after %d ticks, want between 3 and 5", last, len(limits))
+	}
+
+	close(release)
+	// every Run must have returned before the Wait
+	eventually(t, func() bool {
+		stats := s.Observe()
+		return stats.Active == 0 && stats.Waiting == 0
+	})
+	s.Wait()
+}
+
+func TestAdaptiveSpawnerBounds(t *testing.T) {
+	s := group.NewAdaptiveSpawner(0, -1, nil)
+	if stats := s.Observe(); stats.Limit != 1 {
+		t.Errorf("limit %d, want min and max raised to 1", stats.Limit)
+	}
+	s = group.NewAdaptiveSpawner(3, 8, nil)
+	if stats := s.Observe(); stats.Limit != 3 {
+		t.Errorf("limit %d, want to start at min", stats.Limit)
+	}
+
+	var ran atomic.Int64
+	for range 100 {
+		s.Run(func() {
+			ran.Add(1)
+		})
+	}
+	s.Wait()
+	if ran.Load() != 100 {
+		t.Errorf("%d tasks ran, want 100", ran.Load())
+	}
+}
@@ -0,0 +1,116 @@
+package group
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrBarrierBroken is returned by Barrier.Await to the waiters of a round broken by Break.
+var ErrBarrierBroken = errors.New("barrier broken")
+
+// Barrier is a rendezvous of n participants: Await blocks until all of them arrived.
+// It's reusable, every n arrivals make a round.
+type Barrier struct {
+	n int
+
+	mu      sync.Mutex
+	arrived int
+	round   *barrierRound
+	broken  error
+}
+
+type barrierRound struct {
+	done chan struct{} // closed when the round is over, err telling how
+	err  error
+}
+
+// NewBarrier creates a barrier of n participants.
+func NewBarrier(n int) *Barrier {
+	return &Barrier{n: n, round: &barrierRound{done: make(chan struct{})}}
+}
+
+// Await blocks until n participants, this one included, called Await in this round.
+// When ctx is done first the round is broken: all its waiters get ctx.Err(),
+// and the next Await starts a new round.
+func (b *Barrier) Await(ctx context.Context) error {
+	b.mu.Lock()
+	if b.broken != nil {
+		b.mu.Unlock()
+		return b.broken
+	}
+	round := b.round
+	b.arrived++
+	if b.arrived == b.n {
+		b.next(nil)
+		b.mu.Unlock()
+		return nil
+	}
+	b.mu.Unlock()
+
+	select {
+	case <-round.done:
+		return round.err
+	case <-ctx.Done():
+		b.mu.Lock()
+		if b.round == round {
+			b.next(ctx.Err())
+		}
+		b.mu.Unlock()
+		<-round.done
+		return round.err
+	}
+}
+
+// Break breaks the barrier for good: the waiters of the current round, and every Await from now on,
+// get an error wrapping ErrBarrierBroken and err. The participants which won't arrive call it,
+// so that the others don't wait for them forever.
+func (b *Barrier) Break(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.broken != nil {
+		return
+	}
+	b.broken = fmt.Errorf("%w: %w", ErrBarrierBroken, err)
+	b.next(b.broken)
+}
+
+// next ends the current round with err and starts a new one.
+func (b *Barrier) next(err error) {
+	b.round.err = err
+	close(b.round.done)
+	b.round = &barrierRound{done: make(chan struct{})}
+	b.arrived = 0
+}
+
+// RunPhases runs every phase on workers tasks of s, numbered from 0, a phase starting once all the workers
+// finished the previous one. The first phase error stops the workers at the end of the phase,
+// the ones waiting at the barrier included; the errors are returned joined, each telling its phase and worker.
+//
+// s must be able to run workers tasks at once: a bounded spawner of a lower limit deadlocks.
+func RunPhases(s Spawner, workers int, phases ...func(worker int) error) error {
+	barrier := NewBarrier(workers)
+	g := Scope(s)
+	var mu sync.Mutex
+	var errs []error
+	for worker := range workers {
+		g.Run(func() {
+			for i, phase := range phases {
+				err := phase(worker)
+				if err != nil {
+					mu.Lock()
+					errs = append(errs, fmt.Errorf("phase %d worker %d: %w", i, worker, err))
+					mu.Unlock()
+					barrier.Break(err)
+					return
+				}
+				if i < len(phases)-1 && barrier.Await(context.Background()) != nil {
+					return
+				}
+			}
+		})
+	}
+	g.Wait()
+	return errors.Join(errs...)
+}
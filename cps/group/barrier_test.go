@@ -0,0 +1,141 @@
+package group_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/group"
+)
+
+func TestRunPhasesOrder(t *testing.T) {
+	const workers = 4
+	var mu sync.Mutex
+	var events []int // the phase of every call, in order
+	phase := func(i int) func(worker int) error {
+		return func(worker int) error {
+			// the later workers are slower, the barrier has them all finish first
+			time.Sleep(time.Duration(worker) * time.Millisecond)
+			mu.Lock()
+			events = append(events, i)
+			mu.Unlock()
+			return nil
+		}
+	}
+	err := group.RunPhases(group.NewSafeWaitGroup(), workers, phase(0), phase(1), phase(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 3*workers {
+		t.Fatalf("%d calls, want %d", len(events), 3*workers)
+	}
+	for i, got := range events {
+		if want := i / workers; got != want {
+			t.Fatalf("events = %v, want every call of a phase before the next phase", events)
+		}
+	}
+}
+
+func TestRunPhasesErrorStopsNextPhase(t *testing.T) {
+	errLoad := errors.New("load failed")
+	var second atomic.Int64
+	err := group.RunPhases(group.NewSafeWaitGroup(), 4, func(worker int) error {
+		if worker == 2 {
+			return errLoad
+		}
+		return nil
+	}, func(worker int) error {
+		second.Add(1)
+		return nil
+	})
+	if !errors.Is(err, errLoad) || err.Error() != "phase 0 worker 2: load failed" {
+		t.Errorf("RunPhases = %v, want the error of worker 2", err)
+	}
+	if second.Load() != 0 {
+		t.Errorf("the second phase ran %d times after the first failed", second.Load())
+	}
+}
+
+func TestBarrierRounds(t *testing.T) {
+	const participants, rounds = 3, 5
+	b := group.NewBarrier(participants)
+	var reached [participants]atomic.Int64
+	g := group.NewSafeWaitGroup()
+	for p := range participants {
+		g.Run(func() {
+			for round := range rounds {
+				reached[p].Store(int64(round + 1))
+				err := b.Await(context.Background())
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				for other := range participants {
+					if got := reached[other].Load(); got < int64(round+1) {
+						t.Errorf("participant %d past round %d while %d reached %d", p, round, other, got)
+					}
+				}
+			}
+		})
+	}
+	g.Wait()
+}
+
+func TestBarrierCancelledReleasesWaiters(t *testing.T) {
+	b := group.NewBarrier(3)
+	ctx, cancel := context.WithCancel(context.Background())
+	results := make(chan error, 2)
+	go func() {
+		results <- b.Await(ctx)
+	}()
+	go func() {
+		results <- b.Await(context.Background())
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	for range 2 {
+		select {
+		case err := <-results:
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("Await = %v, want context.Canceled", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("a waiter still waits after the cancellation")
+		}
+	}
+
+	// the next round starts from scratch
+	g := group.NewSafeWaitGroup()
+	for range 3 {
+		g.Run(func() {
+			if err := b.Await(context.Background()); err != nil {
+				t.Errorf("Await after the broken round = %v", err)
+			}
+		})
+	}
+	g.Wait()
+}
+
+func TestBarrierBreak(t *testing.T) {
+	b := group.NewBarrier(2)
+	errGone := errors.New("worker gone")
+	waiting := make(chan error, 1)
+	go func() {
+		waiting <- b.Await(context.Background())
+	}()
+	time.Sleep(10 * time.Millisecond)
+	b.Break(errGone)
+	b.Break(errors.New("ignored"))
+	for _, err := range []error{<-waiting, b.Await(context.Background())} {
+		if !errors.Is(err, group.ErrBarrierBroken) || !errors.Is(err, errGone) {
+			t.Errorf("Await = %v, want ErrBarrierBroken and the error of Break", err)
+		}
+		if got, want := err.Error(), fmt.Sprint(group.ErrBarrierBroken, ": ", errGone); got != want {
+			t.Errorf("Error = %q, want %q", got, want)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package group
+
+// BatchSpawner is a Spawner which can start many tasks at once, cheaper than as many Run calls.
+// The groups of this package implement it.
+type BatchSpawner interface {
+	Spawner
+	RunBatch(tasks []func())
+}
+
+// RunBatch runs all of tasks through s, in a single call when s is a BatchSpawner.
+func RunBatch(s Spawner, tasks []func()) {
+	if bs, ok := s.(BatchSpawner); ok {
+		bs.RunBatch(tasks)
+		return
+	}
+	for _, task := range tasks {
+		s.Run(task)
+	}
+}
+
+// RunN runs f for every i from 0 to n-1 through s, as one batch.
+func RunN(s Spawner, n int, f func(i int)) {
+	if n <= 0 {
+		return
+	}
+	tasks := make([]func(), n)
+	for i := range tasks {
+		tasks[i] = func() {
+			f(i)
+		}
+	}
+	RunBatch(s, tasks)
+}
+
+func (swg *safeWaitGroupImpl) RunBatch(tasks []func()) {
+	swg.wg.Add(len(tasks))
+	for _, task := range tasks {
+		go func() {
+			task()
+			swg.wg.Add(-1)
+		}()
+	}
+}
+
+func (p *pooledWaitGroup) RunBatch(tasks []func()) {
+	p.pending.Add(len(tasks))
+	queue := p.queue()
+	for _, task := range tasks {
+		queue <- task
+	}
+}
+
+func (bwg *boundedWaitGroup) RunBatch(tasks []func()) {
+	// every task needs its slot anyway
+	for _, task := range tasks {
+		bwg.Run(task)
+	}
+}
+
+func (s *scope) RunBatch(tasks []func()) {
+	s.wg.Add(len(tasks))
+	wrapped := make([]func(), len(tasks))
+	for i, task := range tasks {
+		wrapped[i] = func() {
+			defer s.wg.Add(-1)
+			task()
+		}
+	}
+	RunBatch(s.parent, wrapped)
+}
+
+func (ws *wrappedSpawner) RunBatch(tasks []func()) {
+	wrapped := make([]func(), len(tasks))
+	for i, task := range tasks {
+		wrapped[i] = wrap(task, ws.middlewares)
+	}
+	RunBatch(ws.spawner, wrapped)
+}
+
+func (g *drainableGroup) RunBatch(tasks []func()) {
+	_ = g.TryRunBatch(tasks)
+}
+
+// TryRunBatch is RunBatch which rejects the whole batch with ErrDraining once Drain was called.
+func (g *drainableGroup) TryRunBatch(tasks []func()) error {
+	g.mu.Lock()
+	if g.draining {
+		g.mu.Unlock()
+		return ErrDraining
+	}
+	g.running += len(tasks)
+	g.wg.Add(len(tasks))
+	g.mu.Unlock()
+
+	wrapped := make([]func(), len(tasks))
+	for i, task := range tasks {
+		wrapped[i] = func() {
+			defer g.done()
+			task()
+		}
+	}
+	RunBatch(g.parent, wrapped)
+	return nil
+}
@@ -0,0 +1,146 @@
+package group_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/group"
+)
+
+// plainSpawner is a Spawner without RunBatch.
+type plainSpawner struct {
+	group.SafeWaitGroup
+}
+
+func (s plainSpawner) Run(task func()) {
+	s.SafeWaitGroup.Run(task)
+}
+
+func TestRunNRunsEveryIndexOnce(t *testing.T) {
+	const n = 10_000
+	for name, newGroup := range map[string]func() (group.Spawner, func()){
+		"SafeWaitGroup": func() (group.Spawner, func()) {
+			g := group.NewSafeWaitGroup()
+			return g, g.Wait
+		},
+		"pooled": func() (group.Spawner, func()) {
+			g := group.NewPooledSpawner(8, 16)
+			return g, g.Wait
+		},
+		"bounded": func() (group.Spawner, func()) {
+			g := group.NewBoundedSpawner(8)
+			return g, g.Wait
+		},
+		"Scope": func() (group.Spawner, func()) {
+			parent := group.NewPooledSpawner(8, 16)
+			g := group.Scope(parent)
+			return g, func() {
+				g.Wait()
+				parent.Wait()
+			}
+		},
+		"Drainable": func() (group.Spawner, func()) {
+			g := group.Drainable(group.NewBoundedSpawner(8))
+			return g, g.Wait
+		},
+		"WrapSpawner": func() (group.Spawner, func()) {
+			g := group.NewSafeWaitGroup()
+			return group.WrapSpawner(g, group.Recover(nil)), g.Wait
+		},
+		"without RunBatch": func() (group.Spawner, func()) {
+			g := plainSpawner{group.NewSafeWaitGroup()}
+			return g, g.Wait
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s, wait := newGroup()
+			var runs [n]atomic.Int64
+			group.RunN(s, n, func(i int) {
+				runs[i].Add(1)
+			})
+			wait()
+			for i := range runs {
+				if got := runs[i].Load(); got != 1 {
+					t.Fatalf("index %d ran %d times, want once", i, got)
+				}
+			}
+		})
+	}
+}
+
+func TestRunBatchOnDrainingGroupRejectsEverything(t *testing.T) {
+	g := group.Drainable(group.NewSafeWaitGroup())
+	var ran atomic.Int64
+	task := func() { ran.Add(1) }
+
+	err := g.TryRunBatch([]func(){task, task, task})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = g.Drain(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = g.TryRunBatch([]func(){task, task, task})
+	if !errors.Is(err, group.ErrDraining) {
+		t.Errorf("TryRunBatch after Drain = %v, want ErrDraining", err)
+	}
+	group.RunN(g, 3, func(int) { ran.Add(1) })
+	g.Wait()
+	if ran.Load() != 3 {
+		t.Errorf("%d tasks ran, want only the batch before Drain", ran.Load())
+	}
+}
+
+func TestRunNWithoutTasks(t *testing.T) {
+	g := group.NewSafeWaitGroup()
+	group.RunN(g, 0, func(int) { t.Error("task of RunN(0) ran") })
+	group.RunN(g, -1, func(int) { t.Error("task of RunN(-1) ran") })
+	g.Wait()
+}
+
+const batchTasks = 100_000
+
+func benchmarkRun(b *testing.B, newGroup func() group.SafeWaitGroup) {
+	b.ReportAllocs()
+	for range b.N {
+		g := newGroup()
+		var n atomic.Int64
+		for range batchTasks {
+			g.Run(func() { n.Add(1) })
+		}
+		g.Wait()
+	}
+}
+
+func benchmarkRunN(b *testing.B, newGroup func() group.SafeWaitGroup) {
+	b.ReportAllocs()
+	for range b.N {
+		g := newGroup()
+		var n atomic.Int64
+		group.RunN(g, batchTasks, func(int) { n.Add(1) })
+		g.Wait()
+	}
+}
+
+func newPooled() group.SafeWaitGroup {
+	return group.NewPooledSpawner(8, 1024)
+}
+
+func BenchmarkRunEach(b *testing.B) {
+	benchmarkRun(b, group.NewSafeWaitGroup)
+}
+
+func BenchmarkRunN(b *testing.B) {
+	benchmarkRunN(b, group.NewSafeWaitGroup)
+}
+
+func BenchmarkPooledRunEach(b *testing.B) {
+	benchmarkRun(b, newPooled)
+}
+
+func BenchmarkPooledRunN(b *testing.B) {
+	benchmarkRunN(b, newPooled)
+}
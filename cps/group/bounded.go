@@ -0,0 +1,29 @@
+package group
+
+// NewBoundedSpawner creates a group running at most limit tasks at a time:
+// Run blocks until one of the running tasks finishes. A limit below 1 is 1.
+func NewBoundedSpawner(limit int) SafeWaitGroup {
+	return &boundedWaitGroup{
+		swg:   NewSafeWaitGroup(),
+		slots: make(chan struct{}, max(limit, 1)),
+	}
+}
+
+type boundedWaitGroup struct {
+	swg   SafeWaitGroup
+	slots chan struct{}
+}
+
+func (bwg *boundedWaitGroup) Run(task func()) {
+	bwg.slots <- struct{}{}
+	bwg.swg.Run(func() {
+		defer func() {
+			<-bwg.slots
+		}()
+		task()
+	})
+}
+
+func (bwg *boundedWaitGroup) Wait() {
+	bwg.swg.Wait()
+}
@@ -0,0 +1,57 @@
+package group_test
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/group"
+)
+
+func TestBoundedSpawnerLimit(t *testing.T) {
+	const limit = 3
+	spawner := group.NewBoundedSpawner(limit)
+	release := make(chan struct{})
+	var active, most, done atomic.Int64
+	go func() {
+		for range 10 {
+			spawner.Run(func() {
+				n := active.Add(1)
+				for m := most.Load(); n > m && !most.CompareAndSwap(m, n); m = most.Load() {
+				}
+				<-release
+				active.Add(-1)
+				done.Add(1)
+			})
+		}
+	}()
+	eventually(t, func() bool { return active.Load() == limit })
+	close(release)
+	eventually(t, func() bool { return done.Load() == 10 })
+	spawner.Wait()
+	if most.Load() != limit {
+		t.Errorf("%d tasks at a time, want %d", most.Load(), limit)
+	}
+}
+
+func TestBoundedSpawnerLimitBelowOne(t *testing.T) {
+	for _, limit := range []int{0, -3} {
+		t.Run(fmt.Sprint(limit), func(t *testing.T) {
+			spawner := group.NewBoundedSpawner(limit)
+			var active, most, done atomic.Int64
+			for range 5 {
+				spawner.Run(func() {
+					n := active.Add(1)
+					for m := most.Load(); n > m && !most.CompareAndSwap(m, n); m = most.Load() {
+					}
+					active.Add(-1)
+					done.Add(1)
+				})
+			}
+			spawner.Wait()
+			if done.Load() != 5 || most.Load() != 1 {
+				t.Errorf("%d tasks ran, %d at a time; want all 5 one at a time", done.Load(), most.Load())
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package group
+
+import (
+	"context"
+	"sync"
+)
+
+// TaskDescriptor describes a task well enough to run it again in another process:
+// Data is opaque to the group, its caller serializes and decodes it.
+type TaskDescriptor struct {
+	Name string
+	Data []byte
+}
+
+// CheckpointGroup is a DrainableGroup whose Drain doesn't start the queued tasks:
+// the described ones are handed back by Snapshot, to be persisted and run again after a restart.
+type CheckpointGroup interface {
+	DrainableGroup
+	// RunDescribed is Run for a task described by desc. Once Drain was called,
+	// the task isn't run but goes to Snapshot.
+	RunDescribed(desc TaskDescriptor, task func())
+	// Snapshot returns the descriptors of the described tasks which never started,
+	// complete once Drain returned nil, in the order they were withdrawn.
+	Snapshot() []TaskDescriptor
+	// Unrecoverable is the number of tasks withdrawn by Drain without a descriptor: they are lost.
+	Unrecoverable() int
+}
+
+// Checkpointed creates a child group of parent, like Drainable does, for the parents which queue tasks
+// before starting them, like NewPooledSpawner or NewBoundedSpawner. Once Drain was called, the queued tasks
+// are withdrawn as parent gets to them instead of being run, and Drain waits for the running ones only.
+func Checkpointed(parent Spawner) CheckpointGroup {
+	return &checkpointGroup{parent: parent, idle: make(chan struct{})}
+}
+
+type checkpointGroup struct {
+	parent Spawner
+	wg     sync.WaitGroup
+
+	mu            sync.Mutex
+	draining      bool
+	pending       int           // queued and running tasks
+	idle          chan struct{} // closed when draining with nothing pending
+	withdrawn     []TaskDescriptor
+	unrecoverable int
+}
+
+func (g *checkpointGroup) Run(task func()) {
+	_ = g.TryRun(task)
+}
+
+func (g *checkpointGroup) TryRun(task func()) error {
+	return g.TryRunBatch([]func(){task})
+}
+
+func (g *checkpointGroup) RunDescribed(desc TaskDescriptor, task func()) {
+	g.run([]*TaskDescriptor{&desc}, []func(){task})
+}
+
+func (g *checkpointGroup) TryRunBatch(tasks []func()) error {
+	if !g.run(make([]*TaskDescriptor, len(tasks)), tasks) {
+		return ErrDraining
+	}
+	return nil
+}
+
+// run queues the tasks in parent, unless draining; descs has a nil descriptor for undescribed tasks.
+func (g *checkpointGroup) run(descs []*TaskDescriptor, tasks []func()) bool {
+	g.mu.Lock()
+	if g.draining {
+		for _, desc := range descs {
+			if desc != nil {
+				g.withdrawn = append(g.withdrawn, *desc)
+			}
+		}
+		g.mu.Unlock()
+		return false
+	}
+	g.pending += len(tasks)
+	g.wg.Add(len(tasks))
+	g.mu.Unlock()
+
+	for i, task := range tasks {
+		desc := descs[i]
+		g.parent.Run(func() {
+			defer g.done()
+			if g.withdraw(desc) {
+				return
+			}
+			task()
+		})
+	}
+	return true
+}
+
+// withdraw tells whether the task isn't to be started, recording it.
+func (g *checkpointGroup) withdraw(desc *TaskDescriptor) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.draining {
+		return false
+	}
+	if desc != nil {
+		g.withdrawn = append(g.withdrawn, *desc)
+	} else {
+		g.unrecoverable++
+	}
+	return true
+}
+
+func (g *checkpointGroup) done() {
+	g.mu.Lock()
+	g.pending--
+	if g.draining && g.pending == 0 {
+		close(g.idle)
+	}
+	g.mu.Unlock()
+	g.wg.Add(-1)
+}
+
+func (g *checkpointGroup) Wait() {
+	g.wg.Wait()
+}
+
+// Drain stops intake and waits for the queued tasks to be withdrawn and the running ones to finish,
+// giving up with a *DrainError when ctx is done first.
+func (g *checkpointGroup) Drain(ctx context.Context) error {
+	g.mu.Lock()
+	if !g.draining {
+		g.draining = true
+		if g.pending == 0 {
+			close(g.idle)
+		}
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-g.idle:
+		return nil
+	case <-ctx.Done():
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		if g.pending == 0 {
+			return nil
+		}
+		return &DrainError{Abandoned: g.pending, Err: ctx.Err()}
+	}
+}
+
+func (g *checkpointGroup) Snapshot() []TaskDescriptor {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]TaskDescriptor(nil), g.withdrawn...)
+}
+
+func (g *checkpointGroup) Unrecoverable() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.unrecoverable
+}
@@ -0,0 +1,119 @@
+package group_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/group"
+)
+
+func TestCheckpointedSnapshotsQueuedTasks(t *testing.T) {
+	pool := group.NewPooledSpawner(2, 20)
+	g := group.Checkpointed(pool)
+
+	var mu sync.Mutex
+	var ran []string
+	task := func(name string) func() {
+		return func() {
+			mu.Lock()
+			ran = append(ran, name)
+			mu.Unlock()
+		}
+	}
+
+	// both workers busy, the queue filled behind them
+	release := make(chan struct{})
+	var started atomic.Int64
+	for i := range 2 {
+		g.RunDescribed(group.TaskDescriptor{Name: fmt.Sprint("running ", i)}, func() {
+			started.Add(1)
+			<-release
+		})
+	}
+	eventually(t, func() bool { return started.Load() == 2 })
+	var queued []string
+	for i := range 8 {
+		name := fmt.Sprint("queued ", i)
+		queued = append(queued, name)
+		g.RunDescribed(group.TaskDescriptor{Name: name, Data: []byte(name)}, task(name))
+	}
+	g.Run(task("undescribed 0"))
+	g.Run(task("undescribed 1"))
+
+	// a done ctx stops intake without waiting
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var drainErr *group.DrainError
+	if err := g.Drain(ctx); !errors.As(err, &drainErr) || drainErr.Abandoned != 12 {
+		t.Fatalf("Drain with a done ctx = %v, want 12 tasks abandoned", err)
+	}
+	late := "submitted while draining"
+	queued = append(queued, late)
+	g.RunDescribed(group.TaskDescriptor{Name: late, Data: []byte(late)}, task(late))
+	if err := g.TryRun(task("rejected")); !errors.Is(err, group.ErrDraining) {
+		t.Errorf("TryRun while draining = %v, want ErrDraining", err)
+	}
+
+	close(release)
+	if err := g.Drain(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	g.Wait()
+	pool.Wait()
+	if len(ran) != 0 {
+		t.Errorf("ran %q after Drain, want none of the queued tasks", ran)
+	}
+	if got := g.Unrecoverable(); got != 2 {
+		t.Errorf("Unrecoverable = %d, want the 2 undescribed tasks", got)
+	}
+	snapshot := g.Snapshot()
+	var names []string
+	for _, desc := range snapshot {
+		names = append(names, desc.Name)
+	}
+	slices.Sort(names)
+	slices.Sort(queued)
+	if !slices.Equal(names, queued) {
+		t.Fatalf("Snapshot = %q, want the queued tasks only", names)
+	}
+
+	// the next process runs them again
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(path, data, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err = os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var restored []group.TaskDescriptor
+	err = json.Unmarshal(data, &restored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restarted := group.Checkpointed(group.NewPooledSpawner(2, 20))
+	for _, desc := range restored {
+		restarted.RunDescribed(desc, task(string(desc.Data)))
+	}
+	restarted.Wait()
+	slices.Sort(ran)
+	if !slices.Equal(ran, queued) {
+		t.Errorf("ran %q after the restart, want the snapshot", ran)
+	}
+	if err := restarted.Drain(context.Background()); err != nil || len(restarted.Snapshot()) != 0 {
+		t.Errorf("Drain of the idle group = %v with %d tasks withdrawn, want none", err, len(restarted.Snapshot()))
+	}
+}
@@ -0,0 +1,33 @@
+package group
+
+import (
+	"context"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/internal/clock"
+)
+
+// Clock tells the time and waits for the time-dependent spawners of the package, and those of package resource,
+// so tests can run them with a fake clock (resourcetest.FakeClock) instead of waiting for real.
+type Clock = clock.Clock
+
+// Timer is what Clock.NewTimer returns, a *time.Timer for the real clock.
+type Timer = clock.Timer
+
+// Ticker is what Clock.NewTicker returns, a *time.Ticker for the real clock.
+type Ticker = clock.Ticker
+
+// RealClock is the clock of the time package, the default of every clock option.
+func RealClock() Clock {
+	return clock.Real()
+}
+
+// clockOr returns c, the real clock when nil.
+func clockOr(c Clock) Clock {
+	return clock.Or(c)
+}
+
+// withClockTimeout is context.WithTimeout timed by c.
+func withClockTimeout(ctx context.Context, c Clock, d time.Duration) (context.Context, context.CancelFunc) {
+	return clock.WithTimeout(ctx, c, d)
+}
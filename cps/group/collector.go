@@ -0,0 +1,63 @@
+package group
+
+import (
+	"sync"
+)
+
+// Collector gathers the results of concurrent tasks, instead of having them write
+// into a shared slice. The zero value is empty and ready to use.
+type Collector[T any] struct {
+	mu      sync.Mutex
+	values  []T
+	indexed map[int]T
+	maxIdx  int
+}
+
+// Add appends v; values added concurrently are in no particular order.
+func (c *Collector[T]) Add(v T) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values = append(c.values, v)
+}
+
+// AddIndexed puts v at index i of the snapshot, whatever the order of the calls.
+// i must not be negative; adding twice at the same index keeps the last value.
+func (c *Collector[T]) AddIndexed(i int, v T) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.indexed == nil {
+		c.indexed = make(map[int]T)
+	}
+	c.indexed[i] = v
+	if i+1 > c.maxIdx {
+		c.maxIdx = i + 1
+	}
+}
+
+// Snapshot returns a copy of the collected values: the indexed ones first, in index order
+// with zero values at the missing indexes, then the added ones.
+func (c *Collector[T]) Snapshot() []T {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	snapshot := make([]T, c.maxIdx, c.maxIdx+len(c.values))
+	for i, v := range c.indexed {
+		snapshot[i] = v
+	}
+	return append(snapshot, c.values...)
+}
+
+// RunGroupCollect runs f for every i from 0 to n-1 concurrently and returns the results in order.
+func RunGroupCollect[T any](n int, f func(i int) T) []T {
+	if n <= 0 {
+		return nil
+	}
+	var c Collector[T]
+	RunGroup(func(s Spawner) {
+		for i := 0; i < n; i++ {
+			s.Run(func() {
+				c.AddIndexed(i, f(i))
+			})
+		}
+	})
+	return c.Snapshot()
+}
@@ -0,0 +1,98 @@
+package group_test
+
+import (
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/group"
+)
+
+func TestCollectorConcurrentAdds(t *testing.T) {
+	const n = 5000
+	var c group.Collector[int]
+	group.RunGroup(func(s group.Spawner) {
+		for i := range n {
+			s.Run(func() {
+				c.Add(i)
+			})
+		}
+	})
+
+	got := c.Snapshot()
+	slices.Sort(got)
+	if len(got) != n {
+		t.Fatalf("collected %d values, want %d", len(got), n)
+	}
+	for i, v := range got {
+		if v != i {
+			t.Fatalf("sorted values[%d] = %d, want every value once", i, v)
+		}
+	}
+}
+
+func TestCollectorIndexedOrder(t *testing.T) {
+	const n = 5000
+	var c group.Collector[int]
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.AddIndexed(n-1-i, (n-1-i)*10)
+		}()
+	}
+	wg.Wait()
+
+	got := c.Snapshot()
+	if len(got) != n {
+		t.Fatalf("collected %d values, want %d", len(got), n)
+	}
+	for i, v := range got {
+		if v != i*10 {
+			t.Fatalf("values[%d] = %d, want %d", i, v, i*10)
+		}
+	}
+}
+
+func TestCollectorSnapshot(t *testing.T) {
+	var c group.Collector[string]
+	if got := c.Snapshot(); len(got) != 0 {
+		t.Errorf("zero Collector snapshot = %q", got)
+	}
+
+	c.Add("added")
+	c.AddIndexed(2, "two")
+	c.AddIndexed(0, "zero")
+	c.AddIndexed(0, "last zero")
+	snapshot := c.Snapshot()
+	want := []string{"last zero", "", "two", "added"}
+	if !slices.Equal(snapshot, want) {
+		t.Errorf("snapshot = %q, want %q", snapshot, want)
+	}
+
+	// a snapshot is a copy
+	snapshot[0] = "changed"
+	c.Add("more")
+	if got := c.Snapshot(); got[0] != "last zero" || len(got) != 5 {
+		t.Errorf("snapshot after changing the previous one = %q", got)
+	}
+}
+
+func TestRunGroupCollect(t *testing.T) {
+	got := group.RunGroupCollect(1000, func(i int) int {
+		return i * i
+	})
+	if len(got) != 1000 {
+		t.Fatalf("RunGroupCollect returned %d results, want 1000", len(got))
+	}
+	for i, v := range got {
+		if v != i*i {
+			t.Fatalf("results[%d] = %d, want %d", i, v, i*i)
+		}
+	}
+
+	if got := group.RunGroupCollect(0, func(i int) int { return i }); got != nil {
+		t.Errorf("RunGroupCollect(0) = %v, want nil", got)
+	}
+}
@@ -0,0 +1,169 @@
+package group
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrSpawner runs tasks which can fail.
+type ErrSpawner interface {
+	Run(task func() error)
+}
+
+type errGroup struct {
+	swg    SafeWaitGroup
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu     sync.Mutex
+	errs   []error
+	failed bool
+}
+
+func (g *errGroup) Run(task func() error) {
+	g.swg.Run(func() {
+		err := task()
+		if err != nil {
+			g.fail(err)
+		}
+	})
+}
+
+func (g *errGroup) fail(err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.failed && errors.Is(err, context.Canceled) {
+		// most likely caused by the first error cancelling the context
+		return
+	}
+	if !g.failed {
+		g.failed = true
+		g.cancel()
+	}
+	g.errs = append(g.errs, err)
+}
+
+// RunGroupCtx is RunGroup for tasks which can fail: the first task error (or f's error)
+// cancels the context given to f, so the other tasks can stop early.
+//
+// The returned error starts with the first error, joined with the other errors
+// except the context.Canceled ones following it.
+func RunGroupCtx(ctx context.Context, f func(ctx context.Context, s ErrSpawner) error) error {
+	g := NewCancelGroup(ctx)
+	err := f(g.Context(), g)
+	if err != nil {
+		g.Cancel(err)
+	}
+	return g.Wait()
+}
+
+// CancelGroup is the group of RunGroupCtx, for the callers which can't run their tasks inside f.
+type CancelGroup interface {
+	ErrSpawner
+	// Context is cancelled by the first task error or Cancel, and once Wait returned.
+	Context() context.Context
+	// Cancel fails the group with err, as a task returning it would.
+	Cancel(err error)
+	// Wait waits for the tasks and returns their errors, joined like RunGroupCtx does.
+	Wait() error
+	// Spawner runs tasks which can't fail in the group; GroupContext of it is Context.
+	Spawner() Spawner
+}
+
+// NewCancelGroup creates a CancelGroup whose context is derived from ctx.
+func NewCancelGroup(ctx context.Context) CancelGroup {
+	ctx, cancel := context.WithCancel(ctx)
+	return &errGroup{swg: NewSafeWaitGroup(), ctx: ctx, cancel: cancel}
+}
+
+func (g *errGroup) Context() context.Context {
+	return g.ctx
+}
+
+func (g *errGroup) Cancel(err error) {
+	g.fail(err)
+}
+
+func (g *errGroup) Spawner() Spawner {
+	return cancelSpawner{g}
+}
+
+func (g *errGroup) Wait() error {
+	g.swg.Wait()
+	g.cancel()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return errors.Join(g.errs...)
+}
+
+type taskOptions struct {
+	timeout time.Duration
+	clock   Clock
+}
+
+// TaskOption configures RunCtx and RunCtxErr.
+type TaskOption func(options *taskOptions)
+
+// WithTaskTimeout cancels the context of the task d after it started,
+// unless the group context is cancelled first.
+func WithTaskTimeout(d time.Duration) TaskOption {
+	return func(options *taskOptions) {
+		options.timeout = d
+	}
+}
+
+// TaskClock makes WithTaskTimeout time the task with clock.
+func TaskClock(clock Clock) TaskOption {
+	return func(options *taskOptions) {
+		options.clock = clock
+	}
+}
+
+func taskContext(ctx context.Context, opts []TaskOption) (context.Context, context.CancelFunc) {
+	var options taskOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.timeout > 0 {
+		return withClockTimeout(ctx, clockOr(options.clock), options.timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// RunCtx runs task through s with a context derived from ctx, cancelled when the task returns,
+// ready to be passed to the ctx-aware resources. It is a function rather than a Spawner method
+// so that it works with every Spawner.
+//
+// The context is also cancelled with the GroupContext of s, and a task waiting for a slot
+// of a bounded spawner when either is done is dropped.
+func RunCtx(s Spawner, ctx context.Context, task func(ctx context.Context), opts ...TaskOption) {
+	group := GroupContext(s)
+	run := func() {
+		ctx, stop := untilDone(ctx, group)
+		defer stop()
+		ctx, cancel := taskContext(ctx, opts)
+		defer cancel()
+		task(ctx)
+	}
+	if runner, ok := s.(ctxRunner); ok {
+		waitCtx, stop := untilDone(ctx, group)
+		defer stop()
+		runner.runCtx(waitCtx, run)
+		return
+	}
+	s.Run(run)
+}
+
+// RunCtxErr is RunCtx for the tasks of RunGroupCtx, ctx being the one given to its f.
+func RunCtxErr(s ErrSpawner, ctx context.Context, task func(ctx context.Context) error, opts ...TaskOption) {
+	group := groupContext(s)
+	s.Run(func() error {
+		ctx, stop := untilDone(ctx, group)
+		defer stop()
+		ctx, cancel := taskContext(ctx, opts)
+		defer cancel()
+		return task(ctx)
+	})
+}
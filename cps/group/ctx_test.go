@@ -0,0 +1,178 @@
+package group_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/group"
+)
+
+func TestWithTaskTimeoutOnClock(t *testing.T) {
+	clock := newFakeClock()
+	swg := group.NewSafeWaitGroup()
+	var err error
+	group.RunCtx(swg, context.Background(), func(ctx context.Context) {
+		<-ctx.Done()
+		err = ctx.Err()
+	}, group.WithTaskTimeout(time.Minute), group.TaskClock(clock))
+
+	clock.BlockUntilTimers(1)
+	clock.Advance(time.Minute)
+	swg.Wait()
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestRunGroupCtxFirstError(t *testing.T) {
+	errBoom, errLater := errors.New("boom"), errors.New("later")
+	err := group.RunGroupCtx(context.Background(), func(ctx context.Context, s group.ErrSpawner) error {
+		s.Run(func() error {
+			return errBoom
+		})
+		for range 2 {
+			s.Run(func() error {
+				<-ctx.Done()
+				return ctx.Err()
+			})
+		}
+		s.Run(func() error {
+			<-ctx.Done()
+			return errLater
+		})
+		return nil
+	})
+	if !errors.Is(err, errBoom) || !errors.Is(err, errLater) {
+		t.Fatalf("RunGroupCtx = %v, want the task errors", err)
+	}
+	if errors.Is(err, context.Canceled) {
+		t.Errorf("RunGroupCtx = %v, want the cancellations following the first error dropped", err)
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); !ok || joined.Unwrap()[0] != errBoom {
+		t.Errorf("RunGroupCtx = %v, want the first error first", err)
+	}
+}
+
+func TestRunGroupCtxFnError(t *testing.T) {
+	errFn := errors.New("fn")
+	var taskErr error
+	err := group.RunGroupCtx(context.Background(), func(ctx context.Context, s group.ErrSpawner) error {
+		s.Run(func() error {
+			<-ctx.Done()
+			taskErr = ctx.Err()
+			return taskErr
+		})
+		return errFn
+	})
+	if !errors.Is(err, errFn) {
+		t.Errorf("RunGroupCtx = %v, want %v", err, errFn)
+	}
+	if !errors.Is(taskErr, context.Canceled) {
+		t.Errorf("task context ended with %v, want it cancelled by the error of f", taskErr)
+	}
+}
+
+func TestRunGroupCtxParentCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := group.RunGroupCtx(ctx, func(ctx context.Context, s group.ErrSpawner) error {
+		s.Run(func() error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("RunGroupCtx = %v, want the cancellation of its parent as the first error", err)
+	}
+}
+
+func TestTaskTimeoutKeepsGroupAlive(t *testing.T) {
+	clock := newFakeClock()
+	var timedOut, groupErr error
+	err := group.RunGroupCtx(context.Background(), func(ctx context.Context, s group.ErrSpawner) error {
+		timedOutDone := make(chan struct{})
+		group.RunCtxErr(s, ctx, func(ctx context.Context) error {
+			defer close(timedOutDone)
+			<-ctx.Done()
+			timedOut = ctx.Err()
+			return nil
+		}, group.WithTaskTimeout(time.Minute), group.TaskClock(clock))
+		group.RunCtxErr(s, ctx, func(taskCtx context.Context) error {
+			<-timedOutDone
+			groupErr = ctx.Err()
+			return taskCtx.Err()
+		})
+		clock.BlockUntilTimers(1)
+		clock.Advance(time.Minute)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !errors.Is(timedOut, context.DeadlineExceeded) || groupErr != nil {
+		t.Errorf("task context %v, group context %v, want only the task timed out", timedOut, groupErr)
+	}
+}
+
+func TestGroupCancellationOverridesTaskTimeout(t *testing.T) {
+	errBoom := errors.New("boom")
+	var taskErr error
+	err := group.RunGroupCtx(context.Background(), func(ctx context.Context, s group.ErrSpawner) error {
+		group.RunCtxErr(s, ctx, func(ctx context.Context) error {
+			<-ctx.Done()
+			taskErr = ctx.Err()
+			return nil
+		}, group.WithTaskTimeout(time.Hour))
+		s.Run(func() error { return errBoom })
+		return nil
+	})
+	if !errors.Is(err, errBoom) {
+		t.Errorf("RunGroupCtx = %v, want %v", err, errBoom)
+	}
+	if !errors.Is(taskErr, context.Canceled) {
+		t.Errorf("task context %v, want it cancelled with the group before its deadline", taskErr)
+	}
+}
+
+func TestRunCtxFollowsCancelGroup(t *testing.T) {
+	g := group.NewCancelGroup(context.Background())
+	started := make(chan struct{}, 2)
+	errs := make(chan error, 2)
+	for _, s := range []group.Spawner{g.Spawner(), group.Scope(g.Spawner())} {
+		group.RunCtx(s, context.Background(), func(ctx context.Context) {
+			started <- struct{}{}
+			<-ctx.Done()
+			errs <- ctx.Err()
+		}, group.WithTaskTimeout(time.Hour))
+	}
+	<-started
+	<-started
+	errStop := errors.New("stop")
+	g.Cancel(errStop)
+	if err := g.Wait(); !errors.Is(err, errStop) {
+		t.Errorf("Wait = %v, want %v", err, errStop)
+	}
+	for range 2 {
+		if err := <-errs; !errors.Is(err, context.Canceled) {
+			t.Errorf("task context %v, want it cancelled with the group, a scope of it included", err)
+		}
+	}
+}
+
+func TestRunCtxCancelledAfterTask(t *testing.T) {
+	swg := group.NewSafeWaitGroup()
+	var kept context.Context
+	group.RunCtx(swg, context.Background(), func(ctx context.Context) {
+		if ctx.Err() != nil {
+			t.Errorf("context %v while the task runs", ctx.Err())
+		}
+		kept = ctx
+	})
+	swg.Wait()
+	if kept.Err() == nil {
+		t.Error("context of the task not cancelled after it returned")
+	}
+}
@@ -0,0 +1,112 @@
+package group
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrDraining is returned by TryRun once Drain was called.
+var ErrDraining = errors.New("group is draining")
+
+// DrainError is returned by Drain when ctx is done before the tasks; it wraps ctx.Err().
+type DrainError struct {
+	Abandoned int
+	Err       error
+}
+
+func (e *DrainError) Error() string {
+	return fmt.Sprintf("drain: %d tasks abandoned: %v", e.Abandoned, e.Err)
+}
+
+func (e *DrainError) Unwrap() error {
+	return e.Err
+}
+
+// DrainableGroup is a group which can stop accepting tasks, for graceful shutdowns.
+type DrainableGroup interface {
+	SafeWaitGroup
+	// TryRun is Run which returns ErrDraining instead of running task once Drain was called.
+	TryRun(task func()) error
+	// TryRunBatch is TryRun for a batch, rejected as a whole.
+	TryRunBatch(tasks []func()) error
+	// Drain rejects the tasks run from now on and waits for the running ones,
+	// giving up with a *DrainError when ctx is done first.
+	Drain(ctx context.Context) error
+}
+
+// Drainable creates a drainable child group of parent, like Scope does:
+// wrap a bounded or pooled spawner to drain it. Its Run drops the rejected tasks silently,
+// use TryRun where that matters.
+func Drainable(parent Spawner) DrainableGroup {
+	return &drainableGroup{parent: parent, idle: make(chan struct{})}
+}
+
+type drainableGroup struct {
+	parent Spawner
+	wg     sync.WaitGroup
+
+	mu       sync.Mutex
+	draining bool
+	running  int
+	idle     chan struct{} // closed when draining with nothing running
+}
+
+func (g *drainableGroup) Run(task func()) {
+	_ = g.TryRun(task)
+}
+
+func (g *drainableGroup) TryRun(task func()) error {
+	g.mu.Lock()
+	if g.draining {
+		g.mu.Unlock()
+		return ErrDraining
+	}
+	g.running++
+	g.wg.Add(1)
+	g.mu.Unlock()
+
+	g.parent.Run(func() {
+		defer g.done()
+		task()
+	})
+	return nil
+}
+
+func (g *drainableGroup) done() {
+	g.mu.Lock()
+	g.running--
+	if g.draining && g.running == 0 {
+		close(g.idle)
+	}
+	g.mu.Unlock()
+	g.wg.Add(-1)
+}
+
+func (g *drainableGroup) Wait() {
+	g.wg.Wait()
+}
+
+func (g *drainableGroup) Drain(ctx context.Context) error {
+	g.mu.Lock()
+	if !g.draining {
+		g.draining = true
+		if g.running == 0 {
+			close(g.idle)
+		}
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-g.idle:
+		return nil
+	case <-ctx.Done():
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		if g.running == 0 {
+			return nil
+		}
+		return &DrainError{Abandoned: g.running, Err: ctx.Err()}
+	}
+}
@@ -0,0 +1,104 @@
+package group_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/group"
+)
+
+func TestDrainRejectsAndFinishesRunning(t *testing.T) {
+	for name, parent := range map[string]func() group.SafeWaitGroup{
+		"SafeWaitGroup": group.NewSafeWaitGroup,
+		"bounded":       func() group.SafeWaitGroup { return group.NewBoundedSpawner(4) },
+		"pooled":        func() group.SafeWaitGroup { return group.NewPooledSpawner(4, 4) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			p := parent()
+			defer p.Wait()
+			g := group.Drainable(p)
+
+			release := make(chan struct{})
+			var started, finished atomic.Int64
+			for range 3 {
+				err := g.TryRun(func() {
+					started.Add(1)
+					<-release
+					finished.Add(1)
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			eventually(t, func() bool { return started.Load() == 3 })
+
+			drained := make(chan error)
+			go func() {
+				drained <- g.Drain(context.Background())
+			}()
+			eventually(t, func() bool {
+				return errors.Is(g.TryRun(func() {}), group.ErrDraining)
+			})
+			var ran atomic.Bool
+			g.Run(func() { ran.Store(true) })
+			if err := g.TryRunBatch([]func(){func() { ran.Store(true) }}); !errors.Is(err, group.ErrDraining) {
+				t.Errorf("TryRunBatch while draining = %v, want ErrDraining", err)
+			}
+
+			close(release)
+			if err := <-drained; err != nil {
+				t.Errorf("Drain = %v", err)
+			}
+			if finished.Load() != 3 {
+				t.Errorf("%d running tasks finished when drained, want 3", finished.Load())
+			}
+			g.Wait()
+			if ran.Load() {
+				t.Error("a task run while draining ran")
+			}
+			if err := g.Drain(context.Background()); err != nil {
+				t.Errorf("second Drain = %v", err)
+			}
+		})
+	}
+}
+
+func TestDrainWithoutTasks(t *testing.T) {
+	g := group.Drainable(group.NewSafeWaitGroup())
+	err := g.Drain(context.Background())
+	if err != nil {
+		t.Errorf("Drain of an idle group = %v", err)
+	}
+	if err := g.TryRun(func() {}); !errors.Is(err, group.ErrDraining) {
+		t.Errorf("TryRun after Drain = %v, want ErrDraining", err)
+	}
+}
+
+func TestDrainDeadlineReportsAbandoned(t *testing.T) {
+	p := group.NewSafeWaitGroup()
+	g := group.Drainable(p)
+	release := make(chan struct{})
+	defer func() {
+		close(release)
+		p.Wait()
+	}()
+
+	for range 2 {
+		g.Run(func() { <-release })
+	}
+	g.Run(func() {})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	err := g.Drain(ctx)
+	var drainErr *group.DrainError
+	if !errors.As(err, &drainErr) || drainErr.Abandoned != 2 {
+		t.Fatalf("Drain = %v, want 2 abandoned tasks", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Drain = %v, want it to wrap the deadline", err)
+	}
+}
@@ -0,0 +1,86 @@
+package group
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ErrorPolicy is what ForEach does when fn fails.
+type ErrorPolicy int
+
+const (
+	// FailFast cancels the context of the running calls and skips the items not started yet.
+	FailFast ErrorPolicy = iota
+	// CollectAll runs fn for every item and returns all the errors.
+	CollectAll
+)
+
+type itemError struct {
+	index int
+	err   error
+}
+
+// ForEach calls fn for every item, running at most workers calls at a time.
+// A panic in fn is turned into an error of its item.
+//
+// The returned error joins the errors of the items, prefixed with their indexes, in index order.
+// With FailFast the context.Canceled errors following the first error are left out.
+func ForEach[T any](items []T, workers int, fn func(ctx context.Context, item T) error, policy ErrorPolicy) error {
+	if workers < 1 {
+		workers = 1
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	var errs []itemError
+	fail := func(index int, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if policy == FailFast && len(errs) > 0 && errors.Is(err, context.Canceled) {
+			return
+		}
+		errs = append(errs, itemError{index, err})
+		if policy == FailFast {
+			cancel()
+		}
+	}
+
+	bounded := NewBoundedSpawner(workers)
+	for i, item := range items {
+		if policy == FailFast && ctx.Err() != nil {
+			break
+		}
+		bounded.Run(func() {
+			if policy == FailFast && ctx.Err() != nil {
+				return
+			}
+			err := callRecovering(ctx, fn, item)
+			if err != nil {
+				fail(i, err)
+			}
+		})
+	}
+	bounded.Wait()
+
+	sort.Slice(errs, func(i, j int) bool {
+		return errs[i].index < errs[j].index
+	})
+	joined := make([]error, len(errs))
+	for i, e := range errs {
+		joined[i] = fmt.Errorf("item %d: %w", e.index, e.err)
+	}
+	return errors.Join(joined...)
+}
+
+func callRecovering[T any](ctx context.Context, fn func(ctx context.Context, item T) error, item T) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fn(ctx, item)
+}
@@ -0,0 +1,118 @@
+package group_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/group"
+)
+
+func TestForEachCollectAll(t *testing.T) {
+	errOdd := errors.New("odd")
+	var calls atomic.Int64
+	err := group.ForEach([]int{0, 1, 2, 3, 4, 5}, 2, func(ctx context.Context, i int) error {
+		calls.Add(1)
+		if i%2 == 1 {
+			return errOdd
+		}
+		return nil
+	}, group.CollectAll)
+
+	if calls.Load() != 6 {
+		t.Errorf("fn called %d times, want every item", calls.Load())
+	}
+	if !errors.Is(err, errOdd) || err.Error() != "item 1: odd\nitem 3: odd\nitem 5: odd" {
+		t.Errorf("ForEach = %q, want the errors of the odd items by index", err)
+	}
+}
+
+func TestForEachFailFast(t *testing.T) {
+	errBoom := errors.New("boom")
+	items := make([]int, 100)
+	for i := range items {
+		items[i] = i
+	}
+	var calls atomic.Int64
+	err := group.ForEach(items, 3, func(ctx context.Context, i int) error {
+		calls.Add(1)
+		if i == 0 {
+			return errBoom
+		}
+		<-ctx.Done() // stopped by the failure
+		return ctx.Err()
+	}, group.FailFast)
+
+	if err == nil || err.Error() != "item 0: boom" {
+		t.Errorf("ForEach = %q, want the first error alone", err)
+	}
+	if n := calls.Load(); n > 3 {
+		t.Errorf("fn called %d times, want the items after the failure skipped", n)
+	}
+}
+
+func TestForEachWorkers(t *testing.T) {
+	var mu sync.Mutex
+	running, most := 0, 0
+	started := make(chan struct{})
+	var once sync.Once
+	err := group.ForEach([]string{"a", "b", "c"}, 10, func(ctx context.Context, s string) error {
+		mu.Lock()
+		running++
+		most = max(most, running)
+		if running == 3 {
+			once.Do(func() { close(started) })
+		}
+		mu.Unlock()
+		<-started // all three at once, fewer items than workers
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return nil
+	}, group.CollectAll)
+	if err != nil || most != 3 {
+		t.Errorf("ForEach = %v with %d calls at most at a time, want 3", err, most)
+	}
+
+	running, most = 0, 0
+	err = group.ForEach(make([]int, 20), 4, func(ctx context.Context, _ int) error {
+		mu.Lock()
+		running++
+		most = max(most, running)
+		mu.Unlock()
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return nil
+	}, group.FailFast)
+	if err != nil || most > 4 {
+		t.Errorf("ForEach = %v with %d calls at most at a time, want up to 4", err, most)
+	}
+}
+
+func TestForEachEmpty(t *testing.T) {
+	for _, policy := range []group.ErrorPolicy{group.FailFast, group.CollectAll} {
+		err := group.ForEach(nil, 3, func(context.Context, int) error {
+			t.Error("fn called without items")
+			return nil
+		}, policy)
+		if err != nil {
+			t.Errorf("ForEach = %v", err)
+		}
+	}
+}
+
+func TestForEachPanic(t *testing.T) {
+	err := group.ForEach([]int{0, 1, 2}, 2, func(ctx context.Context, i int) error {
+		if i == 1 {
+			panic("kaboom")
+		}
+		return nil
+	}, group.CollectAll)
+	if err == nil || !strings.Contains(err.Error(), "item 1: panic: kaboom") {
+		t.Errorf("ForEach = %v, want the panic as the error of item 1", err)
+	}
+}
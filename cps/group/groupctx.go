@@ -0,0 +1,91 @@
+package group
+
+import (
+	"context"
+)
+
+// GroupContext is the context of the group s runs its tasks in, done once the group is cancelled:
+// the Context of a CancelGroup whose Spawner s is, through Scope and WrapSpawner too.
+// It is context.Background() for the groups which can't be cancelled.
+//
+// RunCtx and RunCtxErr derive the context of their tasks from it, so cancelling the group
+// unblocks the tasks waiting with their ctx: in Barrier.Await, the UseCtx of a resource.Pool,
+// the UseNCtx of a resource.WeightedSemaphore... Only the waits given that ctx: Go has no context
+// attached to a goroutine, so the plain Use and UseN of a task still wait after the group is cancelled,
+// and so does the Wait of the group, for that task.
+func GroupContext(s Spawner) context.Context {
+	switch s := s.(type) {
+	case interface{ Context() context.Context }:
+		return s.Context()
+	case *scope:
+		return GroupContext(s.parent)
+	case *wrappedSpawner:
+		return GroupContext(s.spawner)
+	case *drainableGroup:
+		return GroupContext(s.parent)
+	}
+	return context.Background()
+}
+
+// groupContext is GroupContext for both kinds of spawners.
+func groupContext(s any) context.Context {
+	switch s := s.(type) {
+	case Spawner:
+		return GroupContext(s)
+	case interface{ Context() context.Context }:
+		return s.Context()
+	}
+	return context.Background()
+}
+
+// cancelSpawner is the Spawner of a CancelGroup.
+type cancelSpawner struct {
+	g *errGroup
+}
+
+func (s cancelSpawner) Run(task func()) {
+	s.g.Run(func() error {
+		task()
+		return nil
+	})
+}
+
+func (s cancelSpawner) Context() context.Context {
+	return s.g.ctx
+}
+
+// untilDone is ctx which is also cancelled, with its cause, once group is done.
+func untilDone(ctx, group context.Context) (context.Context, context.CancelFunc) {
+	if group.Done() == nil {
+		return ctx, func() {}
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	stop := context.AfterFunc(group, func() {
+		cancel(context.Cause(group))
+	})
+	return ctx, func() {
+		stop()
+		cancel(nil)
+	}
+}
+
+// ctxRunner is a Spawner whose Run may block, and which can give up when ctx is done.
+type ctxRunner interface {
+	runCtx(ctx context.Context, task func()) bool
+}
+
+// runCtx is Run giving up waiting for a slot when ctx is done.
+func (bwg *boundedWaitGroup) runCtx(ctx context.Context, task func()) bool {
+	select {
+	case bwg.slots <- struct{}{}:
+	case <-ctx.Done():
+		return false
+	}
+	bwg.swg.Run(func() {
+		defer func() {
+			<-bwg.slots
+		}()
+		task()
+	})
+	return true
+}
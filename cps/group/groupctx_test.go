@@ -0,0 +1,204 @@
+package group_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/group"
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+func TestGroupCancellationUnblocksWaits(t *testing.T) {
+	release := make(chan struct{})
+	held := group.NewSafeWaitGroup()
+	defer held.Wait()
+	defer close(release)
+
+	// the semaphore and the pool are held outside of the group until the end of the test
+	sem := resource.NewWeightedSemaphore(1)
+	pool := resource.NewPool(func() (int, error) { return 1, nil }, func(int) error { return nil }, 1)
+	holding := make(chan struct{}, 2)
+	held.Run(func() {
+		_ = sem.UseN(1, func() error {
+			holding <- struct{}{}
+			<-release
+			return nil
+		})
+	})
+	held.Run(func() {
+		_ = pool.Use(func(int) error {
+			holding <- struct{}{}
+			<-release
+			return nil
+		})
+	})
+	<-holding
+	<-holding
+	barrier := group.NewBarrier(2)
+
+	g := group.NewCancelGroup(context.Background())
+	waits := map[string]func(ctx context.Context) error{
+		"semaphore": func(ctx context.Context) error {
+			return sem.UseNCtx(ctx, 1, func() error { return nil })
+		},
+		"pool": func(ctx context.Context) error {
+			return pool.UseCtx(ctx, func(int) error { return nil })
+		},
+		"barrier": barrier.Await,
+	}
+	var blocked atomic.Int64
+	errs := make(chan error, len(waits))
+	for name, wait := range waits {
+		group.RunCtx(g.Spawner(), context.Background(), func(ctx context.Context) {
+			blocked.Add(1)
+			err := wait(ctx)
+			if err != nil {
+				err = errors.Join(errors.New(name), err)
+			}
+			errs <- err
+		})
+	}
+	eventually(t, func() bool { return blocked.Load() == int64(len(waits)) })
+	time.Sleep(10 * time.Millisecond)
+
+	errStop := errors.New("stop")
+	g.Cancel(errStop)
+	waited := make(chan error, 1)
+	go func() {
+		waited <- g.Wait()
+	}()
+	select {
+	case err := <-waited:
+		if !errors.Is(err, errStop) {
+			t.Errorf("Wait = %v, want %v", err, errStop)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Wait blocked after cancelling the group")
+	}
+	for range waits {
+		if err := <-errs; !errors.Is(err, context.Canceled) {
+			t.Errorf("blocked task returned %v, want context.Canceled", err)
+		}
+	}
+}
+
+func TestGroupCancellationLeavesPlainUseWaiting(t *testing.T) {
+	release := make(chan struct{})
+	held := group.NewSafeWaitGroup()
+	sem := resource.NewWeightedSemaphore(1)
+	pool := resource.NewPool(func() (int, error) { return 1, nil }, func(int) error { return nil }, 1)
+	holding := make(chan struct{}, 2)
+	held.Run(func() {
+		_ = sem.UseN(1, func() error {
+			holding <- struct{}{}
+			<-release
+			return nil
+		})
+	})
+	held.Run(func() {
+		_ = pool.Use(func(int) error {
+			holding <- struct{}{}
+			<-release
+			return nil
+		})
+	})
+	<-holding
+	<-holding
+
+	g := group.NewCancelGroup(context.Background())
+	// the plain Use and UseN don't know the ctx of the task
+	waits := []func() error{
+		func() error { return sem.UseN(1, func() error { return nil }) },
+		func() error { return pool.Use(func(int) error { return nil }) },
+	}
+	var blocked, done atomic.Int64
+	for _, wait := range waits {
+		group.RunCtx(g.Spawner(), context.Background(), func(context.Context) {
+			blocked.Add(1)
+			if wait() == nil {
+				done.Add(1)
+			}
+		})
+	}
+	eventually(t, func() bool { return blocked.Load() == int64(len(waits)) })
+
+	errStop := errors.New("stop")
+	g.Cancel(errStop)
+	waited := make(chan error, 1)
+	go func() {
+		waited <- g.Wait()
+	}()
+	select {
+	case err := <-waited:
+		t.Fatalf("Wait = %v with the tasks waiting in the plain Use", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+	if n := done.Load(); n != 0 {
+		t.Errorf("%d plain Use returned before the release", n)
+	}
+
+	close(release)
+	held.Wait()
+	if err := <-waited; !errors.Is(err, errStop) {
+		t.Errorf("Wait = %v, want %v", err, errStop)
+	}
+	if n := done.Load(); n != int64(len(waits)) {
+		t.Errorf("%d plain Use succeeded after the release, want %d", n, len(waits))
+	}
+}
+
+func TestGroupCancellationDropsTaskWaitingForSlot(t *testing.T) {
+	bounded := group.NewBoundedSpawner(1)
+	release := make(chan struct{})
+	bounded.Run(func() { <-release })
+	defer bounded.Wait()
+	defer close(release)
+
+	g := group.NewCancelGroup(context.Background())
+	ran := make(chan struct{})
+	g.Spawner().Run(func() {
+		// the slot of the bounded spawner is taken: RunCtx waits for it with the ctx of the group
+		group.RunCtx(bounded, g.Context(), func(context.Context) {
+			close(ran)
+		})
+	})
+	time.Sleep(10 * time.Millisecond)
+
+	g.Cancel(errors.New("stop"))
+	waited := make(chan struct{})
+	go func() {
+		defer close(waited)
+		_ = g.Wait()
+	}()
+	select {
+	case <-waited:
+	case <-time.After(time.Second):
+		t.Fatal("Wait blocked with a task waiting for a slot")
+	}
+	select {
+	case <-ran:
+		t.Error("the task waiting for a slot ran after the group was cancelled")
+	default:
+	}
+}
+
+func TestGroupContext(t *testing.T) {
+	g := group.NewCancelGroup(context.Background())
+	for name, s := range map[string]group.Spawner{
+		"spawner":   g.Spawner(),
+		"scope":     group.Scope(g.Spawner()),
+		"drainable": group.Drainable(g.Spawner()),
+	} {
+		if group.GroupContext(s) != g.Context() {
+			t.Errorf("GroupContext of the %s isn't the context of the group", name)
+		}
+	}
+	if ctx := group.GroupContext(group.NewSafeWaitGroup()); ctx.Done() != nil {
+		t.Error("GroupContext of a SafeWaitGroup can be cancelled")
+	}
+	g.Cancel(errors.New("stop"))
+	_ = g.Wait()
+}
@@ -0,0 +1,27 @@
+package group_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource/resourcetest"
+)
+
+// epoch is the start of the fake clocks of the tests.
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// eventually polls cond until it holds, failing the test after a second.
+func eventually(t testing.TB, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met after a second")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func newFakeClock() *resourcetest.FakeClock {
+	return resourcetest.NewFakeClock(epoch)
+}
@@ -0,0 +1,103 @@
+package group
+
+import (
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultKeyedQueue is how many tasks wait in the queue of a worker of NewKeyedSpawner by default.
+const DefaultKeyedQueue = 64
+
+// KeyedSpawner runs the tasks of a key one after the other, in the order they were submitted,
+// and the tasks of different keys in parallel.
+type KeyedSpawner interface {
+	SafeWaitGroup
+	// RunKeyed queues task on the worker of key; it blocks while that queue is full.
+	RunKeyed(key string, task func())
+}
+
+// KeyedOption configures NewKeyedSpawner.
+type KeyedOption func(s *keyedSpawner)
+
+// WithKeyedQueue sets how many tasks wait in the queue of each worker, DefaultKeyedQueue by default.
+func WithKeyedQueue(n int) KeyedOption {
+	return func(s *keyedSpawner) {
+		s.queue = max(n, 1)
+	}
+}
+
+// NewKeyedSpawner creates a group of workers goroutines, the key of a task choosing its worker:
+// two keys may share one, so a slow task delays the next tasks of its worker, whatever their keys.
+// Run spreads the tasks without a key over the workers.
+func NewKeyedSpawner(workers int, opts ...KeyedOption) KeyedSpawner {
+	if workers < 1 {
+		workers = 1
+	}
+	s := &keyedSpawner{swg: NewSafeWaitGroup(), queue: DefaultKeyedQueue}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.workers = make([]*keyedWorker, workers)
+	for i := range s.workers {
+		s.workers[i] = &keyedWorker{queue: make(chan func(), s.queue)}
+	}
+	return s
+}
+
+type keyedSpawner struct {
+	swg     SafeWaitGroup
+	queue   int
+	workers []*keyedWorker
+	next    atomic.Uint64 // worker of the next Run
+}
+
+// keyedWorker has a goroutine only while its queue isn't empty.
+type keyedWorker struct {
+	queue   chan func()
+	mu      sync.Mutex
+	running bool
+}
+
+func (s *keyedSpawner) Run(task func()) {
+	s.submit(s.workers[(s.next.Add(1)-1)%uint64(len(s.workers))], task)
+}
+
+func (s *keyedSpawner) RunKeyed(key string, task func()) {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	s.submit(s.workers[h.Sum32()%uint32(len(s.workers))], task)
+}
+
+func (s *keyedSpawner) submit(w *keyedWorker, task func()) {
+	w.queue <- task
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.running {
+		w.running = true
+		s.swg.Run(w.work)
+	}
+}
+
+// work runs the queued tasks until the queue is empty.
+func (w *keyedWorker) work() {
+	for {
+		select {
+		case task := <-w.queue:
+			task()
+			continue
+		default:
+		}
+		w.mu.Lock()
+		if len(w.queue) == 0 {
+			w.running = false
+			w.mu.Unlock()
+			return
+		}
+		w.mu.Unlock()
+	}
+}
+
+func (s *keyedSpawner) Wait() {
+	s.swg.Wait()
+}
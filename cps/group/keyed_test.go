@@ -0,0 +1,142 @@
+package group_test
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/group"
+)
+
+// keysOnWorkers returns one key per worker of a keyed spawner of workers workers,
+// hashing them as RunKeyed does.
+func keysOnWorkers(workers int) []string {
+	keys := make([]string, workers)
+	found := 0
+	for i := 0; found < workers; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		h := fnv.New32a()
+		h.Write([]byte(key))
+		if w := h.Sum32() % uint32(workers); keys[w] == "" {
+			keys[w] = key
+			found++
+		}
+	}
+	return keys
+}
+
+func TestKeyedSpawnerKeepsOrderPerKey(t *testing.T) {
+	const keys, perKey = 20, 200
+	spawner := group.NewKeyedSpawner(4, group.WithKeyedQueue(8))
+	var mu sync.Mutex
+	logs := make(map[string][]int)
+
+	submitters := group.NewSafeWaitGroup()
+	for k := range keys {
+		key := fmt.Sprintf("user-%d", k)
+		// each key has a submitter of its own, so the keys interleave in the queues
+		submitters.Run(func() {
+			for i := range perKey {
+				spawner.RunKeyed(key, func() {
+					if rand.IntN(10) == 0 {
+						time.Sleep(time.Microsecond)
+					}
+					mu.Lock()
+					logs[key] = append(logs[key], i)
+					mu.Unlock()
+				})
+			}
+		})
+	}
+	submitters.Wait()
+	spawner.Wait()
+
+	if len(logs) != keys {
+		t.Fatalf("%d keys ran, want %d", len(logs), keys)
+	}
+	for key, log := range logs {
+		if len(log) != perKey || !slices.IsSorted(log) {
+			t.Errorf("tasks of %s ran %d times, in order %v; want %d in submission order", key, len(log), slices.IsSorted(log), perKey)
+		}
+	}
+}
+
+func TestKeyedSpawnerRunsKeysInParallel(t *testing.T) {
+	const workers = 4
+	spawner := group.NewKeyedSpawner(workers)
+	release := make(chan struct{})
+	var active, most atomic.Int64
+	for _, key := range keysOnWorkers(workers) {
+		for range 3 {
+			spawner.RunKeyed(key, func() {
+				n := active.Add(1)
+				for m := most.Load(); n > m && !most.CompareAndSwap(m, n); m = most.Load() {
+				}
+				<-release
+				active.Add(-1)
+			})
+		}
+	}
+	eventually(t, func() bool { return active.Load() == workers })
+	close(release)
+	spawner.Wait()
+	if most.Load() != workers {
+		t.Errorf("%d tasks at a time, want one per key on %d workers", most.Load(), workers)
+	}
+}
+
+func TestKeyedSpawnerBlocksOnFullQueue(t *testing.T) {
+	spawner := group.NewKeyedSpawner(1, group.WithKeyedQueue(2))
+	release := make(chan struct{})
+	started := make(chan struct{})
+	spawner.RunKeyed("a", func() {
+		close(started)
+		<-release
+	})
+	<-started
+	// the running task is out of the queue: two more fit in it
+	spawner.RunKeyed("a", func() {})
+	spawner.RunKeyed("b", func() {})
+
+	submitted := make(chan struct{})
+	go func() {
+		defer close(submitted)
+		spawner.RunKeyed("c", func() {})
+	}()
+	select {
+	case <-submitted:
+		t.Fatal("RunKeyed returned with the queue full")
+	case <-time.After(10 * time.Millisecond):
+	}
+	close(release)
+	<-submitted
+	spawner.Wait()
+}
+
+func TestKeyedSpawnerWaitRunsEveryTask(t *testing.T) {
+	spawner := group.NewKeyedSpawner(3, group.WithKeyedQueue(1))
+	var ran atomic.Int64
+	for i := range 100 {
+		if i%2 == 0 {
+			spawner.Run(func() { ran.Add(1) })
+		} else {
+			spawner.RunKeyed(fmt.Sprint(i%7), func() { ran.Add(1) })
+		}
+	}
+	spawner.Wait()
+	if n := ran.Load(); n != 100 {
+		t.Errorf("%d tasks ran by Wait, want 100", n)
+	}
+
+	// the workers start again after Wait
+	spawner.RunKeyed("again", func() { ran.Add(1) })
+	spawner.Wait()
+	if n := ran.Load(); n != 101 {
+		t.Errorf("%d tasks ran by the second Wait, want 101", n)
+	}
+}
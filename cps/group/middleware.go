@@ -0,0 +1,132 @@
+package group
+
+import (
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sync/atomic"
+)
+
+// Middleware wraps every task run by a spawner, see WrapSpawner.
+type Middleware func(task func()) func()
+
+type wrappedSpawner struct {
+	spawner     Spawner
+	middlewares []Middleware
+}
+
+// WrapSpawner returns a spawner running the tasks through s wrapped by the middlewares,
+// the first one outermost. Waiting for s waits for the wrapped tasks.
+func WrapSpawner(s Spawner, mw ...Middleware) Spawner {
+	return &wrappedSpawner{spawner: s, middlewares: mw}
+}
+
+func (ws *wrappedSpawner) Run(task func()) {
+	ws.spawner.Run(wrap(task, ws.middlewares))
+}
+
+func wrap(task func(), middlewares []Middleware) func() {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		task = middlewares[i](task)
+	}
+	return task
+}
+
+// PanicError is a recovered panic.
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// Unwrap returns the panic value when it's an error, like the runtime.Error of a nil map write.
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// Recover stops the panics of the tasks, reporting them as *PanicError to report,
+// or logging them with slog.Default() when report is nil.
+func Recover(report func(err error)) Middleware {
+	if report == nil {
+		report = func(err error) {
+			slog.Default().Error("task panicked", "error", err, "stack", string(err.(*PanicError).Stack))
+		}
+	}
+	return func(task func()) func() {
+		return func() {
+			defer func() {
+				if r := recover(); r != nil {
+					report(&PanicError{Value: r, Stack: debug.Stack()})
+				}
+			}()
+			task()
+		}
+	}
+}
+
+type recoveringSpawner struct {
+	spawner ErrSpawner
+}
+
+// RecoverErrors returns s whose task panics are the errors of their tasks, as *PanicError,
+// instead of crashing the program. runtime.Goexit isn't a panic and isn't stopped.
+func RecoverErrors(s ErrSpawner) ErrSpawner {
+	return &recoveringSpawner{spawner: s}
+}
+
+func (rs *recoveringSpawner) Run(task func() error) {
+	rs.spawner.Run(func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = &PanicError{Value: r, Stack: debug.Stack()}
+			}
+		}()
+		return task()
+	})
+}
+
+type timedOptions struct {
+	clock Clock
+}
+
+// TimedOption configures Timed.
+type TimedOption func(options *timedOptions)
+
+// TimedClock makes Timed measure the tasks with clock.
+func TimedClock(clock Clock) TimedOption {
+	return func(options *timedOptions) {
+		options.clock = clock
+	}
+}
+
+// Timed logs the duration of every task at debug level.
+func Timed(logger *slog.Logger, opts ...TimedOption) Middleware {
+	var options timedOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	clock := clockOr(options.clock)
+	return func(task func()) func() {
+		return func() {
+			started := clock.Now()
+			defer func() {
+				logger.Debug("task done", "duration", clock.Now().Sub(started))
+			}()
+			task()
+		}
+	}
+}
+
+// Counter atomically adds one to *n for every finished task, panicked ones included.
+func Counter(n *int64) Middleware {
+	return func(task func()) func() {
+		return func() {
+			defer atomic.AddInt64(n, 1)
+			task()
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package group_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/group"
+)
+
+func TestTimedOnClock(t *testing.T) {
+	clock := newFakeClock()
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	group.Timed(logger, group.TimedClock(clock))(func() {
+		clock.Advance(2 * time.Second)
+	})()
+	if !strings.Contains(logs.String(), "duration=2s") {
+		t.Fatalf("logged %q, want the duration on the clock", logs.String())
+	}
+}
+
+// tracing records entering and leaving its name around the task.
+func tracing(mu *sync.Mutex, events *[]string, name string) group.Middleware {
+	record := func(event string) {
+		mu.Lock()
+		defer mu.Unlock()
+		*events = append(*events, event)
+	}
+	return func(task func()) func() {
+		return func() {
+			record(name + " in")
+			defer record(name + " out")
+			task()
+		}
+	}
+}
+
+func TestWrapSpawnerOrder(t *testing.T) {
+	var mu sync.Mutex
+	var events []string
+	group.RunGroup(func(s group.Spawner) {
+		s.Run(func() {
+			mu.Lock()
+			events = append(events, "task")
+			mu.Unlock()
+		})
+	}, tracing(&mu, &events, "outer"), tracing(&mu, &events, "inner"))
+	if want := []string{"outer in", "inner in", "task", "inner out", "outer out"}; !slices.Equal(events, want) {
+		t.Errorf("events = %q, want %q", events, want)
+	}
+}
+
+func TestRecoverInsideOuterMiddleware(t *testing.T) {
+	var mu sync.Mutex
+	var events []string
+	var reported []error
+	s := group.NewSafeWaitGroup()
+	wrapped := group.WrapSpawner(s, tracing(&mu, &events, "outer"), group.Recover(func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		reported = append(reported, err)
+	}))
+	wrapped.Run(func() { panic("boom") })
+	s.Wait()
+
+	// the outer middleware finishes normally, the panic stopped inside it
+	if want := []string{"outer in", "outer out"}; !slices.Equal(events, want) {
+		t.Errorf("events = %q, want %q", events, want)
+	}
+	var panicErr *group.PanicError
+	if len(reported) != 1 || !errors.As(reported[0], &panicErr) || panicErr.Value != "boom" || len(panicErr.Stack) == 0 {
+		t.Errorf("reported %v, want the panic with its stack", reported)
+	}
+}
+
+func TestRecoverLogsByDefault(t *testing.T) {
+	var logs bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	t.Cleanup(func() {
+		slog.SetDefault(previous)
+	})
+	group.RunGroup(func(s group.Spawner) {
+		s.Run(func() { panic("boom") })
+	}, group.Recover(nil))
+	if !strings.Contains(logs.String(), `msg="task panicked" error="panic: boom"`) {
+		t.Errorf("logged %q, want the panic", logs.String())
+	}
+}
+
+func TestRecoverErrors(t *testing.T) {
+	errTask := errors.New("task")
+	err := group.RunGroupCtx(context.Background(), func(ctx context.Context, s group.ErrSpawner) error {
+		s = group.RecoverErrors(s)
+		s.Run(func() error { return errTask })
+		s.Run(func() error {
+			var m map[string]int
+			m["write"] = 1 // a runtime error
+			return nil
+		})
+		return nil
+	})
+	var panicErr *group.PanicError
+	var runtimeErr runtime.Error
+	if !errors.Is(err, errTask) || !errors.As(err, &panicErr) || !errors.As(err, &runtimeErr) {
+		t.Errorf("RunGroupCtx = %v, want the task error and the panic, a runtime.Error", err)
+	}
+}
+
+func TestCounterWaitAccountsForWrappedTasks(t *testing.T) {
+	var n int64
+	var finished atomic.Int64
+	group.RunGroup(func(s group.Spawner) {
+		for range 100 {
+			s.Run(func() {
+				time.Sleep(time.Millisecond)
+				finished.Add(1)
+			})
+		}
+		s.Run(func() { panic("boom") })
+	}, group.Counter(&n), group.Recover(func(error) {}))
+	// RunGroup waited for every wrapped task, the panicked one included
+	if n != 101 || finished.Load() != 100 {
+		t.Errorf("counted %d tasks, %d finished, want 101 and 100", n, finished.Load())
+	}
+}
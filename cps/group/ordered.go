@@ -0,0 +1,121 @@
+package group
+
+import (
+	"sync"
+)
+
+type orderedOptions struct {
+	window int
+}
+
+// OrderedOption configures NewOrderedGroup.
+type OrderedOption func(options *orderedOptions)
+
+// WithReorderWindow bounds how many submitted results wait to be consumed, 2×workers by default:
+// Submit blocks while the window is full.
+func WithReorderWindow(n int) OrderedOption {
+	return func(options *orderedOptions) {
+		options.window = n
+	}
+}
+
+// OrderedGroup runs tasks in parallel and hands their results out in submission order.
+//
+// One goroutine submits the tasks and calls Close, another one Consumes:
+//
+//	g := group.NewOrderedGroup[string](4)
+//	go func() {
+//		defer g.Close()
+//		for _, name := range names {
+//			g.Submit(func() (string, error) { return render(name) })
+//		}
+//	}()
+//	err := g.Consume(func(page string) error { return write(page) })
+type OrderedGroup[T any] struct {
+	spawner SafeWaitGroup
+	window  chan struct{}
+	pending chan chan orderedResult[T]
+
+	failOnce sync.Once
+	failed   chan struct{}
+}
+
+type orderedResult[T any] struct {
+	value T
+	err   error
+	ran   bool
+}
+
+// NewOrderedGroup creates a group running at most workers tasks at a time.
+func NewOrderedGroup[T any](workers int, opts ...OrderedOption) *OrderedGroup[T] {
+	if workers < 1 {
+		workers = 1
+	}
+	options := orderedOptions{window: 2 * workers}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.window < 1 {
+		options.window = 1
+	}
+	return &OrderedGroup[T]{
+		spawner: NewBoundedSpawner(workers),
+		window:  make(chan struct{}, options.window),
+		pending: make(chan chan orderedResult[T], options.window),
+		failed:  make(chan struct{}),
+	}
+}
+
+// Submit queues task, blocking while the reorder window is full.
+// Once a task or the consumer failed, Submit drops its task and returns at once;
+// the tasks already queued but not started are skipped.
+func (g *OrderedGroup[T]) Submit(task func() (T, error)) {
+	select {
+	case g.window <- struct{}{}:
+	case <-g.failed:
+		return
+	}
+	result := make(chan orderedResult[T], 1)
+	g.pending <- result
+	g.spawner.Run(func() {
+		select {
+		case <-g.failed:
+			result <- orderedResult[T]{}
+			return
+		default:
+		}
+		value, err := task()
+		result <- orderedResult[T]{value: value, err: err, ran: true}
+	})
+}
+
+// Close tells Consume that no more tasks will be submitted; Submit must not be called afterwards.
+func (g *OrderedGroup[T]) Close() {
+	close(g.pending)
+}
+
+// Consume calls fn with the results in submission order until Close was called and all of them were consumed.
+// The first error of a task or of fn stops everything: Consume waits for the running tasks
+// and returns it.
+func (g *OrderedGroup[T]) Consume(fn func(value T) error) error {
+	var firstErr error
+	for result := range g.pending {
+		r := <-result
+		<-g.window
+		if firstErr != nil || !r.ran {
+			continue
+		}
+		err := r.err
+		if err == nil {
+			err = fn(r.value)
+		}
+		if err != nil {
+			firstErr = err
+			g.failOnce.Do(func() {
+				close(g.failed)
+			})
+		}
+	}
+	g.spawner.Wait()
+	return firstErr
+}
@@ -0,0 +1,136 @@
+package group_test
+
+import (
+	"errors"
+	"math/rand/v2"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/group"
+)
+
+func TestOrderedGroupKeepsSubmissionOrder(t *testing.T) {
+	const n = 200
+	random := rand.New(rand.NewPCG(1, 2))
+	durations := make([]time.Duration, n)
+	for i := range durations {
+		durations[i] = time.Duration(random.IntN(2000)) * time.Microsecond
+	}
+
+	g := group.NewOrderedGroup[int](8)
+	go func() {
+		defer g.Close()
+		for i := range n {
+			g.Submit(func() (int, error) {
+				time.Sleep(durations[i])
+				return i, nil
+			})
+		}
+	}()
+	var got []int
+	err := g.Consume(func(i int) error {
+		got = append(got, i)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range got {
+		if v != i {
+			t.Fatalf("result %d = %d, want the submission order", i, v)
+		}
+	}
+	if len(got) != n {
+		t.Errorf("consumed %d results, want %d", len(got), n)
+	}
+}
+
+func TestOrderedGroupWindowBlocksSubmit(t *testing.T) {
+	g := group.NewOrderedGroup[int](8, group.WithReorderWindow(3))
+	var submitted, ran atomic.Int64
+	go func() {
+		defer g.Close()
+		for i := range 20 {
+			g.Submit(func() (int, error) {
+				ran.Add(1)
+				return i, nil
+			})
+			submitted.Add(1)
+		}
+	}()
+
+	release := make(chan struct{})
+	consumed := make(chan error)
+	go func() {
+		consumed <- g.Consume(func(i int) error {
+			if i == 0 {
+				<-release
+			}
+			return nil
+		})
+	}()
+
+	// the result given to the consumer left the window, three more fill it
+	eventually(t, func() bool { return submitted.Load() == 4 && ran.Load() == 4 })
+	time.Sleep(20 * time.Millisecond)
+	if submitted.Load() != 4 || ran.Load() != 4 {
+		t.Errorf("%d tasks submitted and %d ran while the consumer is stuck, want the window of 3 after the consumed one", submitted.Load(), ran.Load())
+	}
+
+	close(release)
+	if err := <-consumed; err != nil {
+		t.Fatal(err)
+	}
+	if submitted.Load() != 20 || ran.Load() != 20 {
+		t.Errorf("%d tasks submitted and %d ran, want all of them", submitted.Load(), ran.Load())
+	}
+}
+
+func TestOrderedGroupErrorStops(t *testing.T) {
+	errTask := errors.New("task failed")
+	for name, fail := range map[string]struct{ task, consumer bool }{
+		"task":     {task: true},
+		"consumer": {consumer: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			g := group.NewOrderedGroup[int](2, group.WithReorderWindow(4))
+			var ran atomic.Int64
+			submitDone := make(chan struct{})
+			go func() {
+				defer close(submitDone)
+				defer g.Close()
+				for i := range 1000 {
+					g.Submit(func() (int, error) {
+						ran.Add(1)
+						if fail.task && i == 5 {
+							return 0, errTask
+						}
+						return i, nil
+					})
+				}
+			}()
+
+			var got []int
+			err := g.Consume(func(i int) error {
+				if fail.consumer && i == 5 {
+					return errTask
+				}
+				got = append(got, i)
+				return nil
+			})
+			<-submitDone
+			if !errors.Is(err, errTask) {
+				t.Errorf("Consume = %v, want the error", err)
+			}
+			if want := []int{0, 1, 2, 3, 4}; !slices.Equal(got, want) {
+				t.Errorf("consumed %v, want %v", got, want)
+			}
+			// the window and the workers bound the tasks started past the failure
+			if ran.Load() > 5+1+4+2 {
+				t.Errorf("%d tasks ran, want the outstanding ones cancelled", ran.Load())
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package group
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+)
+
+// Pipeline shuts the stages run in it down together: at the first error of one of them,
+// or when the context it was created with is done, every stage stops reading its input,
+// and its workers return and close its output, without draining anything.
+// The sources feeding the first stage must stop sending once Done is closed.
+type Pipeline struct {
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+}
+
+// NewPipeline creates a pipeline shutting down when ctx is done.
+func NewPipeline(ctx context.Context) *Pipeline {
+	ctx, cancel := context.WithCancelCause(ctx)
+	return &Pipeline{ctx: ctx, cancel: cancel}
+}
+
+// Done is closed once the pipeline shuts down.
+func (p *Pipeline) Done() <-chan struct{} {
+	return p.ctx.Done()
+}
+
+// Err is why the pipeline shut down: the first error of a stage, or the error of its context; nil while it runs.
+func (p *Pipeline) Err() error {
+	if p.ctx.Err() == nil {
+		return nil
+	}
+	return context.Cause(p.ctx)
+}
+
+// Source sends values to the returned channel for the first stage of p, and closes it
+// once they are all sent or p shuts down.
+func Source[A any](p *Pipeline, values ...A) <-chan A {
+	out := make(chan A)
+	go func() {
+		defer close(out)
+		for _, a := range values {
+			select {
+			case out <- a:
+			case <-p.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+type stageOptions struct {
+	pipeline *Pipeline
+}
+
+// StageOption configures Stage.
+type StageOption func(options *stageOptions)
+
+// InPipeline runs the stage in p: its first error shuts p down, and p shutting down stops the stage.
+func InPipeline(p *Pipeline) StageOption {
+	return func(options *stageOptions) {
+		options.pipeline = p
+	}
+}
+
+// Stage runs fn for the values of in with workers goroutines and sends the results to the returned channel,
+// which is closed once in is closed and drained. The order of the results is not kept.
+//
+// The first error of fn is sent to the error channel; the stage then stops calling fn,
+// but keeps draining in so the upstream stages don't block, and closes its output to shut the
+// downstream stages down. The error channel is closed when the stage is done.
+// With InPipeline, the error shuts the whole pipeline down instead, upstream stages included,
+// and nothing is drained.
+//
+// The output must be read until it is closed, by the next Stage or by Collect.
+func Stage[A, B any](in <-chan A, workers int, fn func(A) (B, error), opts ...StageOption) (<-chan B, <-chan error) {
+	if workers < 1 {
+		workers = 1
+	}
+	var options stageOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	var done <-chan struct{} // nil without a pipeline: never closed
+	if options.pipeline != nil {
+		done = options.pipeline.Done()
+	}
+	out := make(chan B)
+	errc := make(chan error, 1)
+
+	var failed atomic.Bool
+	fail := func(err error) {
+		if failed.CompareAndSwap(false, true) {
+			errc <- err
+		}
+		if options.pipeline != nil {
+			options.pipeline.cancel(err)
+		}
+	}
+	swg := NewSafeWaitGroup()
+	for range workers {
+		swg.Run(func() {
+			for {
+				var a A
+				var ok bool
+				select {
+				case a, ok = <-in:
+				case <-done:
+					return
+				}
+				if !ok {
+					return
+				}
+				if failed.Load() {
+					continue
+				}
+				b, err := fn(a)
+				if err != nil {
+					fail(err)
+					continue
+				}
+				select {
+				case out <- b:
+				case <-done:
+					return
+				}
+			}
+		})
+	}
+	go func() {
+		swg.Wait()
+		close(out)
+		close(errc)
+	}()
+	return out, errc
+}
+
+// Collect reads out until it is closed and returns the values,
+// with the errors of the error channels of the stages joined.
+func Collect[B any](out <-chan B, errcs ...<-chan error) ([]B, error) {
+	var values []B
+	for b := range out {
+		values = append(values, b)
+	}
+	var errs []error
+	for _, errc := range errcs {
+		for err := range errc {
+			errs = append(errs, err)
+		}
+	}
+	return values, errors.Join(errs...)
+}
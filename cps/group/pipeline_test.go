@@ -0,0 +1,134 @@
+package group_test
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/group"
+)
+
+// noLeaks fails the test unless the goroutines started while it ran are all gone at the end.
+func noLeaks(t *testing.T) {
+	t.Helper()
+	before := runtime.NumGoroutine()
+	t.Cleanup(func() {
+		eventually(t, func() bool {
+			return runtime.NumGoroutine() <= before
+		})
+	})
+}
+
+// naturals sends 0, 1, 2... until p shuts down.
+func naturals(p *group.Pipeline) <-chan int {
+	out := make(chan int)
+	go func() {
+		defer close(out)
+		for i := 0; ; i++ {
+			select {
+			case out <- i:
+			case <-p.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+func TestStageCollect(t *testing.T) {
+	noLeaks(t)
+
+	p := group.NewPipeline(context.Background())
+	squares, errc1 := group.Stage(group.Source(p, 1, 2, 3, 4), 3, func(i int) (int, error) {
+		return i * i, nil
+	}, group.InPipeline(p))
+	texts, errc2 := group.Stage(squares, 2, func(i int) (string, error) {
+		return strconv.Itoa(i), nil
+	}, group.InPipeline(p))
+
+	values, err := group.Collect(texts, errc1, errc2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(values)
+	if !slices.Equal(values, []string{"1", "16", "4", "9"}) {
+		t.Errorf("values = %v", values)
+	}
+	if p.Err() != nil {
+		t.Errorf("Err = %v for a pipeline still running", p.Err())
+	}
+}
+
+func TestStageErrorShutsPipelineDown(t *testing.T) {
+	noLeaks(t)
+
+	errBoom := errors.New("boom")
+	p := group.NewPipeline(context.Background())
+	doubled, errc1 := group.Stage(naturals(p), 4, func(i int) (int, error) {
+		return 2 * i, nil
+	}, group.InPipeline(p))
+	checked, errc2 := group.Stage(doubled, 4, func(i int) (int, error) {
+		if i == 20 {
+			return 0, errBoom
+		}
+		return i, nil
+	}, group.InPipeline(p))
+
+	_, err := group.Collect(checked, errc1, errc2)
+	if !errors.Is(err, errBoom) {
+		t.Errorf("Collect = %v, want %v", err, errBoom)
+	}
+	if !errors.Is(p.Err(), errBoom) {
+		t.Errorf("Err = %v, want %v", p.Err(), errBoom)
+	}
+}
+
+func TestPipelineCancelled(t *testing.T) {
+	noLeaks(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := group.NewPipeline(ctx)
+	out, errc := group.Stage(naturals(p), 2, func(i int) (int, error) {
+		return i, nil
+	}, group.InPipeline(p))
+
+	<-out
+	cancel()
+	_, err := group.Collect(out, errc)
+	if err != nil {
+		t.Errorf("Collect = %v, want no stage error", err)
+	}
+	if !errors.Is(p.Err(), context.Canceled) {
+		t.Errorf("Err = %v, want %v", p.Err(), context.Canceled)
+	}
+}
+
+func TestStageDrainsWithoutPipeline(t *testing.T) {
+	noLeaks(t)
+
+	errBoom := errors.New("boom")
+	in := make(chan int)
+	go func() {
+		defer close(in)
+		for i := range 100 {
+			in <- i // blocks forever unless the failed stage keeps draining
+		}
+	}()
+	out, errc := group.Stage(in, 2, func(i int) (int, error) {
+		if i == 10 {
+			return 0, errBoom
+		}
+		return i, nil
+	})
+
+	values, err := group.Collect(out, errc)
+	if !errors.Is(err, errBoom) {
+		t.Errorf("Collect = %v, want %v", err, errBoom)
+	}
+	if len(values) > 99 {
+		t.Errorf("%d values, fn kept being called after the error", len(values))
+	}
+}
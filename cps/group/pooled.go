@@ -0,0 +1,71 @@
+package group
+
+import (
+	"sync"
+)
+
+// NewPooledSpawner creates a group running its tasks on workers long-lived goroutines
+// instead of one goroutine per task, which pays off for many small tasks.
+// Tasks wait in a queue of queueSize: Run blocks while it's full.
+//
+// Wait runs the queued tasks, then stops the workers; they are started again by the next Run.
+// A task spawning into its own pool may block forever once the queue is full and all workers are busy.
+// Queued tasks are lost when the process stops: wrap the pool with Checkpointed to keep them.
+func NewPooledSpawner(workers int, queueSize int) SafeWaitGroup {
+	if workers < 1 {
+		workers = 1
+	}
+	if queueSize < 0 {
+		queueSize = 0
+	}
+	return &pooledWaitGroup{workers: workers, queueSize: queueSize}
+}
+
+type pooledWaitGroup struct {
+	workers   int
+	queueSize int
+
+	pending sync.WaitGroup // queued and running tasks
+	running sync.WaitGroup // worker goroutines
+
+	mu    sync.Mutex
+	tasks chan func()
+}
+
+func (p *pooledWaitGroup) Run(task func()) {
+	p.pending.Add(1)
+	p.queue() <- task
+}
+
+// queue returns the task channel, starting the workers if they aren't running.
+func (p *pooledWaitGroup) queue() chan func() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.tasks == nil {
+		p.tasks = make(chan func(), p.queueSize)
+		p.running.Add(p.workers)
+		for i := 0; i < p.workers; i++ {
+			go p.work(p.tasks)
+		}
+	}
+	return p.tasks
+}
+
+func (p *pooledWaitGroup) work(tasks <-chan func()) {
+	defer p.running.Add(-1)
+	for task := range tasks {
+		task()
+		p.pending.Add(-1)
+	}
+}
+
+func (p *pooledWaitGroup) Wait() {
+	p.pending.Wait()
+	p.mu.Lock()
+	if p.tasks != nil {
+		close(p.tasks)
+		p.tasks = nil
+	}
+	p.mu.Unlock()
+	p.running.Wait()
+}
@@ -0,0 +1,107 @@
+package group_test
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/group"
+)
+
+const trivialTasks = 1_000_000
+
+func runTrivial(s group.SafeWaitGroup) {
+	var n atomic.Int64
+	for range trivialTasks {
+		s.Run(func() { n.Add(1) })
+	}
+	s.Wait()
+}
+
+func BenchmarkGoroutinePerTask(b *testing.B) {
+	b.ReportAllocs()
+	for range b.N {
+		runTrivial(group.NewSafeWaitGroup())
+	}
+}
+
+func BenchmarkPooledSpawner(b *testing.B) {
+	b.ReportAllocs()
+	for range b.N {
+		runTrivial(group.NewPooledSpawner(8, 1024))
+	}
+}
+
+func TestPooledSpawnerRunsQueuedTasksAtWait(t *testing.T) {
+	noLeaks(t)
+	pool := group.NewPooledSpawner(2, 100)
+	release := make(chan struct{})
+	var done atomic.Int64
+	for range 50 {
+		pool.Run(func() {
+			<-release
+			done.Add(1)
+		})
+	}
+	// the workers are busy, most tasks are still queued when Wait is called
+	close(release)
+	pool.Wait()
+	if n := done.Load(); n != 50 {
+		t.Errorf("%d tasks done after Wait, want 50", n)
+	}
+
+	// started again by the next Run
+	for range 10 {
+		pool.Run(func() { done.Add(1) })
+	}
+	pool.Wait()
+	if n := done.Load(); n != 60 {
+		t.Errorf("%d tasks done after reusing the pool, want 60", n)
+	}
+}
+
+func TestPooledSpawnerWorkers(t *testing.T) {
+	noLeaks(t)
+	pool := group.NewPooledSpawner(3, 100)
+	var active, most atomic.Int64
+	for range 30 {
+		pool.Run(func() {
+			n := active.Add(1)
+			for m := most.Load(); n > m && !most.CompareAndSwap(m, n); m = most.Load() {
+			}
+			time.Sleep(time.Millisecond)
+			active.Add(-1)
+		})
+	}
+	pool.Wait()
+	if most.Load() > 3 {
+		t.Errorf("%d tasks at a time, want at most the 3 workers", most.Load())
+	}
+}
+
+func TestPooledSpawnerRunBlocksWhenFull(t *testing.T) {
+	noLeaks(t)
+	pool := group.NewPooledSpawner(1, 1)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	pool.Run(func() {
+		close(started)
+		<-release
+	})
+	<-started
+	pool.Run(func() {}) // queued
+
+	queued := make(chan struct{})
+	go func() {
+		pool.Run(func() {})
+		close(queued)
+	}()
+	select {
+	case <-queued:
+		t.Error("Run returned with the queue full")
+	case <-time.After(10 * time.Millisecond):
+	}
+	close(release)
+	<-queued
+	pool.Wait()
+}
@@ -0,0 +1,130 @@
+package group
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// DefaultPriority is the priority of the tasks started with Run.
+const DefaultPriority = 0
+
+// PrioritySpawner is a bounded group which starts its queued tasks by priority.
+type PrioritySpawner interface {
+	SafeWaitGroup
+	// RunP queues task; higher priorities run first, equal ones in the order they were queued.
+	RunP(priority int, task func())
+}
+
+// PriorityOption configures NewPrioritySpawner.
+type PriorityOption func(p *prioritySpawner)
+
+// WithAging raises the priority of a waiting task by perSecond for every second it waits,
+// so a steady flow of urgent tasks can't starve the others forever.
+func WithAging(perSecond float64) PriorityOption {
+	return func(p *prioritySpawner) {
+		p.aging = perSecond
+	}
+}
+
+// PriorityClock makes WithAging tell how long the tasks waited with clock.
+func PriorityClock(clock Clock) PriorityOption {
+	return func(p *prioritySpawner) {
+		p.clock = clock
+	}
+}
+
+// NewPrioritySpawner creates a group running at most workers tasks at a time.
+// Unlike NewBoundedSpawner, Run doesn't block: the tasks wait in a queue.
+func NewPrioritySpawner(workers int, opts ...PriorityOption) PrioritySpawner {
+	if workers < 1 {
+		workers = 1
+	}
+	p := &prioritySpawner{swg: NewSafeWaitGroup(), workers: workers}
+	for _, opt := range opts {
+		opt(p)
+	}
+	p.clock = clockOr(p.clock)
+	p.start = p.clock.Now()
+	return p
+}
+
+type prioritySpawner struct {
+	swg     SafeWaitGroup
+	workers int
+	aging   float64
+	clock   Clock
+	start   time.Time
+
+	mu     sync.Mutex
+	queue  priorityQueue
+	active int
+	seq    uint64
+}
+
+func (p *prioritySpawner) Run(task func()) {
+	p.RunP(DefaultPriority, task)
+}
+
+func (p *prioritySpawner) RunP(priority int, task func()) {
+	// Every waiting task ages at the same rate, so priority+aging*(now-queued)
+	// orders them like priority-aging*queued, which doesn't change while they wait.
+	rank := float64(priority) - p.aging*p.clock.Now().Sub(p.start).Seconds()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.seq++
+	heap.Push(&p.queue, queuedTask{rank: rank, seq: p.seq, task: task})
+	if p.active < p.workers {
+		p.active++
+		p.swg.Run(p.work)
+	}
+}
+
+// work runs queued tasks until the queue is empty.
+func (p *prioritySpawner) work() {
+	for {
+		p.mu.Lock()
+		if p.queue.Len() == 0 {
+			p.active--
+			p.mu.Unlock()
+			return
+		}
+		next := heap.Pop(&p.queue).(queuedTask)
+		p.mu.Unlock()
+		next.task()
+	}
+}
+
+func (p *prioritySpawner) Wait() {
+	p.swg.Wait()
+}
+
+type queuedTask struct {
+	rank float64
+	seq  uint64
+	task func()
+}
+
+type priorityQueue []queuedTask
+
+func (q priorityQueue) Len() int { return len(q) }
+
+func (q priorityQueue) Less(i, j int) bool {
+	if q[i].rank != q[j].rank {
+		return q[i].rank > q[j].rank
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q priorityQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *priorityQueue) Push(x any) { *q = append(*q, x.(queuedTask)) }
+
+func (q *priorityQueue) Pop() any {
+	old := *q
+	last := old[len(old)-1]
+	old[len(old)-1] = queuedTask{}
+	*q = old[:len(old)-1]
+	return last
+}
@@ -0,0 +1,95 @@
+package group_test
+
+import (
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/group"
+)
+
+func TestWithAgingOnClock(t *testing.T) {
+	clock := newFakeClock()
+	p := group.NewPrioritySpawner(1, group.WithAging(1), group.PriorityClock(clock))
+	gate := make(chan struct{})
+	p.Run(func() {
+		<-gate
+	})
+
+	var mu sync.Mutex
+	var order []string
+	record := func(name string) func() {
+		return func() {
+			mu.Lock()
+			defer mu.Unlock()
+			order = append(order, name)
+		}
+	}
+	p.RunP(0, record("old"))
+	clock.Advance(10 * time.Second)
+	// 5 over old, which gained 10 waiting
+	p.RunP(5, record("urgent"))
+	close(gate)
+	p.Wait()
+
+	if !slices.Equal(order, []string{"old", "urgent"}) {
+		t.Fatalf("ran %v, want the aged task first", order)
+	}
+}
+
+func TestPrioritySpawnerOrder(t *testing.T) {
+	p := group.NewPrioritySpawner(1)
+	gate := make(chan struct{})
+	p.Run(func() {
+		<-gate
+	})
+
+	var mu sync.Mutex
+	var order []string
+	record := func(name string) func() {
+		return func() {
+			mu.Lock()
+			defer mu.Unlock()
+			order = append(order, name)
+		}
+	}
+	p.RunP(1, record("low 1"))
+	p.RunP(10, record("high 1"))
+	p.Run(record("default"))
+	p.RunP(1, record("low 2"))
+	p.RunP(10, record("high 2"))
+	p.RunP(-5, record("backfill"))
+	close(gate)
+	p.Wait()
+
+	// Run queues at DefaultPriority, 0
+	want := []string{"high 1", "high 2", "low 1", "low 2", "default", "backfill"}
+	if !slices.Equal(order, want) {
+		t.Errorf("ran %q, want %q", order, want)
+	}
+}
+
+func TestPrioritySpawnerWaitDrains(t *testing.T) {
+	noLeaks(t)
+	p := group.NewPrioritySpawner(4)
+	var done, active, most atomic.Int64
+	for i := range 200 {
+		p.RunP(i%7, func() {
+			n := active.Add(1)
+			for m := most.Load(); n > m && !most.CompareAndSwap(m, n); m = most.Load() {
+			}
+			time.Sleep(100 * time.Microsecond)
+			active.Add(-1)
+			done.Add(1)
+		})
+	}
+	p.Wait()
+	if n := done.Load(); n != 200 {
+		t.Errorf("%d tasks done after Wait, want 200", n)
+	}
+	if most.Load() > 4 {
+		t.Errorf("%d tasks at a time, want at most the 4 workers", most.Load())
+	}
+}
@@ -0,0 +1,119 @@
+package group
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// QuiescentGroup is a group which can wait for its tasks to stop spawning more of them.
+type QuiescentGroup interface {
+	SafeWaitGroup
+	// Quiesce waits until no task of the group has been running or queued for the settle duration
+	// in a row, giving up with ctx.Err() when ctx is done first.
+	Quiesce(ctx context.Context) error
+}
+
+// QuiescentOption configures Quiescent.
+type QuiescentOption func(g *quiescentGroup)
+
+// QuiescentClock makes Quiesce time the settle duration with clock.
+func QuiescentClock(clock Clock) QuiescentOption {
+	return func(g *quiescentGroup) {
+		g.clock = clock
+	}
+}
+
+// Quiescent creates a child group of parent, like Scope does, whose Quiesce also waits for the tasks
+// run in a hurry by the goroutines of other tasks: Wait may return before such a task is run
+// when it races with it, Quiesce waits for settle more first.
+//
+// Quiesce is meant for tests and shutdowns, where tasks schedule follow-up tasks the caller can't wait for;
+// it is slow by design, don't call it on hot paths.
+func Quiescent(parent Spawner, settle time.Duration, opts ...QuiescentOption) QuiescentGroup {
+	idle := make(chan struct{})
+	close(idle)
+	g := &quiescentGroup{parent: parent, settle: settle, idle: idle}
+	for _, opt := range opts {
+		opt(g)
+	}
+	g.clock = clockOr(g.clock)
+	return g
+}
+
+type quiescentGroup struct {
+	parent Spawner
+	settle time.Duration
+	clock  Clock
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	running int           // tasks running or queued in parent
+	runs    uint64        // tasks run so far
+	idle    chan struct{} // closed while nothing is running
+}
+
+func (g *quiescentGroup) Run(task func()) {
+	g.mu.Lock()
+	if g.running == 0 {
+		g.idle = make(chan struct{})
+	}
+	g.running++
+	g.runs++
+	g.wg.Add(1)
+	g.mu.Unlock()
+
+	g.parent.Run(func() {
+		defer g.done()
+		task()
+	})
+}
+
+func (g *quiescentGroup) done() {
+	g.mu.Lock()
+	g.running--
+	if g.running == 0 {
+		close(g.idle)
+	}
+	g.mu.Unlock()
+	g.wg.Add(-1)
+}
+
+func (g *quiescentGroup) Wait() {
+	g.wg.Wait()
+}
+
+func (g *quiescentGroup) Quiesce(ctx context.Context) error {
+	timer := g.clock.NewTimer(g.settle)
+	defer timer.Stop()
+	for {
+		g.mu.Lock()
+		idle := g.idle
+		g.mu.Unlock()
+		select {
+		case <-idle:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		g.mu.Lock()
+		running, runs := g.running, g.runs
+		g.mu.Unlock()
+		if running != 0 {
+			continue
+		}
+
+		timer.Reset(g.settle)
+		select {
+		case <-timer.C():
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		g.mu.Lock()
+		settled := g.running == 0 && g.runs == runs
+		g.mu.Unlock()
+		if settled {
+			return nil
+		}
+	}
+}
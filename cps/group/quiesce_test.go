@@ -0,0 +1,112 @@
+package group_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/group"
+)
+
+func TestQuiesceWaitsForSettleOnClock(t *testing.T) {
+	clock := newFakeClock()
+	g := group.Quiescent(group.NewSafeWaitGroup(), time.Second, group.QuiescentClock(clock))
+	g.Run(func() {})
+
+	quiesced := make(chan error, 1)
+	go func() {
+		quiesced <- g.Quiesce(context.Background())
+	}()
+	for {
+		select {
+		case err := <-quiesced:
+			if err != nil {
+				t.Fatal(err)
+			}
+			if settled := clock.Now().Sub(epoch); settled < time.Second {
+				t.Fatalf("quiesced after %v, before the settle duration", settled)
+			}
+			g.Wait()
+			return
+		default:
+			clock.Advance(100 * time.Millisecond)
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
+
+func TestQuiesceWaitsForSpawnedChain(t *testing.T) {
+	g := group.Quiescent(group.NewSafeWaitGroup(), 100*time.Millisecond)
+	spawn := make(chan struct{})
+	var mu sync.Mutex
+	var ran []string
+	// task runs name, then spawns next from a goroutine of its own once spawn is closed
+	var task func(name string, next ...string) func()
+	task = func(name string, next ...string) func() {
+		return func() {
+			mu.Lock()
+			ran = append(ran, name)
+			mu.Unlock()
+			if len(next) == 0 {
+				return
+			}
+			go func() {
+				<-spawn
+				time.Sleep(time.Millisecond)
+				g.Run(task(next[0], next[1:]...))
+			}()
+		}
+	}
+	snapshot := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(ran)
+	}
+
+	g.Run(task("A", "B", "C"))
+	g.Wait()
+	if got := snapshot(); !slices.Equal(got, []string{"A"}) {
+		t.Fatalf("ran %q by Wait, want only A", got)
+	}
+
+	close(spawn)
+	err := g.Quiesce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := snapshot(); !slices.Equal(got, []string{"A", "B", "C"}) {
+		t.Errorf("ran %q by Quiesce, want A, B and C", got)
+	}
+}
+
+func TestQuiesceGivesUp(t *testing.T) {
+	g := group.Quiescent(group.NewSafeWaitGroup(), time.Millisecond)
+	release := make(chan struct{})
+	g.Run(func() { <-release })
+	defer g.Wait()
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := g.Quiesce(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Quiesce of a busy group = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestQuiesceIdleGroup(t *testing.T) {
+	clock := newFakeClock()
+	g := group.Quiescent(group.NewSafeWaitGroup(), time.Second, group.QuiescentClock(clock))
+	quiesced := make(chan error, 1)
+	go func() {
+		quiesced <- g.Quiesce(context.Background())
+	}()
+	clock.BlockUntilTimers(1)
+	clock.Advance(time.Second)
+	if err := <-quiesced; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,32 @@
+package group
+
+import (
+	"sync"
+)
+
+// Scope creates a child group of parent: its tasks run through parent, so parent's Wait
+// waits for them too, even if the child's own Wait is never called, and nothing spawned
+// in a scope outlives the parent. The child's Wait waits for the child's tasks only.
+//
+// Running through parent, the tasks get whatever parent does: a bounded parent bounds
+// them, a wrapped one applies its middlewares.
+func Scope(parent Spawner) SafeWaitGroup {
+	return &scope{parent: parent}
+}
+
+type scope struct {
+	parent Spawner
+	wg     sync.WaitGroup
+}
+
+func (s *scope) Run(task func()) {
+	s.wg.Add(1)
+	s.parent.Run(func() {
+		defer s.wg.Add(-1)
+		task()
+	})
+}
+
+func (s *scope) Wait() {
+	s.wg.Wait()
+}
@@ -0,0 +1,94 @@
+package group_test
+
+import (
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/group"
+)
+
+func TestScopeGrandchildAwaited(t *testing.T) {
+	var mu sync.Mutex
+	var events []string
+	record := func(event string) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+	}
+
+	parent := group.NewSafeWaitGroup()
+	child := group.Scope(parent)
+	child.Run(func() {
+		grandchild := group.Scope(child)
+		grandchild.Run(func() {
+			time.Sleep(10 * time.Millisecond)
+			record("grandchild")
+		})
+		record("child")
+	})
+	child.Wait()
+	record("child waited")
+	parent.Wait()
+	record("parent waited")
+
+	// the grandchild runs through the child, its Wait covers it
+	if want := []string{"child", "grandchild", "child waited", "parent waited"}; !slices.Equal(events, want) {
+		t.Errorf("events = %q, want %q", events, want)
+	}
+}
+
+func TestScopeNeverWaited(t *testing.T) {
+	var done atomic.Int64
+	group.RunGroup(func(s group.Spawner) {
+		scope := group.Scope(s)
+		for range 10 {
+			scope.Run(func() {
+				time.Sleep(time.Millisecond)
+				done.Add(1)
+			})
+		}
+		// no scope.Wait()
+	})
+	if n := done.Load(); n != 10 {
+		t.Errorf("%d tasks of the scope done after the parent's Wait, want 10", n)
+	}
+}
+
+func TestScopeWaitsForItsOwnTasks(t *testing.T) {
+	parent := group.NewSafeWaitGroup()
+	release := make(chan struct{})
+	parent.Run(func() { <-release })
+
+	scope := group.Scope(parent)
+	var done atomic.Bool
+	scope.Run(func() { done.Store(true) })
+	scope.Wait() // doesn't wait for the task of the parent
+	if !done.Load() {
+		t.Error("Wait returned before the task of the scope finished")
+	}
+	close(release)
+	parent.Wait()
+}
+
+func TestScopeBoundedByParent(t *testing.T) {
+	var active, most atomic.Int64
+	parent := group.NewBoundedSpawner(2)
+	scope := group.Scope(parent)
+	for range 20 {
+		scope.Run(func() {
+			n := active.Add(1)
+			for m := most.Load(); n > m && !most.CompareAndSwap(m, n); m = most.Load() {
+			}
+			time.Sleep(time.Millisecond)
+			active.Add(-1)
+		})
+	}
+	scope.Wait()
+	parent.Wait()
+	if most.Load() > 2 {
+		t.Errorf("%d tasks of the scope at a time, want the bound of the parent, 2", most.Load())
+	}
+}
@@ -0,0 +1,210 @@
+package group
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/internal/goid"
+)
+
+var debugMode atomic.Bool
+
+// SetDebug turns debug mode on or off. In debug mode the tasks of a TrackedGroup remember
+// their goroutine, so a WaitCtx timeout reports their stacks, which costs a stack walk per task.
+func SetDebug(on bool) {
+	debugMode.Store(on)
+}
+
+// TrackedGroup is a group keeping track of its running tasks by name,
+// so a WaitCtx which gives up can tell which ones are stuck.
+type TrackedGroup interface {
+	SafeWaitGroup
+	// RunNamed runs task under name; Run names its tasks "task 1", "task 2"...
+	RunNamed(name string, task func())
+	// WaitCtx is Wait which gives up when ctx is done, returning a *StuckError.
+	WaitCtx(ctx context.Context) error
+}
+
+// TaskInfo describes a task which was still running.
+type TaskInfo struct {
+	Name    string
+	Running time.Duration
+	// Stack is the stack of the task's goroutine, captured in debug mode only.
+	Stack string
+}
+
+// StuckError is returned by WaitCtx when ctx is done before the tasks; it wraps ctx.Err().
+// Formatted with %+v it prints a report of the stuck tasks.
+type StuckError struct {
+	Err   error
+	tasks []TaskInfo
+}
+
+// StuckTasks returns the tasks which were running when WaitCtx gave up, longest running first.
+func (e *StuckError) StuckTasks() []TaskInfo {
+	return e.tasks
+}
+
+func (e *StuckError) Error() string {
+	names := make([]string, len(e.tasks))
+	for i, task := range e.tasks {
+		names[i] = task.Name
+	}
+	return fmt.Sprintf("%d tasks still running (%s): %v", len(e.tasks), strings.Join(names, ", "), e.Err)
+}
+
+func (e *StuckError) Unwrap() error {
+	return e.Err
+}
+
+func (e *StuckError) Format(f fmt.State, verb rune) {
+	if verb != 'v' || !f.Flag('+') {
+		_, _ = io.WriteString(f, e.Error())
+		return
+	}
+	_, _ = fmt.Fprintf(f, "%v, %d tasks still running:", e.Err, len(e.tasks))
+	for _, task := range e.tasks {
+		_, _ = fmt.Fprintf(f, "\n- %s, running for %v", task.Name, task.Running.Round(time.Millisecond))
+		if task.Stack != "" {
+			_, _ = fmt.Fprintf(f, "\n\t%s", strings.ReplaceAll(strings.TrimSpace(task.Stack), "\n", "\n\t"))
+		}
+	}
+}
+
+// TrackedOption configures NewTrackedGroup.
+type TrackedOption func(g *trackedGroup)
+
+// TrackedClock makes the group tell how long its tasks have been running with clock.
+func TrackedClock(clock Clock) TrackedOption {
+	return func(g *trackedGroup) {
+		g.clock = clock
+	}
+}
+
+// NewTrackedGroup creates a tracked child group of parent, like Scope does.
+func NewTrackedGroup(parent Spawner, opts ...TrackedOption) TrackedGroup {
+	g := &trackedGroup{parent: parent, running: make(map[*runningTask]struct{})}
+	for _, opt := range opts {
+		opt(g)
+	}
+	g.clock = clockOr(g.clock)
+	return g
+}
+
+type runningTask struct {
+	name      string
+	started   time.Time
+	goroutine string
+}
+
+type trackedGroup struct {
+	parent Spawner
+	clock  Clock
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	running map[*runningTask]struct{}
+	spawned int
+}
+
+func (g *trackedGroup) Run(task func()) {
+	g.mu.Lock()
+	g.spawned++
+	name := "task " + strconv.Itoa(g.spawned)
+	g.mu.Unlock()
+	g.RunNamed(name, task)
+}
+
+func (g *trackedGroup) RunNamed(name string, task func()) {
+	g.wg.Add(1)
+	g.parent.Run(func() {
+		defer g.wg.Add(-1)
+		running := &runningTask{name: name, started: g.clock.Now()}
+		if debugMode.Load() {
+			running.goroutine = goid.Current()
+		}
+		g.mu.Lock()
+		g.running[running] = struct{}{}
+		g.mu.Unlock()
+		defer func() {
+			g.mu.Lock()
+			delete(g.running, running)
+			g.mu.Unlock()
+		}()
+		task()
+	})
+}
+
+func (g *trackedGroup) Wait() {
+	g.wg.Wait()
+}
+
+// WaitCtx leaves a goroutine waiting for the tasks behind when it gives up.
+func (g *trackedGroup) WaitCtx(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return &StuckError{Err: ctx.Err(), tasks: g.stuckTasks()}
+	}
+}
+
+func (g *trackedGroup) stuckTasks() []TaskInfo {
+	now := g.clock.Now()
+	var tasks []TaskInfo
+	var goroutines []string
+	g.mu.Lock()
+	for running := range g.running {
+		tasks = append(tasks, TaskInfo{Name: running.name, Running: now.Sub(running.started)})
+		goroutines = append(goroutines, running.goroutine)
+	}
+	g.mu.Unlock()
+
+	var stacks map[string]string
+	for i, id := range goroutines {
+		if id == "" {
+			continue
+		}
+		if stacks == nil {
+			stacks = allStacks()
+		}
+		tasks[i].Stack = stacks[id]
+	}
+	sort.SliceStable(tasks, func(i, j int) bool {
+		return tasks[i].Running > tasks[j].Running
+	})
+	return tasks
+}
+
+// allStacks returns the stacks of all goroutines by id.
+func allStacks() map[string]string {
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+	stacks := make(map[string]string)
+	for _, stack := range strings.Split(string(buf), "\n\n") {
+		header, _, _ := strings.Cut(stack, "\n")
+		id, _, _ := strings.Cut(strings.TrimPrefix(header, "goroutine "), " ")
+		stacks[id] = stack
+	}
+	return stacks
+}
@@ -0,0 +1,108 @@
+package group_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/group"
+)
+
+func TestTrackedGroupRunningOnClock(t *testing.T) {
+	clock := newFakeClock()
+	g := group.NewTrackedGroup(group.NewSafeWaitGroup(), group.TrackedClock(clock))
+	started := make(chan struct{})
+	release := make(chan struct{})
+	g.RunNamed("slow", func() {
+		close(started)
+		<-release
+	})
+	<-started
+	clock.Advance(3 * time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := g.WaitCtx(ctx)
+	var stuck *group.StuckError
+	if !errors.As(err, &stuck) || !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want a *StuckError", err)
+	}
+	tasks := stuck.StuckTasks()
+	if len(tasks) != 1 || tasks[0].Name != "slow" || tasks[0].Running != 3*time.Second {
+		t.Fatalf("got %+v, want slow running for 3s", tasks)
+	}
+	close(release)
+	g.Wait()
+}
+
+// blockedInQuery is the function a task of TestStuckReport is blocked in, to be found in its stack.
+func blockedInQuery(release <-chan struct{}) {
+	<-release
+}
+
+func TestStuckReport(t *testing.T) {
+	group.SetDebug(true)
+	t.Cleanup(func() {
+		group.SetDebug(false)
+	})
+	clock := newFakeClock()
+	g := group.NewTrackedGroup(group.NewSafeWaitGroup(), group.TrackedClock(clock))
+	release := make(chan struct{})
+	started := make(chan struct{})
+	g.RunNamed("user query", func() {
+		close(started)
+		blockedInQuery(release)
+	})
+	<-started
+	clock.Advance(time.Second)
+	g.Run(func() { <-release })
+	g.Run(func() {}) // done before WaitCtx
+	eventually(t, func() bool { return strings.Contains(fmt.Sprint(waitNow(g)), "2 tasks") })
+	clock.Advance(time.Second)
+
+	err := waitNow(g)
+	if got := err.Error(); !strings.Contains(got, "2 tasks still running (user query, task 1)") {
+		t.Errorf("Error() = %q, want the names of the stuck tasks, longest running first", got)
+	}
+	report := fmt.Sprintf("%+v", err)
+	for _, want := range []string{"context deadline exceeded, 2 tasks still running:", "- user query, running for 2s", "- task 1, running for 1s", "blockedInQuery"} {
+		if !strings.Contains(report, want) {
+			t.Errorf("report %q doesn't contain %q", report, want)
+		}
+	}
+	var stuck *group.StuckError
+	if !errors.As(err, &stuck) || !strings.Contains(stuck.StuckTasks()[0].Stack, "blockedInQuery") {
+		t.Errorf("stack of the stuck task not captured in debug mode")
+	}
+	close(release)
+	if err := g.WaitCtx(context.Background()); err != nil {
+		t.Errorf("WaitCtx after the tasks finished = %v", err)
+	}
+}
+
+func TestStuckTasksWithoutDebug(t *testing.T) {
+	g := group.NewTrackedGroup(group.NewSafeWaitGroup())
+	release := make(chan struct{})
+	started := make(chan struct{})
+	g.RunNamed("blocked", func() {
+		close(started)
+		<-release
+	})
+	<-started
+	var stuck *group.StuckError
+	if err := waitNow(g); !errors.As(err, &stuck) || len(stuck.StuckTasks()) != 1 || stuck.StuckTasks()[0].Stack != "" {
+		t.Errorf("WaitCtx = %v, want the task without a stack outside debug mode", err)
+	}
+	close(release)
+	g.Wait()
+}
+
+// waitNow is WaitCtx with an expired deadline.
+func waitNow(g group.TrackedGroup) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	return g.WaitCtx(ctx)
+}
@@ -0,0 +1,51 @@
+// Package group runs goroutines without sync.WaitGroup bookkeeping in the calling code.
+package group
+
+import (
+	"sync"
+)
+
+// Spawner runs tasks concurrently.
+type Spawner interface {
+	Run(task func())
+}
+
+// SafeWaitGroup is a sync.WaitGroup which counts a task in and out by itself:
+// there is no Add or Done to forget or to get wrong.
+type SafeWaitGroup interface {
+	Spawner
+	Wait()
+}
+
+type safeWaitGroupImpl struct {
+	wg *sync.WaitGroup
+}
+
+// NewSafeWaitGroup creates an empty group.
+func NewSafeWaitGroup() SafeWaitGroup {
+	return &safeWaitGroupImpl{new(sync.WaitGroup)}
+}
+
+func (swg *safeWaitGroupImpl) Run(task func()) {
+	swg.wg.Add(1)
+	go func() {
+		task()
+		swg.wg.Add(-1)
+	}()
+}
+
+func (swg *safeWaitGroupImpl) Wait() {
+	swg.wg.Wait()
+}
+
+// RunGroup lets taskRunner spawn tasks and returns when all of them are done.
+// The tasks are wrapped by the middlewares like WrapSpawner does.
+func RunGroup(taskRunner func(Spawner), mw ...Middleware) {
+	swg := NewSafeWaitGroup()
+	if len(mw) > 0 {
+		taskRunner(WrapSpawner(swg, mw...))
+	} else {
+		taskRunner(swg)
+	}
+	swg.Wait()
+}
@@ -0,0 +1,74 @@
+package group_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/group"
+)
+
+const noopTasks = 100_000
+
+func noop() {}
+
+func runRaw() {
+	var wg sync.WaitGroup
+	for range noopTasks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			noop()
+		}()
+	}
+	wg.Wait()
+}
+
+func runSafe() {
+	swg := group.NewSafeWaitGroup()
+	for range noopTasks {
+		swg.Run(noop)
+	}
+	swg.Wait()
+}
+
+func BenchmarkWaitGroup(b *testing.B) {
+	b.ReportAllocs()
+	for range b.N {
+		runRaw()
+	}
+}
+
+func BenchmarkSafeWaitGroup(b *testing.B) {
+	b.ReportAllocs()
+	for range b.N {
+		runSafe()
+	}
+}
+
+// TestSafeWaitGroupAllocations checks that the bookkeeping of SafeWaitGroup costs no more
+// than the closure of a go statement does with sync.WaitGroup: the group itself is the one allocation more.
+func TestSafeWaitGroupAllocations(t *testing.T) {
+	const tasks = 1000
+	raw := testing.AllocsPerRun(10, func() {
+		var wg sync.WaitGroup
+		for range tasks {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				noop()
+			}()
+		}
+		wg.Wait()
+	})
+	safe := testing.AllocsPerRun(10, func() {
+		swg := group.NewSafeWaitGroup()
+		for range tasks {
+			swg.Run(noop)
+		}
+		swg.Wait()
+	})
+	t.Logf("%v allocations for %d tasks, %v with sync.WaitGroup", safe, tasks, raw)
+	if safe > raw+1 {
+		t.Fatalf("%v allocations for %d tasks, %v with sync.WaitGroup", safe, tasks, raw)
+	}
+}
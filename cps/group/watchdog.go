@@ -0,0 +1,143 @@
+package group
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrStalled matches every *StalledError with errors.Is.
+var ErrStalled = errors.New("no progress")
+
+// StalledError fails the group of WithWatchdog when its ProgressMeter wasn't ticked for the idle duration.
+type StalledError struct {
+	// LastTick is the time of the last tick, or of the start of the watchdog without ticks.
+	LastTick time.Time
+	// InFlight are the names of the tasks tracked by the meter, sorted.
+	InFlight []string
+}
+
+func (e *StalledError) Error() string {
+	msg := fmt.Sprintf("%v since %s", ErrStalled, e.LastTick.Format(time.RFC3339Nano))
+	if len(e.InFlight) > 0 {
+		msg += ", in flight: " + strings.Join(e.InFlight, ", ")
+	}
+	return msg
+}
+
+func (e *StalledError) Is(target error) bool {
+	return target == ErrStalled
+}
+
+// ProgressMeter is ticked by tasks as they complete units of work, see WithWatchdog.
+type ProgressMeter struct {
+	clock Clock
+
+	mu       sync.Mutex
+	last     time.Time
+	inFlight map[uint64]string
+	nextID   uint64
+}
+
+// NewProgressMeter creates a meter telling the time with clock, the real clock when nil.
+func NewProgressMeter(clock Clock) *ProgressMeter {
+	return &ProgressMeter{clock: clockOr(clock), inFlight: make(map[uint64]string)}
+}
+
+// Tick records a unit of work completed now.
+func (m *ProgressMeter) Tick() {
+	now := m.clock.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.last = now
+}
+
+// Track names a task in flight in the *StalledError, until done is called.
+func (m *ProgressMeter) Track(name string) (done func()) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id := m.nextID
+	m.nextID++
+	m.inFlight[id] = name
+	return func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		delete(m.inFlight, id)
+	}
+}
+
+// stalled returns the error when the last tick, or since when none, is idle ago.
+func (m *ProgressMeter) stalled(since time.Time, idle time.Duration) *StalledError {
+	now := m.clock.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	last := m.last
+	if last.Before(since) {
+		last = since
+	}
+	if now.Sub(last) < idle {
+		return nil
+	}
+	err := &StalledError{LastTick: last}
+	for _, name := range m.inFlight {
+		err.InFlight = append(err.InFlight, name)
+	}
+	sort.Strings(err.InFlight)
+	return err
+}
+
+// WithWatchdog returns g running a watchdog task besides the others: when progress isn't ticked
+// for the idle duration, it fails the group with a *StalledError, cancelling its context, and Wait
+// returns an error matching ErrStalled. The tasks must stop on the cancellation for Wait to return.
+//
+// The watchdog checks progress every quarter of idle, telling the time and ticking with the clock of the meter.
+// It stops once the other tasks are over, when Wait is called: use the returned group only,
+// not g, whose Wait would wait for the watchdog forever.
+func WithWatchdog(g CancelGroup, idle time.Duration, progress *ProgressMeter) CancelGroup {
+	w := &watchdogGroup{CancelGroup: g, stop: make(chan struct{})}
+	since := progress.clock.Now()
+	interval := max(idle/4, time.Millisecond)
+	g.Run(func() error {
+		ticker := progress.clock.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-w.stop:
+				return nil
+			case <-g.Context().Done():
+				return nil
+			case <-ticker.C():
+				if err := progress.stalled(since, idle); err != nil {
+					return err
+				}
+			}
+		}
+	})
+	return w
+}
+
+type watchdogGroup struct {
+	CancelGroup
+	tasks    sync.WaitGroup
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func (w *watchdogGroup) Run(task func() error) {
+	w.tasks.Add(1)
+	w.CancelGroup.Run(func() error {
+		defer w.tasks.Done()
+		return task()
+	})
+}
+
+func (w *watchdogGroup) Wait() error {
+	w.tasks.Wait()
+	w.stopOnce.Do(func() {
+		close(w.stop)
+	})
+	return w.CancelGroup.Wait()
+}
@@ -0,0 +1,127 @@
+package group_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/group"
+)
+
+func TestWatchdogFailsStalledGroup(t *testing.T) {
+	clock := newFakeClock()
+	meter := group.NewProgressMeter(clock)
+	g := group.WithWatchdog(group.NewCancelGroup(context.Background()), time.Second, meter)
+	tracked := make(chan struct{})
+	g.Run(func() error {
+		defer meter.Track("copy")()
+		close(tracked)
+		<-g.Context().Done()
+		return nil
+	})
+
+	<-tracked
+	clock.BlockUntilTimers(1)
+	clock.Advance(time.Second)
+	err := g.Wait()
+	var stalled *group.StalledError
+	if !errors.As(err, &stalled) || !errors.Is(err, group.ErrStalled) {
+		t.Fatalf("got %v, want a *StalledError", err)
+	}
+	if !stalled.LastTick.Equal(epoch) || !slices.Equal(stalled.InFlight, []string{"copy"}) {
+		t.Fatalf("got %+v, want no tick since the start and copy in flight", stalled)
+	}
+}
+
+func TestWatchdogKeepsTickedGroup(t *testing.T) {
+	clock := newFakeClock()
+	meter := group.NewProgressMeter(clock)
+	g := group.WithWatchdog(group.NewCancelGroup(context.Background()), time.Second, meter)
+	done := make(chan struct{})
+	g.Run(func() error {
+		<-done
+		return nil
+	})
+
+	clock.BlockUntilTimers(1)
+	for range 8 {
+		clock.Advance(750 * time.Millisecond)
+		meter.Tick()
+	}
+	if err := g.Context().Err(); err != nil {
+		t.Fatalf("the group was cancelled: %v", context.Cause(g.Context()))
+	}
+	close(done)
+	if err := g.Wait(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatchdogStopsWithTheGroup(t *testing.T) {
+	clock := newFakeClock()
+	meter := group.NewProgressMeter(clock)
+	g := group.WithWatchdog(group.NewCancelGroup(context.Background()), time.Second, meter)
+	errTask := errors.New("task failed")
+	g.Run(func() error {
+		meter.Tick()
+		return nil
+	})
+	g.Run(func() error {
+		return errTask
+	})
+
+	waited := make(chan error)
+	go func() {
+		waited <- g.Wait()
+	}()
+	select {
+	case err := <-waited:
+		if !errors.Is(err, errTask) || errors.Is(err, group.ErrStalled) {
+			t.Errorf("Wait = %v, want the error of the task", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Wait didn't stop the watchdog")
+	}
+}
+
+func TestStalledErrorNamesTasksInFlight(t *testing.T) {
+	clock := newFakeClock()
+	meter := group.NewProgressMeter(clock)
+	g := group.WithWatchdog(group.NewCancelGroup(context.Background()), time.Second, meter)
+	tracked := make(chan struct{}, 3)
+	for _, name := range []string{"upload", "copy", "finished"} {
+		g.Run(func() error {
+			done := meter.Track(name)
+			if name == "finished" {
+				done()
+			} else {
+				defer done()
+			}
+			tracked <- struct{}{}
+			<-g.Context().Done()
+			return nil
+		})
+	}
+	for range 3 {
+		<-tracked
+	}
+
+	clock.BlockUntilTimers(1)
+	clock.Advance(500 * time.Millisecond)
+	meter.Tick()
+	lastTick := clock.Now()
+	for range 6 {
+		clock.Advance(250 * time.Millisecond)
+	}
+	err := g.Wait()
+	var stalled *group.StalledError
+	if !errors.As(err, &stalled) {
+		t.Fatalf("Wait = %v, want a *StalledError", err)
+	}
+	want := "no progress since " + lastTick.Format(time.RFC3339Nano) + ", in flight: copy, upload"
+	if got := stalled.Error(); got != want {
+		t.Errorf("Error = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,126 @@
+// Package clock is the Clock of packages group and resource, which alias its types,
+// with the helpers both of them need.
+package clock
+
+import (
+	"context"
+	"time"
+)
+
+// Clock tells the time and waits, see group.Clock.
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+	NewTicker(d time.Duration) Ticker
+	// AfterFunc calls f in a goroutine of its own after d; the channel of the returned Timer is nil.
+	AfterFunc(d time.Duration, f func()) Timer
+	// Sleep waits for d and returns ctx.Err() as soon as ctx is done.
+	Sleep(ctx context.Context, d time.Duration) error
+}
+
+// Timer is what Clock.NewTimer returns, a *time.Timer for the real clock.
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// Ticker is what Clock.NewTicker returns, a *time.Ticker for the real clock.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// Real is the clock of the time package.
+func Real() Clock {
+	return realClock{}
+}
+
+// Or returns c, the real clock when nil.
+func Or(c Clock) Clock {
+	if c == nil {
+		return realClock{}
+	}
+	return c
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return realTimer{time.AfterFunc(d, f)}
+}
+
+func (realClock) Sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type realTimer struct {
+	*time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
+
+type realTicker struct {
+	*time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
+
+// WithTimeout is context.WithTimeout timed by c: the context is done d after now on c,
+// with context.DeadlineExceeded, sooner if ctx is.
+func WithTimeout(ctx context.Context, c Clock, d time.Duration) (context.Context, context.CancelFunc) {
+	deadline := c.Now().Add(d)
+	cancelCtx, cancel := context.WithCancelCause(ctx)
+	timer := c.AfterFunc(d, func() {
+		cancel(context.DeadlineExceeded)
+	})
+	return &deadlineContext{Context: cancelCtx, deadline: deadline}, func() {
+		timer.Stop()
+		cancel(context.Canceled)
+	}
+}
+
+// deadlineContext is a context cancelled with the cause context.DeadlineExceeded at its deadline,
+// whose Err tells it like the contexts of context.WithDeadline do.
+type deadlineContext struct {
+	context.Context
+	deadline time.Time
+}
+
+func (c *deadlineContext) Deadline() (time.Time, bool) {
+	if parent, ok := c.Context.Deadline(); ok && parent.Before(c.deadline) {
+		return parent, true
+	}
+	return c.deadline, true
+}
+
+func (c *deadlineContext) Err() error {
+	err := c.Context.Err()
+	if err != nil && context.Cause(c.Context) == context.DeadlineExceeded {
+		return context.DeadlineExceeded
+	}
+	return err
+}
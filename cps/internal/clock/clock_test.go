@@ -0,0 +1,105 @@
+package clock_test
+
+import (
+	"context"
+	"errors"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/internal/clock"
+	"github.com/Q69K/using-cps-in-golang/cps/resource/resourcetest"
+)
+
+// clockFuncs are the functions of package time a Clock stands for.
+var clockFuncs = map[string]bool{
+	"Now": true, "Since": true, "Until": true, "After": true, "AfterFunc": true,
+	"NewTimer": true, "NewTicker": true, "Tick": true, "Sleep": true,
+}
+
+// TestPackagesUseClock fails for every call of package group or resource, tests aside,
+// reading the time or waiting without its Clock.
+func TestPackagesUseClock(t *testing.T) {
+	for _, dir := range []string{"../../group", "../../resource"} {
+		files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		fset := token.NewFileSet()
+		for _, path := range files {
+			if strings.HasSuffix(path, "_test.go") {
+				continue
+			}
+			file, err := parser.ParseFile(fset, path, nil, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			timeName := ""
+			for _, spec := range file.Imports {
+				if importPath, _ := strconv.Unquote(spec.Path.Value); importPath == "time" {
+					timeName = "time"
+					if spec.Name != nil {
+						timeName = spec.Name.Name
+					}
+				}
+			}
+			if timeName == "" {
+				continue
+			}
+			ast.Inspect(file, func(n ast.Node) bool {
+				sel, ok := n.(*ast.SelectorExpr)
+				if !ok {
+					return true
+				}
+				if x, ok := sel.X.(*ast.Ident); ok && x.Name == timeName && clockFuncs[sel.Sel.Name] {
+					t.Errorf("%s: time.%s instead of a Clock", fset.Position(sel.Pos()), sel.Sel.Name)
+				}
+				return true
+			})
+		}
+	}
+}
+
+func TestWithTimeoutOnFakeClock(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	fake := resourcetest.NewFakeClock(start)
+	ctx, cancel := clock.WithTimeout(context.Background(), fake, time.Minute)
+	defer cancel()
+
+	if deadline, ok := ctx.Deadline(); !ok || !deadline.Equal(start.Add(time.Minute)) {
+		t.Fatalf("got deadline %v, %v, want %v", deadline, ok, start.Add(time.Minute))
+	}
+	fake.Advance(time.Minute - time.Nanosecond)
+	if ctx.Err() != nil {
+		t.Fatalf("done before its deadline: %v", ctx.Err())
+	}
+	fake.Advance(time.Nanosecond)
+	<-ctx.Done()
+	if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		t.Fatalf("got %v, want context.DeadlineExceeded", ctx.Err())
+	}
+}
+
+func TestWithTimeoutCancelled(t *testing.T) {
+	fake := resourcetest.NewFakeClock(time.Now())
+	parent, cancelParent := context.WithCancel(context.Background())
+	ctx, cancel := clock.WithTimeout(parent, fake, time.Minute)
+	defer cancel()
+
+	cancelParent()
+	<-ctx.Done()
+	if !errors.Is(ctx.Err(), context.Canceled) {
+		t.Fatalf("got %v, want context.Canceled", ctx.Err())
+	}
+
+	ctx, cancel = clock.WithTimeout(context.Background(), fake, time.Minute)
+	cancel()
+	if !errors.Is(ctx.Err(), context.Canceled) {
+		t.Fatalf("got %v, want context.Canceled", ctx.Err())
+	}
+}
@@ -0,0 +1,17 @@
+// Package goid tells the id of the current goroutine, for packages group and resource
+// to match the goroutines which hold things with their stacks.
+package goid
+
+import (
+	"bytes"
+	"runtime"
+)
+
+// Current parses the id of the current goroutine from the "goroutine 42 [running]:" stack header.
+func Current() string {
+	var buf [64]byte
+	header := buf[:runtime.Stack(buf[:], false)]
+	header = bytes.TrimPrefix(header, []byte("goroutine "))
+	id, _, _ := bytes.Cut(header, []byte(" "))
+	return string(id)
+}
@@ -0,0 +1,29 @@
+package goid_test
+
+import (
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/internal/goid"
+)
+
+func TestCurrent(t *testing.T) {
+	id := goid.Current()
+	if _, err := strconv.Atoi(id); err != nil {
+		t.Fatalf("Current = %q, not a number", id)
+	}
+	buf := make([]byte, 1<<10)
+	if stack := string(buf[:runtime.Stack(buf, false)]); !strings.HasPrefix(stack, "goroutine "+id+" ") {
+		t.Errorf("Current = %s, stack starts with %q", id, stack[:20])
+	}
+
+	other := make(chan string)
+	go func() {
+		other <- goid.Current()
+	}()
+	if otherID := <-other; otherID == id {
+		t.Errorf("two goroutines with the id %s", id)
+	}
+}
@@ -0,0 +1,128 @@
+package resource
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+// Acquire is the escape hatch out of the callback style, for code which wants a handle to close itself:
+// it returns the value of r and the func releasing it, which must be called once the value isn't used any more.
+// Prefer Use wherever possible, nothing releases a value whose release func was forgotten.
+//
+// The value is held by r.Use running in a goroutine of its own until release is called.
+// release returns the error of r.Use; calling it again is a no-op returning the same error.
+// Until then the value counts as open for VerifyNoneOpen.
+func Acquire[T any](r Resource[T]) (T, func() error, error) {
+	acquired := make(chan T)
+	done := make(chan struct{})
+	result := make(chan error, 1)
+	go func() {
+		result <- r.Use(func(value T) error {
+			acquired <- value
+			<-done
+			return nil
+		})
+	}()
+
+	select {
+	case value := <-acquired:
+		token := trackOpenAs("acquired", r.Describe(), 0)
+		var once sync.Once
+		var err error
+		release := func() error {
+			once.Do(func() {
+				close(done)
+				err = <-result
+				token.release()
+			})
+			return err
+		}
+		return value, release, nil
+	case err := <-result:
+		var zero T
+		if err == nil {
+			// a resource returning without calling its callback but without an error either
+			err = phaseError(PhaseAcquire, errors.New("callback not called"))
+		}
+		return zero, nil, err
+	}
+}
+
+// FromOpener is the resource of a value opened by open and released by its Close method,
+// the inverse of Acquire for the APIs returning an io.Closer.
+func FromOpener[T io.Closer](open func() (T, error)) Resource[T] {
+	return Resource[T]{
+		Use: func(callback func(value T) error) error {
+			value, err := open()
+			if err != nil {
+				return phaseError(PhaseAcquire, err)
+			}
+			err = useCallback(callback, value)
+			closeErr := value.Close()
+			if closeErr == nil {
+				return err
+			}
+			return errors.Join(err, phaseError(PhaseRelease, closeErr))
+		},
+	}
+}
+
+// Handoff is what a callback of UseHandoff hands over to the caller beyond the Use,
+// like a temporary file it produced; the zero Handoff hands nothing over.
+type Handoff struct {
+	// Description tells what is handed over, in VerifyNoneOpen errors.
+	Description string
+	// Release finalizes it, like removing the file; nil for nothing to do.
+	Release func() error
+}
+
+// RemoveHandoff hands over the file or empty directory at path, removed by the release.
+func RemoveHandoff(path string) Handoff {
+	return Handoff{
+		Description: "file " + path,
+		Release: func() error {
+			return removeError(os.Remove(path))
+		},
+	}
+}
+
+// UseHandoff runs cb with a value of r released by Use as usual, and returns the result of cb
+// with the func finalizing the Handoff of cb, which the caller calls once done with the result:
+// it's for callbacks producing an artifact which outlives the Use, like a file made out of a query.
+//
+// When cb or the release of r fails, the handoff is released right away, its error a secondary one
+// returned in StrictMode.
+// Until release is called the handoff counts as open for VerifyNoneOpen; calling it again is a no-op
+// returning the same error.
+func UseHandoff[T, R any](r Resource[T], cb func(value T) (R, Handoff, error)) (R, func() error, error) {
+	var result R
+	var handoff Handoff
+	err := r.Use(func(value T) error {
+		var err error
+		result, handoff, err = cb(value)
+		return err
+	})
+	if err != nil {
+		if handoff.Release != nil {
+			err = secondaryError(err, handoff.Description, handoff.Release())
+		}
+		var zero R
+		return zero, nil, err
+	}
+
+	token := trackOpenAs("handoff", handoff.Description, 0)
+	var once sync.Once
+	var releaseErr error
+	release := func() error {
+		once.Do(func() {
+			if handoff.Release != nil {
+				releaseErr = handoff.Release()
+			}
+			token.release()
+		})
+		return releaseErr
+	}
+	return result, release, nil
+}
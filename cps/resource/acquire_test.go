@@ -0,0 +1,230 @@
+package resource_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+	"github.com/Q69K/using-cps-in-golang/cps/resource/resourcetest"
+)
+
+// fakeCloser counts its Close calls, failing them with err.
+type fakeCloser struct {
+	closes int
+	err    error
+}
+
+func (c *fakeCloser) Close() error {
+	c.closes++
+	return c.err
+}
+
+func TestAcquireReleaseIsIdempotent(t *testing.T) {
+	closer := &fakeCloser{err: errors.New("close failed")}
+	r := resource.FromOpener(func() (*fakeCloser, error) {
+		return closer, nil
+	})
+
+	value, release, err := resource.Acquire(r)
+	if err != nil || value != closer {
+		t.Fatalf("Acquire = %v, %v", value, err)
+	}
+	if closer.closes != 0 {
+		t.Errorf("closed %d times before the release", closer.closes)
+	}
+	first := release()
+	second := release()
+	if closer.closes != 1 {
+		t.Errorf("closed %d times, want once", closer.closes)
+	}
+	if !errors.Is(first, closer.err) || phaseOf(t, first) != resource.PhaseRelease || second != first {
+		t.Errorf("release = %v then %v, want the close error twice", first, second)
+	}
+}
+
+func TestAcquireForgottenReleaseIsOpen(t *testing.T) {
+	r := resourcetest.FakeResource("value", resourcetest.NoFailure)
+	r.Description = "fake value"
+	resource.SetDebug(true)
+	t.Cleanup(func() {
+		resource.SetDebug(false)
+	})
+
+	_, release, err := resource.Acquire(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = resource.VerifyNoneOpen()
+	if !errors.Is(err, resource.ErrResourcesOpen) || !strings.Contains(err.Error(), "1 acquired") ||
+		!strings.Contains(err.Error(), "fake value") || !strings.Contains(err.Error(), "TestAcquireForgottenReleaseIsOpen") {
+		t.Errorf("VerifyNoneOpen = %v, want the acquired value with its call site", err)
+	}
+
+	err = release()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := resource.VerifyNoneOpen(); err != nil {
+		t.Errorf("VerifyNoneOpen after the release = %v", err)
+	}
+}
+
+func TestAcquireFailure(t *testing.T) {
+	_, release, err := resource.Acquire(resourcetest.FakeResource(1, resource.PhaseAcquire))
+	if !errors.Is(err, resourcetest.ErrFake) || release != nil {
+		t.Errorf("Acquire = %v, release %v, want the acquire error without a release func", err, release != nil)
+	}
+
+	skipping := resource.Resource[int]{
+		Use: func(func(int) error) error { return nil },
+	}
+	_, _, err = resource.Acquire(skipping)
+	if phaseOf(t, err) != resource.PhaseAcquire {
+		t.Errorf("Acquire of a resource not calling back = %v, want an acquire error", err)
+	}
+	if err := resource.VerifyNoneOpen(); err != nil {
+		t.Errorf("VerifyNoneOpen after failed acquisitions = %v", err)
+	}
+}
+
+func TestFromOpener(t *testing.T) {
+	errCallback := errors.New("callback failed")
+	closer := &fakeCloser{}
+	r := resource.FromOpener(func() (*fakeCloser, error) {
+		return closer, nil
+	})
+	err := r.Use(func(c *fakeCloser) error {
+		if c != closer || c.closes != 0 {
+			t.Errorf("callback got %+v, want the opened value", c)
+		}
+		return errCallback
+	})
+	if !errors.Is(err, errCallback) || closer.closes != 1 {
+		t.Errorf("Use = %v after %d closes, want the callback error and one close", err, closer.closes)
+	}
+
+	closer.err = errors.New("close failed")
+	err = r.Use(func(*fakeCloser) error { return nil })
+	if !errors.Is(err, closer.err) || phaseOf(t, err) != resource.PhaseRelease {
+		t.Errorf("Use closing with an error = %v, want a release error", err)
+	}
+
+	errOpen := errors.New("open failed")
+	err = resource.FromOpener(func() (*fakeCloser, error) {
+		return nil, errOpen
+	}).Use(func(*fakeCloser) error {
+		t.Error("callback called")
+		return nil
+	})
+	if !errors.Is(err, errOpen) || phaseOf(t, err) != resource.PhaseAcquire {
+		t.Errorf("Use failing to open = %v, want an acquire error", err)
+	}
+}
+
+// exportNames writes the names of the items of conn to a new file of dir, handed off to be removed.
+func exportNames(dir string) func(conn *sql.Conn) (string, resource.Handoff, error) {
+	return func(conn *sql.Conn) (string, resource.Handoff, error) {
+		var names string
+		err := conn.QueryRowContext(context.Background(), "SELECT group_concat(name, ',') FROM items").Scan(&names)
+		if err != nil {
+			return "", resource.Handoff{}, err
+		}
+		path := filepath.Join(dir, "names.txt")
+		err = os.WriteFile(path, []byte(names), 0o644)
+		return path, resource.RemoveHandoff(path), err
+	}
+}
+
+func TestUseHandoff(t *testing.T) {
+	db := itemsNamed(t, "a", "b")
+	dir := t.TempDir()
+
+	path, release, err := resource.UseHandoff(resource.NewConnResource(db), exportNames(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inUse := db.Stats().InUse; inUse != 0 {
+		t.Errorf("%d connections in use after UseHandoff, want the conn released", inUse)
+	}
+	if err := resource.VerifyNoneOpen(); !errors.Is(err, resource.ErrResourcesOpen) {
+		t.Errorf("VerifyNoneOpen before the release = %v, want the handoff open", err)
+	}
+	if got := readFile(t, path); got != "a,b" {
+		t.Errorf("handed off %q", got)
+	}
+
+	if err := release(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Stat after the release = %v, want the file removed", err)
+	}
+	if err := release(); err != nil {
+		t.Errorf("second release = %v, want a no-op", err)
+	}
+	if err := resource.VerifyNoneOpen(); err != nil {
+		t.Errorf("VerifyNoneOpen after the release = %v", err)
+	}
+}
+
+func TestUseHandoffForgottenRelease(t *testing.T) {
+	resource.SetDebug(true)
+	t.Cleanup(func() {
+		resource.SetDebug(false)
+	})
+	db := itemsNamed(t, "a")
+	dir := t.TempDir()
+
+	_, release, err := resource.UseHandoff(resource.NewConnResource(db), exportNames(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = resource.VerifyNoneOpen()
+	if !errors.Is(err, resource.ErrResourcesOpen) || !strings.Contains(err.Error(), "1 handoff") ||
+		!strings.Contains(err.Error(), filepath.Join(dir, "names.txt")) {
+		t.Errorf("VerifyNoneOpen = %v, want the handoff of the file", err)
+	}
+	if err := release(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUseHandoffFailureReleasesRightAway(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "partial.txt")
+	errExport := errors.New("export failed")
+	result, release, err := resource.UseHandoff(resourcetest.FakeResource(1, resourcetest.NoFailure), func(int) (string, resource.Handoff, error) {
+		writeFile(t, path, "partial")
+		return path, resource.RemoveHandoff(path), errExport
+	})
+	if !errors.Is(err, errExport) || result != "" || release != nil {
+		t.Errorf("UseHandoff = %q, %v, release %v, want the error alone", result, err, release != nil)
+	}
+	if entries := dirEntries(t, dir); len(entries) != 0 {
+		t.Errorf("files = %q, want the handoff released", entries)
+	}
+
+	// a failed release of the resource releases it too, a failed handoff release is a secondary error
+	strictly(t, resourcetest.ErrFake, func(t *testing.T) error {
+		var released bool
+		_, _, err := resource.UseHandoff(resourcetest.FakeResource(1, resource.PhaseRelease), func(int) (string, resource.Handoff, error) {
+			return "", resource.Handoff{Description: "artifact", Release: func() error {
+				released = true
+				return errors.New("remove failed")
+			}}, nil
+		})
+		if !released {
+			t.Error("handoff not released")
+		}
+		if err := resource.VerifyNoneOpen(); err != nil {
+			t.Errorf("VerifyNoneOpen = %v, want nothing handed off", err)
+		}
+		return err
+	})
+}
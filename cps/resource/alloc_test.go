@@ -0,0 +1,147 @@
+package resource_test
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+// The manual baselines of the wrappers, doing what they do by hand.
+
+func openByHand(path string) error {
+	f, err := os.OpenFile(path, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func useFile(*os.File) error {
+	return nil
+}
+
+func txByHand(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func useTx(*sql.Tx) error {
+	return nil
+}
+
+func rowsByHand(db *sql.DB) error {
+	rows, err := db.Query("SELECT id FROM items")
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+	}
+	err = rows.Err()
+	closeErr := rows.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+func useRows(rows *sql.Rows) error {
+	for rows.Next() {
+	}
+	return rows.Err()
+}
+
+func tempFile(t testing.TB) string {
+	path := filepath.Join(t.TempDir(), "file")
+	err := os.WriteFile(path, nil, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// allocs is the average number of allocations of a call of use, failing the test on an error.
+func allocs(t *testing.T, use func() error) float64 {
+	t.Helper()
+	var err error
+	n := testing.AllocsPerRun(100, func() {
+		if useErr := use(); useErr != nil {
+			err = useErr
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// TestWrapperAllocations enforces the claim of the package doc: with no tracer, no stats collector
+// and debug mode off, a Use allocates exactly as much as doing it by hand.
+func TestWrapperAllocations(t *testing.T) {
+	path := tempFile(t)
+	db := openDB(t)
+	file := resource.NewFileResource(path, os.O_RDONLY, 0)
+	tx := resource.RunTransaction(db)
+	rows := resource.QueryRows(db, "SELECT id FROM items")
+	cases := []struct {
+		name            string
+		byHand, wrapped func() error
+	}{
+		{"file", func() error { return openByHand(path) }, func() error { return file.Use(useFile) }},
+		{"tx", func() error { return txByHand(db) }, func() error { return tx.Use(useTx) }},
+		{"rows", func() error { return rowsByHand(db) }, func() error { return rows.Use(useRows) }},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			byHand, wrapped := allocs(t, c.byHand), allocs(t, c.wrapped)
+			t.Logf("%v allocations per Use, %v by hand", wrapped, byHand)
+			if wrapped > byHand {
+				t.Fatalf("%v allocations per Use, %v by hand", wrapped, byHand)
+			}
+		})
+	}
+}
+
+func benchmark(b *testing.B, use func() error) {
+	b.ReportAllocs()
+	for range b.N {
+		if err := use(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFileByHand(b *testing.B) {
+	path := tempFile(b)
+	benchmark(b, func() error { return openByHand(path) })
+}
+
+func BenchmarkNewFileResource(b *testing.B) {
+	file := resource.NewFileResource(tempFile(b), os.O_RDONLY, 0)
+	benchmark(b, func() error { return file.Use(useFile) })
+}
+
+func BenchmarkTxByHand(b *testing.B) {
+	db := openDB(b)
+	benchmark(b, func() error { return txByHand(db) })
+}
+
+func BenchmarkRunTransaction(b *testing.B) {
+	tx := resource.RunTransaction(openDB(b))
+	benchmark(b, func() error { return tx.Use(useTx) })
+}
+
+func BenchmarkRowsByHand(b *testing.B) {
+	db := openDB(b)
+	benchmark(b, func() error { return rowsByHand(db) })
+}
+
+func BenchmarkQueryRows(b *testing.B) {
+	rows := resource.QueryRows(openDB(b), "SELECT id FROM items")
+	benchmark(b, func() error { return rows.Use(useRows) })
+}
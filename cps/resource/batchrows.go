@@ -0,0 +1,104 @@
+package resource
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// RowDecoder decodes a row with a scan function which works like rows.Scan, as in Paginate.
+type RowDecoder[T any] func(scan func(dest ...any) error) (T, error)
+
+type batchOptions struct {
+	prefetch bool
+	rows     []RowsOption
+}
+
+// BatchOption configures ForEachBatch.
+type BatchOption func(options *batchOptions)
+
+// PrefetchBatch makes ForEachBatch fetch the rows of the next batch while fn handles the current one,
+// in a goroutine of its own: fn isn't called concurrently with itself, but does run concurrently
+// with the decoding.
+func PrefetchBatch() BatchOption {
+	return func(options *batchOptions) {
+		options.prefetch = true
+	}
+}
+
+// BatchRowsOptions applies MaxRows and WarnRows to the rows of ForEachBatch.
+func BatchRowsOptions(opts ...RowsOption) BatchOption {
+	return func(options *batchOptions) {
+		options.rows = append(options.rows, opts...)
+	}
+}
+
+// ForEachBatch runs the query with q and calls fn for every batchSize rows decoded with decode,
+// the last batch getting the remaining ones. fn may keep its batch, every batch is a new slice.
+// A decode or fn error stops the iteration; the rows are closed and rows.Err() checked like in QueryRows.
+func ForEachBatch[T any](q Queryer, query string, args []any, batchSize int, decode RowDecoder[T], fn func(batch []T) error, opts ...BatchOption) error {
+	if batchSize < 1 {
+		return fmt.Errorf("for each batch: batch size %d is not positive", batchSize)
+	}
+	var options batchOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return QueryRows(q, query, args...).Use(func(rows *sql.Rows) error {
+		handle := fn
+		var running chan error // the previous fn call with PrefetchBatch
+		wait := func() error {
+			if running == nil {
+				return nil
+			}
+			err := <-running
+			running = nil
+			return err
+		}
+		if options.prefetch {
+			handle = func(batch []T) error {
+				err := wait()
+				if err != nil {
+					return err
+				}
+				running = make(chan error, 1)
+				go func() {
+					running <- fn(batch)
+				}()
+				return nil
+			}
+		}
+
+		counter := newRowsOptions(options.rows).counter(query)
+		err := eachBatch(rows, counter, batchSize, decode, handle)
+		return errors.Join(err, wait())
+	})
+}
+
+func eachBatch[T any](rows *sql.Rows, counter *rowCounter, batchSize int, decode RowDecoder[T], fn func(batch []T) error) error {
+	batch := make([]T, 0, batchSize)
+	for rows.Next() {
+		err := counter.next()
+		if err != nil {
+			return err
+		}
+		item, err := decode(rows.Scan)
+		if err != nil {
+			return err
+		}
+		batch = append(batch, item)
+		if len(batch) == batchSize {
+			err = fn(batch)
+			if err != nil {
+				return err
+			}
+			batch = make([]T, 0, batchSize)
+		}
+	}
+	err := rows.Err()
+	if err != nil || len(batch) == 0 {
+		return err
+	}
+	return fn(batch)
+}
@@ -0,0 +1,152 @@
+package resource_test
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+func decodeName(scan func(dest ...any) error) (string, error) {
+	var name string
+	err := scan(&name)
+	return name, err
+}
+
+func TestForEachBatchSizes(t *testing.T) {
+	var names []string
+	for i := range 10 {
+		names = append(names, fmt.Sprint(i))
+	}
+	db := itemsNamed(t, names...)
+
+	for _, test := range []struct {
+		batchSize int
+		want      []int
+	}{
+		{5, []int{5, 5}},
+		{4, []int{4, 4, 2}},
+		{1, []int{1, 1, 1, 1, 1, 1, 1, 1, 1, 1}},
+		{100, []int{10}},
+	} {
+		for _, opts := range [][]resource.BatchOption{nil, {resource.PrefetchBatch()}} {
+			var sizes []int
+			var got []string
+			err := resource.ForEachBatch(db, "SELECT name FROM items ORDER BY id", nil, test.batchSize, decodeName, func(batch []string) error {
+				sizes = append(sizes, len(batch))
+				got = append(got, batch...)
+				return nil
+			}, opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(sizes, test.want) || !slices.Equal(got, names) {
+				t.Errorf("batch size %d, prefetch %v: batches of %v with %q, want %v with every row in order",
+					test.batchSize, opts != nil, sizes, got, test.want)
+			}
+		}
+	}
+
+	calls := 0
+	err := resource.ForEachBatch(db, "SELECT name FROM items WHERE id > 100", nil, 5, decodeName, func([]string) error {
+		calls++
+		return nil
+	})
+	if err != nil || calls != 0 {
+		t.Errorf("ForEachBatch of no rows = %v after %d calls, want none", err, calls)
+	}
+	err = resource.ForEachBatch(db, "SELECT name FROM items", nil, 0, decodeName, func([]string) error { return nil })
+	if err == nil {
+		t.Error("ForEachBatch with a batch size of 0 succeeded")
+	}
+}
+
+func TestForEachBatchStops(t *testing.T) {
+	var names []string
+	for i := range 20 {
+		names = append(names, fmt.Sprint(i))
+	}
+	db := itemsNamed(t, names...)
+	errStop := errors.New("stop")
+
+	for _, opts := range [][]resource.BatchOption{nil, {resource.PrefetchBatch()}} {
+		calls := 0
+		err := resource.ForEachBatch(db, "SELECT name FROM items ORDER BY id", nil, 3, decodeName, func(batch []string) error {
+			calls++
+			if calls == 2 {
+				return errStop
+			}
+			return nil
+		}, opts...)
+		// with PrefetchBatch, the batch fetched meanwhile isn't handled
+		if !errors.Is(err, errStop) || calls != 2 {
+			t.Errorf("prefetch %v: ForEachBatch = %v after %d calls, want it stopped at the second", opts != nil, err, calls)
+		}
+		if inUse := db.Stats().InUse; inUse != 0 {
+			t.Errorf("prefetch %v: %d connections in use, want the rows closed", opts != nil, inUse)
+		}
+	}
+
+	errDecode := errors.New("bad row")
+	calls := 0
+	err := resource.ForEachBatch(db, "SELECT name FROM items ORDER BY id", nil, 5, func(scan func(dest ...any) error) (string, error) {
+		name, err := decodeName(scan)
+		if name == "7" {
+			return "", errDecode
+		}
+		return name, err
+	}, func([]string) error {
+		calls++
+		return nil
+	})
+	if !errors.Is(err, errDecode) || calls != 1 {
+		t.Errorf("ForEachBatch = %v after %d calls, want the decode error after the first batch", err, calls)
+	}
+}
+
+func TestForEachBatchPrefetchOverlaps(t *testing.T) {
+	var names []string
+	for i := range 100 {
+		names = append(names, fmt.Sprint(i))
+	}
+	db := itemsNamed(t, names...)
+
+	// the first batch is handled until a row of the second one is decoded
+	secondBatch := make(chan struct{})
+	var running, concurrent atomic.Int64
+	var got []string
+	err := resource.ForEachBatch(db, "SELECT name FROM items ORDER BY id", nil, 10, func(scan func(dest ...any) error) (string, error) {
+		name, err := decodeName(scan)
+		if name == "15" {
+			close(secondBatch)
+		}
+		return name, err
+	}, func(batch []string) error {
+		if running.Add(1) > 1 {
+			concurrent.Add(1)
+		}
+		defer running.Add(-1)
+		if batch[0] == "0" {
+			select {
+			case <-secondBatch:
+			case <-time.After(5 * time.Second):
+				t.Error("the second batch wasn't fetched while the first one was handled")
+			}
+		}
+		got = append(got, batch...)
+		return nil
+	}, resource.PrefetchBatch())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got, names) {
+		t.Errorf("rows %q, want every row in order", got)
+	}
+	if concurrent.Load() != 0 {
+		t.Errorf("fn ran concurrently with itself %d times", concurrent.Load())
+	}
+}
@@ -0,0 +1,215 @@
+package resource
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen matches every *CircuitOpenError with errors.Is.
+var ErrCircuitOpen = errors.New("circuit open")
+
+// CircuitOpenError is returned by WithCircuitBreaker without trying to acquire the resource.
+type CircuitOpenError struct {
+	Resource string
+	// Until is when a probe will be let through, zero while one is running.
+	Until time.Time
+}
+
+func (e *CircuitOpenError) Error() string {
+	if e.Until.IsZero() {
+		return fmt.Sprintf("%s: %v, probing", e.Resource, ErrCircuitOpen)
+	}
+	return fmt.Sprintf("%s: %v until %s", e.Resource, ErrCircuitOpen, e.Until.Format(time.RFC3339))
+}
+
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+// BreakerState is the state of the circuit breaker of WithCircuitBreaker.
+type BreakerState int
+
+const (
+	// BreakerClosed lets every Use through.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen fails every Use fast.
+	BreakerOpen
+	// BreakerHalfOpen lets one probe Use through, the others fail fast.
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("breaker state(%d)", int(s))
+	}
+}
+
+// BreakerConfig configures WithCircuitBreaker; zero fields get the defaults.
+type BreakerConfig struct {
+	// Window is how long acquisitions are remembered, 10s by default.
+	Window time.Duration
+	// MinRequests is how many acquisitions of the window it takes to trip, 10 by default.
+	MinRequests int
+	// FailureRate is the failed fraction of the acquisitions of the window which trips, 0.5 by default.
+	FailureRate float64
+	// OpenFor is how long Use fails fast before a probe, 5s by default.
+	OpenFor time.Duration
+	// Now tells the time, time.Now when nil; Clock.Now for a fake clock.
+	Now func() time.Time
+	// OnStateChange is called on every transition, by the goroutine running Use, which it must not
+	// use the resource from; nil for none.
+	OnStateChange func(from, to BreakerState)
+}
+
+// breakerBuckets is how many slices of the window are counted.
+const breakerBuckets = 10
+
+// WithCircuitBreaker counts the acquisitions of r which failed, and once they make FailureRate of those
+// of the sliding window, opens the circuit: Use fails fast with a *CircuitOpenError for OpenFor,
+// then lets a single probe acquire r, whose success closes the circuit and failure opens it again.
+//
+// Only acquisitions count: an error of Use which ran the callback, its own or a release one, doesn't.
+func WithCircuitBreaker[T any](r Resource[T], cfg BreakerConfig) Resource[T] {
+	b := newBreaker(cfg, r.Describe())
+	return Resource[T]{
+		Description: r.Description,
+		Use: func(callback func(value T) error) error {
+			probe, err := b.allow()
+			if err != nil {
+				return phaseError(PhaseAcquire, err)
+			}
+			var called bool
+			err = r.Use(func(value T) error {
+				called = true
+				b.record(probe, true)
+				return callback(value)
+			})
+			if !called {
+				b.record(probe, err == nil)
+			}
+			return err
+		},
+	}
+}
+
+type breaker struct {
+	cfg      BreakerConfig
+	resource string
+
+	mu        sync.Mutex
+	state     BreakerState
+	openUntil time.Time
+	probing   bool
+	buckets   [breakerBuckets]breakerBucket
+}
+
+type breakerBucket struct {
+	start           time.Time
+	total, failures int
+}
+
+func newBreaker(cfg BreakerConfig, resource string) *breaker {
+	if cfg.Window <= 0 {
+		cfg.Window = 10 * time.Second
+	}
+	if cfg.MinRequests <= 0 {
+		cfg.MinRequests = 10
+	}
+	if cfg.FailureRate <= 0 {
+		cfg.FailureRate = 0.5
+	}
+	if cfg.OpenFor <= 0 {
+		cfg.OpenFor = 5 * time.Second
+	}
+	if cfg.Now == nil {
+		cfg.Now = RealClock().Now
+	}
+	return &breaker{cfg: cfg, resource: resource}
+}
+
+// allow tells whether a Use may acquire the resource, and whether it's the probe.
+func (b *breaker) allow() (probe bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		if b.cfg.Now().Before(b.openUntil) {
+			return false, &CircuitOpenError{Resource: b.resource, Until: b.openUntil}
+		}
+		b.transition(BreakerHalfOpen)
+		b.probing = true
+		return true, nil
+	case BreakerHalfOpen:
+		if b.probing {
+			return false, &CircuitOpenError{Resource: b.resource}
+		}
+		b.probing = true
+		return true, nil
+	}
+	return false, nil
+}
+
+// record counts an acquisition, once per Use.
+func (b *breaker) record(probe, acquired bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.cfg.Now()
+	if probe {
+		b.probing = false
+		if acquired {
+			b.buckets = [breakerBuckets]breakerBucket{}
+			b.transition(BreakerClosed)
+		} else {
+			b.open(now)
+		}
+		return
+	}
+	if b.state != BreakerClosed {
+		// acquired before the circuit opened
+		return
+	}
+
+	width := b.cfg.Window / breakerBuckets
+	start := now.Truncate(width)
+	bucket := &b.buckets[start.UnixNano()/int64(width)%breakerBuckets]
+	if !bucket.start.Equal(start) {
+		*bucket = breakerBucket{start: start}
+	}
+	bucket.total++
+	if !acquired {
+		bucket.failures++
+	}
+
+	var total, failures int
+	for _, bucket := range b.buckets {
+		if now.Sub(bucket.start) < b.cfg.Window {
+			total += bucket.total
+			failures += bucket.failures
+		}
+	}
+	if !acquired && total >= b.cfg.MinRequests && float64(failures) >= b.cfg.FailureRate*float64(total) {
+		b.open(now)
+	}
+}
+
+func (b *breaker) open(now time.Time) {
+	b.openUntil = now.Add(b.cfg.OpenFor)
+	b.transition(BreakerOpen)
+}
+
+func (b *breaker) transition(to BreakerState) {
+	from := b.state
+	b.state = to
+	if from != to && b.cfg.OnStateChange != nil {
+		b.cfg.OnStateChange(from, to)
+	}
+}
@@ -0,0 +1,198 @@
+package resource_test
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+var errDown = errors.New("database down")
+
+// scriptedResource fails to acquire while *down, counting the acquisitions tried in *tries.
+func scriptedResource(down *bool, tries *int) resource.Resource[int] {
+	return resource.Resource[int]{
+		Description: "db",
+		Use: func(callback func(int) error) error {
+			*tries++
+			if *down {
+				return errDown
+			}
+			return callback(1)
+		},
+	}
+}
+
+// breakerConfig trips on half of 4 acquisitions of 10s, recording the transitions in transitions.
+func breakerConfig(clock resource.Clock, transitions *[]string) resource.BreakerConfig {
+	return resource.BreakerConfig{
+		Window:      10 * time.Second,
+		MinRequests: 4,
+		FailureRate: 0.5,
+		OpenFor:     5 * time.Second,
+		Now:         clock.Now,
+		OnStateChange: func(from, to resource.BreakerState) {
+			*transitions = append(*transitions, from.String()+" -> "+to.String())
+		},
+	}
+}
+
+func TestCircuitBreakerTransitions(t *testing.T) {
+	clock := newFakeClock()
+	var transitions []string
+	var down bool
+	var tries int
+	r := resource.WithCircuitBreaker(scriptedResource(&down, &tries), breakerConfig(clock, &transitions))
+	use := func() error {
+		return r.Use(func(int) error { return nil })
+	}
+
+	for _, fail := range []bool{false, false, true, true} {
+		down = fail
+		err := use()
+		if !errors.Is(err, errDown) && fail || err != nil && !fail {
+			t.Fatalf("Use = %v while closed", err)
+		}
+	}
+	if want := []string{"closed -> open"}; !slices.Equal(transitions, want) {
+		t.Fatalf("transitions = %q after 2 failures of 4, want %q", transitions, want)
+	}
+
+	// open: fail fast without trying
+	clock.Advance(4 * time.Second)
+	err := use()
+	var openErr *resource.CircuitOpenError
+	if !errors.As(err, &openErr) || !errors.Is(err, resource.ErrCircuitOpen) || phaseOf(t, err) != resource.PhaseAcquire {
+		t.Fatalf("Use while open = %v, want a *CircuitOpenError", err)
+	}
+	if !openErr.Until.Equal(epoch.Add(5*time.Second)) || openErr.Resource != "db" {
+		t.Errorf("error = %+v, want db open until 5s after the trip", openErr)
+	}
+	if got, want := openErr.Error(), "db: circuit open until 2024-01-01T00:00:05Z"; got != want {
+		t.Errorf("Error = %q, want %q", got, want)
+	}
+	if tries != 4 {
+		t.Errorf("%d acquisitions tried, want none while open", tries)
+	}
+
+	// a failed probe opens it again
+	clock.Advance(time.Second)
+	if err := use(); !errors.Is(err, errDown) {
+		t.Fatalf("probe = %v, want the acquire error", err)
+	}
+	if err := use(); !errors.Is(err, resource.ErrCircuitOpen) {
+		t.Fatalf("Use after the failed probe = %v, want ErrCircuitOpen", err)
+	}
+
+	// a successful one closes it
+	down = false
+	clock.Advance(5 * time.Second)
+	if err := use(); err != nil {
+		t.Fatalf("probe = %v", err)
+	}
+	if err := use(); err != nil {
+		t.Fatalf("Use once closed = %v", err)
+	}
+	want := []string{"closed -> open", "open -> half-open", "half-open -> open", "open -> half-open", "half-open -> closed"}
+	if !slices.Equal(transitions, want) {
+		t.Errorf("transitions = %q, want %q", transitions, want)
+	}
+	if tries != 7 {
+		t.Errorf("%d acquisitions tried, want 7", tries)
+	}
+
+	// the failures before the trip were forgotten: 2 of 3 don't trip it
+	down = true
+	for range 2 {
+		_ = use()
+	}
+	if len(transitions) != len(want) {
+		t.Errorf("transitions = %q, want it still closed", transitions)
+	}
+}
+
+func TestCircuitBreakerSingleProbe(t *testing.T) {
+	clock := newFakeClock()
+	var transitions []string
+	down := true
+	var r resource.Resource[int]
+	var acquiring func()
+	r = resource.WithCircuitBreaker(resource.Resource[int]{
+		Description: "db",
+		Use: func(callback func(int) error) error {
+			if down {
+				return errDown
+			}
+			acquiring()
+			return callback(1)
+		},
+	}, breakerConfig(clock, &transitions))
+	for range 4 {
+		_ = r.Use(func(int) error { return nil })
+	}
+	down = false
+	clock.Advance(5 * time.Second)
+
+	// the others fail fast while the probe acquires the resource
+	acquiring = func() {
+		err := r.Use(func(int) error {
+			t.Error("a second probe acquired the resource")
+			return nil
+		})
+		var openErr *resource.CircuitOpenError
+		if !errors.As(err, &openErr) || !openErr.Until.IsZero() {
+			t.Errorf("Use during the probe = %v, want a *CircuitOpenError without Until", err)
+		} else if got, want := openErr.Error(), "db: circuit open, probing"; got != want {
+			t.Errorf("Error = %q, want %q", got, want)
+		}
+	}
+	err := r.Use(func(int) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := transitions[len(transitions)-1]; got != "half-open -> closed" {
+		t.Errorf("last transition = %q, want the probe to close it", got)
+	}
+}
+
+func TestCircuitBreakerIgnoresCallbackErrors(t *testing.T) {
+	clock := newFakeClock()
+	var transitions []string
+	var down bool
+	var tries int
+	r := resource.WithCircuitBreaker(scriptedResource(&down, &tries), breakerConfig(clock, &transitions))
+	errQuery := errors.New("bad query")
+	for range 20 {
+		if err := r.Use(func(int) error { return errQuery }); !errors.Is(err, errQuery) {
+			t.Fatalf("Use = %v, want the callback error", err)
+		}
+	}
+	if len(transitions) != 0 || tries != 20 {
+		t.Errorf("transitions = %q after %d callback errors, want none", transitions, tries)
+	}
+}
+
+func TestCircuitBreakerWindowSlides(t *testing.T) {
+	clock := newFakeClock()
+	var transitions []string
+	down := true
+	var tries int
+	r := resource.WithCircuitBreaker(scriptedResource(&down, &tries), breakerConfig(clock, &transitions))
+	for range 3 {
+		_ = r.Use(func(int) error { return nil })
+	}
+	// the 3 failures left the window
+	clock.Advance(11 * time.Second)
+	_ = r.Use(func(int) error { return nil })
+	if len(transitions) != 0 {
+		t.Errorf("transitions = %q, want the old failures forgotten", transitions)
+	}
+	for range 3 {
+		_ = r.Use(func(int) error { return nil })
+	}
+	if want := []string{"closed -> open"}; !slices.Equal(transitions, want) {
+		t.Errorf("transitions = %q after 4 failures in the window, want %q", transitions, want)
+	}
+}
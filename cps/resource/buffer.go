@@ -0,0 +1,42 @@
+package resource
+
+import (
+	"bytes"
+	"os"
+	"sync"
+)
+
+var bufferPool = sync.Pool{
+	New: func() any {
+		return new(bytes.Buffer)
+	},
+}
+
+// WithBuffer lends fn a buffer from a pool and returns it there afterwards, even on error or panic.
+//
+// The buffer is reused as soon as fn returns: keeping a reference to it
+// (or to a slice returned by its Bytes method) after that is a bug.
+func WithBuffer(fn func(buf *bytes.Buffer) error) error {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	defer func() {
+		buf.Reset()
+		bufferPool.Put(buf)
+	}()
+
+	return fn(buf)
+}
+
+// WriteFileBuffered builds the content in a pooled buffer and writes it to the file in one go.
+// The file is not acquired at all if build fails.
+func WriteFileBuffered(fr FileResource, build func(buf *bytes.Buffer) error) error {
+	return WithBuffer(func(buf *bytes.Buffer) error {
+		err := build(buf)
+		if err != nil {
+			return err
+		}
+		return fr.Use(func(file *os.File) error {
+			_, err := buf.WriteTo(file)
+			return err
+		})
+	})
+}
@@ -0,0 +1,100 @@
+package resource_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+func TestWithBufferResetsOnErrorAndPanic(t *testing.T) {
+	errBoom := errors.New("boom")
+	err := resource.WithBuffer(func(buf *bytes.Buffer) error {
+		buf.WriteString("left over")
+		return errBoom
+	})
+	if err != errBoom {
+		t.Errorf("WithBuffer = %v, want the error of fn", err)
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("panic not propagated")
+			}
+		}()
+		resource.WithBuffer(func(buf *bytes.Buffer) error {
+			buf.WriteString("left over")
+			panic("boom")
+		})
+	}()
+
+	for range 10 {
+		resource.WithBuffer(func(buf *bytes.Buffer) error {
+			if buf.Len() != 0 {
+				t.Errorf("lent a buffer holding %q", buf.String())
+			}
+			return nil
+		})
+	}
+}
+
+func TestWriteFileBuffered(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.txt")
+	err := resource.WriteFileBuffered(resource.NewAtomicFileResource(path, 0o644), func(buf *bytes.Buffer) error {
+		buf.WriteString("built ")
+		buf.WriteString("in memory")
+		return nil
+	})
+	if err != nil || readFile(t, path) != "built in memory" {
+		t.Errorf("WriteFileBuffered = %v, file %q", err, readFile(t, path))
+	}
+
+	errBoom := errors.New("boom")
+	skipped := filepath.Join(dir, "skipped.txt")
+	err = resource.WriteFileBuffered(resource.NewFileResource(skipped, resource.NewFileFlag, 0o644), func(buf *bytes.Buffer) error {
+		return errBoom
+	})
+	if err != errBoom {
+		t.Errorf("WriteFileBuffered = %v, want the build error", err)
+	}
+	if _, err := os.Stat(skipped); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("file acquired although build failed: %v", err)
+	}
+}
+
+var bufferContent = bytes.Repeat([]byte("0123456789abcdef"), 4<<10)
+
+func buildContent(buf *bytes.Buffer) error {
+	buf.Write(bufferContent)
+	return nil
+}
+
+func TestWithBufferAllocatesLess(t *testing.T) {
+	fresh := testing.AllocsPerRun(100, func() {
+		buildContent(new(bytes.Buffer))
+	})
+	pooled := testing.AllocsPerRun(100, func() {
+		resource.WithBuffer(buildContent)
+	})
+	if pooled >= fresh {
+		t.Errorf("%v allocations with WithBuffer, %v with fresh buffers", pooled, fresh)
+	}
+}
+
+func BenchmarkFreshBuffer(b *testing.B) {
+	b.ReportAllocs()
+	for range b.N {
+		buildContent(new(bytes.Buffer))
+	}
+}
+
+func BenchmarkWithBuffer(b *testing.B) {
+	b.ReportAllocs()
+	for range b.N {
+		resource.WithBuffer(buildContent)
+	}
+}
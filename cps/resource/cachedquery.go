@@ -0,0 +1,171 @@
+package resource
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/group"
+)
+
+type cachedQueryOptions struct {
+	sweepInterval time.Duration
+	clock         Clock
+}
+
+// CachedQueryOption configures NewCachedQuery.
+type CachedQueryOption func(options *cachedQueryOptions)
+
+// WithSweeper makes the cache drop its expired entries every interval from a goroutine
+// of its own, stopped by Close. Without it they are dropped when a Get finds them expired.
+func WithSweeper(interval time.Duration) CachedQueryOption {
+	return func(options *cachedQueryOptions) {
+		options.sweepInterval = interval
+	}
+}
+
+// CachedQueryClock makes the cache expire its entries, and run the sweeper of WithSweeper, with clock.
+func CachedQueryClock(clock Clock) CachedQueryOption {
+	return func(options *cachedQueryOptions) {
+		options.clock = clock
+	}
+}
+
+// CachedQuery is a read-through cache in front of a database lookup.
+type CachedQuery[K comparable, V any] struct {
+	db   DBResource
+	load func(q Queryer, key K) (V, error)
+	ttl  time.Duration
+
+	clock   Clock
+	mu      sync.Mutex
+	entries map[K]cachedEntry[V]
+	loading map[K]*cachedLoad[V]
+
+	sweeper group.SafeWaitGroup
+	stop    chan struct{}
+	close   sync.Once
+}
+
+type cachedEntry[V any] struct {
+	value   V
+	expires time.Time
+}
+
+type cachedLoad[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+}
+
+// NewCachedQuery creates a cache loading the missing and expired values with load, through db.
+// Loaded values are served for ttl; failed loads aren't cached.
+func NewCachedQuery[K comparable, V any](db DBResource, load func(q Queryer, key K) (V, error), ttl time.Duration, opts ...CachedQueryOption) *CachedQuery[K, V] {
+	var options cachedQueryOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	c := &CachedQuery[K, V]{
+		db:      db,
+		load:    load,
+		ttl:     ttl,
+		clock:   clockOr(options.clock),
+		entries: make(map[K]cachedEntry[V]),
+		loading: make(map[K]*cachedLoad[V]),
+		sweeper: group.NewSafeWaitGroup(),
+		stop:    make(chan struct{}),
+	}
+	if options.sweepInterval > 0 {
+		c.sweeper.Run(func() {
+			c.sweep(options.sweepInterval)
+		})
+	}
+	return c
+}
+
+// Get returns the value of key, loading it when it's not cached or expired.
+// Concurrent Gets of the same key share a single load; a Get whose ctx is done stops waiting for it.
+func (c *CachedQuery[K, V]) Get(ctx context.Context, key K) (V, error) {
+	c.mu.Lock()
+	if entry, ok := c.entries[key]; ok {
+		if c.clock.Now().Before(entry.expires) {
+			c.mu.Unlock()
+			return entry.value, nil
+		}
+		delete(c.entries, key)
+	}
+	load, running := c.loading[key]
+	if !running {
+		load = &cachedLoad[V]{done: make(chan struct{})}
+		c.loading[key] = load
+	}
+	c.mu.Unlock()
+
+	if !running {
+		// not tied to ctx: the other Gets waiting for the load may still want it
+		load.value, load.err = UseValue(FromUsable(c.db), func(db *sql.DB) (V, error) {
+			return c.load(db, key)
+		})
+		c.mu.Lock()
+		if c.loading[key] == load {
+			delete(c.loading, key)
+			if load.err == nil {
+				c.entries[key] = cachedEntry[V]{value: load.value, expires: c.clock.Now().Add(c.ttl)}
+			}
+		}
+		c.mu.Unlock()
+		close(load.done)
+	}
+
+	select {
+	case <-load.done:
+		return load.value, load.err
+	case <-ctx.Done():
+		var zero V
+		return zero, ctx.Err()
+	}
+}
+
+// Invalidate drops key: the next Get loads it again. A load running meanwhile isn't cached.
+func (c *CachedQuery[K, V]) Invalidate(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+	delete(c.loading, key)
+}
+
+// Purge drops every key.
+func (c *CachedQuery[K, V]) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.entries)
+	clear(c.loading)
+}
+
+// Close stops the sweeper of WithSweeper and waits for it to return.
+func (c *CachedQuery[K, V]) Close() {
+	c.close.Do(func() {
+		close(c.stop)
+	})
+	c.sweeper.Wait()
+}
+
+func (c *CachedQuery[K, V]) sweep(interval time.Duration) {
+	ticker := c.clock.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case now := <-ticker.C():
+			c.mu.Lock()
+			for key, entry := range c.entries {
+				if !now.Before(entry.expires) {
+					delete(c.entries, key)
+				}
+			}
+			c.mu.Unlock()
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package resource_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/group"
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+	"github.com/Q69K/using-cps-in-golang/cps/resource/resourcetest"
+)
+
+// newNameCache caches the names of the items of a new database by id, through a counting driver;
+// the loads call wait first when it isn't nil.
+func newNameCache(t *testing.T, wait func(), opts ...resource.CachedQueryOption) (*resource.CachedQuery[int64, string], *resourcetest.CountingDriver, string) {
+	t.Helper()
+	driver, name := countingSQLite(t)
+	path := filepath.Join(t.TempDir(), "test.db")
+	err := resource.NewDBResource(name, path).Use(func(db *sql.DB) error {
+		_, err := db.Exec("CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT NOT NULL); INSERT INTO items VALUES (1, 'alice'), (2, 'bob')")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := resource.NewCachedQuery(resource.NewDBResource(name, path), func(q resource.Queryer, id int64) (string, error) {
+		if wait != nil {
+			wait()
+		}
+		var name string
+		err := q.QueryRowContext(context.Background(), "SELECT name FROM items WHERE id = ?", id).Scan(&name)
+		return name, err
+	}, time.Minute, opts...)
+	t.Cleanup(cache.Close)
+	return cache, driver, path
+}
+
+func TestCachedQueryLoadsColdKeyOnce(t *testing.T) {
+	release := make(chan struct{})
+	cache, driver, _ := newNameCache(t, func() { <-release })
+	before := driver.Counts().Queries
+
+	var got atomic.Int64
+	g := group.NewSafeWaitGroup()
+	for range 50 {
+		g.Run(func() {
+			name, err := cache.Get(context.Background(), 1)
+			if err != nil || name != "alice" {
+				t.Errorf("Get(1) = %q, %v", name, err)
+				return
+			}
+			got.Add(1)
+		})
+	}
+	time.Sleep(20 * time.Millisecond) // lets the Gets wait for the load
+	close(release)
+	g.Wait()
+
+	if got.Load() != 50 {
+		t.Fatalf("%d Gets succeeded, want 50", got.Load())
+	}
+	if queries := driver.Counts().Queries - before; queries != 1 {
+		t.Errorf("%d queries for one cold key, want 1", queries)
+	}
+}
+
+func TestCachedQueryExpiresAndInvalidates(t *testing.T) {
+	clock := newFakeClock()
+	cache, driver, path := newNameCache(t, nil, resource.CachedQueryClock(clock))
+	queries := func() int64 {
+		return driver.Counts().Queries
+	}
+	get := func(id int64, want string) {
+		t.Helper()
+		name, err := cache.Get(context.Background(), id)
+		if err != nil || name != want {
+			t.Fatalf("Get(%d) = %q, %v, want %q", id, name, err, want)
+		}
+	}
+	rename := func(name string) {
+		t.Helper()
+		db, err := sql.Open("sqlite3", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		_, err = db.Exec("UPDATE items SET name = ? WHERE id = 1", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	get(1, "alice")
+	start := queries()
+	rename("alicia")
+	clock.Advance(time.Minute - time.Second)
+	get(1, "alice")
+	if queries() != start {
+		t.Errorf("fresh value loaded again")
+	}
+
+	clock.Advance(time.Second)
+	get(1, "alicia")
+	if queries() != start+1 {
+		t.Errorf("%d loads after the ttl, want 1", queries()-start)
+	}
+
+	rename("ali")
+	cache.Invalidate(1)
+	get(1, "ali")
+	get(2, "bob")
+	rename("al")
+	cache.Purge()
+	get(1, "al")
+	if queries() != start+4 {
+		t.Errorf("%d loads, want one after the ttl, the invalidation, bob and the purge", queries()-start)
+	}
+}
+
+func TestCachedQueryDoesNotCacheFailures(t *testing.T) {
+	cache, driver, _ := newNameCache(t, nil)
+	for range 2 {
+		_, err := cache.Get(context.Background(), 3)
+		if !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("Get of a missing id = %v, want sql.ErrNoRows", err)
+		}
+	}
+	if counts := driver.Counts(); counts.Open() != 0 {
+		t.Errorf("counts = %+v, want the connections closed after the loads", counts)
+	}
+}
+
+func TestCachedQuerySweeperStopsOnClose(t *testing.T) {
+	clock := newFakeClock()
+	cache, driver, _ := newNameCache(t, nil, resource.CachedQueryClock(clock), resource.WithSweeper(time.Minute))
+	_, err := cache.Get(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := driver.Counts().Queries
+
+	clock.BlockUntilTimers(1)
+	clock.Advance(time.Minute)
+	_, err = cache.Get(context.Background(), 1)
+	if err != nil || driver.Counts().Queries != start+1 {
+		t.Errorf("Get after the ttl = %v, %d loads, want 1", err, driver.Counts().Queries-start)
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		cache.Close()
+		cache.Close()
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("Close didn't stop the sweeper")
+	}
+}
+
+func TestCachedQueryGetCancelled(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	cache, _, _ := newNameCache(t, func() {
+		close(started)
+		<-release
+	})
+	loaded := make(chan error)
+	go func() {
+		_, err := cache.Get(context.Background(), 1)
+		loaded <- err
+	}()
+	<-started
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := cache.Get(ctx, 1)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Get waiting with a cancelled context = %v, want context.Canceled", err)
+	}
+	close(release)
+	if err := <-loaded; err != nil {
+		t.Errorf("Get running the load = %v, want it to go on", err)
+	}
+}
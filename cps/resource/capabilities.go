@@ -0,0 +1,132 @@
+package resource
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrUnsupportedByDriver matches every *UnsupportedError with errors.Is.
+var ErrUnsupportedByDriver = errors.New("unsupported by driver")
+
+// UnsupportedError is returned by the helpers needing a feature the Capabilities of the driver lack.
+type UnsupportedError struct {
+	Driver  string
+	Feature string
+}
+
+func (e *UnsupportedError) Error() string {
+	return fmt.Sprintf("%s: %v %s", e.Feature, ErrUnsupportedByDriver, e.Driver)
+}
+
+// Is matches ErrUnsupportedByDriver, and ErrLastInsertIDUnsupported for the LastInsertId feature.
+func (e *UnsupportedError) Is(target error) bool {
+	return target == ErrUnsupportedByDriver || target == ErrLastInsertIDUnsupported && e.Feature == "LastInsertId"
+}
+
+// Capabilities tell what a driver supports, for the helpers to pick a strategy working with it.
+type Capabilities struct {
+	// LastInsertID is whether sql.Result.LastInsertId works.
+	LastInsertID bool
+	// Returning is whether INSERT ... RETURNING works.
+	Returning bool
+	// Savepoints is whether SAVEPOINT, RELEASE SAVEPOINT and ROLLBACK TO SAVEPOINT work.
+	Savepoints bool
+	// Placeholders is the placeholder style of the driver.
+	Placeholders PlaceholderStyle
+	// Snapshot is how WithSnapshot gets a consistent view of the database.
+	Snapshot SnapshotStrategy
+}
+
+var capabilities = struct {
+	sync.RWMutex
+	byDriver map[string]Capabilities
+}{byDriver: map[string]Capabilities{
+	"sqlite3":  {LastInsertID: true, Returning: true, Savepoints: true, Placeholders: QuestionMark, Snapshot: SnapshotDeferredTx},
+	"sqlite":   {LastInsertID: true, Returning: true, Savepoints: true, Placeholders: QuestionMark, Snapshot: SnapshotDeferredTx},
+	"mysql":    {LastInsertID: true, Savepoints: true, Placeholders: QuestionMark},
+	"postgres": {Returning: true, Savepoints: true, Placeholders: Dollar},
+	"pgx":      {Returning: true, Savepoints: true, Placeholders: Dollar},
+}}
+
+// RegisterCapabilities sets the capabilities of a driver, by the name it's registered with in database/sql,
+// replacing the built-in ones of sqlite3, sqlite, mysql, postgres and pgx.
+func RegisterCapabilities(driverName string, caps Capabilities) {
+	capabilities.Lock()
+	defer capabilities.Unlock()
+	capabilities.byDriver[driverName] = caps
+}
+
+// LookupCapabilities returns the capabilities registered for a driver.
+func LookupCapabilities(driverName string) (Capabilities, bool) {
+	capabilities.RLock()
+	defer capabilities.RUnlock()
+	caps, ok := capabilities.byDriver[driverName]
+	return caps, ok
+}
+
+// queryerDrivers maps the *sql.DB, *sql.Tx and *sql.Conn of this package's resources to their driver name
+// while they are in use.
+var queryerDrivers sync.Map
+
+func bindDriver(q any, driverName string) {
+	queryerDrivers.Store(q, driverName)
+}
+
+// bindDriverOf binds q to the driver of parent, if known.
+func bindDriverOf(q, parent any) {
+	if driverName, ok := queryerDrivers.Load(parent); ok {
+		queryerDrivers.Store(q, driverName)
+	}
+}
+
+func unbindDriver(q any) {
+	queryerDrivers.Delete(q)
+}
+
+// CapabilitiesOf returns the driver name and capabilities of q, when q is the *sql.DB of NewDBResource
+// or SharedDBResource, or a transaction or connection of one, and the driver has registered capabilities.
+// Helpers fall back to their driver-agnostic behavior otherwise.
+func CapabilitiesOf(q Queryer) (string, Capabilities, bool) {
+	driverName, ok := queryerDrivers.Load(q)
+	if !ok {
+		return "", Capabilities{}, false
+	}
+	caps, ok := LookupCapabilities(driverName.(string))
+	return driverName.(string), caps, ok
+}
+
+// placeholderStyleOf is the placeholder style of the driver of q, DefaultPlaceholderStyle when unknown.
+func placeholderStyleOf(q Queryer) PlaceholderStyle {
+	if _, caps, ok := CapabilitiesOf(q); ok {
+		return caps.Placeholders
+	}
+	return DefaultPlaceholderStyle
+}
+
+// WithSavepoint runs fn inside a savepoint of tx: when fn fails, what it did is rolled back
+// but the transaction goes on. name must be a valid identifier.
+// It returns an *UnsupportedError when the driver of tx is known not to support savepoints.
+func WithSavepoint(tx *sql.Tx, name string, fn func() error) error {
+	if driverName, caps, ok := CapabilitiesOf(tx); ok && !caps.Savepoints {
+		return &UnsupportedError{Driver: driverName, Feature: "savepoints"}
+	}
+	ctx := context.Background()
+	name = QuoteIdentifier(name)
+	_, err := tx.ExecContext(ctx, "SAVEPOINT "+name)
+	if err != nil {
+		return phaseError(PhaseAcquire, err)
+	}
+	err = fn()
+	if err != nil {
+		_, rollbackErr := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+name)
+		if rollbackErr != nil {
+			return errors.Join(err, phaseError(PhaseRelease, rollbackErr))
+		}
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "RELEASE SAVEPOINT "+name)
+	return phaseError(PhaseRelease, err)
+}
@@ -0,0 +1,142 @@
+package resource_test
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+func TestRegisterCapabilities(t *testing.T) {
+	caps, ok := resource.LookupCapabilities("postgres")
+	if !ok || caps.LastInsertID || !caps.Returning || caps.Placeholders != resource.Dollar {
+		t.Errorf("capabilities of postgres = %+v, %v", caps, ok)
+	}
+	if _, ok := resource.LookupCapabilities("no such driver"); ok {
+		t.Error("capabilities of an unknown driver found")
+	}
+
+	_, name := countingSQLite(t)
+	want := resource.Capabilities{LastInsertID: true, Placeholders: resource.Dollar}
+	resource.RegisterCapabilities(name, want)
+	if caps, ok := resource.LookupCapabilities(name); !ok || caps != want {
+		t.Errorf("capabilities of %s = %+v, %v, want %+v", name, caps, ok, want)
+	}
+}
+
+func TestCapabilitiesOf(t *testing.T) {
+	_, name := countingSQLite(t)
+	resource.RegisterCapabilities(name, resource.Capabilities{Savepoints: true})
+	check := func(what string, q resource.Queryer) {
+		t.Helper()
+		driverName, caps, ok := resource.CapabilitiesOf(q)
+		if !ok || driverName != name || !caps.Savepoints {
+			t.Errorf("CapabilitiesOf(%s) = %q, %+v, %v, want those of %s", what, driverName, caps, ok, name)
+		}
+	}
+
+	var used *sql.DB
+	err := resource.NewDBResource(name, filepath.Join(t.TempDir(), "test.db")).Use(func(db *sql.DB) error {
+		used = db
+		check("db", db)
+		err := resource.RunTransaction(db).Use(func(tx *sql.Tx) error {
+			check("tx", tx)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return resource.NewConnResource(db).Use(func(conn *sql.Conn) error {
+			check("conn", conn)
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := resource.CapabilitiesOf(used); ok {
+		t.Error("capabilities of a closed db found")
+	}
+
+	// a *sql.DB opened elsewhere gets the driver-agnostic behavior
+	db := openDB(t)
+	if _, _, ok := resource.CapabilitiesOf(db); ok {
+		t.Error("capabilities of a db not opened by a resource found")
+	}
+}
+
+func TestWithSavepointByCapabilities(t *testing.T) {
+	errStep := errors.New("step failed")
+	for _, savepoints := range []bool{true, false} {
+		_, name := countingSQLite(t)
+		resource.RegisterCapabilities(name, resource.Capabilities{LastInsertID: true, Savepoints: savepoints})
+		db := resource.NewDBResource(name, filepath.Join(t.TempDir(), "test.db"))
+		_, err := resource.Exec(resource.FromUsable(db), "CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT NOT NULL)")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = db.Use(func(db *sql.DB) error {
+			return resource.RunTransaction(db).Use(func(tx *sql.Tx) error {
+				_, err := tx.Exec("INSERT INTO items (name) VALUES ('kept')")
+				if err != nil {
+					return err
+				}
+				err = resource.WithSavepoint(tx, "step", func() error {
+					_, err := tx.Exec("INSERT INTO items (name) VALUES ('undone')")
+					if err != nil {
+						return err
+					}
+					return errStep
+				})
+				if savepoints && !errors.Is(err, errStep) {
+					t.Errorf("WithSavepoint = %v, want the error of the step", err)
+				}
+				var unsupported *resource.UnsupportedError
+				if !savepoints && (!errors.Is(err, resource.ErrUnsupportedByDriver) || !errors.As(err, &unsupported) ||
+					unsupported.Driver != name || unsupported.Feature != "savepoints") {
+					t.Errorf("WithSavepoint = %v, want savepoints unsupported by %s", err, name)
+				}
+				return nil
+			})
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		names, err := resource.UseValue(resource.FromUsable(db), func(db *sql.DB) ([]string, error) {
+			var names []string
+			err := resource.QueryRows(db, "SELECT name FROM items ORDER BY id").Use(func(rows *sql.Rows) error {
+				for rows.Next() {
+					var name string
+					err := rows.Scan(&name)
+					if err != nil {
+						return err
+					}
+					names = append(names, name)
+				}
+				return rows.Err()
+			})
+			return names, err
+		})
+		if err != nil || len(names) != 1 || names[0] != "kept" {
+			t.Errorf("savepoints %v: names = %q, %v, want only the one outside the savepoint", savepoints, names, err)
+		}
+	}
+}
+
+func TestUnsupportedError(t *testing.T) {
+	err := error(&resource.UnsupportedError{Driver: "custom", Feature: "LastInsertId"})
+	if got := err.Error(); got != "LastInsertId: unsupported by driver custom" {
+		t.Errorf("Error = %q", got)
+	}
+	if !errors.Is(err, resource.ErrUnsupportedByDriver) || !errors.Is(err, resource.ErrLastInsertIDUnsupported) {
+		t.Errorf("%v doesn't match ErrUnsupportedByDriver and ErrLastInsertIDUnsupported", err)
+	}
+	err = &resource.UnsupportedError{Driver: "custom", Feature: "savepoints"}
+	if errors.Is(err, resource.ErrLastInsertIDUnsupported) {
+		t.Errorf("%v matches ErrLastInsertIDUnsupported", err)
+	}
+}
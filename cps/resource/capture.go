@@ -0,0 +1,62 @@
+package resource
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"sync/atomic"
+
+	"github.com/Q69K/using-cps-in-golang/cps/group"
+)
+
+// ErrCaptureActive is returned by CaptureOutput called while another capture runs.
+var ErrCaptureActive = errors.New("output is already being captured")
+
+var capturing atomic.Bool
+
+// CaptureOutput runs fn with os.Stdout and os.Stderr replaced by pipes and returns what was written to them.
+// The originals are restored even when fn panics.
+//
+// The replacement is process-wide: output of other goroutines is captured too.
+func CaptureOutput(fn func() error) (stdout, stderr string, err error) {
+	if !capturing.CompareAndSwap(false, true) {
+		return "", "", ErrCaptureActive
+	}
+	defer capturing.Store(false)
+
+	outR, outW, err := os.Pipe()
+	if err != nil {
+		return "", "", phaseError(PhaseAcquire, err)
+	}
+	errR, errW, err := os.Pipe()
+	if err != nil {
+		err = phaseError(PhaseAcquire, err)
+		err = secondaryError(err, "pipe", phaseError(PhaseRelease, outR.Close()))
+		return "", "", secondaryError(err, "pipe", phaseError(PhaseRelease, outW.Close()))
+	}
+
+	// read while fn writes, or a full pipe would block it
+	var outBuf, errBuf bytes.Buffer
+	var outErr, errErr error
+	readers := group.NewSafeWaitGroup()
+	readers.Run(func() {
+		_, outErr = io.Copy(&outBuf, outR)
+	})
+	readers.Run(func() {
+		_, errErr = io.Copy(&errBuf, errR)
+	})
+
+	originalOut, originalErr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = outW, errW
+	defer func() {
+		os.Stdout, os.Stderr = originalOut, originalErr
+		closeErr := errors.Join(outW.Close(), errW.Close())
+		readers.Wait()
+		closeErr = errors.Join(closeErr, outErr, errErr, outR.Close(), errR.Close())
+		stdout, stderr = outBuf.String(), errBuf.String()
+		err = errors.Join(err, phaseError(PhaseRelease, closeErr))
+	}()
+
+	return "", "", fn()
+}
@@ -0,0 +1,83 @@
+package resource_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+func TestCaptureOutput(t *testing.T) {
+	originalOut, originalErr := os.Stdout, os.Stderr
+	errBoom := errors.New("boom")
+	stdout, stderr, err := resource.CaptureOutput(func() error {
+		fmt.Println("to stdout")
+		fmt.Fprintln(os.Stderr, "to stderr")
+		return errBoom
+	})
+	if !errors.Is(err, errBoom) {
+		t.Errorf("CaptureOutput = %v, want the error of fn", err)
+	}
+	if stdout != "to stdout\n" || stderr != "to stderr\n" {
+		t.Errorf("captured %q and %q", stdout, stderr)
+	}
+	if os.Stdout != originalOut || os.Stderr != originalErr {
+		t.Error("outputs not restored")
+	}
+}
+
+func TestCaptureOutputLarge(t *testing.T) {
+	line := strings.Repeat("x", 1023) + "\n"
+	stdout, stderr, err := resource.CaptureOutput(func() error {
+		for range 1024 { // 1MiB, way over the buffer of a pipe
+			fmt.Print(line)
+			fmt.Fprint(os.Stderr, line)
+		}
+		return nil
+	})
+	if err != nil || len(stdout) != 1<<20 || len(stderr) != 1<<20 {
+		t.Errorf("CaptureOutput = %v with %d and %d bytes, want 1MiB each", err, len(stdout), len(stderr))
+	}
+}
+
+func TestCaptureOutputRestoresOnPanic(t *testing.T) {
+	originalOut, originalErr := os.Stdout, os.Stderr
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("panic swallowed")
+			}
+		}()
+		resource.CaptureOutput(func() error {
+			panic("kaboom")
+		})
+	}()
+	if os.Stdout != originalOut || os.Stderr != originalErr {
+		t.Error("outputs not restored after the panic")
+	}
+	_, _, err := resource.CaptureOutput(func() error { return nil })
+	if err != nil {
+		t.Errorf("CaptureOutput after the panic = %v", err)
+	}
+}
+
+func TestCaptureOutputConcurrent(t *testing.T) {
+	var nestedErr error
+	stdout, _, err := resource.CaptureOutput(func() error {
+		_, _, nestedErr = resource.CaptureOutput(func() error {
+			t.Error("nested capture ran fn")
+			return nil
+		})
+		fmt.Print("outer")
+		return nil
+	})
+	if !errors.Is(nestedErr, resource.ErrCaptureActive) {
+		t.Errorf("nested CaptureOutput = %v, want %v", nestedErr, resource.ErrCaptureActive)
+	}
+	if err != nil || stdout != "outer" {
+		t.Errorf("CaptureOutput = %q, %v", stdout, err)
+	}
+}
@@ -0,0 +1,126 @@
+package resource
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrInvalidDigest is returned for a digest which isn't a hex sha256 one.
+var ErrInvalidDigest = errors.New("invalid digest")
+
+// CASStore is a content-addressed file store: every entry is named after the sha256 digest
+// of its content, dir/ab/cdef... for the digest abcdef..., so identical content is stored once.
+type CASStore struct {
+	dir string
+}
+
+// NewCASStore creates the store of dir, created by the first Put.
+// Several stores, in as many processes, can share dir.
+func NewCASStore(dir string) *CASStore {
+	return &CASStore{dir: dir}
+}
+
+func (s *CASStore) path(digest string) string {
+	return filepath.Join(s.dir, digest[:2], digest[2:])
+}
+
+// Put stores the content of r and returns its hex digest. The content is written to a temporary file
+// of dir renamed to its entry, unless the entry exists already: it's left alone then.
+// Concurrent Puts of the same content both rename, getting the same entry whichever wins.
+func (s *CASStore) Put(r io.Reader) (digest string, err error) {
+	err = os.MkdirAll(s.dir, 0o755)
+	if err != nil {
+		return "", phaseError(PhaseAcquire, err)
+	}
+	err = NewTempFileResource(s.dir, ".put-*").Use(func(file *os.File) error {
+		h := sha256.New()
+		_, err := io.Copy(io.MultiWriter(file, h), r)
+		if err != nil {
+			return err
+		}
+		digest = hex.EncodeToString(h.Sum(nil))
+		path := s.path(digest)
+		if _, err := os.Stat(path); err == nil {
+			return nil
+		}
+		err = file.Sync()
+		if err != nil {
+			return err
+		}
+		err = os.MkdirAll(filepath.Dir(path), 0o755)
+		if err != nil {
+			return err
+		}
+		// the temporary file is renamed while open, its removal is then a no-op
+		return os.Rename(file.Name(), path)
+	})
+	if err != nil {
+		return "", err
+	}
+	return digest, nil
+}
+
+// Open opens the entry of digest, failing with fs.ErrNotExist when there's none.
+func (s *CASStore) Open(digest string) Resource[fs.File] {
+	if !validDigest(digest) {
+		return Resource[fs.File]{
+			Use: func(func(file fs.File) error) error {
+				return phaseError(PhaseAcquire, fmt.Errorf("%w: %q", ErrInvalidDigest, digest))
+			},
+		}
+	}
+	r := NewFSFileResource(os.DirFS(s.dir), digest[:2]+"/"+digest[2:])
+	r.Description = "file " + s.path(digest)
+	return r
+}
+
+// GC removes the entries whose digest keep rejects and returns how many it removed.
+// Temporary files of Puts in progress aren't entries: they're left alone.
+func (s *CASStore) GC(keep func(digest string) bool) (removed int, err error) {
+	subdirs, err := os.ReadDir(s.dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var errs []error
+	for _, subdir := range subdirs {
+		if !subdir.IsDir() || len(subdir.Name()) != 2 {
+			continue
+		}
+		entries, err := os.ReadDir(filepath.Join(s.dir, subdir.Name()))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, entry := range entries {
+			digest := subdir.Name() + entry.Name()
+			if entry.IsDir() || !validDigest(digest) || keep(digest) {
+				continue
+			}
+			err := os.Remove(s.path(digest))
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				errs = append(errs, err)
+				continue
+			}
+			removed++
+		}
+	}
+	return removed, errors.Join(errs...)
+}
+
+func validDigest(digest string) bool {
+	if len(digest) != 2*sha256.Size || strings.ToLower(digest) != digest {
+		return false
+	}
+	_, err := hex.DecodeString(digest)
+	return err == nil
+}
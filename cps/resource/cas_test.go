@@ -0,0 +1,157 @@
+package resource_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/group"
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+func digestOf(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// readEntry returns the content of the entry of digest in store.
+func readEntry(t *testing.T, store *resource.CASStore, digest string) string {
+	t.Helper()
+	var content []byte
+	err := store.Open(digest).Use(func(file fs.File) error {
+		var err error
+		content, err = io.ReadAll(file)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestCASStorePutAndOpen(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "cas")
+	store := resource.NewCASStore(dir)
+	digest, err := store.Put(strings.NewReader("artifact"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if digest != digestOf("artifact") {
+		t.Errorf("digest = %s, want the sha256 of the content", digest)
+	}
+	if _, err := os.Stat(filepath.Join(dir, digest[:2], digest[2:])); err != nil {
+		t.Errorf("entry not at dir/ab/cdef...: %v", err)
+	}
+	if got := readEntry(t, store, digest); got != "artifact" {
+		t.Errorf("entry = %q", got)
+	}
+
+	err = store.Open(digestOf("missing")).Use(func(fs.File) error { return nil })
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Open of a missing entry = %v, want fs.ErrNotExist", err)
+	}
+	for _, invalid := range []string{"", "../etc/passwd", strings.ToUpper(digest), digest[:10]} {
+		err = store.Open(invalid).Use(func(fs.File) error { return nil })
+		if !errors.Is(err, resource.ErrInvalidDigest) {
+			t.Errorf("Open(%q) = %v, want ErrInvalidDigest", invalid, err)
+		}
+	}
+}
+
+func TestCASStoreDuplicatePutIsNoOp(t *testing.T) {
+	dir := t.TempDir()
+	store := resource.NewCASStore(dir)
+	digest, err := store.Put(strings.NewReader("artifact"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, digest[:2], digest[2:])
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	err = os.Chtimes(path, past, past)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	again, err := store.Put(strings.NewReader("artifact"))
+	if err != nil || again != digest {
+		t.Fatalf("second Put = %s, %v, want %s", again, err, digest)
+	}
+	info, err := os.Stat(path)
+	if err != nil || !info.ModTime().Equal(past) {
+		t.Errorf("entry modified at %v, %v, want it untouched at %v", info.ModTime(), err, past)
+	}
+	if entries := dirEntries(t, dir); len(entries) != 1 {
+		t.Errorf("files = %q, want the entry's directory only, no temporary file", entries)
+	}
+}
+
+func TestCASStoreGC(t *testing.T) {
+	dir := t.TempDir()
+	store := resource.NewCASStore(dir)
+	keep := make(map[string]bool)
+	var dropped []string
+	for i, content := range []string{"a", "b", "c", "d"} {
+		digest, err := store.Put(strings.NewReader(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i%2 == 0 {
+			keep[digest] = true
+		} else {
+			dropped = append(dropped, digest)
+		}
+	}
+	// a Put in progress
+	writeFile(t, filepath.Join(dir, ".put-123"), "partial")
+
+	removed, err := store.GC(func(digest string) bool { return keep[digest] })
+	if err != nil || removed != 2 {
+		t.Fatalf("GC = %d, %v, want 2 removed", removed, err)
+	}
+	for digest := range keep {
+		readEntry(t, store, digest)
+	}
+	for _, digest := range dropped {
+		err := store.Open(digest).Use(func(fs.File) error { return nil })
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Open of a collected entry = %v, want fs.ErrNotExist", err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".put-123")); err != nil {
+		t.Errorf("temporary file of a Put: %v, want it left alone", err)
+	}
+
+	removed, err = resource.NewCASStore(filepath.Join(dir, "missing")).GC(func(string) bool { return false })
+	if err != nil || removed != 0 {
+		t.Errorf("GC of a missing store = %d, %v", removed, err)
+	}
+}
+
+func TestCASStoreConcurrentIdenticalPuts(t *testing.T) {
+	dir := t.TempDir()
+	store := resource.NewCASStore(dir)
+	content := strings.Repeat("shared artifact ", 10_000)
+	g := group.NewSafeWaitGroup()
+	for range 20 {
+		g.Run(func() {
+			digest, err := store.Put(strings.NewReader(content))
+			if err != nil || digest != digestOf(content) {
+				t.Errorf("Put = %s, %v", digest, err)
+			}
+		})
+	}
+	g.Wait()
+	if got := readEntry(t, store, digestOf(content)); got != content {
+		t.Errorf("entry of %d bytes, want the %d of the content", len(got), len(content))
+	}
+	if entries := dirEntries(t, dir); len(entries) != 1 {
+		t.Errorf("files = %q, want no temporary file left", entries)
+	}
+}
@@ -0,0 +1,79 @@
+package resource
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// Checkpointer lets CPU-bound loops notice the cancellation of a context
+// at a cost low enough to be paid at every iteration. It's safe for concurrent use.
+type Checkpointer struct {
+	ctx      context.Context
+	every    int64
+	interval time.Duration
+	clock    Clock
+
+	count atomic.Int64
+	next  atomic.Int64 // unix nanoseconds of the next time based check
+}
+
+// CheckpointerOption configures NewCheckpointer.
+type CheckpointerOption func(c *Checkpointer)
+
+// CheckpointerClock makes the checkpointer time its interval with clock.
+func CheckpointerClock(clock Clock) CheckpointerOption {
+	return func(c *Checkpointer) {
+		c.clock = clock
+	}
+}
+
+// NewCheckpointer creates a checkpointer looking at ctx every n calls of Check (every call when n < 1)
+// and, with a positive interval, not more than once per interval.
+func NewCheckpointer(ctx context.Context, n int, interval time.Duration, opts ...CheckpointerOption) *Checkpointer {
+	c := &Checkpointer{ctx: ctx, every: max(int64(n), 1), interval: interval}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.clock = clockOr(c.clock)
+	return c
+}
+
+// Check returns ctx.Err() when it's time to look at ctx and ctx is done, nil otherwise.
+// A nil checkpointer never fails.
+func (c *Checkpointer) Check() error {
+	if c == nil || c.count.Add(1)%c.every != 0 {
+		return nil
+	}
+	if c.interval > 0 {
+		now := c.clock.Now().UnixNano()
+		next := c.next.Load()
+		if now < next || !c.next.CompareAndSwap(next, now+int64(c.interval)) {
+			return nil
+		}
+	}
+	select {
+	case <-c.ctx.Done():
+		return c.ctx.Err()
+	default:
+		return nil
+	}
+}
+
+// checkEvery is how often the loop helpers look at their context.
+const checkEvery = 64
+
+// LinesContext makes ForEachLine stop with ctx.Err() soon after ctx is done.
+func LinesContext(ctx context.Context) LineOption {
+	return func(options *lineOptions) {
+		options.checkpointer = NewCheckpointer(ctx, checkEvery, 0)
+	}
+}
+
+// WalkContext makes ForEachFile stop with ctx.Err() soon after ctx is done:
+// no more files are opened, the running fn calls go on.
+func WalkContext(ctx context.Context) WalkOption {
+	return func(options *walkOptions) {
+		options.checkpointer = NewCheckpointer(ctx, 1, 0)
+	}
+}
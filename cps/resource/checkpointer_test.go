@@ -0,0 +1,136 @@
+package resource_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+func TestCheckpointerIntervalOnClock(t *testing.T) {
+	clock := newFakeClock()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c := resource.NewCheckpointer(ctx, 1, time.Second, resource.CheckpointerClock(clock))
+
+	if err := c.Check(); !errors.Is(err, context.Canceled) {
+		t.Fatalf("first check got %v, want context.Canceled", err)
+	}
+	clock.Advance(time.Second - time.Nanosecond)
+	if err := c.Check(); err != nil {
+		t.Fatalf("check within the interval got %v, want nil", err)
+	}
+	clock.Advance(time.Nanosecond)
+	if err := c.Check(); !errors.Is(err, context.Canceled) {
+		t.Fatalf("check after the interval got %v, want context.Canceled", err)
+	}
+}
+
+func TestCheckpointerEveryN(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c := resource.NewCheckpointer(ctx, 4, 0)
+	for i := 1; i <= 8; i++ {
+		err := c.Check()
+		if cancelled := errors.Is(err, context.Canceled); cancelled != (i%4 == 0) {
+			t.Errorf("check %d = %v, want the context looked at every 4 checks", i, err)
+		}
+	}
+
+	var nilCheckpointer *resource.Checkpointer
+	if err := nilCheckpointer.Check(); err != nil {
+		t.Errorf("nil checkpointer = %v", err)
+	}
+}
+
+func TestForEachLineStopsWhenCancelled(t *testing.T) {
+	path := writeTemp(t, "lines.txt", strings.Repeat("line\n", 10_000))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	lines := 0
+	err := resource.ForEachLine(path, func(string) error {
+		lines++
+		if lines == 1000 {
+			cancel()
+		}
+		return nil
+	}, resource.LinesContext(ctx))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("ForEachLine = %v, want context.Canceled", err)
+	}
+	if lines >= 1000+64 {
+		t.Errorf("%d lines read, want the loop stopped soon after the cancellation", lines)
+	}
+}
+
+func TestForEachFileStopsWhenCancelled(t *testing.T) {
+	root := t.TempDir()
+	for i := range 100 {
+		writeFile(t, filepath.Join(root, fmt.Sprintf("%03d.txt", i)), "content")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var files atomic.Int64
+	err := resource.ForEachFile(root, txtFiles, func(string, io.Reader) error {
+		if files.Add(1) == 10 {
+			cancel()
+		}
+		return nil
+	}, resource.WalkContext(ctx), resource.WalkConcurrency(1))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("ForEachFile = %v, want context.Canceled in the joined errors", err)
+	}
+	if files.Load() > 11 {
+		t.Errorf("%d files processed, want the walk stopped soon after the cancellation", files.Load())
+	}
+}
+
+func BenchmarkCheckpointer(b *testing.B) {
+	c := resource.NewCheckpointer(context.Background(), 64, 0)
+	b.ReportAllocs()
+	for range b.N {
+		_ = c.Check()
+	}
+}
+
+func BenchmarkCheckpointerInterval(b *testing.B) {
+	c := resource.NewCheckpointer(context.Background(), 1, time.Millisecond)
+	b.ReportAllocs()
+	for range b.N {
+		_ = c.Check()
+	}
+}
+
+func benchmarkForEachLine(b *testing.B, opts ...resource.LineOption) {
+	path := filepath.Join(b.TempDir(), "lines.txt")
+	err := os.WriteFile(path, []byte(strings.Repeat("a line of text\n", 100_000)), 0o644)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		err := resource.ForEachLine(path, func(string) error { return nil }, opts...)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkForEachLine(b *testing.B) {
+	benchmarkForEachLine(b)
+}
+
+func BenchmarkForEachLineContext(b *testing.B) {
+	benchmarkForEachLine(b, resource.LinesContext(context.Background()))
+}
@@ -0,0 +1,151 @@
+package resource
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+)
+
+var (
+	// ErrChecksumMismatch matches every *ChecksumMismatchError with errors.Is.
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	// ErrPartialRead is returned by NewVerifiedReadResource with RequireFullRead
+	// when the callback didn't read the whole file.
+	ErrPartialRead = errors.New("file not read to the end")
+)
+
+// ChecksumMismatchError is returned by NewVerifiedReadResource when the digest of the file isn't the expected one.
+type ChecksumMismatchError struct {
+	Path      string
+	Got, Want []byte
+}
+
+func (e *ChecksumMismatchError) Error() string {
+	return fmt.Sprintf("%s: %v: got %s, want %s", e.Path, ErrChecksumMismatch, hex.EncodeToString(e.Got), hex.EncodeToString(e.Want))
+}
+
+func (e *ChecksumMismatchError) Is(target error) bool {
+	return target == ErrChecksumMismatch
+}
+
+// ChecksumFileResource writes a file and hashes everything written to it on the way.
+type ChecksumFileResource struct {
+	Use    func(callback func(w io.Writer) error) error
+	UseSum func(callback func(w io.Writer) error) ([]byte, error)
+}
+
+// NewChecksumFileResource creates (or truncates) path; the callback's writes go both to the file and to h().
+// UseSum returns the digest, computed only if both the callback and the close succeeded.
+func NewChecksumFileResource(path string, perm os.FileMode, h func() hash.Hash) ChecksumFileResource {
+	file := NewFileResource(path, NewFileFlag|os.O_TRUNC, perm)
+
+	useSum := func(callback func(w io.Writer) error) ([]byte, error) {
+		digest := h()
+		err := file.Use(func(fd *os.File) error {
+			return callback(io.MultiWriter(fd, digest))
+		})
+		if err != nil {
+			return nil, err
+		}
+		return digest.Sum(nil), nil
+	}
+
+	return ChecksumFileResource{
+		Use: func(callback func(w io.Writer) error) error {
+			_, err := useSum(callback)
+			return err
+		},
+		UseSum: useSum,
+	}
+}
+
+type verifyOptions struct {
+	requireFullRead bool
+}
+
+// VerifyOption configures NewVerifiedReadResource.
+type VerifyOption func(options *verifyOptions)
+
+// RequireFullRead makes a callback which didn't read the whole file fail with ErrPartialRead,
+// instead of skipping the verification.
+func RequireFullRead() VerifyOption {
+	return func(options *verifyOptions) {
+		options.requireFullRead = true
+	}
+}
+
+// NewVerifiedReadResource is NewReadFileResource which hashes everything the callback reads with h(),
+// the inverse of NewChecksumFileResource. When the callback succeeded having read the whole file,
+// a digest other than want fails the release with a *ChecksumMismatchError.
+// A partial read skips the verification, or fails with ErrPartialRead with RequireFullRead.
+func NewVerifiedReadResource(path string, want []byte, h func() hash.Hash, opts ...VerifyOption) Resource[io.Reader] {
+	var options verifyOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	file := NewFileResource(path, os.O_RDONLY, 0)
+
+	return Resource[io.Reader]{
+		Description: describeFile(path, os.O_RDONLY),
+		Use: func(callback func(r io.Reader) error) error {
+			return file.Use(func(fd *os.File) error {
+				r := &verifiedReader{file: fd, digest: h()}
+				err := callback(r)
+				if err != nil {
+					return err
+				}
+				full, err := r.atEOF()
+				if err != nil {
+					return phaseError(PhaseRelease, err)
+				}
+				if !full {
+					if options.requireFullRead {
+						return phaseError(PhaseRelease, fmt.Errorf("%s: %w", path, ErrPartialRead))
+					}
+					return nil
+				}
+				got := r.digest.Sum(nil)
+				if !bytes.Equal(got, want) {
+					return phaseError(PhaseRelease, &ChecksumMismatchError{Path: path, Got: got, Want: want})
+				}
+				return nil
+			})
+		},
+	}
+}
+
+type verifiedReader struct {
+	file   *os.File
+	digest hash.Hash
+	eof    bool
+}
+
+func (r *verifiedReader) Read(p []byte) (int, error) {
+	n, err := r.file.Read(p)
+	r.digest.Write(p[:n])
+	if err == io.EOF {
+		r.eof = true
+	}
+	return n, err
+}
+
+// atEOF tells whether the whole file was read, reading one more byte when the callback stopped
+// right at the end without seeing io.EOF.
+func (r *verifiedReader) atEOF() (bool, error) {
+	if r.eof {
+		return true, nil
+	}
+	var b [1]byte
+	n, err := r.file.Read(b[:])
+	if n == 0 && err == io.EOF {
+		return true, nil
+	}
+	if n > 0 {
+		return false, nil
+	}
+	return false, err
+}
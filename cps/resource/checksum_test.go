@@ -0,0 +1,145 @@
+package resource_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+func TestChecksumFileResourceSum(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.bin")
+	sum, err := resource.NewChecksumFileResource(path, 0o644, sha256.New).UseSum(func(w io.Writer) error {
+		for range 100 {
+			if _, err := io.WriteString(w, "some content "); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := sha256.Sum256(data)
+	if len(data) != 1300 || !bytes.Equal(sum, want[:]) {
+		t.Errorf("digest %x of %d bytes, want %x", sum, len(data), want)
+	}
+}
+
+func TestChecksumFileResourceNoSumOnError(t *testing.T) {
+	errBoom := errors.New("boom")
+	path := filepath.Join(t.TempDir(), "data.bin")
+	sum, err := resource.NewChecksumFileResource(path, 0o644, sha256.New).UseSum(func(w io.Writer) error {
+		io.WriteString(w, "partial")
+		return errBoom
+	})
+	if !errors.Is(err, errBoom) || sum != nil {
+		t.Errorf("UseSum = %x, %v, want no digest and the error", sum, err)
+	}
+
+	sum, err = resource.NewChecksumFileResource(filepath.Join(path, "not-a-dir", "x"), 0o644, sha256.New).UseSum(func(w io.Writer) error {
+		t.Error("callback called without a file")
+		return nil
+	})
+	if err == nil || sum != nil || phaseOf(t, err) != resource.PhaseAcquire {
+		t.Errorf("UseSum of an unopenable file = %x, %v", sum, err)
+	}
+}
+
+func TestVerifiedReadResource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.bin")
+	content := bytes.Repeat([]byte("verified content "), 1000)
+	sum, err := resource.NewChecksumFileResource(path, 0o644, sha256.New).UseSum(func(w io.Writer) error {
+		_, err := w.Write(content)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	readAll := func(r io.Reader) error {
+		_, err := io.ReadAll(r)
+		return err
+	}
+	// reads exactly the content, without seeing io.EOF
+	readExactly := func(r io.Reader) error {
+		_, err := io.ReadFull(r, make([]byte, len(content)))
+		return err
+	}
+	readHalf := func(r io.Reader) error {
+		_, err := io.ReadFull(r, make([]byte, len(content)/2))
+		return err
+	}
+
+	for _, test := range []struct {
+		name     string
+		callback func(r io.Reader) error
+	}{
+		{"full read", readAll},
+		{"exact read", readExactly},
+		{"partial read skips verification", readHalf},
+	} {
+		err := resource.NewVerifiedReadResource(path, sum, sha256.New).Use(test.callback)
+		if err != nil {
+			t.Errorf("%s: Use = %v", test.name, err)
+		}
+	}
+
+	err = resource.NewVerifiedReadResource(path, sum, sha256.New, resource.RequireFullRead()).Use(readHalf)
+	if !errors.Is(err, resource.ErrPartialRead) || phaseOf(t, err) != resource.PhaseRelease {
+		t.Errorf("partial read with RequireFullRead = %v, want ErrPartialRead", err)
+	}
+	err = resource.NewVerifiedReadResource(path, sum, sha256.New, resource.RequireFullRead()).Use(readExactly)
+	if err != nil {
+		t.Errorf("exact read with RequireFullRead = %v", err)
+	}
+}
+
+func TestVerifiedReadResourceCorrupted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.bin")
+	sum, err := resource.NewChecksumFileResource(path, 0o644, sha256.New).UseSum(func(w io.Writer) error {
+		_, err := io.WriteString(w, "original content")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, path, "corrupted content")
+
+	err = resource.NewVerifiedReadResource(path, sum, sha256.New).Use(func(r io.Reader) error {
+		_, err := io.ReadAll(r)
+		return err
+	})
+	var mismatch *resource.ChecksumMismatchError
+	if !errors.Is(err, resource.ErrChecksumMismatch) || !errors.As(err, &mismatch) || phaseOf(t, err) != resource.PhaseRelease {
+		t.Fatalf("Use = %v, want a checksum mismatch on release", err)
+	}
+	got := sha256.Sum256([]byte("corrupted content"))
+	if !bytes.Equal(mismatch.Got, got[:]) || !bytes.Equal(mismatch.Want, sum) || mismatch.Path != path {
+		t.Errorf("mismatch = %+v", mismatch)
+	}
+	if msg := err.Error(); !strings.Contains(msg, hex.EncodeToString(got[:])) || !strings.Contains(msg, hex.EncodeToString(sum)) {
+		t.Errorf("error %q, want both digests in hex", msg)
+	}
+
+	// a failed callback isn't verified
+	errRead := errors.New("read failed")
+	err = resource.NewVerifiedReadResource(path, sum, sha256.New).Use(func(r io.Reader) error {
+		io.ReadAll(r)
+		return errRead
+	})
+	if !errors.Is(err, errRead) || errors.Is(err, resource.ErrChecksumMismatch) {
+		t.Errorf("failed Use = %v, want only the callback error", err)
+	}
+}
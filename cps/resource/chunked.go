@@ -0,0 +1,142 @@
+package resource
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// ChunkError is returned by ChunkedTransaction when a chunk failed: the chunks before it are committed.
+type ChunkError struct {
+	// Chunk is the number of the failed chunk, from 1.
+	Chunk int
+	// Committed is the number of operations of the committed chunks.
+	Committed int
+	Err       error
+}
+
+func (e *ChunkError) Error() string {
+	return fmt.Sprintf("chunk %d (%d operations committed before): %v", e.Chunk, e.Committed, e.Err)
+}
+
+func (e *ChunkError) Unwrap() error {
+	return e.Err
+}
+
+type chunkOptions struct {
+	txOptions   []TxOption
+	onCommitted func(chunks, ops int)
+}
+
+// ChunkOption configures ChunkedTransaction.
+type ChunkOption func(options *chunkOptions)
+
+// OnChunkCommitted makes ChunkedTransaction call fn after every commit with the numbers of chunks
+// and operations committed so far, to checkpoint the progress of the job.
+func OnChunkCommitted(fn func(chunks, ops int)) ChunkOption {
+	return func(options *chunkOptions) {
+		options.onCommitted = fn
+	}
+}
+
+// ChunkTxOptions passes opts to the RunTransaction of every chunk.
+func ChunkTxOptions(opts ...TxOption) ChunkOption {
+	return func(options *chunkOptions) {
+		options.txOptions = opts
+	}
+}
+
+type chunkRequest struct {
+	op     func(tx *sql.Tx) error
+	result chan error
+}
+
+// ChunkedTransaction runs a long job as a single callback which commits every n operations:
+// fn submits its operations through step, which returns the error of the operation,
+// and ChunkedTransaction runs every n of them in a RunTransaction of their own, the last one possibly shorter.
+//
+// An operation error, or fn's, rolls the current chunk back and is returned as a *ChunkError,
+// the previous chunks staying committed. A failed commit is reported by the following steps, which don't
+// run their operations once a chunk failed, and by the returned error.
+// The transactions run in a goroutine of their own: operations must use the tx they're given,
+// and not the state of fn's goroutine unless synchronized.
+func ChunkedTransaction(db *sql.DB, n int, fn func(step func(op func(tx *sql.Tx) error) error) error, opts ...ChunkOption) error {
+	var options chunkOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if n < 1 {
+		n = 1
+	}
+
+	requests := make(chan chunkRequest)
+	finish := make(chan error, 1)
+	stopped := make(chan struct{})
+	var chunksErr error
+	go func() {
+		defer close(stopped)
+		chunksErr = runChunks(db, n, &options, requests, finish)
+	}()
+
+	step := func(op func(tx *sql.Tx) error) error {
+		request := chunkRequest{op: op, result: make(chan error, 1)}
+		select {
+		case requests <- request:
+			return <-request.result
+		case <-stopped:
+			return chunksErr
+		}
+	}
+	finish <- fn(step)
+	<-stopped
+	return chunksErr
+}
+
+// runChunks runs the requests in transactions of n of them, until fn finishes.
+func runChunks(db *sql.DB, n int, options *chunkOptions, requests <-chan chunkRequest, finish <-chan error) error {
+	var chunks, committed int
+	for {
+		var first chunkRequest
+		select {
+		case first = <-requests:
+		case err := <-finish:
+			if err != nil {
+				return &ChunkError{Chunk: chunks + 1, Committed: committed, Err: err}
+			}
+			return nil
+		}
+
+		var done bool // fn finished
+		var ops int
+		err := RunTransaction(db, options.txOptions...).Use(func(tx *sql.Tx) error {
+			request := first
+			for {
+				err := request.op(tx)
+				request.result <- err
+				if err != nil {
+					return err
+				}
+				ops++
+				if ops == n {
+					return nil
+				}
+				select {
+				case request = <-requests:
+				case err := <-finish:
+					done = true
+					return err
+				}
+			}
+		})
+		chunks++
+		if err != nil {
+			return &ChunkError{Chunk: chunks, Committed: committed, Err: err}
+		}
+		committed += ops
+		if options.onCommitted != nil {
+			options.onCommitted(chunks, committed)
+		}
+		if done {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package resource_test
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+	"github.com/Q69K/using-cps-in-golang/cps/resource/resourcetest"
+)
+
+// countingItemsDB opens an items table through a counting driver.
+func countingItemsDB(t *testing.T) (*sql.DB, *resourcetest.CountingDriver) {
+	driver, name := countingSQLite(t)
+	db, err := sql.Open(name, filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+	})
+	_, err = db.Exec("CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT NOT NULL)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, driver
+}
+
+// insertOps submits count inserts through step, the one numbered fail (from 1) failing with errFail.
+func insertOps(count, fail int, errFail error) func(step func(op func(tx *sql.Tx) error) error) error {
+	return func(step func(op func(tx *sql.Tx) error) error) error {
+		for i := 1; i <= count; i++ {
+			err := step(func(tx *sql.Tx) error {
+				if i == fail {
+					return errFail
+				}
+				return insertItem(tx, fmt.Sprint(i))
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func TestChunkedTransactionCommitsEveryN(t *testing.T) {
+	db, driver := countingItemsDB(t)
+	type progress struct{ chunks, ops int }
+	var checkpoints []progress
+	err := resource.ChunkedTransaction(db, 10, insertOps(25, 0, nil), resource.OnChunkCommitted(func(chunks, ops int) {
+		checkpoints = append(checkpoints, progress{chunks, ops})
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts := driver.Counts(); counts.Begins != 3 || counts.Commits != 3 || counts.Rollbacks != 0 {
+		t.Errorf("counts = %+v, want 3 transactions committed", counts)
+	}
+	if want := []progress{{1, 10}, {2, 20}, {3, 25}}; !slices.Equal(checkpoints, want) {
+		t.Errorf("checkpoints = %v, want %v", checkpoints, want)
+	}
+	if n := countItems(t, db); n != 25 {
+		t.Errorf("%d items, want 25", n)
+	}
+}
+
+func TestChunkedTransactionFailureRollsBackTheChunk(t *testing.T) {
+	db, driver := countingItemsDB(t)
+	errOp := errors.New("op failed")
+	var checkpoints int
+	err := resource.ChunkedTransaction(db, 10, insertOps(25, 17, errOp), resource.OnChunkCommitted(func(int, int) {
+		checkpoints++
+	}))
+	var chunkErr *resource.ChunkError
+	if !errors.As(err, &chunkErr) || !errors.Is(err, errOp) {
+		t.Fatalf("ChunkedTransaction = %v, want a *ChunkError of the op", err)
+	}
+	if chunkErr.Chunk != 2 || chunkErr.Committed != 10 {
+		t.Errorf("error = %+v, want chunk 2 failed after 10 operations committed", chunkErr)
+	}
+	if got, want := chunkErr.Error(), "chunk 2 (10 operations committed before): op failed"; got != want {
+		t.Errorf("Error = %q, want %q", got, want)
+	}
+	if counts := driver.Counts(); counts.Commits != 1 || counts.Rollbacks != 1 {
+		t.Errorf("counts = %+v, want the first chunk committed and the second rolled back", counts)
+	}
+	if n := countItems(t, db); n != 10 || checkpoints != 1 {
+		t.Errorf("%d items after %d checkpoints, want the 10 of the first chunk", n, checkpoints)
+	}
+}
+
+func TestChunkedTransactionFnError(t *testing.T) {
+	db, _ := countingItemsDB(t)
+	errFn := errors.New("fn failed")
+	for _, test := range []struct {
+		ops, committed int
+	}{
+		{ops: 15, committed: 10}, // in the middle of a chunk
+		{ops: 10, committed: 10}, // between chunks
+	} {
+		_, err := db.Exec("DELETE FROM items")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = resource.ChunkedTransaction(db, 10, func(step func(op func(tx *sql.Tx) error) error) error {
+			err := insertOps(test.ops, 0, nil)(step)
+			if err != nil {
+				return err
+			}
+			return errFn
+		})
+		var chunkErr *resource.ChunkError
+		if !errors.As(err, &chunkErr) || !errors.Is(err, errFn) || chunkErr.Chunk != 2 || chunkErr.Committed != 10 {
+			t.Errorf("ChunkedTransaction after %d ops = %v, want chunk 2 failed with fn's error", test.ops, err)
+		}
+		if n := countItems(t, db); n != test.committed {
+			t.Errorf("%d items after %d ops, want %d", n, test.ops, test.committed)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package resource
+
+import (
+	"errors"
+)
+
+// Cleanup is the undo stack of WithCleanup.
+type Cleanup struct {
+	undos     []func() error
+	committed bool
+}
+
+// Defer registers an undo step; the steps run in reverse order of registration.
+func (c *Cleanup) Defer(undo func() error) {
+	c.undos = append(c.undos, undo)
+}
+
+// Commit keeps what the steps did: once fn succeeds, the undo steps are dropped.
+// A failing fn is undone even after Commit.
+func (c *Cleanup) Commit() {
+	c.committed = true
+}
+
+type cleanupOptions struct {
+	commitOnSuccess bool
+}
+
+// CleanupOption configures WithCleanup.
+type CleanupOption func(options *cleanupOptions)
+
+// CommitOnSuccess makes a successful fn commit without calling Commit:
+// the undo steps only run when fn fails or panics.
+func CommitOnSuccess() CleanupOption {
+	return func(options *cleanupOptions) {
+		options.commitOnSuccess = true
+	}
+}
+
+// WithCleanup runs fn, which acquires step by step and registers how to undo every step
+// with c.Defer, like RunTransaction rolls back what its callback did.
+//
+// After fn returns the undo steps run, last registered first, unless fn succeeded and called
+// c.Commit (or CommitOnSuccess is given). Their errors are joined with fn's one as PhaseRelease errors;
+// a failed undo doesn't stop the next ones. When fn panics the undo steps run before the panic goes on.
+func WithCleanup(fn func(c *Cleanup) error, opts ...CleanupOption) (err error) {
+	var options cleanupOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	c := &Cleanup{}
+	panicking := true
+	defer func() {
+		if !panicking && err == nil && (c.committed || options.commitOnSuccess) {
+			return
+		}
+		undoErr := c.undo()
+		if !panicking && undoErr != nil {
+			err = errors.Join(err, undoErr)
+		}
+	}()
+	err = fn(c)
+	panicking = false
+	return err
+}
+
+func (c *Cleanup) undo() error {
+	var errs []error
+	for i := len(c.undos) - 1; i >= 0; i-- {
+		errs = append(errs, phaseError(PhaseRelease, c.undos[i]()))
+	}
+	return errors.Join(errs...)
+}
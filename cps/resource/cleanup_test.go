@@ -0,0 +1,101 @@
+package resource_test
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+// threeSteps registers the undo steps of three steps, the second one failing,
+// and records their order in undone.
+func threeSteps(c *resource.Cleanup, undone *[]string, errUndo error) {
+	c.Defer(func() error {
+		*undone = append(*undone, "dir")
+		return nil
+	})
+	c.Defer(func() error {
+		*undone = append(*undone, "marker")
+		return errUndo
+	})
+	c.Defer(func() error {
+		*undone = append(*undone, "db")
+		return nil
+	})
+}
+
+func TestWithCleanupUndoesOnFailure(t *testing.T) {
+	errStep := errors.New("step failed")
+	errUndo := errors.New("undo failed")
+	var undone []string
+	err := resource.WithCleanup(func(c *resource.Cleanup) error {
+		threeSteps(c, &undone, errUndo)
+		c.Commit() // a failure is undone even after Commit
+		return errStep
+	})
+
+	if want := []string{"db", "marker", "dir"}; !slices.Equal(undone, want) {
+		t.Errorf("undone = %q, want %q", undone, want)
+	}
+	if !errors.Is(err, errStep) || !errors.Is(err, errUndo) {
+		t.Errorf("WithCleanup = %v, want the step and the undo errors", err)
+	}
+	var resourceErr *resource.ResourceError
+	if !errors.As(err, &resourceErr) || resourceErr.Phase != resource.PhaseRelease || !errors.Is(resourceErr, errUndo) {
+		t.Errorf("WithCleanup = %v, want the undo error as a release error", err)
+	}
+}
+
+func TestWithCleanupUndoesWithoutCommit(t *testing.T) {
+	errUndo := errors.New("undo failed")
+	var undone []string
+	err := resource.WithCleanup(func(c *resource.Cleanup) error {
+		threeSteps(c, &undone, errUndo)
+		return nil
+	})
+	if want := []string{"db", "marker", "dir"}; !slices.Equal(undone, want) {
+		t.Errorf("undone = %q, want %q", undone, want)
+	}
+	if !errors.Is(err, errUndo) || phaseOf(t, err) != resource.PhaseRelease {
+		t.Errorf("WithCleanup = %v, want the undo error", err)
+	}
+}
+
+func TestWithCleanupUndoesOnPanic(t *testing.T) {
+	var undone []string
+	defer func() {
+		if r := recover(); r != "boom" {
+			t.Errorf("recovered %v, want the panic of fn", r)
+		}
+		if want := []string{"db", "marker", "dir"}; !slices.Equal(undone, want) {
+			t.Errorf("undone = %q, want %q", undone, want)
+		}
+	}()
+	resource.WithCleanup(func(c *resource.Cleanup) error {
+		threeSteps(c, &undone, errors.New("undo failed"))
+		c.Commit()
+		panic("boom")
+	})
+	t.Error("WithCleanup didn't panic")
+}
+
+func TestWithCleanupCommit(t *testing.T) {
+	var undone []string
+	err := resource.WithCleanup(func(c *resource.Cleanup) error {
+		threeSteps(c, &undone, errors.New("undo failed"))
+		c.Commit()
+		return nil
+	})
+	if err != nil || len(undone) != 0 {
+		t.Errorf("WithCleanup with Commit = %v, undone %q, want nothing undone", err, undone)
+	}
+
+	err = resource.WithCleanup(func(c *resource.Cleanup) error {
+		threeSteps(c, &undone, errors.New("undo failed"))
+		return nil
+	}, resource.CommitOnSuccess())
+	if err != nil || len(undone) != 0 {
+		t.Errorf("WithCleanup with CommitOnSuccess = %v, undone %q, want nothing undone", err, undone)
+	}
+}
@@ -0,0 +1,35 @@
+package resource
+
+import (
+	"context"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/group"
+	"github.com/Q69K/using-cps-in-golang/cps/internal/clock"
+)
+
+// Clock tells the time and waits for the time-dependent features of the package,
+// so tests can run them with a fake clock (resourcetest.FakeClock) instead of waiting for real.
+// It's the clock of package group too. A Clock is also a Sleeper.
+type Clock = group.Clock
+
+// Timer is what Clock.NewTimer returns, a *time.Timer for the real clock.
+type Timer = group.Timer
+
+// Ticker is what Clock.NewTicker returns, a *time.Ticker for the real clock.
+type Ticker = group.Ticker
+
+// RealClock is the clock of the time package, the default of every clock option.
+func RealClock() Clock {
+	return group.RealClock()
+}
+
+// clockOr returns c, the real clock when nil.
+func clockOr(c Clock) Clock {
+	return clock.Or(c)
+}
+
+// withClockTimeout is context.WithTimeout timed by c.
+func withClockTimeout(ctx context.Context, c Clock, d time.Duration) (context.Context, context.CancelFunc) {
+	return clock.WithTimeout(ctx, c, d)
+}
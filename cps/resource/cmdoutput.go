@@ -0,0 +1,110 @@
+package resource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// CommandStderrLimit is how many bytes of the stderr of a command CommandOutputResource keeps for its *ExitError.
+var CommandStderrLimit = 64 << 10
+
+// ExitError is the release error of CommandOutputResource for a command which exited with a non-zero status.
+type ExitError struct {
+	Command  string
+	ExitCode int
+	// Stderr is what the command wrote to stderr, up to CommandStderrLimit bytes.
+	Stderr string
+	Err    *exec.ExitError
+}
+
+func (e *ExitError) Error() string {
+	msg := fmt.Sprintf("%s: exit status %d", e.Command, e.ExitCode)
+	if stderr := strings.TrimSpace(e.Stderr); stderr != "" {
+		msg += ": " + stderr
+	}
+	return msg
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// CommandOutputResource runs the command like NewCommandResource does, giving the callback its stdout.
+// Once the callback succeeded, the output it didn't read is drained, so the command doesn't block
+// on a full pipe, and the release waits for the command to exit: a non-zero exit status is an *ExitError
+// carrying the beginning of stderr. A failing callback terminates the command instead.
+func CommandOutputResource(ctx context.Context, name string, args ...string) Resource[io.Reader] {
+	return Resource[io.Reader]{
+		Description: "command " + name,
+		Use: func(callback func(r io.Reader) error) error {
+			stdout, stdoutWriter, err := os.Pipe()
+			if err != nil {
+				return phaseError(PhaseAcquire, err)
+			}
+			defer stdout.Close()
+			// closed once the command started with its own copy, or if it didn't
+			defer stdoutWriter.Close()
+
+			stderr := &boundedBuffer{limit: CommandStderrLimit}
+			err = NewCommandResourceFunc(ctx, func() *exec.Cmd {
+				cmd := exec.Command(name, args...)
+				cmd.Stdout = stdoutWriter
+				cmd.Stderr = stderr
+				return cmd
+			}).Use(func(*exec.Cmd) error {
+				// reads see the end of the output once the command closed its copy
+				stdoutWriter.Close()
+				err := callback(struct{ io.Reader }{stdout})
+				if err != nil {
+					// children of the command still writing to it fail instead of blocking its termination
+					stdout.Close()
+					return err
+				}
+				_, err = io.Copy(io.Discard, stdout)
+				if err != nil {
+					return phaseError(PhaseRelease, err)
+				}
+				return nil
+			})
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				return phaseError(PhaseRelease, &ExitError{
+					Command:  name,
+					ExitCode: exitErr.ExitCode(),
+					Stderr:   stderr.String(),
+					Err:      exitErr,
+				})
+			}
+			return err
+		},
+	}
+}
+
+// boundedBuffer keeps the first limit bytes written to it and drops the others.
+type boundedBuffer struct {
+	limit int
+
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (b *boundedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if room := b.limit - len(b.buf); room > 0 {
+		b.buf = append(b.buf, p[:min(room, len(p))]...)
+	}
+	return len(p), nil
+}
+
+func (b *boundedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return string(b.buf)
+}
@@ -0,0 +1,98 @@
+package resource_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+// readOutput runs the shell script with CommandOutputResource, returning what read took of its stdout.
+func readOutput(script string, read func(r io.Reader) ([]byte, error)) (string, error) {
+	var out []byte
+	err := resource.CommandOutputResource(context.Background(), "sh", "-c", script).Use(func(r io.Reader) error {
+		var err error
+		out, err = read(r)
+		return err
+	})
+	return string(out), err
+}
+
+func TestCommandOutputResource(t *testing.T) {
+	out, err := readOutput("echo hello; echo world", io.ReadAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "hello\nworld\n" {
+		t.Errorf("output = %q", out)
+	}
+}
+
+func TestCommandOutputResourceExitError(t *testing.T) {
+	out, err := readOutput(`echo partial; echo "disk full" >&2; exit 3`, io.ReadAll)
+	if out != "partial\n" {
+		t.Errorf("output = %q", out)
+	}
+	var exitErr *resource.ExitError
+	if !errors.As(err, &exitErr) || phaseOf(t, err) != resource.PhaseRelease {
+		t.Fatalf("Use = %v, want the release *ExitError", err)
+	}
+	if exitErr.ExitCode != 3 || exitErr.Stderr != "disk full\n" || exitErr.Command != "sh" {
+		t.Errorf("error = %+v", exitErr)
+	}
+	if got, want := exitErr.Error(), "sh: exit status 3: disk full"; got != want {
+		t.Errorf("Error = %q, want %q", got, want)
+	}
+	var execErr *exec.ExitError
+	if !errors.As(err, &execErr) {
+		t.Errorf("Use = %v, want the *exec.ExitError wrapped", err)
+	}
+}
+
+func TestCommandOutputResourceBoundsStderr(t *testing.T) {
+	previous := resource.CommandStderrLimit
+	resource.CommandStderrLimit = 10
+	t.Cleanup(func() {
+		resource.CommandStderrLimit = previous
+	})
+	_, err := readOutput(`head -c 100000 /dev/zero | tr '\0' x >&2; exit 1`, io.ReadAll)
+	var exitErr *resource.ExitError
+	if !errors.As(err, &exitErr) || exitErr.Stderr != strings.Repeat("x", 10) {
+		t.Errorf("Use = %v, want the first 10 bytes of stderr", err)
+	}
+}
+
+func TestCommandOutputResourceStopsReadingEarly(t *testing.T) {
+	errEnough := errors.New("enough")
+	// far more than a pipe holds
+	const script = "head -c 10000000 /dev/zero"
+	for _, callbackErr := range []error{nil, errEnough} {
+		done := make(chan error, 1)
+		go func() {
+			out, err := readOutput(script, func(r io.Reader) ([]byte, error) {
+				out, err := io.ReadAll(io.LimitReader(r, 1024))
+				if err == nil {
+					err = callbackErr
+				}
+				return out, err
+			})
+			if len(out) != 1024 {
+				t.Errorf("read %d bytes, want 1KB", len(out))
+			}
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			if callbackErr == nil && err != nil || !errors.Is(err, callbackErr) {
+				t.Errorf("Use = %v, want %v", err, callbackErr)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("the command blocked after the callback returned %v", callbackErr)
+		}
+	}
+}
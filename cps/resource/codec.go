@@ -0,0 +1,49 @@
+package resource
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"io"
+	"os"
+)
+
+// Codec serializes the values of SaveEncoded and LoadEncoded; implement it to plug in msgpack or protobuf.
+type Codec interface {
+	Encode(w io.Writer, v any) error
+	Decode(r io.Reader, v any) error
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Encode(w io.Writer, v any) error { return json.NewEncoder(w).Encode(v) }
+func (jsonCodec) Decode(r io.Reader, v any) error { return json.NewDecoder(r).Decode(v) }
+
+type gobCodec struct{}
+
+func (gobCodec) Encode(w io.Writer, v any) error { return gob.NewEncoder(w).Encode(v) }
+func (gobCodec) Decode(r io.Reader, v any) error { return gob.NewDecoder(r).Decode(v) }
+
+// JSONCodec encodes with encoding/json, one value per line.
+func JSONCodec() Codec {
+	return jsonCodec{}
+}
+
+// GobCodec encodes with encoding/gob.
+func GobCodec() Codec {
+	return gobCodec{}
+}
+
+// SaveEncoded atomically replaces path with v encoded by codec, going through NewAtomicFileResource:
+// a failed encoding leaves path as it was.
+func SaveEncoded(path string, v any, codec Codec, opts ...FileOption) error {
+	return NewAtomicFileResource(path, OwnerRWOnly, opts...).Use(func(fd *os.File) error {
+		return codec.Encode(fd, v)
+	})
+}
+
+// LoadEncoded decodes the content of path, encoded by codec, into v.
+func LoadEncoded(path string, v any, codec Codec) error {
+	return NewReadFileResource(path).Use(func(r io.Reader) error {
+		return codec.Decode(r, v)
+	})
+}
@@ -0,0 +1,89 @@
+package resource_test
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+func TestCodecsRoundTrip(t *testing.T) {
+	for name, codec := range map[string]resource.Codec{"json": resource.JSONCodec(), "gob": resource.GobCodec()} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "nested", "settings."+name)
+			want := settings{Name: "demo", Ports: []int{80, 443}, Tags: []string{"a", "b"}}
+			err := resource.SaveEncoded(path, want, codec, resource.WithMkdirAll(0o755))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got settings
+			err = resource.LoadEncoded(path, &got, codec)
+			if err != nil || got.Name != want.Name || !slices.Equal(got.Ports, want.Ports) || !slices.Equal(got.Tags, want.Tags) {
+				t.Errorf("loaded %+v, %v, want %+v", got, err, want)
+			}
+		})
+	}
+
+	path := filepath.Join(t.TempDir(), "settings.json")
+	err := resource.SaveEncoded(path, settings{Name: "demo"}, resource.JSONCodec())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, path); got != `{"name":"demo","ports":null}`+"\n" {
+		t.Errorf("file = %q, want JSON on a line", got)
+	}
+}
+
+// failingCodec writes half of an encoding, then fails.
+type failingCodec struct{}
+
+var errEncode = errors.New("encoder broke")
+
+func (failingCodec) Encode(w io.Writer, v any) error {
+	_, err := io.WriteString(w, `{"name":`)
+	if err != nil {
+		return err
+	}
+	return errEncode
+}
+
+func (failingCodec) Decode(r io.Reader, v any) error {
+	return errEncode
+}
+
+func TestSaveEncodedFailingCodecLeavesNoPartialFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "settings.json")
+	err := resource.SaveEncoded(path, settings{Name: "missing"}, failingCodec{})
+	if !errors.Is(err, errEncode) {
+		t.Fatalf("SaveEncoded = %v, want the error of the codec", err)
+	}
+	if entries := dirEntries(t, dir); len(entries) != 0 {
+		t.Errorf("files = %q, want no partial file", entries)
+	}
+
+	err = resource.SaveEncoded(path, settings{Name: "kept"}, resource.GobCodec())
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := readFile(t, path)
+	err = resource.SaveEncoded(path, settings{Name: "replaced"}, failingCodec{})
+	if !errors.Is(err, errEncode) {
+		t.Fatalf("SaveEncoded = %v, want the error of the codec", err)
+	}
+	if got := readFile(t, path); got != before {
+		t.Error("file changed by a failed save")
+	}
+	if entries := dirEntries(t, dir); len(entries) != 1 {
+		t.Errorf("files = %q, want the saved file only", entries)
+	}
+
+	var got settings
+	err = resource.LoadEncoded(path, &got, failingCodec{})
+	if !errors.Is(err, errEncode) {
+		t.Errorf("LoadEncoded = %v, want the error of the codec", err)
+	}
+}
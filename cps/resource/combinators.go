@@ -0,0 +1,88 @@
+package resource
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// Map derives a resource yielding f's value from r.
+//
+// f may return a finalizer for the derived value, like Flush for a bufio.Writer,
+// which runs after the callback and before r releases its own value:
+// teardown always goes from the inner value to the outer one.
+// The callback, finalizer and release errors are joined.
+func Map[A, B any](r Resource[A], f func(a A) (B, func() error, error)) Resource[B] {
+	return Resource[B]{
+		Use: func(callback func(b B) error) error {
+			return r.Use(func(a A) error {
+				b, finalize, err := f(a)
+				if err != nil {
+					return phaseError(PhaseAcquire, err)
+				}
+				err = callback(b)
+				if finalize != nil {
+					err = errors.Join(err, phaseError(PhaseRelease, finalize()))
+				}
+				return err
+			})
+		},
+	}
+}
+
+// Then acquires the resource made by f from r's value, nested inside r's lifetime.
+func Then[A, B any](r Resource[A], f func(a A) Resource[B]) Resource[B] {
+	return Resource[B]{
+		Use: func(callback func(b B) error) error {
+			return r.Use(func(a A) error {
+				return f(a).Use(callback)
+			})
+		},
+	}
+}
+
+// WithFallback uses secondary when primary could not be acquired with an error accepted by isFallbackable.
+//
+// Only acquisition failures fall back: once the callback ran it may have had side effects,
+// so its error is returned as is. When both acquisitions fail their errors are joined.
+func WithFallback[T any](primary, secondary Resource[T], isFallbackable func(err error) bool) Resource[T] {
+	return Resource[T]{
+		Use: func(callback func(value T) error) error {
+			called := false
+			err := primary.Use(func(value T) error {
+				called = true
+				return callback(value)
+			})
+			if err == nil || called || !isFallbackable(err) {
+				return err
+			}
+
+			primaryErr := err
+			called = false
+			err = secondary.Use(func(value T) error {
+				called = true
+				return callback(value)
+			})
+			if err != nil && !called {
+				return errors.Join(primaryErr, err)
+			}
+			return err
+		},
+	}
+}
+
+// ErrResourceConsumed is returned by the Use calls of a Once resource after the first one.
+var ErrResourceConsumed = errors.New("resource is already consumed")
+
+// Once makes r single-use: only the first Use reaches r, concurrent ones included,
+// the others fail with ErrResourceConsumed.
+func Once[T any](r Resource[T]) Resource[T] {
+	var used atomic.Bool
+	return Resource[T]{
+		Use: func(callback func(value T) error) error {
+			if !used.CompareAndSwap(false, true) {
+				return ErrResourceConsumed
+			}
+			return r.Use(callback)
+		},
+	}
+}
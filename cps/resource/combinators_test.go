@@ -0,0 +1,252 @@
+package resource_test
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+// spy records the lifecycle of its resources.
+type spy struct {
+	events []string
+}
+
+func (s *spy) record(event string) {
+	s.events = append(s.events, event)
+}
+
+// writer is a resource of a buffer recording its acquisition and release, failing the release with releaseErr.
+func (s *spy) writer(buf *bytes.Buffer, releaseErr error) resource.Resource[io.Writer] {
+	return resource.Resource[io.Writer]{
+		Use: func(callback func(w io.Writer) error) error {
+			s.record("acquire")
+			err := callback(&spyWriter{spy: s, w: buf})
+			s.record("release")
+			return errors.Join(err, releaseErr)
+		},
+	}
+}
+
+type spyWriter struct {
+	spy *spy
+	w   io.Writer
+}
+
+func (w *spyWriter) Write(p []byte) (int, error) {
+	w.spy.record("write")
+	return w.w.Write(p)
+}
+
+func TestMapTeardownOrder(t *testing.T) {
+	s := &spy{}
+	errFinalize, errRelease := errors.New("finalize"), errors.New("release")
+	mapped := resource.Map(s.writer(new(bytes.Buffer), errRelease), func(w io.Writer) (string, func() error, error) {
+		s.record("map")
+		return "derived", func() error {
+			s.record("finalize")
+			return errFinalize
+		}, nil
+	})
+
+	err := mapped.Use(func(v string) error {
+		s.record("callback " + v)
+		return nil
+	})
+	if want := []string{"acquire", "map", "callback derived", "finalize", "release"}; !slices.Equal(s.events, want) {
+		t.Errorf("events = %q, want %q", s.events, want)
+	}
+	if !errors.Is(err, errFinalize) || !errors.Is(err, errRelease) {
+		t.Errorf("Use = %v, want the finalizer and release errors joined", err)
+	}
+}
+
+func TestMapFailure(t *testing.T) {
+	s := &spy{}
+	errMap := errors.New("map")
+	mapped := resource.Map(s.writer(new(bytes.Buffer), nil), func(w io.Writer) (int, func() error, error) {
+		return 0, nil, errMap
+	})
+	err := mapped.Use(func(int) error {
+		t.Error("callback called although f failed")
+		return nil
+	})
+	if !errors.Is(err, errMap) || phaseOf(t, err) != resource.PhaseAcquire {
+		t.Errorf("Use = %v, want a PhaseAcquire %v", err, errMap)
+	}
+	if want := []string{"acquire", "release"}; !slices.Equal(s.events, want) {
+		t.Errorf("events = %q, want %q: the outer value is released", s.events, want)
+	}
+}
+
+func TestThen(t *testing.T) {
+	s := &spy{}
+	outer := s.writer(new(bytes.Buffer), nil)
+	inner := new(bytes.Buffer)
+	err := resource.Then(outer, func(w io.Writer) resource.Resource[io.Writer] {
+		return s.writer(inner, nil)
+	}).Use(func(w io.Writer) error {
+		_, err := io.WriteString(w, "inner")
+		return err
+	})
+	if err != nil || inner.String() != "inner" {
+		t.Errorf("Use = %v, inner %q", err, inner.String())
+	}
+	if want := []string{"acquire", "acquire", "write", "release", "release"}; !slices.Equal(s.events, want) {
+		t.Errorf("events = %q, want %q", s.events, want)
+	}
+}
+
+func TestBufferedWriteResourceFlushesBeforeRelease(t *testing.T) {
+	s := &spy{}
+	var buf bytes.Buffer
+	err := resource.NewBufferedWriteResource(s.writer(&buf, nil), 1024).Use(func(w *bufio.Writer) error {
+		_, err := w.WriteString("buffered")
+		s.record("written")
+		return err
+	})
+	if err != nil || buf.String() != "buffered" {
+		t.Errorf("Use = %v, buffer %q", err, buf.String())
+	}
+	if want := []string{"acquire", "written", "write", "release"}; !slices.Equal(s.events, want) {
+		t.Errorf("events = %q, want %q: one flush, before the release", s.events, want)
+	}
+}
+
+func TestGzipWriteResourceClosesBeforeRelease(t *testing.T) {
+	s := &spy{}
+	var buf bytes.Buffer
+	err := resource.NewGzipWriteResource(s.writer(&buf, nil), gzip.BestSpeed).Use(func(zw *gzip.Writer) error {
+		_, err := io.WriteString(zw, "compressed")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := s.events[len(s.events)-1]; last != "release" || s.events[len(s.events)-2] != "write" {
+		t.Errorf("events = %q, want the end of the gzip stream written before the release", s.events)
+	}
+
+	zr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := io.ReadAll(zr)
+	if err != nil || string(content) != "compressed" {
+		t.Errorf("decompressed %q, %v", content, err)
+	}
+
+	err = resource.NewGzipWriteResource(s.writer(new(bytes.Buffer), nil), 42).Use(func(zw *gzip.Writer) error {
+		t.Error("callback called with an invalid level")
+		return nil
+	})
+	if phaseOf(t, err) != resource.PhaseAcquire {
+		t.Errorf("invalid level = %v", err)
+	}
+}
+
+// acquiring is a resource of value, or failing to acquire with err.
+func acquiring(value string, err error) resource.Resource[string] {
+	return resource.Resource[string]{
+		Use: func(callback func(v string) error) error {
+			if err != nil {
+				return err
+			}
+			return callback(value)
+		},
+	}
+}
+
+func TestWithFallback(t *testing.T) {
+	errPrimary, errSecondary, errCallback := errors.New("primary down"), errors.New("secondary down"), errors.New("callback")
+	fallbackable := func(err error) bool { return errors.Is(err, errPrimary) }
+
+	tests := []struct {
+		name               string
+		primary, secondary resource.Resource[string]
+		callbackErr        error
+		used               []string
+		check              func(err error) bool
+	}{
+		{"primary ok", acquiring("primary", nil), acquiring("secondary", nil), nil,
+			[]string{"primary"}, func(err error) bool { return err == nil }},
+		{"primary fails", acquiring("", errPrimary), acquiring("secondary", nil), nil,
+			[]string{"secondary"}, func(err error) bool { return err == nil }},
+		{"both fail", acquiring("", errPrimary), acquiring("", errSecondary), nil,
+			nil, func(err error) bool { return errors.Is(err, errPrimary) && errors.Is(err, errSecondary) }},
+		{"not fallbackable", acquiring("", errSecondary), acquiring("secondary", nil), nil,
+			nil, func(err error) bool { return err == errSecondary }},
+		{"callback fails", acquiring("primary", nil), acquiring("secondary", nil), errPrimary,
+			[]string{"primary"}, func(err error) bool { return err == errPrimary }},
+		{"callback fails on the secondary", acquiring("", errPrimary), acquiring("secondary", nil), errCallback,
+			[]string{"secondary"}, func(err error) bool { return err == errCallback }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var used []string
+			err := resource.WithFallback(test.primary, test.secondary, fallbackable).Use(func(v string) error {
+				used = append(used, v)
+				return test.callbackErr
+			})
+			if !test.check(err) {
+				t.Errorf("Use = %v", err)
+			}
+			if !slices.Equal(used, test.used) {
+				t.Errorf("callback used %q, want %q", used, test.used)
+			}
+		})
+	}
+}
+
+func TestOnce(t *testing.T) {
+	acquisitions := 0
+	r := resource.Once(resource.Resource[int]{
+		Use: func(callback func(int) error) error {
+			acquisitions++
+			return callback(acquisitions)
+		},
+	})
+	err := r.Use(func(v int) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = r.Use(func(int) error {
+		t.Error("callback called by the second Use")
+		return nil
+	})
+	if !errors.Is(err, resource.ErrResourceConsumed) || acquisitions != 1 {
+		t.Errorf("second Use = %v after %d acquisitions, want %v after 1", err, acquisitions, resource.ErrResourceConsumed)
+	}
+}
+
+func TestOnceConcurrent(t *testing.T) {
+	var acquisitions, consumed atomic.Int64
+	r := resource.Once(resource.Resource[int]{
+		Use: func(callback func(int) error) error {
+			acquisitions.Add(1)
+			return callback(0)
+		},
+	})
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := r.Use(func(int) error { return nil })
+			if errors.Is(err, resource.ErrResourceConsumed) {
+				consumed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if acquisitions.Load() != 1 || consumed.Load() != 19 {
+		t.Errorf("%d acquisitions and %d ErrResourceConsumed, want 1 and 19", acquisitions.Load(), consumed.Load())
+	}
+}
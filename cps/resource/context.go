@@ -0,0 +1,148 @@
+package resource
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// WithSignalContext returns a root context resource: the context is cancelled
+// when one of the signals arrives (SIGINT and SIGTERM by default).
+// Default signal handling is restored when the callback returns.
+func WithSignalContext(signals ...os.Signal) Resource[context.Context] {
+	if len(signals) == 0 {
+		signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	return Resource[context.Context]{
+		Use: func(callback func(ctx context.Context) error) error {
+			ctx, stop := signal.NotifyContext(context.Background(), signals...)
+			defer stop()
+
+			return useCallback(callback, ctx)
+		},
+	}
+}
+
+// WithContext makes r give up on ctx: the callback is not called when ctx is done already,
+// and a successful callback returns ctx.Err() (as a PhaseUse error) when ctx got done meanwhile,
+// so the resource treats the work as failed and rolls back what it can.
+func WithContext[T any](ctx context.Context, r Resource[T]) Resource[T] {
+	return Resource[T]{
+		Use: func(callback func(value T) error) error {
+			err := ctx.Err()
+			if err != nil {
+				return phaseError(PhaseAcquire, err)
+			}
+			return r.Use(func(value T) error {
+				err := callback(value)
+				if err != nil {
+					return err
+				}
+				return phaseError(PhaseUse, ctx.Err())
+			})
+		},
+	}
+}
+
+// NewDBResourceCtx is NewDBResource which also pings the database with ctx
+// and gives up on ctx like WithContext does.
+func NewDBResourceCtx[S string | DSN](ctx context.Context, driverName string, datasource S, opts ...DBOption) DBResource {
+	inner := NewDBResource(driverName, datasource, opts...)
+	db := WithContext(ctx, FromUsable(inner))
+	return DB(Resource[*sql.DB]{
+		Description: inner.Describe(),
+		Use: func(callback func(db *sql.DB) error) error {
+			var pingErr error
+			err := db.Use(func(db *sql.DB) error {
+				pingErr = db.PingContext(ctx)
+				if pingErr != nil {
+					return pingErr
+				}
+				return callback(db)
+			})
+			if pingErr != nil {
+				return phaseError(PhaseAcquire, err)
+			}
+			return err
+		},
+	})
+}
+
+// NewFileResourceCtx is NewFileResource which gives up on ctx like WithContext does.
+func NewFileResourceCtx(ctx context.Context, path string, flags int, perm os.FileMode, opts ...FileOption) FileResource {
+	file := NewFileResource(path, flags, perm, opts...)
+	return newFileResource(file.Describe(), func(callback FileResourceCallback) error {
+		err := ctx.Err()
+		if err != nil {
+			return phaseError(PhaseAcquire, err)
+		}
+		return file.Use(func(fd *os.File) error {
+			err := callback(fd)
+			if err != nil {
+				return err
+			}
+			return phaseError(PhaseUse, ctx.Err())
+		})
+	})
+}
+
+// RunTransactionCtx is RunTransaction with the transaction begun with ctx:
+// database/sql rolls it back as soon as ctx is done, the statements and Commit then fail;
+// a callback failing with their sql.ErrTxDone fails the Use with it joined with the context error.
+func RunTransactionCtx(ctx context.Context, db *sql.DB, opts ...TxOption) TxResource {
+	options := newTxOptions(opts)
+	return TxResource{
+		Use: func(callback func(tx *sql.Tx) error) error {
+			end := startSpan(options.tracer, "resource.tx")
+			err := runTransaction(ctx, db, &options, callback)
+			end(err)
+			return checkResult(err, "tx")
+		},
+	}
+}
+
+// WithCancel gives fn a child context of parent, cancelled when fn returns
+// even if goroutines started by fn still hold it.
+//
+// This and WithDeadline and WithTimeout are the way to scope the ctx-aware resources:
+//
+//	err := WithTimeout(ctx, time.Minute, func(ctx context.Context) error {
+//		return RunTransactionCtx(ctx, db).Use(...)
+//	})
+func WithCancel(parent context.Context, fn func(ctx context.Context) error) error {
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	return fn(ctx)
+}
+
+// WithDeadline is WithCancel with a context ending at deadline.
+// When the deadline passes before fn returns, context.DeadlineExceeded is joined with fn's error
+// (unless fn's error is one already).
+func WithDeadline(parent context.Context, deadline time.Time, fn func(ctx context.Context) error) error {
+	ctx, cancel := context.WithDeadline(parent, deadline)
+	defer cancel()
+
+	return deadlineError(ctx, fn(ctx))
+}
+
+// WithTimeout is WithDeadline ending d from now.
+func WithTimeout(parent context.Context, d time.Duration, fn func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(parent, d)
+	defer cancel()
+
+	return deadlineError(ctx, fn(ctx))
+}
+
+// deadlineError joins context.DeadlineExceeded with err when the deadline of ctx passed,
+// unless err is one already.
+func deadlineError(ctx context.Context, err error) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) && !errors.Is(err, context.DeadlineExceeded) {
+		return errors.Join(err, ctx.Err())
+	}
+	return err
+}
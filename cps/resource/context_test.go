@@ -0,0 +1,142 @@
+package resource_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/group"
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+func TestRunGroupCtxRollsBackSlowTasks(t *testing.T) {
+	db := openDB(t)
+	path := filepath.Join(t.TempDir(), "slow.txt")
+	errBoom := errors.New("boom")
+	started := make(chan struct{}, 2)
+
+	err := group.RunGroupCtx(context.Background(), func(ctx context.Context, s group.ErrSpawner) error {
+		group.RunCtxErr(s, ctx, func(ctx context.Context) error {
+			return resource.RunTransactionCtx(ctx, db).Use(func(tx *sql.Tx) error {
+				err := insertItem(tx, "partial")
+				if err != nil {
+					return err
+				}
+				started <- struct{}{}
+				<-ctx.Done() // slow work, stopped by the failure
+				return insertItem(tx, "never")
+			})
+		})
+		group.RunCtxErr(s, ctx, func(ctx context.Context) error {
+			return resource.NewFileResourceCtx(ctx, path, os.O_CREATE|os.O_WRONLY, 0o644).Use(func(file *os.File) error {
+				started <- struct{}{}
+				<-ctx.Done()
+				return nil // the context error fails the Use anyway
+			})
+		})
+		group.RunCtxErr(s, ctx, func(ctx context.Context) error {
+			<-started
+			<-started
+			return errBoom // fails fast once the others are busy
+		})
+		return nil
+	})
+
+	if joined, ok := err.(interface{ Unwrap() []error }); !ok || len(joined.Unwrap()) != 1 || !errors.Is(err, errBoom) {
+		t.Errorf("RunGroupCtx = %v, want %v alone", err, errBoom)
+	}
+	if n := countItems(t, db); n != 0 {
+		t.Errorf("%d rows committed by the cancelled transaction", n)
+	}
+}
+
+func TestWithCancelKillsContextOnReturn(t *testing.T) {
+	held := make(chan context.Context, 1)
+	err := resource.WithCancel(context.Background(), func(ctx context.Context) error {
+		go func() {
+			held <- ctx // still holding it after fn returned
+		}()
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := <-held
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("context of WithCancel alive after it returned")
+	}
+
+	errBoom := errors.New("boom")
+	err = resource.WithCancel(context.Background(), func(ctx context.Context) error {
+		held <- ctx
+		return errBoom
+	})
+	if err != errBoom || (<-held).Err() == nil {
+		t.Errorf("WithCancel = %v, want the error of fn and its context cancelled", err)
+	}
+}
+
+func TestWithTimeoutOverrun(t *testing.T) {
+	errBoom := errors.New("boom")
+	var kept context.Context
+	err := resource.WithTimeout(context.Background(), time.Millisecond, func(ctx context.Context) error {
+		kept = ctx
+		<-ctx.Done()
+		return errBoom
+	})
+	if !errors.Is(err, errBoom) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("WithTimeout = %v, want the error of fn joined with context.DeadlineExceeded", err)
+	}
+	if kept.Err() == nil {
+		t.Error("context of WithTimeout alive after it returned")
+	}
+
+	err = resource.WithTimeout(context.Background(), time.Millisecond, func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("WithTimeout = %v after a silent overrun, want context.DeadlineExceeded", err)
+	}
+
+	err = resource.WithTimeout(context.Background(), time.Millisecond, func(ctx context.Context) error {
+		<-ctx.Done()
+		return fmt.Errorf("query: %w", ctx.Err())
+	})
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		t.Errorf("WithTimeout = %v joined %d errors, want the error of fn as is", err, len(joined.Unwrap()))
+	}
+
+	err = resource.WithTimeout(context.Background(), time.Hour, func(ctx context.Context) error {
+		kept = ctx
+		return nil
+	})
+	if err != nil || kept.Err() != context.Canceled {
+		t.Errorf("WithTimeout = %v, context %v, want nil and cancelled on return", err, kept.Err())
+	}
+}
+
+func TestWithDeadline(t *testing.T) {
+	err := resource.WithDeadline(context.Background(), time.Now().Add(-time.Second), func(ctx context.Context) error {
+		return nil
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("WithDeadline in the past = %v, want context.DeadlineExceeded", err)
+	}
+
+	parent, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = resource.WithDeadline(parent, time.Now().Add(time.Hour), func(ctx context.Context) error {
+		return ctx.Err()
+	})
+	if err != context.Canceled {
+		t.Errorf("WithDeadline with a cancelled parent = %v, want context.Canceled alone", err)
+	}
+}
@@ -0,0 +1,50 @@
+//go:build unix
+
+package resource_test
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+// signalled sends sig to the test process and waits for ctx to be cancelled.
+func signalled(t *testing.T, ctx context.Context, sig syscall.Signal) {
+	t.Helper()
+	if ctx.Err() != nil {
+		t.Fatal("context cancelled before the signal")
+	}
+	err := syscall.Kill(os.Getpid(), sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("context not cancelled by %v", sig)
+	}
+}
+
+func TestWithSignalContext(t *testing.T) {
+	err := resource.WithSignalContext(syscall.SIGUSR1).Use(func(ctx context.Context) error {
+		signalled(t, ctx, syscall.SIGUSR1)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWithSignalContextDefaultsToTerm(t *testing.T) {
+	err := resource.WithSignalContext().Use(func(ctx context.Context) error {
+		signalled(t, ctx, syscall.SIGTERM)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
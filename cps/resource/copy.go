@@ -0,0 +1,99 @@
+package resource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+var (
+	// ErrSameFile is returned when copying a file onto itself.
+	ErrSameFile = errors.New("source and destination are the same file")
+	// ErrIsDirectory is returned when the source of a copy is a directory.
+	ErrIsDirectory = errors.New("is a directory")
+)
+
+// CopyFile copies src to dst, see CopyFileN.
+func CopyFile(src, dst string, perm os.FileMode) error {
+	_, err := CopyFileN(src, dst, perm)
+	return err
+}
+
+// CopyFileN copies src to dst and returns the number of bytes copied.
+// dst is written with NewAtomicFileResource, so a failed copy leaves it untouched.
+func CopyFileN(src, dst string, perm os.FileMode) (int64, error) {
+	return CopyFileCtx(context.Background(), src, dst, perm)
+}
+
+// CopyFileCtx is CopyFileN which gives up on ctx between chunks of DefaultCopyChunk bytes, like CopyCtx does,
+// leaving dst untouched. The number of bytes copied before is returned with ctx.Err().
+func CopyFileCtx(ctx context.Context, src, dst string, perm os.FileMode) (int64, error) {
+	var copied int64
+	err := NewFileResource(src, os.O_RDONLY, 0).Use(func(in *os.File) error {
+		srcInfo, err := in.Stat()
+		if err != nil {
+			return err
+		}
+		if srcInfo.IsDir() {
+			return fmt.Errorf("copy %s: %w", src, ErrIsDirectory)
+		}
+		dstInfo, err := os.Stat(dst)
+		if err == nil && os.SameFile(srcInfo, dstInfo) {
+			return fmt.Errorf("copy %s to %s: %w", src, dst, ErrSameFile)
+		}
+
+		return NewAtomicFileResource(dst, perm).Use(func(out *os.File) error {
+			copied, err = CopyCtx(ctx, out, copySource(in), 0)
+			return err
+		})
+	})
+	return copied, err
+}
+
+// copySource is the reader CopyFileCtx copies in from, replaced by tests failing the copy partway.
+var copySource = func(in *os.File) io.Reader {
+	return in
+}
+
+// DefaultCopyChunk is the chunk size of CopyCtx. Copying a file in chunks of 1MiB
+// costs about the same as io.Copy does.
+const DefaultCopyChunk = 1 << 20
+
+// CopyCtx is io.Copy which checks ctx before every chunk of chunk bytes (DefaultCopyChunk when 0 or less)
+// and stops with ctx.Err() once it's done, returning the number of bytes copied so far.
+// With a ctx which can't be cancelled it is io.Copy.
+func CopyCtx(ctx context.Context, dst io.Writer, src io.Reader, chunk int) (int64, error) {
+	if ctx.Done() == nil {
+		return io.Copy(dst, src)
+	}
+	if chunk <= 0 {
+		chunk = DefaultCopyChunk
+	}
+	buf := make([]byte, chunk)
+	var copied int64
+	for {
+		err := ctx.Err()
+		if err != nil {
+			return copied, err
+		}
+		n, err := io.ReadFull(src, buf)
+		if n > 0 {
+			written, writeErr := dst.Write(buf[:n])
+			copied += int64(written)
+			if writeErr != nil {
+				return copied, writeErr
+			}
+			if written != n {
+				return copied, io.ErrShortWrite
+			}
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return copied, nil
+		}
+		if err != nil {
+			return copied, err
+		}
+	}
+}
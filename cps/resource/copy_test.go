@@ -0,0 +1,277 @@
+package resource_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+func randomBytes(size int) []byte {
+	data := make([]byte, size)
+	r := rand.NewChaCha8([32]byte{})
+	r.Read(data)
+	return data
+}
+
+func TestCopyFileLarge(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "src.bin"), filepath.Join(dir, "dst.bin")
+	data := randomBytes(5<<20 + 123)
+	if err := os.WriteFile(src, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := resource.CopyFileN(src, dst, 0o640)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(data)) {
+		t.Errorf("copied %d bytes, want %d", n, len(data))
+	}
+	copied, err := os.ReadFile(dst)
+	if err != nil || !bytes.Equal(copied, data) {
+		t.Errorf("copy differs from the source: %v", err)
+	}
+	info, err := os.Stat(dst)
+	if err != nil || info.Mode().Perm() != 0o640 {
+		t.Errorf("copy mode = %v, %v, want 0640", info.Mode(), err)
+	}
+}
+
+func TestCopyFileFailures(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "src.txt"), filepath.Join(dir, "dst.txt")
+	if err := os.WriteFile(src, []byte("source"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dst, []byte("kept"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	err := resource.CopyFile(src, src, 0o644)
+	if !errors.Is(err, resource.ErrSameFile) {
+		t.Errorf("copy onto itself = %v, want %v", err, resource.ErrSameFile)
+	}
+	if err := os.Link(src, filepath.Join(dir, "link.txt")); err == nil {
+		err = resource.CopyFile(src, filepath.Join(dir, "link.txt"), 0o644)
+		if !errors.Is(err, resource.ErrSameFile) {
+			t.Errorf("copy onto a hard link = %v, want %v", err, resource.ErrSameFile)
+		}
+	}
+
+	err = resource.CopyFile(dir, dst, 0o644)
+	if !errors.Is(err, resource.ErrIsDirectory) {
+		t.Errorf("copy of a directory = %v, want %v", err, resource.ErrIsDirectory)
+	}
+
+	err = resource.CopyFile(filepath.Join(dir, "missing"), dst, 0o644)
+	if !errors.Is(err, os.ErrNotExist) || phaseOf(t, err) != resource.PhaseAcquire {
+		t.Errorf("copy of a missing file = %v", err)
+	}
+
+	if got := readFile(t, dst); got != "kept" {
+		t.Errorf("destination = %q after the failed copies, want it untouched", got)
+	}
+	if got := readFile(t, src); got != "source" {
+		t.Errorf("source = %q after copying it onto itself", got)
+	}
+}
+
+// failingReader reads r up to after bytes, then fails with err.
+type failingReader struct {
+	r     io.Reader
+	after int64
+	err   error
+}
+
+func (f *failingReader) Read(p []byte) (int, error) {
+	if f.after <= 0 {
+		return 0, f.err
+	}
+	if int64(len(p)) > f.after {
+		p = p[:f.after]
+	}
+	n, err := f.r.Read(p)
+	f.after -= int64(n)
+	return n, err
+}
+
+func TestCopyFileFailsPartway(t *testing.T) {
+	errRead := errors.New("read failed")
+	const failAfter = resource.DefaultCopyChunk + 100
+	resource.SetCopySource(t, func(in *os.File) io.Reader {
+		return &failingReader{r: in, after: failAfter, err: errRead}
+	})
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.bin")
+	if err := os.WriteFile(src, randomBytes(3*resource.DefaultCopyChunk), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	kept := filepath.Join(dir, "kept.bin")
+	writeFile(t, kept, "kept")
+
+	for _, dst := range []string{filepath.Join(dir, "missing.bin"), kept} {
+		copied, err := resource.CopyFileN(src, dst, 0o644)
+		if !errors.Is(err, errRead) {
+			t.Fatalf("CopyFileN to %s = %v, want the read error", dst, err)
+		}
+		if copied != failAfter {
+			t.Errorf("CopyFileN to %s copied %d bytes, want the %d read before the error", dst, copied, failAfter)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "missing.bin")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("destination created by the failed copy: %v", err)
+	}
+	if got := readFile(t, kept); got != "kept" {
+		t.Errorf("destination = %q after the failed copy, want it untouched", got)
+	}
+	if entries := dirEntries(t, dir); len(entries) != 2 {
+		t.Errorf("files = %q, want no temporary file left", entries)
+	}
+}
+
+// zeros is an endless stream of zero bytes.
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+// cancellingReader reads r, calling cancel once it has read more than after bytes.
+type cancellingReader struct {
+	r      io.Reader
+	read   int64
+	after  int64
+	cancel func()
+}
+
+func (c *cancellingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.read += int64(n)
+	if c.read > c.after {
+		c.cancel()
+	}
+	return n, err
+}
+
+// countingWriter counts the bytes written to it.
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+func TestCopyCtxCancelledMidCopy(t *testing.T) {
+	const size, cancelAfter = 50 << 20, 10 << 20
+	ctx, cancel := context.WithCancel(context.Background())
+	src := &cancellingReader{r: io.LimitReader(zeros{}, size), after: cancelAfter, cancel: cancel}
+	var dst countingWriter
+
+	started := time.Now()
+	copied, err := resource.CopyCtx(ctx, &dst, src, 0)
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Errorf("CopyCtx returned after %v, want it to stop promptly", elapsed)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("CopyCtx = %d, %v, want context.Canceled", copied, err)
+	}
+	// the chunk read when cancelled is written, the next one isn't read
+	if want := int64(cancelAfter + resource.DefaultCopyChunk); copied != want || dst.n != copied {
+		t.Errorf("copied %d bytes, %d written, want %d", copied, dst.n, want)
+	}
+}
+
+func TestCopyCtxChunks(t *testing.T) {
+	data := randomBytes(10_000)
+	for _, chunk := range []int{1, 7, 4096, 10_000, 1 << 20} {
+		var dst bytes.Buffer
+		ctx, cancel := context.WithCancel(context.Background())
+		copied, err := resource.CopyCtx(ctx, &dst, bytes.NewReader(data), chunk)
+		cancel()
+		if err != nil || copied != int64(len(data)) || !bytes.Equal(dst.Bytes(), data) {
+			t.Errorf("chunk %d: CopyCtx = %d, %v, want the whole copy", chunk, copied, err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	copied, err := resource.CopyCtx(ctx, io.Discard, bytes.NewReader(data), 0)
+	if copied != 0 || !errors.Is(err, context.Canceled) {
+		t.Errorf("CopyCtx of a cancelled context = %d, %v", copied, err)
+	}
+}
+
+func TestCopyFileCtxCancelledKeepsDestination(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "src.bin"), filepath.Join(dir, "dst.bin")
+	if err := os.WriteFile(src, randomBytes(3*resource.DefaultCopyChunk), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, dst, "kept")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := resource.CopyFileCtx(ctx, src, dst, 0o644)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("CopyFileCtx = %v, want context.Canceled", err)
+	}
+	if got := readFile(t, dst); got != "kept" {
+		t.Errorf("destination = %q after the cancelled copy, want it untouched", got)
+	}
+	if entries := dirEntries(t, dir); len(entries) != 2 {
+		t.Errorf("files = %q, want no temporary file left", entries)
+	}
+}
+
+// benchmarkCopy copies a 64MiB file to another with copy, per op.
+func benchmarkCopy(b *testing.B, copy func(dst io.Writer, src io.Reader) (int64, error)) {
+	const size = 64 << 20
+	dir := b.TempDir()
+	src := filepath.Join(dir, "src.bin")
+	if err := os.WriteFile(src, randomBytes(size), 0o644); err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(size)
+	b.ResetTimer()
+	for range b.N {
+		err := resource.NewFileResource(src, os.O_RDONLY, 0).Use(func(in *os.File) error {
+			return resource.NewFileResource(filepath.Join(dir, "dst.bin"), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644).Use(func(out *os.File) error {
+				// hides the io.ReaderFrom of the file, which io.Copy would use instead of a buffer
+				_, err := copy(struct{ io.Writer }{out}, in)
+				return err
+			})
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkIOCopy(b *testing.B) {
+	benchmarkCopy(b, io.Copy)
+}
+
+func BenchmarkCopyCtx(b *testing.B) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for _, chunk := range []int{32 << 10, resource.DefaultCopyChunk} {
+		b.Run(fmt.Sprintf("chunk=%d", chunk), func(b *testing.B) {
+			benchmarkCopy(b, func(dst io.Writer, src io.Reader) (int64, error) {
+				return resource.CopyCtx(ctx, dst, src, chunk)
+			})
+		})
+	}
+}
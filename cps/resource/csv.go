@@ -0,0 +1,135 @@
+package resource
+
+import (
+	"encoding/csv"
+	"errors"
+	"os"
+)
+
+// CSVFailureMode decides what happens to the file when the callback fails.
+type CSVFailureMode int
+
+const (
+	CSVRemoveOnError CSVFailureMode = iota
+	CSVTruncateOnError
+)
+
+type csvOptions struct {
+	comma   rune
+	header  []string
+	onError CSVFailureMode
+	atomic  bool
+}
+
+// CSVOption configures NewCSVFileResource.
+type CSVOption func(options *csvOptions)
+
+// CSVComma sets the field delimiter, ',' by default.
+func CSVComma(comma rune) CSVOption {
+	return func(options *csvOptions) {
+		options.comma = comma
+	}
+}
+
+// CSVHeader writes the header row before the callback is called.
+func CSVHeader(columns ...string) CSVOption {
+	return func(options *csvOptions) {
+		options.header = columns
+	}
+}
+
+// CSVOnError chooses between removing (default) and truncating the file when the callback fails.
+func CSVOnError(mode CSVFailureMode) CSVOption {
+	return func(options *csvOptions) {
+		options.onError = mode
+	}
+}
+
+// CSVAtomic writes the file like NewAtomicFileResource does: into a temporary file renamed to path
+// on success only, so a failure leaves the previous file, if any, as it was. CSVOnError is ignored then.
+func CSVAtomic() CSVOption {
+	return func(options *csvOptions) {
+		options.atomic = true
+	}
+}
+
+// NewCSVFileResource creates (or truncates) the file and gives the callback a csv.Writer over it.
+//
+// csv.Writer buffers and reveals write errors only via Flush and Error,
+// so on success the resource flushes and checks w.Error() before closing the file.
+// On failure nothing is flushed and the file is removed or truncated.
+func NewCSVFileResource(path string, perm os.FileMode, opts ...CSVOption) Resource[*csv.Writer] {
+	options := csvOptions{comma: ','}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	if options.atomic {
+		atomicFile := NewAtomicFileResource(path, perm)
+		return Resource[*csv.Writer]{
+			Use: func(callback func(w *csv.Writer) error) error {
+				return atomicFile.Use(func(file *os.File) error {
+					w := options.newWriter(file)
+					err := options.writeHeader(w)
+					if err == nil {
+						err = useCallback(callback, w)
+					}
+					if err != nil {
+						return phaseError(PhaseUse, err)
+					}
+					w.Flush()
+					return phaseError(PhaseRelease, w.Error())
+				})
+			},
+		}
+	}
+
+	return Resource[*csv.Writer]{
+		Use: func(callback func(w *csv.Writer) error) error {
+			file, err := os.OpenFile(path, NewFileFlag|os.O_TRUNC, perm)
+			if err != nil {
+				return phaseError(PhaseAcquire, err)
+			}
+
+			w := options.newWriter(file)
+			err = options.writeHeader(w)
+			if err == nil {
+				err = useCallback(callback, w)
+			}
+			if err != nil {
+				closeErr := file.Close()
+				err = errors.Join(phaseError(PhaseUse, err), options.discard(path))
+				return secondaryError(err, "csv "+path, phaseError(PhaseRelease, closeErr))
+			}
+
+			w.Flush()
+			err = w.Error()
+			if err != nil {
+				closeErr := file.Close()
+				err = errors.Join(phaseError(PhaseRelease, err), options.discard(path))
+				return secondaryError(err, "csv "+path, phaseError(PhaseRelease, closeErr))
+			}
+			return phaseError(PhaseRelease, file.Close())
+		},
+	}
+}
+
+func (options *csvOptions) discard(path string) error {
+	if options.onError == CSVTruncateOnError {
+		return phaseError(PhaseRelease, os.Truncate(path, 0))
+	}
+	return phaseError(PhaseRelease, os.Remove(path))
+}
+
+func (options *csvOptions) newWriter(file *os.File) *csv.Writer {
+	w := csv.NewWriter(file)
+	w.Comma = options.comma
+	return w
+}
+
+func (options *csvOptions) writeHeader(w *csv.Writer) error {
+	if options.header == nil {
+		return nil
+	}
+	return w.Write(options.header)
+}
@@ -0,0 +1,98 @@
+package resource_test
+
+import (
+	"encoding/csv"
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestCSVFileResourceRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "items.csv")
+	err := resource.NewCSVFileResource(path, 0o644, resource.CSVComma(';'), resource.CSVHeader("id", "name")).Use(func(w *csv.Writer) error {
+		return w.WriteAll([][]string{{"1", "a;b"}, {"2", "c"}})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := readFile(t, path), "id;name\n1;\"a;b\"\n2;c\n"; got != want {
+		t.Errorf("file = %q, want %q", got, want)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.Comma = ';'
+	records, err := r.ReadAll()
+	if err != nil || len(records) != 3 || records[1][1] != "a;b" {
+		t.Errorf("records = %q, %v", records, err)
+	}
+}
+
+func TestCSVFileResourceOnError(t *testing.T) {
+	errBoom := errors.New("boom")
+	fail := func(w *csv.Writer) error {
+		w.Write([]string{"never", "flushed"})
+		return errBoom
+	}
+
+	removed := filepath.Join(t.TempDir(), "removed.csv")
+	err := resource.NewCSVFileResource(removed, 0o644).Use(fail)
+	if !errors.Is(err, errBoom) || phaseOf(t, err) != resource.PhaseUse {
+		t.Errorf("Use = %v", err)
+	}
+	if _, err := os.Stat(removed); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("file of a failed callback not removed: %v", err)
+	}
+
+	truncated := filepath.Join(t.TempDir(), "truncated.csv")
+	err = resource.NewCSVFileResource(truncated, 0o644, resource.CSVOnError(resource.CSVTruncateOnError)).Use(fail)
+	if !errors.Is(err, errBoom) {
+		t.Errorf("Use = %v", err)
+	}
+	if got := readFile(t, truncated); got != "" {
+		t.Errorf("file of a failed callback = %q, want it truncated", got)
+	}
+
+	atomic := filepath.Join(t.TempDir(), "atomic.csv")
+	if err := os.WriteFile(atomic, []byte("previous\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	err = resource.NewCSVFileResource(atomic, 0o644, resource.CSVAtomic()).Use(fail)
+	if !errors.Is(err, errBoom) {
+		t.Errorf("Use = %v", err)
+	}
+	if got := readFile(t, atomic); got != "previous\n" {
+		t.Errorf("atomic file of a failed callback = %q, want it untouched", got)
+	}
+}
+
+func TestCSVFileResourceFlushError(t *testing.T) {
+	// every write to /dev/full fails with ENOSPC, which only the flush reveals;
+	// truncating rather than removing it on failure leaves the device alone
+	if _, err := os.Stat("/dev/full"); err != nil {
+		t.Skip("no /dev/full")
+	}
+	err := resource.NewCSVFileResource("/dev/full", 0o644, resource.CSVOnError(resource.CSVTruncateOnError)).Use(func(w *csv.Writer) error {
+		return w.Write([]string{"lost"})
+	})
+	if !errors.Is(err, syscall.ENOSPC) || phaseOf(t, err) != resource.PhaseRelease {
+		t.Errorf("Use = %v, want the ENOSPC of the flush", err)
+	}
+}
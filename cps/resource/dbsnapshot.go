@@ -0,0 +1,68 @@
+package resource
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// ErrReadOnlySnapshot is returned by the ExecContext of the Queryer of WithSnapshot.
+var ErrReadOnlySnapshot = errors.New("exec in a read-only snapshot")
+
+// SnapshotStrategy is how WithSnapshot gets a consistent view of the database, per driver in Capabilities.
+type SnapshotStrategy int
+
+const (
+	// SnapshotReadOnlyTx is a READ ONLY transaction of REPEATABLE READ isolation, a snapshot in Postgres and MySQL.
+	// It's the default for the drivers of unknown capabilities.
+	SnapshotReadOnlyTx SnapshotStrategy = iota
+	// SnapshotDeferredTx is a plain transaction, for SQLite whose deferred transactions read
+	// a single snapshot from their first SELECT on and don't take isolation options.
+	SnapshotDeferredTx
+)
+
+// WithSnapshot runs fn with a Queryer whose SELECTs all see the same state of db, the strongest
+// cheap way the driver of db allows (see SnapshotStrategy), whatever is committed meanwhile.
+// The transaction is always rolled back; its ExecContext fails with ErrReadOnlySnapshot.
+func WithSnapshot(db *sql.DB, fn func(q Queryer) error) error {
+	var opts *sql.TxOptions
+	if _, caps, ok := CapabilitiesOf(db); !ok || caps.Snapshot == SnapshotReadOnlyTx {
+		opts = &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true}
+	}
+
+	id := txIDs.Add(1)
+	tx, err := db.BeginTx(context.Background(), opts)
+	if err != nil {
+		return describedError(PhaseAcquire, describeTx(id), err)
+	}
+	open := trackOpenAs("tx", "tx", id)
+	defer open.release()
+	q := snapshotQueryer{tx}
+	bindDriverOf(q, db)
+	defer unbindDriver(q)
+
+	err = fn(q)
+	rollbackErr := tx.Rollback()
+	if err == nil {
+		return describedError(PhaseRelease, describeTx(id), rollbackErr)
+	}
+	return secondaryError(err, describeTx(id), describedError(PhaseRelease, describeTx(id), rollbackErr))
+}
+
+// snapshotQueryer is the read side of a snapshot transaction.
+type snapshotQueryer struct {
+	tx *sql.Tx
+}
+
+func (q snapshotQueryer) ExecContext(_ context.Context, query string, _ ...any) (sql.Result, error) {
+	return nil, fmt.Errorf("%w: %s", ErrReadOnlySnapshot, truncateQuery(query))
+}
+
+func (q snapshotQueryer) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return q.tx.QueryContext(ctx, query, args...)
+}
+
+func (q snapshotQueryer) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return q.tx.QueryRowContext(ctx, query, args...)
+}
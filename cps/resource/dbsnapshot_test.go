@@ -0,0 +1,105 @@
+package resource_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+	"github.com/Q69K/using-cps-in-golang/cps/resource/resourcetest"
+)
+
+// useSnapshotDB runs fn with an items database of WAL journal, where a writer commits alongside a snapshot.
+func useSnapshotDB(t *testing.T, driverName string, fn func(db *sql.DB) error) {
+	t.Helper()
+	err := resource.NewDBResource(driverName, filepath.Join(t.TempDir(), "test.db")).Use(func(db *sql.DB) error {
+		_, err := db.Exec("PRAGMA journal_mode = WAL")
+		if err == nil {
+			_, err = db.Exec("CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT NOT NULL)")
+		}
+		if err == nil {
+			_, err = db.Exec("INSERT INTO items (name) VALUES ('a'), ('b')")
+		}
+		if err != nil {
+			return err
+		}
+		return fn(db)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWithSnapshotIsConsistent(t *testing.T) {
+	// both strategies work with sqlite, the read-only transaction of the drivers of unknown capabilities too
+	for _, strategy := range []string{"deferred", "unknown driver"} {
+		t.Run(strategy, func(t *testing.T) {
+			driver, name := countingSQLite(t)
+			if strategy == "deferred" {
+				resource.RegisterCapabilities(name, resource.Capabilities{Snapshot: resource.SnapshotDeferredTx})
+			}
+			testSnapshotConsistent(t, driver, name)
+		})
+	}
+}
+
+func testSnapshotConsistent(t *testing.T, driver *resourcetest.CountingDriver, name string) {
+	useSnapshotDB(t, name, func(db *sql.DB) error {
+		var before, after, last int64
+		err := resource.WithSnapshot(db, func(q resource.Queryer) error {
+			err := q.QueryRowContext(context.Background(), "SELECT count(*) FROM items").Scan(&before)
+			if err != nil {
+				return err
+			}
+			// committed by another connection in the middle of the snapshot
+			_, err = db.Exec("INSERT INTO items (name) VALUES ('c')")
+			if err != nil {
+				return err
+			}
+			err = q.QueryRowContext(context.Background(), "SELECT count(*) FROM items").Scan(&after)
+			if err != nil {
+				return err
+			}
+			return q.QueryRowContext(context.Background(), "SELECT max(id) FROM items").Scan(&last)
+		})
+		if err != nil {
+			return err
+		}
+		if before != 2 || after != 2 || last != 2 {
+			t.Errorf("snapshot saw %d rows, then %d with the last id %d, want the 2 rows before the insert", before, after, last)
+		}
+		if n := countItems(t, db); n != 3 {
+			t.Errorf("%d items after the snapshot, want the insert committed", n)
+		}
+		if counts := driver.Counts(); counts.Begins != 1 || counts.Rollbacks != 1 || counts.Commits != 0 {
+			t.Errorf("counts = %+v, want the snapshot rolled back", counts)
+		}
+		return nil
+	})
+}
+
+func TestWithSnapshotRejectsExec(t *testing.T) {
+	driver, name := countingSQLite(t)
+	resource.RegisterCapabilities(name, resource.Capabilities{Snapshot: resource.SnapshotDeferredTx})
+	useSnapshotDB(t, name, func(db *sql.DB) error {
+		err := resource.WithSnapshot(db, func(q resource.Queryer) error {
+			_, err := q.ExecContext(context.Background(), "INSERT INTO items (name) VALUES ('c')")
+			return err
+		})
+		if !errors.Is(err, resource.ErrReadOnlySnapshot) {
+			t.Errorf("WithSnapshot = %v, want ErrReadOnlySnapshot", err)
+		}
+		if got, want := err.Error(), "exec in a read-only snapshot: INSERT INTO items (name) VALUES ('c')"; got != want {
+			t.Errorf("Error = %q, want %q", got, want)
+		}
+		if n := countItems(t, db); n != 2 {
+			t.Errorf("%d items, want the exec rejected", n)
+		}
+		if counts := driver.Counts(); counts.Rollbacks != 1 {
+			t.Errorf("counts = %+v, want the snapshot rolled back", counts)
+		}
+		return nil
+	})
+}
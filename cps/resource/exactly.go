@@ -0,0 +1,80 @@
+package resource
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrNoRows is matched by the *RowsCountError of a query which returned no row, as is sql.ErrNoRows.
+	ErrNoRows = errors.New("no rows")
+	// ErrTooFewRows is matched by the *RowsCountError of a query which returned some rows, but not enough.
+	ErrTooFewRows = errors.New("too few rows")
+	// ErrTooManyRows is matched by the *RowsCountError of a query which returned more rows than expected.
+	ErrTooManyRows = errors.New("too many rows")
+)
+
+// RowsCountError is returned by QueryExactly when the query didn't return the expected number of rows.
+type RowsCountError struct {
+	Expected int
+	// Got is the number of rows read: at most Expected+1, the rows beyond aren't read.
+	Got int
+}
+
+func (e *RowsCountError) Error() string {
+	if e.Got > e.Expected {
+		return fmt.Sprintf("%v: expected %d", ErrTooManyRows, e.Expected)
+	}
+	return fmt.Sprintf("%v: got %d, expected %d", e.sentinel(), e.Got, e.Expected)
+}
+
+func (e *RowsCountError) sentinel() error {
+	switch {
+	case e.Got == 0:
+		return ErrNoRows
+	case e.Got < e.Expected:
+		return ErrTooFewRows
+	default:
+		return ErrTooManyRows
+	}
+}
+
+func (e *RowsCountError) Is(target error) bool {
+	return target == e.sentinel() || e.Got == 0 && target == sql.ErrNoRows
+}
+
+// QueryExactly runs the query with q and calls scan for every row, failing with a *RowsCountError
+// unless there are exactly n of them. One row more than n is looked for; scan isn't called for it.
+func QueryExactly(q Queryer, n int, scan func(i int, rows *sql.Rows) error, query string, args ...any) error {
+	return QueryRows(q, query, args...).Use(func(rows *sql.Rows) error {
+		got := 0
+		for rows.Next() {
+			if got == n {
+				return &RowsCountError{Expected: n, Got: n + 1}
+			}
+			err := scan(got, rows)
+			if err != nil {
+				return err
+			}
+			got++
+		}
+		err := rows.Err()
+		if err != nil {
+			return err
+		}
+		if got != n {
+			return &RowsCountError{Expected: n, Got: got}
+		}
+		return nil
+	})
+}
+
+// QueryExactlyOne scans the only row of the query into dest, like QueryRow does,
+// but fails with ErrTooManyRows instead of ignoring the rows after the first one.
+// No row fails with ErrNoRows, which sql.ErrNoRows matches too.
+func QueryExactlyOne(q Queryer, dest []any, query string, args ...any) error {
+	return QueryExactly(q, 1, func(_ int, rows *sql.Rows) error {
+		return rows.Scan(dest...)
+	}, query, args...)
+}
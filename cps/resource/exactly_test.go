@@ -0,0 +1,101 @@
+package resource_test
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+// itemsNamed opens a database whose items table has the given names.
+func itemsNamed(t *testing.T, names ...string) *sql.DB {
+	t.Helper()
+	db := openDB(t)
+	for _, name := range names {
+		_, err := db.Exec("INSERT INTO items (name) VALUES (?)", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+func TestQueryExactlyOne(t *testing.T) {
+	db := itemsNamed(t, "alice", "bob", "bob")
+
+	var id int64
+	err := resource.QueryExactlyOne(db, []any{&id}, "SELECT id FROM items WHERE name = ?", "alice")
+	if err != nil || id != 1 {
+		t.Errorf("one row = %d, %v", id, err)
+	}
+
+	err = resource.QueryExactlyOne(db, []any{&id}, "SELECT id FROM items WHERE name = ?", "carol")
+	if !errors.Is(err, resource.ErrNoRows) || !errors.Is(err, sql.ErrNoRows) || errors.Is(err, resource.ErrTooManyRows) {
+		t.Errorf("no row = %v, want ErrNoRows and sql.ErrNoRows", err)
+	}
+
+	err = resource.QueryExactlyOne(db, []any{&id}, "SELECT id FROM items WHERE name = ?", "bob")
+	if !errors.Is(err, resource.ErrTooManyRows) || errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("two rows = %v, want ErrTooManyRows", err)
+	}
+	var countErr *resource.RowsCountError
+	if !errors.As(err, &countErr) || countErr.Expected != 1 || countErr.Got != 2 {
+		t.Errorf("two rows = %#v, want a *RowsCountError", err)
+	}
+}
+
+func TestQueryExactly(t *testing.T) {
+	db := itemsNamed(t, "a", "b", "c")
+	query := "SELECT name FROM items ORDER BY id LIMIT ?"
+
+	for _, test := range []struct {
+		rows int
+		want error
+	}{
+		{rows: 0, want: resource.ErrNoRows},
+		{rows: 1, want: resource.ErrTooFewRows},
+		{rows: 2, want: nil},
+		{rows: 3, want: resource.ErrTooManyRows},
+	} {
+		var names []string
+		err := resource.QueryExactly(db, 2, func(i int, rows *sql.Rows) error {
+			var name string
+			err := rows.Scan(&name)
+			names = append(names, name)
+			return err
+		}, query, test.rows)
+		if test.want == nil && err != nil || test.want != nil && !errors.Is(err, test.want) {
+			t.Errorf("QueryExactly(2) of %d rows = %v, want %v", test.rows, err, test.want)
+		}
+		if want := []string{"a", "b", "c"}[:min(test.rows, 2)]; !slices.Equal(names, want) {
+			t.Errorf("QueryExactly(2) of %d rows scanned %q, want %q", test.rows, names, want)
+		}
+	}
+}
+
+func TestQueryExactlyClosesRows(t *testing.T) {
+	driver, name := countingSQLite(t)
+	err := resource.NewDBResource(name, filepath.Join(t.TempDir(), "test.db")).Use(func(db *sql.DB) error {
+		db.SetMaxOpenConns(1)
+		_, err := db.Exec("CREATE TABLE items (id INTEGER PRIMARY KEY); INSERT INTO items VALUES (1), (2)")
+		if err != nil {
+			return err
+		}
+		var id int64
+		err = resource.QueryExactlyOne(db, []any{&id}, "SELECT id FROM items")
+		if !errors.Is(err, resource.ErrTooManyRows) {
+			t.Errorf("QueryExactlyOne = %v, want ErrTooManyRows", err)
+		}
+		// with a single connection, this would block on rows left open
+		return db.QueryRow("SELECT COUNT(*) FROM items").Scan(&id)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts := driver.Counts(); counts.Open() != 0 || counts.OpenStmts() != 0 {
+		t.Errorf("counts = %+v, want every connection and statement closed", counts)
+	}
+}
@@ -0,0 +1,173 @@
+package resource
+
+import (
+	"context"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/group"
+)
+
+// DefaultCommandGracePeriod is how long a command gets to exit after SIGTERM before it is killed,
+// unless CommandGracePeriod says otherwise.
+const DefaultCommandGracePeriod = 5 * time.Second
+
+// CommandOption configures NewCommandResourceFunc.
+type CommandOption func(*commandOptions)
+
+type commandOptions struct {
+	grace time.Duration
+	clock Clock
+}
+
+// CommandGracePeriod sets how long the command gets to exit after SIGTERM before it is killed.
+func CommandGracePeriod(d time.Duration) CommandOption {
+	return func(o *commandOptions) {
+		o.grace = d
+	}
+}
+
+// CommandClock makes the grace period timed with clock.
+func CommandClock(clock Clock) CommandOption {
+	return func(o *commandOptions) {
+		o.clock = clock
+	}
+}
+
+// NewCommandResource starts the command before the callback and reaps it afterwards.
+//
+// When the callback succeeds the command is waited for until it exits by itself.
+// When the callback fails or panics the command is terminated, and so is it as soon as ctx is done,
+// while the callback runs too: SIGTERM first, SIGKILL after DefaultCommandGracePeriod.
+// Wait is always called, so no zombies are left.
+//
+// Errors are *ResourceError: PhaseAcquire for Start, PhaseUse for the callback
+// and PhaseRelease for the exit status or cancellation.
+func NewCommandResource(ctx context.Context, name string, args ...string) Resource[*exec.Cmd] {
+	return NewCommandResourceFunc(ctx, func() *exec.Cmd {
+		return exec.Command(name, args...)
+	})
+}
+
+// NewCommandResourceFunc is NewCommandResource for the commands made by newCmd, with options:
+// newCmd returns a new command on every Use, not started yet, with its Dir, Env or pipes set up.
+func NewCommandResourceFunc(ctx context.Context, newCmd func() *exec.Cmd, opts ...CommandOption) Resource[*exec.Cmd] {
+	options := commandOptions{grace: DefaultCommandGracePeriod}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	options.clock = clockOr(options.clock)
+	return commandResource(ctx, newCmd, options)
+}
+
+func commandResource(ctx context.Context, newCmd func() *exec.Cmd, options commandOptions) Resource[*exec.Cmd] {
+	return Resource[*exec.Cmd]{
+		Use: func(callback func(cmd *exec.Cmd) error) error {
+			cmd := newCmd()
+			err := cmd.Start()
+			if err != nil {
+				return phaseError(PhaseAcquire, err)
+			}
+			reaper := startReaper(ctx, cmd, options)
+
+			called := false
+			defer func() {
+				if !called {
+					// the callback panicked: reap the command before the panic goes on
+					reaper.terminate()
+				}
+			}()
+			err = useCallback(callback, cmd)
+			called = true
+			if err != nil {
+				// exit status of a process we terminated ourselves is not interesting
+				reaper.terminate()
+				return phaseError(PhaseUse, err)
+			}
+
+			err = reaper.wait()
+			if reaper.cancelled.Load() {
+				return phaseError(PhaseRelease, ctx.Err())
+			}
+			return phaseError(PhaseRelease, err)
+		},
+	}
+}
+
+// reaper waits for a started command in the background, terminating it when ctx is done
+// or when terminate is called, whichever comes first.
+type reaper struct {
+	cmd      *exec.Cmd
+	options  commandOptions
+	watching group.SafeWaitGroup
+	exited   chan struct{}
+	err      error // of Wait, set when exited is closed
+
+	stop      chan struct{}
+	stopOnce  sync.Once
+	cancelled atomic.Bool // terminated because ctx was done
+}
+
+func startReaper(ctx context.Context, cmd *exec.Cmd, options commandOptions) *reaper {
+	r := &reaper{
+		cmd:      cmd,
+		options:  options,
+		watching: group.NewSafeWaitGroup(),
+		exited:   make(chan struct{}),
+		stop:     make(chan struct{}),
+	}
+	r.watching.Run(func() {
+		r.err = cmd.Wait()
+		close(r.exited)
+	})
+	r.watching.Run(func() {
+		select {
+		case <-r.exited:
+			return
+		case <-r.stop:
+		case <-ctx.Done():
+			r.cancelled.Store(true)
+		}
+		r.kill()
+	})
+	return r
+}
+
+// terminate terminates the command and waits until it's reaped.
+func (r *reaper) terminate() {
+	r.stopOnce.Do(func() {
+		close(r.stop)
+	})
+	r.watching.Wait()
+}
+
+// wait waits until the command is reaped, having exited by itself or terminated for ctx,
+// and returns the error of Wait.
+func (r *reaper) wait() error {
+	r.watching.Wait()
+	return r.err
+}
+
+// kill sends SIGTERM, then SIGKILL after the grace period, and waits for the command to exit.
+func (r *reaper) kill() {
+	err := r.cmd.Process.Signal(syscall.SIGTERM)
+	if err != nil {
+		// already exited, or signals are not supported (windows): nothing to wait for
+		_ = r.cmd.Process.Kill()
+		<-r.exited
+		return
+	}
+
+	timer := r.options.clock.NewTimer(r.options.grace)
+	defer timer.Stop()
+
+	select {
+	case <-r.exited:
+	case <-timer.C():
+		_ = r.cmd.Process.Kill()
+		<-r.exited
+	}
+}
@@ -0,0 +1,136 @@
+//go:build unix
+
+package resource_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"os/exec"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+// processGone tells whether the process pid was reaped.
+func processGone(pid int) bool {
+	return errors.Is(syscall.Kill(pid, 0), syscall.ESRCH)
+}
+
+func TestCommandResourceWaitsForExit(t *testing.T) {
+	err := resource.NewCommandResource(context.Background(), "true").Use(func(*exec.Cmd) error {
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = resource.NewCommandResource(context.Background(), "false").Use(func(*exec.Cmd) error {
+		return nil
+	})
+	var exitErr *exec.ExitError
+	if phaseOf(t, err) != resource.PhaseRelease || !errors.As(err, &exitErr) {
+		t.Fatalf("got %v, want the exit status as a release error", err)
+	}
+}
+
+func TestCommandResourceTerminatesOnCallbackError(t *testing.T) {
+	errCallback := errors.New("callback failed")
+	var pid int
+	started := time.Now()
+	err := resource.NewCommandResource(context.Background(), "sleep", "60").Use(func(cmd *exec.Cmd) error {
+		pid = cmd.Process.Pid
+		return errCallback
+	})
+	if phaseOf(t, err) != resource.PhaseUse || !errors.Is(err, errCallback) {
+		t.Fatalf("got %v, want the callback error", err)
+	}
+	if elapsed := time.Since(started); elapsed > resource.DefaultCommandGracePeriod {
+		t.Fatalf("took %v, longer than the grace period", elapsed)
+	}
+	if !processGone(pid) {
+		t.Fatal("the command is still running")
+	}
+}
+
+func TestCommandResourceTerminatesWhileCallbackRuns(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err := resource.NewCommandResource(ctx, "sleep", "60").Use(func(cmd *exec.Cmd) error {
+		cancel()
+		deadline := time.Now().Add(5 * time.Second)
+		for !processGone(cmd.Process.Pid) {
+			if time.Now().After(deadline) {
+				return errors.New("the command wasn't terminated during the callback")
+			}
+			time.Sleep(time.Millisecond)
+		}
+		return nil
+	})
+	if phaseOf(t, err) != resource.PhaseRelease || !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want the cancellation as a release error", err)
+	}
+}
+
+func TestCommandGracePeriodKillsCommandIgnoringSIGTERM(t *testing.T) {
+	var stdout io.Reader
+	newCmd := func() *exec.Cmd {
+		cmd := exec.Command("sh", "-c", `trap "" TERM; echo ready; while :; do sleep 1; done`)
+		pipe, err := cmd.StdoutPipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		stdout = pipe
+		return cmd
+	}
+	started := time.Now()
+	err := resource.NewCommandResourceFunc(context.Background(), newCmd, resource.CommandGracePeriod(50*time.Millisecond)).Use(func(*exec.Cmd) error {
+		// SIGTERM is ignored once the command printed
+		_, err := bufio.NewReader(stdout).ReadString('\n')
+		if err != nil {
+			return err
+		}
+		return errors.New("done")
+	})
+	if phaseOf(t, err) != resource.PhaseUse {
+		t.Fatalf("got %v, want the callback error", err)
+	}
+	if elapsed := time.Since(started); elapsed > 2*time.Second {
+		t.Fatalf("took %v, want SIGKILL after the grace period", elapsed)
+	}
+}
+
+func TestCommandGracePeriodOnClock(t *testing.T) {
+	clock := newFakeClock()
+	var stdout io.Reader
+	newCmd := func() *exec.Cmd {
+		cmd := exec.Command("sh", "-c", `trap "" TERM; echo ready; while :; do sleep 1; done`)
+		pipe, err := cmd.StdoutPipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		stdout = pipe
+		return cmd
+	}
+	used := make(chan error, 1)
+	go func() {
+		used <- resource.NewCommandResourceFunc(context.Background(), newCmd,
+			resource.CommandGracePeriod(time.Hour), resource.CommandClock(clock)).Use(func(*exec.Cmd) error {
+			_, err := bufio.NewReader(stdout).ReadString('\n')
+			if err != nil {
+				return err
+			}
+			return errors.New("done")
+		})
+	}()
+
+	// the command ignores SIGTERM until the hour of grace passed on the clock
+	clock.BlockUntilTimers(1)
+	clock.Advance(time.Hour)
+	if err := <-used; phaseOf(t, err) != resource.PhaseUse {
+		t.Fatalf("got %v, want the callback error", err)
+	}
+}
@@ -0,0 +1,114 @@
+package resource
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	// ErrUnexpectedRowCount matches every *RowCountError with errors.Is.
+	ErrUnexpectedRowCount = errors.New("unexpected number of affected rows")
+	// ErrLastInsertIDUnsupported is returned by ExecReturningID when the driver has no LastInsertId,
+	// as with Postgres: add a RETURNING clause to the query instead.
+	ErrLastInsertIDUnsupported = errors.New("driver doesn't support LastInsertId")
+)
+
+// RowCountError is returned by ExecExpectingRows when the statement affected another number of rows.
+type RowCountError struct {
+	Expected int64
+	Affected int64
+}
+
+func (e *RowCountError) Error() string {
+	return fmt.Sprintf("%v: %d rows affected, expected %d", ErrUnexpectedRowCount, e.Affected, e.Expected)
+}
+
+func (e *RowCountError) Is(target error) bool {
+	return target == ErrUnexpectedRowCount
+}
+
+var returningClause = regexp.MustCompile(`(?i)\bRETURNING\b`)
+
+// ExecReturningID runs an INSERT and returns the id of the new row, without a racy follow-up SELECT.
+//
+// A query with a RETURNING clause (Postgres, newer SQLite) is run with QueryRowContext
+// and its single returned column is the id; otherwise the id comes from LastInsertId.
+// When the Capabilities of the driver of q are known (see CapabilitiesOf), a driver without LastInsertId
+// gets `RETURNING id` appended to the query instead, and a driver supporting neither an *UnsupportedError.
+func ExecReturningID(q Queryer, query string, args ...any) (int64, error) {
+	returning := returningClause.MatchString(query)
+	if driverName, caps, ok := CapabilitiesOf(q); ok {
+		switch {
+		case returning && !caps.Returning:
+			return 0, &UnsupportedError{Driver: driverName, Feature: "RETURNING"}
+		case !returning && !caps.LastInsertID && caps.Returning:
+			query = strings.TrimRight(query, "; \t\n") + " RETURNING id"
+			returning = true
+		case !returning && !caps.LastInsertID:
+			return 0, &UnsupportedError{Driver: driverName, Feature: "LastInsertId"}
+		}
+	}
+
+	var id int64
+	if returning {
+		err := q.QueryRowContext(context.Background(), query, args...).Scan(&id)
+		return id, err
+	}
+
+	result, err := q.ExecContext(context.Background(), query, args...)
+	if err != nil {
+		return 0, err
+	}
+	id, err = result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrLastInsertIDUnsupported, err)
+	}
+	return id, nil
+}
+
+// ExecExpectingRows runs the statement and returns a *RowCountError unless it affected exactly n rows.
+// Inside a transaction the error rolls it back, for an UPDATE hitting more rows than meant to.
+func ExecExpectingRows(q Queryer, n int64, query string, args ...any) error {
+	result, err := q.ExecContext(context.Background(), query, args...)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected != n {
+		return &RowCountError{Expected: n, Affected: affected}
+	}
+	return nil
+}
+
+// ErrNotFound is returned by QueryValue when the query returned no row; sql.ErrNoRows matches it too.
+var ErrNotFound = errors.New("not found")
+
+// Exec runs one statement through r, for the one-off statements not worth a callback:
+//
+//	_, err := Exec(FromUsable(NewDBResource("sqlite3", path)), "PRAGMA journal_mode = WAL")
+//
+// It goes through r.Use, so r opens and releases as usual (a TxResource commits).
+// It is a function because TxResource, being a Resource instance, can't have methods of its own.
+func Exec[Q Queryer](r Resource[Q], query string, args ...any) (sql.Result, error) {
+	return UseValue(r, func(q Q) (sql.Result, error) {
+		return q.ExecContext(context.Background(), query, args...)
+	})
+}
+
+// QueryValue scans the single column of the first row of the query run through r into dest.
+func QueryValue[Q Queryer](r Resource[Q], dest any, query string, args ...any) error {
+	return r.Use(func(q Q) error {
+		err := q.QueryRowContext(context.Background(), query, args...).Scan(dest)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w: %w", ErrNotFound, err)
+		}
+		return err
+	})
+}
@@ -0,0 +1,183 @@
+package resource_test
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+func TestExecReturningID(t *testing.T) {
+	db := openDB(t)
+	var ids []int64
+	err := resource.RunTransaction(db).Use(func(tx *sql.Tx) error {
+		for _, name := range []string{"a", "b"} {
+			id, err := resource.ExecReturningID(tx, "INSERT INTO items (name) VALUES (?)", name)
+			if err != nil {
+				return err
+			}
+			ids = append(ids, id)
+		}
+		id, err := resource.ExecReturningID(tx, "INSERT INTO items (name) VALUES (?) RETURNING id", "c")
+		ids = append(ids, id)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 3 || ids[0] != 1 || ids[1] != 2 || ids[2] != 3 {
+		t.Errorf("ids = %v, want 1, 2, 3", ids)
+	}
+}
+
+func TestExecReturningIDByCapabilities(t *testing.T) {
+	_, returningOnly := countingSQLite(t)
+	resource.RegisterCapabilities(returningOnly, resource.Capabilities{Returning: true})
+	_, neither := countingSQLite(t)
+	resource.RegisterCapabilities(neither, resource.Capabilities{})
+	dir := t.TempDir()
+
+	err := resource.NewDBResource(returningOnly, filepath.Join(dir, "returning.db")).Use(func(db *sql.DB) error {
+		_, err := db.Exec("CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT NOT NULL)")
+		if err != nil {
+			return err
+		}
+		id, err := resource.ExecReturningID(db, "INSERT INTO items (name) VALUES (?);", "a") // gets RETURNING id
+		if id != 1 {
+			t.Errorf("id = %d, want 1", id)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = resource.NewDBResource(neither, filepath.Join(dir, "neither.db")).Use(func(db *sql.DB) error {
+		_, err := resource.ExecReturningID(db, "INSERT INTO items (name) VALUES (?)", "a")
+		var unsupported *resource.UnsupportedError
+		if !errors.As(err, &unsupported) || unsupported.Feature != "LastInsertId" {
+			t.Errorf("ExecReturningID = %v, want LastInsertId unsupported", err)
+		}
+		_, err = resource.ExecReturningID(db, "INSERT INTO items (name) VALUES (?) RETURNING id", "a")
+		if !errors.As(err, &unsupported) || unsupported.Feature != "RETURNING" {
+			t.Errorf("ExecReturningID = %v, want RETURNING unsupported", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExecExpectingRows(t *testing.T) {
+	db := openDB(t)
+	for _, name := range []string{"a", "b", "c"} {
+		_, err := db.Exec("INSERT INTO items (name) VALUES (?)", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := resource.RunTransaction(db).Use(func(tx *sql.Tx) error {
+		return resource.ExecExpectingRows(tx, 1, "UPDATE items SET name = 'x' WHERE id = ?", 1)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = resource.RunTransaction(db).Use(func(tx *sql.Tx) error {
+		return resource.ExecExpectingRows(tx, 1, "UPDATE items SET name = 'y' WHERE id > ?", 1) // hits two
+	})
+	var rowCount *resource.RowCountError
+	if !errors.Is(err, resource.ErrUnexpectedRowCount) || !errors.As(err, &rowCount) || rowCount.Expected != 1 || rowCount.Affected != 2 {
+		t.Fatalf("ExecExpectingRows = %v, want 2 rows affected of 1 expected", err)
+	}
+	var n int
+	err = db.QueryRow("SELECT COUNT(*) FROM items WHERE name = 'y'").Scan(&n)
+	if err != nil || n != 0 {
+		t.Errorf("%d rows updated by the rolled back transaction, %v", n, err)
+	}
+
+	err = resource.ExecExpectingRows(db, 0, "DELETE FROM items WHERE id = 42")
+	if err != nil {
+		t.Errorf("ExecExpectingRows of no row = %v", err)
+	}
+}
+
+func TestExecAndQueryValue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db := resource.FromUsable(resource.NewDBResource("sqlite3", path))
+	_, err := resource.Exec(db, "CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT NOT NULL)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := resource.Exec(db, "INSERT INTO items (name) VALUES (?)", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := result.RowsAffected(); n != 1 {
+		t.Errorf("%d rows affected", n)
+	}
+
+	var name string
+	err = resource.QueryValue(db, &name, "SELECT name FROM items WHERE id = ?", 1)
+	if err != nil || name != "a" {
+		t.Errorf("QueryValue = %q, %v", name, err)
+	}
+	err = resource.QueryValue(db, &name, "SELECT name FROM items WHERE id = ?", 42)
+	if !errors.Is(err, resource.ErrNotFound) || !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("QueryValue of no row = %v, want %v", err, resource.ErrNotFound)
+	}
+}
+
+func TestExecAndQueryValueClose(t *testing.T) {
+	driver, name := countingSQLite(t)
+	db := resource.FromUsable(resource.NewDBResource(name, filepath.Join(t.TempDir(), "test.db")))
+	_, err := resource.Exec(db, "CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT NOT NULL)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = resource.Exec(db, "INSERT INTO missing (name) VALUES ('a')")
+	if err == nil {
+		t.Error("Exec into a missing table succeeded")
+	}
+	var n int
+	err = resource.QueryValue(db, &n, "SELECT id FROM items")
+	if !errors.Is(err, resource.ErrNotFound) {
+		t.Errorf("QueryValue of no row = %v, want %v", err, resource.ErrNotFound)
+	}
+	if counts := driver.Counts(); counts.Opens != 3 || counts.Open() != 0 {
+		t.Errorf("counts = %+v, want the database opened and closed by every call", counts)
+	}
+}
+
+func TestExecAndQueryValueInTransaction(t *testing.T) {
+	db := openDB(t)
+	var committed []string
+	tx := resource.RunTransaction(db, resource.OnBeforeCommit(func(*sql.Tx) error {
+		committed = append(committed, "commit")
+		return nil
+	}))
+	_, err := resource.Exec(tx, "INSERT INTO items (name) VALUES (?)", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := countItems(t, db); n != 1 || len(committed) != 1 {
+		t.Errorf("%d rows and %d commit hooks after Exec, want it committed through the hooks", n, len(committed))
+	}
+
+	_, err = resource.Exec(tx, "INSERT INTO items (id, name) VALUES (1, 'duplicate')")
+	if err == nil {
+		t.Error("Exec of a duplicate key succeeded")
+	}
+	var name string
+	err = resource.QueryValue(tx, &name, "SELECT name FROM items WHERE id = 1")
+	if err != nil || name != "a" {
+		t.Errorf("QueryValue = %q, %v", name, err)
+	}
+	if n := countItems(t, db); n != 1 || len(committed) != 2 || db.Stats().InUse != 0 {
+		t.Errorf("%d rows, %d commit hooks, %d connections in use, want the failed Exec rolled back", n, len(committed), db.Stats().InUse)
+	}
+}
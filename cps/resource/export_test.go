@@ -0,0 +1,52 @@
+package resource
+
+import (
+	"io"
+	"os"
+	"testing"
+)
+
+// SetSyncFile replaces the fsync of the file resources with sync until the test finishes.
+func SetSyncFile(t testing.TB, sync func(f *os.File) error) {
+	previous := syncFile
+	syncFile = sync
+	t.Cleanup(func() {
+		syncFile = previous
+	})
+}
+
+// SetPairRenamed makes AtomicPair call renamed between its two renames until the test finishes.
+func SetPairRenamed(t testing.TB, renamed func() error) {
+	previous := pairRenamed
+	pairRenamed = renamed
+	t.Cleanup(func() {
+		pairRenamed = previous
+	})
+}
+
+// SetOpenFile replaces the os.OpenFile of the file resources with open until the test finishes.
+func SetOpenFile(t testing.TB, open func(name string, flag int, perm os.FileMode) (*os.File, error)) {
+	previous := openFile
+	openFile = open
+	t.Cleanup(func() {
+		openFile = previous
+	})
+}
+
+// SetRename replaces the os.Rename of PromoteTempFile with rename until the test finishes.
+func SetRename(t testing.TB, rename func(oldpath, newpath string) error) {
+	previous := renameFile
+	renameFile = rename
+	t.Cleanup(func() {
+		renameFile = previous
+	})
+}
+
+// SetCopySource replaces the source reader of CopyFileCtx with source until the test finishes.
+func SetCopySource(t testing.TB, source func(in *os.File) io.Reader) {
+	previous := copySource
+	copySource = source
+	t.Cleanup(func() {
+		copySource = previous
+	})
+}
@@ -0,0 +1,411 @@
+package resource
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type fallbackOptions struct {
+	retry      *RetryPolicy
+	migrations []Migration
+	journal    string
+	onFallback []func(primaryErr error)
+	clock      Clock
+}
+
+// FallbackOption configures NewDBResourceWithFallback.
+type FallbackOption func(options *fallbackOptions)
+
+// FallbackRetry retries opening the primary database according to policy before falling back.
+func FallbackRetry(policy RetryPolicy) FallbackOption {
+	return func(options *fallbackOptions) {
+		options.retry = &policy
+	}
+}
+
+// FallbackMigrations seeds the fallback database with Migrate before the callback runs.
+func FallbackMigrations(migrations []Migration) FallbackOption {
+	return func(options *fallbackOptions) {
+		options.migrations = migrations
+	}
+}
+
+// FallbackJournal appends a FallbackWrite to journalPath for every statement the callback executed
+// on the fallback database and which was committed, for ReplayFallbackJournal to apply them later
+// to the primary database. The statements of Query calls, like INSERT ... RETURNING, aren't journaled.
+//
+// A journal failure doesn't fail the Use: it is reported as a WarnJournalFailed warning.
+func FallbackJournal(journalPath string) FallbackOption {
+	return func(options *fallbackOptions) {
+		options.journal = journalPath
+	}
+}
+
+// FallbackClock dates the writes of FallbackJournal with clock.
+func FallbackClock(clock Clock) FallbackOption {
+	return func(options *fallbackOptions) {
+		options.clock = clock
+	}
+}
+
+// OnFallback calls hook with the error of the primary database before every callback
+// running on the fallback one.
+func OnFallback(hook func(primaryErr error)) FallbackOption {
+	return func(options *fallbackOptions) {
+		options.onFallback = append(options.onFallback, hook)
+	}
+}
+
+// fallbackDBs are the fallback databases in use.
+var fallbackDBs sync.Map
+
+// IsFallback tells whether db is the fallback database of NewDBResourceWithFallback,
+// for the callback to know it runs in degraded mode.
+func IsFallback(db *sql.DB) bool {
+	_, ok := fallbackDBs.Load(db)
+	return ok
+}
+
+// NewDBResourceWithFallback opens the primary database, pinged, for every Use, and the database
+// of fallback instead when the primary can't be opened: typically an in-memory sqlite database
+// seeded by FallbackMigrations, for demos and tests to run offline. A sqlite :memory: database
+// is per connection, so fallback should return a shared-cache one like "file:offline?mode=memory&cache=shared".
+//
+// Only the acquire failures of the primary fall back: the errors of the callback are returned as is.
+func NewDBResourceWithFallback(primary DBConfig, fallback func() (driver, dsn string), opts ...FallbackOption) DBResource {
+	var options fallbackOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	primaryDB := FromUsable(NewDBResource(primary.DriverName, primary.DatasourceName, func(options *dbOptions) {
+		options.checkOpened = append(options.checkOpened, (*sql.DB).Ping)
+	}))
+	if options.retry != nil {
+		primaryDB = WithRetry(context.Background(), primaryDB, *options.retry)
+	}
+
+	return DB(Resource[*sql.DB]{
+		Description: primaryDB.Description + " with fallback",
+		Use: func(callback func(db *sql.DB) error) error {
+			called := false
+			err := primaryDB.Use(func(db *sql.DB) error {
+				called = true
+				return callback(db)
+			})
+			if called || err == nil {
+				return err
+			}
+			driverName, dsn := fallback()
+			return useFallback(driverName, dsn, &options, err, callback)
+		},
+	})
+}
+
+func useFallback(driverName, dsn string, options *fallbackOptions, primaryErr error, callback func(db *sql.DB) error) error {
+	description := "db fallback " + driverName + " " + redactDSN(dsn)
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return errors.Join(primaryErr, describedError(PhaseAcquire, description, err))
+	}
+	var journal *journalConnector
+	if options.journal != "" {
+		journal = &journalConnector{driver: db.Driver(), dsn: dsn, path: options.journal, clock: clockOr(options.clock)}
+		err = db.Close()
+		if err != nil {
+			return errors.Join(primaryErr, describedError(PhaseAcquire, description, err))
+		}
+		db = sql.OpenDB(journal)
+	}
+
+	if len(options.migrations) > 0 {
+		err = Migrate(db, options.migrations)
+		if err != nil {
+			closeErr := db.Close()
+			err = errors.Join(primaryErr, describedError(PhaseAcquire, description, err))
+			return secondaryError(err, description, describedError(PhaseRelease, description, closeErr))
+		}
+	}
+	if journal != nil {
+		journal.recording.Store(true)
+	}
+
+	for _, hook := range options.onFallback {
+		hook(primaryErr)
+	}
+	bindDriver(db, driverName)
+	fallbackDBs.Store(db, struct{}{})
+	err = useCallback(callback, db)
+	fallbackDBs.Delete(db)
+	unbindDriver(db)
+	closeErr := db.Close()
+	if err != nil {
+		return err
+	}
+	return describedError(PhaseRelease, description, closeErr)
+}
+
+// FallbackWrite is a line of the journal of FallbackJournal, in JSON.
+type FallbackWrite struct {
+	Time  time.Time     `json:"time"`
+	Query string        `json:"query"`
+	Args  []FallbackArg `json:"args,omitempty"`
+}
+
+// FallbackArg is an argument of a FallbackWrite, with its type so it's replayed as is.
+type FallbackArg struct {
+	// Kind is "null", "int", "float", "bool", "bytes", "string" or "time".
+	Kind  string          `json:"kind"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+func fallbackArg(value driver.Value) FallbackArg {
+	var kind string
+	switch value.(type) {
+	case nil:
+		return FallbackArg{Kind: "null"}
+	case int64:
+		kind = "int"
+	case float64:
+		kind = "float"
+	case bool:
+		kind = "bool"
+	case []byte:
+		kind = "bytes" // base64 in JSON
+	case time.Time:
+		kind = "time"
+	default:
+		kind = "string"
+		value = fmt.Sprint(value)
+	}
+	data, _ := json.Marshal(value)
+	return FallbackArg{Kind: kind, Value: data}
+}
+
+func (a FallbackArg) value() (any, error) {
+	var err error
+	switch a.Kind {
+	case "null":
+		return nil, nil
+	case "int":
+		var v int64
+		err = json.Unmarshal(a.Value, &v)
+		return v, err
+	case "float":
+		var v float64
+		err = json.Unmarshal(a.Value, &v)
+		return v, err
+	case "bool":
+		var v bool
+		err = json.Unmarshal(a.Value, &v)
+		return v, err
+	case "bytes":
+		var v []byte
+		err = json.Unmarshal(a.Value, &v)
+		return v, err
+	case "time":
+		var v time.Time
+		err = json.Unmarshal(a.Value, &v)
+		return v, err
+	case "string":
+		var v string
+		err = json.Unmarshal(a.Value, &v)
+		return v, err
+	}
+	return nil, fmt.Errorf("unknown argument kind %q", a.Kind)
+}
+
+// ReplayFallbackJournal executes the writes of the journal of FallbackJournal on db,
+// in one transaction, and returns how many there were. The journal is left as is:
+// remove it once replayed, so it isn't replayed twice.
+func ReplayFallbackJournal(db *sql.DB, journalPath string) (int, error) {
+	replayed := 0
+	err := RunTransaction(db).Use(func(tx *sql.Tx) error {
+		return NewReadFileResource(journalPath).Use(func(r io.Reader) error {
+			scanner := bufio.NewScanner(r)
+			scanner.Buffer(nil, 16<<20)
+			for line := 1; scanner.Scan(); line++ {
+				var write FallbackWrite
+				err := json.Unmarshal(scanner.Bytes(), &write)
+				if err != nil {
+					return fmt.Errorf("%s:%d: %w", journalPath, line, err)
+				}
+				args := make([]any, len(write.Args))
+				for i, arg := range write.Args {
+					args[i], err = arg.value()
+					if err != nil {
+						return fmt.Errorf("%s:%d: argument %d: %w", journalPath, line, i+1, err)
+					}
+				}
+				_, err = tx.Exec(write.Query, args...)
+				if err != nil {
+					return fmt.Errorf("%s:%d: %s: %w", journalPath, line, truncateQuery(write.Query), err)
+				}
+				replayed++
+			}
+			return scanner.Err()
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+	return replayed, nil
+}
+
+// journalConnector opens the connections of a fallback database journaling its writes once recording.
+type journalConnector struct {
+	driver    driver.Driver
+	dsn       string
+	path      string
+	clock     Clock
+	recording atomic.Bool
+}
+
+func (c *journalConnector) Connect(context.Context) (driver.Conn, error) {
+	conn, err := c.driver.Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &journalConn{conn: conn, connector: c}, nil
+}
+
+func (c *journalConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// journalConn keeps the writes of its transaction until it commits.
+// database/sql uses a connection from one goroutine at a time.
+type journalConn struct {
+	conn      driver.Conn
+	connector *journalConnector
+	inTx      bool
+	pending   []FallbackWrite
+}
+
+func (c *journalConn) record(query string, args []driver.Value) {
+	if !c.connector.recording.Load() {
+		return
+	}
+	write := FallbackWrite{Time: c.connector.clock.Now(), Query: query}
+	for _, arg := range args {
+		write.Args = append(write.Args, fallbackArg(arg))
+	}
+	if c.inTx {
+		c.pending = append(c.pending, write)
+		return
+	}
+	writeJournal(c.connector.path, write)
+}
+
+func (c *journalConn) Prepare(query string) (driver.Stmt, error) {
+	stmt, err := c.conn.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	return &journalStmt{stmt: stmt, conn: c, query: query}, nil
+}
+
+func (c *journalConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *journalConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *journalConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	var tx driver.Tx
+	var err error
+	if beginner, ok := c.conn.(driver.ConnBeginTx); ok {
+		tx, err = beginner.BeginTx(ctx, opts)
+	} else {
+		tx, err = c.conn.Begin()
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.inTx = true
+	return &journalTx{tx: tx, conn: c}, nil
+}
+
+// ExecContext keeps the multi-statement Exec of drivers like sqlite, which Prepare would cut
+// to its first statement.
+func (c *journalConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	result, err := execer.ExecContext(ctx, query, args)
+	if err == nil {
+		values := make([]driver.Value, len(args))
+		for i, arg := range args {
+			values[i] = arg.Value
+		}
+		c.record(query, values)
+	}
+	return result, err
+}
+
+func (c *journalConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	return queryer.QueryContext(ctx, query, args)
+}
+
+type journalTx struct {
+	tx   driver.Tx
+	conn *journalConn
+}
+
+func (t *journalTx) Commit() error {
+	err := t.tx.Commit()
+	pending := t.conn.pending
+	t.conn.inTx, t.conn.pending = false, nil
+	if err == nil {
+		for _, write := range pending {
+			writeJournal(t.conn.connector.path, write)
+		}
+	}
+	return err
+}
+
+func (t *journalTx) Rollback() error {
+	t.conn.inTx, t.conn.pending = false, nil
+	return t.tx.Rollback()
+}
+
+type journalStmt struct {
+	stmt  driver.Stmt
+	conn  *journalConn
+	query string
+}
+
+func (s *journalStmt) Close() error {
+	return s.stmt.Close()
+}
+
+func (s *journalStmt) NumInput() int {
+	return s.stmt.NumInput()
+}
+
+func (s *journalStmt) Exec(args []driver.Value) (driver.Result, error) {
+	result, err := s.stmt.Exec(args)
+	if err == nil {
+		s.conn.record(s.query, args)
+	}
+	return result, err
+}
+
+func (s *journalStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.stmt.Query(args)
+}
@@ -0,0 +1,224 @@
+package resource_test
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+var itemsSchema = []resource.Migration{
+	{Version: 1, Name: "items", Up: "CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT NOT NULL)"},
+}
+
+// unreachableDB is a sqlite database in a missing directory, which fails the ping.
+func unreachableDB(t *testing.T) resource.DBConfig {
+	return resource.DBConfig{
+		DriverName:     "sqlite3",
+		DatasourceName: "file:" + filepath.Join(t.TempDir(), "missing", "test.db") + "?mode=rw",
+	}
+}
+
+// memoryDB is a fallback opening a shared in-memory sqlite database of its own.
+func memoryDB(t *testing.T, driverName string) func() (string, string) {
+	return func() (string, string) {
+		return driverName, fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())
+	}
+}
+
+func TestFallbackWhenPrimaryDown(t *testing.T) {
+	clock := newFakeClock()
+	sleeper := &advancingSleeper{clock: clock}
+	policy := resource.FixedDelay(time.Second, 3)
+	policy.Sleeper = sleeper
+	var primaryErrs []error
+
+	dbr := resource.NewDBResourceWithFallback(unreachableDB(t), memoryDB(t, "sqlite3"),
+		resource.FallbackRetry(policy),
+		resource.FallbackMigrations(itemsSchema),
+		resource.OnFallback(func(primaryErr error) {
+			primaryErrs = append(primaryErrs, primaryErr)
+		}))
+	var fallbackDB *sql.DB
+	err := dbr.Use(func(db *sql.DB) error {
+		fallbackDB = db
+		if !resource.IsFallback(db) {
+			t.Error("IsFallback = false on the fallback database")
+		}
+		// seeded by the migrations
+		_, err := db.Exec("INSERT INTO items (name) VALUES (?)", "offline")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sleeper.delays) != 2 {
+		t.Errorf("slept %v, want the primary tried 3 times", sleeper.delays)
+	}
+	if len(primaryErrs) != 1 || primaryErrs[0] == nil || phaseOf(t, primaryErrs[0]) != resource.PhaseAcquire {
+		t.Errorf("OnFallback called with %v, want the acquire error of the primary once", primaryErrs)
+	}
+	if resource.IsFallback(fallbackDB) {
+		t.Error("IsFallback = true after the Use")
+	}
+
+	// the errors of the callback on the fallback are returned as is
+	errCallback := errors.New("callback failed")
+	err = dbr.Use(func(*sql.DB) error { return errCallback })
+	if !errors.Is(err, errCallback) {
+		t.Errorf("Use = %v, want the error of the callback", err)
+	}
+}
+
+func TestFallbackNotOpenedWhenPrimaryUp(t *testing.T) {
+	primary := filepath.Join(t.TempDir(), "primary.db")
+	_, primaryDriver := countingSQLite(t)
+	fallbackDriver, fallbackDriverName := countingSQLite(t)
+	fallbacks := 0
+	fallback := func() (string, string) {
+		fallbacks++
+		return memoryDB(t, fallbackDriverName)()
+	}
+
+	dbr := resource.NewDBResourceWithFallback(resource.DBConfig{DriverName: primaryDriver, DatasourceName: primary}, fallback,
+		resource.FallbackMigrations(itemsSchema),
+		resource.OnFallback(func(error) {
+			t.Error("OnFallback called with the primary up")
+		}))
+	err := dbr.Use(func(db *sql.DB) error {
+		if resource.IsFallback(db) {
+			t.Error("IsFallback = true on the primary database")
+		}
+		_, err := db.Exec("CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT NOT NULL)")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a callback failing on the primary doesn't fall back either
+	errCallback := errors.New("callback failed")
+	err = dbr.Use(func(*sql.DB) error { return errCallback })
+	if !errors.Is(err, errCallback) {
+		t.Errorf("Use = %v, want the error of the callback", err)
+	}
+	if fallbacks != 0 || fallbackDriver.Counts().Open() != 0 {
+		t.Errorf("fallback called %d times, %d connections opened, want none", fallbacks, fallbackDriver.Counts().Open())
+	}
+}
+
+// readFallbackJournal decodes the lines of the journal of FallbackJournal.
+func readFallbackJournal(t *testing.T, path string) []resource.FallbackWrite {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var writes []resource.FallbackWrite
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var write resource.FallbackWrite
+		err := json.Unmarshal(scanner.Bytes(), &write)
+		if err != nil {
+			t.Fatalf("journal line %q: %v", scanner.Text(), err)
+		}
+		writes = append(writes, write)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return writes
+}
+
+func TestFallbackJournalReplay(t *testing.T) {
+	const insert = "INSERT INTO records (id, name, score, data, note) VALUES (?, ?, ?, ?, ?)"
+	schema := []resource.Migration{{Version: 1, Name: "records",
+		Up: "CREATE TABLE records (id INTEGER PRIMARY KEY, name TEXT, score REAL, data BLOB, note TEXT)"}}
+	journal := filepath.Join(t.TempDir(), "fallback.journal")
+	clock := newFakeClock()
+
+	dbr := resource.NewDBResourceWithFallback(unreachableDB(t), memoryDB(t, "sqlite3"),
+		resource.FallbackMigrations(schema),
+		resource.FallbackJournal(journal),
+		resource.FallbackClock(clock))
+	err := dbr.Use(func(db *sql.DB) error {
+		_, err := db.Exec(insert, 1, "alice", 1.5, []byte{0, 1, 2}, nil)
+		if err != nil {
+			return err
+		}
+		clock.Advance(time.Minute)
+		// a rolled back transaction isn't journaled, a committed one is on its commit
+		err = resource.RunTransaction(db).Use(func(tx *sql.Tx) error {
+			_, err := tx.Exec(insert, 2, "rolled back", 0.0, nil, nil)
+			if err != nil {
+				return err
+			}
+			return errors.New("abort")
+		})
+		if err == nil {
+			t.Error("aborted transaction committed")
+		}
+		return resource.RunTransaction(db).Use(func(tx *sql.Tx) error {
+			_, err := tx.Exec(insert, 3, "bob", -2.0, []byte("x"), "in a transaction")
+			return err
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writes := readFallbackJournal(t, journal)
+	if len(writes) != 2 {
+		t.Fatalf("journal = %+v, want the two committed inserts", writes)
+	}
+	if writes[0].Query != insert || !writes[0].Time.Equal(epoch) || !writes[1].Time.Equal(epoch.Add(time.Minute)) {
+		t.Errorf("journal = %+v, want the inserts dated by the clock", writes)
+	}
+	var kinds []string
+	for _, arg := range writes[0].Args {
+		kinds = append(kinds, arg.Kind)
+	}
+	if want := []string{"int", "string", "float", "bytes", "null"}; !slices.Equal(kinds, want) {
+		t.Errorf("argument kinds = %q, want %q", kinds, want)
+	}
+
+	primary := openDB(t)
+	_, err = primary.Exec(schema[0].Up)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayed, err := resource.ReplayFallbackJournal(primary, journal)
+	if err != nil || replayed != 2 {
+		t.Fatalf("ReplayFallbackJournal = %d, %v; want 2 writes", replayed, err)
+	}
+	rows, err := primary.Query("SELECT id, name, score, data, note FROM records ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var got []string
+	for rows.Next() {
+		var id int64
+		var name string
+		var score float64
+		var data []byte
+		var note sql.NullString
+		if err := rows.Scan(&id, &name, &score, &data, &note); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, fmt.Sprintf("%d %s %g %q %v", id, name, score, data, note))
+	}
+	want := []string{`1 alice 1.5 "\x00\x01\x02" { false}`, `3 bob -2 "x" {in a transaction true}`}
+	if !slices.Equal(got, want) {
+		t.Errorf("replayed rows = %q, want %q", got, want)
+	}
+}
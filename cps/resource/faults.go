@@ -0,0 +1,85 @@
+package resource
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// ErrInjectedFault is the error of the failures injected by WithFaults.
+var ErrInjectedFault = errors.New("injected fault")
+
+// FaultConfig tells WithFaults which faults to inject; probabilities go from 0 (never) to 1 (every Use).
+type FaultConfig struct {
+	// Seed makes the sequence of faults reproducible.
+	Seed uint64
+
+	AcquireFailure float64
+	ReleaseFailure float64
+
+	// LatencyProbability applies to AcquireLatency and ReleaseLatency, each drawn separately.
+	LatencyProbability float64
+	AcquireLatency     time.Duration
+	ReleaseLatency     time.Duration
+	// Clock sleeps the latencies, the real clock when nil.
+	Clock Clock
+
+	// OnFault, when set, is told about every injected fault.
+	OnFault func(f Fault)
+}
+
+// Fault is an injected fault: a failure, or a latency when Latency isn't zero.
+type Fault struct {
+	Phase   Phase
+	Latency time.Duration
+}
+
+// WithFaults wraps r to inject faults at random, for testing the error handling around it.
+//
+// An acquire failure doesn't acquire r; acquire latency is a sleep before acquiring it.
+// Release faults happen after r's real release, so they never leave anything open:
+// a release failure is a PhaseRelease ErrInjectedFault joined with the Use error.
+func WithFaults[T any](r Resource[T], cfg FaultConfig) Resource[T] {
+	var mu sync.Mutex
+	random := rand.New(rand.NewPCG(cfg.Seed, cfg.Seed))
+	clock := clockOr(cfg.Clock)
+	return Resource[T]{
+		Description: r.Description,
+		Use: func(callback func(value T) error) error {
+			// all the draws of a Use happen at once, so the faults don't depend on timing
+			mu.Lock()
+			acquireFailure := random.Float64() < cfg.AcquireFailure
+			acquireLatency := random.Float64() < cfg.LatencyProbability
+			releaseFailure := random.Float64() < cfg.ReleaseFailure
+			releaseLatency := random.Float64() < cfg.LatencyProbability
+			mu.Unlock()
+
+			if acquireLatency && cfg.AcquireLatency > 0 {
+				cfg.injected(Fault{Phase: PhaseAcquire, Latency: cfg.AcquireLatency})
+				_ = clock.Sleep(context.Background(), cfg.AcquireLatency)
+			}
+			if acquireFailure {
+				cfg.injected(Fault{Phase: PhaseAcquire})
+				return phaseError(PhaseAcquire, ErrInjectedFault)
+			}
+			err := r.Use(callback)
+			if releaseLatency && cfg.ReleaseLatency > 0 {
+				cfg.injected(Fault{Phase: PhaseRelease, Latency: cfg.ReleaseLatency})
+				_ = clock.Sleep(context.Background(), cfg.ReleaseLatency)
+			}
+			if releaseFailure {
+				cfg.injected(Fault{Phase: PhaseRelease})
+				return errors.Join(err, phaseError(PhaseRelease, ErrInjectedFault))
+			}
+			return err
+		},
+	}
+}
+
+func (cfg *FaultConfig) injected(f Fault) {
+	if cfg.OnFault != nil {
+		cfg.OnFault(f)
+	}
+}
@@ -0,0 +1,132 @@
+package resource_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+	"github.com/Q69K/using-cps-in-golang/cps/resource/resourcetest"
+)
+
+// sleepingClock is a fake clock whose Sleep advances it instead of blocking.
+type sleepingClock struct {
+	*resourcetest.FakeClock
+}
+
+func (c sleepingClock) Sleep(ctx context.Context, d time.Duration) error {
+	c.Advance(d)
+	return ctx.Err()
+}
+
+// faultSequence uses r wrapped with the faults of seed 42 twelve times, returning the faults injected
+// and the time slept on its clock.
+func faultSequence(t *testing.T) ([]string, time.Duration) {
+	clock := sleepingClock{newFakeClock()}
+	use := 0
+	var faults []string
+	r := resource.WithFaults(resourcetest.FakeResource(1, resourcetest.NoFailure), resource.FaultConfig{
+		Seed:               42,
+		AcquireFailure:     0.3,
+		ReleaseFailure:     0.3,
+		LatencyProbability: 0.3,
+		AcquireLatency:     time.Second,
+		ReleaseLatency:     2 * time.Second,
+		Clock:              clock,
+		OnFault: func(f resource.Fault) {
+			if f.Latency > 0 {
+				faults = append(faults, fmt.Sprintf("use %d: %v latency %v", use, f.Phase, f.Latency))
+			} else {
+				faults = append(faults, fmt.Sprintf("use %d: %v failure", use, f.Phase))
+			}
+		},
+	})
+	for ; use < 12; use++ {
+		called := false
+		err := r.Use(func(int) error {
+			called = true
+			return nil
+		})
+		last := ""
+		if len(faults) > 0 {
+			last = faults[len(faults)-1]
+		}
+		switch {
+		case last == fmt.Sprintf("use %d: acquire failure", use):
+			if called || phaseOf(t, err) != resource.PhaseAcquire || !errors.Is(err, resource.ErrInjectedFault) {
+				t.Errorf("use %d = %v, callback called %v, want an injected acquire failure", use, err, called)
+			}
+		case last == fmt.Sprintf("use %d: release failure", use):
+			if !called || phaseOf(t, err) != resource.PhaseRelease || !errors.Is(err, resource.ErrInjectedFault) {
+				t.Errorf("use %d = %v, callback called %v, want an injected release failure", use, err, called)
+			}
+		default:
+			if !called || err != nil {
+				t.Errorf("use %d = %v, callback called %v, want no failure", use, err, called)
+			}
+		}
+	}
+	return faults, clock.Now().Sub(epoch)
+}
+
+func TestWithFaultsSequence(t *testing.T) {
+	faults, slept := faultSequence(t)
+	want := []string{
+		"use 1: acquire latency 1s",
+		"use 1: acquire failure",
+		"use 3: release failure",
+		"use 4: acquire latency 1s",
+		"use 5: acquire failure",
+		"use 6: acquire latency 1s",
+		"use 6: acquire failure",
+		"use 7: release latency 2s",
+		"use 8: acquire latency 1s",
+		"use 10: acquire latency 1s",
+		"use 10: acquire failure",
+		"use 11: acquire latency 1s",
+		"use 11: acquire failure",
+	}
+	if !slices.Equal(faults, want) {
+		t.Errorf("faults = %q, want %q", faults, want)
+	}
+	if slept != 8*time.Second {
+		t.Errorf("slept %v, want the 8s of the latencies", slept)
+	}
+
+	again, _ := faultSequence(t)
+	if !slices.Equal(again, faults) {
+		t.Errorf("faults with the same seed = %q, want %q", again, faults)
+	}
+}
+
+func TestWithFaultsReleasesBeforeFailing(t *testing.T) {
+	errCallback := errors.New("callback failed")
+	released := false
+	r := resource.Resource[int]{
+		Use: func(callback func(int) error) error {
+			defer func() {
+				released = true
+			}()
+			return callback(1)
+		},
+	}
+
+	err := resource.WithFaults(r, resource.FaultConfig{ReleaseFailure: 1}).Use(func(int) error {
+		return errCallback
+	})
+	if !released {
+		t.Error("not released before the injected failure")
+	}
+	if !errors.Is(err, errCallback) || !errors.Is(err, resource.ErrInjectedFault) {
+		t.Errorf("Use = %v, want the callback error and the injected one", err)
+	}
+
+	released = false
+	err = resource.WithFaults(r, resource.FaultConfig{}).Use(func(int) error { return nil })
+	if err != nil || !released {
+		t.Errorf("Use without faults = %v, released %v", err, released)
+	}
+}
@@ -0,0 +1,566 @@
+package resource
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// NewFileFlag creates the file if needed and opens it for writing.
+const NewFileFlag = os.O_CREATE | os.O_WRONLY
+
+// OwnerRWOnly lets only the owner read and write the file.
+const OwnerRWOnly os.FileMode = 0600
+
+// FileResourceCallback is what a FileResource gives the opened file to.
+type FileResourceCallback = func(fd *os.File) error
+
+// FileResource opens a file, passes it to the callback and closes it afterwards.
+//
+// The file resources of this package are unexported implementations of it, with a String method
+// telling the same as Describe, so decorators take any FileResource and can unwrap their own.
+type FileResource interface {
+	Use(callback FileResourceCallback) error
+	// Describe tells which file it is, like "file out.txt (O_WRONLY|O_CREATE)".
+	Describe() string
+}
+
+// FileResourceFunc is the function form FileResource had before it became an interface.
+// Its Use method calls it, so FileResourceFunc(f) is a FileResource, and fr.Use is the FileResourceFunc of fr.
+//
+// Deprecated: call fr.Use(callback) rather than fr(callback), and implement FileResource, or decorate
+// the file resources of this package, rather than writing file resources as functions.
+type FileResourceFunc func(callback FileResourceCallback) error
+
+// Use calls f.
+func (f FileResourceFunc) Use(callback FileResourceCallback) error {
+	return f(callback)
+}
+
+// Describe returns "file": a function can't tell which file it opens.
+func (f FileResourceFunc) Describe() string {
+	return "file"
+}
+
+// fileResource is the FileResource of the constructors of this package.
+type fileResource struct {
+	use         func(callback FileResourceCallback) error
+	description string
+}
+
+func newFileResource(description string, use func(callback FileResourceCallback) error) FileResource {
+	return &fileResource{use: use, description: description}
+}
+
+func (f *fileResource) Use(callback FileResourceCallback) error {
+	return f.use(callback)
+}
+
+func (f *fileResource) Describe() string {
+	return f.description
+}
+
+func (f *fileResource) String() string {
+	return f.description
+}
+
+type fileOptions struct {
+	sync              bool
+	tracer            Tracer
+	mkdirAll          bool
+	dirPerm           os.FileMode
+	removeCreatedDirs bool
+	journal           string
+	verify            func(r io.Reader) error
+	openRetry         *RetryPolicy
+	skipUnchanged     bool
+	journalClock      Clock
+}
+
+// FileOption configures the file resources.
+type FileOption func(options *fileOptions)
+
+func newFileOptions(opts []FileOption) fileOptions {
+	var options fileOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
+
+// Sync makes the resource fsync the file before closing it when the callback succeeded
+// (and the parent directory after the rename for NewAtomicFileResource).
+// Sync failures are reported as PhaseRelease errors.
+// It is an option because fsync is expensive.
+func Sync() FileOption {
+	return func(options *fileOptions) {
+		options.sync = true
+	}
+}
+
+// WithMkdirAll makes the resource create the missing parent directories of the file with perm
+// (before umask) when acquiring it; failures are PhaseAcquire errors.
+func WithMkdirAll(perm os.FileMode) FileOption {
+	return func(options *fileOptions) {
+		options.mkdirAll = true
+		options.dirPerm = perm
+	}
+}
+
+// RemoveCreatedDirs makes WithMkdirAll remove the directories it created when the Use fails.
+// It's an option because another goroutine or process may have started using them;
+// a directory which isn't empty anymore is left alone.
+func RemoveCreatedDirs() FileOption {
+	return func(options *fileOptions) {
+		options.removeCreatedDirs = true
+	}
+}
+
+// Verify makes NewAtomicFileResource read back the complete temporary file with verify before renaming it
+// over path, like parsing it again: a verify error leaves path as it was and removes the temporary file.
+// Verify errors are PhaseRelease errors. Other resources ignore the option.
+func Verify(verify func(r io.Reader) error) FileOption {
+	return func(options *fileOptions) {
+		options.verify = verify
+	}
+}
+
+// ErrUnchanged is returned by NewAtomicFileResource with SkipIfUnchanged when path had the content
+// of the callback already. It isn't a failure: the callback succeeded, path is as wanted.
+var ErrUnchanged = errors.New("file unchanged")
+
+// SkipIfUnchanged makes NewAtomicFileResource compare the complete temporary file with path before the rename:
+// when their contents are the same, the temporary file is removed, path is left alone, mtime included,
+// and Use returns ErrUnchanged. The files are compared in a streaming fashion, after their sizes.
+// Other resources ignore the option.
+func SkipIfUnchanged() FileOption {
+	return func(options *fileOptions) {
+		options.skipUnchanged = true
+	}
+}
+
+// RetryTransientOpen makes NewFileResource, and the resources built on it, retry opening the file
+// according to policy when it fails with an error IsTransientOpenError accepts, or policy.Classify when set:
+// on Windows antivirus and indexers briefly hold files other processes then fail to open.
+func RetryTransientOpen(policy RetryPolicy) FileOption {
+	return func(options *fileOptions) {
+		if policy.Classify == nil {
+			policy.Classify = IsTransientOpenError
+		}
+		options.openRetry = &policy
+	}
+}
+
+// openFile is os.OpenFile, replaced by tests simulating failures.
+var openFile = os.OpenFile
+
+func (options *fileOptions) open(path string, flags int, perm os.FileMode) (*os.File, error) {
+	if options.openRetry == nil {
+		return openFile(path, flags, perm)
+	}
+	var file *os.File
+	err := options.openRetry.Do(context.Background(), func() error {
+		var err error
+		file, err = openFile(path, flags, perm)
+		return err
+	})
+	return file, err
+}
+
+// makeParents creates the missing parents of path with the WithMkdirAll option,
+// returning the ones it created, deepest first.
+func (options *fileOptions) makeParents(path string) ([]string, error) {
+	if !options.mkdirAll {
+		return nil, nil
+	}
+	var missing []string
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		_, err := os.Stat(dir)
+		if err == nil || !errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+		missing = append(missing, dir)
+		if filepath.Dir(dir) == dir {
+			break
+		}
+	}
+	if len(missing) == 0 {
+		return nil, nil
+	}
+	return missing, os.MkdirAll(missing[0], options.dirPerm)
+}
+
+// removeParents removes the directories created by makeParents after a failed Use, with RemoveCreatedDirs.
+func (options *fileOptions) removeParents(created []string, useErr error) {
+	if useErr == nil || !options.removeCreatedDirs {
+		return
+	}
+	for _, dir := range created {
+		if os.Remove(dir) != nil {
+			return
+		}
+	}
+}
+
+// func NewFileResource(path string, flags int, perm os.FileMode, callback FileResourceCallback) error {
+
+// NewFileResource opens path with os.OpenFile for every call of the returned resource.
+// The close error is returned too, joined with the callback error if there is one.
+//
+// Prefer NewReadFileResource and NewWriteFileResource unless the callback needs *os.File.
+func NewFileResource(path string, flags int, perm os.FileMode, opts ...FileOption) FileResource {
+	options := newFileOptions(opts)
+
+	description := describeFile(path, flags)
+	return newFileResource(description, func(callback FileResourceCallback) error {
+		end := startSpan(options.tracer, "resource.file")
+		err := useFile(path, flags, perm, description, &options, callback)
+		end(err)
+		return checkResult(err, description)
+	})
+}
+
+func useFile(path string, flags int, perm os.FileMode, description string, options *fileOptions, callback FileResourceCallback) error {
+	created, err := options.makeParents(path)
+	if err == nil {
+		err = openAndUseFile(path, flags, perm, description, options, callback)
+	} else {
+		currentStats("file").acquireFailed()
+		err = describedError(PhaseAcquire, description, err)
+	}
+	options.removeParents(created, err)
+	return err
+}
+
+func openAndUseFile(path string, flags int, perm os.FileMode, description string, options *fileOptions, callback FileResourceCallback) error {
+	stats := currentStats("file")
+
+	file, err := options.open(path, flags, perm)
+	if err != nil {
+		stats.acquireFailed()
+		return describedError(PhaseAcquire, description, err)
+	}
+	acquired := stats.acquired()
+	open := trackOpenAs("file", description, 0)
+
+	called := false
+	defer func() {
+		if !called {
+			// the callback panicked or called runtime.Goexit: the file is closed before that goes on
+			_ = file.Close()
+			open.release()
+		}
+	}()
+	endUse := startSpan(options.tracer, "resource.file.use")
+	err = useCallback(callback, file)
+	called = true
+	endUse(err)
+
+	releaseErr := describedError(PhaseRelease, description, closeFile(file, err == nil && options.sync))
+	open.release()
+	stats.released(acquired, err, releaseErr)
+	if err != nil {
+		// return user's error anyway
+		// combined with the close error if there is one
+		return errors.Join(err, releaseErr)
+	}
+	return releaseErr
+}
+
+var fileFlagNames = []struct {
+	flag int
+	name string
+}{
+	{os.O_APPEND, "O_APPEND"},
+	{os.O_CREATE, "O_CREATE"},
+	{os.O_EXCL, "O_EXCL"},
+	{os.O_SYNC, "O_SYNC"},
+	{os.O_TRUNC, "O_TRUNC"},
+}
+
+// describeFile is the description of a file resource: "file out.txt (O_WRONLY|O_CREATE)".
+func describeFile(path string, flags int) string {
+	names := []string{"O_RDONLY"}
+	switch flags & (os.O_RDONLY | os.O_WRONLY | os.O_RDWR) {
+	case os.O_WRONLY:
+		names[0] = "O_WRONLY"
+	case os.O_RDWR:
+		names[0] = "O_RDWR"
+	}
+	for _, flag := range fileFlagNames {
+		if flags&flag.flag != 0 {
+			names = append(names, flag.name)
+		}
+	}
+	return "file " + path + " (" + strings.Join(names, "|") + ")"
+}
+
+// syncFile is (*os.File).Sync, replaced by tests counting the syncs.
+var syncFile = (*os.File).Sync
+
+// closeFile doesn't fail when the callback closed the file itself, it warns with WarnDoubleClose.
+func closeFile(file *os.File, sync bool) error {
+	if sync {
+		err := syncFile(file)
+		if errors.Is(err, os.ErrClosed) {
+			warn(WarnDoubleClose, "file "+file.Name())
+			return nil
+		}
+		if err != nil {
+			return secondaryError(phaseError(PhaseRelease, err), "file "+file.Name(), phaseError(PhaseRelease, file.Close()))
+		}
+	}
+	err := file.Close()
+	if errors.Is(err, os.ErrClosed) {
+		warn(WarnDoubleClose, "file "+file.Name())
+		return nil
+	}
+	return err
+}
+
+// TempFileResource gives the callback a new temporary file, removed after the callback returns.
+// Concurrent calls get distinct files.
+//
+// Deprecated: use NewTempFileResource("", ""), a variable can be reassigned by any package.
+var TempFileResource FileResource = NewTempFileResource("", "")
+
+// NewTempFileResource gives the callback a new temporary file inside dir (os.TempDir() when empty),
+// named after pattern like os.CreateTemp does, and removed after the callback returns.
+// Concurrent calls get distinct files.
+func NewTempFileResource(dir, pattern string) FileResource {
+	description := "temp file " + filepath.Join(dir, pattern)
+	if dir == "" {
+		description = "temp file " + pattern
+	}
+	return newFileResource(description, func(callback FileResourceCallback) (err error) {
+		file, err := os.CreateTemp(dir, pattern)
+		if err != nil {
+			return phaseError(PhaseAcquire, err)
+		}
+		defer func() {
+			err = secondaryError(err, "file "+file.Name(), removeError(os.Remove(file.Name())))
+		}()
+		err = useCallback(callback, file)
+		releaseErr := closeFile(file, false)
+		if releaseErr == nil {
+			return err
+		}
+		return errors.Join(err, releaseErr)
+	})
+}
+
+// FileUsable returns f as a Usable.
+//
+// Deprecated: a FileResource is a Usable[*os.File] itself.
+func FileUsable(f FileResource) Usable[*os.File] {
+	return f
+}
+
+// NewTempDirResource gives the callback the path of a new temporary directory inside dir
+// (os.TempDir() when empty), removed with all its content after the callback returns.
+func NewTempDirResource(dir, pattern string) Resource[string] {
+	return Resource[string]{
+		Use: func(callback func(path string) error) error {
+			path, err := os.MkdirTemp(dir, pattern)
+			if err != nil {
+				return phaseError(PhaseAcquire, err)
+			}
+			err = useCallback(callback, path)
+			return errors.Join(err, phaseError(PhaseRelease, os.RemoveAll(path)))
+		},
+	}
+}
+
+// NewAtomicFileResource gives the callback a temporary file next to path
+// and renames it over path only if the callback succeeds,
+// so path never contains partially written content.
+//
+// Without the Sync option the rename may reach the disk before the content does:
+// after a power loss path can turn out to be empty.
+func NewAtomicFileResource(path string, perm os.FileMode, opts ...FileOption) FileResource {
+	options := newFileOptions(opts)
+
+	return newFileResource("atomic file "+path, func(callback FileResourceCallback) error {
+		created, err := options.makeParents(path)
+		if err != nil {
+			options.removeParents(created, err)
+			return phaseError(PhaseAcquire, err)
+		}
+		err = useAtomicFile(path, perm, &options, callback)
+		options.removeParents(created, err)
+		return err
+	})
+}
+
+func useAtomicFile(path string, perm os.FileMode, options *fileOptions, callback FileResourceCallback) error {
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+
+	err = useCallback(callback, file)
+	if err == nil {
+		err = file.Chmod(perm)
+	}
+	if err == nil && options.sync {
+		err = phaseError(PhaseRelease, syncFile(file))
+	}
+
+	if err != nil {
+		err = secondaryError(err, "file "+file.Name(), phaseError(PhaseRelease, closeFile(file, false)))
+		return secondaryError(err, "file "+file.Name(), removeError(os.Remove(file.Name())))
+	}
+
+	err = file.Close()
+	if err == nil && options.verify != nil {
+		err = NewReadFileResource(file.Name()).Use(options.verify)
+		if err != nil {
+			err = phaseError(PhaseRelease, fmt.Errorf("verify %s: %w", path, err))
+		}
+	}
+	if err == nil && options.skipUnchanged {
+		var same bool
+		same, err = sameContent(file.Name(), path)
+		if err == nil && same {
+			err = ErrUnchanged
+		}
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+	if err != nil {
+		return secondaryError(err, "file "+file.Name(), removeError(os.Remove(file.Name())))
+	}
+
+	if options.sync {
+		return phaseError(PhaseRelease, syncDir(filepath.Dir(path)))
+	}
+	return nil
+}
+
+// sameContent tells whether the files at a and b have the same content, false when b doesn't exist.
+func sameContent(a, b string) (bool, error) {
+	infoB, err := os.Stat(b)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	infoA, err := os.Stat(a)
+	if err != nil || infoA.Size() != infoB.Size() || !infoB.Mode().IsRegular() {
+		return false, err
+	}
+
+	return UseValue(NewReadFileResource(a), func(ra io.Reader) (bool, error) {
+		return UseValue(NewReadFileResource(b), func(rb io.Reader) (bool, error) {
+			bufA := make([]byte, 32*1024)
+			bufB := make([]byte, len(bufA))
+			for {
+				n, errA := io.ReadFull(ra, bufA)
+				_, errB := io.ReadFull(rb, bufB[:n])
+				if errB != nil && !errors.Is(errB, io.EOF) {
+					return false, errB
+				}
+				if !bytes.Equal(bufA[:n], bufB[:n]) {
+					return false, nil
+				}
+				if errors.Is(errA, io.EOF) || errors.Is(errA, io.ErrUnexpectedEOF) {
+					return true, nil
+				}
+				if errA != nil {
+					return false, errA
+				}
+			}
+		})
+	})
+}
+
+// syncDir makes a rename inside dir durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = syncFile(d)
+	return errors.Join(err, d.Close())
+}
+
+// The views below are the recommended way to work with files: the callback can neither
+// write to a file opened for reading, nor Close the file under the resource's feet.
+// Use NewFileResource when the callback really needs *os.File (Fd, Stat, Sync...).
+
+type fileReader struct{ file *os.File }
+type fileWriter struct{ file *os.File }
+type fileReadWriteSeeker struct{ file *os.File }
+
+func (r fileReader) Read(p []byte) (int, error)           { return r.file.Read(p) }
+func (w fileWriter) Write(p []byte) (int, error)          { return w.file.Write(p) }
+func (f fileReadWriteSeeker) Read(p []byte) (int, error)  { return f.file.Read(p) }
+func (f fileReadWriteSeeker) Write(p []byte) (int, error) { return f.file.Write(p) }
+func (f fileReadWriteSeeker) Seek(offset int64, whence int) (int64, error) {
+	return f.file.Seek(offset, whence)
+}
+
+// NewReadFileResource opens path read-only, the callback only gets an io.Reader.
+func NewReadFileResource(path string, opts ...FileOption) Resource[io.Reader] {
+	file := NewFileResource(path, os.O_RDONLY, 0, opts...)
+	return Resource[io.Reader]{
+		Description: describeFile(path, os.O_RDONLY),
+		Use: func(callback func(r io.Reader) error) error {
+			return file.Use(func(fd *os.File) error {
+				return callback(fileReader{fd})
+			})
+		},
+	}
+}
+
+// NewWriteFileResource opens path with flags, the callback only gets an io.Writer.
+func NewWriteFileResource(path string, flags int, perm os.FileMode, opts ...FileOption) Resource[io.Writer] {
+	options := newFileOptions(opts)
+	file := NewFileResource(path, flags, perm, opts...)
+	return Resource[io.Writer]{
+		Description: describeFile(path, flags),
+		Use: func(callback func(w io.Writer) error) error {
+			if options.journal == "" {
+				return file.Use(func(fd *os.File) error {
+					return callback(fileWriter{fd})
+				})
+			}
+			var written int64
+			err := file.Use(func(fd *os.File) error {
+				return callback(countingWriter{w: fileWriter{fd}, n: &written})
+			})
+			options.journalUse(path, written, err)
+			return err
+		},
+	}
+}
+
+// NewReadWriteFileResource opens path with flags, the callback gets an io.ReadWriteSeeker.
+func NewReadWriteFileResource(path string, flags int, perm os.FileMode, opts ...FileOption) Resource[io.ReadWriteSeeker] {
+	options := newFileOptions(opts)
+	file := NewFileResource(path, flags, perm, opts...)
+	return Resource[io.ReadWriteSeeker]{
+		Description: describeFile(path, flags),
+		Use: func(callback func(rws io.ReadWriteSeeker) error) error {
+			if options.journal == "" {
+				return file.Use(func(fd *os.File) error {
+					return callback(fileReadWriteSeeker{fd})
+				})
+			}
+			var written int64
+			err := file.Use(func(fd *os.File) error {
+				return callback(countingReadWriteSeeker{ReadWriteSeeker: fileReadWriteSeeker{fd}, n: &written})
+			})
+			options.journalUse(path, written, err)
+			return err
+		},
+	}
+}
@@ -0,0 +1,562 @@
+package resource_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+// recordSyncs makes the file resources record the names of the files they sync, failing with err.
+func recordSyncs(t *testing.T, err error) func() []string {
+	var mu sync.Mutex
+	var synced []string
+	resource.SetSyncFile(t, func(f *os.File) error {
+		mu.Lock()
+		defer mu.Unlock()
+		synced = append(synced, f.Name())
+		if err != nil {
+			return err
+		}
+		return f.Sync()
+	})
+	return func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(synced)
+	}
+}
+
+func writeHello(fd *os.File) error {
+	_, err := fd.WriteString("hello")
+	return err
+}
+
+func TestFileResourceSync(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.txt")
+	synced := recordSyncs(t, nil)
+
+	err := resource.NewFileResource(path, resource.NewFileFlag, 0o644).Use(writeHello)
+	if err != nil || len(synced()) != 0 {
+		t.Fatalf("Use = %v, synced %q without the Sync option", err, synced())
+	}
+	err = resource.NewFileResource(path, resource.NewFileFlag, 0o644, resource.Sync()).Use(writeHello)
+	if err != nil || !slices.Equal(synced(), []string{path}) {
+		t.Errorf("Use = %v, synced %q, want %s", err, synced(), path)
+	}
+
+	err = resource.NewFileResource(path, resource.NewFileFlag, 0o644, resource.Sync()).Use(func(fd *os.File) error {
+		return errors.New("boom")
+	})
+	if err == nil || len(synced()) != 1 {
+		t.Errorf("Use = %v, synced %q: a failed callback must not be synced", err, synced())
+	}
+}
+
+func TestAtomicFileResourceSyncsFileAndDirectory(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.txt")
+	synced := recordSyncs(t, nil)
+
+	err := resource.NewAtomicFileResource(path, 0o644, resource.Sync()).Use(writeHello)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := synced()
+	if len(got) != 2 || filepath.Dir(got[0]) != dir || got[0] == path || got[1] != dir {
+		t.Errorf("synced %q, want the temporary file then %s", got, dir)
+	}
+	if readFile(t, path) != "hello" {
+		t.Errorf("file = %q", readFile(t, path))
+	}
+}
+
+func TestSyncFailureIsReleaseError(t *testing.T) {
+	errSync := errors.New("sync failed")
+	recordSyncs(t, errSync)
+	dir := t.TempDir()
+
+	err := resource.NewFileResource(filepath.Join(dir, "plain.txt"), resource.NewFileFlag, 0o644, resource.Sync()).Use(writeHello)
+	if !errors.Is(err, errSync) || phaseOf(t, err) != resource.PhaseRelease {
+		t.Errorf("Use = %v, want a PhaseRelease %v", err, errSync)
+	}
+
+	path := filepath.Join(dir, "atomic.txt")
+	err = resource.NewAtomicFileResource(path, 0o644, resource.Sync()).Use(writeHello)
+	if !errors.Is(err, errSync) || phaseOf(t, err) != resource.PhaseRelease {
+		t.Errorf("atomic Use = %v, want a PhaseRelease %v", err, errSync)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("file renamed in place despite the failed sync: %v", err)
+	}
+}
+
+func benchmarkAtomicFile(b *testing.B, opts ...resource.FileOption) {
+	path := filepath.Join(b.TempDir(), "out.txt")
+	file := resource.NewAtomicFileResource(path, 0o644, opts...)
+	for range b.N {
+		if err := file.Use(writeHello); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkAtomicFile(b *testing.B) {
+	benchmarkAtomicFile(b)
+}
+
+func BenchmarkAtomicFileSync(b *testing.B) {
+	benchmarkAtomicFile(b, resource.Sync())
+}
+
+func TestFileViewsHideCloseAndWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "view.txt")
+	if err := os.WriteFile(path, []byte("content"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	warnings := captureWarnings(t)
+
+	// the callback of the *os.File resource can close the file under its feet
+	err := resource.NewFileResource(path, os.O_RDONLY, 0).Use(func(fd *os.File) error {
+		return fd.Close()
+	})
+	if err != nil || !hasWarning(warnings(), resource.WarnDoubleClose) {
+		t.Fatalf("Use = %v, warnings %v, want a double close warning", err, warnings())
+	}
+
+	views := map[string]func(callback func(v any) error) error{
+		"read": func(callback func(v any) error) error {
+			return resource.NewReadFileResource(path).Use(func(r io.Reader) error { return callback(r) })
+		},
+		"write": func(callback func(v any) error) error {
+			return resource.NewWriteFileResource(path, resource.NewFileFlag, 0o644).Use(func(w io.Writer) error { return callback(w) })
+		},
+		"read-write": func(callback func(v any) error) error {
+			return resource.NewReadWriteFileResource(path, os.O_RDWR, 0o644).Use(func(rws io.ReadWriteSeeker) error { return callback(rws) })
+		},
+	}
+	for name, use := range views {
+		before := len(warnings())
+		err := use(func(v any) error {
+			if _, ok := v.(io.Closer); ok {
+				t.Errorf("%s view can be closed", name)
+			}
+			if _, ok := v.(*os.File); ok {
+				t.Errorf("%s view is the *os.File", name)
+			}
+			return nil
+		})
+		if err != nil || len(warnings()) != before {
+			t.Errorf("%s view: Use = %v, warnings %v", name, err, warnings()[before:])
+		}
+	}
+
+	err = resource.NewReadFileResource(path).Use(func(r io.Reader) error {
+		if _, ok := r.(io.Writer); ok {
+			t.Error("read view can be written")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// countWarnings counts the warnings of kind.
+func countWarnings(warnings []resource.Warning, kind resource.WarningKind) int {
+	n := 0
+	for _, w := range warnings {
+		if w.Kind == kind {
+			n++
+		}
+	}
+	return n
+}
+
+func TestFileClosedByCallback(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		opts []resource.FileOption
+	}{
+		{"plain", nil},
+		{"synced", []resource.FileOption{resource.Sync()}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			warnings := captureWarnings(t)
+			path := filepath.Join(t.TempDir(), "closed")
+			err := resource.NewFileResource(path, os.O_CREATE|os.O_WRONLY, 0o644, test.opts...).Use(func(file *os.File) error {
+				_, err := file.WriteString("hello")
+				if err != nil {
+					return err
+				}
+				return file.Close()
+			})
+			if err != nil {
+				t.Errorf("Use = %v, want nil", err)
+			}
+			if n := countWarnings(warnings(), resource.WarnDoubleClose); n != 1 {
+				t.Errorf("%d WarnDoubleClose in %v, want one", n, warnings())
+			}
+			if content := readFile(t, path); content != "hello" {
+				t.Errorf("content = %q", content)
+			}
+		})
+	}
+}
+
+func TestFileResourceConcurrentUses(t *testing.T) {
+	file := resource.NewFileResource(tempFile(t), os.O_RDONLY, 0)
+	var mu sync.Mutex
+	fds := make(map[uintptr]bool)
+	var wg sync.WaitGroup
+	held := make(chan struct{})
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := file.Use(func(f *os.File) error {
+				mu.Lock()
+				fds[f.Fd()] = true
+				mu.Unlock()
+				<-held // all open at once
+				return nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(fds) == 10
+	})
+	close(held)
+	wg.Wait()
+}
+
+func TestTempFileResourceConcurrentUses(t *testing.T) {
+	dir := t.TempDir()
+	temp := resource.NewTempFileResource(dir, "concurrent-*")
+	var mu sync.Mutex
+	names := make(map[string]bool)
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := temp.Use(func(f *os.File) error {
+				mu.Lock()
+				defer mu.Unlock()
+				names[f.Name()] = true
+				_, err := f.WriteString(f.Name())
+				return err
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if len(names) != 10 {
+		t.Errorf("%d distinct temporary files for 10 Uses", len(names))
+	}
+	if entries := dirEntries(t, dir); len(entries) != 0 {
+		t.Errorf("temporary files left: %q", entries)
+	}
+}
+
+func TestWithMkdirAllCreatesNestedParents(t *testing.T) {
+	dir := t.TempDir()
+	for name, use := range map[string]func(path string) error{
+		"file": func(path string) error {
+			return resource.NewFileResource(path, resource.NewFileFlag, resource.OwnerRWOnly, resource.WithMkdirAll(0700)).Use(writeHello)
+		},
+		"atomic": func(path string) error {
+			return resource.NewAtomicFileResource(path, resource.OwnerRWOnly, resource.WithMkdirAll(0700)).Use(writeHello)
+		},
+		"write": func(path string) error {
+			return resource.NewWriteFileResource(path, resource.NewFileFlag, resource.OwnerRWOnly, resource.WithMkdirAll(0700)).Use(func(w io.Writer) error {
+				_, err := io.WriteString(w, "hello")
+				return err
+			})
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name, "reports", "2024", "jan.txt")
+			err := use(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := readFile(t, path); got != "hello" {
+				t.Errorf("content = %q", got)
+			}
+			info, err := os.Stat(filepath.Dir(path))
+			if err != nil || !info.IsDir() || info.Mode().Perm()&^0700 != 0 {
+				t.Errorf("parent = %v, %v, want a directory with 0700 at most", info, err)
+			}
+		})
+	}
+}
+
+func TestWithMkdirAllKeepsExistingDirs(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "out")
+	err := os.Mkdir(existing, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errWrite := errors.New("write failed")
+
+	path := filepath.Join(existing, "reports", "jan.txt")
+	err = resource.NewFileResource(path, resource.NewFileFlag, resource.OwnerRWOnly,
+		resource.WithMkdirAll(0700), resource.RemoveCreatedDirs()).Use(func(*os.File) error {
+		return errWrite
+	})
+	if !errors.Is(err, errWrite) {
+		t.Fatalf("Use = %v, want the callback error", err)
+	}
+	// jan.txt stays: the file remains when the callback fails, so reports isn't empty
+	if got := dirEntries(t, filepath.Join(existing, "reports")); !slices.Equal(got, []string{"jan.txt"}) {
+		t.Errorf("reports = %q", got)
+	}
+
+	os.Remove(path)
+	err = resource.NewAtomicFileResource(path, resource.OwnerRWOnly,
+		resource.WithMkdirAll(0700), resource.RemoveCreatedDirs()).Use(func(*os.File) error {
+		return errWrite
+	})
+	if !errors.Is(err, errWrite) {
+		t.Fatalf("Use = %v, want the callback error", err)
+	}
+	// reports existed already for this Use
+	if got := dirEntries(t, existing); !slices.Equal(got, []string{"reports"}) {
+		t.Errorf("out = %q, want the existing directories kept", got)
+	}
+}
+
+func TestWithMkdirAllRemovesCreatedDirsOnFailure(t *testing.T) {
+	dir := t.TempDir()
+	errWrite := errors.New("write failed")
+	failing := func(*os.File) error {
+		return errWrite
+	}
+
+	path := filepath.Join(dir, "out", "reports", "jan.txt")
+	err := resource.NewAtomicFileResource(path, resource.OwnerRWOnly, resource.WithMkdirAll(0700)).Use(failing)
+	if !errors.Is(err, errWrite) {
+		t.Fatalf("Use = %v, want the callback error", err)
+	}
+	if got := dirEntries(t, filepath.Join(dir, "out")); !slices.Equal(got, []string{"reports"}) {
+		t.Errorf("out = %q, want the directories kept without RemoveCreatedDirs", got)
+	}
+
+	err = os.RemoveAll(filepath.Join(dir, "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = resource.NewAtomicFileResource(path, resource.OwnerRWOnly, resource.WithMkdirAll(0700), resource.RemoveCreatedDirs()).Use(failing)
+	if !errors.Is(err, errWrite) {
+		t.Fatalf("Use = %v, want the callback error", err)
+	}
+	if got := dirEntries(t, dir); len(got) != 0 {
+		t.Errorf("temporary directory = %q, want the created directories removed", got)
+	}
+}
+
+func TestWithMkdirAllFailureIsAcquireError(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "out"), "a file, not a directory")
+
+	called := false
+	err := resource.NewFileResource(filepath.Join(dir, "out", "reports", "jan.txt"), resource.NewFileFlag, resource.OwnerRWOnly,
+		resource.WithMkdirAll(0700)).Use(func(*os.File) error {
+		called = true
+		return nil
+	})
+	if called || phaseOf(t, err) != resource.PhaseAcquire {
+		t.Errorf("Use below a file = %v, callback called %v, want an acquire error", err, called)
+	}
+}
+
+// verifyJSON is a verifier accepting a JSON object with a name, which can't write back what it reads.
+func verifyJSON(t *testing.T) func(r io.Reader) error {
+	return func(r io.Reader) error {
+		if _, ok := r.(io.Writer); ok {
+			t.Error("the verifier got a writable file")
+		}
+		var v struct{ Name string }
+		err := json.NewDecoder(r).Decode(&v)
+		if err == nil && v.Name == "" {
+			err = errors.New("no name")
+		}
+		return err
+	}
+}
+
+func TestAtomicFileResourceVerifyRejects(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "settings.json")
+	writeFile(t, path, `{"Name": "original"}`)
+
+	for _, content := range []string{`{"Name": "trunc`, `{"Other": 1}`} {
+		err := resource.NewAtomicFileResource(path, 0o644, resource.Verify(verifyJSON(t))).Use(func(fd *os.File) error {
+			_, err := fd.WriteString(content)
+			return err
+		})
+		if err == nil || phaseOf(t, err) != resource.PhaseRelease {
+			t.Errorf("Use writing %s = %v, want the release error of the verifier", content, err)
+		}
+		if got := readFile(t, path); got != `{"Name": "original"}` {
+			t.Errorf("content after a rejected write = %s, want the original", got)
+		}
+		if entries := dirEntries(t, dir); !slices.Equal(entries, []string{"settings.json"}) {
+			t.Errorf("files = %q, want the temporary file removed", entries)
+		}
+	}
+}
+
+func TestAtomicFileResourceVerifyAccepts(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "settings.json")
+	writeFile(t, path, `{"Name": "original"}`)
+
+	var verified string
+	err := resource.NewAtomicFileResource(path, 0o644, resource.Verify(func(r io.Reader) error {
+		data, err := io.ReadAll(r)
+		verified = string(data)
+		if err != nil {
+			return err
+		}
+		return verifyJSON(t)(bytes.NewReader(data))
+	})).Use(func(fd *os.File) error {
+		_, err := fd.WriteString(`{"Name": "new"}`)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verified != `{"Name": "new"}` {
+		t.Errorf("verified %q, want the complete new content", verified)
+	}
+	if got := readFile(t, path); got != `{"Name": "new"}` {
+		t.Errorf("content = %s, want the new one", got)
+	}
+	if entries := dirEntries(t, dir); !slices.Equal(entries, []string{"settings.json"}) {
+		t.Errorf("files = %q", entries)
+	}
+}
+
+// writeUnlessUnchanged writes content to path with SkipIfUnchanged.
+func writeUnlessUnchanged(path, content string) error {
+	return resource.NewAtomicFileResource(path, 0o644, resource.SkipIfUnchanged()).Use(func(fd *os.File) error {
+		_, err := fd.WriteString(content)
+		return err
+	})
+}
+
+func TestSkipIfUnchanged(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config")
+	// larger than the comparison buffer, the difference being at the very end
+	content := strings.Repeat("0123456789", 10_000)
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	for _, test := range []struct {
+		name, content string
+		unchanged     bool
+	}{
+		{"identical", content, true},
+		{"same size", content[:len(content)-1] + "!", false},
+		{"shorter", content[:len(content)-1], false},
+		{"empty", "", false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			writeFile(t, path, content)
+			err := os.Chtimes(path, old, old)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = writeUnlessUnchanged(path, test.content)
+			if test.unchanged != errors.Is(err, resource.ErrUnchanged) || !test.unchanged && err != nil {
+				t.Fatalf("Use = %v, want ErrUnchanged: %v", err, test.unchanged)
+			}
+			if got := readFile(t, path); got != test.content {
+				t.Errorf("content of %d bytes, want the %d written", len(got), len(test.content))
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if touched := !info.ModTime().Equal(old); touched == test.unchanged {
+				t.Errorf("mtime %v, want it kept: %v", info.ModTime(), test.unchanged)
+			}
+			if entries := dirEntries(t, dir); !slices.Equal(entries, []string{"config"}) {
+				t.Errorf("files = %q, want the temporary file gone", entries)
+			}
+		})
+	}
+}
+
+func TestSkipIfUnchangedWithoutTarget(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config")
+	for _, content := range []string{"", "new"} {
+		os.Remove(path)
+		err := writeUnlessUnchanged(path, content)
+		if err != nil {
+			t.Fatalf("Use writing %q without a target = %v", content, err)
+		}
+		if got := readFile(t, path); got != content {
+			t.Errorf("content = %q, want %q", got, content)
+		}
+	}
+}
+
+func TestFileResourceForms(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "forms.txt")
+	fr := resource.NewFileResource(path, resource.NewFileFlag, resource.OwnerRWOnly)
+	if got, want := fmt.Sprint(fr), "file "+path+" (O_WRONLY|O_CREATE)"; got != want || fr.Describe() != want {
+		t.Errorf("String = %q, Describe = %q, want %q", got, fr.Describe(), want)
+	}
+	if resource.FileUsable(fr) != resource.Usable[*os.File](fr) {
+		t.Error("FileUsable isn't the file resource itself")
+	}
+
+	// the function form FileResource had before it became an interface still compiles both ways
+	var old resource.FileResourceFunc = fr.Use
+	err := old(func(file *os.File) error {
+		_, err := file.WriteString("old ")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wrapped resource.FileResource = resource.FileResourceFunc(func(callback resource.FileResourceCallback) error {
+		return resource.NewFileResource(path, os.O_WRONLY|os.O_APPEND, 0).Use(callback)
+	})
+	err = wrapped.Use(func(file *os.File) error {
+		_, err := file.WriteString("new")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wrapped.Describe() != "file" {
+		t.Errorf("Describe of a FileResourceFunc = %q, want \"file\"", wrapped.Describe())
+	}
+	content, err := os.ReadFile(path)
+	if err != nil || string(content) != "old new" {
+		t.Errorf("content = %q, %v; want both writes", content, err)
+	}
+}
@@ -0,0 +1,105 @@
+package resource
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+var (
+	// ErrFileLocked is returned by TryFileLockResource when another holder has the lock.
+	ErrFileLocked = errors.New("file locked")
+	// ErrDBInUse is returned by TryWithDBLock when another holder has the lock of the database.
+	ErrDBInUse = errors.New("database in use")
+)
+
+// NewFileLockResource holds an exclusive advisory lock (flock) on path, created when missing,
+// for the callback, waiting for other holders to release it.
+//
+// The lock dies with its process, so a crashed holder leaves no stale lock, only the file;
+// the release removes the file while still holding the lock. A waiter which wakes up holding
+// the lock of a removed file opens path again, so two holders never lock different files.
+// Advisory locks are unsupported on some platforms and network filesystems: Use fails then.
+func NewFileLockResource(path string) Resource[struct{}] {
+	return fileLockResource(path, false)
+}
+
+// TryFileLockResource is NewFileLockResource which fails with ErrFileLocked instead of waiting.
+func TryFileLockResource(path string) Resource[struct{}] {
+	return fileLockResource(path, true)
+}
+
+func fileLockResource(path string, try bool) Resource[struct{}] {
+	return Resource[struct{}]{
+		Description: "lock " + path,
+		Use: func(callback func(struct{}) error) (err error) {
+			file, err := lockFile(path, try)
+			if err != nil {
+				return describedError(PhaseAcquire, "lock "+path, err)
+			}
+			defer func() {
+				// removed before unlocking, see lockFile
+				removeErr := os.Remove(path)
+				if errors.Is(removeErr, os.ErrNotExist) {
+					removeErr = nil
+				}
+				releaseErr := errors.Join(removeErr, unlockFile(file), file.Close())
+				if releaseErr != nil {
+					err = errors.Join(err, describedError(PhaseRelease, "lock "+path, releaseErr))
+				}
+			}()
+			return callback(struct{}{})
+		},
+	}
+}
+
+// lockFile opens and locks path until the locked file is the one at path:
+// the previous holder may have removed it while this one was waiting.
+func lockFile(path string, try bool) (*os.File, error) {
+	for {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+		if err != nil {
+			return nil, err
+		}
+		err = flockFile(file, try)
+		if err != nil {
+			return nil, errors.Join(err, file.Close())
+		}
+
+		locked, err := file.Stat()
+		if err == nil {
+			var current os.FileInfo
+			current, err = os.Stat(path)
+			if err == nil && os.SameFile(locked, current) {
+				return file, nil
+			}
+			if errors.Is(err, os.ErrNotExist) {
+				err = nil
+			}
+		}
+		closeErr := file.Close() // unlocks too
+		if err != nil {
+			return nil, errors.Join(err, closeErr)
+		}
+	}
+}
+
+// WithDBLock runs fn holding the lock of the sidecar file "<path>.lock" (see NewFileLockResource),
+// so that processes sharing the database at path, like sqlite files, take turns:
+// fn opens the database, typically with NewDBResource, and it's closed before the lock is released.
+func WithDBLock(path string, fn func() error) error {
+	return NewFileLockResource(path + ".lock").Use(func(struct{}) error {
+		return fn()
+	})
+}
+
+// TryWithDBLock is WithDBLock which fails with ErrDBInUse instead of waiting for another holder.
+func TryWithDBLock(path string, fn func() error) error {
+	err := TryFileLockResource(path + ".lock").Use(func(struct{}) error {
+		return fn()
+	})
+	if errors.Is(err, ErrFileLocked) {
+		return fmt.Errorf("%s: %w", path, ErrDBInUse)
+	}
+	return err
+}
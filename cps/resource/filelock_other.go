@@ -0,0 +1,16 @@
+//go:build !unix
+
+package resource
+
+import (
+	"errors"
+	"os"
+)
+
+func flockFile(*os.File, bool) error {
+	return errors.ErrUnsupported
+}
+
+func unlockFile(*os.File) error {
+	return errors.ErrUnsupported
+}
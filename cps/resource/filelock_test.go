@@ -0,0 +1,148 @@
+//go:build unix
+
+package resource_test
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/group"
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+func TestWithDBLockTakesTurns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "demo.sqlite")
+	var inside, overlaps atomic.Int64
+	g := group.NewSafeWaitGroup()
+	for range 2 {
+		g.Run(func() {
+			for range 50 {
+				err := resource.WithDBLock(path, func() error {
+					if inside.Add(1) > 1 {
+						overlaps.Add(1)
+					}
+					time.Sleep(100 * time.Microsecond)
+					inside.Add(-1)
+					return nil
+				})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		})
+	}
+	g.Wait()
+	if overlaps.Load() != 0 {
+		t.Errorf("%d overlapping holders", overlaps.Load())
+	}
+	if _, err := os.Stat(path + ".lock"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("lock file after the releases: %v, want it removed", err)
+	}
+}
+
+func TestTryWithDBLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "demo.sqlite")
+	errFn := errors.New("fn failed")
+	err := resource.WithDBLock(path, func() error {
+		err := resource.TryWithDBLock(path, func() error {
+			t.Error("fn ran while the lock was held")
+			return nil
+		})
+		if !errors.Is(err, resource.ErrDBInUse) {
+			t.Errorf("TryWithDBLock while held = %v, want ErrDBInUse", err)
+		}
+		return errFn
+	})
+	if !errors.Is(err, errFn) {
+		t.Errorf("WithDBLock = %v, want the error of fn", err)
+	}
+
+	ran := false
+	err = resource.TryWithDBLock(path, func() error {
+		ran = true
+		return nil
+	})
+	if err != nil || !ran {
+		t.Errorf("TryWithDBLock after the release = %v, ran %v", err, ran)
+	}
+}
+
+func TestWithDBLockStaleFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "demo.sqlite")
+	// left by a holder which crashed: the file is there, the lock died with the process
+	writeFile(t, path+".lock", "")
+	err := resource.TryWithDBLock(path, func() error { return nil })
+	if err != nil {
+		t.Fatalf("TryWithDBLock with a stale lock file = %v", err)
+	}
+	if _, err := os.Stat(path + ".lock"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("stale lock file: %v, want it removed", err)
+	}
+}
+
+// TestDBLockHelperProcess holds the lock of DB_LOCK_PATH for TestDBLockAcrossProcesses
+// until its stdin is closed, or it's killed.
+func TestDBLockHelperProcess(t *testing.T) {
+	path, ok := os.LookupEnv("DB_LOCK_PATH")
+	if !ok {
+		t.Skip("run by TestDBLockAcrossProcesses")
+	}
+	err := resource.WithDBLock(path, func() error {
+		os.Stdout.WriteString("locked\n")
+		_, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		return err
+	})
+	if err != nil && !errors.Is(err, io.EOF) {
+		os.Exit(1)
+	}
+}
+
+func TestDBLockAcrossProcesses(t *testing.T) {
+	if testing.Short() {
+		t.Skip("starts the test binary again")
+	}
+	path := filepath.Join(t.TempDir(), "demo.sqlite")
+	cmd := exec.Command(os.Args[0], "-test.run=^TestDBLockHelperProcess$")
+	cmd.Env = append(os.Environ(), "DB_LOCK_PATH="+path)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdin.Close()
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cmd.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil || line != "locked\n" {
+		t.Fatalf("helper printed %q, %v", line, err)
+	}
+
+	err = resource.TryWithDBLock(path, func() error { return nil })
+	if !errors.Is(err, resource.ErrDBInUse) {
+		t.Errorf("TryWithDBLock held by another process = %v, want ErrDBInUse", err)
+	}
+
+	// the lock dies with its holder
+	err = cmd.Process.Kill()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd.Wait()
+	err = resource.TryWithDBLock(path, func() error { return nil })
+	if err != nil {
+		t.Errorf("TryWithDBLock after the holder died = %v", err)
+	}
+}
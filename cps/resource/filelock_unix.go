@@ -0,0 +1,30 @@
+//go:build unix
+
+package resource
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+func flockFile(file *os.File, try bool) error {
+	how := syscall.LOCK_EX
+	if try {
+		how |= syscall.LOCK_NB
+	}
+	for {
+		err := syscall.Flock(int(file.Fd()), how)
+		if errors.Is(err, syscall.EINTR) {
+			continue
+		}
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return ErrFileLocked
+		}
+		return err
+	}
+}
+
+func unlockFile(file *os.File) error {
+	return syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+}
@@ -0,0 +1,49 @@
+package resource
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// FirstOf uses the first of the resources which opens successfully, trying them in order:
+// handy for a config file which can be in one of several places.
+// When none opens, all their errors are returned joined (open errors carry their paths).
+func FirstOf(resources ...FileResource) FileResource {
+	return firstOf(func(error) bool { return true }, resources)
+}
+
+// FirstExisting is FirstOf which only skips files that don't exist:
+// any other error, like a permission denied, stops the search.
+func FirstExisting(resources ...FileResource) FileResource {
+	return firstOf(func(err error) bool { return errors.Is(err, fs.ErrNotExist) }, resources)
+}
+
+func firstOf(skippable func(err error) bool, resources []FileResource) FileResource {
+	descriptions := make([]string, len(resources))
+	for i, fr := range resources {
+		descriptions[i] = fr.Describe()
+	}
+	return newFileResource("first of "+strings.Join(descriptions, ", "), func(callback FileResourceCallback) error {
+		var skipped []error
+		for _, fr := range resources {
+			called := false
+			err := fr.Use(func(file *os.File) error {
+				called = true
+				return callback(file)
+			})
+			if err == nil || called {
+				return err
+			}
+			skipped = append(skipped, err)
+			if !skippable(err) {
+				break
+			}
+		}
+		if len(skipped) == 0 {
+			return phaseError(PhaseAcquire, errors.New("no files to choose from"))
+		}
+		return errors.Join(skipped...)
+	})
+}
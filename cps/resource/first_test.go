@@ -0,0 +1,120 @@
+package resource_test
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+// candidates are three config paths in a temporary directory; only the ones in exist are created,
+// holding their own index.
+func candidates(t *testing.T, exist ...int) ([]string, []resource.FileResource) {
+	t.Helper()
+	dir := t.TempDir()
+	var paths []string
+	var resources []resource.FileResource
+	for i, name := range []string{"local.conf", "user.conf", "system.conf"} {
+		path := filepath.Join(dir, name)
+		paths = append(paths, path)
+		resources = append(resources, resource.NewFileResource(path, os.O_RDONLY, 0))
+		for _, e := range exist {
+			if e == i {
+				writeFile(t, path, name)
+			}
+		}
+	}
+	return paths, resources
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	err := os.WriteFile(path, []byte(content), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFirstOfEachPositionWins(t *testing.T) {
+	for winner, name := range []string{"local.conf", "user.conf", "system.conf"} {
+		t.Run(name, func(t *testing.T) {
+			exist := []int{winner}
+			if winner < 2 {
+				exist = append(exist, 2) // a later candidate is never opened
+			}
+			_, resources := candidates(t, exist...)
+			var got string
+			err := resource.FirstOf(resources...).Use(func(file *os.File) error {
+				content, err := os.ReadFile(file.Name())
+				got = string(content)
+				return err
+			})
+			if err != nil || got != name {
+				t.Errorf("FirstOf used %q, %v, want %q", got, err, name)
+			}
+		})
+	}
+}
+
+func TestFirstOfNoneOpens(t *testing.T) {
+	paths, resources := candidates(t)
+	err := resource.FirstOf(resources...).Use(func(*os.File) error {
+		t.Error("callback called without any file")
+		return nil
+	})
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("FirstOf = %v, want not exist errors", err)
+	}
+	for _, path := range paths {
+		if !strings.Contains(err.Error(), path) {
+			t.Errorf("error %q doesn't mention %s", err, path)
+		}
+	}
+
+	err = resource.FirstOf().Use(func(*os.File) error { return nil })
+	if phaseOf(t, err) != resource.PhaseAcquire {
+		t.Errorf("FirstOf without resources = %v", err)
+	}
+}
+
+func TestFirstOfCallbackErrorStops(t *testing.T) {
+	_, resources := candidates(t, 0, 1)
+	errBoom := errors.New("boom")
+	calls := 0
+	err := resource.FirstOf(resources...).Use(func(*os.File) error {
+		calls++
+		return errBoom
+	})
+	if !errors.Is(err, errBoom) || calls != 1 {
+		t.Errorf("FirstOf = %v after %d calls, want %v after 1", err, calls, errBoom)
+	}
+}
+
+func TestFirstExistingStopsOnOtherErrors(t *testing.T) {
+	paths, resources := candidates(t, 2)
+	// a path below a regular file fails with ENOTDIR: not a missing file, even running as root
+	blocker := filepath.Join(filepath.Dir(paths[0]), "blocker")
+	writeFile(t, blocker, "")
+	resources = append([]resource.FileResource{resources[0], resource.NewFileResource(filepath.Join(blocker, "x.conf"), os.O_RDONLY, 0)}, resources[1:]...)
+
+	err := resource.FirstExisting(resources...).Use(func(*os.File) error {
+		t.Error("search went on after an error other than not exist")
+		return nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "not a directory") {
+		t.Errorf("FirstExisting = %v", err)
+	}
+
+	used := false
+	err = resource.FirstOf(resources...).Use(func(*os.File) error {
+		used = true
+		return nil
+	})
+	if err != nil || !used {
+		t.Errorf("FirstOf = %v, want the search to skip any error", err)
+	}
+}
@@ -0,0 +1,53 @@
+package resource
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+)
+
+// NewFSFileResource opens name in fsys for every Use and closes it afterwards,
+// the close error joined with the callback's like NewFileResource does.
+// It makes the readers below work with embed.FS, os.DirFS or fstest.MapFS.
+// fs.FS is read-only: there are no writing variants.
+func NewFSFileResource(fsys fs.FS, name string) Resource[fs.File] {
+	return Resource[fs.File]{
+		Use: func(callback func(file fs.File) error) error {
+			file, err := fsys.Open(name)
+			if err != nil {
+				return err
+			}
+			err = useCallback(callback, file)
+			return errors.Join(err, file.Close())
+		},
+	}
+}
+
+// NewFSReadResource is NewReadFileResource for fsys.
+func NewFSReadResource(fsys fs.FS, name string) Resource[io.Reader] {
+	file := NewFSFileResource(fsys, name)
+	return Resource[io.Reader]{
+		Use: func(callback func(r io.Reader) error) error {
+			return file.Use(func(file fs.File) error {
+				// hide whatever else the file can do
+				return callback(struct{ io.Reader }{file})
+			})
+		},
+	}
+}
+
+// ReadAllFS returns the content of name in fsys.
+func ReadAllFS(fsys fs.FS, name string) ([]byte, error) {
+	return UseValue(NewFSReadResource(fsys, name), io.ReadAll)
+}
+
+// ForEachLineFS is ForEachLine for fsys.
+func ForEachLineFS(fsys fs.FS, name string, fn func(line string) error, opts ...LineOption) error {
+	return forEachLine(NewFSReadResource(fsys, name), fn, newLineOptions(opts))
+}
+
+// ReadJSONResourceFS is ReadJSONResource for fsys.
+func ReadJSONResourceFS(fsys fs.FS, name string) Resource[*json.Decoder] {
+	return jsonDecoderResource(NewFSReadResource(fsys, name))
+}
@@ -0,0 +1,131 @@
+package resource_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+var fsFiles = map[string]string{
+	"lines.txt":      "one\ntwo\r\n\nthree",
+	"long.txt":       strings.Repeat("x", 100) + "\n",
+	"data/user.json": `{"name": "gopher", "age": 13}`,
+}
+
+// fileSystems returns an os.DirFS and an fstest.MapFS with fsFiles.
+func fileSystems(t *testing.T) map[string]fs.FS {
+	t.Helper()
+	dir := t.TempDir()
+	mapFS := fstest.MapFS{}
+	for name, content := range fsFiles {
+		path := filepath.Join(dir, name)
+		err := os.MkdirAll(filepath.Dir(path), 0o755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeFile(t, path, content)
+		mapFS[name] = &fstest.MapFile{Data: []byte(content)}
+	}
+	return map[string]fs.FS{"os.DirFS": os.DirFS(dir), "fstest.MapFS": mapFS}
+}
+
+func TestFSReaders(t *testing.T) {
+	for name, fsys := range fileSystems(t) {
+		t.Run(name, func(t *testing.T) {
+			content, err := resource.ReadAllFS(fsys, "lines.txt")
+			if err != nil || string(content) != fsFiles["lines.txt"] {
+				t.Errorf("ReadAllFS = %q, %v", content, err)
+			}
+
+			var lines []string
+			err = resource.ForEachLineFS(fsys, "lines.txt", func(line string) error {
+				lines = append(lines, line)
+				return nil
+			})
+			if want := []string{"one", "two", "", "three"}; err != nil || !slices.Equal(lines, want) {
+				t.Errorf("ForEachLineFS = %q, %v, want %q", lines, err, want)
+			}
+			err = resource.ForEachLineFS(fsys, "long.txt", func(string) error { return nil }, resource.MaxLineSize(10))
+			if !errors.Is(err, bufio.ErrTooLong) {
+				t.Errorf("ForEachLineFS of a long line = %v, want bufio.ErrTooLong", err)
+			}
+
+			var user struct {
+				Name string
+				Age  int
+			}
+			err = resource.ReadJSONResourceFS(fsys, "data/user.json").Use(func(d *json.Decoder) error {
+				return d.Decode(&user)
+			})
+			if err != nil || user.Name != "gopher" || user.Age != 13 {
+				t.Errorf("ReadJSONResourceFS = %+v, %v", user, err)
+			}
+
+			_, err = resource.ReadAllFS(fsys, "missing.txt")
+			if !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("ReadAllFS of a missing file = %v, want fs.ErrNotExist", err)
+			}
+		})
+	}
+}
+
+func TestFSReadResourceIsReadOnly(t *testing.T) {
+	for name, fsys := range fileSystems(t) {
+		t.Run(name, func(t *testing.T) {
+			err := resource.NewFSReadResource(fsys, "lines.txt").Use(func(r io.Reader) error {
+				if _, ok := r.(io.Writer); ok {
+					t.Error("the reader is an io.Writer")
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+// closeFailingFS is an fs.FS whose files fail to close.
+type closeFailingFS struct{ fs.FS }
+
+type closeFailingFile struct{ fs.File }
+
+var errCloseFailed = errors.New("close failed")
+
+func (fsys closeFailingFS) Open(name string) (fs.File, error) {
+	file, err := fsys.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return closeFailingFile{file}, nil
+}
+
+func (f closeFailingFile) Close() error {
+	f.File.Close()
+	return errCloseFailed
+}
+
+func TestFSFileResourceJoinsCloseError(t *testing.T) {
+	fsys := closeFailingFS{fstest.MapFS{"a.txt": {Data: []byte("a")}}}
+	errCallback := errors.New("callback")
+	err := resource.NewFSFileResource(fsys, "a.txt").Use(func(fs.File) error {
+		return errCallback
+	})
+	if !errors.Is(err, errCallback) || !errors.Is(err, errCloseFailed) {
+		t.Errorf("Use = %v, want the callback and close errors", err)
+	}
+	_, err = resource.ReadAllFS(fsys, "a.txt")
+	if !errors.Is(err, errCloseFailed) {
+		t.Errorf("ReadAllFS = %v, want the close error", err)
+	}
+}
@@ -0,0 +1,124 @@
+package resource
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/group"
+)
+
+// ErrHealthCheckerStarted is returned by a second HealthChecker.Start.
+var ErrHealthCheckerStarted = errors.New("health checker is already started")
+
+// PingProbe is the default probe of NewHealthChecker: SELECT 1.
+func PingProbe(ctx context.Context, db *sql.DB) error {
+	var one int
+	return db.QueryRowContext(ctx, "SELECT 1").Scan(&one)
+}
+
+// HealthChecker probes a database periodically.
+// It is unhealthy until the first successful probe; then FailureThreshold consecutive failures
+// make it unhealthy, and SuccessThreshold consecutive successes healthy again.
+type HealthChecker struct {
+	// FailureThreshold and SuccessThreshold must be set before Start, they default to 3 and 1.
+	FailureThreshold int
+	SuccessThreshold int
+	// Timeout limits every probe, it defaults to the interval.
+	Timeout time.Duration
+	// Clock ticks the probes and times their Timeout, the real clock when nil. It must be set before Start.
+	Clock Clock
+
+	db       DBResource
+	interval time.Duration
+	probe    func(ctx context.Context, db *sql.DB) error
+
+	started   atomic.Bool
+	healthy   atomic.Bool
+	lastError atomic.Pointer[error]
+	runs      group.SafeWaitGroup
+
+	// used by the checking goroutine only
+	failures  int
+	successes int
+}
+
+// NewHealthChecker creates a checker running probe (PingProbe if nil) with db every interval.
+func NewHealthChecker(db DBResource, interval time.Duration, probe func(ctx context.Context, db *sql.DB) error) *HealthChecker {
+	if probe == nil {
+		probe = PingProbe
+	}
+	return &HealthChecker{
+		FailureThreshold: 3,
+		SuccessThreshold: 1,
+		Timeout:          interval,
+		db:               db,
+		interval:         interval,
+		probe:            probe,
+		runs:             group.NewSafeWaitGroup(),
+	}
+}
+
+// Start probes right away, then every interval in a goroutine of its own, until ctx is done.
+// Wait waits for that goroutine to finish.
+func (h *HealthChecker) Start(ctx context.Context) error {
+	if !h.started.CompareAndSwap(false, true) {
+		return ErrHealthCheckerStarted
+	}
+	h.runs.Run(func() {
+		ticker := clockOr(h.Clock).NewTicker(h.interval)
+		defer ticker.Stop()
+		for {
+			h.check(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C():
+			}
+		}
+	})
+	return nil
+}
+
+// Wait returns when the goroutine of Start is done, after its ctx was cancelled.
+func (h *HealthChecker) Wait() {
+	h.runs.Wait()
+}
+
+// Healthy tells whether the database is considered reachable.
+func (h *HealthChecker) Healthy() bool {
+	return h.healthy.Load()
+}
+
+// LastError is the error of the last probe, nil if it succeeded.
+func (h *HealthChecker) LastError() error {
+	if err := h.lastError.Load(); err != nil {
+		return *err
+	}
+	return nil
+}
+
+func (h *HealthChecker) check(ctx context.Context) {
+	ctx, cancel := withClockTimeout(ctx, clockOr(h.Clock), h.Timeout)
+	defer cancel()
+	err := h.db.Use(func(db *sql.DB) error {
+		return h.probe(ctx, db)
+	})
+	h.lastError.Store(&err)
+
+	if err != nil {
+		h.successes = 0
+		h.failures++
+		if h.failures >= h.FailureThreshold {
+			h.healthy.Store(false)
+		}
+		return
+	}
+	h.failures = 0
+	h.successes++
+	if h.successes >= h.SuccessThreshold {
+		h.healthy.Store(true)
+	}
+}
@@ -0,0 +1,108 @@
+package resource_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+func TestHealthCheckerThresholds(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "health.db")
+	clock := newFakeClock()
+	var healthyBefore []bool // Healthy as seen by every probe, so after all the previous ones
+	probed := make(chan error)
+	var h *resource.HealthChecker
+	h = resource.NewHealthChecker(resource.NewDBResource("flaky", dsn), time.Second, func(ctx context.Context, db *sql.DB) error {
+		healthyBefore = append(healthyBefore, h.Healthy())
+		err := resource.PingProbe(ctx, db)
+		probed <- err
+		return err
+	})
+	h.Clock = clock
+	if h.FailureThreshold != 3 || h.SuccessThreshold != 1 {
+		t.Errorf("thresholds %d and %d, want 3 and 1 by default", h.FailureThreshold, h.SuccessThreshold)
+	}
+	if h.Healthy() {
+		t.Error("healthy before the first probe")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	down := []bool{false, true, true, true, false, true, false}
+	for i, isDown := range down {
+		flaky.setDown(dsn, isDown)
+		if i == 0 {
+			if err := h.Start(ctx); err != nil {
+				t.Fatal(err)
+			}
+		} else {
+			clock.Advance(time.Second)
+		}
+		if err := <-probed; (err != nil) != isDown {
+			t.Fatalf("probe %d = %v, want it down %v", i, err, isDown)
+		}
+	}
+	cancel()
+	h.Wait()
+
+	// unhealthy until the first success, then after 3 failures, healthy again after 1 success
+	want := []bool{false, true, true, true, false, true, true}
+	if !slices.Equal(healthyBefore, want) {
+		t.Errorf("healthy before every probe %v, want %v", healthyBefore, want)
+	}
+	if !h.Healthy() || h.LastError() != nil {
+		t.Errorf("Healthy = %v with %v after a success", h.Healthy(), h.LastError())
+	}
+}
+
+func TestHealthCheckerLastError(t *testing.T) {
+	errProbe := errors.New("probe")
+	probed := make(chan struct{})
+	h := resource.NewHealthChecker(resource.NewDBResource("sqlite3", filepath.Join(t.TempDir(), "health.db")), time.Hour,
+		func(ctx context.Context, db *sql.DB) error {
+			defer close(probed)
+			return errProbe
+		})
+	h.FailureThreshold = 1
+	ctx, cancel := context.WithCancel(context.Background())
+	err := h.Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Start(ctx); !errors.Is(err, resource.ErrHealthCheckerStarted) {
+		t.Errorf("second Start = %v, want %v", err, resource.ErrHealthCheckerStarted)
+	}
+	<-probed
+	cancel()
+	h.Wait()
+	if !errors.Is(h.LastError(), errProbe) || h.Healthy() {
+		t.Errorf("Healthy = %v with %v, want the error of the probe", h.Healthy(), h.LastError())
+	}
+}
+
+func TestHealthCheckerStopsOnCancel(t *testing.T) {
+	h := resource.NewHealthChecker(resource.NewDBResource("sqlite3", filepath.Join(t.TempDir(), "health.db")), time.Millisecond, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	err := h.Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, h.Healthy)
+	cancel()
+	done := make(chan struct{})
+	go func() {
+		h.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("health checker still running a second after the cancel")
+	}
+}
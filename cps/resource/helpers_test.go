@@ -0,0 +1,179 @@
+package resource_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+	"github.com/Q69K/using-cps-in-golang/cps/resource/resourcetest"
+	"github.com/mattn/go-sqlite3"
+)
+
+// openDB opens a new sqlite database file in the temporary directory of the test,
+// with the table items (id, name), closed when the test finishes.
+func openDB(t testing.TB) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+	})
+	_, err = db.Exec("CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT NOT NULL)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// countItems counts the rows of the items table.
+func countItems(t testing.TB, db *sql.DB) int {
+	t.Helper()
+	var n int
+	err := db.QueryRow("SELECT COUNT(*) FROM items").Scan(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// captureWarnings records the warnings reported until the test finishes.
+func captureWarnings(t testing.TB) func() []resource.Warning {
+	t.Helper()
+	var mu sync.Mutex
+	var warnings []resource.Warning
+	resource.SetWarningHandler(func(w resource.Warning) {
+		mu.Lock()
+		defer mu.Unlock()
+		warnings = append(warnings, w)
+	})
+	t.Cleanup(func() {
+		resource.SetWarningHandler(nil)
+	})
+	return func() []resource.Warning {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]resource.Warning(nil), warnings...)
+	}
+}
+
+// hasWarning tells whether one of the warnings is of kind.
+func hasWarning(warnings []resource.Warning, kind resource.WarningKind) bool {
+	for _, w := range warnings {
+		if w.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// phaseOf is the phase of the *resource.ResourceError err is, failing the test when it's none.
+func phaseOf(t testing.TB, err error) resource.Phase {
+	t.Helper()
+	var resourceErr *resource.ResourceError
+	if !errors.As(err, &resourceErr) {
+		t.Fatalf("got %v, want a *resource.ResourceError", err)
+	}
+	return resourceErr.Phase
+}
+
+// epoch is the start of the fake clocks of the tests.
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func newFakeClock() *resourcetest.FakeClock {
+	return resourcetest.NewFakeClock(epoch)
+}
+
+// recorder is the driver "recording", with the capabilities of Postgres: it records the statements
+// executed through it by data source name, and fails everything but Exec.
+var recorder = &recordingDriver{queries: make(map[string][]string)}
+
+func init() {
+	sql.Register("recording", recorder)
+	resource.RegisterCapabilities("recording", resource.Capabilities{Returning: true, Savepoints: true, Placeholders: resource.Dollar})
+}
+
+type recordingDriver struct {
+	mu      sync.Mutex
+	queries map[string][]string
+}
+
+func (d *recordingDriver) Open(name string) (driver.Conn, error) {
+	return &recordingConn{driver: d, name: name}, nil
+}
+
+// recorded returns the statements executed through the data source name.
+func (d *recordingDriver) recorded(name string) []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.queries[name]...)
+}
+
+type recordingConn struct {
+	driver *recordingDriver
+	name   string
+}
+
+func (c *recordingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.driver.mu.Lock()
+	defer c.driver.mu.Unlock()
+	c.driver.queries[c.name] = append(c.driver.queries[c.name], query)
+	return driver.RowsAffected(1), nil
+}
+
+func (c *recordingConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("recording: prepare not supported")
+}
+
+func (c *recordingConn) Close() error { return nil }
+
+func (c *recordingConn) Begin() (driver.Tx, error) { return recordingTx{}, nil }
+
+type recordingTx struct{}
+
+func (recordingTx) Commit() error   { return nil }
+func (recordingTx) Rollback() error { return nil }
+
+// eventually polls cond until it holds, failing the test after a second.
+func eventually(t testing.TB, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met after a second")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+var countingDrivers atomic.Int64
+
+// countingSQLite registers a resourcetest.CountingDriver over sqlite3 under a new name, returned with it.
+func countingSQLite(t testing.TB) (*resourcetest.CountingDriver, string) {
+	name := fmt.Sprintf("counting-sqlite3-%d", countingDrivers.Add(1))
+	return resourcetest.RegisterCountingDriver(name, &sqlite3.SQLiteDriver{}), name
+}
+
+// dirEntries returns the names of the entries of dir.
+func dirEntries(t testing.TB, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
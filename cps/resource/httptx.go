@@ -0,0 +1,79 @@
+package resource
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+)
+
+type txContextKey struct{}
+
+// TxFromContext returns the transaction TxMiddleware stored in the request context.
+func TxFromContext(ctx context.Context) (*sql.Tx, bool) {
+	tx, ok := ctx.Value(txContextKey{}).(*sql.Tx)
+	return tx, ok
+}
+
+// TxMiddleware runs every request inside a transaction, fetched by the handlers with TxFromContext.
+// The transaction is committed when the handler returns with a status below 500,
+// and rolled back when it fails with a 5xx or panics; the panic goes on after the rollback.
+//
+// The transaction is bound to the request context, so a client going away rolls it back.
+// A commit is attempted after the handler wrote its response: when it fails the client
+// gets a 500 only if nothing was written yet.
+func TxMiddleware(db *sql.DB, opts *sql.TxOptions) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tx, err := db.BeginTx(r.Context(), opts)
+			if err != nil {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			open := trackOpen("tx")
+			defer open.release()
+
+			recorder := &statusRecorder{ResponseWriter: w}
+			committed := false
+			defer func() {
+				if !committed {
+					swallowedError("tx", tx.Rollback())
+				}
+			}()
+			next.ServeHTTP(recorder, r.WithContext(context.WithValue(r.Context(), txContextKey{}, tx)))
+
+			if recorder.status >= http.StatusInternalServerError {
+				return
+			}
+			committed = true
+			err = tx.Commit()
+			if err != nil && recorder.status == 0 {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			}
+		})
+	}
+}
+
+// statusRecorder remembers the status written by a handler, 0 while none is.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(p)
+}
+
+// Unwrap lets http.ResponseController reach the optional interfaces of the original writer.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
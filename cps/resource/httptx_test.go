@@ -0,0 +1,128 @@
+package resource_test
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+// insertingHandler inserts an item in the transaction of the request, then responds with status.
+func insertingHandler(t *testing.T, status int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tx, ok := resource.TxFromContext(r.Context())
+		if !ok {
+			t.Error("no transaction in the request context")
+			return
+		}
+		if err := insertItem(tx, "request"); err != nil {
+			t.Error(err)
+		}
+		w.WriteHeader(status)
+	})
+}
+
+func TestTxMiddleware(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		status    int
+		committed int
+	}{
+		{"ok", http.StatusOK, 1},
+		{"client error", http.StatusNotFound, 1},
+		{"server error", http.StatusInternalServerError, 0},
+		{"unavailable", http.StatusServiceUnavailable, 0},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			db := openDB(t)
+			w := httptest.NewRecorder()
+			resource.TxMiddleware(db, nil)(insertingHandler(t, test.status)).ServeHTTP(w, httptest.NewRequest("POST", "/", nil))
+			if w.Code != test.status {
+				t.Errorf("status %d, want the one of the handler, %d", w.Code, test.status)
+			}
+			if n := countItems(t, db); n != test.committed {
+				t.Errorf("%d rows committed, want %d", n, test.committed)
+			}
+			if db.Stats().InUse != 0 {
+				t.Error("connection of the transaction still in use")
+			}
+		})
+	}
+}
+
+func TestTxMiddlewareImplicitOK(t *testing.T) {
+	db := openDB(t)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tx, _ := resource.TxFromContext(r.Context())
+		if err := insertItem(tx, "request"); err != nil {
+			t.Error(err)
+		}
+		// neither WriteHeader nor Write: a 200
+	})
+	w := httptest.NewRecorder()
+	resource.TxMiddleware(db, nil)(handler).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusOK || countItems(t, db) != 1 {
+		t.Errorf("status %d with %d rows, want the transaction committed", w.Code, countItems(t, db))
+	}
+}
+
+func TestTxMiddlewarePanic(t *testing.T) {
+	db := openDB(t)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tx, _ := resource.TxFromContext(r.Context())
+		if err := insertItem(tx, "request"); err != nil {
+			t.Error(err)
+		}
+		panic("boom")
+	})
+	func() {
+		defer func() {
+			if r := recover(); r != "boom" {
+				t.Errorf("recovered %v, want the panic to go on after the rollback", r)
+			}
+		}()
+		resource.TxMiddleware(db, nil)(handler).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/", nil))
+	}()
+	if n := countItems(t, db); n != 0 {
+		t.Errorf("%d rows committed by a panicking handler", n)
+	}
+	if db.Stats().InUse != 0 {
+		t.Error("connection of the transaction still in use")
+	}
+}
+
+func TestTxMiddlewareCommitFails(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db")+"?_foreign_keys=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	_, err = db.Exec(`
+		CREATE TABLE items (id INTEGER PRIMARY KEY);
+		CREATE TABLE children (parent INTEGER REFERENCES items (id) DEFERRABLE INITIALLY DEFERRED);
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tx, _ := resource.TxFromContext(r.Context())
+		_, err := tx.Exec("INSERT INTO children (parent) VALUES (42)") // checked at commit
+		if err != nil {
+			t.Error(err)
+		}
+	})
+	w := httptest.NewRecorder()
+	resource.TxMiddleware(db, nil)(handler).ServeHTTP(w, httptest.NewRequest("POST", "/", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status %d, want a 500 for the failed commit before anything was written", w.Code)
+	}
+}
+
+func TestTxFromContextOutsideMiddleware(t *testing.T) {
+	if _, ok := resource.TxFromContext(httptest.NewRequest("GET", "/", nil).Context()); ok {
+		t.Error("TxFromContext found a transaction outside TxMiddleware")
+	}
+}
@@ -0,0 +1,95 @@
+package resource
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrAlreadyApplied matches every *AlreadyAppliedError with errors.Is.
+var ErrAlreadyApplied = errors.New("transaction already applied")
+
+// AlreadyAppliedError is returned for a transaction of WithIdempotencyKey whose key was committed before:
+// its callback wasn't run again.
+type AlreadyAppliedError struct {
+	Key       string
+	AppliedAt time.Time
+}
+
+func (e *AlreadyAppliedError) Error() string {
+	return fmt.Sprintf("%v: key %q at %s", ErrAlreadyApplied, e.Key, e.AppliedAt.Format(time.RFC3339))
+}
+
+func (e *AlreadyAppliedError) Is(target error) bool {
+	return target == ErrAlreadyApplied
+}
+
+// IdempotencyMigration creates the tx_idempotency table of WithIdempotencyKey, add it to the migrations of Migrate.
+func IdempotencyMigration(version int) Migration {
+	return Migration{
+		Version: version,
+		Name:    "create tx_idempotency",
+		Up: `CREATE TABLE IF NOT EXISTS tx_idempotency (
+	idempotency_key TEXT PRIMARY KEY,
+	applied_at TIMESTAMP NOT NULL
+)`,
+	}
+}
+
+// WithIdempotencyKey records key in the tx_idempotency table (see IdempotencyMigration)
+// inside the transaction, before the callback. When key is there already, committed by an earlier
+// transaction, the callback isn't run and Use returns an *AlreadyAppliedError: a transaction which
+// committed but whose caller didn't learn it can be run again safely. RunTransactionRetry stops retrying then.
+//
+// Concurrent transactions of the same key are told apart by the primary key of the table:
+// the loser fails on its insert, and gets the *AlreadyAppliedError once the winner committed.
+func WithIdempotencyKey(key string) TxOption {
+	return func(options *txOptions) {
+		options.idempotencyKey = key
+	}
+}
+
+// keyInsertError is the error of recording the idempotency key.
+type keyInsertError struct {
+	err error
+}
+
+func (e *keyInsertError) Error() string {
+	return "record idempotency key: " + e.err.Error()
+}
+
+func (e *keyInsertError) Unwrap() error {
+	return e.err
+}
+
+// idempotent records the idempotency key before running callback.
+func (options *txOptions) idempotent(callback func(tx *sql.Tx) error) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		style := placeholderStyleOf(tx)
+		_, err := tx.ExecContext(TxContext(tx), "INSERT INTO tx_idempotency (idempotency_key, applied_at) VALUES ("+
+			style.placeholder(1)+", "+style.placeholder(2)+")", options.idempotencyKey, clockOr(options.clock).Now().UTC())
+		if err != nil {
+			return &keyInsertError{err: err}
+		}
+		return callback(tx)
+	}
+}
+
+// alreadyApplied turns the failure to record the idempotency key into an *AlreadyAppliedError
+// when the key is recorded, the transaction being over.
+func (options *txOptions) alreadyApplied(ctx context.Context, db *sql.DB, err error) error {
+	var insertErr *keyInsertError
+	if !errors.As(err, &insertErr) {
+		return err
+	}
+	var appliedAt time.Time
+	queryErr := db.QueryRowContext(ctx, "SELECT applied_at FROM tx_idempotency WHERE idempotency_key = "+placeholderStyleOf(db).placeholder(1),
+		options.idempotencyKey).Scan(&appliedAt)
+	if queryErr != nil {
+		// not recorded yet, or the insert failed for another reason
+		return err
+	}
+	return &AlreadyAppliedError{Key: options.idempotencyKey, AppliedAt: appliedAt}
+}
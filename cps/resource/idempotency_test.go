@@ -0,0 +1,138 @@
+package resource_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/group"
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+	"github.com/Q69K/using-cps-in-golang/cps/sqlerr"
+)
+
+// openIdempotentDB opens a database like openDB's with the tx_idempotency table,
+// whose connections wait for each other's locks.
+func openIdempotentDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db")+"?_busy_timeout=5000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+	})
+	err = resource.Migrate(db, []resource.Migration{
+		{Version: 1, Name: "create items", Up: "CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT NOT NULL)"},
+		resource.IdempotencyMigration(2),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestIdempotencyKeyAfterCommit(t *testing.T) {
+	db := openIdempotentDB(t)
+	clock := newFakeClock()
+	runs := 0
+	insert := func(tx *sql.Tx) error {
+		runs++
+		return insertItem(tx, "payment")
+	}
+
+	err := resource.RunTransaction(db, resource.WithIdempotencyKey("payment-1"), resource.TxClock(clock)).Use(insert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the caller crashed before learning of the commit, and runs the transaction again
+	clock.Advance(time.Hour)
+	err = resource.RunTransaction(db, resource.WithIdempotencyKey("payment-1"), resource.TxClock(clock)).Use(insert)
+	var applied *resource.AlreadyAppliedError
+	if !errors.Is(err, resource.ErrAlreadyApplied) || !errors.As(err, &applied) {
+		t.Fatalf("second Use = %v, want ErrAlreadyApplied", err)
+	}
+	if applied.Key != "payment-1" || !applied.AppliedAt.Equal(epoch) {
+		t.Errorf("error = %+v, want the key applied at %v", applied, epoch)
+	}
+	if runs != 1 || countItems(t, db) != 1 {
+		t.Errorf("callback ran %d times for %d items, want once", runs, countItems(t, db))
+	}
+
+	// RunTransactionRetry doesn't retry it
+	attempts := 0
+	policy := resource.RetryPolicy{Attempts: 3, Delay: func(int) time.Duration {
+		attempts++
+		return 0
+	}}
+	err = resource.RunTransactionRetry(context.Background(), db, policy, resource.WithIdempotencyKey("payment-1")).Use(insert)
+	if !errors.Is(err, resource.ErrAlreadyApplied) || attempts != 0 || runs != 1 {
+		t.Errorf("RunTransactionRetry = %v after %d retries and %d runs, want ErrAlreadyApplied at once", err, attempts, runs)
+	}
+}
+
+func TestIdempotencyKeyRolledBack(t *testing.T) {
+	db := openIdempotentDB(t)
+	errFail := errors.New("failed")
+	err := resource.RunTransaction(db, resource.WithIdempotencyKey("k")).Use(func(tx *sql.Tx) error {
+		err := insertItem(tx, "a")
+		if err != nil {
+			return err
+		}
+		return errFail
+	})
+	if !errors.Is(err, errFail) {
+		t.Fatalf("Use = %v, want the callback error", err)
+	}
+	// the key was rolled back with the rest
+	err = resource.RunTransaction(db, resource.WithIdempotencyKey("k")).Use(func(tx *sql.Tx) error {
+		return insertItem(tx, "a")
+	})
+	if err != nil || countItems(t, db) != 1 {
+		t.Errorf("Use after the rollback = %v with %d items, want it applied", err, countItems(t, db))
+	}
+}
+
+func TestIdempotencyKeyConcurrentDuplicates(t *testing.T) {
+	db := openIdempotentDB(t)
+	policy := resource.RetryPolicy{Attempts: 5, Delay: func(int) time.Duration { return time.Millisecond }, Classify: sqlerr.IsBusy}
+	var applied, duplicates atomic.Int64
+	g := group.NewSafeWaitGroup()
+	for range 10 {
+		g.Run(func() {
+			err := resource.RunTransactionRetry(context.Background(), db, policy, resource.WithIdempotencyKey("order-7")).Use(func(tx *sql.Tx) error {
+				return insertItem(tx, "order")
+			})
+			switch {
+			case err == nil:
+				applied.Add(1)
+			case errors.Is(err, resource.ErrAlreadyApplied):
+				duplicates.Add(1)
+			default:
+				t.Error(err)
+			}
+		})
+	}
+	g.Wait()
+	if applied.Load() != 1 || duplicates.Load() != 9 || countItems(t, db) != 1 {
+		t.Errorf("%d applied and %d duplicates with %d items, want one applied", applied.Load(), duplicates.Load(), countItems(t, db))
+	}
+}
+
+func TestIdempotencyDistinctKeys(t *testing.T) {
+	db := openIdempotentDB(t)
+	for _, key := range []string{"a", "b", "c"} {
+		err := resource.RunTransaction(db, resource.WithIdempotencyKey(key)).Use(func(tx *sql.Tx) error {
+			return insertItem(tx, key)
+		})
+		if err != nil {
+			t.Fatalf("key %s: %v", key, err)
+		}
+	}
+	if n := countItems(t, db); n != 3 {
+		t.Errorf("%d items, want one per key", n)
+	}
+}
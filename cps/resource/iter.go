@@ -0,0 +1,18 @@
+package resource
+
+import (
+	"errors"
+	"iter"
+)
+
+var errStopRows = errors.New("stop rows iteration")
+
+// Rows runs the query and iterates over its rows scanned into T:
+//
+//	for name, err := range Rows[string](db, "SELECT name FROM names WHERE id > ?", n) {
+//
+// The rows are closed when the loop ends, early break and return included.
+// A scan, rows.Err() or close error is yielded as the last element.
+func Rows[T any](q Queryer, query string, args ...any) iter.Seq2[T, error] {
+	return RowsWith[T](q, query, args)
+}
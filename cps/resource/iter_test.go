@@ -0,0 +1,145 @@
+package resource_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+// closingQueryer records the rows its queries return, to check they are closed.
+type closingQueryer struct {
+	*sql.DB
+	rows []*sql.Rows
+}
+
+func (q *closingQueryer) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	rows, err := q.DB.QueryContext(ctx, query, args...)
+	if rows != nil {
+		q.rows = append(q.rows, rows)
+	}
+	return rows, err
+}
+
+// closed tells whether every rows returned was closed, which gave its connection back.
+func (q *closingQueryer) closed() bool {
+	return len(q.rows) > 0 && q.DB.Stats().InUse == 0
+}
+
+func insertItems(t *testing.T, db *sql.DB, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		_, err := db.Exec("INSERT INTO items (name) VALUES (?)", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+type item struct {
+	ID   int64  `db:"id"`
+	Name string `db:"name"`
+}
+
+func TestRowsIterates(t *testing.T) {
+	db := openDB(t)
+	insertItems(t, db, "a", "b", "c")
+	q := &closingQueryer{DB: db}
+
+	var items []item
+	for it, err := range resource.Rows[item](q, "SELECT id, name FROM items WHERE id > ? ORDER BY id", 1) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		items = append(items, it)
+	}
+	if len(items) != 2 || items[0] != (item{2, "b"}) || items[1] != (item{3, "c"}) {
+		t.Errorf("items = %v", items)
+	}
+	if !q.closed() {
+		t.Error("rows left open")
+	}
+}
+
+func TestRowsEarlyBreakCloses(t *testing.T) {
+	db := openDB(t)
+	insertItems(t, db, "a", "b", "c")
+	q := &closingQueryer{DB: db}
+
+	var names []string
+	for name, err := range resource.Rows[string](q, "SELECT name FROM items ORDER BY id") {
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+		if len(names) == 2 {
+			break
+		}
+	}
+	if len(names) != 2 {
+		t.Errorf("names = %q", names)
+	}
+	if !q.closed() {
+		t.Error("rows left open after break")
+	}
+
+	find := func() string {
+		for name, err := range resource.Rows[string](q, "SELECT name FROM items ORDER BY id") {
+			if err == nil && name == "b" {
+				return name
+			}
+		}
+		return ""
+	}
+	if find() != "b" || !q.closed() {
+		t.Error("rows left open after return")
+	}
+}
+
+func TestRowsScanErrorMidStream(t *testing.T) {
+	db := openDB(t)
+	insertItems(t, db, "1", "2", "three", "4")
+	q := &closingQueryer{DB: db}
+
+	var ids []int
+	var errs []error
+	for id, err := range resource.Rows[int](q, "SELECT name FROM items ORDER BY id") {
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) != 2 || len(errs) != 1 {
+		t.Errorf("ids %v, errors %v; want 2 ids then the scan error", ids, errs)
+	}
+	if !q.closed() {
+		t.Error("rows left open after the scan error")
+	}
+}
+
+func TestRowsEmpty(t *testing.T) {
+	db := openDB(t)
+	q := &closingQueryer{DB: db}
+	for it, err := range resource.Rows[item](q, "SELECT id, name FROM items") {
+		t.Errorf("yielded %v, %v for no rows", it, err)
+	}
+	if !q.closed() {
+		t.Error("rows left open")
+	}
+}
+
+func TestRowsQueryError(t *testing.T) {
+	db := openDB(t)
+	n := 0
+	for _, err := range resource.Rows[item](db, "SELECT id, name FROM missing") {
+		n++
+		if err == nil {
+			t.Error("yielded a row of a missing table")
+		}
+	}
+	if n != 1 {
+		t.Errorf("%d elements yielded, want the error only", n)
+	}
+}
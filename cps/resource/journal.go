@@ -0,0 +1,91 @@
+package resource
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// JournalRecord is a line of the journal of WithJournal, in JSON.
+type JournalRecord struct {
+	Time  time.Time `json:"time"`
+	Path  string    `json:"path"`
+	Bytes int64     `json:"bytes"`
+	// Error is the error of the Use, empty when it succeeded.
+	Error string `json:"error,omitempty"`
+}
+
+// WithJournal makes NewWriteFileResource and NewReadWriteFileResource append a JournalRecord
+// to journalPath after every Use, fsynced, whether the Use succeeded or not.
+// The other file resources ignore it.
+//
+// A journal failure doesn't fail the Use: it is reported as a WarnJournalFailed warning.
+func WithJournal(journalPath string) FileOption {
+	return func(options *fileOptions) {
+		options.journal = journalPath
+	}
+}
+
+// JournalClock dates the records of WithJournal with clock.
+func JournalClock(clock Clock) FileOption {
+	return func(options *fileOptions) {
+		options.journalClock = clock
+	}
+}
+
+// journalLocks keeps the records of concurrent Uses whole.
+var journalLocks sync.Map // journal path -> *sync.Mutex
+
+// writeJournal appends record, a JournalRecord or a FallbackWrite, to the journal.
+func writeJournal(journalPath string, record any) {
+	line, err := json.Marshal(record)
+	if err == nil {
+		lock, _ := journalLocks.LoadOrStore(journalPath, new(sync.Mutex))
+		lock.(*sync.Mutex).Lock()
+		defer lock.(*sync.Mutex).Unlock()
+		err = NewFileResource(journalPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600, Sync()).Use(func(fd *os.File) error {
+			_, err := fd.Write(append(line, '\n'))
+			return err
+		})
+	}
+	if err != nil {
+		warnErr(WarnJournalFailed, "journal "+journalPath, err)
+	}
+}
+
+// journalUse journals a Use of path with the WithJournal option.
+func (options *fileOptions) journalUse(path string, written int64, useErr error) {
+	if options.journal == "" {
+		return
+	}
+	record := JournalRecord{Time: clockOr(options.journalClock).Now(), Path: path, Bytes: written}
+	if useErr != nil {
+		record.Error = useErr.Error()
+	}
+	writeJournal(options.journal, record)
+}
+
+// countingWriter counts the bytes written through it into n.
+type countingWriter struct {
+	w io.Writer
+	n *int64
+}
+
+func (c countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	*c.n += int64(n)
+	return n, err
+}
+
+type countingReadWriteSeeker struct {
+	io.ReadWriteSeeker
+	n *int64
+}
+
+func (c countingReadWriteSeeker) Write(p []byte) (int, error) {
+	n, err := c.ReadWriteSeeker.Write(p)
+	*c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,145 @@
+package resource_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/group"
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+func TestJournalClock(t *testing.T) {
+	dir := t.TempDir()
+	journal := filepath.Join(dir, "journal.jsonl")
+	clock := newFakeClock()
+	err := resource.NewWriteFileResource(filepath.Join(dir, "data"), os.O_CREATE|os.O_WRONLY, 0o644,
+		resource.WithJournal(journal), resource.JournalClock(clock)).Use(func(w io.Writer) error {
+		_, err := io.WriteString(w, "hello")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	line, err := os.ReadFile(journal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var record resource.JournalRecord
+	err = json.Unmarshal(line, &record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !record.Time.Equal(epoch) || record.Bytes != 5 {
+		t.Fatalf("got %+v, want 5 bytes at the time of the clock", record)
+	}
+}
+
+// readJournal parses the records of the journal, failing the test on a torn line.
+func readJournal(t *testing.T, journal string) []resource.JournalRecord {
+	t.Helper()
+	var records []resource.JournalRecord
+	for _, line := range strings.Split(strings.TrimSuffix(readFile(t, journal), "\n"), "\n") {
+		var record resource.JournalRecord
+		err := json.Unmarshal([]byte(line), &record)
+		if err != nil {
+			t.Fatalf("journal line %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestJournalSuccessAndFailure(t *testing.T) {
+	dir := t.TempDir()
+	journal := filepath.Join(dir, "journal.jsonl")
+	data := filepath.Join(dir, "data")
+	errWrite := errors.New("write failed")
+
+	err := resource.NewWriteFileResource(data, resource.NewFileFlag, resource.OwnerRWOnly, resource.WithJournal(journal)).Use(func(w io.Writer) error {
+		_, err := io.WriteString(w, "hello")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = resource.NewReadWriteFileResource(data, os.O_RDWR, resource.OwnerRWOnly, resource.WithJournal(journal)).Use(func(rw io.ReadWriteSeeker) error {
+		_, err := io.WriteString(rw, "hi")
+		if err != nil {
+			return err
+		}
+		return errWrite
+	})
+	if !errors.Is(err, errWrite) {
+		t.Fatalf("Use = %v, want the callback error", err)
+	}
+
+	records := readJournal(t, journal)
+	if len(records) != 2 {
+		t.Fatalf("journal = %+v, want 2 records", records)
+	}
+	if records[0].Path != data || records[0].Bytes != 5 || records[0].Error != "" {
+		t.Errorf("record of the successful write = %+v", records[0])
+	}
+	if records[1].Path != data || records[1].Bytes != 2 || !strings.Contains(records[1].Error, "write failed") {
+		t.Errorf("record of the failed write = %+v", records[1])
+	}
+}
+
+func TestJournalFailureKeepsTheResult(t *testing.T) {
+	warnings := captureWarnings(t)
+	dir := t.TempDir()
+	data := filepath.Join(dir, "data")
+	journal := filepath.Join(dir, "missing", "journal.jsonl")
+
+	err := resource.NewWriteFileResource(data, resource.NewFileFlag, resource.OwnerRWOnly, resource.WithJournal(journal)).Use(func(w io.Writer) error {
+		_, err := io.WriteString(w, "hello")
+		return err
+	})
+	if err != nil {
+		t.Errorf("Use with a failing journal = %v, want nil", err)
+	}
+	if got := readFile(t, data); got != "hello" {
+		t.Errorf("content = %q", got)
+	}
+	if !hasWarning(warnings(), resource.WarnJournalFailed) {
+		t.Errorf("warnings = %v, want WarnJournalFailed", warnings())
+	}
+}
+
+func TestJournalConcurrentUsesWriteWholeRecords(t *testing.T) {
+	dir := t.TempDir()
+	journal := filepath.Join(dir, "journal.jsonl")
+	g := group.NewSafeWaitGroup()
+	for i := range 50 {
+		g.Run(func() {
+			path := filepath.Join(dir, fmt.Sprintf("data-%d-%s", i, strings.Repeat("x", 200)))
+			err := resource.NewWriteFileResource(path, resource.NewFileFlag, resource.OwnerRWOnly, resource.WithJournal(journal)).Use(func(w io.Writer) error {
+				_, err := io.WriteString(w, strings.Repeat("y", i))
+				return err
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+	g.Wait()
+
+	records := readJournal(t, journal)
+	if len(records) != 50 {
+		t.Fatalf("%d records, want 50", len(records))
+	}
+	seen := make(map[int64]bool)
+	for _, record := range records {
+		seen[record.Bytes] = true
+	}
+	if len(seen) != 50 {
+		t.Errorf("records = %+v, want one per Use", records)
+	}
+}
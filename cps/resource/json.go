@@ -0,0 +1,68 @@
+package resource
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+)
+
+type jsonOptions struct {
+	prefix string
+	indent string
+}
+
+// JSONOption configures WriteJSONResource.
+type JSONOption func(options *jsonOptions)
+
+// JSONIndent makes the encoder indent its output, see json.Encoder.SetIndent.
+func JSONIndent(prefix, indent string) JSONOption {
+	return func(options *jsonOptions) {
+		options.prefix = prefix
+		options.indent = indent
+	}
+}
+
+// WriteJSONResource gives the callback a json.Encoder writing to path.
+// It goes through NewAtomicFileResource, so a failed encoding never leaves a truncated file behind.
+func WriteJSONResource(path string, perm os.FileMode, opts ...JSONOption) Resource[*json.Encoder] {
+	var options jsonOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	file := NewAtomicFileResource(path, perm)
+	return Resource[*json.Encoder]{
+		Use: func(callback func(enc *json.Encoder) error) error {
+			return file.Use(func(fd *os.File) error {
+				enc := json.NewEncoder(fd)
+				enc.SetIndent(options.prefix, options.indent)
+				return useCallback(callback, enc)
+			})
+		},
+	}
+}
+
+// ReadJSONResource gives the callback a json.Decoder reading from path.
+func ReadJSONResource(path string) Resource[*json.Decoder] {
+	return jsonDecoderResource(NewReadFileResource(path))
+}
+
+func jsonDecoderResource(file Resource[io.Reader]) Resource[*json.Decoder] {
+	return Resource[*json.Decoder]{
+		Use: func(callback func(dec *json.Decoder) error) error {
+			return file.Use(func(r io.Reader) error {
+				return callback(json.NewDecoder(r))
+			})
+		},
+	}
+}
+
+// SaveJSON atomically replaces path with v encoded as JSON, see SaveEncoded.
+func SaveJSON(path string, v any) error {
+	return SaveEncoded(path, v, JSONCodec())
+}
+
+// LoadJSON decodes the JSON content of path into v.
+func LoadJSON(path string, v any) error {
+	return LoadEncoded(path, v, JSONCodec())
+}
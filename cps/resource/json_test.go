@@ -0,0 +1,80 @@
+package resource_test
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+type settings struct {
+	Name  string   `json:"name"`
+	Ports []int    `json:"ports"`
+	Tags  []string `json:"tags,omitempty"`
+}
+
+func TestJSONResourcesRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "settings.json")
+	want := settings{Name: "demo", Ports: []int{80, 443}}
+	err := resource.WriteJSONResource(path, 0o644, resource.JSONIndent("", "  ")).Use(func(enc *json.Encoder) error {
+		return enc.Encode(want)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, indented := readFile(t, path), "{\n  \"name\": \"demo\",\n  \"ports\": [\n    80,\n    443\n  ]\n}\n"; got != indented {
+		t.Errorf("file = %q, want %q", got, indented)
+	}
+
+	var got settings
+	err = resource.ReadJSONResource(path).Use(func(dec *json.Decoder) error {
+		return dec.Decode(&got)
+	})
+	if err != nil || got.Name != want.Name || len(got.Ports) != 2 {
+		t.Errorf("read %+v, %v", got, err)
+	}
+}
+
+func TestSaveAndLoadJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "settings.json")
+	err := resource.SaveJSON(path, settings{Name: "first", Tags: []string{"a"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got settings
+	err = resource.LoadJSON(path, &got)
+	if err != nil || got.Name != "first" || len(got.Tags) != 1 {
+		t.Errorf("loaded %+v, %v", got, err)
+	}
+
+	err = resource.LoadJSON(filepath.Join(t.TempDir(), "missing.json"), &got)
+	if !errors.Is(err, os.ErrNotExist) || phaseOf(t, err) != resource.PhaseAcquire {
+		t.Errorf("LoadJSON of a missing file = %v", err)
+	}
+}
+
+func TestSaveJSONMarshalErrorKeepsFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "settings.json")
+	err := resource.SaveJSON(path, settings{Name: "kept"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := readFile(t, path)
+
+	err = resource.SaveJSON(path, map[string]any{"unmarshalable": make(chan int)})
+	var typeErr *json.UnsupportedTypeError
+	if !errors.As(err, &typeErr) {
+		t.Errorf("SaveJSON of a channel = %v, want a *json.UnsupportedTypeError", err)
+	}
+	if got := readFile(t, path); got != before {
+		t.Errorf("file = %q after a failed save, want %q", got, before)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 1 {
+		t.Errorf("directory holds %d entries after a failed save, want the file only: %v", len(entries), err)
+	}
+}
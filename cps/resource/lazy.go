@@ -0,0 +1,69 @@
+package resource
+
+import (
+	"errors"
+	"sync"
+)
+
+// LazyHandle acquires the value of a Lazy resource on the first Get.
+type LazyHandle[T any] struct {
+	r    Resource[T]
+	once sync.Once
+
+	value    T
+	err      error
+	acquired bool
+	release  chan struct{} // closed when the Lazy callback returned
+	released chan error    // the result of r.Use once the value was acquired
+}
+
+// Lazy gives the callback a handle instead of the value of r: r is acquired by the first Get only,
+// and released after the callback like any resource. When Get isn't called nothing is acquired.
+//
+// The value is held by r.Use running in a goroutine of its own until the callback returns.
+func Lazy[T any](r Resource[T]) Resource[*LazyHandle[T]] {
+	return Resource[*LazyHandle[T]]{
+		Use: func(callback func(h *LazyHandle[T]) error) error {
+			h := &LazyHandle[T]{
+				r:        r,
+				release:  make(chan struct{}),
+				released: make(chan error, 1),
+			}
+			err := callback(h)
+			close(h.release)
+
+			h.once.Do(func() {}) // no acquisition can start any more
+			if h.acquired {
+				err = errors.Join(err, <-h.released)
+			}
+			return err
+		},
+	}
+}
+
+// Get acquires the value on the first call and returns it, or the acquisition error, on every call.
+// It is safe to call from goroutines started by the callback, but not after the callback returned.
+func (h *LazyHandle[T]) Get() (T, error) {
+	h.once.Do(func() {
+		ready := make(chan struct{})
+		go func() {
+			called := false
+			err := h.r.Use(func(value T) error {
+				called = true
+				h.value = value
+				h.acquired = true
+				close(ready)
+				<-h.release
+				return nil
+			})
+			if !called {
+				h.err = err
+				close(ready)
+				return
+			}
+			h.released <- err
+		}()
+		<-ready
+	})
+	return h.value, h.err
+}
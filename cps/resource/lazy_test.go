@@ -0,0 +1,118 @@
+package resource_test
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+// countedResource counts its acquisitions and records them with its releases in events.
+type countedResource struct {
+	acquisitions atomic.Int64
+	acquireErr   error
+	releaseErr   error
+
+	mu     sync.Mutex
+	events []string
+}
+
+func (c *countedResource) record(event string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.events = append(c.events, event)
+}
+
+func (c *countedResource) resource() resource.Resource[string] {
+	return resource.Resource[string]{
+		Use: func(callback func(string) error) error {
+			c.acquisitions.Add(1)
+			if c.acquireErr != nil {
+				return c.acquireErr
+			}
+			c.record("acquire")
+			err := callback("value")
+			c.record("release")
+			return errors.Join(err, c.releaseErr)
+		},
+	}
+}
+
+func TestLazyUntouched(t *testing.T) {
+	var c countedResource
+	err := resource.Lazy(c.resource()).Use(func(*resource.LazyHandle[string]) error {
+		return nil
+	})
+	if err != nil || c.acquisitions.Load() != 0 || len(c.events) != 0 {
+		t.Errorf("Use = %v with %d acquisitions, events %q, want none", err, c.acquisitions.Load(), c.events)
+	}
+}
+
+func TestLazyTouched(t *testing.T) {
+	var c countedResource
+	err := resource.Lazy(c.resource()).Use(func(h *resource.LazyHandle[string]) error {
+		for range 3 {
+			v, err := h.Get()
+			if err != nil || v != "value" {
+				t.Errorf("Get = %q, %v", v, err)
+			}
+		}
+		c.record("callback returns")
+		return nil
+	})
+	if err != nil || c.acquisitions.Load() != 1 {
+		t.Errorf("Use = %v with %d acquisitions, want 1", err, c.acquisitions.Load())
+	}
+	if want := []string{"acquire", "callback returns", "release"}; !slices.Equal(c.events, want) {
+		t.Errorf("events %q, want %q", c.events, want)
+	}
+}
+
+func TestLazyConcurrentGets(t *testing.T) {
+	var c countedResource
+	err := resource.Lazy(c.resource()).Use(func(h *resource.LazyHandle[string]) error {
+		var wg sync.WaitGroup
+		for range 20 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if v, err := h.Get(); err != nil || v != "value" {
+					t.Errorf("Get = %q, %v", v, err)
+				}
+			}()
+		}
+		wg.Wait()
+		return nil
+	})
+	if err != nil || c.acquisitions.Load() != 1 {
+		t.Errorf("Use = %v with %d acquisitions, want exactly 1", err, c.acquisitions.Load())
+	}
+}
+
+func TestLazyErrors(t *testing.T) {
+	errAcquire, errRelease := errors.New("acquire"), errors.New("release")
+
+	c := &countedResource{acquireErr: errAcquire}
+	err := resource.Lazy(c.resource()).Use(func(h *resource.LazyHandle[string]) error {
+		_, err := h.Get()
+		if _, again := h.Get(); again != err {
+			t.Errorf("second Get = %v, want the same error", again)
+		}
+		return err
+	})
+	if !errors.Is(err, errAcquire) || c.acquisitions.Load() != 1 {
+		t.Errorf("Use = %v after %d acquisitions, want %v after 1", err, c.acquisitions.Load(), errAcquire)
+	}
+
+	c = &countedResource{releaseErr: errRelease}
+	err = resource.Lazy(c.resource()).Use(func(h *resource.LazyHandle[string]) error {
+		_, err := h.Get()
+		return err
+	})
+	if !errors.Is(err, errRelease) {
+		t.Errorf("Use = %v, want the release error", err)
+	}
+}
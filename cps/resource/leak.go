@@ -0,0 +1,206 @@
+package resource
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrResourcesOpen is returned by VerifyNoneOpen when some resources are not released.
+var ErrResourcesOpen = errors.New("resources are still open")
+
+var debug atomic.Bool
+
+type debugOptions struct {
+	clock Clock
+}
+
+// DebugOption configures SetDebug.
+type DebugOption func(options *debugOptions)
+
+// DebugClock makes debug mode tell how long the resources have been open with clock.
+func DebugClock(clock Clock) DebugOption {
+	return func(options *debugOptions) {
+		options.clock = clock
+	}
+}
+
+var debugSettings atomic.Pointer[debugOptions]
+
+// SetDebug turns debug mode on or off. In debug mode every acquisition records its call site
+// for VerifyNoneOpen, which costs an allocation and a stack walk per Use.
+func SetDebug(on bool, opts ...DebugOption) {
+	var options debugOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	options.clock = clockOr(options.clock)
+	debugSettings.Store(&options)
+	debug.Store(on)
+}
+
+// debugClock is the clock of SetDebug.
+func debugClock() Clock {
+	if options := debugSettings.Load(); options != nil {
+		return options.clock
+	}
+	return RealClock()
+}
+
+// openCounts counts the open resources of every tracked kind, and is never written to after init.
+var openCounts = map[string]*atomic.Int64{
+	"acquired": new(atomic.Int64), // values of Acquire not released yet
+	"db":       new(atomic.Int64),
+	"file":     new(atomic.Int64),
+	"handoff":  new(atomic.Int64), // handoffs of UseHandoff not released yet
+	"release":  new(atomic.Int64), // WithReleaseTimeout releases still running
+	"rows":     new(atomic.Int64),
+	"tx":       new(atomic.Int64),
+}
+
+type openEntry struct {
+	kind        string
+	description string
+	site        string
+	since       time.Time
+}
+
+var openEntries sync.Map // *openEntry acquired in debug mode
+
+// openToken is what trackOpen returns to release with; a value, so tracking doesn't allocate.
+type openToken struct {
+	counter  *atomic.Int64
+	entry    *openEntry
+	stopSlow func() // with SetDefaultWarnAfter
+}
+
+func trackOpen(kind string) openToken {
+	return trackOpenAs(kind, "", 0)
+}
+
+// trackOpenAs is trackOpen recording the description of the resource in debug mode,
+// followed by " #id" for a non-zero id.
+func trackOpenAs(kind, description string, id int64) openToken {
+	token := openToken{counter: openCounts[kind]}
+	token.counter.Add(1)
+	if debug.Load() {
+		if id != 0 {
+			description += " #" + strconv.FormatInt(id, 10)
+		}
+		token.entry = &openEntry{kind: kind, description: description, site: callSite(), since: debugClock().Now()}
+		openEntries.Store(token.entry, struct{}{})
+	}
+	if slow := defaultWarnAfter.Load(); slow != nil && kind != "release" {
+		if description == "" {
+			description = kind
+		}
+		token.stopSlow = startSlowTimer(slow.clock, description, slow.d, slow.onWarn)
+	}
+	return token
+}
+
+func (token openToken) release() {
+	token.counter.Add(-1)
+	if token.entry != nil {
+		openEntries.Delete(token.entry)
+	}
+	if token.stopSlow != nil {
+		token.stopSlow()
+	}
+}
+
+// callSite is the first caller outside of this package's non-test files.
+func callSite() string {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs)])
+	for {
+		frame, more := frames.Next()
+		inPackage := filepath.Dir(frame.File) == packageDir && !strings.HasSuffix(frame.File, "_test.go")
+		if !inPackage && frame.Function != "runtime.goexit" {
+			return fmt.Sprintf("%s (%s:%d)", frame.Function, frame.File, frame.Line)
+		}
+		if !more {
+			return "unknown"
+		}
+	}
+}
+
+var packageDir = func() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Dir(file)
+}()
+
+// VerifyNoneOpen returns ErrResourcesOpen if a Use of the db, tx, rows or file resources is running
+// (or a release abandoned by WithReleaseTimeout, or a value of Acquire or a handoff of UseHandoff
+// not released yet),
+// for example because a callback left a goroutine holding the resource.
+// In debug mode the error lists where every open resource was acquired.
+//
+// Call it when nothing is supposed to run: at program exit or at the end of a test.
+func VerifyNoneOpen() error {
+	var counts []string
+	for kind, counter := range openCounts {
+		if n := counter.Load(); n != 0 {
+			counts = append(counts, fmt.Sprintf("%d %s", n, kind))
+		}
+	}
+	if len(counts) == 0 {
+		return nil
+	}
+	sort.Strings(counts)
+
+	var sites []string
+	for _, site := range openSites() {
+		sites = append(sites, "\n\t"+site)
+	}
+	return fmt.Errorf("%w: %s%s", ErrResourcesOpen, strings.Join(counts, ", "), strings.Join(sites, ""))
+}
+
+// openSites describes the resources acquired in debug mode and still open, sorted.
+func openSites() []string {
+	var sites []string
+	now := debugClock().Now()
+	openEntries.Range(func(key, _ any) bool {
+		entry := key.(*openEntry)
+		what := entry.kind
+		if entry.description != "" {
+			what = entry.description
+		}
+		sites = append(sites, fmt.Sprintf("%s acquired %s ago by %s",
+			what, now.Sub(entry.since).Round(time.Millisecond), entry.site))
+		return true
+	})
+	sort.Strings(sites)
+	return sites
+}
+
+// DumpOpenResources writes how many resources of every kind are open to w,
+// followed in debug mode by one line per open resource with its description.
+func DumpOpenResources(w io.Writer) error {
+	kinds := make([]string, 0, len(openCounts))
+	for kind := range openCounts {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		_, err := fmt.Fprintf(w, "%s: %d open\n", kind, openCounts[kind].Load())
+		if err != nil {
+			return err
+		}
+	}
+	for _, site := range openSites() {
+		_, err := fmt.Fprintf(w, "\t%s\n", site)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
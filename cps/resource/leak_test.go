@@ -0,0 +1,84 @@
+package resource_test
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+func TestSetDebugOnClock(t *testing.T) {
+	clock := newFakeClock()
+	resource.SetDebug(true, resource.DebugClock(clock))
+	t.Cleanup(func() {
+		resource.SetDebug(false)
+	})
+
+	path := filepath.Join(t.TempDir(), "open")
+	err := resource.NewFileResource(path, os.O_CREATE|os.O_WRONLY, 0o644).Use(func(*os.File) error {
+		clock.Advance(3 * time.Second)
+		err := resource.VerifyNoneOpen()
+		if !errors.Is(err, resource.ErrResourcesOpen) || !strings.Contains(err.Error(), "acquired 3s ago") {
+			t.Errorf("got %v, want the file open for 3s", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := resource.VerifyNoneOpen(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyNoneOpenFlagsGoroutineHoldingRows(t *testing.T) {
+	resource.SetDebug(true)
+	t.Cleanup(func() {
+		resource.SetDebug(false)
+	})
+	db := openDB(t)
+	held, release, done := make(chan struct{}), make(chan struct{}), make(chan error)
+	go func() {
+		done <- resource.QueryRows(db, "SELECT id FROM items").Use(func(*sql.Rows) error {
+			close(held)
+			<-release // past the Use the test made
+			return nil
+		})
+	}()
+	<-held
+
+	err := resource.VerifyNoneOpen()
+	if !errors.Is(err, resource.ErrResourcesOpen) {
+		t.Fatalf("VerifyNoneOpen = %v, want %v", err, resource.ErrResourcesOpen)
+	}
+	if !strings.Contains(err.Error(), "1 rows") || !strings.Contains(err.Error(), "TestVerifyNoneOpenFlagsGoroutineHoldingRows") {
+		t.Errorf("VerifyNoneOpen = %v, want the rows with their call site", err)
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if err := resource.VerifyNoneOpen(); err != nil {
+		t.Errorf("VerifyNoneOpen = %v once released", err)
+	}
+}
+
+func TestVerifyNoneOpenWithoutDebug(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "open")
+	err := resource.NewFileResource(path, os.O_CREATE|os.O_WRONLY, 0o644).Use(func(*os.File) error {
+		err := resource.VerifyNoneOpen()
+		if !errors.Is(err, resource.ErrResourcesOpen) || strings.Contains(err.Error(), "acquired") {
+			t.Errorf("got %v, want the count of open files only", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
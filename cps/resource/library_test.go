@@ -0,0 +1,61 @@
+package resource_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestImportFromExternalModule builds a program of another module importing the library,
+// without cgo: the sqlite driver is a dependency of the demo only.
+func TestImportFromExternalModule(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs the go command")
+	}
+	goCmd, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("no go command")
+	}
+	root, err := filepath.Abs(filepath.Join("..", ".."))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod": "module example.com/user\n\ngo 1.23\n\n" +
+			"require github.com/Q69K/using-cps-in-golang v0.0.0\n\n" +
+			"replace github.com/Q69K/using-cps-in-golang => " + root + "\n",
+		"main.go": `package main
+
+import (
+	"fmt"
+
+	"github.com/Q69K/using-cps-in-golang/cps/group"
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+func main() {
+	fmt.Println(group.RunGroupCollect(3, func(i int) int { return i }), resource.OwnerRWOnly)
+}
+`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cmd := exec.Command(goCmd, "run", ".")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod", "GOPROXY=off", "GOWORK=off", "CGO_ENABLED=0")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("go run: %v\n%s", err, out)
+	}
+	if got := strings.TrimSpace(string(out)); got != "[0 1 2] -rw-------" {
+		t.Errorf("output = %q", got)
+	}
+}
@@ -0,0 +1,96 @@
+package resource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// ErrNoHandle is returned by Handle for a name no resource was added with, or of another type.
+var ErrNoHandle = errors.New("no such handle")
+
+// Lifecycle holds the long-lived resources of a service: they are acquired in the order they were added
+// and released in reverse.
+type Lifecycle struct {
+	entries []lifecycleEntry
+}
+
+type lifecycleEntry struct {
+	name string
+	r    Resource[any]
+}
+
+// Add adds r under name; its value is then available in Handles.
+func (l *Lifecycle) Add(name string, r Resource[any]) {
+	l.entries = append(l.entries, lifecycleEntry{name: name, r: r})
+}
+
+// AddResource is Lifecycle.Add for a typed resource; get its value back with Handle.
+func AddResource[T any](l *Lifecycle, name string, r Resource[T]) {
+	l.Add(name, Resource[any]{
+		Use: func(callback func(value any) error) error {
+			return r.Use(func(value T) error {
+				return callback(value)
+			})
+		},
+		Description: r.Description,
+	})
+}
+
+// Handles are the values of the resources held by Lifecycle.Run, by name.
+type Handles struct {
+	values map[string]any
+}
+
+// Get returns the value of the resource added under name.
+func (h Handles) Get(name string) (any, bool) {
+	value, ok := h.values[name]
+	return value, ok
+}
+
+// Handle returns the value of the resource added under name, which must be a T.
+func Handle[T any](h Handles, name string) (T, error) {
+	value, ok := h.values[name].(T)
+	if !ok {
+		var zero T
+		return zero, fmt.Errorf("%w: %s %T", ErrNoHandle, name, zero)
+	}
+	return value, nil
+}
+
+// Run acquires the resources, runs main with their values and releases them in reverse.
+// When an acquisition fails the resources acquired before it are released, in reverse too, and main isn't run.
+// All the errors are joined; an acquisition error is prefixed with the name of its resource.
+//
+// main's context is cancelled on SIGINT or SIGTERM, like WithSignalContext's, as well as with ctx:
+// main is expected to return then, so the resources are released and Run returns.
+func (l *Lifecycle) Run(ctx context.Context, main func(ctx context.Context, handles Handles) error) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	handles := Handles{values: make(map[string]any, len(l.entries))}
+	return useLifecycle(l.entries, handles, func() error {
+		return main(ctx, handles)
+	})
+}
+
+func useLifecycle(entries []lifecycleEntry, handles Handles, main func() error) error {
+	if len(entries) == 0 {
+		return main()
+	}
+	entry := entries[0]
+	acquired := false
+	err := entry.r.Use(func(value any) error {
+		acquired = true
+		handles.values[entry.name] = value
+		defer delete(handles.values, entry.name)
+		return useLifecycle(entries[1:], handles, main)
+	})
+	if !acquired && err != nil {
+		return fmt.Errorf("%s: %w", entry.name, err)
+	}
+	return err
+}
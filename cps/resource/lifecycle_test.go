@@ -0,0 +1,77 @@
+package resource_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+	"github.com/Q69K/using-cps-in-golang/cps/resource/resourcetest"
+)
+
+// recordingResource gives name to the callback, recording its acquisition and release in events.
+func recordingResource(name string, events *[]string) resource.Resource[string] {
+	return resource.Resource[string]{
+		Use: func(callback func(string) error) error {
+			*events = append(*events, "acquire "+name)
+			defer func() {
+				*events = append(*events, "release "+name)
+			}()
+			return callback(name)
+		},
+	}
+}
+
+func TestLifecycleAcquireFailureReleasesInReverse(t *testing.T) {
+	var events []string
+	var l resource.Lifecycle
+	resource.AddResource(&l, "db", recordingResource("db", &events))
+	resource.AddResource(&l, "listener", recordingResource("listener", &events))
+	resource.AddResource(&l, "tmp", resourcetest.FakeResource("tmp", resource.PhaseAcquire))
+	resource.AddResource(&l, "cache", recordingResource("cache", &events))
+
+	err := l.Run(context.Background(), func(context.Context, resource.Handles) error {
+		t.Error("main ran")
+		return nil
+	})
+	if !errors.Is(err, resourcetest.ErrFake) || !strings.HasPrefix(err.Error(), "tmp: ") {
+		t.Errorf("Run = %v, want the acquisition error of tmp", err)
+	}
+	if want := []string{"acquire db", "acquire listener", "release listener", "release db"}; !slices.Equal(events, want) {
+		t.Errorf("events = %q, want %q", events, want)
+	}
+}
+
+func TestLifecycleHandles(t *testing.T) {
+	var events []string
+	var l resource.Lifecycle
+	resource.AddResource(&l, "db", recordingResource("db", &events))
+	resource.AddResource(&l, "port", resourcetest.FakeResource(8080, resourcetest.NoFailure))
+	errMain := errors.New("main failed")
+
+	err := l.Run(context.Background(), func(ctx context.Context, handles resource.Handles) error {
+		db, err := resource.Handle[string](handles, "db")
+		if err != nil || db != "db" {
+			t.Errorf("Handle db = %q, %v", db, err)
+		}
+		port, err := resource.Handle[int](handles, "port")
+		if err != nil || port != 8080 {
+			t.Errorf("Handle port = %d, %v", port, err)
+		}
+		if _, err := resource.Handle[int](handles, "db"); !errors.Is(err, resource.ErrNoHandle) {
+			t.Errorf("Handle of the wrong type = %v, want ErrNoHandle", err)
+		}
+		if _, ok := handles.Get("missing"); ok {
+			t.Error("Get of a missing name succeeded")
+		}
+		return errMain
+	})
+	if !errors.Is(err, errMain) {
+		t.Errorf("Run = %v, want the error of main", err)
+	}
+	if want := []string{"acquire db", "release db"}; !slices.Equal(events, want) {
+		t.Errorf("events = %q, want %q", events, want)
+	}
+}
@@ -0,0 +1,34 @@
+//go:build unix
+
+package resource_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"syscall"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+func TestLifecycleShutsDownOnSIGTERM(t *testing.T) {
+	var events []string
+	var l resource.Lifecycle
+	for _, name := range []string{"db", "listener", "tmp"} {
+		resource.AddResource(&l, name, recordingResource(name, &events))
+	}
+
+	err := l.Run(context.Background(), func(ctx context.Context, handles resource.Handles) error {
+		signalled(t, ctx, syscall.SIGTERM)
+		events = append(events, "main done")
+		return ctx.Err()
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Run = %v, want the cancellation main returned", err)
+	}
+	want := []string{"acquire db", "acquire listener", "acquire tmp", "main done", "release tmp", "release listener", "release db"}
+	if !slices.Equal(events, want) {
+		t.Errorf("events = %q, want %q", events, want)
+	}
+}
@@ -0,0 +1,139 @@
+package resource
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ErrWriteLimitExceeded matches every *WriteLimitError with errors.Is.
+var ErrWriteLimitExceeded = errors.New("write limit exceeded")
+
+// WriteLimitError is returned by LimitWriteResource when the file grew past the limit,
+// and by a LimitWriter writer instead of writing past it.
+type WriteLimitError struct {
+	Limit int64
+	// Attempted is what the file grew by for LimitWriteResource; for LimitWriter,
+	// the number of bytes written so far plus the rejected write.
+	Attempted int64
+}
+
+func (e *WriteLimitError) Error() string {
+	return fmt.Sprintf("%v: %d bytes attempted, limit is %d", ErrWriteLimitExceeded, e.Attempted, e.Limit)
+}
+
+func (e *WriteLimitError) Is(target error) bool {
+	return target == ErrWriteLimitExceeded
+}
+
+type limitOptions struct {
+	removeOnExceed bool
+}
+
+// LimitOption configures LimitWriteResource and LimitWriter.
+type LimitOption func(options *limitOptions)
+
+// RemoveOnLimitExceeded removes the partially written file when the limit is hit.
+func RemoveOnLimitExceeded() LimitOption {
+	return func(options *limitOptions) {
+		options.removeOnExceed = true
+	}
+}
+
+// LimitWriteResource protects against runaway output: the callback gets the inner file,
+// and the Use fails with a *WriteLimitError when the callback made the file grow by more than maxBytes.
+//
+// Writes on *os.File can't be intercepted, so the limit is checked when the callback returns,
+// before the inner resource is released: an atomic file over the limit isn't committed.
+// LimitWriter rejects the writes themselves instead, for callbacks which can do with an io.Writer.
+// The inner resource is still closed normally when the limit is hit.
+func LimitWriteResource(inner FileResource, maxBytes int64, opts ...LimitOption) FileResource {
+	options := limitOptionsOf(opts)
+	description := fmt.Sprintf("%s limited to %d bytes", inner.Describe(), maxBytes)
+	return newFileResource(description, func(callback FileResourceCallback) error {
+		return useLimited(inner, &options, func(fd *os.File) error {
+			before, err := fileSize(fd)
+			if err != nil {
+				return phaseError(PhaseAcquire, err)
+			}
+			err = callback(fd)
+			after, sizeErr := fileSize(fd)
+			if sizeErr != nil {
+				return errors.Join(err, sizeErr)
+			}
+			if grown := after - before; grown > maxBytes {
+				return errors.Join(err, &WriteLimitError{Limit: maxBytes, Attempted: grown})
+			}
+			return err
+		})
+	})
+}
+
+// LimitWriter is LimitWriteResource for callbacks writing to an io.Writer: the writer over the inner file
+// rejects, as a whole, any write that would make the total exceed maxBytes.
+func LimitWriter(inner FileResource, maxBytes int64, opts ...LimitOption) Resource[io.Writer] {
+	options := limitOptionsOf(opts)
+	return Resource[io.Writer]{
+		Description: fmt.Sprintf("writer of %s limited to %d bytes", inner.Describe(), maxBytes),
+		Use: func(callback func(w io.Writer) error) error {
+			return useLimited(inner, &options, func(fd *os.File) error {
+				return callback(&limitedWriter{w: fd, limit: maxBytes})
+			})
+		},
+	}
+}
+
+func limitOptionsOf(opts []LimitOption) limitOptions {
+	var options limitOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
+
+// useLimited uses inner, removing its file when the limit was hit and options say so.
+func useLimited(inner FileResource, options *limitOptions, callback FileResourceCallback) error {
+	var path string
+	err := inner.Use(func(fd *os.File) error {
+		path = fd.Name()
+		return callback(fd)
+	})
+	if options.removeOnExceed && errors.Is(err, ErrWriteLimitExceeded) {
+		removeErr := os.Remove(path)
+		if errors.Is(removeErr, os.ErrNotExist) {
+			// temporary files are already gone
+			removeErr = nil
+		}
+		return errors.Join(err, removeErr)
+	}
+	return err
+}
+
+// fileSize is the size of fd, from its path when the callback closed it.
+func fileSize(fd *os.File) (int64, error) {
+	info, err := fd.Stat()
+	if errors.Is(err, os.ErrClosed) {
+		info, err = os.Stat(fd.Name())
+	}
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+type limitedWriter struct {
+	w       io.Writer
+	limit   int64
+	written int64
+}
+
+func (lw *limitedWriter) Write(p []byte) (int, error) {
+	attempted := lw.written + int64(len(p))
+	if attempted > lw.limit {
+		return 0, &WriteLimitError{Limit: lw.limit, Attempted: attempted}
+	}
+	n, err := lw.w.Write(p)
+	lw.written += int64(n)
+	return n, err
+}
@@ -0,0 +1,163 @@
+package resource_test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+func TestLimitWriterExactLimit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.txt")
+	inner := resource.NewFileResource(path, resource.NewFileFlag, 0o644)
+	err := resource.LimitWriter(inner, 10).Use(func(w io.Writer) error {
+		_, err := io.WriteString(w, "12345")
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, "67890") // up to the limit exactly
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, "x")
+		return err
+	})
+	var limitErr *resource.WriteLimitError
+	if !errors.As(err, &limitErr) || !errors.Is(err, resource.ErrWriteLimitExceeded) {
+		t.Fatalf("Use = %v, want a *WriteLimitError", err)
+	}
+	if limitErr.Limit != 10 || limitErr.Attempted != 11 {
+		t.Errorf("limit error = %+v, want 11 bytes attempted of 10", limitErr)
+	}
+	if got := readFile(t, path); got != "1234567890" {
+		t.Errorf("file = %q, want the writes up to the limit", got)
+	}
+}
+
+func TestLimitWriterFarOver(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.txt")
+	inner := resource.NewFileResource(path, resource.NewFileFlag, 0o644)
+	var n int
+	err := resource.LimitWriter(inner, 10, resource.RemoveOnLimitExceeded()).Use(func(w io.Writer) error {
+		var err error
+		n, err = io.WriteString(w, strings.Repeat("x", 1000))
+		return err
+	})
+	var limitErr *resource.WriteLimitError
+	if !errors.As(err, &limitErr) || limitErr.Attempted != 1000 {
+		t.Fatalf("Use = %v, want 1000 bytes attempted", err)
+	}
+	if n != 0 {
+		t.Errorf("%d bytes written, the write must be rejected as a whole", n)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("partial file not removed: %v", err)
+	}
+}
+
+func TestLimitWriterUnderLimit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.txt")
+	inner := resource.NewFileResource(path, resource.NewFileFlag, 0o644)
+	err := resource.LimitWriter(inner, 10, resource.RemoveOnLimitExceeded()).Use(func(w io.Writer) error {
+		_, err := io.WriteString(w, "short")
+		return err
+	})
+	if err != nil || readFile(t, path) != "short" {
+		t.Errorf("Use = %v, file %q", err, readFile(t, path))
+	}
+}
+
+func TestLimitWriteResourceExactLimit(t *testing.T) {
+	dir := t.TempDir()
+	for _, tc := range []struct {
+		content string
+		over    bool
+	}{
+		{"1234567890", false}, // up to the limit exactly
+		{"1234567890x", true},
+	} {
+		path := filepath.Join(dir, fmt.Sprintf("out-%d.txt", len(tc.content)))
+		inner := resource.NewFileResource(path, resource.NewFileFlag, 0o644)
+		err := resource.LimitWriteResource(inner, 10).Use(func(file *os.File) error {
+			_, err := file.WriteString(tc.content[:5])
+			if err != nil {
+				return err
+			}
+			_, err = file.WriteString(tc.content[5:])
+			return err
+		})
+		if !tc.over {
+			if err != nil {
+				t.Errorf("Use writing %d bytes = %v", len(tc.content), err)
+			}
+			continue
+		}
+		var limitErr *resource.WriteLimitError
+		if !errors.As(err, &limitErr) || !errors.Is(err, resource.ErrWriteLimitExceeded) {
+			t.Fatalf("Use = %v, want a *WriteLimitError", err)
+		}
+		if limitErr.Limit != 10 || limitErr.Attempted != 11 {
+			t.Errorf("limit error = %+v, want 11 bytes attempted of 10", limitErr)
+		}
+		// without RemoveOnLimitExceeded the file is left as written
+		if got := readFile(t, path); got != tc.content {
+			t.Errorf("file = %q, want %q", got, tc.content)
+		}
+	}
+}
+
+func TestLimitWriteResourceFarOver(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.txt")
+	errCallback := errors.New("callback failed")
+	for name, inner := range map[string]resource.FileResource{
+		"file":   resource.NewFileResource(path, resource.NewFileFlag, 0o644),
+		"atomic": resource.NewAtomicFileResource(path, 0o644),
+	} {
+		err := resource.LimitWriteResource(inner, 10, resource.RemoveOnLimitExceeded()).Use(func(file *os.File) error {
+			_, err := file.WriteString(strings.Repeat("x", 1000))
+			if err != nil {
+				return err
+			}
+			return errCallback
+		})
+		var limitErr *resource.WriteLimitError
+		if !errors.As(err, &limitErr) || limitErr.Attempted != 1000 || !errors.Is(err, errCallback) {
+			t.Fatalf("Use of the %s = %v, want 1000 bytes attempted and the error of the callback", name, err)
+		}
+		if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("partial %s not removed: %v", name, err)
+		}
+		if entries := dirEntries(t, dir); len(entries) != 0 {
+			t.Errorf("%s left %v", name, entries)
+		}
+	}
+}
+
+func TestLimitWriteResourceCountsWhatTheFileGrew(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.txt")
+	err := os.WriteFile(path, []byte(strings.Repeat("x", 100)), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner := resource.NewFileResource(path, os.O_WRONLY|os.O_APPEND, 0)
+	limited := resource.LimitWriteResource(inner, 10, resource.RemoveOnLimitExceeded())
+	err = limited.Use(func(file *os.File) error {
+		_, err := file.WriteString("appended")
+		return err
+	})
+	if err != nil {
+		t.Errorf("Use appending 8 bytes to a file of 100 = %v", err)
+	}
+	if want := strings.Repeat("x", 100) + "appended"; readFile(t, path) != want {
+		t.Errorf("file = %q, want %q", readFile(t, path), want)
+	}
+	if want := "file " + path + " (O_WRONLY|O_APPEND) limited to 10 bytes"; limited.Describe() != want {
+		t.Errorf("Describe = %q, want %q", limited.Describe(), want)
+	}
+}
@@ -0,0 +1,61 @@
+package resource
+
+import (
+	"bufio"
+	"errors"
+	"io"
+)
+
+// ErrStopIteration can be returned by a ForEachLine callback to stop reading without an error.
+var ErrStopIteration = errors.New("stop iteration")
+
+type lineOptions struct {
+	maxLineSize  int
+	checkpointer *Checkpointer
+}
+
+// LineOption configures ForEachLine.
+type LineOption func(options *lineOptions)
+
+// MaxLineSize raises the longest accepted line, bufio.MaxScanTokenSize (64KB) by default.
+// Longer lines are reported as bufio.ErrTooLong, they are never truncated.
+func MaxLineSize(size int) LineOption {
+	return func(options *lineOptions) {
+		options.maxLineSize = size
+	}
+}
+
+// ForEachLine calls fn for every line of the file at path, without line terminators.
+// It returns the first error of fn, the scanner error and the close error joined.
+func ForEachLine(path string, fn func(line string) error, opts ...LineOption) error {
+	return forEachLine(NewReadFileResource(path), fn, newLineOptions(opts))
+}
+
+func newLineOptions(opts []LineOption) lineOptions {
+	options := lineOptions{maxLineSize: bufio.MaxScanTokenSize}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
+
+func forEachLine(file Resource[io.Reader], fn func(line string) error, options lineOptions) error {
+	return file.Use(func(r io.Reader) error {
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(nil, options.maxLineSize)
+		for scanner.Scan() {
+			err := options.checkpointer.Check()
+			if err != nil {
+				return err
+			}
+			err = fn(scanner.Text())
+			if errors.Is(err, ErrStopIteration) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return scanner.Err()
+	})
+}
@@ -0,0 +1,88 @@
+package resource_test
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+func writeTemp(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	err := os.WriteFile(path, []byte(content), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestForEachLine(t *testing.T) {
+	path := writeTemp(t, "lines.txt", "one\ntwo\r\n\nthree")
+	var lines []string
+	err := resource.ForEachLine(path, func(line string) error {
+		lines = append(lines, line)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"one", "two", "", "three"}; !slices.Equal(lines, want) {
+		t.Errorf("lines = %q, want %q", lines, want)
+	}
+}
+
+func TestForEachLineLongLine(t *testing.T) {
+	long := strings.Repeat("x", 1<<20)
+	path := writeTemp(t, "long.txt", "short\n"+long+"\nlast\n")
+
+	calls := 0
+	err := resource.ForEachLine(path, func(line string) error {
+		calls++
+		return nil
+	})
+	if !errors.Is(err, bufio.ErrTooLong) {
+		t.Errorf("ForEachLine of a 1MB line = %v, want %v", err, bufio.ErrTooLong)
+	}
+	if calls != 1 {
+		t.Errorf("%d calls before the long line, want 1: it must not be truncated", calls)
+	}
+
+	var lengths []int
+	err = resource.ForEachLine(path, func(line string) error {
+		lengths = append(lengths, len(line))
+		return nil
+	}, resource.MaxLineSize(2<<20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{5, 1 << 20, 4}; !slices.Equal(lengths, want) {
+		t.Errorf("line lengths = %v, want %v", lengths, want)
+	}
+}
+
+func TestForEachLineStops(t *testing.T) {
+	path := writeTemp(t, "lines.txt", "1\n2\n3\n4\n")
+	errBoom := errors.New("boom")
+	for _, stop := range []error{resource.ErrStopIteration, errBoom} {
+		var lines []string
+		err := resource.ForEachLine(path, func(line string) error {
+			lines = append(lines, line)
+			if line == "2" {
+				return stop
+			}
+			return nil
+		})
+		if stop == resource.ErrStopIteration && err != nil || stop == errBoom && !errors.Is(err, errBoom) {
+			t.Errorf("ForEachLine stopped with %v = %v", stop, err)
+		}
+		if !slices.Equal(lines, []string{"1", "2"}) {
+			t.Errorf("lines = %q after stopping with %v", lines, stop)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package resource
+
+import (
+	"errors"
+	"net"
+)
+
+// NewListenerResource listens with net.Listen for every Use and closes the listener afterwards.
+// Port 0 in address picks a free port, the callback finds it in l.Addr().
+func NewListenerResource(network, address string) Resource[net.Listener] {
+	return Resource[net.Listener]{
+		Use: func(callback func(l net.Listener) error) error {
+			l, err := net.Listen(network, address)
+			if err != nil {
+				return phaseError(PhaseAcquire, err)
+			}
+			err = useCallback(callback, l)
+			closeErr := l.Close()
+			if errors.Is(closeErr, net.ErrClosed) {
+				// closed by the callback, http.Server.Close does that
+				warn(WarnDoubleClose, "listener "+l.Addr().String())
+				closeErr = nil
+			}
+			return errors.Join(err, phaseError(PhaseRelease, closeErr))
+		},
+	}
+}
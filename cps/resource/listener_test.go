@@ -0,0 +1,58 @@
+package resource_test
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+// relisten fails the test unless addr can be listened on again.
+func relisten(t *testing.T, addr string) {
+	t.Helper()
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatalf("port not released: %v", err)
+	}
+	l.Close()
+}
+
+func TestListenerResourceReleasesPort(t *testing.T) {
+	var addr string
+	errBoom := errors.New("boom")
+	err := resource.NewListenerResource("tcp", "127.0.0.1:0").Use(func(l net.Listener) error {
+		addr = l.Addr().String()
+		if _, err := net.Listen("tcp", addr); err == nil {
+			t.Error("port free while listened on")
+		}
+		return errBoom
+	})
+	if !errors.Is(err, errBoom) {
+		t.Errorf("Use = %v, want the error of the callback", err)
+	}
+	relisten(t, addr)
+}
+
+func TestListenerResourceClosedByCallback(t *testing.T) {
+	warnings := captureWarnings(t)
+	err := resource.NewListenerResource("tcp", "127.0.0.1:0").Use(func(l net.Listener) error {
+		return l.Close()
+	})
+	if err != nil {
+		t.Errorf("Use = %v, want the double close dropped", err)
+	}
+	if !hasWarning(warnings(), resource.WarnDoubleClose) {
+		t.Errorf("no WarnDoubleClose in %v", warnings())
+	}
+}
+
+func TestListenerResourceAcquireError(t *testing.T) {
+	err := resource.NewListenerResource("tcp", "256.0.0.1:0").Use(func(net.Listener) error {
+		t.Error("callback called without a listener")
+		return nil
+	})
+	if phaseOf(t, err) != resource.PhaseAcquire {
+		t.Errorf("Use = %v, want an acquire error", err)
+	}
+}
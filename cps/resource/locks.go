@@ -0,0 +1,284 @@
+package resource
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Q69K/using-cps-in-golang/cps/internal/goid"
+)
+
+// LockResource is a lock-like resource, like a mutex or a semaphore: its value carries nothing,
+// holding it is the point. Acquire several of them with OrderedAcquire, not by nesting their Resource,
+// so every code path takes them in the same order.
+type LockResource struct {
+	name   string
+	rank   int
+	id     uint64
+	lock   func() error
+	unlock func() error
+}
+
+type lockOptions struct {
+	rank int
+}
+
+// LockOption configures NewLockResource.
+type LockOption func(options *lockOptions)
+
+// WithRank orders the lock before the locks of a greater rank in OrderedAcquire;
+// locks of the same rank, 0 by default, are ordered by creation.
+func WithRank(rank int) LockOption {
+	return func(options *lockOptions) {
+		options.rank = rank
+	}
+}
+
+var lockIDs atomic.Uint64
+
+// NewLockResource creates a lock acquired with lock and released with unlock.
+func NewLockResource(name string, lock, unlock func() error, opts ...LockOption) *LockResource {
+	var options lockOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return &LockResource{name: name, rank: options.rank, id: lockIDs.Add(1), lock: lock, unlock: unlock}
+}
+
+// MutexLock is the lock resource of mu.
+func MutexLock(name string, mu sync.Locker, opts ...LockOption) *LockResource {
+	return NewLockResource(name, func() error {
+		mu.Lock()
+		return nil
+	}, func() error {
+		mu.Unlock()
+		return nil
+	}, opts...)
+}
+
+// SemaphoreLock is the lock resource taking one slot of sem, a channel with one buffered slot per holder.
+func SemaphoreLock(name string, sem chan struct{}, opts ...LockOption) *LockResource {
+	return NewLockResource(name, func() error {
+		sem <- struct{}{}
+		return nil
+	}, func() error {
+		<-sem
+		return nil
+	}, opts...)
+}
+
+// Name is the name the lock was created with.
+func (l *LockResource) Name() string {
+	return l.name
+}
+
+// Resource holds the lock alone.
+func (l *LockResource) Resource() Resource[struct{}] {
+	return Resource[struct{}]{
+		Use: func(callback func(struct{}) error) error {
+			return useLocks([]*LockResource{l}, callback)
+		},
+		Description: "lock " + l.name,
+	}
+}
+
+// OrderedAcquire holds all the locks, acquired by rank then creation order whatever the order of the arguments,
+// and released in reverse. A lock given twice is acquired once.
+//
+// In debug mode (see SetDebug) every lock acquisition is checked against the order
+// locks were acquired in before, nested Resource calls included, and a WarnLockOrder warning
+// is reported when two code paths take the same locks in conflicting orders.
+func OrderedAcquire(locks ...*LockResource) Resource[struct{}] {
+	sorted := make([]*LockResource, 0, len(locks))
+	for _, l := range locks {
+		if !containsLock(sorted, l) {
+			sorted = append(sorted, l)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].rank != sorted[j].rank {
+			return sorted[i].rank < sorted[j].rank
+		}
+		return sorted[i].id < sorted[j].id
+	})
+	names := make([]string, len(sorted))
+	for i, l := range sorted {
+		names[i] = l.name
+	}
+	return Resource[struct{}]{
+		Use: func(callback func(struct{}) error) error {
+			return useLocks(sorted, callback)
+		},
+		Description: "locks " + strings.Join(names, ", "),
+	}
+}
+
+func containsLock(locks []*LockResource, l *LockResource) bool {
+	for _, other := range locks {
+		if other == l {
+			return true
+		}
+	}
+	return false
+}
+
+func useLocks(locks []*LockResource, callback func(struct{}) error) (err error) {
+	for i, l := range locks {
+		if debug.Load() {
+			lockOrder.acquiring(l)
+		}
+		err := l.lock()
+		if err != nil {
+			if debug.Load() {
+				lockOrder.released(l)
+			}
+			return errors.Join(describedError(PhaseAcquire, "lock "+l.name, err), unlockAll(locks[:i]))
+		}
+	}
+	defer func() {
+		err = errors.Join(err, unlockAll(locks))
+	}()
+	return callback(struct{}{})
+}
+
+// unlockAll releases locks in reverse.
+func unlockAll(locks []*LockResource) error {
+	var errs []error
+	for i := len(locks) - 1; i >= 0; i-- {
+		l := locks[i]
+		err := l.unlock()
+		if debug.Load() {
+			lockOrder.released(l)
+		}
+		if err != nil {
+			errs = append(errs, describedError(PhaseRelease, "lock "+l.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// LockOrderError is the Err of a WarnLockOrder warning: Cycle lists the names of locks
+// each acquired while holding the previous one (the last while holding the first),
+// and Stacks[i] is where Cycle[i+1] was acquired while holding Cycle[i].
+type LockOrderError struct {
+	Cycle  []string
+	Stacks []string
+}
+
+func (e *LockOrderError) Error() string {
+	return "lock order cycle: " + strings.Join(e.Cycle, " -> ") + " -> " + e.Cycle[0]
+}
+
+// Format prints the stacks too with %+v.
+func (e *LockOrderError) Format(s fmt.State, verb rune) {
+	_, _ = fmt.Fprint(s, e.Error())
+	if verb == 'v' && s.Flag('+') {
+		for i, stack := range e.Stacks {
+			_, _ = fmt.Fprintf(s, "\n\n%s acquired holding %s:\n%s", e.Cycle[(i+1)%len(e.Cycle)], e.Cycle[i], stack)
+		}
+	}
+}
+
+// lockOrder is the graph of the locks acquired while holding others, kept in debug mode.
+var lockOrder = &lockGraph{
+	edges: make(map[*LockResource]map[*LockResource]string),
+	held:  make(map[string][]*LockResource),
+}
+
+type lockGraph struct {
+	mu       sync.Mutex
+	edges    map[*LockResource]map[*LockResource]string // held -> acquired -> stack
+	held     map[string][]*LockResource                 // by goroutine
+	reported map[[2]*LockResource]bool
+}
+
+func (g *lockGraph) acquiring(l *LockResource) {
+	goroutine := goid.Current()
+	var cycles []*LockOrderError
+	g.mu.Lock()
+	var stack string
+	for _, h := range g.held[goroutine] {
+		if h == l || g.edges[h][l] != "" {
+			continue
+		}
+		if stack == "" {
+			stack = currentStack()
+		}
+		if g.edges[h] == nil {
+			g.edges[h] = make(map[*LockResource]string)
+		}
+		g.edges[h][l] = stack
+		if path := g.path(l, h); path != nil && !g.reported[[2]*LockResource{h, l}] {
+			if g.reported == nil {
+				g.reported = make(map[[2]*LockResource]bool)
+			}
+			g.reported[[2]*LockResource{h, l}] = true
+			cycles = append(cycles, g.cycle(append([]*LockResource{h}, path...)))
+		}
+	}
+	g.held[goroutine] = append(g.held[goroutine], l)
+	g.mu.Unlock()
+
+	for _, cycle := range cycles {
+		warnErr(WarnLockOrder, "lock "+l.name, cycle)
+	}
+}
+
+func (g *lockGraph) released(l *LockResource) {
+	goroutine := goid.Current()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	held := g.held[goroutine]
+	for i := len(held) - 1; i >= 0; i-- {
+		if held[i] == l {
+			held = append(held[:i], held[i+1:]...)
+			break
+		}
+	}
+	if len(held) == 0 {
+		delete(g.held, goroutine)
+	} else {
+		g.held[goroutine] = held
+	}
+}
+
+// path returns the locks from "from" to "to" (both included) following the edges, nil if there is none.
+func (g *lockGraph) path(from, to *LockResource) []*LockResource {
+	visited := map[*LockResource]bool{}
+	var walk func(l *LockResource) []*LockResource
+	walk = func(l *LockResource) []*LockResource {
+		if l == to {
+			return []*LockResource{l}
+		}
+		visited[l] = true
+		for next := range g.edges[l] {
+			if visited[next] {
+				continue
+			}
+			if path := walk(next); path != nil {
+				return append([]*LockResource{l}, path...)
+			}
+		}
+		return nil
+	}
+	return walk(from)
+}
+
+// cycle describes the locks of path, whose last lock is its first one.
+func (g *lockGraph) cycle(path []*LockResource) *LockOrderError {
+	err := &LockOrderError{}
+	for i, l := range path[:len(path)-1] {
+		err.Cycle = append(err.Cycle, l.name)
+		err.Stacks = append(err.Stacks, g.edges[l][path[i+1]])
+	}
+	return err
+}
+
+func currentStack() string {
+	buf := make([]byte, 8<<10)
+	return string(buf[:runtime.Stack(buf, false)])
+}
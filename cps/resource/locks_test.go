@@ -0,0 +1,163 @@
+package resource_test
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/group"
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+// recordingLock is a lock resource recording its lock and unlock calls in events, failing to lock with lockErr.
+func recordingLock(name string, events *[]string, lockErr error, opts ...resource.LockOption) *resource.LockResource {
+	return resource.NewLockResource(name, func() error {
+		*events = append(*events, "lock "+name)
+		return lockErr
+	}, func() error {
+		*events = append(*events, "unlock "+name)
+		return nil
+	}, opts...)
+}
+
+func TestOrderedAcquireOrder(t *testing.T) {
+	var events []string
+	a := recordingLock("a", &events, nil)
+	b := recordingLock("b", &events, nil)
+	first := recordingLock("first", &events, nil, resource.WithRank(-1))
+
+	locks := resource.OrderedAcquire(b, a, first, b)
+	err := locks.Use(func(struct{}) error {
+		events = append(events, "callback")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"lock first", "lock a", "lock b", "callback", "unlock b", "unlock a", "unlock first"}
+	if !slices.Equal(events, want) {
+		t.Errorf("events = %q, want %q", events, want)
+	}
+	if got := locks.Describe(); got != "locks first, a, b" {
+		t.Errorf("Describe = %q", got)
+	}
+}
+
+func TestOrderedAcquireFailureReleasesHeld(t *testing.T) {
+	errBusy := errors.New("busy")
+	var events []string
+	a := recordingLock("a", &events, nil)
+	b := recordingLock("b", &events, errBusy)
+	c := recordingLock("c", &events, nil)
+
+	err := resource.OrderedAcquire(c, b, a).Use(func(struct{}) error {
+		t.Error("callback called")
+		return nil
+	})
+	if !errors.Is(err, errBusy) || phaseOf(t, err) != resource.PhaseAcquire || !strings.Contains(err.Error(), "lock b") {
+		t.Errorf("Use = %v, want the acquire error of b", err)
+	}
+	if want := []string{"lock a", "lock b", "unlock a"}; !slices.Equal(events, want) {
+		t.Errorf("events = %q, want %q", events, want)
+	}
+}
+
+func TestOrderedAcquireAvoidsABBA(t *testing.T) {
+	var muA, muB sync.Mutex
+	a := resource.MutexLock("a", &muA)
+	b := resource.MutexLock("b", &muB)
+	sem := make(chan struct{}, 1)
+	s := resource.SemaphoreLock("sem", sem)
+
+	// nesting a.Resource() in b.Resource() on one side and the reverse on the other deadlocks;
+	// OrderedAcquire takes them in the same order whatever the order of its arguments
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		g := group.NewSafeWaitGroup()
+		for _, order := range [][]*resource.LockResource{{a, b, s}, {s, b, a}} {
+			g.Run(func() {
+				for range 1000 {
+					err := resource.OrderedAcquire(order...).Use(func(struct{}) error { return nil })
+					if err != nil {
+						t.Error(err)
+						return
+					}
+				}
+			})
+		}
+		g.Wait()
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("OrderedAcquire deadlocked")
+	}
+}
+
+func TestLockOrderDetector(t *testing.T) {
+	resource.SetDebug(true)
+	t.Cleanup(func() {
+		resource.SetDebug(false)
+	})
+	warnings := captureWarnings(t)
+	var muA, muB sync.Mutex
+	a := resource.MutexLock("a", &muA)
+	b := resource.MutexLock("b", &muB)
+	nested := func(outer, inner *resource.LockResource) {
+		err := outer.Resource().Use(func(struct{}) error {
+			return inner.Resource().Use(func(struct{}) error { return nil })
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// one after the other they can't deadlock, but together they could
+	nested(a, b)
+	if hasWarning(warnings(), resource.WarnLockOrder) {
+		t.Fatalf("warnings = %v after a single order", warnings())
+	}
+	nested(b, a)
+	nested(b, a)
+
+	var reports []resource.Warning
+	for _, w := range warnings() {
+		if w.Kind == resource.WarnLockOrder {
+			reports = append(reports, w)
+		}
+	}
+	if len(reports) != 1 {
+		t.Fatalf("warnings = %v, want the cycle reported once", warnings())
+	}
+	var orderErr *resource.LockOrderError
+	if !errors.As(reports[0].Err, &orderErr) || !slices.Equal(orderErr.Cycle, []string{"b", "a"}) {
+		t.Fatalf("warning = %v, want the cycle b, a", reports[0])
+	}
+	if got := orderErr.Error(); got != "lock order cycle: b -> a -> b" {
+		t.Errorf("Error = %q", got)
+	}
+	report := fmt.Sprintf("%+v", orderErr)
+	if !strings.Contains(report, "a acquired holding b:") || !strings.Contains(report, "b acquired holding a:") ||
+		strings.Count(report, "TestLockOrderDetector") < 2 {
+		t.Errorf("report = %s, want both acquisitions with their stacks", report)
+	}
+
+	// OrderedAcquire never creates a cycle
+	warningsBefore := len(warnings())
+	c := resource.MutexLock("c", new(sync.Mutex))
+	d := resource.MutexLock("d", new(sync.Mutex))
+	for _, order := range [][]*resource.LockResource{{c, d}, {d, c}} {
+		err := resource.OrderedAcquire(order...).Use(func(struct{}) error { return nil })
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(warnings()) != warningsBefore {
+		t.Errorf("warnings = %v, want none for OrderedAcquire", warnings()[warningsBefore:])
+	}
+}
@@ -0,0 +1,137 @@
+package resource
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+)
+
+// WithQueryLogging logs begin, commit and rollback of the transaction with its total duration.
+// A nil logger disables it.
+//
+// The statements run by the callback are logged by NewLoggedQueryer.
+func WithQueryLogging(logger *slog.Logger) TxOption {
+	return func(options *txOptions) {
+		options.logger = logger
+	}
+}
+
+func (options *txOptions) logBegin(err error) {
+	if options.logger == nil {
+		return
+	}
+	if err != nil {
+		options.logger.Error("sql tx begin", "error", err)
+		return
+	}
+	options.logger.Debug("sql tx begin")
+}
+
+func (options *txOptions) logEnd(event string, started time.Time, err error) {
+	if options.logger == nil {
+		return
+	}
+	level := slog.LevelDebug
+	if err != nil {
+		level = slog.LevelError
+	}
+	options.logger.Log(context.Background(), level, "sql tx "+event,
+		"duration", clockOr(options.clock).Now().Sub(started), "error", err)
+}
+
+type logOptions struct {
+	redact func(query string, args []any) []any
+	clock  Clock
+}
+
+// LogOption configures NewLoggedQueryer.
+type LogOption func(options *logOptions)
+
+// RedactArgs replaces the query arguments before they are logged, to keep secrets out of logs.
+func RedactArgs(redact func(query string, args []any) []any) LogOption {
+	return func(options *logOptions) {
+		options.redact = redact
+	}
+}
+
+// LogClock makes NewLoggedQueryer measure the statements with clock.
+func LogClock(clock Clock) LogOption {
+	return func(options *logOptions) {
+		options.clock = clock
+	}
+}
+
+// NewLoggedQueryer logs every statement run through q: query, arguments, duration,
+// rows affected for Exec, and the error. With a nil logger q is returned as is.
+//
+// Rows returned by Query are not counted: *sql.Rows can't be wrapped.
+func NewLoggedQueryer(q Queryer, logger *slog.Logger, opts ...LogOption) Queryer {
+	if logger == nil {
+		return q
+	}
+	var options logOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	options.clock = clockOr(options.clock)
+	return &loggedQueryer{q: q, logger: logger, options: options}
+}
+
+type loggedQueryer struct {
+	q       Queryer
+	logger  *slog.Logger
+	options logOptions
+}
+
+func (lq *loggedQueryer) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	started := lq.options.clock.Now()
+	result, err := lq.q.ExecContext(ctx, query, args...)
+	attrs := lq.attrs(query, args, started, err)
+	if err == nil {
+		affected, affectedErr := result.RowsAffected()
+		if affectedErr == nil {
+			attrs = append(attrs, slog.Int64("rows_affected", affected))
+		}
+	}
+	lq.log(ctx, "sql exec", err, attrs)
+	return result, err
+}
+
+func (lq *loggedQueryer) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	started := lq.options.clock.Now()
+	rows, err := lq.q.QueryContext(ctx, query, args...)
+	lq.log(ctx, "sql query", err, lq.attrs(query, args, started, err))
+	return rows, err
+}
+
+func (lq *loggedQueryer) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	started := lq.options.clock.Now()
+	row := lq.q.QueryRowContext(ctx, query, args...)
+	err := row.Err()
+	lq.log(ctx, "sql query row", err, lq.attrs(query, args, started, err))
+	return row
+}
+
+func (lq *loggedQueryer) attrs(query string, args []any, started time.Time, err error) []slog.Attr {
+	if lq.options.redact != nil {
+		args = lq.options.redact(query, args)
+	}
+	attrs := []slog.Attr{
+		slog.String("query", query),
+		slog.Any("args", args),
+		slog.Duration("duration", lq.options.clock.Now().Sub(started)),
+	}
+	if err != nil {
+		attrs = append(attrs, slog.Any("error", err))
+	}
+	return attrs
+}
+
+func (lq *loggedQueryer) log(ctx context.Context, msg string, err error, attrs []slog.Attr) {
+	level := slog.LevelDebug
+	if err != nil {
+		level = slog.LevelError
+	}
+	lq.logger.LogAttrs(ctx, level, msg, attrs...)
+}
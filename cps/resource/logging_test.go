@@ -0,0 +1,150 @@
+package resource_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+	"github.com/Q69K/using-cps-in-golang/cps/resource/resourcetest"
+)
+
+// slowQueryer makes every Exec last a second on its clock.
+type slowQueryer struct {
+	resource.Queryer
+	clock *resourcetest.FakeClock
+}
+
+func (q slowQueryer) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	q.clock.Advance(time.Second)
+	return q.Queryer.ExecContext(ctx, query, args...)
+}
+
+func debugLogger(logs *bytes.Buffer) *slog.Logger {
+	return slog.New(slog.NewTextHandler(logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+}
+
+func TestNewLoggedQueryerOnClock(t *testing.T) {
+	db := openDB(t)
+	clock := newFakeClock()
+	var logs bytes.Buffer
+	q := resource.NewLoggedQueryer(slowQueryer{Queryer: db, clock: clock}, debugLogger(&logs), resource.LogClock(clock))
+
+	_, err := q.ExecContext(context.Background(), "INSERT INTO items (name) VALUES (?)", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(logs.String(), "duration=1s") || !strings.Contains(logs.String(), "rows_affected=1") {
+		t.Fatalf("logged %q, want the second of the clock", logs.String())
+	}
+}
+
+func TestWithQueryLoggingOnClock(t *testing.T) {
+	db := openDB(t)
+	clock := newFakeClock()
+	var logs bytes.Buffer
+	err := resource.RunTransaction(db, resource.WithQueryLogging(debugLogger(&logs)), resource.TxClock(clock)).Use(func(tx *sql.Tx) error {
+		clock.Advance(2 * time.Second)
+		return insertItem(tx, "a")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(logs.String(), `msg="sql tx commit" duration=2s`) {
+		t.Fatalf("logged %q, want the commit after the 2s of the clock", logs.String())
+	}
+}
+
+// recordingHandler keeps the messages of the records it handles, with their attributes.
+type recordingHandler struct {
+	records *[]string
+}
+
+func (h recordingHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h recordingHandler) Handle(_ context.Context, record slog.Record) error {
+	line := record.Level.String() + " " + record.Message
+	record.Attrs(func(attr slog.Attr) bool {
+		line += " " + attr.String()
+		return true
+	})
+	*h.records = append(*h.records, line)
+	return nil
+}
+
+func (h recordingHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+func (h recordingHandler) WithGroup(string) slog.Handler      { return h }
+
+// helloLogged is helloSql_Cool of the demo, logged.
+func helloLogged(db *sql.DB, logger *slog.Logger, clock resource.Clock, name string) (int64, error) {
+	tx := resource.RunTransaction(db, resource.WithQueryLogging(logger), resource.TxClock(clock))
+	return resource.UseValue(tx, func(tx *sql.Tx) (int64, error) {
+		q := resource.NewLoggedQueryer(tx, logger, resource.LogClock(clock), resource.RedactArgs(func(string, []any) []any {
+			return []any{"<redacted>"}
+		}))
+		return resource.ExecReturningID(q, "INSERT INTO items (name) VALUES (?)", name)
+	})
+}
+
+func TestQueryLoggingRecords(t *testing.T) {
+	db := openDB(t)
+	var records []string
+	logger := slog.New(recordingHandler{records: &records})
+
+	id, err := helloLogged(db, logger, newFakeClock(), "MessageBird")
+	if err != nil || id != 1 {
+		t.Fatalf("helloLogged = %d, %v", id, err)
+	}
+	want := []string{
+		"DEBUG sql tx begin",
+		"DEBUG sql exec query=INSERT INTO items (name) VALUES (?) args=[<redacted>] duration=0s rows_affected=1",
+		"DEBUG sql tx commit duration=0s error=<nil>",
+	}
+	if !slices.Equal(records, want) {
+		t.Errorf("records:\n%s\nwant:\n%s", strings.Join(records, "\n"), strings.Join(want, "\n"))
+	}
+
+	records = nil
+	_, err = resource.UseValue(resource.RunTransaction(db, resource.WithQueryLogging(logger)), func(tx *sql.Tx) (int64, error) {
+		return resource.ExecReturningID(resource.NewLoggedQueryer(tx, logger), "INSERT INTO missing (name) VALUES (?)", "a")
+	})
+	if err == nil {
+		t.Fatal("insert into a missing table succeeded")
+	}
+	if len(records) != 3 || !strings.HasPrefix(records[1], "ERROR sql exec query=INSERT INTO missing") ||
+		!strings.Contains(records[1], "error=no such table") || !strings.HasPrefix(records[2], "DEBUG sql tx rollback") {
+		t.Errorf("records for the failed insert:\n%s", strings.Join(records, "\n"))
+	}
+}
+
+func TestQueryLoggingWithoutLogger(t *testing.T) {
+	db := openDB(t)
+	if q := resource.NewLoggedQueryer(db, nil); q != resource.Queryer(db) {
+		t.Errorf("NewLoggedQueryer without a logger = %T, want the queryer itself", q)
+	}
+	err := resource.RunTransaction(db, resource.WithQueryLogging(nil)).Use(func(tx *sql.Tx) error {
+		return insertItem(tx, "a")
+	})
+	if err != nil || countItems(t, db) != 1 {
+		t.Errorf("Use without a logger = %v, %d rows", err, countItems(t, db))
+	}
+}
+
+func BenchmarkRunTransactionWithoutLogger(b *testing.B) {
+	tx := resource.RunTransaction(openDB(b), resource.WithQueryLogging(nil))
+	benchmark(b, func() error { return tx.Use(useTx) })
+}
+
+func BenchmarkLoggedQueryerWithoutLogger(b *testing.B) {
+	db := openDB(b)
+	q := resource.NewLoggedQueryer(db, nil)
+	benchmark(b, func() error {
+		_, err := q.ExecContext(context.Background(), "UPDATE items SET name = name")
+		return err
+	})
+}
@@ -0,0 +1,87 @@
+package resource
+
+import (
+	"database/sql"
+	"reflect"
+	"strconv"
+)
+
+// QueryMaps runs the query and returns its rows as maps from column name to value,
+// for queries whose columns aren't known in advance.
+//
+// Values are whatever the driver returns, typically int64, float64, string, []byte (copied),
+// time.Time, or nil for NULL; []byte of text columns is turned into string.
+// Duplicate column names, as in a join, get a suffix: id, id_2, id_3...
+func QueryMaps(q Queryer, query string, args ...any) ([]map[string]any, error) {
+	var result []map[string]any
+	err := ForEachMap(q, func(row map[string]any) error {
+		result = append(result, row)
+		return nil
+	}, query, args...)
+	return result, err
+}
+
+// ForEachMap is QueryMaps calling fn for every row instead of collecting them.
+// fn may keep the map, every row gets a new one.
+func ForEachMap(q Queryer, fn func(row map[string]any) error, query string, args ...any) error {
+	return QueryRows(q, query, args...).Use(func(rows *sql.Rows) error {
+		types, err := rows.ColumnTypes()
+		if err != nil {
+			return err
+		}
+		names := uniqueColumnNames(types)
+		textColumns := make([]bool, len(types))
+		for i, t := range types {
+			if scanType := t.ScanType(); scanType != nil {
+				textColumns[i] = scanType.Kind() == reflect.String ||
+					scanType == reflect.TypeOf(sql.NullString{})
+			}
+		}
+
+		values := make([]any, len(types))
+		dest := make([]any, len(types))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		for rows.Next() {
+			// scanning into *any copies []byte, it doesn't alias the driver's buffer
+			err := rows.Scan(dest...)
+			if err != nil {
+				return err
+			}
+			row := make(map[string]any, len(names))
+			for i, name := range names {
+				value := values[i]
+				if b, ok := value.([]byte); ok && textColumns[i] {
+					value = string(b)
+				}
+				row[name] = value
+			}
+			err = fn(row)
+			if err != nil {
+				return err
+			}
+		}
+		return rows.Err()
+	})
+}
+
+func uniqueColumnNames(types []*sql.ColumnType) []string {
+	names := make([]string, len(types))
+	seen := make(map[string]int, len(types))
+	for i, t := range types {
+		name := t.Name()
+		seen[name]++
+		for n := seen[name]; n > 1; n++ {
+			candidate := name + "_" + strconv.Itoa(n)
+			if seen[candidate] == 0 {
+				seen[name] = n
+				name = candidate
+				seen[name]++
+				break
+			}
+		}
+		names[i] = name
+	}
+	return names
+}
@@ -0,0 +1,112 @@
+package resource_test
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+func TestQueryMapsTypes(t *testing.T) {
+	db := openDB(t)
+	at := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	_, err := db.Exec("CREATE TABLE values_ (i INTEGER, r REAL, s TEXT, b BLOB, at TIMESTAMP)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec("INSERT INTO values_ VALUES (?, ?, ?, ?, ?), (NULL, NULL, NULL, NULL, NULL), (2, 2.5, 'b', ?, ?)",
+		1, 1.5, "a", []byte{1, 2}, at, []byte{3, 4}, at)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := resource.QueryMaps(db, "SELECT i, r, s, b, at FROM values_ ORDER BY rowid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("%d rows, want 3", len(rows))
+	}
+	want := map[string]any{"i": int64(1), "r": 1.5, "s": "a", "b": []byte{1, 2}, "at": at}
+	if len(rows[0]) != len(want) {
+		t.Errorf("row = %v, want %v", rows[0], want)
+	}
+	for name, value := range want {
+		got := rows[0][name]
+		if gotTime, ok := got.(time.Time); ok && gotTime.Equal(at) {
+			continue // in the local time zone
+		}
+		if !reflect.DeepEqual(got, value) {
+			t.Errorf("%s = %#v, want %#v", name, got, value)
+		}
+	}
+	for name, value := range rows[1] {
+		if value != nil {
+			t.Errorf("NULL %s = %v, want nil", name, value)
+		}
+	}
+	// every row has its own copy of the blob
+	if b := rows[0]["b"].([]byte); !bytes.Equal(b, []byte{1, 2}) || !bytes.Equal(rows[2]["b"].([]byte), []byte{3, 4}) {
+		t.Errorf("blobs %v and %v, want [1 2] and [3 4]", b, rows[2]["b"])
+	}
+}
+
+func TestQueryMapsDuplicateColumns(t *testing.T) {
+	db := openDB(t)
+	_, err := db.Exec("INSERT INTO items (name) VALUES ('a'), ('b')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := resource.QueryMaps(db, "SELECT * FROM items a JOIN items b ON b.id = a.id + 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []map[string]any{{"id": int64(1), "name": "a", "id_2": int64(2), "name_2": "b"}}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows = %v, want %v", rows, want)
+	}
+
+	// a suffixed name already taken gets the next suffix
+	rows, err = resource.QueryMaps(db, "SELECT 1 AS id, 2 AS id_2, 3 AS id, 4 AS id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []map[string]any{{"id": int64(1), "id_2": int64(2), "id_3": int64(3), "id_4": int64(4)}}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows = %v, want %v", rows, want)
+	}
+}
+
+func TestForEachMap(t *testing.T) {
+	db := openDB(t)
+	_, err := db.Exec("INSERT INTO items (name) VALUES ('a'), ('b'), ('c')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kept []map[string]any
+	errStop := errors.New("stop")
+	err = resource.ForEachMap(db, func(row map[string]any) error {
+		kept = append(kept, row)
+		if len(kept) == 2 {
+			return errStop
+		}
+		return nil
+	}, "SELECT name FROM items WHERE id > ? ORDER BY id", 0)
+	if !errors.Is(err, errStop) {
+		t.Errorf("ForEachMap = %v, want the error of fn", err)
+	}
+	var names []any
+	for _, row := range kept {
+		names = append(names, row["name"])
+	}
+	if !slices.Equal(names, []any{"a", "b"}) {
+		t.Errorf("names = %v, want the rows until the error, each in a map of its own", names)
+	}
+	if db.Stats().InUse != 0 {
+		t.Error("rows not closed after fn failed")
+	}
+}
@@ -0,0 +1,127 @@
+package resource
+
+import (
+	runtimedebug "runtime/debug"
+	"sync"
+	"time"
+)
+
+type memoOptions struct {
+	errorTTL time.Duration
+	clock    Clock
+}
+
+// MemoOption configures Memoize.
+type MemoOption func(options *memoOptions)
+
+// CacheErrors makes Memoize keep a failure for ttl instead of retrying on the next call.
+func CacheErrors(ttl time.Duration) MemoOption {
+	return func(options *memoOptions) {
+		options.errorTTL = ttl
+	}
+}
+
+// MemoClock makes Memoize tell the age of the failures of CacheErrors with clock.
+func MemoClock(clock Clock) MemoOption {
+	return func(options *memoOptions) {
+		options.clock = clock
+	}
+}
+
+// Memo is the result of Memoize.
+type Memo[R any] struct {
+	compute func() (R, error)
+	options memoOptions
+
+	mu       sync.Mutex
+	cached   bool
+	result   R
+	err      error
+	failedAt time.Time
+	running  *memoCall[R]
+}
+
+type memoCall[R any] struct {
+	done   chan struct{}
+	result R
+	err    error
+}
+
+// Memoize computes cb's result with a value of r on the first Get, and returns it again
+// on the next ones without using r. Concurrent first calls share a single computation.
+// Failures aren't cached, unless CacheErrors says otherwise.
+//
+// m.Get is the func() (R, error) to hand out where the value is needed.
+func Memoize[T, R any](r Resource[T], cb func(value T) (R, error), opts ...MemoOption) *Memo[R] {
+	m := &Memo[R]{compute: func() (R, error) {
+		return UseValue(r, cb)
+	}}
+	for _, opt := range opts {
+		opt(&m.options)
+	}
+	m.options.clock = clockOr(m.options.clock)
+	return m
+}
+
+// Get returns the cached result, computing it when there is none.
+func (m *Memo[R]) Get() (R, error) {
+	m.mu.Lock()
+	if m.cached && (m.err == nil || m.options.clock.Now().Sub(m.failedAt) < m.options.errorTTL) {
+		result, err := m.result, m.err
+		m.mu.Unlock()
+		return result, err
+	}
+	call := m.running
+	if call == nil {
+		call = &memoCall[R]{done: make(chan struct{})}
+		m.running = call
+		m.mu.Unlock()
+		m.run(call)
+		return call.result, call.err
+	}
+	m.mu.Unlock()
+	<-call.done
+	return call.result, call.err
+}
+
+// run computes the result of call and caches it. When compute panics, the callers waiting
+// for call get a *PanicError, nothing is cached, and the panic goes on.
+func (m *Memo[R]) run(call *memoCall[R]) {
+	computed := false
+	defer func() {
+		var p any
+		if !computed {
+			p = recover() // nil for runtime.Goexit, which goes on by itself
+			call.err = &PanicError{Value: p, Stack: runtimedebug.Stack()}
+		}
+		m.finish(call, computed && (call.err == nil || m.options.errorTTL > 0))
+		if p != nil {
+			panic(p)
+		}
+	}()
+	call.result, call.err = m.compute()
+	computed = true
+}
+
+// finish releases the callers waiting for call, caching its result unless Invalidate was called meanwhile.
+func (m *Memo[R]) finish(call *memoCall[R], cache bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.running == call {
+		m.running = nil
+		m.cached = cache
+		m.result, m.err, m.failedAt = call.result, call.err, m.options.clock.Now()
+	}
+	close(call.done)
+}
+
+// Invalidate drops the cached result: the next Get computes it again.
+// A computation running meanwhile still returns to its callers but isn't cached.
+func (m *Memo[R]) Invalidate() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cached = false
+	m.running = nil
+	var zero R
+	m.result, m.err = zero, nil
+}
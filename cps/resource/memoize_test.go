@@ -0,0 +1,147 @@
+package resource_test
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+// spyResource counts its acquisitions.
+func spyResource(acquired *atomic.Int64) resource.Resource[int] {
+	return resource.Resource[int]{
+		Use: func(callback func(value int) error) error {
+			return callback(int(acquired.Add(1)))
+		},
+	}
+}
+
+func TestMemoizeCoalescesFirstCalls(t *testing.T) {
+	var acquired atomic.Int64
+	release := make(chan struct{})
+	memo := resource.Memoize(spyResource(&acquired), func(n int) (int, error) {
+		<-release
+		return n * 10, nil
+	})
+
+	var wg sync.WaitGroup
+	results := make([]int, 10)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := memo.Get()
+			if err != nil {
+				t.Error(err)
+			}
+			results[i] = result
+		}()
+	}
+	eventually(t, func() bool { return acquired.Load() == 1 })
+	close(release)
+	wg.Wait()
+
+	for _, result := range results {
+		if result != 10 {
+			t.Errorf("results = %v, want 10 everywhere", results)
+			break
+		}
+	}
+	if _, _ = memo.Get(); acquired.Load() != 1 {
+		t.Errorf("resource acquired %d times, want once", acquired.Load())
+	}
+}
+
+func TestMemoizeInvalidate(t *testing.T) {
+	var acquired atomic.Int64
+	memo := resource.Memoize(spyResource(&acquired), func(n int) (int, error) {
+		return n, nil
+	})
+	first, _ := memo.Get()
+	memo.Invalidate()
+	second, _ := memo.Get()
+	if first != 1 || second != 2 || acquired.Load() != 2 {
+		t.Errorf("got %d then %d after Invalidate, %d acquisitions", first, second, acquired.Load())
+	}
+}
+
+func TestMemoizeErrors(t *testing.T) {
+	errBoom := errors.New("boom")
+	var acquired atomic.Int64
+	memo := resource.Memoize(spyResource(&acquired), func(n int) (int, error) {
+		return 0, errBoom
+	})
+	for range 2 {
+		if _, err := memo.Get(); !errors.Is(err, errBoom) {
+			t.Errorf("Get = %v", err)
+		}
+	}
+	if acquired.Load() != 2 {
+		t.Errorf("failure cached: %d acquisitions, want 2", acquired.Load())
+	}
+
+	clock := newFakeClock()
+	acquired.Store(0)
+	memo = resource.Memoize(spyResource(&acquired), func(n int) (int, error) {
+		return 0, errBoom
+	}, resource.CacheErrors(time.Minute), resource.MemoClock(clock))
+	memo.Get()
+	clock.Advance(59 * time.Second)
+	memo.Get()
+	if acquired.Load() != 1 {
+		t.Errorf("failure not cached for a minute: %d acquisitions", acquired.Load())
+	}
+	clock.Advance(time.Second)
+	if _, err := memo.Get(); !errors.Is(err, errBoom) || acquired.Load() != 2 {
+		t.Errorf("failure cached past its TTL: %v, %d acquisitions", err, acquired.Load())
+	}
+}
+
+func TestMemoizePanicReleasesWaiters(t *testing.T) {
+	var acquired atomic.Int64
+	release := make(chan struct{})
+	memo := resource.Memoize(spyResource(&acquired), func(n int) (int, error) {
+		if n == 1 {
+			<-release
+			panic("boom")
+		}
+		return n, nil
+	})
+
+	panicked := make(chan any)
+	go func() {
+		defer func() {
+			panicked <- recover()
+		}()
+		memo.Get()
+	}()
+	eventually(t, func() bool { return acquired.Load() == 1 })
+
+	// the waiter may join the panicking computation or come after it: it must not hang either way
+	waited := make(chan error)
+	go func() {
+		_, err := memo.Get()
+		waited <- err
+	}()
+	close(release)
+	if p := <-panicked; p != "boom" {
+		t.Errorf("panic = %v, want it to go on", p)
+	}
+	select {
+	case err := <-waited:
+		var panicErr *resource.PanicError
+		if err != nil && (!errors.As(err, &panicErr) || panicErr.Value != "boom") {
+			t.Errorf("waiting Get = %v, want a *PanicError", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Get still waiting for the computation which panicked")
+	}
+
+	result, err := memo.Get()
+	if err != nil || result < 2 {
+		t.Errorf("Get after the panic = %d, %v, want a new computation", result, err)
+	}
+}
@@ -0,0 +1,162 @@
+package resource
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/group"
+)
+
+// ErrBatcherClosed is returned by the Submit of a closed MicroBatcher.
+var ErrBatcherClosed = errors.New("micro-batcher is closed")
+
+type microBatchOptions struct {
+	clock Clock
+	tx    []TxOption
+}
+
+// MicroBatchOption configures NewMicroBatcher.
+type MicroBatchOption func(options *microBatchOptions)
+
+// BatcherClock makes the batcher time maxDelay with clock.
+func BatcherClock(clock Clock) MicroBatchOption {
+	return func(options *microBatchOptions) {
+		options.clock = clock
+	}
+}
+
+// BatcherTxOptions applies opts to the transactions of the batches.
+func BatcherTxOptions(opts ...TxOption) MicroBatchOption {
+	return func(options *microBatchOptions) {
+		options.tx = append(options.tx, opts...)
+	}
+}
+
+// MicroBatcher groups the items submitted concurrently into transactions of up to maxBatch items,
+// committed at the latest maxDelay after their first item came.
+type MicroBatcher struct {
+	tx       TxResource
+	maxBatch int
+	maxDelay time.Duration
+	apply    func(tx *sql.Tx, items []any) error
+	clock    Clock
+
+	submits chan *batchedItem
+	closing chan struct{}
+	stopped chan struct{}
+	close   sync.Once
+	loop    group.SafeWaitGroup
+	lastErr error // of the flush of Close
+}
+
+type batchedItem struct {
+	item any
+	done chan error
+}
+
+// NewMicroBatcher starts the goroutine of the batcher, which runs apply in a transaction of its own
+// for every batch. Close stops it.
+func NewMicroBatcher(db *sql.DB, maxBatch int, maxDelay time.Duration, apply func(tx *sql.Tx, items []any) error, opts ...MicroBatchOption) *MicroBatcher {
+	var options microBatchOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	b := &MicroBatcher{
+		tx:       RunTransaction(db, options.tx...),
+		maxBatch: max(maxBatch, 1),
+		maxDelay: maxDelay,
+		apply:    apply,
+		clock:    clockOr(options.clock),
+		submits:  make(chan *batchedItem),
+		closing:  make(chan struct{}),
+		stopped:  make(chan struct{}),
+		loop:     group.NewSafeWaitGroup(),
+	}
+	b.loop.Run(b.run)
+	return b
+}
+
+// Submit adds item to the current batch and waits until the batch is committed, returning the error
+// of the batch if it failed. A ctx done stops the waiting, not the batch: the item may still be committed.
+func (b *MicroBatcher) Submit(ctx context.Context, item any) error {
+	submitted := &batchedItem{item: item, done: make(chan error, 1)}
+	select {
+	case b.submits <- submitted:
+	case <-b.closing:
+		return ErrBatcherClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case err := <-submitted.done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close commits the last batch and stops the goroutine of the batcher, returning the error of that batch.
+// When ctx is done first, Close returns ctx.Err() and the batch ends in the background.
+func (b *MicroBatcher) Close(ctx context.Context) error {
+	b.close.Do(func() {
+		close(b.closing)
+	})
+	select {
+	case <-b.stopped:
+		b.loop.Wait()
+		return b.lastErr
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *MicroBatcher) run() {
+	defer close(b.stopped)
+	var pending []*batchedItem
+	var timer Timer
+	var fired <-chan time.Time // nil while there is no pending item
+
+	flush := func() error {
+		if timer != nil {
+			timer.Stop()
+			timer, fired = nil, nil
+		}
+		if len(pending) == 0 {
+			return nil
+		}
+		items := make([]any, len(pending))
+		for i, submitted := range pending {
+			items[i] = submitted.item
+		}
+		err := b.tx.Use(func(tx *sql.Tx) error {
+			return b.apply(tx, items)
+		})
+		for _, submitted := range pending {
+			submitted.done <- err
+		}
+		pending = nil
+		return err
+	}
+
+	for {
+		select {
+		case submitted := <-b.submits:
+			pending = append(pending, submitted)
+			if len(pending) >= b.maxBatch {
+				_ = flush()
+			} else if timer == nil {
+				timer = b.clock.NewTimer(b.maxDelay)
+				fired = timer.C()
+			}
+		case <-fired:
+			_ = flush()
+		case <-b.closing:
+			b.lastErr = flush()
+			return
+		}
+	}
+}
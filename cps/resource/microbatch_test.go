@@ -0,0 +1,182 @@
+package resource_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/group"
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+var errBadItem = errors.New("bad item")
+
+// insertBatch inserts the items as names, recording the size of the batch in sizes,
+// and fails on the item "bad" after inserting the ones before it.
+func insertBatch(sizes *[]int) func(tx *sql.Tx, items []any) error {
+	return func(tx *sql.Tx, items []any) error {
+		*sizes = append(*sizes, len(items))
+		for _, item := range items {
+			if item == "bad" {
+				return errBadItem
+			}
+			err := insertItem(tx, item.(string))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// submitAll submits the items concurrently, returning their errors by item.
+func submitAll(b *resource.MicroBatcher, items ...string) map[string]error {
+	errs := make([]error, len(items))
+	g := group.NewSafeWaitGroup()
+	for i, item := range items {
+		g.Run(func() {
+			errs[i] = b.Submit(context.Background(), item)
+		})
+	}
+	g.Wait()
+	byItem := make(map[string]error, len(items))
+	for i, item := range items {
+		byItem[item] = errs[i]
+	}
+	return byItem
+}
+
+func TestMicroBatcherFlushesOnSize(t *testing.T) {
+	db := openDB(t)
+	clock := newFakeClock()
+	var sizes []int
+	b := resource.NewMicroBatcher(db, 3, time.Second, insertBatch(&sizes), resource.BatcherClock(clock))
+
+	// the clock never moves: only full batches are committed
+	for item, err := range submitAll(b, "a", "b", "c", "d", "e", "f") {
+		if err != nil {
+			t.Errorf("Submit %s = %v", item, err)
+		}
+	}
+	if n := countItems(t, db); n != 6 {
+		t.Errorf("%d items committed, want 6", n)
+	}
+	if !slices.Equal(sizes, []int{3, 3}) {
+		t.Errorf("batches of %v, want two of 3", sizes)
+	}
+	if err := b.Close(context.Background()); err != nil {
+		t.Errorf("Close = %v", err)
+	}
+}
+
+func TestMicroBatcherFlushesOnTime(t *testing.T) {
+	db := openDB(t)
+	clock := newFakeClock()
+	var sizes []int
+	b := resource.NewMicroBatcher(db, 10, time.Second, insertBatch(&sizes), resource.BatcherClock(clock))
+	defer b.Close(context.Background())
+
+	for _, item := range []string{"a", "b"} {
+		submitted := make(chan error, 1)
+		go func() {
+			submitted <- b.Submit(context.Background(), item)
+		}()
+		// the timer starts with the first item of the batch
+		clock.BlockUntilTimers(1)
+		clock.Advance(time.Second - time.Nanosecond)
+		select {
+		case err := <-submitted:
+			t.Fatalf("Submit %s = %v before maxDelay", item, err)
+		case <-time.After(10 * time.Millisecond):
+		}
+		clock.Advance(time.Nanosecond)
+		if err := <-submitted; err != nil {
+			t.Fatalf("Submit %s = %v", item, err)
+		}
+	}
+	if n := countItems(t, db); n != 2 {
+		t.Errorf("%d items committed, want 2", n)
+	}
+	if !slices.Equal(sizes, []int{1, 1}) {
+		t.Errorf("batches of %v, want one per maxDelay", sizes)
+	}
+}
+
+func TestMicroBatcherFlushesOnClose(t *testing.T) {
+	db := openDB(t)
+	clock := newFakeClock()
+	var sizes []int
+	b := resource.NewMicroBatcher(db, 10, time.Second, insertBatch(&sizes), resource.BatcherClock(clock))
+
+	submitted := make(chan error, 1)
+	go func() {
+		submitted <- b.Submit(context.Background(), "a")
+	}()
+	clock.BlockUntilTimers(1)
+	if err := b.Close(context.Background()); err != nil {
+		t.Fatalf("Close = %v", err)
+	}
+	if err := <-submitted; err != nil {
+		t.Errorf("Submit of the pending item = %v", err)
+	}
+	if n := countItems(t, db); n != 1 || !slices.Equal(sizes, []int{1}) {
+		t.Errorf("%d items committed in batches of %v, want the pending one by Close", n, sizes)
+	}
+
+	if err := b.Submit(context.Background(), "b"); !errors.Is(err, resource.ErrBatcherClosed) {
+		t.Errorf("Submit after Close = %v, want ErrBatcherClosed", err)
+	}
+	if err := b.Close(context.Background()); err != nil {
+		t.Errorf("second Close = %v", err)
+	}
+}
+
+func TestMicroBatcherFailedBatch(t *testing.T) {
+	db := openDB(t)
+	clock := newFakeClock()
+	var sizes []int
+	b := resource.NewMicroBatcher(db, 2, time.Second, insertBatch(&sizes), resource.BatcherClock(clock))
+
+	for item, err := range submitAll(b, "a", "bad") {
+		if !errors.Is(err, errBadItem) {
+			t.Errorf("Submit %s = %v, want the error of its batch", item, err)
+		}
+	}
+	for item, err := range submitAll(b, "c", "d") {
+		if err != nil {
+			t.Errorf("Submit %s to the next batch = %v", item, err)
+		}
+	}
+	rows, err := db.Query("SELECT name FROM items ORDER BY name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+	if !slices.Equal(names, []string{"c", "d"}) {
+		t.Errorf("items = %q, want the failed batch rolled back", names)
+	}
+
+	// the error of the batch flushed by Close is the error of Close
+	submitted := make(chan error, 1)
+	go func() {
+		submitted <- b.Submit(context.Background(), "bad")
+	}()
+	clock.BlockUntilTimers(1)
+	if err := b.Close(context.Background()); !errors.Is(err, errBadItem) {
+		t.Errorf("Close = %v, want the error of the last batch", err)
+	}
+	if err := <-submitted; !errors.Is(err, errBadItem) {
+		t.Errorf("Submit flushed by Close = %v, want the error of its batch", err)
+	}
+}
@@ -0,0 +1,90 @@
+package resource
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Migration is one step of a database schema.
+type Migration struct {
+	// Version orders the migrations and must be unique; applied versions are recorded in schema_migrations.
+	Version int
+	Name    string
+	// Up is the SQL applying the migration, unless Apply is set.
+	Up    string
+	Apply func(tx *sql.Tx) error
+}
+
+const createMigrationsTableQuery = `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	applied_at TIMESTAMP NOT NULL
+)`
+
+type migrateOptions struct {
+	clock Clock
+}
+
+// MigrateOption configures Migrate.
+type MigrateOption func(options *migrateOptions)
+
+// MigrateClock makes Migrate record when the migrations were applied with clock.
+func MigrateClock(clock Clock) MigrateOption {
+	return func(options *migrateOptions) {
+		options.clock = clock
+	}
+}
+
+// Migrate applies the migrations not applied yet to db in version order,
+// each one in its own transaction together with its schema_migrations record:
+// a failed migration leaves the ones before it applied and nothing of itself.
+func Migrate(db *sql.DB, migrations []Migration, opts ...MigrateOption) error {
+	var options migrateOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	clock := clockOr(options.clock)
+	style := placeholderStyleOf(db)
+
+	seen := make(map[int]bool, len(migrations))
+	for i, m := range migrations {
+		if seen[m.Version] {
+			return fmt.Errorf("migrate: duplicate version %d", m.Version)
+		}
+		if i > 0 && m.Version < migrations[i-1].Version {
+			return fmt.Errorf("migrate: version %d is listed after %d", m.Version, migrations[i-1].Version)
+		}
+		seen[m.Version] = true
+	}
+
+	_, err := db.Exec(createMigrationsTableQuery)
+	if err != nil {
+		return fmt.Errorf("migrate: %w", err)
+	}
+
+	for _, m := range migrations {
+		err := RunTransaction(db).Use(func(tx *sql.Tx) error {
+			var applied int
+			err := tx.QueryRow("SELECT COUNT(*) FROM schema_migrations WHERE version = "+style.placeholder(1), m.Version).Scan(&applied)
+			if err != nil || applied > 0 {
+				return err
+			}
+
+			if m.Apply != nil {
+				err = m.Apply(tx)
+			} else {
+				_, err = tx.Exec(m.Up)
+			}
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES ("+
+				style.placeholder(1)+", "+style.placeholder(2)+", "+style.placeholder(3)+")", m.Version, m.Name, clock.Now().UTC())
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("migrate %d %s: %w", m.Version, m.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package resource_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+func TestMigrateClock(t *testing.T) {
+	db := openDB(t)
+	clock := newFakeClock()
+	migrations := []resource.Migration{{Version: 1, Name: "notes", Up: "CREATE TABLE notes (text TEXT)"}}
+	err := resource.Migrate(db, migrations, resource.MigrateClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var applied time.Time
+	err = db.QueryRow("SELECT applied_at FROM schema_migrations WHERE version = 1").Scan(&applied)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !applied.Equal(epoch) {
+		t.Fatalf("applied at %v, want the time of the clock", applied)
+	}
+}
@@ -0,0 +1,155 @@
+package resource
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrUnknownParameter is returned for a :name placeholder missing from the parameters.
+	ErrUnknownParameter = errors.New("unknown named parameter")
+	// ErrUnusedParameter is returned for a parameter no placeholder refers to.
+	ErrUnusedParameter = errors.New("unused named parameter")
+)
+
+// PlaceholderStyle is how a driver expects positional parameters.
+type PlaceholderStyle int
+
+const (
+	// QuestionMark placeholders are used by sqlite and MySQL: `?`.
+	QuestionMark PlaceholderStyle = iota
+	// Dollar placeholders are used by Postgres: `$1`, `$2`...
+	Dollar
+)
+
+// DefaultPlaceholderStyle is used by Named, and by ExecNamed and QueryNamed for the drivers of unknown capabilities.
+var DefaultPlaceholderStyle = QuestionMark
+
+// Named rewrites :name placeholders of query into positional ones of DefaultPlaceholderStyle.
+func Named(query string, params map[string]any) (string, []any, error) {
+	return DefaultPlaceholderStyle.Rewrite(query, params)
+}
+
+// ExecNamed is q.ExecContext with named parameters, rewritten in the placeholder style of the driver of q
+// (see CapabilitiesOf), DefaultPlaceholderStyle when unknown.
+func ExecNamed(q Queryer, query string, params map[string]any) (sql.Result, error) {
+	query, args, err := placeholderStyleOf(q).Rewrite(query, params)
+	if err != nil {
+		return nil, err
+	}
+	return q.ExecContext(context.Background(), query, args...)
+}
+
+// QueryNamed is QueryRows with named parameters, rewritten like in ExecNamed.
+func QueryNamed(q Queryer, query string, params map[string]any) RowsResource {
+	query, args, err := placeholderStyleOf(q).Rewrite(query, params)
+	if err != nil {
+		return RowsResource{
+			Use: func(func(rows *sql.Rows) error) error {
+				return err
+			},
+		}
+	}
+	return QueryRows(q, query, args...)
+}
+
+// Rewrite replaces :name placeholders of query with positional ones and returns their arguments.
+//
+// A name used twice is passed twice with QuestionMark and refers to the same $N with Dollar.
+// Colons inside string literals, quoted identifiers and comments are left alone, as is the `::` cast.
+// Every placeholder must have a parameter and every parameter must be used.
+func (style PlaceholderStyle) Rewrite(query string, params map[string]any) (string, []any, error) {
+	var b strings.Builder
+	var args []any
+	positions := make(map[string]int, len(params))
+
+	for i := 0; i < len(query); {
+		c := query[i]
+		end := i + 1
+		switch {
+		case c == '\'' || c == '"':
+			end = skipQuoted(query, i)
+		case strings.HasPrefix(query[i:], "--"):
+			end = skipUntil(query, i, "\n")
+		case strings.HasPrefix(query[i:], "/*"):
+			end = skipUntil(query, i, "*/")
+		case strings.HasPrefix(query[i:], "::"):
+			end = i + 2
+		case c == ':' && i+1 < len(query) && isNameStart(query[i+1]):
+			end = i + 2
+			for end < len(query) && isNameChar(query[end]) {
+				end++
+			}
+			name := query[i+1 : end]
+			value, ok := params[name]
+			if !ok {
+				return "", nil, fmt.Errorf("%w: %s", ErrUnknownParameter, name)
+			}
+
+			position, seen := positions[name]
+			if !seen || style == QuestionMark {
+				args = append(args, value)
+				position = len(args)
+				positions[name] = position
+			}
+			if style == Dollar {
+				b.WriteString("$" + strconv.Itoa(position))
+			} else {
+				b.WriteByte('?')
+			}
+			i = end
+			continue
+		}
+		b.WriteString(query[i:end])
+		i = end
+	}
+
+	var unused []string
+	for name := range params {
+		if _, ok := positions[name]; !ok {
+			unused = append(unused, name)
+		}
+	}
+	if len(unused) > 0 {
+		sort.Strings(unused)
+		return "", nil, fmt.Errorf("%w: %s", ErrUnusedParameter, strings.Join(unused, ", "))
+	}
+	return b.String(), args, nil
+}
+
+// skipQuoted returns the index after the literal starting at i; doubled quotes are escapes.
+func skipQuoted(query string, i int) int {
+	quote := query[i]
+	for j := i + 1; j < len(query); j++ {
+		if query[j] != quote {
+			continue
+		}
+		if j+1 < len(query) && query[j+1] == quote {
+			j++
+			continue
+		}
+		return j + 1
+	}
+	return len(query)
+}
+
+func skipUntil(query string, i int, terminator string) int {
+	j := strings.Index(query[i+2:], terminator)
+	if j < 0 {
+		return len(query)
+	}
+	return i + 2 + j + len(terminator)
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isNameChar(c byte) bool {
+	return isNameStart(c) || '0' <= c && c <= '9'
+}
@@ -0,0 +1,136 @@
+package resource_test
+
+import (
+	"database/sql"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+func TestRewrite(t *testing.T) {
+	tests := []struct {
+		name   string
+		style  resource.PlaceholderStyle
+		query  string
+		params map[string]any
+		want   string
+		args   []any
+	}{
+		{"question marks", resource.QuestionMark,
+			"SELECT * FROM items WHERE id = :id AND name = :name", map[string]any{"id": 1, "name": "a"},
+			"SELECT * FROM items WHERE id = ? AND name = ?", []any{1, "a"}},
+		{"dollars", resource.Dollar,
+			"SELECT * FROM items WHERE id = :id AND name = :name", map[string]any{"id": 1, "name": "a"},
+			"SELECT * FROM items WHERE id = $1 AND name = $2", []any{1, "a"}},
+		{"name twice with question marks", resource.QuestionMark,
+			"SELECT :a, :b, :a", map[string]any{"a": 1, "b": 2},
+			"SELECT ?, ?, ?", []any{1, 2, 1}},
+		{"name twice with dollars", resource.Dollar,
+			"SELECT :a, :b, :a", map[string]any{"a": 1, "b": 2},
+			"SELECT $1, $2, $1", []any{1, 2}},
+		{"string literal", resource.QuestionMark,
+			"SELECT ':not', 'it''s :not', :yes", map[string]any{"yes": 1},
+			"SELECT ':not', 'it''s :not', ?", []any{1}},
+		{"quoted identifier", resource.Dollar,
+			`SELECT ":not" FROM items WHERE id = :id`, map[string]any{"id": 1},
+			`SELECT ":not" FROM items WHERE id = $1`, []any{1}},
+		{"comments", resource.QuestionMark,
+			"SELECT :a -- :not\n/* :not */ + :b", map[string]any{"a": 1, "b": 2},
+			"SELECT ? -- :not\n/* :not */ + ?", []any{1, 2}},
+		{"cast", resource.Dollar,
+			"SELECT :id::text", map[string]any{"id": 1},
+			"SELECT $1::text", []any{1}},
+		{"lone colon", resource.QuestionMark,
+			"SELECT ': ' || :x, 1 : 2", map[string]any{"x": "a"},
+			"SELECT ': ' || ?, 1 : 2", []any{"a"}},
+		{"no parameters", resource.Dollar,
+			"SELECT 1", nil,
+			"SELECT 1", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			query, args, err := test.style.Rewrite(test.query, test.params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if query != test.want || !slices.Equal(args, test.args) {
+				t.Errorf("Rewrite = %q %v, want %q %v", query, args, test.want, test.args)
+			}
+		})
+	}
+}
+
+func TestRewriteErrors(t *testing.T) {
+	_, _, err := resource.Named("SELECT :a, :b", map[string]any{"a": 1})
+	if !errors.Is(err, resource.ErrUnknownParameter) {
+		t.Errorf("Named with an unknown parameter = %v", err)
+	}
+	_, _, err = resource.Named("SELECT :a", map[string]any{"a": 1, "b": 2, "c": 3})
+	if !errors.Is(err, resource.ErrUnusedParameter) || err.Error() != "unused named parameter: b, c" {
+		t.Errorf("Named with unused parameters = %v", err)
+	}
+	_, _, err = resource.Named("SELECT ':a'", map[string]any{"a": 1})
+	if !errors.Is(err, resource.ErrUnusedParameter) {
+		t.Errorf("Named with the parameter in a literal only = %v", err)
+	}
+}
+
+func TestExecAndQueryNamed(t *testing.T) {
+	db := openDB(t)
+	err := resource.RunTransaction(db).Use(func(tx *sql.Tx) error {
+		for _, name := range []string{"a", "b:c", "d"} {
+			_, err := resource.ExecNamed(tx, "INSERT INTO items (name) VALUES (:name)", map[string]any{"name": name})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	err = resource.QueryNamed(db, "SELECT name FROM items WHERE name <> :skip AND name <> ':skip' AND id >= :min ORDER BY id",
+		map[string]any{"skip": "d", "min": 1}).Use(func(rows *sql.Rows) error {
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				return err
+			}
+			names = append(names, name)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(names, []string{"a", "b:c"}) {
+		t.Errorf("names = %q", names)
+	}
+
+	err = resource.QueryNamed(db, "SELECT name FROM items WHERE id = :id", nil).Use(func(*sql.Rows) error {
+		t.Error("callback called for an unknown parameter")
+		return nil
+	})
+	if !errors.Is(err, resource.ErrUnknownParameter) {
+		t.Errorf("QueryNamed with an unknown parameter = %v", err)
+	}
+}
+
+func TestExecNamedUsesPlaceholdersOfDriver(t *testing.T) {
+	dsn := t.TempDir() // unique to this run of the test
+	err := resource.NewDBResource("recording", dsn).Use(func(db *sql.DB) error {
+		_, err := resource.ExecNamed(db, "UPDATE items SET name = :name WHERE id = :id OR parent = :id", map[string]any{"id": 1, "name": "a"})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"UPDATE items SET name = $1 WHERE id = $2 OR parent = $2"}
+	if got := recorder.recorded(dsn); !slices.Equal(got, want) {
+		t.Errorf("queries = %q, want %q", got, want)
+	}
+}
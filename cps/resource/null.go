@@ -0,0 +1,62 @@
+package resource
+
+import (
+	"database/sql"
+	"database/sql/driver"
+)
+
+// NullValue is a scan destination for a nullable column, see Null.
+type NullValue[T any] struct {
+	null sql.Null[T]
+}
+
+// Null returns a scan destination accepting NULL:
+//
+//	name := Null[string]()
+//	err := row.Scan(name)
+//	if value, ok := name.Get(); ok { ... }
+//
+// Values are converted like database/sql converts them, which rejects lossy conversions
+// such as 1.5 into an int or 300 into an int8.
+func Null[T any]() *NullValue[T] {
+	return &NullValue[T]{}
+}
+
+func (n *NullValue[T]) Scan(src any) error {
+	return n.null.Scan(src)
+}
+
+// Get returns the scanned value, and false if it was NULL.
+func (n *NullValue[T]) Get() (T, bool) {
+	return n.null.V, n.null.Valid
+}
+
+// Value makes NullValue usable as a query argument too.
+func (n *NullValue[T]) Value() (driver.Value, error) {
+	return n.null.Value()
+}
+
+type ptrScanner[T any] struct {
+	dst **T
+}
+
+// Ptr returns a scan destination setting *dst to nil for NULL and to a new T otherwise.
+//
+// Struct fields of pointer types scanned by Rows and the other struct helpers work that way already.
+func Ptr[T any](dst **T) sql.Scanner {
+	return ptrScanner[T]{dst}
+}
+
+func (p ptrScanner[T]) Scan(src any) error {
+	var null sql.Null[T]
+	err := null.Scan(src)
+	if err != nil {
+		return err
+	}
+	if !null.Valid {
+		*p.dst = nil
+		return nil
+	}
+	*p.dst = &null.V
+	return nil
+}
@@ -0,0 +1,127 @@
+package resource_test
+
+import (
+	"bytes"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+// scanNull scans the single value of the query into a Null[T] and a Ptr[T].
+func scanNull[T any](t *testing.T, db *sql.DB, query string, args ...any) (T, bool, *T, error) {
+	t.Helper()
+	null := resource.Null[T]()
+	var ptr *T
+	err := db.QueryRow("SELECT "+query+", "+query, append(args, args...)...).Scan(null, resource.Ptr(&ptr))
+	value, ok := null.Get()
+	return value, ok, ptr, err
+}
+
+func checkNull[T comparable](t *testing.T, db *sql.DB, want T, query string, args ...any) {
+	t.Helper()
+	value, ok, ptr, err := scanNull[T](t, db, query, args...)
+	if err != nil || !ok || value != want || ptr == nil || *ptr != want {
+		t.Errorf("%s as %T = %v, %v, %v, %v, want %v", query, want, value, ok, ptr, err, want)
+	}
+	value, ok, ptr, err = scanNull[T](t, db, "NULL")
+	var zero T
+	if err != nil || ok || value != zero || ptr != nil {
+		t.Errorf("NULL as %T = %v, %v, %v, %v, want no value", want, value, ok, ptr, err)
+	}
+}
+
+func TestNullTypes(t *testing.T) {
+	db := openDB(t)
+	checkNull(t, db, "text", "'text'")
+	checkNull(t, db, int64(42), "42")
+	checkNull(t, db, 42, "42")
+	checkNull(t, db, int8(-3), "-3")
+	checkNull(t, db, uint16(300), "300")
+	checkNull(t, db, 1.5, "1.5")
+	checkNull(t, db, float32(2), "2")
+	checkNull(t, db, true, "1")
+	checkNull(t, db, "42", "42") // numbers convert to text
+
+	at := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	_, err := db.Exec("CREATE TABLE times (at TIMESTAMP); INSERT INTO times VALUES (?)", at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// sqlite returns a time.Time for the columns declared so only
+	value, ok, ptr, err := scanNull[time.Time](t, db, "(SELECT at FROM times)")
+	if err != nil || !ok || !value.Equal(at) || ptr == nil || !ptr.Equal(at) {
+		t.Errorf("time = %v, %v, %v, %v, want %v", value, ok, ptr, err, at)
+	}
+
+	blob, ok, blobPtr, err := scanNull[[]byte](t, db, "?", []byte{1, 2, 3})
+	if err != nil || !ok || !bytes.Equal(blob, []byte{1, 2, 3}) || blobPtr == nil || !bytes.Equal(*blobPtr, blob) {
+		t.Errorf("blob = %v, %v, %v, %v", blob, ok, blobPtr, err)
+	}
+	blob, ok, blobPtr, err = scanNull[[]byte](t, db, "NULL")
+	if err != nil || ok || blob != nil || blobPtr != nil {
+		t.Errorf("NULL blob = %v, %v, %v, %v, want no value", blob, ok, blobPtr, err)
+	}
+}
+
+func TestNullRejectsLossyConversions(t *testing.T) {
+	db := openDB(t)
+	for name, scan := range map[string]func() error{
+		"float into int":          func() error { _, _, _, err := scanNull[int](t, db, "1.5"); return err },
+		"out of range of int8":    func() error { _, _, _, err := scanNull[int8](t, db, "300"); return err },
+		"negative into uint":      func() error { _, _, _, err := scanNull[uint](t, db, "-1"); return err },
+		"text into int":           func() error { _, _, _, err := scanNull[int64](t, db, "'forty-two'"); return err },
+		"text into bool":          func() error { _, _, _, err := scanNull[bool](t, db, "'maybe'"); return err },
+		"out of range of float32": func() error { _, _, _, err := scanNull[float32](t, db, "1e300"); return err },
+	} {
+		if err := scan(); err == nil {
+			t.Errorf("%s succeeded", name)
+		}
+	}
+}
+
+func TestNullAsArgument(t *testing.T) {
+	db := openDB(t)
+	name := resource.Null[string]()
+	var got sql.NullString
+	err := db.QueryRow("SELECT ?", name).Scan(&got)
+	if err != nil || got.Valid {
+		t.Errorf("unset Null as an argument = %v, %v, want NULL", got, err)
+	}
+	err = name.Scan("gopher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.QueryRow("SELECT ?", name).Scan(&got)
+	if err != nil || got.String != "gopher" {
+		t.Errorf("Null as an argument = %v, %v, want gopher", got, err)
+	}
+}
+
+func TestRowsPointerFields(t *testing.T) {
+	db := openDB(t)
+	_, err := db.Exec(`
+		CREATE TABLE people (id INTEGER PRIMARY KEY, nick TEXT, age INTEGER);
+		INSERT INTO people VALUES (1, 'go', 13), (2, NULL, NULL);
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type person struct {
+		ID   int64   `db:"id"`
+		Nick *string `db:"nick"`
+		Age  *int    `db:"age"`
+	}
+	var people []person
+	for p, err := range resource.Rows[person](db, "SELECT id, nick, age FROM people ORDER BY id") {
+		if err != nil {
+			t.Fatal(err)
+		}
+		people = append(people, p)
+	}
+	if len(people) != 2 || people[0].Nick == nil || *people[0].Nick != "go" || people[0].Age == nil || *people[0].Age != 13 ||
+		people[1].Nick != nil || people[1].Age != nil {
+		t.Errorf("people = %+v, want nil fields for NULL", people)
+	}
+}
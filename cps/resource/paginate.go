@@ -0,0 +1,166 @@
+package resource
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidCursor is returned by Paginate for a cursor it didn't produce.
+var ErrInvalidCursor = errors.New("invalid page cursor")
+
+// PageQuery is a keyset (seek) pagination request, which unlike OFFSET doesn't get slower page after page.
+type PageQuery struct {
+	// Query is the SELECT to paginate, without ORDER BY and LIMIT; it must select the Keys columns.
+	Query string
+	Args  []any
+	// Keys are the columns ordering the rows; together they must be unique, like (created_at, id).
+	Keys []string
+	// Size is the maximum number of items of the page.
+	Size int
+	// Cursor is the Next of the previous page, empty for the first page.
+	Cursor string
+}
+
+// Page is the result of Paginate.
+type Page[T any] struct {
+	Items []T
+	// Next is the cursor of the next page, empty after the last page. It is URL-safe.
+	Next string
+}
+
+// Paginate returns the page of p.Query following p.Cursor, ordered by the key columns.
+// decode is called for every row with a scan function which works like rows.Scan.
+func Paginate[T any](q Queryer, p PageQuery, decode func(scan func(dest ...any) error) (T, error)) (Page[T], error) {
+	var page Page[T]
+	if len(p.Keys) == 0 || p.Size < 1 {
+		return page, fmt.Errorf("paginate: keys and a positive size are required")
+	}
+	after, err := decodeCursor(p.Cursor, len(p.Keys))
+	if err != nil {
+		return page, err
+	}
+
+	keys := make([]string, len(p.Keys))
+	for i, key := range p.Keys {
+		keys[i] = QuoteIdentifier(key)
+	}
+	keyList := strings.Join(keys, ", ")
+	args := append([]any(nil), p.Args...)
+	query := "SELECT * FROM (" + p.Query + ") AS page"
+	if after != nil {
+		style := placeholderStyleOf(q)
+		placeholders := make([]string, len(after))
+		for i, value := range after {
+			args = append(args, value)
+			placeholders[i] = style.placeholder(len(args))
+		}
+		query += " WHERE (" + keyList + ") > (" + strings.Join(placeholders, ", ") + ")"
+	}
+	// one more row tells whether there is a next page
+	query += " ORDER BY " + keyList + " LIMIT " + strconv.Itoa(p.Size+1)
+
+	var last []any
+	err = QueryRows(q, query, args...).Use(func(rows *sql.Rows) error {
+		columns, err := rows.Columns()
+		if err != nil {
+			return err
+		}
+		keyIndexes, err := columnIndexes(columns, p.Keys)
+		if err != nil {
+			return err
+		}
+
+		for rows.Next() {
+			if len(page.Items) == p.Size {
+				page.Next, err = encodeCursor(last)
+				return err
+			}
+			item, err := decode(func(dest ...any) error {
+				err := rows.Scan(dest...)
+				if err != nil {
+					return err
+				}
+				if len(dest) != len(columns) {
+					return fmt.Errorf("paginate: scanned %d of %d columns", len(dest), len(columns))
+				}
+				last = make([]any, len(keyIndexes))
+				for i, index := range keyIndexes {
+					last[i] = reflect.ValueOf(dest[index]).Elem().Interface()
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			page.Items = append(page.Items, item)
+		}
+		return rows.Err()
+	})
+	return page, err
+}
+
+func columnIndexes(columns, names []string) ([]int, error) {
+	indexes := make([]int, len(names))
+	for i, name := range names {
+		indexes[i] = -1
+		for j, column := range columns {
+			if column == name {
+				indexes[i] = j
+				break
+			}
+		}
+		if indexes[i] < 0 {
+			return nil, fmt.Errorf("paginate: key column %q is not selected", name)
+		}
+	}
+	return indexes, nil
+}
+
+func encodeCursor(values []any) (string, error) {
+	data, err := json.Marshal(values)
+	if err != nil {
+		return "", fmt.Errorf("paginate: encode cursor: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeCursor(cursor string, keys int) ([]any, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCursor, err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var values []any
+	err = decoder.Decode(&values)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCursor, err)
+	}
+	if len(values) != keys {
+		return nil, fmt.Errorf("%w: %d values for %d keys", ErrInvalidCursor, len(values), keys)
+	}
+	for i, value := range values {
+		number, ok := value.(json.Number)
+		if !ok {
+			continue
+		}
+		if n, err := number.Int64(); err == nil {
+			values[i] = n
+		} else if f, err := number.Float64(); err == nil {
+			values[i] = f
+		} else {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidCursor, err)
+		}
+	}
+	return values, nil
+}
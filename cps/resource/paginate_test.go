@@ -0,0 +1,133 @@
+package resource_test
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+type scored struct {
+	Score, ID int64
+	Name      string
+}
+
+func decodeScored(scan func(dest ...any) error) (scored, error) {
+	var s scored
+	err := scan(&s.ID, &s.Score, &s.Name)
+	return s, err
+}
+
+// scoredDB has 1000 rows of scores with many duplicates: only (score, id) is unique.
+func scoredDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db := openDB(t)
+	err := resource.RunTransaction(db).Use(func(tx *sql.Tx) error {
+		_, err := tx.Exec("CREATE TABLE scores (id INTEGER PRIMARY KEY, score INTEGER NOT NULL, name TEXT NOT NULL)")
+		if err != nil {
+			return err
+		}
+		for i := range 1000 {
+			_, err := tx.Exec("INSERT INTO scores (id, score, name) VALUES (?, ?, ?)", 1000-i, i%7, "n")
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestPaginateTraversesAll(t *testing.T) {
+	db := scoredDB(t)
+	for _, size := range []int{37, 100, 1000, 2000} {
+		p := resource.PageQuery{Query: "SELECT id, score, name FROM scores", Keys: []string{"score", "id"}, Size: size}
+		var all []scored
+		pages := 0
+		for {
+			page, err := resource.Paginate(db, p, decodeScored)
+			if err != nil {
+				t.Fatalf("size %d, page %d: %v", size, pages, err)
+			}
+			pages++
+			all = append(all, page.Items...)
+			if page.Next == "" {
+				break
+			}
+			if url.QueryEscape(page.Next) != page.Next {
+				t.Errorf("cursor %q is not URL-safe", page.Next)
+			}
+			p.Cursor = page.Next
+		}
+
+		if len(all) != 1000 {
+			t.Fatalf("size %d: %d rows traversed, want 1000", size, len(all))
+		}
+		if want := (1000 + size - 1) / size; pages != want {
+			t.Errorf("size %d: %d pages, want %d", size, pages, want)
+		}
+		for i := 1; i < len(all); i++ {
+			a, b := all[i-1], all[i]
+			if a.Score > b.Score || a.Score == b.Score && a.ID >= b.ID {
+				t.Fatalf("size %d: %+v before %+v", size, a, b)
+			}
+		}
+	}
+}
+
+func TestPaginateWithArgs(t *testing.T) {
+	db := scoredDB(t)
+	p := resource.PageQuery{Query: "SELECT id, score, name FROM scores WHERE score = ?", Args: []any{3}, Keys: []string{"id"}, Size: 50}
+	total := 0
+	for {
+		page, err := resource.Paginate(db, p, decodeScored)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range page.Items {
+			if s.Score != 3 {
+				t.Fatalf("got %+v of another score", s)
+			}
+		}
+		total += len(page.Items)
+		if page.Next == "" {
+			break
+		}
+		p.Cursor = page.Next
+	}
+	if total != 143 { // 3, 10, ... 997
+		t.Errorf("%d rows of score 3, want 143", total)
+	}
+}
+
+func TestPaginateErrors(t *testing.T) {
+	db := scoredDB(t)
+	p := resource.PageQuery{Query: "SELECT id, score, name FROM scores", Keys: []string{"score", "id"}, Size: 10}
+	for _, cursor := range []string{
+		"not base64!",
+		base64.RawURLEncoding.EncodeToString([]byte("{not json")),
+		base64.RawURLEncoding.EncodeToString([]byte("[1]")), // one value for two keys
+	} {
+		p.Cursor = cursor
+		_, err := resource.Paginate(db, p, decodeScored)
+		if !errors.Is(err, resource.ErrInvalidCursor) {
+			t.Errorf("Paginate with cursor %q = %v, want %v", cursor, err, resource.ErrInvalidCursor)
+		}
+	}
+
+	p.Cursor = ""
+	p.Keys = []string{"missing"}
+	if _, err := resource.Paginate(db, p, decodeScored); err == nil {
+		t.Error("Paginate by a column not selected succeeded")
+	}
+	p.Keys = nil
+	if _, err := resource.Paginate(db, p, decodeScored); err == nil {
+		t.Error("Paginate without keys succeeded")
+	}
+}
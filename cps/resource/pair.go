@@ -0,0 +1,133 @@
+package resource
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// AtomicFileSpec is a file written by AtomicPair.
+type AtomicFileSpec struct {
+	Path string
+	Perm os.FileMode
+}
+
+// pairRenamed is called between the two renames of AtomicPair, to inject failures in tests.
+var pairRenamed = func() error { return nil }
+
+// AtomicPair writes two files, like a data file and its index, so that both are replaced or neither is.
+// fn writes to temporary files next to a.Path and b.Path, which are synced and renamed over them
+// only once fn succeeded.
+//
+// Two renames aren't atomic: until the second one succeeds, the previous content of a.Path is kept
+// as a backup (a hard link, or a copy where links aren't supported), and restored when the second rename fails.
+// A crash between the renames can still leave the new a with the old b.
+func AtomicPair(a, b AtomicFileSpec, fn func(wa, wb io.Writer) error) error {
+	tempA, err := createPairTemp(a)
+	if err != nil {
+		return phaseError(PhaseAcquire, err)
+	}
+	defer os.Remove(tempA.Name())
+	tempB, err := createPairTemp(b)
+	if err != nil {
+		_ = tempA.Close()
+		return phaseError(PhaseAcquire, err)
+	}
+	defer os.Remove(tempB.Name())
+
+	err = fn(tempA, tempB)
+	if err == nil {
+		err = errors.Join(finishPairTemp(tempA, a.Perm), finishPairTemp(tempB, b.Perm))
+	} else {
+		err = secondaryError(err, "file "+tempA.Name(), phaseError(PhaseRelease, tempA.Close()))
+		err = secondaryError(err, "file "+tempB.Name(), phaseError(PhaseRelease, tempB.Close()))
+	}
+	if err != nil {
+		return err
+	}
+
+	backup, err := backupFile(a.Path)
+	if err != nil {
+		return phaseError(PhaseRelease, err)
+	}
+	if backup != "" {
+		defer os.Remove(backup)
+	}
+
+	err = os.Rename(tempA.Name(), a.Path)
+	if err == nil {
+		err = pairRenamed()
+		if err == nil {
+			err = os.Rename(tempB.Name(), b.Path)
+		}
+		if err != nil {
+			err = errors.Join(err, restoreFile(a.Path, backup))
+		}
+	}
+	if err != nil {
+		return phaseError(PhaseRelease, err)
+	}
+	return phaseError(PhaseRelease, errors.Join(syncDir(filepath.Dir(a.Path)), syncDir(filepath.Dir(b.Path))))
+}
+
+func createPairTemp(spec AtomicFileSpec) (*os.File, error) {
+	return os.CreateTemp(filepath.Dir(spec.Path), filepath.Base(spec.Path)+".tmp*")
+}
+
+func finishPairTemp(file *os.File, perm os.FileMode) error {
+	err := file.Chmod(perm)
+	if err == nil {
+		err = file.Sync()
+	}
+	if err != nil {
+		_ = file.Close()
+		return phaseError(PhaseRelease, err)
+	}
+	return phaseError(PhaseRelease, file.Close())
+}
+
+// backupFile keeps the current content of path in a new file next to it, and returns its name;
+// "" when path doesn't exist.
+func backupFile(path string) (string, error) {
+	backup, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".bak*")
+	if err != nil {
+		return "", err
+	}
+	_ = backup.Close()
+	_ = os.Remove(backup.Name())
+
+	err = os.Link(path, backup.Name())
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	if err == nil {
+		return backup.Name(), nil
+	}
+	return backup.Name(), copyFile(path, backup.Name())
+}
+
+// restoreFile puts the backup of path back, or removes path when it had none.
+func restoreFile(path, backup string) error {
+	if backup == "" {
+		return os.Remove(path)
+	}
+	return os.Rename(backup, path)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	return NewFileResource(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm(), Sync()).Use(func(out *os.File) error {
+		_, err := io.Copy(out, in)
+		return err
+	})
+}
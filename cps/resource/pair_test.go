@@ -0,0 +1,107 @@
+package resource_test
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+// pairFiles returns the specs of a data file and its index in dir, writing data and index to them unless empty.
+func pairFiles(t *testing.T, dir string, data, index string) (resource.AtomicFileSpec, resource.AtomicFileSpec) {
+	t.Helper()
+	a := resource.AtomicFileSpec{Path: filepath.Join(dir, "data"), Perm: 0o644}
+	b := resource.AtomicFileSpec{Path: filepath.Join(dir, "data.idx"), Perm: 0o600}
+	for path, content := range map[string]string{a.Path: data, b.Path: index} {
+		if content != "" {
+			writeFile(t, path, content)
+		}
+	}
+	return a, b
+}
+
+// writePair writes data and index with AtomicPair.
+func writePair(a, b resource.AtomicFileSpec, data, index string) error {
+	return resource.AtomicPair(a, b, func(wa, wb io.Writer) error {
+		_, err := io.WriteString(wa, data)
+		if err == nil {
+			_, err = io.WriteString(wb, index)
+		}
+		return err
+	})
+}
+
+// checkPair fails the test unless dir holds only the data file and its index, with the given content.
+func checkPair(t *testing.T, dir string, a, b resource.AtomicFileSpec, data, index string) {
+	t.Helper()
+	if got := readFile(t, a.Path); got != data {
+		t.Errorf("data = %q, want %q", got, data)
+	}
+	if got := readFile(t, b.Path); got != index {
+		t.Errorf("index = %q, want %q", got, index)
+	}
+	if entries := dirEntries(t, dir); !slices.Equal(entries, []string{"data", "data.idx"}) {
+		t.Errorf("files = %q, want no temporary file or backup left", entries)
+	}
+}
+
+func TestAtomicPairWritesBoth(t *testing.T) {
+	dir := t.TempDir()
+	a, b := pairFiles(t, dir, "old data", "old index")
+	err := writePair(a, b, "new data", "new index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPair(t, dir, a, b, "new data", "new index")
+	info, err := os.Stat(b.Path)
+	if err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("index mode = %v, %v, want 0600", info.Mode(), err)
+	}
+}
+
+func TestAtomicPairCallbackFailure(t *testing.T) {
+	dir := t.TempDir()
+	a, b := pairFiles(t, dir, "old data", "old index")
+	errWrite := errors.New("write failed")
+	err := resource.AtomicPair(a, b, func(wa, wb io.Writer) error {
+		io.WriteString(wa, "new data")
+		return errWrite
+	})
+	if !errors.Is(err, errWrite) {
+		t.Fatalf("AtomicPair = %v, want the error of the callback", err)
+	}
+	checkPair(t, dir, a, b, "old data", "old index")
+}
+
+func TestAtomicPairFailureBetweenRenames(t *testing.T) {
+	errCrash := errors.New("crash between the renames")
+	resource.SetPairRenamed(t, func() error {
+		return errCrash
+	})
+
+	dir := t.TempDir()
+	a, b := pairFiles(t, dir, "old data", "old index")
+	err := writePair(a, b, "new data", "new index")
+	if !errors.Is(err, errCrash) || phaseOf(t, err) != resource.PhaseRelease {
+		t.Fatalf("AtomicPair = %v, want the injected release failure", err)
+	}
+	checkPair(t, dir, a, b, "old data", "old index")
+
+	// without a previous data file, the new one is removed
+	dir = t.TempDir()
+	a, b = pairFiles(t, dir, "", "old index")
+	err = writePair(a, b, "new data", "new index")
+	if !errors.Is(err, errCrash) {
+		t.Fatalf("AtomicPair = %v, want the injected failure", err)
+	}
+	if entries := dirEntries(t, dir); !slices.Equal(entries, []string{"data.idx"}) {
+		t.Errorf("files = %q, want only the old index", entries)
+	}
+	if got := readFile(t, b.Path); got != "old index" {
+		t.Errorf("index = %q, want it untouched", got)
+	}
+}
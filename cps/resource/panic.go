@@ -0,0 +1,53 @@
+package resource
+
+import (
+	runtimedebug "runtime/debug"
+	"sync/atomic"
+
+	"github.com/Q69K/using-cps-in-golang/cps/group"
+)
+
+// PanicError is a panic of a callback recovered by RecoverToError, the same type as the panics
+// of the tasks recovered by package group. A runtime error, like a write to a nil map, is its Unwrap.
+type PanicError = group.PanicError
+
+var recovering atomic.Bool
+
+// SetRecoverToError makes the resources of this package calling a callback of their own
+// work as if wrapped by RecoverToError. Off by default: the panics of their callbacks go on
+// after the deferred cleanups of the callbacks ran, the transactions rolled back and the files closed;
+// the other resources may be left unreleased.
+func SetRecoverToError(enabled bool) {
+	recovering.Store(enabled)
+}
+
+// RecoverToError returns r whose callback panics are returned as a *PanicError carrying the panic value
+// and stack, after r got released like for any callback error. runtime.Goexit, as called by t.Fatal,
+// isn't a panic: it goes on unchanged.
+func RecoverToError[T any](r Resource[T]) Resource[T] {
+	return Resource[T]{
+		Use: func(callback func(value T) error) error {
+			return r.Use(func(value T) error {
+				return callRecovering(callback, value)
+			})
+		},
+		Description: r.Description,
+	}
+}
+
+// useCallback calls callback, through callRecovering when SetRecoverToError is on.
+func useCallback[T any](callback func(value T) error, value T) error {
+	if recovering.Load() {
+		return callRecovering(callback, value)
+	}
+	return callback(value)
+}
+
+func callRecovering[T any](callback func(value T) error, value T) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = &PanicError{Value: p, Stack: runtimedebug.Stack()}
+		}
+	}()
+	return callback(value)
+}
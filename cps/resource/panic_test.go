@@ -0,0 +1,177 @@
+package resource_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
+
+func TestSetRecoverToErrorRecoversEveryCallback(t *testing.T) {
+	resource.SetRecoverToError(true)
+	t.Cleanup(func() {
+		resource.SetRecoverToError(false)
+	})
+	dir := t.TempDir()
+	boom := func() error { panic("boom") }
+
+	uses := map[string]func() error{
+		"command": func() error {
+			return resource.NewCommandResource(context.Background(), "sleep", "10").Use(func(*exec.Cmd) error { return boom() })
+		},
+		"csv": func() error {
+			return resource.NewCSVFileResource(filepath.Join(dir, "plain.csv"), 0o644).Use(func(*csv.Writer) error { return boom() })
+		},
+		"atomic csv": func() error {
+			return resource.NewCSVFileResource(filepath.Join(dir, "atomic.csv"), 0o644, resource.CSVAtomic()).Use(func(*csv.Writer) error { return boom() })
+		},
+		"pool": func() error {
+			pool := resource.NewPool(func() (int, error) { return 1, nil }, func(int) error { return nil }, 1)
+			defer pool.Close()
+			return pool.Use(func(int) error { return boom() })
+		},
+		"zip": func() error {
+			return resource.NewZipFileResource(filepath.Join(dir, "archive.zip"), 0o644).Use(func(*resource.ZipWriter) error { return boom() })
+		},
+		"zip entry": func() error {
+			return resource.NewZipFileResource(filepath.Join(dir, "entry.zip"), 0o644).Use(func(zw *resource.ZipWriter) error {
+				return zw.Entry("a.txt").Use(func(io.Writer) error { return boom() })
+			})
+		},
+		"json": func() error {
+			return resource.WriteJSONResource(filepath.Join(dir, "value.json"), 0o644).Use(func(*json.Encoder) error { return boom() })
+		},
+		"semaphore": func() error {
+			return resource.NewWeightedSemaphore(1).Resource(1).Use(func(struct{}) error { return boom() })
+		},
+		"listener": func() error {
+			return resource.NewListenerResource("tcp", "127.0.0.1:0").Use(func(net.Listener) error { return boom() })
+		},
+		"signal context": func() error {
+			return resource.WithSignalContext(os.Interrupt).Use(func(context.Context) error { return boom() })
+		},
+		"opener": func() error {
+			return resource.FromOpener(func() (nopCloser, error) { return nopCloser{}, nil }).Use(func(nopCloser) error { return boom() })
+		},
+	}
+	for name, use := range uses {
+		t.Run(name, func(t *testing.T) {
+			var panicErr *resource.PanicError
+			err := use()
+			if !errors.As(err, &panicErr) || panicErr.Value != "boom" {
+				t.Fatalf("got %v, want the recovered panic", err)
+			}
+		})
+	}
+}
+
+func TestCommandResourceReapsOnPanic(t *testing.T) {
+	var cmd *exec.Cmd
+	func() {
+		defer func() {
+			if p := recover(); p != "boom" {
+				t.Fatalf("recovered %v, want the panic of the callback", p)
+			}
+		}()
+		_ = resource.NewCommandResource(context.Background(), "sleep", "10").Use(func(c *exec.Cmd) error {
+			cmd = c
+			panic("boom")
+		})
+	}()
+	if cmd.ProcessState == nil {
+		t.Fatal("the command wasn't waited for")
+	}
+}
+
+// endingCallbacks end a callback the two ways a callback doesn't return: with a panic, recovered
+// by runEnding, and with runtime.Goexit as t.Fatal calls.
+var endingCallbacks = map[string]func(){
+	"panic":  func() { panic("boom") },
+	"goexit": runtime.Goexit,
+}
+
+// runEnding runs use in a goroutine of its own, for runtime.Goexit to end it, recovering its panic.
+func runEnding(use func()) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer func() {
+			_ = recover()
+		}()
+		use()
+	}()
+	<-done
+}
+
+func TestTransactionRolledBackWhenCallbackDoesNotReturn(t *testing.T) {
+	for name, end := range endingCallbacks {
+		t.Run(name, func(t *testing.T) {
+			driver, driverName := countingSQLite(t)
+			db, err := sql.Open(driverName, filepath.Join(t.TempDir(), "test.db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			db.SetMaxOpenConns(1)
+			_, err = db.Exec("CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT NOT NULL)")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			runEnding(func() {
+				_ = resource.RunTransaction(db).Use(func(tx *sql.Tx) error {
+					err := insertItem(tx, "lost")
+					if err != nil {
+						return err
+					}
+					end()
+					return nil
+				})
+			})
+			if counts := driver.Counts(); counts.Rollbacks != 1 || counts.Commits != 0 {
+				t.Errorf("counts = %+v, want the transaction rolled back", counts)
+			}
+			// the single connection is free again
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			var n int
+			err = db.QueryRowContext(ctx, "SELECT COUNT(*) FROM items").Scan(&n)
+			if err != nil || n != 0 {
+				t.Errorf("items after the rollback = %d, %v; want none", n, err)
+			}
+		})
+	}
+}
+
+func TestFileClosedWhenCallbackDoesNotReturn(t *testing.T) {
+	for name, end := range endingCallbacks {
+		t.Run(name, func(t *testing.T) {
+			var file *os.File
+			runEnding(func() {
+				_ = resource.NewFileResource(filepath.Join(t.TempDir(), "out.txt"), os.O_WRONLY|os.O_CREATE, 0o644).Use(func(f *os.File) error {
+					file = f
+					end()
+					return nil
+				})
+			})
+			if _, err := file.Write([]byte("late")); !errors.Is(err, os.ErrClosed) {
+				t.Errorf("Write after the callback = %v, want os.ErrClosed", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package resource
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+
+	"github.com/Q69K/using-cps-in-golang/cps/group"
+)
+
+type parallelOptions struct {
+	concurrency int
+}
+
+// ParallelOption configures UseEach.
+type ParallelOption func(options *parallelOptions)
+
+// Concurrency limits how many resources are used at the same time, runtime.NumCPU() by default.
+// A limit below 1 is 1.
+func Concurrency(n int) ParallelOption {
+	return func(options *parallelOptions) {
+		options.concurrency = max(n, 1)
+	}
+}
+
+// UseEach uses all the resources concurrently with the same callback.
+// Every resource is acquired and released inside its own task.
+// The errors are joined in index order, each one prefixed with its index.
+func UseEach[T any](rs []Resource[T], cb func(index int, v T) error, opts ...ParallelOption) error {
+	options := parallelOptions{concurrency: runtime.NumCPU()}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	errs := make([]error, len(rs))
+	spawner := group.NewBoundedSpawner(options.concurrency)
+	for i, r := range rs {
+		spawner.Run(func() {
+			err := r.Use(func(v T) error {
+				return cb(i, v)
+			})
+			if err != nil {
+				errs[i] = fmt.Errorf("resource %d: %w", i, err)
+			}
+		})
+	}
+	spawner.Wait()
+
+	return errors.Join(errs...)
+}
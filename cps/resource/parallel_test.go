@@ -0,0 +1,72 @@
+package resource_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+func TestUseEach(t *testing.T) {
+	dir := t.TempDir()
+	rs := make([]resource.Resource[*os.File], 20)
+	for i := range rs {
+		rs[i] = resource.FromUsable(resource.NewAtomicFileResource(filepath.Join(dir, fmt.Sprintf("shard-%02d.txt", i)), 0o644))
+	}
+
+	errBoom := errors.New("boom")
+	var active, most atomic.Int64
+	err := resource.UseEach(rs, func(index int, f *os.File) error {
+		n := active.Add(1)
+		defer active.Add(-1)
+		for m := most.Load(); n > m && !most.CompareAndSwap(m, n); m = most.Load() {
+		}
+		if index == 7 || index == 13 {
+			return errBoom
+		}
+		_, err := fmt.Fprintf(f, "shard %d", index)
+		return err
+	}, resource.Concurrency(3))
+
+	if !errors.Is(err, errBoom) {
+		t.Fatalf("UseEach = %v, want the injected failures", err)
+	}
+	message := err.Error()
+	if !strings.Contains(message, "resource 7: ") || !strings.Contains(message, "resource 13: ") || strings.Count(message, "resource ") != 2 {
+		t.Errorf("UseEach = %q, want the indexes 7 and 13", message)
+	}
+	if entries := dirEntries(t, dir); len(entries) != 18 {
+		t.Errorf("%d files written, want 18", len(entries))
+	}
+	if most.Load() > 3 {
+		t.Errorf("%d callbacks at a time, want at most 3", most.Load())
+	}
+}
+
+func TestUseEachConcurrencyBelowOne(t *testing.T) {
+	for _, n := range []int{0, -3} {
+		t.Run(fmt.Sprint(n), func(t *testing.T) {
+			rs := make([]resource.Resource[int], 5)
+			for i := range rs {
+				rs[i] = resource.Resource[int]{Use: func(callback func(int) error) error { return callback(i) }}
+			}
+			var active, most, used atomic.Int64
+			err := resource.UseEach(rs, func(int, int) error {
+				n := active.Add(1)
+				defer active.Add(-1)
+				for m := most.Load(); n > m && !most.CompareAndSwap(m, n); m = most.Load() {
+				}
+				used.Add(1)
+				return nil
+			}, resource.Concurrency(n))
+			if err != nil || used.Load() != 5 || most.Load() != 1 {
+				t.Errorf("UseEach = %v, %d resources used, %d at a time; want all 5 one at a time", err, used.Load(), most.Load())
+			}
+		})
+	}
+}
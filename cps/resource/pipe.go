@@ -0,0 +1,47 @@
+package resource
+
+import (
+	"errors"
+	"io"
+)
+
+// errProducerExited closes the pipe of a producer which called runtime.Goexit.
+var errProducerExited = errors.New("pipe producer exited without returning")
+
+// PipeResource connects producer and consumer with io.Pipe.
+//
+// The producer runs in its own goroutine, the consumer in the caller's one.
+// Whichever side finishes with an error closes its end with that error,
+// so the other side is unblocked instead of hanging forever.
+// Both errors are returned joined, an error seen by both sides only once.
+//
+// A panic of the producer can't reach the caller from its goroutine, so it is returned as a *PanicError;
+// a producer calling runtime.Goexit closes the pipe with an error too.
+func PipeResource(producer func(w io.Writer) error, consumer func(r io.Reader) error) error {
+	pr, pw := io.Pipe()
+
+	producerErr := errProducerExited
+	done := make(chan struct{})
+	go func() {
+		// deferred, so the pipe is closed and the producer waited for even after a runtime.Goexit
+		defer func() {
+			// nil error closes the pipe normally: consumer reads io.EOF
+			_ = pw.CloseWithError(producerErr)
+			close(done)
+		}()
+		producerErr = callRecovering(producer, io.Writer(pw))
+	}()
+
+	consumerErr := consumer(pr)
+	_ = pr.CloseWithError(consumerErr)
+	<-done
+
+	switch {
+	case producerErr != nil && errors.Is(consumerErr, producerErr):
+		return consumerErr
+	case consumerErr != nil && errors.Is(producerErr, consumerErr):
+		return producerErr
+	default:
+		return errors.Join(producerErr, consumerErr)
+	}
+}
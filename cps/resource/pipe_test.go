@@ -0,0 +1,129 @@
+package resource_test
+
+import (
+	"errors"
+	"io"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+func TestPipeResourceStreams(t *testing.T) {
+	const size, chunk = 10 << 20, 32 << 10
+	var written, read, ahead atomic.Int64
+	err := resource.PipeResource(func(w io.Writer) error {
+		buf := make([]byte, chunk)
+		for written.Load() < size {
+			n, err := w.Write(buf)
+			if d := written.Add(int64(n)) - read.Load(); d > ahead.Load() {
+				ahead.Store(d)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}, func(r io.Reader) error {
+		buf := make([]byte, chunk)
+		for {
+			n, err := r.Read(buf)
+			read.Add(int64(n))
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.Load() != size {
+		t.Errorf("read %d bytes, want %d", read.Load(), size)
+	}
+	// io.Pipe hands every write over to a read: the producer never gets more than a write ahead
+	if ahead.Load() > 2*chunk {
+		t.Errorf("producer %d bytes ahead of the consumer, the stream got buffered", ahead.Load())
+	}
+}
+
+func TestPipeResourceProducerFails(t *testing.T) {
+	errBoom := errors.New("boom")
+	var consumerErr error
+	err := resource.PipeResource(func(w io.Writer) error {
+		w.Write([]byte("partial"))
+		return errBoom
+	}, func(r io.Reader) error {
+		_, consumerErr = io.ReadAll(r)
+		return consumerErr
+	})
+	if !errors.Is(consumerErr, errBoom) {
+		t.Errorf("consumer read error = %v, want the producer's", consumerErr)
+	}
+	if err != errBoom {
+		t.Errorf("PipeResource = %v, want the producer error once", err)
+	}
+}
+
+func TestPipeResourceConsumerFails(t *testing.T) {
+	errBoom := errors.New("boom")
+	var producerErr error
+	err := resource.PipeResource(func(w io.Writer) error {
+		buf := make([]byte, 1024)
+		for {
+			_, producerErr = w.Write(buf) // blocks forever unless the failed consumer closes its end
+			if producerErr != nil {
+				return producerErr
+			}
+		}
+	}, func(r io.Reader) error {
+		r.Read(make([]byte, 10))
+		return errBoom
+	})
+	if !errors.Is(producerErr, errBoom) {
+		t.Errorf("producer write error = %v, want the consumer's", producerErr)
+	}
+	if err != errBoom {
+		t.Errorf("PipeResource = %v, want the consumer error once", err)
+	}
+}
+
+func TestPipeResourceProducerPanicsOrExits(t *testing.T) {
+	for name, producer := range map[string]func(w io.Writer) error{
+		"panic": func(w io.Writer) error {
+			w.Write([]byte("partial"))
+			panic("producer panicked")
+		},
+		"Goexit": func(w io.Writer) error {
+			w.Write([]byte("partial"))
+			runtime.Goexit()
+			return nil
+		},
+	} {
+		var consumerErr error
+		returned := make(chan error, 1)
+		go func() {
+			returned <- resource.PipeResource(producer, func(r io.Reader) error {
+				_, consumerErr = io.ReadAll(r)
+				return consumerErr
+			})
+		}()
+		var err error
+		select {
+		case err = <-returned:
+		case <-time.After(time.Second):
+			t.Fatalf("PipeResource blocked after a producer %s", name)
+		}
+		if consumerErr == nil || err == nil {
+			t.Errorf("%s: consumer read error = %v, PipeResource = %v; want the pipe closed with an error", name, consumerErr, err)
+		}
+		var panicErr *resource.PanicError
+		if isPanic := errors.As(err, &panicErr); isPanic != (name == "panic") {
+			t.Errorf("%s: PipeResource = %v, want a *PanicError for the panic only", name, err)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package resource
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrPoolClosed is returned by Use after the pool was closed.
+var ErrPoolClosed = errors.New("pool is closed")
+
+// Pool reuses expensive values between Use calls instead of opening a new one every time.
+type Pool[T any] struct {
+	factory func() (T, error)
+	closeFn func(T) error
+
+	slots chan struct{} // one per checked out value, limits them to size
+	idle  chan T
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// NewPool creates a pool of at most size values, created by factory on demand and closed by closeFn.
+// It panics when size is not positive, as no value could ever be checked out.
+func NewPool[T any](factory func() (T, error), closeFn func(T) error, size int) *Pool[T] {
+	if size <= 0 {
+		panic("resource: non-positive size for NewPool")
+	}
+	return &Pool[T]{
+		factory: factory,
+		closeFn: closeFn,
+		slots:   make(chan struct{}, size),
+		idle:    make(chan T, size),
+	}
+}
+
+// Use checks a value out, blocking while all of them are in use.
+// The value goes back to the pool when the callback succeeds,
+// and is closed and discarded when it fails or panics, so broken values are never reused.
+//
+// Use waits regardless of any context, that of a cancelled task group included:
+// the tasks of group.RunCtx give their ctx to UseCtx to stop waiting with the group.
+func (p *Pool[T]) Use(callback func(value T) error) error {
+	return p.UseCtx(context.Background(), callback)
+}
+
+// UseCtx is Use which stops waiting for a free value when ctx is done.
+func (p *Pool[T]) UseCtx(ctx context.Context, callback func(value T) error) error {
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return phaseError(PhaseAcquire, ctx.Err())
+	}
+	defer func() {
+		<-p.slots
+	}()
+
+	value, err := p.checkout()
+	if err != nil {
+		return phaseError(PhaseAcquire, err)
+	}
+
+	called := false
+	defer func() {
+		if !called {
+			// the callback panicked: the value may be broken, and must not stay checked out forever
+			_ = p.closeFn(value)
+		}
+	}()
+	err = useCallback(callback, value)
+	called = true
+	if err != nil {
+		return errors.Join(phaseError(PhaseUse, err), phaseError(PhaseRelease, p.closeFn(value)))
+	}
+	return phaseError(PhaseRelease, p.checkin(value))
+}
+
+func (p *Pool[T]) checkout() (T, error) {
+	p.mu.Lock()
+	closed := p.closed
+	p.mu.Unlock()
+	if closed {
+		var zero T
+		return zero, ErrPoolClosed
+	}
+
+	select {
+	case value := <-p.idle:
+		return value, nil
+	default:
+		return p.factory()
+	}
+}
+
+func (p *Pool[T]) checkin(value T) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return p.closeFn(value)
+	}
+	// never blocks: there are no more values than slots
+	p.idle <- value
+	return nil
+}
+
+// Close closes all idle values; values still in use are closed when they are returned.
+// Closing the pool again does nothing.
+func (p *Pool[T]) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+
+	var errs []error
+	for {
+		select {
+		case value := <-p.idle:
+			errs = append(errs, p.closeFn(value))
+		default:
+			return errors.Join(errs...)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package resource_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+// conn is a pooled value counting how many of them are open.
+type conn struct {
+	id     int64
+	closed bool
+}
+
+type connPool struct {
+	*resource.Pool[*conn]
+	created, closed atomic.Int64
+}
+
+func newConnPool(size int) *connPool {
+	p := &connPool{}
+	p.Pool = resource.NewPool(func() (*conn, error) {
+		return &conn{id: p.created.Add(1)}, nil
+	}, func(c *conn) error {
+		c.closed = true
+		p.closed.Add(1)
+		return nil
+	}, size)
+	return p
+}
+
+func TestPoolLimitsConcurrency(t *testing.T) {
+	const size = 3
+	p := newConnPool(size)
+	var active, most atomic.Int64
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := p.Use(func(c *conn) error {
+				n := active.Add(1)
+				for m := most.Load(); n > m && !most.CompareAndSwap(m, n); m = most.Load() {
+				}
+				<-release
+				active.Add(-1)
+				return nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	eventually(t, func() bool { return active.Load() == size })
+	close(release)
+	wg.Wait()
+
+	if most.Load() != size {
+		t.Errorf("%d values in use at most, want %d", most.Load(), size)
+	}
+	if p.created.Load() > size {
+		t.Errorf("%d values created for a pool of %d", p.created.Load(), size)
+	}
+}
+
+func TestPoolReusesAndDiscards(t *testing.T) {
+	p := newConnPool(1)
+	var first *conn
+	err := p.Use(func(c *conn) error {
+		first = c
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Use(func(c *conn) error {
+		if c != first {
+			t.Error("idle value not reused")
+		}
+		return errors.New("broken")
+	})
+	if phaseOf(t, err) != resource.PhaseUse || !first.closed {
+		t.Errorf("got %v, closed %v: a failed value must be closed", err, first.closed)
+	}
+	err = p.Use(func(c *conn) error {
+		if c == first {
+			t.Error("discarded value reused")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPoolClosesValueOnPanic(t *testing.T) {
+	p := newConnPool(1)
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("panic not propagated")
+			}
+		}()
+		_ = p.Use(func(c *conn) error {
+			panic("boom")
+		})
+	}()
+	if p.closed.Load() != 1 {
+		t.Errorf("%d values closed after the panic, want 1", p.closed.Load())
+	}
+
+	// the slot is free again
+	err := p.Use(func(c *conn) error {
+		if c.id != 2 {
+			t.Errorf("got value %d, want a new one", c.id)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPoolUseCtxStopsWaiting(t *testing.T) {
+	p := newConnPool(1)
+	held := make(chan struct{})
+	release := make(chan struct{})
+	go p.Use(func(c *conn) error {
+		close(held)
+		<-release
+		return nil
+	})
+	<-held
+	defer close(release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := p.UseCtx(ctx, func(c *conn) error {
+		t.Error("callback called without a free value")
+		return nil
+	})
+	if phaseOf(t, err) != resource.PhaseAcquire || !errors.Is(err, context.Canceled) {
+		t.Errorf("UseCtx = %v", err)
+	}
+}
+
+func TestPoolClose(t *testing.T) {
+	p := newConnPool(2)
+	err := p.Use(func(c *conn) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Close(); err != nil {
+		t.Errorf("second Close = %v", err)
+	}
+	if p.closed.Load() != 1 {
+		t.Errorf("%d values closed, want the idle one", p.closed.Load())
+	}
+	err = p.Use(func(c *conn) error { return nil })
+	if !errors.Is(err, resource.ErrPoolClosed) {
+		t.Errorf("Use after Close = %v", err)
+	}
+}
+
+func TestNewPoolPanicsOnNonPositiveSize(t *testing.T) {
+	for _, size := range []int{0, -1} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("NewPool of size %d did not panic", size)
+				}
+			}()
+			newConnPool(size)
+		}()
+	}
+}
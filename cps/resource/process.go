@@ -0,0 +1,112 @@
+package resource
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// WithEnv and WithChdir change process-wide state: every goroutine sees the change while fn runs.
+// They are not safe for parallel tests (t.Parallel), use the Exclusive option to detect that.
+
+// ErrProcessStateInUse is returned with the Exclusive option when the same variable
+// or the working directory is already changed by another WithEnv or WithChdir.
+var ErrProcessStateInUse = errors.New("process state is already changed by another scope")
+
+type processOptions struct {
+	exclusive bool
+}
+
+// ProcessOption configures WithEnv and WithChdir.
+type ProcessOption func(options *processOptions)
+
+// Exclusive makes WithEnv and WithChdir fail with ErrProcessStateInUse instead of changing
+// what another exclusive scope has changed and not restored yet, including a nested one.
+func Exclusive() ProcessOption {
+	return func(options *processOptions) {
+		options.exclusive = true
+	}
+}
+
+var (
+	processScopesMu sync.Mutex
+	processScopes   = map[string]bool{} // "env:KEY" or "wd" changed by an exclusive scope
+)
+
+func enterProcessScope(name string, opts []ProcessOption) (func(), error) {
+	var options processOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if !options.exclusive {
+		return func() {}, nil
+	}
+
+	processScopesMu.Lock()
+	defer processScopesMu.Unlock()
+	if processScopes[name] {
+		return nil, fmt.Errorf("%w: %s", ErrProcessStateInUse, name)
+	}
+	processScopes[name] = true
+	return func() {
+		processScopesMu.Lock()
+		defer processScopesMu.Unlock()
+		delete(processScopes, name)
+	}, nil
+}
+
+// WithEnv sets the environment variable key to value while fn runs, then restores its previous value,
+// or unsets it if it wasn't set. The variable is restored when fn panics too.
+func WithEnv(key, value string, fn func() error, opts ...ProcessOption) (err error) {
+	leave, err := enterProcessScope("env:"+key, opts)
+	if err != nil {
+		return err
+	}
+	defer leave()
+
+	previous, existed := os.LookupEnv(key)
+	err = os.Setenv(key, value)
+	if err != nil {
+		return phaseError(PhaseAcquire, err)
+	}
+	defer func() {
+		var restoreErr error
+		if existed {
+			restoreErr = os.Setenv(key, previous)
+		} else {
+			restoreErr = os.Unsetenv(key)
+		}
+		err = errors.Join(err, phaseError(PhaseRelease, restoreErr))
+	}()
+
+	return fn()
+}
+
+// WithChdir changes the working directory to dir while fn runs, then changes it back.
+// The directory is restored when fn panics too.
+func WithChdir(dir string, fn func() error, opts ...ProcessOption) (err error) {
+	leave, err := enterProcessScope("wd", opts)
+	if err != nil {
+		return err
+	}
+	defer leave()
+
+	previous, err := os.Getwd()
+	if err != nil {
+		return phaseError(PhaseAcquire, err)
+	}
+	err = os.Chdir(dir)
+	if err != nil {
+		return phaseError(PhaseAcquire, err)
+	}
+	defer func() {
+		restoreErr := os.Chdir(previous)
+		if restoreErr != nil {
+			restoreErr = fmt.Errorf("restore working directory %s (was it removed by fn?): %w", previous, restoreErr)
+		}
+		err = errors.Join(err, phaseError(PhaseRelease, restoreErr))
+	}()
+
+	return fn()
+}
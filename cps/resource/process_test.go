@@ -0,0 +1,176 @@
+package resource_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+const testEnvKey = "RESOURCE_PROCESS_TEST"
+
+func TestWithEnvRestores(t *testing.T) {
+	t.Setenv(testEnvKey, "") // restored at the end of the test
+	os.Unsetenv(testEnvKey)
+	err := resource.WithEnv(testEnvKey, "inner", func() error {
+		if got := os.Getenv(testEnvKey); got != "inner" {
+			t.Errorf("%s = %q inside, want inner", testEnvKey, got)
+		}
+		return nil
+	})
+	if _, set := os.LookupEnv(testEnvKey); err != nil || set {
+		t.Errorf("WithEnv = %v, variable set %v afterwards, want it unset as before", err, set)
+	}
+
+	t.Setenv(testEnvKey, "before")
+	errBoom := errors.New("boom")
+	err = resource.WithEnv(testEnvKey, "", func() error {
+		return errBoom
+	})
+	if got := os.Getenv(testEnvKey); !errors.Is(err, errBoom) || got != "before" {
+		t.Errorf("WithEnv = %v, %s = %q afterwards, want the error of fn and before", err, testEnvKey, got)
+	}
+}
+
+func TestWithEnvNested(t *testing.T) {
+	t.Setenv(testEnvKey, "outside")
+	var seen []string
+	err := resource.WithEnv(testEnvKey, "outer", func() error {
+		seen = append(seen, os.Getenv(testEnvKey))
+		err := resource.WithEnv(testEnvKey, "inner", func() error {
+			seen = append(seen, os.Getenv(testEnvKey))
+			return nil
+		})
+		seen = append(seen, os.Getenv(testEnvKey))
+		return err
+	})
+	seen = append(seen, os.Getenv(testEnvKey))
+	if err != nil || strings.Join(seen, " ") != "outer inner outer outside" {
+		t.Errorf("WithEnv = %v, values %q", err, seen)
+	}
+
+	err = resource.WithEnv(testEnvKey, "outer", func() error {
+		return resource.WithEnv(testEnvKey, "inner", func() error {
+			t.Error("nested exclusive scope ran")
+			return nil
+		}, resource.Exclusive())
+	}, resource.Exclusive())
+	if !errors.Is(err, resource.ErrProcessStateInUse) {
+		t.Errorf("nested exclusive WithEnv = %v, want %v", err, resource.ErrProcessStateInUse)
+	}
+	err = resource.WithEnv(testEnvKey, "again", func() error { return nil }, resource.Exclusive())
+	if err != nil {
+		t.Errorf("exclusive WithEnv after the others = %v", err)
+	}
+}
+
+func TestWithEnvRestoresOnPanic(t *testing.T) {
+	t.Setenv(testEnvKey, "before")
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("panic swallowed")
+			}
+		}()
+		resource.WithEnv(testEnvKey, "inner", func() error {
+			panic("kaboom")
+		}, resource.Exclusive())
+	}()
+	if got := os.Getenv(testEnvKey); got != "before" {
+		t.Errorf("%s = %q after the panic, want before", testEnvKey, got)
+	}
+	err := resource.WithEnv(testEnvKey, "again", func() error { return nil }, resource.Exclusive())
+	if err != nil {
+		t.Errorf("exclusive WithEnv after the panic = %v", err)
+	}
+}
+
+// getwd is the working directory, with the symbolic links of the temporary directories resolved.
+func getwd(t *testing.T) string {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wd, err = filepath.EvalSymlinks(wd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return wd
+}
+
+func TestWithChdir(t *testing.T) {
+	before := getwd(t)
+	outer, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner := filepath.Join(outer, "inner")
+	if err := os.Mkdir(inner, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	var seen []string
+	err = resource.WithChdir(outer, func() error {
+		seen = append(seen, getwd(t))
+		err := resource.WithChdir("inner", func() error { // relative to outer
+			seen = append(seen, getwd(t))
+			return nil
+		})
+		seen = append(seen, getwd(t))
+		return err
+	})
+	if err != nil || strings.Join(seen, " ") != strings.Join([]string{outer, inner, outer}, " ") {
+		t.Errorf("WithChdir = %v, directories %q", err, seen)
+	}
+	if wd := getwd(t); wd != before {
+		t.Errorf("working directory %s afterwards, want %s", wd, before)
+	}
+
+	err = resource.WithChdir(filepath.Join(outer, "missing"), func() error {
+		t.Error("fn ran in a missing directory")
+		return nil
+	})
+	if phaseOf(t, err) != resource.PhaseAcquire {
+		t.Errorf("WithChdir to a missing directory = %v", err)
+	}
+}
+
+func TestWithChdirRestoresOnPanic(t *testing.T) {
+	before := getwd(t)
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("panic swallowed")
+			}
+		}()
+		resource.WithChdir(t.TempDir(), func() error {
+			panic("kaboom")
+		})
+	}()
+	if wd := getwd(t); wd != before {
+		t.Errorf("working directory %s after the panic, want %s", wd, before)
+	}
+}
+
+func TestWithChdirPreviousRemoved(t *testing.T) {
+	before := getwd(t)
+	t.Cleanup(func() {
+		os.Chdir(before)
+	})
+	gone := filepath.Join(t.TempDir(), "gone")
+	if err := os.Mkdir(gone, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	err := resource.WithChdir(gone, func() error {
+		return resource.WithChdir(t.TempDir(), func() error {
+			return os.Remove(gone)
+		})
+	})
+	if err == nil || !strings.Contains(err.Error(), "restore working directory "+gone) {
+		t.Errorf("WithChdir = %v, want the failed restore of %s", err, gone)
+	}
+}
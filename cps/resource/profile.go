@@ -0,0 +1,44 @@
+package resource
+
+import (
+	"errors"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"sync/atomic"
+)
+
+// ErrCPUProfileActive is returned by WithCPUProfile while another CPU profile is running:
+// the runtime supports only one at a time.
+var ErrCPUProfileActive = errors.New("cpu profile is already running")
+
+var cpuProfiling atomic.Bool
+
+// WithCPUProfile writes the CPU profile of fn's run to path.
+// The profile is stopped before the file is closed, whatever fn returns.
+func WithCPUProfile(path string, fn func() error) error {
+	if !cpuProfiling.CompareAndSwap(false, true) {
+		return ErrCPUProfileActive
+	}
+	defer cpuProfiling.Store(false)
+
+	return NewFileResource(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644).Use(func(fd *os.File) error {
+		err := pprof.StartCPUProfile(fd)
+		if err != nil {
+			// started by someone not going through WithCPUProfile
+			return phaseError(PhaseAcquire, errors.Join(ErrCPUProfileActive, err))
+		}
+		defer pprof.StopCPUProfile()
+
+		return fn()
+	})
+}
+
+// WithHeapProfile runs fn and writes the heap profile to path afterwards, even when fn failed.
+func WithHeapProfile(path string, fn func() error) error {
+	err := fn()
+	return errors.Join(err, NewFileResource(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644).Use(func(fd *os.File) error {
+		runtime.GC() // get up-to-date statistics
+		return phaseError(PhaseRelease, pprof.WriteHeapProfile(fd))
+	}))
+}
@@ -0,0 +1,114 @@
+package resource_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+// checkProfile fails the test unless path holds a gzipped protobuf profile, as pprof writes them.
+func checkProfile(t *testing.T, path string) {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(content, []byte{0x1f, 0x8b}) {
+		t.Fatalf("%s doesn't start with the gzip magic bytes: % x", filepath.Base(path), content[:min(len(content), 4)])
+	}
+	r, err := gzip.NewReader(bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := io.ReadAll(r)
+	if err != nil || len(decoded) == 0 {
+		t.Fatalf("%s decoded to %d bytes, %v", filepath.Base(path), len(decoded), err)
+	}
+}
+
+// spin keeps the CPU busy for the profile to have samples.
+func spin() error {
+	n := 0
+	for i := range 10_000_000 {
+		n += i % 7
+	}
+	if n < 0 {
+		return errors.New("unreachable")
+	}
+	return nil
+}
+
+func TestWithCPUProfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cpu.pprof")
+	err := resource.WithCPUProfile(path, spin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkProfile(t, path)
+}
+
+func TestWithCPUProfileNested(t *testing.T) {
+	dir := t.TempDir()
+	var nestedErr error
+	err := resource.WithCPUProfile(filepath.Join(dir, "outer.pprof"), func() error {
+		nestedErr = resource.WithCPUProfile(filepath.Join(dir, "inner.pprof"), func() error {
+			t.Error("nested profile ran fn")
+			return nil
+		})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !errors.Is(nestedErr, resource.ErrCPUProfileActive) {
+		t.Errorf("nested WithCPUProfile = %v, want %v", nestedErr, resource.ErrCPUProfileActive)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "inner.pprof")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("nested profile created its file: %v", err)
+	}
+
+	err = resource.WithCPUProfile(filepath.Join(dir, "after.pprof"), func() error { return nil })
+	if err != nil {
+		t.Errorf("WithCPUProfile after the others = %v", err)
+	}
+}
+
+func TestWithCPUProfileStartedElsewhere(t *testing.T) {
+	err := pprof.StartCPUProfile(io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pprof.StopCPUProfile()
+
+	err = resource.WithCPUProfile(filepath.Join(t.TempDir(), "cpu.pprof"), func() error {
+		t.Error("fn ran without a profile")
+		return nil
+	})
+	if !errors.Is(err, resource.ErrCPUProfileActive) || phaseOf(t, err) != resource.PhaseAcquire {
+		t.Errorf("WithCPUProfile = %v, want an acquire error", err)
+	}
+}
+
+func TestWithHeapProfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "heap.pprof")
+	errBoom := errors.New("boom")
+	err := resource.WithHeapProfile(path, func() error {
+		return errBoom
+	})
+	if !errors.Is(err, errBoom) {
+		t.Errorf("WithHeapProfile = %v, want the error of fn", err)
+	}
+	checkProfile(t, path) // written even though fn failed
+
+	err = resource.WithHeapProfile(filepath.Join(t.TempDir(), "missing", "heap.pprof"), func() error { return nil })
+	if phaseOf(t, err) != resource.PhaseAcquire {
+		t.Errorf("WithHeapProfile into a missing directory = %v", err)
+	}
+}
@@ -0,0 +1,71 @@
+package resource
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// renameFile is os.Rename, replaced by tests simulating renames across filesystems.
+var renameFile = os.Rename
+
+// PromoteTempFile gives the temporary file tmp the name finalPath, replacing the file there:
+// tmp is chmod'ed to perm, synced and closed, then renamed. Across filesystems, where renames fail,
+// it's copied next to finalPath and renamed from there, and removed.
+// When the promotion fails tmp is closed and removed, and finalPath is left untouched.
+func PromoteTempFile(tmp *os.File, finalPath string, perm os.FileMode) error {
+	description := "file " + tmp.Name()
+	err := tmp.Chmod(perm)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err != nil {
+		err = secondaryError(phaseError(PhaseRelease, err), description, phaseError(PhaseRelease, closeFile(tmp, false)))
+		return secondaryError(err, description, removeError(os.Remove(tmp.Name())))
+	}
+	err = closeFile(tmp, false)
+	if err == nil {
+		err = renameFile(tmp.Name(), finalPath)
+		if isCrossDeviceError(err) {
+			err = copyPromoted(tmp.Name(), finalPath, perm)
+		}
+	}
+	if err != nil {
+		return secondaryError(phaseError(PhaseRelease, err), description, removeError(os.Remove(tmp.Name())))
+	}
+	return phaseError(PhaseRelease, syncDir(filepath.Dir(finalPath)))
+}
+
+// copyPromoted copies src to dst atomically and durably, then removes src.
+func copyPromoted(src, dst string, perm os.FileMode) error {
+	err := NewFileResource(src, os.O_RDONLY, 0).Use(func(in *os.File) error {
+		return NewAtomicFileResource(dst, perm, Sync()).Use(func(out *os.File) error {
+			_, err := io.Copy(out, in)
+			return err
+		})
+	})
+	if err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+// TempThenPromote gives fn a new temporary file, like NewTempFileResource("", "") does,
+// and promotes it with PromoteTempFile to the path fn returns, with OwnerRWOnly permissions,
+// instead of removing it. When fn fails or returns an empty path, the file is removed.
+// It's for naming files after their content, a checksum for instance.
+func TempThenPromote(fn func(f *os.File) (finalPath string, err error)) error {
+	tmp, err := os.CreateTemp("", "promote-*")
+	if err != nil {
+		return phaseError(PhaseAcquire, err)
+	}
+	open := trackOpenAs("file", "file "+tmp.Name(), 0)
+	defer open.release()
+
+	finalPath, err := fn(tmp)
+	if err != nil || finalPath == "" {
+		err = secondaryError(err, "file "+tmp.Name(), phaseError(PhaseRelease, closeFile(tmp, false)))
+		return secondaryError(err, "file "+tmp.Name(), removeError(os.Remove(tmp.Name())))
+	}
+	return PromoteTempFile(tmp, finalPath, OwnerRWOnly)
+}
@@ -0,0 +1,119 @@
+package resource_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+// promoteByDigest writes content to the temporary file and names it after its digest in dir,
+// recording the name of the temporary file in tmpName.
+func promoteByDigest(dir, content string, tmpName *string) func(f *os.File) (string, error) {
+	return func(f *os.File) (string, error) {
+		*tmpName = f.Name()
+		_, err := f.WriteString(content)
+		sum := sha256.Sum256([]byte(content))
+		return filepath.Join(dir, hex.EncodeToString(sum[:8])), err
+	}
+}
+
+// checkRemoved checks the temporary file at path is gone.
+func checkRemoved(t *testing.T, path string) {
+	t.Helper()
+	if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Stat of the temporary file = %v, want it removed", err)
+	}
+	if err := resource.VerifyNoneOpen(); err != nil {
+		t.Errorf("VerifyNoneOpen = %v", err)
+	}
+}
+
+func TestTempThenPromote(t *testing.T) {
+	dir := t.TempDir()
+	var tmpName string
+	err := resource.TempThenPromote(promoteByDigest(dir, "hello", &tmpName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := dirEntries(t, dir)
+	if len(entries) != 1 || entries[0] != "2cf24dba5fb0a30e" {
+		t.Fatalf("files = %q, want the one named after its digest", entries)
+	}
+	path := filepath.Join(dir, entries[0])
+	if got := readFile(t, path); got != "hello" {
+		t.Errorf("content = %q", got)
+	}
+	info, err := os.Stat(path)
+	if err != nil || info.Mode().Perm() != resource.OwnerRWOnly {
+		t.Errorf("Stat = %v, %v, want owner only permissions", info.Mode(), err)
+	}
+	checkRemoved(t, tmpName)
+
+	// promoting the same content again replaces the file
+	err = resource.TempThenPromote(promoteByDigest(dir, "hello", &tmpName))
+	if err != nil || !slices.Equal(dirEntries(t, dir), entries) {
+		t.Errorf("second promotion = %v with files %q", err, dirEntries(t, dir))
+	}
+}
+
+func TestTempThenPromoteDiscards(t *testing.T) {
+	errBuild := errors.New("build failed")
+	for _, test := range []struct {
+		name string
+		path string
+		err  error
+	}{
+		{"empty path", "", nil},
+		{"error", "ignored", errBuild},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var tmpName string
+			err := resource.TempThenPromote(func(f *os.File) (string, error) {
+				tmpName = f.Name()
+				_, err := f.WriteString("discarded")
+				if err != nil {
+					return "", err
+				}
+				return test.path, test.err
+			})
+			if !errors.Is(err, test.err) || test.err == nil && err != nil {
+				t.Errorf("TempThenPromote = %v, want %v", err, test.err)
+			}
+			checkRemoved(t, tmpName)
+		})
+	}
+}
+
+func TestPromoteTempFileFailure(t *testing.T) {
+	dir := t.TempDir()
+	final := filepath.Join(dir, "final")
+	writeFile(t, final, "previous")
+	errRename := errors.New("rename failed")
+	resource.SetRename(t, func(string, string) error { return errRename })
+
+	tmp, err := os.CreateTemp(dir, "tmp-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tmp.WriteString("new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = resource.PromoteTempFile(tmp, final, 0o644)
+	if !errors.Is(err, errRename) || phaseOf(t, err) != resource.PhaseRelease {
+		t.Errorf("PromoteTempFile = %v, want the release error of the rename", err)
+	}
+	if got := readFile(t, final); got != "previous" {
+		t.Errorf("final content = %q, want it untouched", got)
+	}
+	if entries := dirEntries(t, dir); !slices.Equal(entries, []string{"final"}) {
+		t.Errorf("files = %q, want the temporary file removed", entries)
+	}
+}
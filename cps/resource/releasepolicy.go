@@ -0,0 +1,91 @@
+package resource
+
+import (
+	"errors"
+	"strings"
+)
+
+// Severity tells what a release error does to the Use it happened in, see ReleaseErrorPolicy.
+type Severity int
+
+const (
+	// SeverityFail fails the Use, as every release error does by default.
+	SeverityFail Severity = iota
+	// SeverityWarn reports the error as a WarnReleaseError warning instead.
+	SeverityWarn
+	// SeverityIgnore drops the error; it's still counted by the stats collector.
+	SeverityIgnore
+)
+
+// ReleaseErrorPolicy classifies the release errors of a resource, see WithReleaseErrorPolicy.
+// Any func(error) Severity is one.
+type ReleaseErrorPolicy func(err error) Severity
+
+// FailUse is the default policy: every release error fails the Use.
+func FailUse() ReleaseErrorPolicy {
+	return func(error) Severity {
+		return SeverityFail
+	}
+}
+
+// WarnOnly reports every release error as a warning instead of failing the Use.
+func WarnOnly() ReleaseErrorPolicy {
+	return func(error) Severity {
+		return SeverityWarn
+	}
+}
+
+// WithReleaseErrorPolicy lets policy decide whether the release errors of r fail its Use.
+// Release errors are the *ResourceErrors of PhaseRelease of the error of r, possibly joined with others;
+// the downgraded ones are counted in the DowngradedReleaseErrors stats of the kind of r, the first word
+// of its description ("file", "db"...), "resource" without one.
+//
+// It suits the errors which aren't worth failing for, like closing rows read to their end;
+// losing the close error of a written file loses data.
+func WithReleaseErrorPolicy[T any](r Resource[T], policy ReleaseErrorPolicy) Resource[T] {
+	description := r.Describe()
+	kind, _, _ := strings.Cut(description, " ")
+	if kind == "" {
+		kind = "resource"
+	}
+	return Resource[T]{
+		Description: r.Description,
+		Use: func(callback func(value T) error) error {
+			err := r.Use(callback)
+			if err == nil {
+				return nil
+			}
+			return applyReleasePolicy(err, policy, description, kind)
+		},
+	}
+}
+
+// applyReleasePolicy returns err without the release errors the policy downgrades.
+func applyReleasePolicy(err error, policy ReleaseErrorPolicy, description, kind string) error {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		var kept []error
+		for _, err := range joined.Unwrap() {
+			if err = applyReleasePolicy(err, policy, description, kind); err != nil {
+				kept = append(kept, err)
+			}
+		}
+		if len(kept) == len(joined.Unwrap()) {
+			return err
+		}
+		return errors.Join(kept...)
+	}
+
+	var resourceErr *ResourceError
+	if !errors.As(err, &resourceErr) || resourceErr.Phase != PhaseRelease {
+		return err
+	}
+	severity := policy(err)
+	if severity == SeverityFail {
+		return err
+	}
+	currentStats(kind).releaseDowngraded()
+	if severity == SeverityWarn {
+		warnErr(WarnReleaseError, description, err)
+	}
+	return nil
+}
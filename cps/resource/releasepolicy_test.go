@@ -0,0 +1,84 @@
+package resource_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+var (
+	errNoise = errors.New("close after the last row")
+	errLost  = errors.New("data lost")
+)
+
+// ignoreNoise fails for every release error but errNoise.
+func ignoreNoise(err error) resource.Severity {
+	if errors.Is(err, errNoise) {
+		return resource.SeverityIgnore
+	}
+	return resource.SeverityFail
+}
+
+// closingWith is a "rows" resource whose close fails with err.
+func closingWith(err error) resource.Resource[*fakeCloser] {
+	r := resource.FromOpener(func() (*fakeCloser, error) {
+		return &fakeCloser{err: err}, nil
+	})
+	r.Description = "rows fake"
+	return r
+}
+
+func TestReleaseErrorPolicies(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		policy     resource.ReleaseErrorPolicy
+		closeErr   error
+		fails      bool
+		warns      bool
+		downgraded int64
+	}{
+		{"FailUse", resource.FailUse(), errLost, true, false, 0},
+		{"WarnOnly", resource.WarnOnly(), errLost, false, true, 1},
+		{"classifier ignoring", ignoreNoise, errNoise, false, false, 1},
+		{"classifier failing", ignoreNoise, errLost, true, false, 0},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			stats := installStats(t)
+			warnings := captureWarnings(t)
+			err := resource.WithReleaseErrorPolicy(closingWith(test.closeErr), test.policy).Use(func(*fakeCloser) error {
+				return nil
+			})
+			if test.fails != (err != nil) || test.fails && !errors.Is(err, test.closeErr) {
+				t.Errorf("Use = %v, want the close error: %v", err, test.fails)
+			}
+			if warned := hasWarning(warnings(), resource.WarnReleaseError); warned != test.warns {
+				t.Errorf("warnings = %v, want the close error reported: %v", warnings(), test.warns)
+			}
+			if got := stats.Stats()["rows"].DowngradedReleaseErrors; got != test.downgraded {
+				t.Errorf("DowngradedReleaseErrors = %d, want %d", got, test.downgraded)
+			}
+		})
+	}
+}
+
+func TestReleaseErrorPolicyKeepsOtherErrors(t *testing.T) {
+	warnings := captureWarnings(t)
+	errQuery := errors.New("bad query")
+	err := resource.WithReleaseErrorPolicy(closingWith(errNoise), resource.WarnOnly()).Use(func(*fakeCloser) error {
+		return errQuery
+	})
+	if !errors.Is(err, errQuery) || errors.Is(err, errNoise) {
+		t.Errorf("Use = %v, want the callback error without the downgraded close one", err)
+	}
+	if !hasWarning(warnings(), resource.WarnReleaseError) {
+		t.Errorf("warnings = %v, want the close error", warnings())
+	}
+
+	// an acquire error isn't the policy's
+	failing := resource.FromOpener(func() (*fakeCloser, error) { return nil, errLost })
+	err = resource.WithReleaseErrorPolicy(failing, resource.WarnOnly()).Use(func(*fakeCloser) error { return nil })
+	if !errors.Is(err, errLost) || phaseOf(t, err) != resource.PhaseAcquire {
+		t.Errorf("Use = %v, want the acquire error", err)
+	}
+}
@@ -0,0 +1,73 @@
+package resource
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrReleaseTimeout is returned by a WithReleaseTimeout resource whose release took too long.
+var ErrReleaseTimeout = errors.New("release timed out")
+
+type releaseTimeoutOptions struct {
+	clock Clock
+}
+
+// ReleaseTimeoutOption configures WithReleaseTimeout.
+type ReleaseTimeoutOption func(options *releaseTimeoutOptions)
+
+// ReleaseTimeoutClock makes WithReleaseTimeout time the release with clock.
+func ReleaseTimeoutClock(clock Clock) ReleaseTimeoutOption {
+	return func(options *releaseTimeoutOptions) {
+		options.clock = clock
+	}
+}
+
+// WithReleaseTimeout stops waiting for r's release after d, so a hung Close doesn't hang Use:
+// Use then returns the callback's error joined with ErrReleaseTimeout (as a PhaseRelease error),
+// and the release finishes in the background. VerifyNoneOpen reports it until it does.
+//
+// r.Use runs in a goroutine of its own, the callback in the calling one.
+func WithReleaseTimeout[T any](r Resource[T], d time.Duration, opts ...ReleaseTimeoutOption) Resource[T] {
+	var options releaseTimeoutOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	clock := clockOr(options.clock)
+
+	return Resource[T]{
+		Use: func(callback func(value T) error) error {
+			values := make(chan T)
+			results := make(chan error)
+			done := make(chan error, 1)
+			go func() {
+				done <- r.Use(func(value T) error {
+					values <- value
+					return <-results
+				})
+			}()
+
+			var value T
+			select {
+			case value = <-values:
+			case err := <-done:
+				return err // not acquired
+			}
+			err := callback(value)
+			results <- err
+
+			timer := clock.NewTimer(d)
+			defer timer.Stop()
+			select {
+			case releaseErr := <-done:
+				return releaseErr
+			case <-timer.C():
+				open := trackOpen("release")
+				go func() {
+					<-done
+					open.release()
+				}()
+				return errors.Join(err, phaseError(PhaseRelease, ErrReleaseTimeout))
+			}
+		},
+	}
+}
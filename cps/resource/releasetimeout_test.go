@@ -0,0 +1,111 @@
+package resource_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+func TestWithReleaseTimeoutOnClock(t *testing.T) {
+	clock := newFakeClock()
+	releasing := make(chan struct{})
+	hung := make(chan struct{})
+	r := resource.Resource[int]{
+		Use: func(callback func(int) error) error {
+			err := callback(1)
+			close(releasing)
+			<-hung
+			return err
+		},
+	}
+	go func() {
+		<-releasing
+		clock.BlockUntilTimers(1)
+		clock.Advance(time.Minute)
+	}()
+
+	err := resource.WithReleaseTimeout(r, time.Minute, resource.ReleaseTimeoutClock(clock)).Use(func(int) error {
+		return nil
+	})
+	if !errors.Is(err, resource.ErrReleaseTimeout) || phaseOf(t, err) != resource.PhaseRelease {
+		t.Fatalf("got %v, want ErrReleaseTimeout", err)
+	}
+	close(hung)
+}
+
+// slowClose is a resource of 1 whose release takes d and returns err.
+func slowClose(d time.Duration, err error) (r resource.Resource[int], released <-chan struct{}) {
+	done := make(chan struct{})
+	return resource.Resource[int]{
+		Use: func(callback func(int) error) error {
+			callbackErr := callback(1)
+			time.Sleep(d)
+			close(done)
+			return errors.Join(callbackErr, err)
+		},
+	}, done
+}
+
+func TestWithReleaseTimeoutSlowClose(t *testing.T) {
+	errCallback := errors.New("callback")
+	r, released := slowClose(200*time.Millisecond, nil)
+	start := time.Now()
+	err := resource.WithReleaseTimeout(r, 10*time.Millisecond).Use(func(int) error {
+		return errCallback
+	})
+	if elapsed := time.Since(start); elapsed > 150*time.Millisecond {
+		t.Errorf("Use took %v, want it to stop waiting after the timeout", elapsed)
+	}
+	if !errors.Is(err, errCallback) || !errors.Is(err, resource.ErrReleaseTimeout) {
+		t.Errorf("Use = %v, want the callback error and ErrReleaseTimeout", err)
+	}
+	<-released
+	eventually(t, func() bool { return resource.VerifyNoneOpen() == nil })
+}
+
+func TestWithReleaseTimeoutTrackedUntilReleased(t *testing.T) {
+	hung := make(chan struct{})
+	r := resource.Resource[int]{
+		Use: func(callback func(int) error) error {
+			err := callback(1)
+			<-hung
+			return err
+		},
+	}
+	err := resource.WithReleaseTimeout(r, time.Millisecond).Use(func(int) error { return nil })
+	if !errors.Is(err, resource.ErrReleaseTimeout) {
+		t.Fatalf("Use = %v, want ErrReleaseTimeout", err)
+	}
+	if err := resource.VerifyNoneOpen(); !errors.Is(err, resource.ErrResourcesOpen) {
+		t.Errorf("VerifyNoneOpen during the release = %v, want %v", err, resource.ErrResourcesOpen)
+	}
+	close(hung)
+	eventually(t, func() bool { return resource.VerifyNoneOpen() == nil })
+}
+
+func TestWithReleaseTimeoutFastClose(t *testing.T) {
+	errClose := errors.New("close")
+	for _, closeErr := range []error{nil, errClose} {
+		r, _ := slowClose(5*time.Millisecond, closeErr)
+		err := resource.WithReleaseTimeout(r, time.Second).Use(func(int) error { return nil })
+		if !errors.Is(err, closeErr) || errors.Is(err, resource.ErrReleaseTimeout) {
+			t.Errorf("Use = %v, want the release error %v", err, closeErr)
+		}
+	}
+}
+
+func TestWithReleaseTimeoutAcquireError(t *testing.T) {
+	errAcquire := errors.New("acquire")
+	called := false
+	err := resource.WithReleaseTimeout(resource.Resource[int]{
+		Use: func(func(int) error) error { return errAcquire },
+	}, time.Second).Use(func(int) error {
+		called = true
+		return nil
+	})
+	if called || !errors.Is(err, errAcquire) {
+		t.Errorf("Use = %v with the callback called %v, want the acquire error", err, called)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !unix && !windows
+
+package resource
+
+// isCrossDeviceError is false where the error isn't known.
+func isCrossDeviceError(err error) bool {
+	return false
+}
@@ -0,0 +1,13 @@
+//go:build unix
+
+package resource
+
+import (
+	"errors"
+	"syscall"
+)
+
+// isCrossDeviceError tells whether a rename failed for going across filesystems.
+func isCrossDeviceError(err error) bool {
+	return errors.Is(err, syscall.EXDEV)
+}
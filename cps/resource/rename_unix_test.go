@@ -0,0 +1,53 @@
+//go:build unix
+
+package resource_test
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"syscall"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+func TestPromoteTempFileAcrossFilesystems(t *testing.T) {
+	dir := t.TempDir()
+	final := filepath.Join(dir, "final")
+	writeFile(t, final, "previous")
+	var renames []string
+	resource.SetRename(t, func(oldpath, newpath string) error {
+		renames = append(renames, filepath.Base(newpath))
+		if newpath == final {
+			return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EXDEV}
+		}
+		return os.Rename(oldpath, newpath)
+	})
+
+	tmpDir := t.TempDir()
+	tmp, err := os.CreateTemp(tmpDir, "tmp-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tmp.WriteString("new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = resource.PromoteTempFile(tmp, final, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, final); got != "new" {
+		t.Errorf("final content = %q, want the copy", got)
+	}
+	if entries := dirEntries(t, dir); !slices.Equal(entries, []string{"final"}) {
+		t.Errorf("files = %q, want only the final one", entries)
+	}
+	if entries := dirEntries(t, tmpDir); len(entries) != 0 {
+		t.Errorf("temporary files = %q, want the source removed", entries)
+	}
+	if len(renames) != 1 {
+		t.Errorf("renames to %q, want only the one failing", renames)
+	}
+}
@@ -0,0 +1,16 @@
+//go:build windows
+
+package resource
+
+import (
+	"errors"
+	"syscall"
+)
+
+// ERROR_NOT_SAME_DEVICE, of a MoveFileEx across volumes
+const errorNotSameDevice syscall.Errno = 17
+
+// isCrossDeviceError tells whether a rename failed for going across volumes.
+func isCrossDeviceError(err error) bool {
+	return errors.Is(err, errorNotSameDevice)
+}
@@ -0,0 +1,111 @@
+package resource
+
+import (
+	"database/sql"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DBConfig is what sql.Open needs.
+type DBConfig struct {
+	DriverName     string
+	DatasourceName string
+}
+
+// Resource is NewDBResource for the config.
+func (c DBConfig) Resource() DBResource {
+	return NewDBResource(c.DriverName, c.DatasourceName)
+}
+
+// DefaultReplicaCooldown is how long a failed replica is skipped before it's tried again.
+const DefaultReplicaCooldown = 30 * time.Second
+
+// ReplicatedDBResource splits reads and writes between a primary database and its replicas.
+type ReplicatedDBResource struct {
+	// Cooldown is how long a replica is skipped after it failed to open or ping.
+	Cooldown time.Duration
+	// Clock tells when the cooldowns are over, the real clock when nil.
+	Clock Clock
+
+	primary  DBConfig
+	replicas []*replica
+	next     atomic.Uint64
+}
+
+type replica struct {
+	config DBConfig
+
+	mu       sync.Mutex
+	badUntil time.Time
+}
+
+// NewReplicatedDBResource creates the resource; every Use opens and closes its database, like DBResource does.
+func NewReplicatedDBResource(primary DBConfig, replicas []DBConfig) *ReplicatedDBResource {
+	r := &ReplicatedDBResource{Cooldown: DefaultReplicaCooldown, primary: primary}
+	for _, config := range replicas {
+		r.replicas = append(r.replicas, &replica{config: config})
+	}
+	return r
+}
+
+// UseWrite runs the callback with the primary database.
+func (r *ReplicatedDBResource) UseWrite(callback func(db *sql.DB) error) error {
+	_, err := usePinged(r.primary, callback)
+	return err
+}
+
+// UseRead runs the callback with the next healthy replica, round-robin.
+// A replica which fails to open or ping is marked bad for Cooldown and the next one is tried;
+// the primary is used when no replica is healthy. Callback errors never mark replicas bad.
+func (r *ReplicatedDBResource) UseRead(callback func(db *sql.DB) error) error {
+	var errs []error
+	start := r.next.Add(1)
+	for i := range r.replicas {
+		replica := r.replicas[(start+uint64(i))%uint64(len(r.replicas))]
+		if !replica.healthy(clockOr(r.Clock)) {
+			continue
+		}
+		acquired, err := usePinged(replica.config, callback)
+		if acquired {
+			return err
+		}
+		replica.markBad(clockOr(r.Clock), r.Cooldown)
+		errs = append(errs, err)
+	}
+
+	acquired, err := usePinged(r.primary, callback)
+	if acquired {
+		return err
+	}
+	return errors.Join(append(errs, err)...)
+}
+
+func (rep *replica) healthy(clock Clock) bool {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+	return clock.Now().After(rep.badUntil)
+}
+
+func (rep *replica) markBad(clock Clock, cooldown time.Duration) {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+	rep.badUntil = clock.Now().Add(cooldown)
+}
+
+// usePinged is DBResource.Use which also pings the database before the callback,
+// telling whether the callback got to run.
+func usePinged(config DBConfig, callback func(db *sql.DB) error) (bool, error) {
+	db, err := sql.Open(config.DriverName, config.DatasourceName)
+	if err != nil {
+		return false, phaseError(PhaseAcquire, err)
+	}
+	err = db.Ping()
+	if err != nil {
+		closeErr := db.Close()
+		return false, secondaryError(phaseError(PhaseAcquire, err), "db "+config.DriverName, phaseError(PhaseRelease, closeErr))
+	}
+	err = callback(db)
+	return true, errors.Join(err, db.Close())
+}
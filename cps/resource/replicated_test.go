@@ -0,0 +1,173 @@
+package resource_test
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+	"github.com/mattn/go-sqlite3"
+)
+
+// flaky is the driver "flaky": sqlite3 failing to open the databases marked down, counting the opens.
+var flaky = &flakyDriver{down: make(map[string]bool), opens: make(map[string]int)}
+
+func init() {
+	sql.Register("flaky", flaky)
+}
+
+type flakyDriver struct {
+	sqlite3.SQLiteDriver
+	mu    sync.Mutex
+	down  map[string]bool
+	opens map[string]int
+}
+
+func (d *flakyDriver) Open(name string) (driver.Conn, error) {
+	d.mu.Lock()
+	d.opens[name]++
+	down := d.down[name]
+	d.mu.Unlock()
+	if down {
+		return nil, errors.New("flaky: " + name + " is down")
+	}
+	return d.SQLiteDriver.Open(name)
+}
+
+func (d *flakyDriver) setDown(name string, down bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.down[name] = down
+}
+
+func (d *flakyDriver) openCount(name string) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.opens[name]
+}
+
+// replicatedDBs creates the sqlite files of a primary and two replicas, each knowing its name.
+func replicatedDBs(t *testing.T) (primary resource.DBConfig, replicas []resource.DBConfig) {
+	t.Helper()
+	dir := t.TempDir()
+	var configs []resource.DBConfig
+	for _, name := range []string{"primary", "replica1", "replica2"} {
+		config := resource.DBConfig{DriverName: "flaky", DatasourceName: filepath.Join(dir, name+".db")}
+		err := config.Resource().Use(func(db *sql.DB) error {
+			_, err := db.Exec("CREATE TABLE whoami (name TEXT); INSERT INTO whoami VALUES (?)", name)
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		configs = append(configs, config)
+	}
+	return configs[0], configs[1:]
+}
+
+func whoami(r *resource.ReplicatedDBResource, read bool) (string, error) {
+	var name string
+	use := r.UseWrite
+	if read {
+		use = r.UseRead
+	}
+	err := use(func(db *sql.DB) error {
+		return db.QueryRow("SELECT name FROM whoami").Scan(&name)
+	})
+	return name, err
+}
+
+func TestReplicatedReadsAndWrites(t *testing.T) {
+	primary, replicas := replicatedDBs(t)
+	r := resource.NewReplicatedDBResource(primary, replicas)
+
+	seen := make(map[string]int)
+	for range 4 {
+		name, err := whoami(r, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen[name]++
+	}
+	if seen["replica1"] != 2 || seen["replica2"] != 2 {
+		t.Errorf("reads went to %v, want round-robin over the replicas", seen)
+	}
+	for range 2 {
+		name, err := whoami(r, false)
+		if err != nil || name != "primary" {
+			t.Errorf("write went to %q, %v", name, err)
+		}
+	}
+}
+
+func TestReplicatedFailover(t *testing.T) {
+	primary, replicas := replicatedDBs(t)
+	clock := newFakeClock()
+	r := resource.NewReplicatedDBResource(primary, replicas)
+	r.Clock = clock
+	r.Cooldown = time.Minute
+
+	flaky.setDown(replicas[0].DatasourceName, true)
+	for range 4 {
+		name, err := whoami(r, true)
+		if err != nil || name != "replica2" {
+			t.Errorf("read went to %q, %v, want the healthy replica", name, err)
+		}
+	}
+	if n := flaky.openCount(replicas[0].DatasourceName); n != 1+1 { // created, then failed once
+		t.Errorf("the bad replica was opened %d times during its cooldown, want 2", n)
+	}
+
+	flaky.setDown(replicas[0].DatasourceName, false)
+	clock.Advance(time.Minute + time.Second)
+	seen := make(map[string]bool)
+	for range 2 {
+		name, _ := whoami(r, true)
+		seen[name] = true
+	}
+	if !seen["replica1"] {
+		t.Errorf("reads went to %v after the cooldown, want the replica back", seen)
+	}
+
+	flaky.setDown(replicas[0].DatasourceName, true)
+	flaky.setDown(replicas[1].DatasourceName, true)
+	name, err := whoami(r, true)
+	if err != nil || name != "primary" {
+		t.Errorf("read went to %q, %v, want the primary without healthy replicas", name, err)
+	}
+
+	flaky.setDown(primary.DatasourceName, true)
+	clock.Advance(2 * time.Minute)
+	_, err = whoami(r, true)
+	if err == nil || phaseOf(t, err) != resource.PhaseAcquire {
+		t.Errorf("read with everything down = %v, want the acquire errors", err)
+	}
+	for _, config := range append(replicas, primary) {
+		flaky.setDown(config.DatasourceName, false)
+	}
+}
+
+func TestReplicatedCallbackErrorKeepsReplica(t *testing.T) {
+	primary, replicas := replicatedDBs(t)
+	r := resource.NewReplicatedDBResource(primary, replicas)
+	errBoom := errors.New("boom")
+
+	for range 4 {
+		err := r.UseRead(func(*sql.DB) error { return errBoom })
+		if !errors.Is(err, errBoom) {
+			t.Errorf("UseRead = %v, want %v", err, errBoom)
+		}
+	}
+	for _, config := range replicas {
+		if n := flaky.openCount(config.DatasourceName); n != 1+2 { // created, then read twice
+			t.Errorf("%s opened %d times, want 3", filepath.Base(config.DatasourceName), n)
+		}
+	}
+	if n := flaky.openCount(primary.DatasourceName); n != 1 {
+		t.Errorf("primary opened %d times for failed reads, want only when created", n)
+	}
+}
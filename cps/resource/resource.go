@@ -0,0 +1,174 @@
+// Package resource manages the lifecycle of resources in continuation-passing style:
+// a resource is acquired, given to a callback and released afterwards,
+// so the calling code can neither forget to release it nor release it wrong.
+//
+// The wrappers are cheap enough for hot paths: with no tracer, no stats collector and debug mode off,
+// a Use of NewFileResource, RunTransaction or QueryRows allocates exactly as much as opening
+// and closing by hand does, as long as the callback doesn't capture new variables.
+// Tracing, stats and debug mode each cost a few allocations per Use.
+package resource
+
+import (
+	"fmt"
+)
+
+// Resource is the generic form of TxResource and RowsResource, and of the decorators:
+// Use acquires the value, passes it to the callback and releases it afterwards.
+//
+// The constructors of this package return reusable resources: every Use acquires a value of its own,
+// so a resource can be used again and by concurrent goroutines. Once makes a resource single-use.
+type Resource[T any] struct {
+	Use func(callback func(value T) error) error
+	// Description tells which resource it is, for debugging; set by the constructors of this package
+	// and lost by the decorators building a new Resource.
+	Description string
+}
+
+// Describe returns the Description of r, "resource" when it has none.
+// Descriptions never contain passwords.
+func (r Resource[T]) Describe() string {
+	if r.Description == "" {
+		return "resource"
+	}
+	return r.Description
+}
+
+// Usable is implemented by everything with a Use method: Resource values (through Usable),
+// FileResource, DBResource, SharedDBResource, Pool... Decorators can take it to accept all of them,
+// and type-switch on the concrete types behind it. Resource itself stays a struct, so the code building
+// Resource literals keeps compiling.
+type Usable[T any] interface {
+	Use(callback func(value T) error) error
+}
+
+// Resource has Use as a field, so it can't implement Usable by itself.
+type usableResource[T any] struct {
+	r Resource[T]
+}
+
+// wrapper is implemented by the Usable values wrapping a Resource, for FromUsable to unwrap them.
+type wrapper[T any] interface {
+	resource() Resource[T]
+}
+
+func (u usableResource[T]) resource() Resource[T] {
+	return u.r
+}
+
+func (u usableResource[T]) Use(callback func(value T) error) error {
+	return u.r.Use(callback)
+}
+
+// Usable returns r as a Usable.
+func (r Resource[T]) Usable() Usable[T] {
+	return usableResource[T]{r}
+}
+
+// FromUsable returns u as a Resource, r itself when u came from r.Usable() or DB(r).
+// The Description is the one of the Describe method of u, when it has one.
+func FromUsable[T any](u Usable[T]) Resource[T] {
+	if u, ok := u.(wrapper[T]); ok {
+		return u.resource()
+	}
+	r := Resource[T]{Use: u.Use}
+	if d, ok := u.(interface{ Describe() string }); ok {
+		r.Description = d.Describe()
+	}
+	return r
+}
+
+// Phase tells in which part of a resource lifecycle an error happened.
+type Phase int
+
+const (
+	// PhaseAcquire is opening, connecting, starting...
+	PhaseAcquire Phase = iota
+	// PhaseUse is the callback.
+	PhaseUse
+	// PhaseRelease is closing, committing, waiting...
+	PhaseRelease
+)
+
+func (p Phase) String() string {
+	switch p {
+	case PhaseAcquire:
+		return "acquire"
+	case PhaseUse:
+		return "use"
+	case PhaseRelease:
+		return "release"
+	default:
+		return fmt.Sprintf("phase(%d)", int(p))
+	}
+}
+
+// ResourceError marks an error with the lifecycle phase it came from,
+// so callers can tell "could not open" from "callback failed" from "could not close".
+type ResourceError struct {
+	Phase Phase
+	// Resource describes the failed resource, empty when unknown.
+	Resource string
+	Err      error
+}
+
+func (e *ResourceError) Error() string {
+	if e.Resource != "" {
+		return e.Phase.String() + " " + e.Resource + ": " + e.Err.Error()
+	}
+	return e.Phase.String() + ": " + e.Err.Error()
+}
+
+func (e *ResourceError) Unwrap() error {
+	return e.Err
+}
+
+func phaseError(phase Phase, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &ResourceError{Phase: phase, Err: err}
+}
+
+// describedError is phaseError telling which resource failed.
+// A *ResourceError keeps its phase and gets the description if it has none yet.
+func describedError(phase Phase, resource string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if checked, ok := err.(*checkedError); ok {
+		if e, ok := checked.err.(*ResourceError); ok && e.Resource != "" {
+			return err
+		}
+		// replaced by the described error, which the Use returning it checks again
+		checked.observed.Store(true)
+		err = checked.err
+	}
+	if e, ok := err.(*ResourceError); ok {
+		if e.Resource != "" {
+			return e
+		}
+		described := *e
+		described.Resource = resource
+		return &described
+	}
+	return &ResourceError{Phase: phase, Resource: resource, Err: err}
+}
+
+// UseValue is Use for callbacks computing a value: the callback returns it
+// instead of smuggling it out through a captured variable.
+// The zero R is returned on any error, release errors included.
+//
+// It's a function and not a method because methods can't have type parameters.
+func UseValue[T, R any](r Resource[T], callback func(value T) (R, error)) (R, error) {
+	var result R
+	err := r.Use(func(value T) error {
+		var err error
+		result, err = callback(value)
+		return err
+	})
+	if err != nil {
+		var zero R
+		return zero, err
+	}
+	return result, nil
+}
@@ -0,0 +1,65 @@
+package resource_test
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+// releasing is a resource of value whose release fails with err.
+func releasing(value string, err error) resource.Resource[string] {
+	return resource.Resource[string]{
+		Use: func(callback func(v string) error) error {
+			return errors.Join(callback(value), err)
+		},
+	}
+}
+
+func TestUseValue(t *testing.T) {
+	got, err := resource.UseValue(releasing("a", nil), func(v string) (int, error) {
+		return len(v) + 41, nil
+	})
+	if got != 42 || err != nil {
+		t.Errorf("UseValue = %d, %v, want 42", got, err)
+	}
+
+	errBoom := errors.New("boom")
+	got, err = resource.UseValue(releasing("a", nil), func(v string) (int, error) {
+		return 42, errBoom
+	})
+	if got != 0 || !errors.Is(err, errBoom) {
+		t.Errorf("UseValue with a failed callback = %d, %v, want 0, %v", got, err, errBoom)
+	}
+}
+
+func TestUseValueDiscardedOnReleaseError(t *testing.T) {
+	errRelease := errors.New("release")
+	got, err := resource.UseValue(releasing("a", errRelease), func(v string) (*string, error) {
+		return &v, nil
+	})
+	if got != nil || !errors.Is(err, errRelease) {
+		t.Errorf("UseValue with a failed release = %v, %v, want nil, %v", got, err, errRelease)
+	}
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db")+"?_foreign_keys=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	_, err = db.Exec(`
+		CREATE TABLE items (id INTEGER PRIMARY KEY);
+		CREATE TABLE children (parent INTEGER REFERENCES items (id) DEFERRABLE INITIALLY DEFERRED);
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := resource.UseValue(resource.RunTransaction(db), func(tx *sql.Tx) (int64, error) {
+		return resource.ExecReturningID(tx, "INSERT INTO children (parent) VALUES (42)") // fails the commit
+	})
+	if id != 0 || phaseOf(t, err) != resource.PhaseRelease {
+		t.Errorf("UseValue with a failed commit = %d, %v, want 0 and a release error", id, err)
+	}
+}
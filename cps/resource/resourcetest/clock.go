@@ -0,0 +1,180 @@
+package resourcetest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+// FakeClock is a resource.Clock whose time only moves with Advance,
+// so the time-dependent features run instantly and deterministically in tests.
+type FakeClock struct {
+	mu      sync.Mutex
+	changed *sync.Cond // broadcast when timers are added
+	now     time.Time
+	timers  []*fakeTimer
+}
+
+var _ resource.Clock = (*FakeClock)(nil)
+
+// NewFakeClock creates a clock telling start until it's advanced.
+func NewFakeClock(start time.Time) *FakeClock {
+	c := &FakeClock{now: start}
+	c.changed = sync.NewCond(&c.mu)
+	return c
+}
+
+type fakeTimer struct {
+	clock  *FakeClock
+	when   time.Time
+	period time.Duration // of tickers, 0 for timers
+	c      chan time.Time
+	f      func()
+	active bool
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *FakeClock) NewTimer(d time.Duration) resource.Timer {
+	return c.add(&fakeTimer{clock: c, c: make(chan time.Time, 1)}, d)
+}
+
+// NewTicker panics for a d of 0 or less, like time.NewTicker does.
+func (c *FakeClock) NewTicker(d time.Duration) resource.Ticker {
+	if d <= 0 {
+		panic("resourcetest: non-positive interval for NewTicker")
+	}
+	return fakeTicker{c.add(&fakeTimer{clock: c, period: d, c: make(chan time.Time, 1)}, d)}
+}
+
+// AfterFunc calls f from the goroutine of the Advance reaching its time.
+func (c *FakeClock) AfterFunc(d time.Duration, f func()) resource.Timer {
+	return c.add(&fakeTimer{clock: c, f: f}, d)
+}
+
+func (c *FakeClock) Sleep(ctx context.Context, d time.Duration) error {
+	timer := c.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *FakeClock) add(t *fakeTimer, d time.Duration) *fakeTimer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t.when = c.now.Add(d)
+	t.active = true
+	c.timers = append(c.timers, t)
+	c.changed.Broadcast()
+	return t
+}
+
+// Advance moves the time forward by d, firing the timers and tickers it reaches in the order of their times.
+// A ticker which missed several ticks gets only one, like a time.Ticker read too slowly.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	target := c.now.Add(d)
+	for {
+		next := c.nextTimer(target)
+		if next == nil {
+			break
+		}
+		c.now = next.when
+		if next.period > 0 {
+			next.when = next.when.Add(next.period)
+		} else {
+			c.remove(next)
+		}
+		if next.f != nil {
+			c.mu.Unlock()
+			next.f()
+			c.mu.Lock()
+			continue
+		}
+		select {
+		case next.c <- c.now:
+		default:
+		}
+	}
+	c.now = target
+	c.mu.Unlock()
+}
+
+// BlockUntilTimers waits until at least n timers, tickers and sleeps are waiting on the clock,
+// so a test can Advance once the code under test is there.
+func (c *FakeClock) BlockUntilTimers(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.timers) < n {
+		c.changed.Wait()
+	}
+}
+
+// nextTimer is the earliest timer due by target, nil if none.
+func (c *FakeClock) nextTimer(target time.Time) *fakeTimer {
+	var next *fakeTimer
+	for _, t := range c.timers {
+		if !t.when.After(target) && (next == nil || t.when.Before(next.when)) {
+			next = t
+		}
+	}
+	return next
+}
+
+func (c *FakeClock) remove(t *fakeTimer) {
+	t.active = false
+	for i, other := range c.timers {
+		if other == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return
+		}
+	}
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Stop() bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	active := t.active
+	c.remove(t)
+	return active
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	active := t.active
+	c.remove(t)
+	t.when = c.now.Add(d)
+	t.active = true
+	c.timers = append(c.timers, t)
+	c.changed.Broadcast()
+	return active
+}
+
+type fakeTicker struct {
+	timer *fakeTimer
+}
+
+func (t fakeTicker) C() <-chan time.Time {
+	return t.timer.c
+}
+
+func (t fakeTicker) Stop() {
+	t.timer.Stop()
+}
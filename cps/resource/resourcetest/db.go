@@ -0,0 +1,77 @@
+package resourcetest
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+type testDBOptions struct {
+	shared bool
+	file   bool
+}
+
+// TestDBOption configures WithTestDB.
+type TestDBOption func(options *testDBOptions)
+
+// SharedMemory makes every connection of the pool see the same in-memory database,
+// which plain :memory: doesn't do. Each WithTestDB still gets a database of its own.
+func SharedMemory() TestDBOption {
+	return func(options *testDBOptions) {
+		options.shared = true
+	}
+}
+
+// FileBacked puts the database in a file inside t.TempDir(), for tests needing real locking
+// like the ones provoking SQLITE_BUSY.
+func FileBacked() TestDBOption {
+	return func(options *testDBOptions) {
+		options.file = true
+	}
+}
+
+var sharedMemoryDBs atomic.Int64
+
+// WithTestDB opens an in-memory sqlite3 database, applies schema with resource.Migrate and runs fn with it.
+// The database is closed by t.Cleanup, so fn may call t.Fatal; a failed close fails the test.
+// The sqlite3 driver must be registered by the test binary.
+func WithTestDB(t testing.TB, schema []resource.Migration, fn func(db *sql.DB), opts ...TestDBOption) {
+	t.Helper()
+	var options testDBOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	dsn := ":memory:"
+	switch {
+	case options.file:
+		dsn = filepath.Join(t.TempDir(), "test.sqlite")
+	case options.shared:
+		dsn = fmt.Sprintf("file:resourcetest%d?mode=memory&cache=shared", sharedMemoryDBs.Add(1))
+	}
+
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		err := db.Close()
+		if err != nil {
+			t.Errorf("close test db: %v", err)
+		}
+	})
+	if dsn == ":memory:" {
+		// every new connection would get an empty database
+		db.SetMaxOpenConns(1)
+	}
+
+	err = resource.Migrate(db, schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn(db)
+}
@@ -0,0 +1,132 @@
+package resourcetest_test
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+	"github.com/Q69K/using-cps-in-golang/cps/resource/resourcetest"
+	"github.com/Q69K/using-cps-in-golang/cps/sqlerr"
+)
+
+var itemsSchema = []resource.Migration{
+	{Version: 1, Name: "items", Up: "CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT NOT NULL)"},
+	{Version: 2, Name: "first item", Up: "INSERT INTO items (name) VALUES ('first')"},
+}
+
+func countItems(t testing.TB, q interface {
+	QueryRow(query string, args ...any) *sql.Row
+}) int {
+	t.Helper()
+	var n int
+	err := q.QueryRow("SELECT COUNT(*) FROM items").Scan(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestWithTestDBAppliesSchema(t *testing.T) {
+	var kept *sql.DB
+	t.Run("fixture", func(t *testing.T) {
+		resourcetest.WithTestDB(t, itemsSchema, func(db *sql.DB) {
+			kept = db
+			if n := countItems(t, db); n != 1 {
+				t.Errorf("%d items, want the one of the schema", n)
+			}
+			var versions int
+			err := db.QueryRow("SELECT COUNT(*) FROM schema_migrations").Scan(&versions)
+			if err != nil || versions != 2 {
+				t.Errorf("%d migrations recorded, %v", versions, err)
+			}
+		})
+	})
+	if err := kept.Ping(); err == nil {
+		t.Error("database still open after the test")
+	}
+}
+
+func TestWithTestDBIsolated(t *testing.T) {
+	for _, opts := range [][]resourcetest.TestDBOption{nil, {resourcetest.SharedMemory()}, {resourcetest.FileBacked()}} {
+		for range 2 {
+			resourcetest.WithTestDB(t, itemsSchema, func(db *sql.DB) {
+				_, err := db.Exec("INSERT INTO items (name) VALUES ('second')")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if n := countItems(t, db); n != 2 {
+					t.Errorf("%d items, want a new database for every WithTestDB", n)
+				}
+			}, opts...)
+		}
+	}
+}
+
+func TestWithTestDBSharedMemory(t *testing.T) {
+	resourcetest.WithTestDB(t, itemsSchema, func(db *sql.DB) {
+		tx, err := db.Begin() // holds a connection
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tx.Rollback()
+		if n := countItems(t, tx); n != 1 {
+			t.Errorf("%d items in the transaction, want 1", n)
+		}
+		if n := countItems(t, db); n != 1 {
+			t.Errorf("%d items on another connection, want 1", n)
+		}
+	}, resourcetest.SharedMemory())
+}
+
+func TestWithTestDBFileBackedBusy(t *testing.T) {
+	resourcetest.WithTestDB(t, itemsSchema, func(db *sql.DB) {
+		locker, err := db.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer locker.Rollback()
+		_, err = locker.Exec("INSERT INTO items (name) VALUES ('locked')")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var path string
+		err = db.QueryRow("SELECT file FROM pragma_database_list WHERE name = 'main'").Scan(&path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if filepath.Dir(filepath.Dir(path)) != filepath.Dir(t.TempDir()) {
+			t.Errorf("database at %q, want it in the temporary directory of the test", path)
+		}
+		other, err := sql.Open("sqlite3", path+"?_busy_timeout=0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer other.Close()
+		_, err = other.Exec("INSERT INTO items (name) VALUES ('busy')")
+		if !sqlerr.IsBusy(err) {
+			t.Errorf("insert in the locked database = %v, want SQLITE_BUSY", err)
+		}
+	}, resourcetest.FileBacked())
+}
+
+func TestWithTestDBFailedMigration(t *testing.T) {
+	tb := &recordingTB{TB: t}
+	called := false
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		resourcetest.WithTestDB(tb, []resource.Migration{{Version: 1, Name: "broken", Up: "CREATE TABLE"}}, func(db *sql.DB) {
+			called = true
+		})
+	}()
+	<-done
+	tb.finish()
+	if called {
+		t.Error("fn called after a failed migration")
+	}
+	if len(tb.errors) != 1 {
+		t.Errorf("failures %q, want the migration error", tb.errors)
+	}
+}
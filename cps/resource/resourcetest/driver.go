@@ -0,0 +1,239 @@
+package resourcetest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"sync/atomic"
+)
+
+// DriverCounts is a snapshot of the calls counted by a CountingDriver.
+type DriverCounts struct {
+	Opens      int64 // connections opened
+	Closes     int64 // connections closed
+	Begins     int64
+	Commits    int64
+	Rollbacks  int64
+	Queries    int64
+	Execs      int64
+	Prepares   int64 // statements prepared
+	StmtCloses int64 // statements closed
+}
+
+// Open is how many connections are open: Opens minus Closes.
+func (c DriverCounts) Open() int64 {
+	return c.Opens - c.Closes
+}
+
+// OpenStmts is how many statements are open: Prepares minus StmtCloses.
+func (c DriverCounts) OpenStmts() int64 {
+	return c.Prepares - c.StmtCloses
+}
+
+// CountingDriver delegates to a real driver and counts what database/sql does with it,
+// to check that resources release everything they acquire.
+type CountingDriver struct {
+	driver driver.Driver
+
+	opens, closes, begins, commits, rollbacks, queries, execs, prepares, stmtCloses atomic.Int64
+}
+
+// RegisterCountingDriver registers with sql.Register a CountingDriver wrapping d under name,
+// which must be unique like for any driver: use one per test.
+func RegisterCountingDriver(name string, d driver.Driver) *CountingDriver {
+	counting := &CountingDriver{driver: d}
+	sql.Register(name, counting)
+	return counting
+}
+
+// Counts returns the calls counted so far.
+func (d *CountingDriver) Counts() DriverCounts {
+	return DriverCounts{
+		Opens:      d.opens.Load(),
+		Closes:     d.closes.Load(),
+		Begins:     d.begins.Load(),
+		Commits:    d.commits.Load(),
+		Rollbacks:  d.rollbacks.Load(),
+		Queries:    d.queries.Load(),
+		Execs:      d.execs.Load(),
+		Prepares:   d.prepares.Load(),
+		StmtCloses: d.stmtCloses.Load(),
+	}
+}
+
+func (d *CountingDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	d.opens.Add(1)
+	return &countingConn{conn: conn, d: d}, nil
+}
+
+type countingConn struct {
+	conn driver.Conn
+	d    *CountingDriver
+}
+
+func (c *countingConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *countingConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var stmt driver.Stmt
+	var err error
+	if preparer, ok := c.conn.(driver.ConnPrepareContext); ok {
+		stmt, err = preparer.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.d.prepares.Add(1)
+	return &countingStmt{stmt: stmt, d: c.d}, nil
+}
+
+func (c *countingConn) Close() error {
+	c.d.closes.Add(1)
+	return c.conn.Close()
+}
+
+func (c *countingConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *countingConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	var tx driver.Tx
+	var err error
+	if beginner, ok := c.conn.(driver.ConnBeginTx); ok {
+		tx, err = beginner.BeginTx(ctx, opts)
+	} else {
+		tx, err = c.conn.Begin()
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.d.begins.Add(1)
+	return &countingTx{tx: tx, d: c.d}, nil
+}
+
+func (c *countingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip // database/sql prepares a statement instead
+	}
+	result, err := execer.ExecContext(ctx, query, args)
+	if err != driver.ErrSkip {
+		c.d.execs.Add(1)
+	}
+	return result, err
+}
+
+func (c *countingConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	rows, err := queryer.QueryContext(ctx, query, args)
+	if err != driver.ErrSkip {
+		c.d.queries.Add(1)
+	}
+	return rows, err
+}
+
+func (c *countingConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *countingConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *countingConn) IsValid() bool {
+	if validator, ok := c.conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+func (c *countingConn) CheckNamedValue(value *driver.NamedValue) error {
+	if checker, ok := c.conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(value)
+	}
+	return driver.ErrSkip
+}
+
+type countingTx struct {
+	tx driver.Tx
+	d  *CountingDriver
+}
+
+func (tx *countingTx) Commit() error {
+	tx.d.commits.Add(1)
+	return tx.tx.Commit()
+}
+
+func (tx *countingTx) Rollback() error {
+	tx.d.rollbacks.Add(1)
+	return tx.tx.Rollback()
+}
+
+type countingStmt struct {
+	stmt driver.Stmt
+	d    *CountingDriver
+}
+
+func (s *countingStmt) Close() error {
+	s.d.stmtCloses.Add(1)
+	return s.stmt.Close()
+}
+
+func (s *countingStmt) NumInput() int { return s.stmt.NumInput() }
+
+func (s *countingStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.d.execs.Add(1)
+	return s.stmt.Exec(args)
+}
+
+func (s *countingStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.d.queries.Add(1)
+	return s.stmt.Query(args)
+}
+
+func (s *countingStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	if execer, ok := s.stmt.(driver.StmtExecContext); ok {
+		s.d.execs.Add(1)
+		return execer.ExecContext(ctx, args)
+	}
+	return s.Exec(values(args))
+}
+
+func (s *countingStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	if queryer, ok := s.stmt.(driver.StmtQueryContext); ok {
+		s.d.queries.Add(1)
+		return queryer.QueryContext(ctx, args)
+	}
+	return s.Query(values(args))
+}
+
+func (s *countingStmt) CheckNamedValue(value *driver.NamedValue) error {
+	if checker, ok := s.stmt.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(value)
+	}
+	return driver.ErrSkip
+}
+
+func values(args []driver.NamedValue) []driver.Value {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	return values
+}
@@ -0,0 +1,63 @@
+package resourcetest_test
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource/resourcetest"
+	"github.com/mattn/go-sqlite3"
+)
+
+var countingDrivers atomic.Int64
+
+func TestCountingDriver(t *testing.T) {
+	name := fmt.Sprintf("counting-sqlite3-%d", countingDrivers.Add(1)) // registered once per run
+	d := resourcetest.RegisterCountingDriver(name, &sqlite3.SQLiteDriver{})
+	db, err := sql.Open(name, filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec("CREATE TABLE items (id INTEGER PRIMARY KEY)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.Exec("INSERT INTO items (id) VALUES (1)")
+	tx.Commit()
+	tx, err = db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.Rollback()
+
+	rows, err := db.Query("SELECT id FROM items")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows.Close()
+	stmt, err := db.Prepare("SELECT id FROM items WHERE id = ?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var id int
+	err = errors.Join(stmt.QueryRow(1).Scan(&id), stmt.Close())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	want := resourcetest.DriverCounts{Opens: 1, Closes: 1, Begins: 2, Commits: 1, Rollbacks: 1, Queries: 2, Execs: 2, Prepares: 1, StmtCloses: 1}
+	if got := d.Counts(); got != want || got.Open() != 0 || got.OpenStmts() != 0 {
+		t.Errorf("counts = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,32 @@
+package resourcetest
+
+import (
+	"errors"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+// ErrFake is what a FakeResource fails with, wrapped in a *resource.ResourceError of its phase.
+var ErrFake = errors.New("fake resource failure")
+
+// NoFailure makes FakeResource succeed.
+const NoFailure resource.Phase = -1
+
+// FakeResource gives value to the callback, failing in the failOn phase:
+// with PhaseAcquire the callback isn't called, with PhaseUse and PhaseRelease
+// the callback runs and ErrFake is joined with its error.
+func FakeResource[T any](value T, failOn resource.Phase) resource.Resource[T] {
+	fail := &resource.ResourceError{Phase: failOn, Err: ErrFake}
+	return resource.Resource[T]{
+		Use: func(callback func(value T) error) error {
+			if failOn == resource.PhaseAcquire {
+				return fail
+			}
+			err := callback(value)
+			if failOn == resource.PhaseUse || failOn == resource.PhaseRelease {
+				return errors.Join(err, fail)
+			}
+			return err
+		},
+	}
+}
@@ -0,0 +1,50 @@
+package resourcetest_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+	"github.com/Q69K/using-cps-in-golang/cps/resource/resourcetest"
+)
+
+func TestFakeResource(t *testing.T) {
+	errCallback := errors.New("callback")
+	for _, test := range []struct {
+		name        string
+		failOn      resource.Phase
+		callbackErr error
+		called      bool
+		wantFake    bool
+	}{
+		{"no failure", resourcetest.NoFailure, nil, true, false},
+		{"no failure, callback fails", resourcetest.NoFailure, errCallback, true, false},
+		{"acquire", resource.PhaseAcquire, nil, false, true},
+		{"use", resource.PhaseUse, errCallback, true, true},
+		{"release", resource.PhaseRelease, nil, true, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			called := false
+			err := resourcetest.FakeResource(42, test.failOn).Use(func(v int) error {
+				called = true
+				if v != 42 {
+					t.Errorf("value = %d", v)
+				}
+				return test.callbackErr
+			})
+			if called != test.called {
+				t.Errorf("callback called %v, want %v", called, test.called)
+			}
+			if test.callbackErr != nil && !errors.Is(err, test.callbackErr) {
+				t.Errorf("Use = %v, want the callback error", err)
+			}
+			if errors.Is(err, resourcetest.ErrFake) != test.wantFake {
+				t.Errorf("Use = %v, ErrFake wanted %v", err, test.wantFake)
+			}
+			var resourceErr *resource.ResourceError
+			if test.wantFake && (!errors.As(err, &resourceErr) || resourceErr.Phase != test.failOn) {
+				t.Errorf("Use = %v, want a %v error", err, test.failOn)
+			}
+		})
+	}
+}
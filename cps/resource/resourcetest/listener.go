@@ -0,0 +1,42 @@
+package resourcetest
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+// WithTestListener gives fn a listener on a free port of 127.0.0.1 and its address.
+// The listener is closed when fn returns, and by t.Cleanup if fn never returns.
+func WithTestListener(t testing.TB, fn func(addr string, l net.Listener) error) error {
+	t.Helper()
+	return resource.NewListenerResource("tcp", "127.0.0.1:0").Use(func(l net.Listener) error {
+		t.Cleanup(func() {
+			_ = l.Close()
+		})
+		return fn(l.Addr().String(), l)
+	})
+}
+
+// WithTestServer serves handler on a test listener while fn runs, giving fn the base URL
+// like "http://127.0.0.1:12345". The server is closed before the listener.
+func WithTestServer(t testing.TB, handler http.Handler, fn func(url string) error) error {
+	t.Helper()
+	return WithTestListener(t, func(addr string, l net.Listener) error {
+		server := &http.Server{Handler: handler}
+		served := make(chan error, 1)
+		go func() {
+			served <- server.Serve(l)
+		}()
+
+		err := fn("http://" + addr)
+		closeErr := server.Close()
+		if serveErr := <-served; !errors.Is(serveErr, http.ErrServerClosed) {
+			closeErr = errors.Join(closeErr, serveErr)
+		}
+		return errors.Join(err, closeErr)
+	})
+}
@@ -0,0 +1,66 @@
+package resourcetest_test
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource/resourcetest"
+)
+
+func relisten(t *testing.T, addr string) {
+	t.Helper()
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatalf("port not released: %v", err)
+	}
+	l.Close()
+}
+
+func TestWithTestListener(t *testing.T) {
+	var got string
+	err := resourcetest.WithTestListener(t, func(addr string, l net.Listener) error {
+		if !strings.HasPrefix(addr, "127.0.0.1:") || addr != l.Addr().String() {
+			t.Errorf("listening on %s, address %s", l.Addr(), addr)
+		}
+		got = addr
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	relisten(t, got)
+}
+
+func TestWithTestServer(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello "+r.URL.Path)
+	})
+	var base string
+	err := resourcetest.WithTestServer(t, handler, func(url string) error {
+		base = url
+		resp, err := http.Get(url + "/world")
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if string(body) != "hello /world" {
+			t.Errorf("body = %q", body)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	relisten(t, strings.TrimPrefix(base, "http://"))
+
+	errBoom := errors.New("boom")
+	err = resourcetest.WithTestServer(t, handler, func(string) error { return errBoom })
+	if !errors.Is(err, errBoom) {
+		t.Errorf("WithTestServer = %v, want the error of fn", err)
+	}
+}
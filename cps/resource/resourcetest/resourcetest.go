@@ -0,0 +1,20 @@
+// Package resourcetest helps testing code built on package resource.
+package resourcetest
+
+import (
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+// Check fails the test if some resources are still open when it finishes.
+// Turn on resource.SetDebug to see where they were acquired.
+func Check(t testing.TB) {
+	t.Helper()
+	t.Cleanup(func() {
+		err := resource.VerifyNoneOpen()
+		if err != nil {
+			t.Error(err)
+		}
+	})
+}
@@ -0,0 +1,58 @@
+package resourcetest_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+	"github.com/Q69K/using-cps-in-golang/cps/resource/resourcetest"
+)
+
+// leakFile opens a file in a goroutine holding it until release is called,
+// which waits for the goroutine to be done.
+func leakFile(t *testing.T) (release func()) {
+	t.Helper()
+	held, released, done := make(chan struct{}), make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		resource.NewFileResource(filepath.Join(t.TempDir(), "leaked"), os.O_CREATE|os.O_WRONLY, 0o644).Use(func(*os.File) error {
+			close(held)
+			<-released
+			return nil
+		})
+	}()
+	<-held
+	return func() {
+		close(released)
+		<-done
+	}
+}
+
+func TestCheckFlagsLeak(t *testing.T) {
+	tb := &recordingTB{TB: t}
+	resourcetest.Check(tb)
+	release := leakFile(t)
+	tb.finish()
+	release()
+
+	if len(tb.errors) != 1 || !strings.Contains(tb.errors[0], "1 file") {
+		t.Fatalf("failures %q, want the leaked file", tb.errors)
+	}
+}
+
+func TestCheckPassesReleased(t *testing.T) {
+	tb := &recordingTB{TB: t}
+	resourcetest.Check(tb)
+	err := resource.NewFileResource(filepath.Join(t.TempDir(), "released"), os.O_CREATE|os.O_WRONLY, 0o644).Use(func(*os.File) error {
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tb.finish()
+	if len(tb.errors) != 0 {
+		t.Fatalf("failures %q, want none", tb.errors)
+	}
+}
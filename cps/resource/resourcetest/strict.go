@@ -0,0 +1,25 @@
+package resourcetest
+
+import (
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+// Strict turns on resource.StrictMode until the test finishes, and fails the test
+// for every error the resources report as swallowed, which strict mode can't return.
+// It replaces the warning handler of resource.SetWarningHandler meanwhile:
+// don't use it in parallel tests.
+func Strict(t testing.TB) {
+	t.Helper()
+	resource.StrictMode(true)
+	resource.SetWarningHandler(func(w resource.Warning) {
+		if w.Kind == resource.WarnSwallowedError {
+			t.Errorf("%s: swallowed error: %v", w.Resource, w.Err)
+		}
+	})
+	t.Cleanup(func() {
+		resource.SetWarningHandler(nil)
+		resource.StrictMode(false)
+	})
+}
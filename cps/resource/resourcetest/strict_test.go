@@ -0,0 +1,71 @@
+package resourcetest_test
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+	"github.com/Q69K/using-cps-in-golang/cps/resource/resourcetest"
+)
+
+// unremovableTempFile uses a temporary file which the callback replaces with a directory that isn't empty,
+// so that removing it fails.
+func unremovableTempFile(t *testing.T) error {
+	return resource.NewTempFileResource(t.TempDir(), "strict-*").Use(func(file *os.File) error {
+		err := os.Remove(file.Name())
+		if err == nil {
+			err = os.Mkdir(file.Name(), 0o755)
+		}
+		if err == nil {
+			err = os.WriteFile(filepath.Join(file.Name(), "blocker"), nil, 0o644)
+		}
+		return err
+	})
+}
+
+func TestStrictReturnsSecondaryErrors(t *testing.T) {
+	tb := &recordingTB{TB: t}
+	resourcetest.Strict(tb)
+	if err := unremovableTempFile(t); err == nil {
+		t.Error("Use in strict mode succeeded, want the removal error")
+	}
+	tb.finish()
+	if len(tb.errors) != 0 {
+		t.Errorf("failures %q, want none for a returned error", tb.errors)
+	}
+
+	if err := unremovableTempFile(t); err != nil {
+		t.Errorf("Use after the test = %v, want strict mode off", err)
+	}
+}
+
+func TestStrictFailsOnSwallowedError(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	tb := &recordingTB{TB: t}
+	resourcetest.Strict(tb)
+	// the rollback of the middleware fails, and it has no error to join it with
+	handler := resource.TxMiddleware(db, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tx, _ := resource.TxFromContext(r.Context())
+		_, err := tx.Exec("ROLLBACK")
+		if err != nil {
+			t.Error(err)
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil))
+	tb.finish()
+	if len(tb.errors) != 1 {
+		t.Fatalf("failures %q, want the swallowed rollback error", tb.errors)
+	}
+}
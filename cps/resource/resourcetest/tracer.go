@@ -0,0 +1,50 @@
+package resourcetest
+
+import (
+	"slices"
+	"sync"
+)
+
+// Span is a span recorded by a RecordingTracer.
+type Span struct {
+	Name string
+	// Parent is the index in Spans of the span still open when this one started, -1 for none.
+	Parent int
+	Ended  bool
+	Err    error
+}
+
+// RecordingTracer is a resource.Tracer keeping the spans it starts, to assert which ones
+// were emitted and how they nest. Spans started from several goroutines nest under
+// whichever span is the last one still open.
+type RecordingTracer struct {
+	mu    sync.Mutex
+	spans []Span
+	open  []int
+}
+
+func (tr *RecordingTracer) StartSpan(name string) func(err error) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	parent := -1
+	if len(tr.open) > 0 {
+		parent = tr.open[len(tr.open)-1]
+	}
+	i := len(tr.spans)
+	tr.spans = append(tr.spans, Span{Name: name, Parent: parent})
+	tr.open = append(tr.open, i)
+	return func(err error) {
+		tr.mu.Lock()
+		defer tr.mu.Unlock()
+		tr.spans[i].Ended = true
+		tr.spans[i].Err = err
+		tr.open = slices.DeleteFunc(tr.open, func(j int) bool { return j == i })
+	}
+}
+
+// Spans returns the spans started so far, in the order they were.
+func (tr *RecordingTracer) Spans() []Span {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	return slices.Clone(tr.spans)
+}
@@ -0,0 +1,55 @@
+package resourcetest
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+// FailOnUnchecked turns on resource.DebugUnchecked until the test finishes, and fails the test
+// for every error of a Use the test left unchecked, found by collecting the garbage when it finishes.
+// Like Strict, it replaces the warning handler of resource.SetWarningHandler meanwhile:
+// don't use it in parallel tests, nor together with Strict.
+func FailOnUnchecked(t testing.TB) {
+	t.Helper()
+	var mu sync.Mutex
+	var unchecked []resource.Warning
+	resource.DebugUnchecked(true)
+	resource.SetWarningHandler(func(w resource.Warning) {
+		if w.Kind == resource.WarnUncheckedError {
+			mu.Lock()
+			defer mu.Unlock()
+			unchecked = append(unchecked, w)
+		}
+	})
+	t.Cleanup(func() {
+		collectGarbage()
+		resource.SetWarningHandler(nil)
+		resource.DebugUnchecked(false)
+		mu.Lock()
+		defer mu.Unlock()
+		for _, w := range unchecked {
+			t.Error(w.Err)
+		}
+	})
+}
+
+// collectGarbage runs the garbage collector until the finalizers of the garbage found have run.
+func collectGarbage() {
+	for range 3 {
+		runtime.GC()
+		done := make(chan struct{})
+		sentinel := new([16]byte) // not a tiny allocation, which could be kept alive by its neighbours
+		runtime.SetFinalizer(sentinel, func(*[16]byte) {
+			close(done)
+		})
+		runtime.GC()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package resourcetest_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+	"github.com/Q69K/using-cps-in-golang/cps/resource/resourcetest"
+)
+
+// recordingTB records the failures of a test instead of failing it, and runs its cleanups on finish.
+type recordingTB struct {
+	testing.TB
+	errors   []string
+	cleanups []func()
+}
+
+func (tb *recordingTB) Helper() {}
+
+func (tb *recordingTB) Error(args ...any) {
+	tb.errors = append(tb.errors, fmt.Sprint(args...))
+}
+
+func (tb *recordingTB) Errorf(format string, args ...any) {
+	tb.errors = append(tb.errors, fmt.Sprintf(format, args...))
+}
+
+// Fatal records the failure and stops the goroutine, which must not be the one of the test.
+func (tb *recordingTB) Fatal(args ...any) {
+	tb.Error(args...)
+	runtime.Goexit()
+}
+
+func (tb *recordingTB) Fatalf(format string, args ...any) {
+	tb.Errorf(format, args...)
+	runtime.Goexit()
+}
+
+func (tb *recordingTB) Cleanup(f func()) {
+	tb.cleanups = append(tb.cleanups, f)
+}
+
+func (tb *recordingTB) finish() {
+	for i := len(tb.cleanups) - 1; i >= 0; i-- {
+		tb.cleanups[i]()
+	}
+}
+
+func failingUse(dir string) error {
+	return resource.NewFileResource(filepath.Join(dir, "missing"), os.O_RDONLY, 0).Use(func(*os.File) error {
+		return nil
+	})
+}
+
+func TestFailOnUncheckedFailsIgnoredError(t *testing.T) {
+	tb := &recordingTB{TB: t}
+	resourcetest.FailOnUnchecked(tb)
+	func() {
+		failingUse(t.TempDir()) // ignored on purpose
+	}()
+	tb.finish()
+	if len(tb.errors) != 1 {
+		t.Fatalf("failures %q, want one", tb.errors)
+	}
+}
+
+func TestFailOnUncheckedPassesHandledError(t *testing.T) {
+	tb := &recordingTB{TB: t}
+	resourcetest.FailOnUnchecked(tb)
+	func() {
+		err := failingUse(t.TempDir())
+		if !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Use: %v, want os.ErrNotExist", err)
+		}
+	}()
+	tb.finish()
+	if len(tb.errors) != 0 {
+		t.Fatalf("failures %q, want none", tb.errors)
+	}
+}
@@ -0,0 +1,128 @@
+package resource
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+)
+
+// Checkpoint records how much of a resumable file is durable.
+type Checkpoint struct {
+	// Records is the number of logical records written, as counted by the writer.
+	Records int64 `json:"records"`
+	// Offset is the file size once they were written.
+	Offset int64 `json:"offset"`
+}
+
+// CheckpointPath is the companion checkpoint file of a resumable file.
+func CheckpointPath(path string) string {
+	return path + ".checkpoint"
+}
+
+// ReadCheckpoint reads the last checkpoint of the resumable file at path,
+// the zero Checkpoint when there is none yet.
+func ReadCheckpoint(path string) (Checkpoint, error) {
+	var checkpoint Checkpoint
+	content, err := os.ReadFile(CheckpointPath(path))
+	if errors.Is(err, fs.ErrNotExist) {
+		return checkpoint, nil
+	}
+	if err != nil {
+		return checkpoint, err
+	}
+	err = json.Unmarshal(content, &checkpoint)
+	return checkpoint, err
+}
+
+type resumableOptions struct {
+	truncate int64
+}
+
+// ResumableOption configures NewResumableFileResource.
+type ResumableOption func(options *resumableOptions)
+
+// Truncate cuts the file to toOffset before the callback runs, dropping a torn last record;
+// toOffset is usually the Offset of ReadCheckpoint.
+func Truncate(toOffset int64) ResumableOption {
+	return func(options *resumableOptions) {
+		options.truncate = toOffset
+	}
+}
+
+// ResumableWriter appends to a resumable file.
+type ResumableWriter struct {
+	file       *os.File
+	path       string
+	offset     int64
+	checkpoint Checkpoint
+}
+
+func (w *ResumableWriter) Write(p []byte) (int, error) {
+	n, err := w.file.Write(p)
+	w.offset += int64(n)
+	return n, err
+}
+
+// Offset is the current size of the file.
+func (w *ResumableWriter) Offset() int64 {
+	return w.offset
+}
+
+// Checkpointed returns the last checkpoint, the one found when the file was opened until Checkpoint is called.
+func (w *ResumableWriter) Checkpointed() Checkpoint {
+	return w.checkpoint
+}
+
+// Checkpoint makes everything written so far durable with fsync, then atomically replaces
+// the checkpoint file, recording that records records are complete at the current offset.
+func (w *ResumableWriter) Checkpoint(records int64) error {
+	err := w.file.Sync()
+	if err != nil {
+		return err
+	}
+	checkpoint := Checkpoint{Records: records, Offset: w.offset}
+	err = NewAtomicFileResource(CheckpointPath(w.path), 0600, Sync()).Use(func(fd *os.File) error {
+		return json.NewEncoder(fd).Encode(checkpoint)
+	})
+	if err != nil {
+		return err
+	}
+	w.checkpoint = checkpoint
+	return nil
+}
+
+// NewResumableFileResource opens path for appending, creating it with perm if needed,
+// for jobs which can be interrupted and resumed later.
+//
+// The callback writes its records and calls Checkpoint once some of them are complete;
+// a job restarting after a crash skips the Checkpointed records and truncates
+// what was written after the checkpoint with the Truncate option.
+func NewResumableFileResource(path string, perm os.FileMode, opts ...ResumableOption) Resource[*ResumableWriter] {
+	options := resumableOptions{truncate: -1}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	file := NewFileResource(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, perm)
+	return Resource[*ResumableWriter]{
+		Use: func(callback func(w *ResumableWriter) error) error {
+			return file.Use(func(fd *os.File) error {
+				checkpoint, err := ReadCheckpoint(path)
+				if err != nil {
+					return phaseError(PhaseAcquire, err)
+				}
+				if options.truncate >= 0 {
+					err = fd.Truncate(options.truncate)
+					if err != nil {
+						return phaseError(PhaseAcquire, err)
+					}
+				}
+				info, err := fd.Stat()
+				if err != nil {
+					return phaseError(PhaseAcquire, err)
+				}
+				return callback(&ResumableWriter{file: fd, path: path, offset: info.Size(), checkpoint: checkpoint})
+			})
+		},
+	}
+}
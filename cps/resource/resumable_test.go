@@ -0,0 +1,130 @@
+package resource_test
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+var errCrash = errors.New("crash")
+
+// export writes the records up to total to path, resuming after the last checkpoint and
+// checkpointing each record; at record crashAt it writes half of it and returns errCrash.
+func export(path string, total, crashAt int64) error {
+	checkpoint, err := resource.ReadCheckpoint(path)
+	if err != nil {
+		return err
+	}
+	return resource.NewResumableFileResource(path, 0600, resource.Truncate(checkpoint.Offset)).Use(func(w *resource.ResumableWriter) error {
+		for i := w.Checkpointed().Records; i < total; i++ {
+			if i == crashAt {
+				fmt.Fprintf(w, "reco")
+				return errCrash
+			}
+			_, err := fmt.Fprintf(w, "record %d\n", i)
+			if err != nil {
+				return err
+			}
+			err = w.Checkpoint(i + 1)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func TestResumableFileResumesAfterACrash(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "export.txt")
+
+	for _, crashAt := range []int64{3, 7} {
+		err := export(path, 10, crashAt)
+		if !errors.Is(err, errCrash) {
+			t.Fatalf("export crashing at %d = %v", crashAt, err)
+		}
+		checkpoint, err := resource.ReadCheckpoint(path)
+		if err != nil || checkpoint.Records != crashAt {
+			t.Fatalf("checkpoint after crashing at %d = %+v, %v", crashAt, checkpoint, err)
+		}
+		if content := readFile(t, path); !strings.HasSuffix(content, "reco") {
+			t.Errorf("content after crashing at %d = %q, want a torn last record", crashAt, content)
+		}
+	}
+	err := export(path, 10, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var want []string
+	for i := range 10 {
+		want = append(want, fmt.Sprintf("record %d", i))
+	}
+	content := readFile(t, path)
+	if got := strings.Split(strings.TrimSuffix(content, "\n"), "\n"); !slices.Equal(got, want) {
+		t.Errorf("records = %q, want %q", got, want)
+	}
+	checkpoint, err := resource.ReadCheckpoint(path)
+	if err != nil || checkpoint != (resource.Checkpoint{Records: 10, Offset: int64(len(content))}) {
+		t.Errorf("checkpoint = %+v, %v, want 10 records at %d", checkpoint, err, len(content))
+	}
+	// the checkpoint is replaced atomically, without leaving a temporary file behind
+	if got := dirEntries(t, dir); !slices.Equal(got, []string{"export.txt", "export.txt.checkpoint"}) {
+		t.Errorf("files = %q", got)
+	}
+}
+
+func TestResumableFileOffset(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "export.txt")
+	writeFile(t, path, "0123456789")
+
+	err := resource.NewResumableFileResource(path, 0600).Use(func(w *resource.ResumableWriter) error {
+		if w.Offset() != 10 {
+			t.Errorf("offset when opened = %d, want 10", w.Offset())
+		}
+		if w.Checkpointed() != (resource.Checkpoint{}) {
+			t.Errorf("checkpoint without a checkpoint file = %+v", w.Checkpointed())
+		}
+		_, err := w.Write([]byte("abc"))
+		if w.Offset() != 13 {
+			t.Errorf("offset after writing = %d, want 13", w.Offset())
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = resource.NewResumableFileResource(path, 0600, resource.Truncate(4)).Use(func(w *resource.ResumableWriter) error {
+		if w.Offset() != 4 {
+			t.Errorf("offset when truncated = %d, want 4", w.Offset())
+		}
+		_, err := w.Write([]byte("xyz"))
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, path); got != "0123xyz" {
+		t.Errorf("content = %q, want appended after the truncation", got)
+	}
+}
+
+func TestResumableFileBadCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "export.txt")
+	writeFile(t, resource.CheckpointPath(path), "not json")
+
+	called := false
+	err := resource.NewResumableFileResource(path, 0600).Use(func(w *resource.ResumableWriter) error {
+		called = true
+		return nil
+	})
+	if called || phaseOf(t, err) != resource.PhaseAcquire {
+		t.Errorf("Use with a bad checkpoint = %v, callback called %v", err, called)
+	}
+}
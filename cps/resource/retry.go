@@ -0,0 +1,168 @@
+package resource
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+)
+
+// Sleeper waits between retry attempts; tests can replace it, with a Clock for instance, to avoid real sleeping.
+type Sleeper interface {
+	// Sleep waits for d and returns ctx.Err() as soon as ctx is done.
+	Sleep(ctx context.Context, d time.Duration) error
+}
+
+// RetryPolicy decides how many times and how often a failing operation is retried.
+type RetryPolicy struct {
+	// Attempts is the total number of attempts, the first one included.
+	Attempts int
+	// Delay is the wait after the given failed attempt (starting from 1).
+	Delay func(attempt int) time.Duration
+	// Classify tells whether an error is worth retrying, nil retries every error.
+	Classify func(err error) bool
+	// Sleeper waits between attempts, nil waits for real.
+	Sleeper Sleeper
+}
+
+// FixedDelay retries up to attempts times in total, waiting d between attempts.
+func FixedDelay(d time.Duration, attempts int) RetryPolicy {
+	return RetryPolicy{
+		Attempts: attempts,
+		Delay: func(int) time.Duration {
+			return d
+		},
+	}
+}
+
+// ExponentialBackoff doubles the wait after every attempt starting from base, up to max.
+// jitter (0 to 1) randomly shortens every wait by up to that fraction, so clients don't retry in lockstep.
+func ExponentialBackoff(base, max time.Duration, attempts int, jitter float64) RetryPolicy {
+	return RetryPolicy{
+		Attempts: attempts,
+		Delay: func(attempt int) time.Duration {
+			d := max
+			if shift := attempt - 1; shift < 62 && base<<shift > 0 && base<<shift < max {
+				d = base << shift
+			}
+			if jitter > 0 {
+				d -= time.Duration(float64(d) * jitter * rand.Float64())
+			}
+			return d
+		},
+	}
+}
+
+func (p RetryPolicy) retryable(err error) bool {
+	return p.Classify == nil || p.Classify(err)
+}
+
+func (p RetryPolicy) sleep(ctx context.Context, attempt int) error {
+	if p.Delay == nil {
+		return ctx.Err()
+	}
+	sleeper := p.Sleeper
+	if sleeper == nil {
+		sleeper = RealClock()
+	}
+	return sleeper.Sleep(ctx, p.Delay(attempt))
+}
+
+// Do runs op until it succeeds, fails with an error Classify rejects, or runs out of attempts.
+// A cancelled ctx interrupts the wait between attempts; its error is joined with op's last one.
+func (p RetryPolicy) Do(ctx context.Context, op func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := op()
+		if err == nil || attempt >= p.Attempts || !p.retryable(err) {
+			return err
+		}
+		sleepErr := p.sleep(ctx, attempt)
+		if sleepErr != nil {
+			return errors.Join(err, sleepErr)
+		}
+	}
+}
+
+// WithRetry retries acquiring r according to the policy.
+// Once the callback was called its error is returned as is: the callback is never run twice.
+func WithRetry[T any](ctx context.Context, r Resource[T], policy RetryPolicy) Resource[T] {
+	return Resource[T]{
+		Use: func(callback func(value T) error) error {
+			var called bool
+			var callbackErr error
+			err := policy.Do(ctx, func() error {
+				err := r.Use(func(value T) error {
+					called = true
+					return callback(value)
+				})
+				if called {
+					// stop retrying, but remember the error
+					callbackErr = err
+					return nil
+				}
+				return err
+			})
+			if called {
+				return callbackErr
+			}
+			return err
+		},
+	}
+}
+
+// UseRetry runs cb with a value of r, and when cb fails with an error classify accepts
+// (every error when nil), releases the value and runs cb again with a fresh one,
+// as many times as the policy allows. Unlike WithRetry it retries the callback: cb must be idempotent.
+// Acquire and release failures are not retried, wrap r with WithRetry for that.
+//
+// On final failure the errors of all the attempts are joined, numbered by attempt.
+// policy.Classify is not used.
+func UseRetry[T any](r Resource[T], policy RetryPolicy, classify func(err error) bool, cb func(value T) error) error {
+	var errs []error
+	for attempt := 1; ; attempt++ {
+		var cbErr error
+		err := r.Use(func(value T) error {
+			cbErr = cb(value)
+			return cbErr
+		})
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("attempt %d: %w", attempt, err))
+		if cbErr == nil || attempt >= policy.Attempts || classify != nil && !classify(cbErr) {
+			return errors.Join(errs...)
+		}
+		err = policy.sleep(context.Background(), attempt)
+		if err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+	}
+}
+
+// RunTransactionRetry is RunTransaction which runs the whole transaction again
+// when it fails with an error the policy retries, like a serialization failure or a busy database
+// (sqlerr.IsBusy as policy.Classify).
+// The callback must be idempotent: it may run several times. WithIdempotencyKey makes it so
+// for the transactions which committed: an *AlreadyAppliedError is returned without retrying.
+func RunTransactionRetry(ctx context.Context, db *sql.DB, policy RetryPolicy, opts ...TxOption) TxResource {
+	tx := RunTransaction(db, opts...)
+	return TxResource{
+		Use: func(callback func(tx *sql.Tx) error) error {
+			var applied error
+			err := policy.Do(ctx, func() error {
+				err := tx.Use(callback)
+				if errors.Is(err, ErrAlreadyApplied) {
+					applied = err
+					return nil
+				}
+				return err
+			})
+			if applied != nil {
+				return applied
+			}
+			return err
+		},
+	}
+}
@@ -0,0 +1,282 @@
+package resource_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+	"github.com/Q69K/using-cps-in-golang/cps/resource/resourcetest"
+)
+
+// advancingSleeper sleeps by advancing its fake clock, recording the delays.
+type advancingSleeper struct {
+	clock  *resourcetest.FakeClock
+	delays []time.Duration
+}
+
+func (s *advancingSleeper) Sleep(ctx context.Context, d time.Duration) error {
+	s.delays = append(s.delays, d)
+	s.clock.Advance(d)
+	return ctx.Err()
+}
+
+// failing is an operation failing with err until its call number succeedAt (never when 0),
+// recording the times of the calls on clock.
+func failing(clock *resourcetest.FakeClock, err error, succeedAt int, calls *[]time.Duration) func() error {
+	return func() error {
+		*calls = append(*calls, clock.Now().Sub(epoch))
+		if len(*calls) == succeedAt {
+			return nil
+		}
+		return err
+	}
+}
+
+func TestRetryPolicyDelays(t *testing.T) {
+	ms := time.Millisecond
+	tests := []struct {
+		name   string
+		policy resource.RetryPolicy
+		delays []time.Duration
+	}{
+		{"fixed", resource.FixedDelay(10*ms, 4), []time.Duration{10 * ms, 10 * ms, 10 * ms}},
+		{"exponential", resource.ExponentialBackoff(10*ms, 50*ms, 6, 0), []time.Duration{10 * ms, 20 * ms, 40 * ms, 50 * ms, 50 * ms}},
+		{"one attempt", resource.FixedDelay(10*ms, 1), nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sleeper := &advancingSleeper{clock: newFakeClock()}
+			test.policy.Sleeper = sleeper
+			errBusy := errors.New("busy")
+			var calls []time.Duration
+			err := test.policy.Do(context.Background(), failing(sleeper.clock, errBusy, 0, &calls))
+			if err != errBusy {
+				t.Errorf("Do = %v, want the last error", err)
+			}
+			if !slices.Equal(sleeper.delays, test.delays) {
+				t.Errorf("delays = %v, want %v", sleeper.delays, test.delays)
+			}
+			want := []time.Duration{0}
+			for _, d := range test.delays {
+				want = append(want, want[len(want)-1]+d)
+			}
+			if !slices.Equal(calls, want) {
+				t.Errorf("attempts at %v, want %v", calls, want)
+			}
+		})
+	}
+}
+
+func TestExponentialBackoffJitter(t *testing.T) {
+	policy := resource.ExponentialBackoff(100*time.Millisecond, time.Second, 10, 0.5)
+	for attempt := 1; attempt < 10; attempt++ {
+		full := min(100*time.Millisecond<<(attempt-1), time.Second)
+		for range 20 {
+			if d := policy.Delay(attempt); d < full/2 || d > full {
+				t.Fatalf("delay %v after attempt %d, want between %v and %v", d, attempt, full/2, full)
+			}
+		}
+	}
+	huge := resource.ExponentialBackoff(time.Second, time.Hour, 100, 0)
+	if d := huge.Delay(99); d != time.Hour {
+		t.Errorf("delay after attempt 99 = %v, want the max", d)
+	}
+}
+
+func TestRetryPolicyStops(t *testing.T) {
+	errPermanent, errBusy := errors.New("permanent"), errors.New("busy")
+	sleeper := &advancingSleeper{clock: newFakeClock()}
+	policy := resource.FixedDelay(time.Second, 5)
+	policy.Sleeper = sleeper
+	policy.Classify = func(err error) bool { return err == errBusy }
+
+	var calls []time.Duration
+	err := policy.Do(context.Background(), failing(sleeper.clock, errPermanent, 0, &calls))
+	if err != errPermanent || len(calls) != 1 || len(sleeper.delays) != 0 {
+		t.Errorf("Do = %v after %d attempts, want a non-retryable error to exit on the first", err, len(calls))
+	}
+
+	calls = nil
+	err = policy.Do(context.Background(), failing(sleeper.clock, errBusy, 3, &calls))
+	if err != nil || len(calls) != 3 {
+		t.Errorf("Do = %v after %d attempts, want success on the third", err, len(calls))
+	}
+}
+
+func TestRetryPolicyCancelInterruptsWait(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	errBusy := errors.New("busy")
+	policy := resource.FixedDelay(time.Hour, 3) // real sleeps
+	started := time.Now()
+	err := policy.Do(ctx, func() error {
+		time.AfterFunc(10*time.Millisecond, cancel)
+		return errBusy
+	})
+	if !errors.Is(err, errBusy) || !errors.Is(err, context.Canceled) {
+		t.Errorf("Do = %v, want the error joined with the cancellation", err)
+	}
+	if elapsed := time.Since(started); elapsed > 10*time.Second {
+		t.Errorf("cancelled wait took %v", elapsed)
+	}
+}
+
+func TestWithRetryRetriesAcquisitionOnly(t *testing.T) {
+	errDown, errCallback := errors.New("down"), errors.New("callback")
+	acquisitions := 0
+	r := resource.Resource[string]{
+		Use: func(callback func(string) error) error {
+			acquisitions++
+			if acquisitions < 3 {
+				return errDown
+			}
+			return callback("value")
+		},
+	}
+	policy := resource.FixedDelay(time.Second, 5)
+	policy.Sleeper = &advancingSleeper{clock: newFakeClock()}
+
+	calls := 0
+	err := resource.WithRetry(context.Background(), r, policy).Use(func(v string) error {
+		calls++
+		return errCallback
+	})
+	if err != errCallback || acquisitions != 3 || calls != 1 {
+		t.Errorf("Use = %v after %d acquisitions and %d calls, want the callback error after 3 and 1", err, acquisitions, calls)
+	}
+}
+
+func TestUseRetryJoinsAttempts(t *testing.T) {
+	errBusy := errors.New("busy")
+	policy := resource.FixedDelay(time.Second, 3)
+	policy.Sleeper = &advancingSleeper{clock: newFakeClock()}
+	values := 0
+	r := resource.Resource[int]{
+		Use: func(callback func(int) error) error {
+			values++
+			return callback(values)
+		},
+	}
+
+	var got []int
+	err := resource.UseRetry(r, policy, nil, func(v int) error {
+		got = append(got, v)
+		return errBusy
+	})
+	if !slices.Equal(got, []int{1, 2, 3}) {
+		t.Errorf("callback got %v, want a fresh value every attempt", got)
+	}
+	if !errors.Is(err, errBusy) || !strings.Contains(err.Error(), "attempt 3: busy") {
+		t.Errorf("UseRetry = %v", err)
+	}
+}
+
+func TestRunTransactionRetry(t *testing.T) {
+	db := openDB(t)
+	errBusy := errors.New("busy")
+	policy := resource.FixedDelay(time.Second, 5)
+	policy.Sleeper = &advancingSleeper{clock: newFakeClock()}
+	policy.Classify = func(err error) bool { return errors.Is(err, errBusy) }
+
+	attempts := 0
+	err := resource.RunTransactionRetry(context.Background(), db, policy).Use(func(tx *sql.Tx) error {
+		attempts++
+		err := insertItem(tx, "a")
+		if err == nil && attempts < 3 {
+			err = errBusy // rolls the insert back
+		}
+		return err
+	})
+	if err != nil || attempts != 3 {
+		t.Errorf("Use = %v after %d attempts, want success on the third", err, attempts)
+	}
+	if n := countItems(t, db); n != 1 {
+		t.Errorf("%d rows committed, want 1", n)
+	}
+}
+
+func TestUseRetryReopensUntilTheCallbackSucceeds(t *testing.T) {
+	errStale := errors.New("stale handle")
+	policy := resource.FixedDelay(time.Second, 5)
+	policy.Sleeper = &advancingSleeper{clock: newFakeClock()}
+	var events []string
+	handles := 0
+	r := resource.Resource[int]{
+		Use: func(callback func(int) error) error {
+			handles++
+			handle := handles
+			events = append(events, fmt.Sprintf("open %d", handle))
+			defer func() {
+				events = append(events, fmt.Sprintf("close %d", handle))
+			}()
+			return callback(handle)
+		},
+	}
+
+	runs := 0
+	err := resource.UseRetry(r, policy, func(err error) bool {
+		return errors.Is(err, errStale)
+	}, func(handle int) error {
+		runs++
+		events = append(events, fmt.Sprintf("run %d", handle))
+		if runs <= 2 {
+			return errStale
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"open 1", "run 1", "close 1", "open 2", "run 2", "close 2", "open 3", "run 3", "close 3"}
+	if !slices.Equal(events, want) {
+		t.Errorf("events = %q, want %q", events, want)
+	}
+}
+
+func TestUseRetryStops(t *testing.T) {
+	errStale := errors.New("stale handle")
+	errPermanent := errors.New("permanent")
+	isStale := func(err error) bool {
+		return errors.Is(err, errStale)
+	}
+	policy := resource.FixedDelay(time.Second, 5)
+	policy.Sleeper = &advancingSleeper{clock: newFakeClock()}
+
+	runs := 0
+	err := resource.UseRetry(resourcetest.FakeResource(1, resourcetest.NoFailure), policy, isStale, func(int) error {
+		runs++
+		if runs == 1 {
+			return errStale
+		}
+		return errPermanent
+	})
+	if runs != 2 || !errors.Is(err, errStale) || !errors.Is(err, errPermanent) {
+		t.Errorf("UseRetry with a permanent error = %v after %d runs, want both attempts", err, runs)
+	}
+	if !strings.Contains(err.Error(), "attempt 1: stale handle") || !strings.Contains(err.Error(), "attempt 2: permanent") {
+		t.Errorf("UseRetry = %q, want the errors numbered by attempt", err)
+	}
+
+	runs = 0
+	err = resource.UseRetry(resourcetest.FakeResource(1, resource.PhaseAcquire), policy, nil, func(int) error {
+		runs++
+		return nil
+	})
+	if runs != 0 || !errors.Is(err, resourcetest.ErrFake) || strings.Contains(err.Error(), "attempt 2") {
+		t.Errorf("UseRetry failing to acquire = %v after %d runs, want one attempt", err, runs)
+	}
+
+	runs = 0
+	err = resource.UseRetry(resourcetest.FakeResource(1, resource.PhaseRelease), policy, nil, func(int) error {
+		runs++
+		return nil
+	})
+	if runs != 1 || phaseOf(t, err) != resource.PhaseRelease {
+		t.Errorf("UseRetry failing to release = %v after %d runs, want one attempt", err, runs)
+	}
+}
@@ -0,0 +1,114 @@
+package resource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/Q69K/using-cps-in-golang/cps/group"
+)
+
+// ErrTasksFailed is the error of RetryingGroup.Wait when some tasks failed all their attempts.
+var ErrTasksFailed = errors.New("tasks failed")
+
+// FailedTask is a task of a RetryingGroup which failed all its attempts, kept so it can be run again later.
+type FailedTask struct {
+	Name string
+	// Attempts is how many times the task ran, 0 when the group was cancelled before it started.
+	Attempts int
+	LastErr  error
+	Task     func() error
+}
+
+// RetryingGroup runs named tasks with a bounded number of workers, retrying the failing ones,
+// and collects those which failed every attempt instead of only joining their errors.
+type RetryingGroup struct {
+	spawner group.SafeWaitGroup
+	policy  RetryPolicy
+	ctx     context.Context
+	cancel  context.CancelCauseFunc
+
+	mu      sync.Mutex
+	tasks   int
+	retried int
+	failed  []FailedTask
+}
+
+// NewRetryingGroup creates a group running up to workers tasks at a time, each up to attempts times
+// in total, waiting between the attempts and classifying the errors like policy does
+// (whose Attempts is replaced). A task waiting for its next attempt holds its worker.
+func NewRetryingGroup(workers int, attempts int, policy RetryPolicy) *RetryingGroup {
+	policy.Attempts = attempts
+	ctx, cancel := context.WithCancelCause(context.Background())
+	return &RetryingGroup{
+		spawner: group.NewBoundedSpawner(max(workers, 1)),
+		policy:  policy,
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// Run runs task in the group, retrying it on failure.
+// Like the Run of group.NewBoundedSpawner, it blocks while all the workers are busy.
+func (g *RetryingGroup) Run(name string, task func() error) {
+	g.mu.Lock()
+	g.tasks++
+	g.mu.Unlock()
+
+	g.spawner.Run(func() {
+		if g.ctx.Err() != nil {
+			g.fail(FailedTask{Name: name, LastErr: context.Cause(g.ctx), Task: task})
+			return
+		}
+		attempts := 0
+		err := g.policy.Do(g.ctx, func() error {
+			attempts++
+			return task()
+		})
+		if attempts > 1 {
+			g.mu.Lock()
+			g.retried++
+			g.mu.Unlock()
+		}
+		if err != nil {
+			g.fail(FailedTask{Name: name, Attempts: attempts, LastErr: err, Task: task})
+		}
+	})
+}
+
+func (g *RetryingGroup) fail(task FailedTask) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.failed = append(g.failed, task)
+}
+
+// Context is done once the group is cancelled, for the tasks to stop early.
+func (g *RetryingGroup) Context() context.Context {
+	return g.ctx
+}
+
+// Cancel stops the tasks not started yet, which become failed tasks with cause (context.Canceled when nil)
+// as LastErr, and the retries waiting for their next attempt, failed with context.Canceled joined
+// to their last error. Running attempts aren't interrupted unless they watch Context.
+func (g *RetryingGroup) Cancel(cause error) {
+	g.cancel(cause)
+}
+
+// Wait waits for the tasks, and returns an ErrTasksFailed error counting them when some failed.
+func (g *RetryingGroup) Wait() error {
+	g.spawner.Wait()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if len(g.failed) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %d of %d tasks, %d retried", ErrTasksFailed, len(g.failed), g.tasks, g.retried)
+}
+
+// Failed returns the tasks which failed, in the order they did; call it after Wait.
+func (g *RetryingGroup) Failed() []FailedTask {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]FailedTask(nil), g.failed...)
+}
@@ -0,0 +1,147 @@
+package resource_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+var (
+	errPermanent = errors.New("permanent")
+	errTransient = errors.New("transient")
+)
+
+func TestRetryingGroupDeadLetters(t *testing.T) {
+	g := resource.NewRetryingGroup(3, 3, resource.FixedDelay(0, 0))
+	var mu sync.Mutex
+	attempts := map[string]int{}
+	var wantFailed []string
+	for i := range 10 {
+		name := fmt.Sprint("task ", i)
+		if i%3 == 0 {
+			wantFailed = append(wantFailed, name)
+		}
+		g.Run(name, func() error {
+			mu.Lock()
+			attempts[name]++
+			attempt := attempts[name]
+			mu.Unlock()
+			switch {
+			case i%3 == 0:
+				return errPermanent
+			case i%3 == 1 && attempt == 1:
+				return errTransient
+			}
+			return nil
+		})
+	}
+	err := g.Wait()
+	if !errors.Is(err, resource.ErrTasksFailed) || err.Error() != "tasks failed: 4 of 10 tasks, 7 retried" {
+		t.Errorf("Wait = %v, want the 4 permanent failures counted", err)
+	}
+
+	failed := g.Failed()
+	var names []string
+	for _, task := range failed {
+		names = append(names, task.Name)
+		if task.Attempts != 3 || !errors.Is(task.LastErr, errPermanent) {
+			t.Errorf("failed task %+v, want 3 attempts ending with the permanent error", task)
+		}
+	}
+	sort.Strings(names)
+	if !slices.Equal(names, wantFailed) {
+		t.Errorf("failed tasks = %q, want %q", names, wantFailed)
+	}
+	for i := range 10 {
+		name := fmt.Sprint("task ", i)
+		if want := []int{3, 2, 1}[i%3]; attempts[name] != want {
+			t.Errorf("%s ran %d times, want %d", name, attempts[name], want)
+		}
+	}
+
+	// a dead letter can be run again
+	if err := failed[0].Task(); !errors.Is(err, errPermanent) {
+		t.Errorf("Task of the dead letter = %v", err)
+	}
+}
+
+func TestRetryingGroupClassifiesAndBounds(t *testing.T) {
+	policy := resource.FixedDelay(0, 0)
+	policy.Classify = func(err error) bool { return errors.Is(err, errTransient) }
+	const workers = 2
+	g := resource.NewRetryingGroup(workers, 5, policy)
+	var running, highWater atomic.Int64
+	var permanentRuns atomic.Int64
+	for i := range 20 {
+		g.Run(fmt.Sprint(i), func() error {
+			n := running.Add(1)
+			defer running.Add(-1)
+			for {
+				high := highWater.Load()
+				if n <= high || highWater.CompareAndSwap(high, n) {
+					break
+				}
+			}
+			time.Sleep(100 * time.Microsecond)
+			if i == 0 {
+				permanentRuns.Add(1)
+				return errPermanent
+			}
+			return nil
+		})
+	}
+	if err := g.Wait(); !errors.Is(err, resource.ErrTasksFailed) {
+		t.Errorf("Wait = %v", err)
+	}
+	if failed := g.Failed(); len(failed) != 1 || failed[0].Attempts != 1 || permanentRuns.Load() != 1 {
+		t.Errorf("failed = %+v, want the permanent error not retried", failed)
+	}
+	if high := highWater.Load(); high > workers {
+		t.Errorf("%d tasks ran at once, want at most %d", high, workers)
+	}
+}
+
+func TestRetryingGroupCancelMidRetry(t *testing.T) {
+	errShutdown := errors.New("shutdown")
+	g := resource.NewRetryingGroup(1, 3, resource.FixedDelay(time.Hour, 0))
+	var attempts atomic.Int64
+	g.Run("flaky", func() error {
+		attempts.Add(1)
+		return errTransient
+	})
+	eventually(t, func() bool { return attempts.Load() == 1 })
+
+	// interrupts the wait for the second attempt
+	g.Cancel(errShutdown)
+	g.Run("queued", func() error {
+		t.Error("a task ran after the cancellation")
+		return nil
+	})
+	err := g.Wait()
+	if !errors.Is(err, resource.ErrTasksFailed) {
+		t.Fatalf("Wait = %v", err)
+	}
+	if g.Context().Err() == nil {
+		t.Error("Context not done after Cancel")
+	}
+
+	failed := g.Failed()
+	if len(failed) != 2 {
+		t.Fatalf("failed = %+v, want both tasks", failed)
+	}
+	flaky, queued := failed[0], failed[1]
+	if flaky.Name != "flaky" || flaky.Attempts != 1 || !errors.Is(flaky.LastErr, errTransient) || !errors.Is(flaky.LastErr, context.Canceled) {
+		t.Errorf("flaky = %+v, want its first error joined with the cancellation", flaky)
+	}
+	if queued.Name != "queued" || queued.Attempts != 0 || !errors.Is(queued.LastErr, errShutdown) {
+		t.Errorf("queued = %+v, want it never started, failed with the cause", queued)
+	}
+}
@@ -0,0 +1,180 @@
+package resource
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"iter"
+)
+
+// ErrRowLimitExceeded matches every *RowLimitError with errors.Is.
+var ErrRowLimitExceeded = errors.New("row limit exceeded")
+
+// RowLimitError is returned once a query yields more rows than MaxRows allows,
+// and passed to the WarnRows hook.
+type RowLimitError struct {
+	Limit int64
+	Query string // shortened to one line, like in the descriptions of QueryRows
+}
+
+func (e *RowLimitError) Error() string {
+	return fmt.Sprintf("%v: more than %d rows for %q", ErrRowLimitExceeded, e.Limit, e.Query)
+}
+
+func (e *RowLimitError) Is(target error) bool {
+	return target == ErrRowLimitExceeded
+}
+
+type rowsOptions struct {
+	max     int64
+	limited bool
+	warnAt  int64
+	warn    func(err *RowLimitError)
+}
+
+// RowsOption configures ForEachRow, QueryAll, RowsWith and StreamRows.
+type RowsOption func(options *rowsOptions)
+
+// MaxRows fails the query with a *RowLimitError at its row n+1, against runaway queries
+// like a forgotten WHERE clause. The rows are closed and the rows already handled stay handled.
+func MaxRows(n int64) RowsOption {
+	return func(options *rowsOptions) {
+		options.max = n
+		options.limited = true
+	}
+}
+
+// WarnRows calls hook once, at the row n+1 of the query, and goes on.
+func WarnRows(n int64, hook func(err *RowLimitError)) RowsOption {
+	return func(options *rowsOptions) {
+		options.warnAt = n
+		options.warn = hook
+	}
+}
+
+func newRowsOptions(opts []RowsOption) *rowsOptions {
+	options := &rowsOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
+}
+
+// rowCounter counts the rows of a query against its options.
+type rowCounter struct {
+	options *rowsOptions
+	query   string
+	n       int64
+}
+
+func (options *rowsOptions) counter(query string) *rowCounter {
+	return &rowCounter{options: options, query: query}
+}
+
+// next counts a row, failing when it's over the limit.
+func (c *rowCounter) next() error {
+	c.n++
+	if c.options.limited && c.n > c.options.max {
+		return &RowLimitError{Limit: c.options.max, Query: truncateQuery(c.query)}
+	}
+	if c.options.warn != nil && c.n == c.options.warnAt+1 {
+		c.options.warn(&RowLimitError{Limit: c.options.warnAt, Query: truncateQuery(c.query)})
+	}
+	return nil
+}
+
+// ForEachRow runs the query with q and calls fn for every row decoded with decode.
+// A decode or fn error stops the iteration; the rows are closed and rows.Err() checked like in QueryRows.
+func ForEachRow[T any](q Queryer, query string, args []any, decode RowDecoder[T], fn func(item T) error, opts ...RowsOption) error {
+	options := newRowsOptions(opts)
+	return QueryRows(q, query, args...).Use(func(rows *sql.Rows) error {
+		counter := options.counter(query)
+		for rows.Next() {
+			err := counter.next()
+			if err != nil {
+				return err
+			}
+			item, err := decode(rows.Scan)
+			if err != nil {
+				return err
+			}
+			err = fn(item)
+			if err != nil {
+				return err
+			}
+		}
+		return rows.Err()
+	})
+}
+
+// QueryAll runs the query with q and returns all its rows decoded with decode.
+func QueryAll[T any](q Queryer, query string, args []any, decode RowDecoder[T], opts ...RowsOption) ([]T, error) {
+	var items []T
+	err := ForEachRow(q, query, args, decode, func(item T) error {
+		items = append(items, item)
+		return nil
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// RowsWith is Rows with options; a *RowLimitError of MaxRows is yielded as the last element.
+func RowsWith[T any](q Queryer, query string, args []any, opts ...RowsOption) iter.Seq2[T, error] {
+	options := newRowsOptions(opts)
+	return func(yield func(T, error) bool) {
+		err := QueryRows(q, query, args...).Use(func(rows *sql.Rows) error {
+			scanner, err := newRowScanner[T](rows)
+			if err != nil {
+				return err
+			}
+			counter := options.counter(query)
+			for rows.Next() {
+				err := counter.next()
+				if err != nil {
+					return err
+				}
+				value, err := scanner.scan(rows)
+				if err != nil {
+					return err
+				}
+				if !yield(value, nil) {
+					return errStopRows
+				}
+			}
+			return rows.Err()
+		})
+		if err != nil && !errors.Is(err, errStopRows) {
+			var zero T
+			yield(zero, err)
+		}
+	}
+}
+
+// StreamRows runs the query with q in a goroutine and sends its rows decoded with decode
+// to the returned channel, closed at the end of the rows. The error of the query, if any,
+// is sent to the error channel, which is closed once the rows are.
+//
+// The output must be read until it is closed, or ctx cancelled, for the rows to be closed.
+func StreamRows[T any](ctx context.Context, q Queryer, query string, args []any, decode RowDecoder[T], opts ...RowsOption) (<-chan T, <-chan error) {
+	out := make(chan T)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(errc)
+		defer close(out)
+		err := ForEachRow(q, query, args, decode, func(item T) error {
+			select {
+			case out <- item:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}, opts...)
+		if err != nil {
+			errc <- err
+		}
+	}()
+	return out, errc
+}
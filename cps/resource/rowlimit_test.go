@@ -0,0 +1,130 @@
+package resource_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+const namesQuery = "SELECT name FROM items ORDER BY id"
+
+var fiveNames = []string{"a", "b", "c", "d", "e"}
+
+// checkRowLimit checks err is the *RowLimitError of MaxRows(4) in namesQuery, and the rows of db were closed.
+func checkRowLimit(t *testing.T, db *sql.DB, err error) {
+	t.Helper()
+	var limitErr *resource.RowLimitError
+	if !errors.As(err, &limitErr) || !errors.Is(err, resource.ErrRowLimitExceeded) {
+		t.Fatalf("got %v, want a *RowLimitError", err)
+	}
+	if limitErr.Limit != 4 || limitErr.Query != namesQuery {
+		t.Errorf("error = %+v", limitErr)
+	}
+	if got, want := limitErr.Error(), `row limit exceeded: more than 4 rows for "SELECT name FROM items ORDER BY id"`; got != want {
+		t.Errorf("Error = %q, want %q", got, want)
+	}
+	if inUse := db.Stats().InUse; inUse != 0 {
+		t.Errorf("%d connections in use, want the rows closed", inUse)
+	}
+}
+
+func TestMaxRowsAtTheLimit(t *testing.T) {
+	db := itemsNamed(t, fiveNames...)
+	names, err := resource.QueryAll(db, namesQuery, nil, decodeName, resource.MaxRows(5))
+	if err != nil || !slices.Equal(names, fiveNames) {
+		t.Errorf("QueryAll with MaxRows(5) = %q, %v, want all 5 rows", names, err)
+	}
+
+	var iterated []string
+	for name, err := range resource.RowsWith[string](db, namesQuery, nil, resource.MaxRows(5)) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		iterated = append(iterated, name)
+	}
+	if !slices.Equal(iterated, fiveNames) {
+		t.Errorf("RowsWith with MaxRows(5) = %q", iterated)
+	}
+}
+
+func TestMaxRowsExceeded(t *testing.T) {
+	db := itemsNamed(t, fiveNames...)
+
+	t.Run("ForEachRow", func(t *testing.T) {
+		var handled []string
+		err := resource.ForEachRow(db, namesQuery, nil, decodeName, func(name string) error {
+			handled = append(handled, name)
+			return nil
+		}, resource.MaxRows(4))
+		checkRowLimit(t, db, err)
+		if !slices.Equal(handled, fiveNames[:4]) {
+			t.Errorf("handled %q, want the first 4 rows", handled)
+		}
+	})
+
+	t.Run("QueryAll", func(t *testing.T) {
+		names, err := resource.QueryAll(db, namesQuery, nil, decodeName, resource.MaxRows(4))
+		checkRowLimit(t, db, err)
+		if names != nil {
+			t.Errorf("QueryAll = %q, want no rows with the error", names)
+		}
+	})
+
+	t.Run("RowsWith", func(t *testing.T) {
+		var names []string
+		var last error
+		for name, err := range resource.RowsWith[string](db, namesQuery, nil, resource.MaxRows(4)) {
+			if err != nil {
+				last = err
+				continue
+			}
+			names = append(names, name)
+		}
+		checkRowLimit(t, db, last)
+		if !slices.Equal(names, fiveNames[:4]) {
+			t.Errorf("iterated %q, want the first 4 rows", names)
+		}
+	})
+
+	t.Run("StreamRows", func(t *testing.T) {
+		out, errc := resource.StreamRows(context.Background(), db, namesQuery, nil, decodeName, resource.MaxRows(4))
+		var names []string
+		for name := range out {
+			names = append(names, name)
+		}
+		checkRowLimit(t, db, <-errc)
+		if !slices.Equal(names, fiveNames[:4]) {
+			t.Errorf("received %q, want the first 4 rows", names)
+		}
+	})
+
+	t.Run("ForEachBatch", func(t *testing.T) {
+		var batches [][]string
+		err := resource.ForEachBatch(db, namesQuery, nil, 2, decodeName, func(batch []string) error {
+			batches = append(batches, batch)
+			return nil
+		}, resource.BatchRowsOptions(resource.MaxRows(4)))
+		checkRowLimit(t, db, err)
+		if len(batches) != 2 {
+			t.Errorf("batches = %q, want the 2 full ones before the limit", batches)
+		}
+	})
+}
+
+func TestWarnRows(t *testing.T) {
+	db := itemsNamed(t, fiveNames...)
+	var warnings []*resource.RowLimitError
+	names, err := resource.QueryAll(db, namesQuery, nil, decodeName, resource.WarnRows(3, func(err *resource.RowLimitError) {
+		warnings = append(warnings, err)
+	}))
+	if err != nil || !slices.Equal(names, fiveNames) {
+		t.Errorf("QueryAll = %q, %v, want all the rows", names, err)
+	}
+	if len(warnings) != 1 || warnings[0].Limit != 3 || warnings[0].Query != namesQuery {
+		t.Errorf("hook called with %v, want once for the limit of 3", warnings)
+	}
+}
@@ -0,0 +1,73 @@
+package resource
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+var scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+
+// rowScanner scans rows into T: a struct gets the columns into its `db` tagged fields
+// (matched by name like InsertStruct does), any other type gets the only column.
+type rowScanner[T any] struct {
+	fields [][]int // field index path per column, nil to scan into T itself
+}
+
+func newRowScanner[T any](rows *sql.Rows) (*rowScanner[T], error) {
+	rt := reflect.TypeOf((*T)(nil)).Elem()
+	if rt.Kind() != reflect.Struct || rt == timeType || reflect.PointerTo(rt).Implements(scannerType) {
+		return &rowScanner[T]{}, nil
+	}
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string][]int)
+	collectFieldIndexes(byName, rt, nil)
+
+	fields := make([][]int, len(columns))
+	for i, column := range columns {
+		index, ok := byName[column]
+		if !ok {
+			return nil, fmt.Errorf("scan: column %q has no db tagged field in %s", column, rt)
+		}
+		fields[i] = index
+	}
+	return &rowScanner[T]{fields: fields}, nil
+}
+
+func collectFieldIndexes(byName map[string][]int, rt reflect.Type, parent []int) {
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		index := append(append([]int(nil), parent...), i)
+		tag, tagged := field.Tag.Lookup("db")
+		if !tagged && field.Anonymous && field.Type.Kind() == reflect.Struct {
+			collectFieldIndexes(byName, field.Type, index)
+			continue
+		}
+		if !tagged || tag == "-" || !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		byName[name] = index
+	}
+}
+
+func (s *rowScanner[T]) scan(rows *sql.Rows) (T, error) {
+	var value T
+	if s.fields == nil {
+		err := rows.Scan(&value)
+		return value, err
+	}
+
+	rv := reflect.ValueOf(&value).Elem()
+	dest := make([]any, len(s.fields))
+	for i, index := range s.fields {
+		dest[i] = rv.FieldByIndex(index).Addr().Interface()
+	}
+	err := rows.Scan(dest...)
+	return value, err
+}
@@ -0,0 +1,70 @@
+package resource
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ErrOutOfRange matches every *RangeError with errors.Is.
+var ErrOutOfRange = errors.New("section out of range")
+
+// RangeError is returned when a section doesn't fit within its file.
+type RangeError struct {
+	Path    string
+	Section Section
+	Size    int64
+}
+
+func (e *RangeError) Error() string {
+	return fmt.Sprintf("%v: %s: %d bytes at offset %d, file size %d",
+		ErrOutOfRange, e.Path, e.Section.Length, e.Section.Offset, e.Size)
+}
+
+func (e *RangeError) Is(target error) bool {
+	return target == ErrOutOfRange
+}
+
+// Section is a byte range of a file.
+type Section struct {
+	Offset int64
+	Length int64
+}
+
+// NewSectionResource opens path read-only and gives the callback the n bytes at off,
+// read directly from the file with ReadAt, so reading a section doesn't move other readers.
+// A section not fitting within the file fails the acquisition with a *RangeError;
+// an empty section right at the end is fine.
+func NewSectionResource(path string, off, n int64) Resource[*io.SectionReader] {
+	return Resource[*io.SectionReader]{
+		Use: func(callback func(r *io.SectionReader) error) error {
+			return UseSections(path, []Section{{Offset: off, Length: n}}, func(_ int, r *io.SectionReader) error {
+				return callback(r)
+			})
+		},
+	}
+}
+
+// UseSections opens path once and calls fn with every section in turn, stopping at the first error.
+// All the sections are checked against the file size before fn is called.
+func UseSections(path string, specs []Section, fn func(i int, r *io.SectionReader) error) error {
+	return NewFileResource(path, os.O_RDONLY, 0).Use(func(fd *os.File) error {
+		info, err := fd.Stat()
+		if err != nil {
+			return phaseError(PhaseAcquire, err)
+		}
+		for _, section := range specs {
+			if section.Offset < 0 || section.Length < 0 || section.Offset > info.Size()-section.Length {
+				return phaseError(PhaseAcquire, &RangeError{Path: path, Section: section, Size: info.Size()})
+			}
+		}
+		for i, section := range specs {
+			err := fn(i, io.NewSectionReader(fd, section.Offset, section.Length))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,121 @@
+package resource_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+// sectionFile writes a file of 1000 bytes, byte i being i % 251, and returns its path with its content.
+func sectionFile(t *testing.T) (string, []byte) {
+	t.Helper()
+	content := make([]byte, 1000)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+	path := filepath.Join(t.TempDir(), "data.bin")
+	writeFile(t, path, string(content))
+	return path, content
+}
+
+func TestSectionResourceBoundaries(t *testing.T) {
+	path, content := sectionFile(t)
+	for _, section := range []resource.Section{
+		{Offset: 0, Length: 10},
+		{Offset: 0, Length: 1000},
+		{Offset: 990, Length: 10},
+		{Offset: 1000, Length: 0}, // empty, right at the end
+		{Offset: 500, Length: 0},
+	} {
+		var got []byte
+		err := resource.NewSectionResource(path, section.Offset, section.Length).Use(func(r *io.SectionReader) error {
+			var err error
+			got, err = io.ReadAll(r)
+			return err
+		})
+		if err != nil {
+			t.Errorf("section %+v: %v", section, err)
+			continue
+		}
+		if want := content[section.Offset : section.Offset+section.Length]; !bytes.Equal(got, want) {
+			t.Errorf("section %+v read %d bytes, want %d", section, len(got), len(want))
+		}
+	}
+}
+
+func TestSectionResourceOutOfRange(t *testing.T) {
+	path, _ := sectionFile(t)
+	for _, section := range []resource.Section{
+		{Offset: 991, Length: 10},
+		{Offset: 1001, Length: 0},
+		{Offset: 2000, Length: 1},
+		{Offset: -1, Length: 1},
+		{Offset: 0, Length: -1},
+		{Offset: 1, Length: 1<<63 - 1}, // doesn't overflow
+	} {
+		err := resource.NewSectionResource(path, section.Offset, section.Length).Use(func(*io.SectionReader) error {
+			t.Errorf("section %+v: callback called", section)
+			return nil
+		})
+		var rangeErr *resource.RangeError
+		if !errors.Is(err, resource.ErrOutOfRange) || !errors.As(err, &rangeErr) || rangeErr.Size != 1000 || rangeErr.Section != section {
+			t.Errorf("section %+v: %v, want a *RangeError", section, err)
+			continue
+		}
+		if phaseOf(t, err) != resource.PhaseAcquire {
+			t.Errorf("section %+v: %v, want an acquire error", section, err)
+		}
+	}
+}
+
+func TestUseSections(t *testing.T) {
+	path, content := sectionFile(t)
+	sections := []resource.Section{{Offset: 900, Length: 100}, {Offset: 0, Length: 1}, {Offset: 250, Length: 5}}
+	var read [][]byte
+	var readers []io.ReaderAt
+	err := resource.UseSections(path, sections, func(i int, r *io.SectionReader) error {
+		if len(read) != i {
+			t.Errorf("section %d after %d sections", i, len(read))
+		}
+		b, err := io.ReadAll(r)
+		read = append(read, b)
+		readerAt, _, _ := r.Outer()
+		readers = append(readers, readerAt)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, section := range sections {
+		if !bytes.Equal(read[i], content[section.Offset:section.Offset+section.Length]) {
+			t.Errorf("section %d = %v", i, read[i])
+		}
+	}
+	if readers[0] != readers[1] || readers[1] != readers[2] {
+		t.Error("the sections read from different files, want the file opened once")
+	}
+
+	// checked before any fn call
+	calls := 0
+	err = resource.UseSections(path, append(sections, resource.Section{Offset: 999, Length: 2}), func(int, *io.SectionReader) error {
+		calls++
+		return nil
+	})
+	if !errors.Is(err, resource.ErrOutOfRange) || calls != 0 {
+		t.Errorf("UseSections = %v after %d calls, want ErrOutOfRange before any", err, calls)
+	}
+
+	errStop := errors.New("stop")
+	calls = 0
+	err = resource.UseSections(path, sections, func(int, *io.SectionReader) error {
+		calls++
+		return errStop
+	})
+	if !errors.Is(err, errStop) || calls != 1 {
+		t.Errorf("UseSections = %v after %d calls, want to stop at the first error", err, calls)
+	}
+}
@@ -0,0 +1,136 @@
+package resource
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrOverCapacity matches every *OverCapacityError with errors.Is.
+var ErrOverCapacity = errors.New("request over semaphore capacity")
+
+// OverCapacityError is returned by WeightedSemaphore for a request which could never be granted.
+type OverCapacityError struct {
+	Requested, Capacity int64
+}
+
+func (e *OverCapacityError) Error() string {
+	return fmt.Sprintf("%v: %d units requested, capacity is %d", ErrOverCapacity, e.Requested, e.Capacity)
+}
+
+func (e *OverCapacityError) Is(target error) bool {
+	return target == ErrOverCapacity
+}
+
+// WeightedSemaphore is a semaphore whose holders take as many units of its capacity as their work costs,
+// like the size of the file they write, where SemaphoreLock takes one slot per holder.
+//
+// Waiters are served first come, first served: a large request waits for the units to free up,
+// and the small ones arriving after it wait behind it rather than starving it.
+type WeightedSemaphore struct {
+	capacity int64
+
+	mu      sync.Mutex
+	used    int64
+	waiters list.List // of *semaphoreWaiter, first come first
+}
+
+type semaphoreWaiter struct {
+	n     int64
+	ready chan struct{} // closed once the units are granted
+}
+
+// NewWeightedSemaphore creates a semaphore of capacity units.
+func NewWeightedSemaphore(capacity int64) *WeightedSemaphore {
+	return &WeightedSemaphore{capacity: capacity}
+}
+
+// UseN runs fn holding n units, waiting for them to be available.
+// A request of more units than the capacity fails with an *OverCapacityError instead of waiting forever.
+//
+// UseN waits regardless of any context, that of a cancelled task group included:
+// the tasks of group.RunCtx give their ctx to UseNCtx to stop waiting with the group.
+func (s *WeightedSemaphore) UseN(n int64, fn func() error) error {
+	return s.UseNCtx(context.Background(), n, fn)
+}
+
+// UseNCtx is UseN giving up waiting with ctx.Err() when ctx is done first.
+func (s *WeightedSemaphore) UseNCtx(ctx context.Context, n int64, fn func() error) error {
+	err := s.acquire(ctx, n)
+	if err != nil {
+		return phaseError(PhaseAcquire, err)
+	}
+	defer s.release(n)
+	return fn()
+}
+
+// Resource is the resource holding n units of s for the callback, waiting like UseN does.
+func (s *WeightedSemaphore) Resource(n int64) Resource[struct{}] {
+	return Resource[struct{}]{
+		Description: fmt.Sprintf("semaphore %d units", n),
+		Use: func(callback func(struct{}) error) error {
+			return s.UseN(n, func() error {
+				return useCallback(callback, struct{}{})
+			})
+		},
+	}
+}
+
+func (s *WeightedSemaphore) acquire(ctx context.Context, n int64) error {
+	if n > s.capacity {
+		return &OverCapacityError{Requested: n, Capacity: s.capacity}
+	}
+	s.mu.Lock()
+	if s.waiters.Len() == 0 && s.used+n <= s.capacity {
+		s.used += n
+		s.mu.Unlock()
+		return nil
+	}
+	waiter := &semaphoreWaiter{n: n, ready: make(chan struct{})}
+	element := s.waiters.PushBack(waiter)
+	s.mu.Unlock()
+
+	select {
+	case <-waiter.ready:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		select {
+		case <-waiter.ready:
+			// granted meanwhile: give the units back
+			s.used -= n
+		default:
+			s.waiters.Remove(element)
+		}
+		// the waiters behind this one may fit now
+		s.grant()
+		return ctx.Err()
+	}
+}
+
+func (s *WeightedSemaphore) release(n int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.used -= n
+	s.grant()
+}
+
+// grant serves the waiters in order while they fit.
+func (s *WeightedSemaphore) grant() {
+	for {
+		front := s.waiters.Front()
+		if front == nil {
+			return
+		}
+		waiter := front.Value.(*semaphoreWaiter)
+		if s.used+waiter.n > s.capacity {
+			return
+		}
+		s.used += waiter.n
+		s.waiters.Remove(front)
+		close(waiter.ready)
+	}
+}
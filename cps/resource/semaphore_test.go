@@ -0,0 +1,160 @@
+package resource_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/group"
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+func TestWeightedSemaphoreCapacity(t *testing.T) {
+	const capacity = 8
+	s := resource.NewWeightedSemaphore(capacity)
+	var used, highWater atomic.Int64
+	g := group.NewSafeWaitGroup()
+	for i := range 50 {
+		n := int64(i%5 + 1)
+		g.Run(func() {
+			err := s.UseN(n, func() error {
+				now := used.Add(n)
+				for {
+					high := highWater.Load()
+					if now <= high || highWater.CompareAndSwap(high, now) {
+						break
+					}
+				}
+				time.Sleep(time.Millisecond)
+				used.Add(-n)
+				return nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+	g.Wait()
+	if high := highWater.Load(); high > capacity {
+		t.Errorf("%d units held at once, capacity is %d", high, capacity)
+	} else if high < capacity/2 {
+		t.Errorf("at most %d units held at once, want the holders to share the capacity", high)
+	}
+
+	// every unit was given back
+	err := s.UseN(capacity, func() error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWeightedSemaphoreLargeWaiterRuns(t *testing.T) {
+	s := resource.NewWeightedSemaphore(4)
+	stop := make(chan struct{})
+	g := group.NewSafeWaitGroup()
+	// a stream of small holders which always keep some of the units
+	for range 4 {
+		g.Run(func() {
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				_ = s.UseN(1, func() error {
+					time.Sleep(100 * time.Microsecond)
+					return nil
+				})
+			}
+		})
+	}
+	defer g.Wait()
+	defer close(stop)
+	time.Sleep(5 * time.Millisecond)
+
+	ran := make(chan error, 1)
+	go func() {
+		ran <- s.UseN(4, func() error { return nil })
+	}()
+	select {
+	case err := <-ran:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the large waiter starved behind the small ones")
+	}
+}
+
+func TestWeightedSemaphoreCancelledWaiter(t *testing.T) {
+	s := resource.NewWeightedSemaphore(10)
+	release := make(chan struct{})
+	held := make(chan struct{})
+	go func() {
+		_ = s.UseN(6, func() error {
+			close(held)
+			<-release
+			return nil
+		})
+	}()
+	<-held
+	defer close(release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	large := make(chan error, 1)
+	go func() {
+		large <- s.UseNCtx(ctx, 10, func() error {
+			t.Error("the large request ran")
+			return nil
+		})
+	}()
+	time.Sleep(20 * time.Millisecond)
+	small := make(chan error, 1)
+	go func() {
+		small <- s.UseN(2, func() error { return nil })
+	}()
+
+	// the small request fits but waits behind the large one
+	select {
+	case <-small:
+		t.Fatal("a small request overtook the large waiter")
+	case <-time.After(20 * time.Millisecond):
+	}
+	cancel()
+	if err := <-large; !errors.Is(err, context.Canceled) || phaseOf(t, err) != resource.PhaseAcquire {
+		t.Errorf("UseNCtx = %v, want the acquire error of the cancellation", err)
+	}
+	select {
+	case err := <-small:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the small request still waits after the large one gave up")
+	}
+}
+
+func TestWeightedSemaphoreOverCapacity(t *testing.T) {
+	s := resource.NewWeightedSemaphore(10)
+	err := s.UseN(11, func() error {
+		t.Error("fn called")
+		return nil
+	})
+	var overErr *resource.OverCapacityError
+	if !errors.As(err, &overErr) || !errors.Is(err, resource.ErrOverCapacity) || phaseOf(t, err) != resource.PhaseAcquire {
+		t.Fatalf("UseN = %v, want an *OverCapacityError", err)
+	}
+	if overErr.Requested != 11 || overErr.Capacity != 10 {
+		t.Errorf("error = %+v", overErr)
+	}
+	if got, want := overErr.Error(), "request over semaphore capacity: 11 units requested, capacity is 10"; got != want {
+		t.Errorf("Error = %q, want %q", got, want)
+	}
+
+	err = s.Resource(11).Use(func(struct{}) error { return nil })
+	if !errors.Is(err, resource.ErrOverCapacity) {
+		t.Errorf("Resource(11).Use = %v, want ErrOverCapacity", err)
+	}
+}
@@ -0,0 +1,130 @@
+package resource
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+)
+
+// Setting is a session setting of a connection, like a sqlite PRAGMA, see WithSessionSettings.
+type Setting struct {
+	// Name describes the setting in errors.
+	Name string
+	// Apply changes the setting of conn and returns how to change it back.
+	Apply func(ctx context.Context, conn *sql.Conn) (restore func(ctx context.Context, conn *sql.Conn) error, err error)
+}
+
+// WithSessionSettings runs fn with a connection of db reserved like NewConnResource does, settings applied
+// in order before fn and restored in reverse order after it, failed, panicking or not. The restores run
+// even when ctx is done; their errors are joined with fn's. A panicking fn gets the connection
+// returned to the pool too. A connection which failed a restore is
+// discarded by the pool rather than reused with the wrong settings.
+func WithSessionSettings(ctx context.Context, db *sql.DB, settings []Setting, fn func(conn *sql.Conn) error) error {
+	return NewConnResource(db).Use(func(conn *sql.Conn) (err error) {
+		var restores []func(ctx context.Context, conn *sql.Conn) error
+		var names []string
+		defer func() {
+			restoreCtx := context.WithoutCancel(ctx)
+			var errs []error
+			for i := len(restores) - 1; i >= 0; i-- {
+				restoreErr := restores[i](restoreCtx, conn)
+				if restoreErr != nil {
+					errs = append(errs, fmt.Errorf("restore %s: %w", names[i], restoreErr))
+				}
+			}
+			if len(errs) > 0 {
+				// the connection keeps the setting: don't let the pool reuse it
+				_ = conn.Raw(func(any) error {
+					return driver.ErrBadConn
+				})
+				err = errors.Join(err, phaseError(PhaseRelease, errors.Join(errs...)))
+			}
+			if p := recover(); p != nil {
+				// NewConnResource doesn't get to return the connection to the pool
+				_ = conn.Close()
+				panic(p)
+			}
+		}()
+
+		for _, setting := range settings {
+			restore, err := setting.Apply(ctx, conn)
+			if err != nil {
+				return phaseError(PhaseAcquire, fmt.Errorf("apply %s: %w", setting.Name, err))
+			}
+			if restore != nil {
+				restores = append(restores, restore)
+				names = append(names, setting.Name)
+			}
+		}
+		return fn(conn)
+	})
+}
+
+// SQLitePragma sets the sqlite PRAGMA name to value, and restores the value it had before.
+// name and value are written in the statement, not passed as arguments: they must be plain words
+// like "foreign_keys" and "OFF".
+func SQLitePragma(name, value string) Setting {
+	return Setting{
+		Name: "pragma " + name,
+		Apply: func(ctx context.Context, conn *sql.Conn) (func(ctx context.Context, conn *sql.Conn) error, error) {
+			err := checkPragmaWords(name, value)
+			if err != nil {
+				return nil, err
+			}
+			var previous string
+			err = conn.QueryRowContext(ctx, "PRAGMA "+name).Scan(&previous)
+			if err != nil {
+				return nil, err
+			}
+			err = setPragma(ctx, conn, name, value)
+			if err != nil {
+				return nil, err
+			}
+			return func(ctx context.Context, conn *sql.Conn) error {
+				return setPragma(ctx, conn, name, previous)
+			}, nil
+		},
+	}
+}
+
+// SQLitePragmaRestore is SQLitePragma restoring restore instead of the value the PRAGMA had,
+// for the PRAGMAs which can't be read back.
+func SQLitePragmaRestore(name, value, restore string) Setting {
+	return Setting{
+		Name: "pragma " + name,
+		Apply: func(ctx context.Context, conn *sql.Conn) (func(ctx context.Context, conn *sql.Conn) error, error) {
+			err := checkPragmaWords(name, value, restore)
+			if err != nil {
+				return nil, err
+			}
+			err = setPragma(ctx, conn, name, value)
+			if err != nil {
+				return nil, err
+			}
+			return func(ctx context.Context, conn *sql.Conn) error {
+				return setPragma(ctx, conn, name, restore)
+			}, nil
+		},
+	}
+}
+
+func setPragma(ctx context.Context, conn *sql.Conn, name, value string) error {
+	_, err := conn.ExecContext(ctx, "PRAGMA "+name+" = "+value)
+	return err
+}
+
+func checkPragmaWords(words ...string) error {
+	for _, word := range words {
+		if word == "" {
+			return fmt.Errorf("pragma: empty word")
+		}
+		for i := 0; i < len(word); i++ {
+			if !isNameChar(word[i]) && word[i] != '-' {
+				return fmt.Errorf("pragma: %q is not a plain word", word)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package resource_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+// pragma returns the value of the sqlite PRAGMA name on q.
+func pragma(t testing.TB, q interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}, name string) string {
+	t.Helper()
+	var value string
+	err := q.QueryRowContext(context.Background(), "PRAGMA "+name).Scan(&value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return value
+}
+
+// recordingSetting is a setting recording its apply and restore in events, restoring with restoreErr.
+func recordingSetting(name string, events *[]string, restoreErr error) resource.Setting {
+	return resource.Setting{
+		Name: name,
+		Apply: func(context.Context, *sql.Conn) (func(context.Context, *sql.Conn) error, error) {
+			*events = append(*events, "apply "+name)
+			return func(context.Context, *sql.Conn) error {
+				*events = append(*events, "restore "+name)
+				return restoreErr
+			}, nil
+		},
+	}
+}
+
+// singleConnDB is openDB with a single connection, so that the settings left on it are seen by the next query.
+func singleConnDB(t testing.TB) *sql.DB {
+	db := openDB(t)
+	db.SetMaxOpenConns(1)
+	_, err := db.Exec("CREATE TABLE tags (item_id INTEGER NOT NULL REFERENCES items (id), tag TEXT NOT NULL)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestWithSessionSettings(t *testing.T) {
+	db := singleConnDB(t)
+	settings := []resource.Setting{
+		resource.SQLitePragma("foreign_keys", "ON"),
+		resource.SQLitePragmaRestore("recursive_triggers", "ON", "OFF"),
+	}
+	errFn := errors.New("fn failed")
+	for _, fnErr := range []error{nil, errFn} {
+		err := resource.WithSessionSettings(context.Background(), db, settings, func(conn *sql.Conn) error {
+			if got := pragma(t, conn, "foreign_keys"); got != "1" {
+				t.Errorf("foreign_keys inside fn = %s, want 1", got)
+			}
+			if got := pragma(t, conn, "recursive_triggers"); got != "1" {
+				t.Errorf("recursive_triggers inside fn = %s, want 1", got)
+			}
+			_, err := conn.ExecContext(context.Background(), "INSERT INTO tags (item_id, tag) VALUES (42, 'orphan')")
+			if err == nil {
+				t.Error("insert of an orphan tag succeeded with the foreign keys on")
+			}
+			return fnErr
+		})
+		if !errors.Is(err, fnErr) || (fnErr == nil && err != nil) {
+			t.Errorf("WithSessionSettings = %v, want %v", err, fnErr)
+		}
+		if got := pragma(t, db, "foreign_keys"); got != "0" {
+			t.Errorf("foreign_keys after fn returned %v = %s, want restored to 0", fnErr, got)
+		}
+		if got := pragma(t, db, "recursive_triggers"); got != "0" {
+			t.Errorf("recursive_triggers after fn returned %v = %s, want restored to 0", fnErr, got)
+		}
+	}
+}
+
+func TestWithSessionSettingsRestoresOnPanic(t *testing.T) {
+	db := singleConnDB(t)
+	var events []string
+	settings := []resource.Setting{
+		recordingSetting("a", &events, nil),
+		recordingSetting("b", &events, nil),
+	}
+	func() {
+		defer func() {
+			if p := recover(); p != "boom" {
+				t.Errorf("recovered %v, want the panic of fn", p)
+			}
+		}()
+		_ = resource.WithSessionSettings(context.Background(), db, settings, func(*sql.Conn) error {
+			events = append(events, "fn")
+			panic("boom")
+		})
+	}()
+	if want := []string{"apply a", "apply b", "fn", "restore b", "restore a"}; !slices.Equal(events, want) {
+		t.Errorf("events = %q, want %q", events, want)
+	}
+	// the single connection went back to the pool
+	if got := pragma(t, db, "foreign_keys"); got != "0" {
+		t.Errorf("foreign_keys after the panic = %s", got)
+	}
+	if inUse := db.Stats().InUse; inUse != 0 {
+		t.Errorf("%d connections in use after the panic", inUse)
+	}
+}
+
+func TestWithSessionSettingsRestoreFailure(t *testing.T) {
+	db := singleConnDB(t)
+	errRestore := errors.New("restore failed")
+	var events []string
+	keyed := resource.Setting{
+		Name: "keys",
+		Apply: func(ctx context.Context, conn *sql.Conn) (func(context.Context, *sql.Conn) error, error) {
+			_, err := conn.ExecContext(ctx, "PRAGMA foreign_keys = ON")
+			return func(context.Context, *sql.Conn) error { return errRestore }, err
+		},
+	}
+	settings := []resource.Setting{recordingSetting("a", &events, errRestore), keyed, recordingSetting("c", &events, nil)}
+	err := resource.WithSessionSettings(context.Background(), db, settings, func(*sql.Conn) error { return nil })
+	if !errors.Is(err, errRestore) || phaseOf(t, err) != resource.PhaseRelease {
+		t.Fatalf("WithSessionSettings = %v, want the release error of the restores", err)
+	}
+	if msg := err.Error(); !strings.Contains(msg, "restore keys") || !strings.Contains(msg, "restore a") {
+		t.Errorf("error = %q, want both failed restores", msg)
+	}
+	if want := []string{"apply a", "apply c", "restore c", "restore a"}; !slices.Equal(events, want) {
+		t.Errorf("events = %q, want every setting restored", events)
+	}
+	// the connection left with the foreign keys on was discarded
+	if got := pragma(t, db, "foreign_keys"); got != "0" {
+		t.Errorf("foreign_keys of the next connection = %s, want a fresh connection", got)
+	}
+}
+
+func TestWithSessionSettingsApplyFailure(t *testing.T) {
+	db := singleConnDB(t)
+	var events []string
+	for _, failing := range []resource.Setting{
+		resource.SQLitePragma("foreign_keys; DROP TABLE items", "ON"),
+		resource.SQLitePragmaRestore("foreign_keys", "", "OFF"),
+		resource.SQLitePragma("no_such_pragma", "ON"),
+	} {
+		events = nil
+		settings := []resource.Setting{recordingSetting("a", &events, nil), failing, recordingSetting("c", &events, nil)}
+		err := resource.WithSessionSettings(context.Background(), db, settings, func(*sql.Conn) error {
+			t.Error("fn called")
+			return nil
+		})
+		if err == nil || phaseOf(t, err) != resource.PhaseAcquire || !strings.Contains(err.Error(), "apply "+failing.Name) {
+			t.Errorf("WithSessionSettings = %v, want the acquire error of %s", err, failing.Name)
+		}
+		if want := []string{"apply a", "restore a"}; !slices.Equal(events, want) {
+			t.Errorf("events = %q, want %q", events, want)
+		}
+	}
+	if countItems(t, db) != 0 {
+		t.Error("items changed")
+	}
+}
@@ -0,0 +1,179 @@
+package resource
+
+import (
+	"container/heap"
+	"database/sql"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync/atomic"
+
+	"github.com/Q69K/using-cps-in-golang/cps/group"
+)
+
+// errShardStopped stops the shards still running once another one failed a fail-fast QueryAllShards.
+var errShardStopped = errors.New("stopped by the failure of another shard")
+
+// ShardError is the error of a shard of QueryAllShards.
+type ShardError struct {
+	Shard       int // index in the shards
+	Description string
+	Err         error
+}
+
+func (e *ShardError) Error() string {
+	return fmt.Sprintf("shard %d (%s): %v", e.Shard, e.Description, e.Err)
+}
+
+func (e *ShardError) Unwrap() error {
+	return e.Err
+}
+
+type shardOptions struct {
+	concurrency int
+	partial     bool
+	compare     any // func(a, b T) int of the T of QueryAllShards
+}
+
+// ShardOption configures QueryAllShards.
+type ShardOption func(options *shardOptions)
+
+// ShardConcurrency limits how many shards are queried at the same time, runtime.NumCPU() by default.
+func ShardConcurrency(n int) ShardOption {
+	return func(options *shardOptions) {
+		options.concurrency = n
+	}
+}
+
+// PartialResults makes QueryAllShards return the rows of the shards which succeeded along with
+// the errors of the others, instead of failing as soon as a shard does.
+func PartialResults() ShardOption {
+	return func(options *shardOptions) {
+		options.partial = true
+	}
+}
+
+// MergeSorted makes QueryAllShards merge the rows of the shards, each sorted by compare
+// (like slices.SortFunc, usually with an ORDER BY of the query), into rows sorted by compare.
+// T must be the row type of QueryAllShards.
+func MergeSorted[T any](compare func(a, b T) int) ShardOption {
+	return func(options *shardOptions) {
+		options.compare = compare
+	}
+}
+
+// QueryAllShards runs the query on every shard concurrently, decoding the rows with decode,
+// and returns the rows of all the shards: in the order of the shards, or merged with MergeSorted.
+//
+// The first shard to fail stops the others and its *ShardError is returned, unless PartialResults.
+func QueryAllShards[T any](shards []DBResource, query string, args []any, decode RowDecoder[T], opts ...ShardOption) ([]T, error) {
+	options := shardOptions{concurrency: runtime.NumCPU()}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	var compare func(a, b T) int
+	if options.compare != nil {
+		var ok bool
+		compare, ok = options.compare.(func(a, b T) int)
+		if !ok {
+			return nil, fmt.Errorf("query all shards: MergeSorted compares %T, rows are %T", options.compare, *new(T))
+		}
+	}
+
+	results := make([][]T, len(shards))
+	errs := make([]error, len(shards))
+	var failed atomic.Int64 // index+1 of the first shard to fail, fail-fast only
+	spawner := group.NewBoundedSpawner(max(options.concurrency, 1))
+	for i, shard := range shards {
+		spawner.Run(func() {
+			if failed.Load() != 0 {
+				return
+			}
+			err := shard.Use(func(db *sql.DB) error {
+				return ForEachRow(db, query, args, decode, func(item T) error {
+					if failed.Load() != 0 {
+						return errShardStopped
+					}
+					results[i] = append(results[i], item)
+					return nil
+				})
+			})
+			if err == nil {
+				return
+			}
+			results[i] = nil
+			errs[i] = &ShardError{Shard: i, Description: shard.Describe(), Err: err}
+			if !options.partial {
+				failed.CompareAndSwap(0, int64(i)+1)
+			}
+		})
+	}
+	spawner.Wait()
+
+	if first := failed.Load(); first != 0 {
+		return nil, errs[first-1]
+	}
+	var items []T
+	if compare != nil {
+		items = mergeSorted(results, compare)
+	} else {
+		for _, result := range results {
+			items = append(items, result...)
+		}
+	}
+	return items, errors.Join(errs...)
+}
+
+// mergeSorted does a k-way merge of sorted slices.
+func mergeSorted[T any](sorted [][]T, compare func(a, b T) int) []T {
+	total := 0
+	h := &mergeHeap[T]{compare: compare}
+	for _, s := range sorted {
+		total += len(s)
+		if len(s) > 0 {
+			h.heads = append(h.heads, s)
+		}
+	}
+	heap.Init(h)
+
+	merged := make([]T, 0, total)
+	for h.Len() > 0 {
+		head := h.heads[0]
+		merged = append(merged, head[0])
+		if len(head) > 1 {
+			h.heads[0] = head[1:]
+			heap.Fix(h, 0)
+		} else {
+			heap.Pop(h)
+		}
+	}
+	return merged
+}
+
+// mergeHeap orders the remaining parts of the slices by their first element.
+type mergeHeap[T any] struct {
+	heads   [][]T
+	compare func(a, b T) int
+}
+
+func (h *mergeHeap[T]) Len() int {
+	return len(h.heads)
+}
+
+func (h *mergeHeap[T]) Less(i, j int) bool {
+	return h.compare(h.heads[i][0], h.heads[j][0]) < 0
+}
+
+func (h *mergeHeap[T]) Swap(i, j int) {
+	h.heads[i], h.heads[j] = h.heads[j], h.heads[i]
+}
+
+func (h *mergeHeap[T]) Push(x any) {
+	h.heads = append(h.heads, x.([]T))
+}
+
+func (h *mergeHeap[T]) Pop() any {
+	last := h.heads[len(h.heads)-1]
+	h.heads = h.heads[:len(h.heads)-1]
+	return last
+}
@@ -0,0 +1,113 @@
+package resource_test
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+// newShards creates a sqlite file per list of names, a nil one being a shard without the items table.
+func newShards(t *testing.T, names ...[]string) []resource.DBResource {
+	t.Helper()
+	var shards []resource.DBResource
+	for i, shardNames := range names {
+		path := filepath.Join(t.TempDir(), fmt.Sprintf("shard%d.db", i))
+		db, err := sql.Open("sqlite3", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if shardNames != nil {
+			_, err = db.Exec("CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT NOT NULL)")
+		}
+		for _, name := range shardNames {
+			if err == nil {
+				_, err = db.Exec("INSERT INTO items (name) VALUES (?)", name)
+			}
+		}
+		if err == nil {
+			err = db.Close()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		shards = append(shards, resource.NewDBResource("sqlite3", path))
+	}
+	return shards
+}
+
+const shardQuery = "SELECT name FROM items ORDER BY name"
+
+func TestQueryAllShards(t *testing.T) {
+	shards := newShards(t, []string{"d", "a"}, []string{"b", "e"}, []string{"f", "c"})
+	for _, concurrency := range []int{1, 3} {
+		names, err := resource.QueryAllShards(shards, shardQuery, nil, decodeName, resource.ShardConcurrency(concurrency))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"a", "d", "b", "e", "c", "f"}; !slices.Equal(names, want) {
+			t.Errorf("rows with %d shards at a time = %q, want the rows of every shard in order %q", concurrency, names, want)
+		}
+
+		names, err = resource.QueryAllShards(shards, shardQuery, nil, decodeName,
+			resource.ShardConcurrency(concurrency), resource.MergeSorted(strings.Compare))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"a", "b", "c", "d", "e", "f"}; !slices.Equal(names, want) {
+			t.Errorf("merged rows = %q, want %q", names, want)
+		}
+	}
+}
+
+// checkShardError checks err is the *ShardError of the poisoned shard 1.
+func checkShardError(t *testing.T, err error) {
+	t.Helper()
+	var shardErr *resource.ShardError
+	if !errors.As(err, &shardErr) || shardErr.Shard != 1 {
+		t.Fatalf("got %v, want the *ShardError of shard 1", err)
+	}
+	if !strings.Contains(shardErr.Description, "shard1.db") || !strings.Contains(err.Error(), "no such table: items") {
+		t.Errorf("error = %v, want the database of shard 1 and the query error", err)
+	}
+	if !strings.HasPrefix(err.Error(), "shard 1 (") {
+		t.Errorf("Error = %q, want it to start with the shard", err.Error())
+	}
+}
+
+func TestQueryAllShardsFailFast(t *testing.T) {
+	shards := newShards(t, []string{"a", "d"}, nil, []string{"c", "f"})
+	names, err := resource.QueryAllShards(shards, shardQuery, nil, decodeName)
+	checkShardError(t, err)
+	if names != nil {
+		t.Errorf("rows = %q, want none with the error", names)
+	}
+}
+
+func TestQueryAllShardsPartialResults(t *testing.T) {
+	shards := newShards(t, []string{"a", "d"}, nil, []string{"c", "f"})
+	names, err := resource.QueryAllShards(shards, shardQuery, nil, decodeName, resource.PartialResults())
+	checkShardError(t, err)
+	if want := []string{"a", "d", "c", "f"}; !slices.Equal(names, want) {
+		t.Errorf("rows = %q, want the ones of the other shards %q", names, want)
+	}
+
+	names, err = resource.QueryAllShards(shards, shardQuery, nil, decodeName, resource.PartialResults(), resource.MergeSorted(strings.Compare))
+	checkShardError(t, err)
+	if want := []string{"a", "c", "d", "f"}; !slices.Equal(names, want) {
+		t.Errorf("merged rows = %q, want %q", names, want)
+	}
+}
+
+func TestQueryAllShardsMergeSortedOfOtherType(t *testing.T) {
+	shards := newShards(t, []string{"a"})
+	_, err := resource.QueryAllShards(shards, shardQuery, nil, decodeName, resource.MergeSorted(func(a, b int) int { return a - b }))
+	if err == nil || !strings.Contains(err.Error(), "MergeSorted compares func(int, int) int, rows are string") {
+		t.Errorf("QueryAllShards = %v, want the type mismatch", err)
+	}
+}
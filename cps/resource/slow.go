@@ -0,0 +1,98 @@
+package resource
+
+import (
+	"log/slog"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// ResourceInfo describes a resource held for too long, see WarnAfter.
+type ResourceInfo struct {
+	Description string
+	// Held is how long the resource had been held when the warning fired.
+	Held time.Duration
+	// Stack is the stack of the goroutine which acquired the resource, at the time it did.
+	Stack string
+}
+
+// LogSlowResource is the default handler of WarnAfter, logging a warning with slog.Default().
+func LogSlowResource(info ResourceInfo) {
+	slog.Warn("resource held for too long",
+		slog.String("resource", info.Description),
+		slog.Duration("held", info.Held),
+		slog.String("stack", info.Stack))
+}
+
+type slowOptions struct {
+	clock Clock
+}
+
+// SlowOption configures WarnAfter and SetDefaultWarnAfter.
+type SlowOption func(options *slowOptions)
+
+// SlowClock makes WarnAfter, or SetDefaultWarnAfter, time the Uses with clock.
+func SlowClock(clock Clock) SlowOption {
+	return func(options *slowOptions) {
+		options.clock = clock
+	}
+}
+
+// WarnAfter calls onWarn (LogSlowResource when nil) when a Use of r holds its value for longer than d,
+// at most once per Use, from a goroutine of its own. The callback isn't interrupted.
+func WarnAfter[T any](r Resource[T], d time.Duration, onWarn func(info ResourceInfo), opts ...SlowOption) Resource[T] {
+	var options slowOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	clock := clockOr(options.clock)
+
+	return Resource[T]{
+		Use: func(callback func(value T) error) error {
+			return r.Use(func(value T) error {
+				stop := startSlowTimer(clock, r.Describe(), d, onWarn)
+				defer stop()
+				return callback(value)
+			})
+		},
+		Description: r.Description,
+	}
+}
+
+type slowDefault struct {
+	d      time.Duration
+	onWarn func(info ResourceInfo)
+	clock  Clock
+}
+
+var defaultWarnAfter atomic.Pointer[slowDefault]
+
+// SetDefaultWarnAfter makes the db, tx, rows and file resources, and the values of Acquire, warn like WarnAfter
+// when held for longer than d. A d of 0 or less stops it.
+func SetDefaultWarnAfter(d time.Duration, onWarn func(info ResourceInfo), opts ...SlowOption) {
+	if d <= 0 {
+		defaultWarnAfter.Store(nil)
+		return
+	}
+	var options slowOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	defaultWarnAfter.Store(&slowDefault{d: d, onWarn: onWarn, clock: clockOr(options.clock)})
+}
+
+// startSlowTimer starts the timer of a resource acquired now, stopped by the returned func.
+func startSlowTimer(clock Clock, description string, d time.Duration, onWarn func(info ResourceInfo)) (stop func()) {
+	if onWarn == nil {
+		onWarn = LogSlowResource
+	}
+	buf := make([]byte, 8<<10)
+	stack := string(buf[:runtime.Stack(buf, false)])
+	acquired := clock.Now()
+	timer := clock.AfterFunc(d, func() {
+		onWarn(ResourceInfo{Description: description, Held: clock.Now().Sub(acquired), Stack: stack})
+	})
+	return func() {
+		timer.Stop()
+	}
+}
@@ -0,0 +1,137 @@
+package resource_test
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+	"github.com/Q69K/using-cps-in-golang/cps/resource/resourcetest"
+)
+
+func TestWarnAfterOnClock(t *testing.T) {
+	clock := newFakeClock()
+	var warned []resource.ResourceInfo
+	r := resource.WarnAfter(resource.Resource[int]{
+		Use: func(callback func(int) error) error {
+			return callback(1)
+		},
+		Description: "slow one",
+	}, time.Second, func(info resource.ResourceInfo) {
+		warned = append(warned, info)
+	}, resource.SlowClock(clock))
+
+	err := r.Use(func(int) error {
+		clock.Advance(time.Second - time.Nanosecond)
+		if len(warned) != 0 {
+			t.Fatal("warned before the second passed")
+		}
+		clock.Advance(time.Minute)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warned) != 1 || warned[0].Description != "slow one" || warned[0].Held != time.Second {
+		t.Fatalf("got %+v, want one warning after a second", warned)
+	}
+}
+
+func TestSetDefaultWarnAfterOnClock(t *testing.T) {
+	clock := newFakeClock()
+	var warned []resource.ResourceInfo
+	resource.SetDefaultWarnAfter(time.Second, func(info resource.ResourceInfo) {
+		warned = append(warned, info)
+	}, resource.SlowClock(clock))
+	t.Cleanup(func() {
+		resource.SetDefaultWarnAfter(0, nil)
+	})
+
+	path := filepath.Join(t.TempDir(), "slow")
+	err := resource.NewFileResource(path, os.O_CREATE|os.O_WRONLY, 0o644).Use(func(*os.File) error {
+		clock.Advance(2 * time.Second)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warned) != 1 || warned[0].Held != time.Second {
+		t.Fatalf("got %+v, want one warning after a second", warned)
+	}
+}
+
+func TestWarnAfterSleepingCallbackWarnsOnce(t *testing.T) {
+	var mu sync.Mutex
+	var warned []resource.ResourceInfo
+	r := resource.WarnAfter(resourcetest.FakeResource(1, resourcetest.NoFailure), 10*time.Millisecond, func(info resource.ResourceInfo) {
+		mu.Lock()
+		defer mu.Unlock()
+		warned = append(warned, info)
+	})
+
+	err := r.Use(func(int) error {
+		time.Sleep(100 * time.Millisecond)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(warned) != 1 {
+		t.Fatalf("%d warnings, want exactly one", len(warned))
+	}
+	if warned[0].Held < 10*time.Millisecond || !strings.Contains(warned[0].Stack, "TestWarnAfterSleepingCallbackWarnsOnce") {
+		t.Errorf("warning = %+v, want the time held and the stack of the acquisition", warned[0])
+	}
+}
+
+func TestWarnAfterFastCallbacksDontWarn(t *testing.T) {
+	var warnings atomic.Int64
+	r := resource.WarnAfter(resourcetest.FakeResource(1, resourcetest.NoFailure), 20*time.Millisecond, func(resource.ResourceInfo) {
+		warnings.Add(1)
+	})
+	for range 100 {
+		err := r.Use(func(int) error { return nil })
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(50 * time.Millisecond) // past the deadline of every Use
+	if n := warnings.Load(); n != 0 {
+		t.Errorf("%d warnings for fast callbacks, want none", n)
+	}
+}
+
+func TestWarnAfterLogsByDefault(t *testing.T) {
+	var buf bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+	t.Cleanup(func() {
+		slog.SetDefault(defaultLogger)
+	})
+
+	clock := newFakeClock()
+	r := resource.WarnAfter(resource.Resource[int]{
+		Use: func(callback func(int) error) error {
+			return callback(1)
+		},
+		Description: "slow one",
+	}, time.Second, nil, resource.SlowClock(clock))
+	err := r.Use(func(int) error {
+		clock.Advance(time.Second)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); !strings.Contains(got, "resource held for too long") || !strings.Contains(got, `resource="slow one"`) {
+		t.Errorf("log = %q, want the warning of slow one", got)
+	}
+}
@@ -0,0 +1,117 @@
+package resource
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// ErrSnapshotTooLarge is returned by WithDirSnapshot for a tree bigger than its MaxSnapshotSize.
+var ErrSnapshotTooLarge = errors.New("directory too large to snapshot")
+
+type snapshotOptions struct {
+	maxSize int64
+}
+
+// SnapshotOption configures WithDirSnapshot.
+type SnapshotOption func(options *snapshotOptions)
+
+// MaxSnapshotSize makes WithDirSnapshot refuse trees whose files take more than n bytes.
+func MaxSnapshotSize(n int64) SnapshotOption {
+	return func(options *snapshotOptions) {
+		options.maxSize = n
+	}
+}
+
+// WithDirSnapshot copies the tree of dir to a temporary directory, runs fn, then restores dir
+// as it was whatever fn did or returned: the files fn changed or deleted come back,
+// those it created are removed. File modes and symlinks are preserved, modification times aren't.
+//
+// It's meant for tests mutating a directory. A failed snapshot is a PhaseAcquire error and
+// fn doesn't run, a failed restore is a PhaseRelease error joined with fn's one.
+func WithDirSnapshot(dir string, fn func() error, opts ...SnapshotOption) error {
+	var options snapshotOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return NewTempDirResource("", "snapshot-*").Use(func(tmp string) error {
+		backup := filepath.Join(tmp, "tree")
+		err := copyTree(dir, backup, options.maxSize)
+		if err != nil {
+			return phaseError(PhaseAcquire, err)
+		}
+		err = fn()
+		return errors.Join(err, phaseError(PhaseRelease, restoreTree(backup, dir)))
+	})
+}
+
+// copyTree copies the tree of src to dst, failing when its files take more than maxSize bytes (if positive).
+func copyTree(src, dst string, maxSize int64) error {
+	var size int64
+	type dirMode struct {
+		path string
+		mode fs.FileMode
+	}
+	var dirs []dirMode
+	err := filepath.WalkDir(src, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case info.IsDir():
+			dirs = append(dirs, dirMode{target, info.Mode().Perm()})
+			return os.MkdirAll(target, 0700)
+		case info.Mode()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case info.Mode().IsRegular():
+			size += info.Size()
+			if maxSize > 0 && size > maxSize {
+				return fmt.Errorf("snapshot %s: %w: more than %d bytes", src, ErrSnapshotTooLarge, maxSize)
+			}
+			return CopyFile(path, target, info.Mode().Perm())
+		default:
+			return fmt.Errorf("snapshot %s: %s is not a regular file", src, path)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	// read-only directories get their mode once their content is there, innermost first
+	for i := len(dirs) - 1; i >= 0; i-- {
+		err = os.Chmod(dirs[i].path, dirs[i].mode)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreTree replaces the content of dir with the tree copied to backup.
+func restoreTree(backup, dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	for _, entry := range entries {
+		err = os.RemoveAll(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return err
+		}
+	}
+	return copyTree(backup, dir, 0)
+}
@@ -0,0 +1,120 @@
+package resource_test
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+// treeState describes every entry of the tree of dir by its mode and content, or link target.
+func treeState(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	state := make(map[string]string)
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case info.Mode()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			state[rel] = fmt.Sprintf("%v -> %s", info.Mode(), link)
+			return err
+		case info.Mode().IsRegular():
+			content, err := os.ReadFile(path)
+			state[rel] = fmt.Sprintf("%v %q", info.Mode(), content)
+			return err
+		default:
+			state[rel] = info.Mode().String()
+			return nil
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return state
+}
+
+func TestWithDirSnapshotRestores(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "config.json"), `{"debug": false}`)
+	writeFile(t, filepath.Join(dir, "run.sh"), "#!/bin/sh\n")
+	err := os.Chmod(filepath.Join(dir, "run.sh"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.MkdirAll(filepath.Join(dir, "data", "nested"), 0750)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "data", "nested", "rows.csv"), "1,a\n2,b\n")
+	err = os.Symlink("data/nested/rows.csv", filepath.Join(dir, "latest"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := treeState(t, dir)
+
+	errTest := errors.New("test failed")
+	err = resource.WithDirSnapshot(dir, func() error {
+		for _, step := range []func() error{
+			func() error { return os.WriteFile(filepath.Join(dir, "config.json"), []byte(`{"debug": true}`), 0600) },
+			func() error { return os.Chmod(filepath.Join(dir, "run.sh"), 0600) },
+			func() error { return os.RemoveAll(filepath.Join(dir, "data", "nested")) },
+			func() error { return os.WriteFile(filepath.Join(dir, "data", "new.txt"), []byte("created"), 0600) },
+			func() error { return os.Mkdir(filepath.Join(dir, "cache"), 0700) },
+			func() error { return os.Remove(filepath.Join(dir, "latest")) },
+			func() error { return os.Symlink("config.json", filepath.Join(dir, "latest")) },
+		} {
+			if err := step(); err != nil {
+				return err
+			}
+		}
+		if maps.Equal(treeState(t, dir), before) {
+			t.Error("the tree didn't change")
+		}
+		return errTest
+	})
+	if !errors.Is(err, errTest) {
+		t.Fatalf("WithDirSnapshot = %v, want the error of fn", err)
+	}
+
+	if after := treeState(t, dir); !maps.Equal(after, before) {
+		t.Errorf("tree after = %q, want %q", after, before)
+	}
+}
+
+func TestWithDirSnapshotMaxSize(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "a"), "0123456789")
+	writeFile(t, filepath.Join(dir, "b"), "0123456789")
+
+	called := false
+	err := resource.WithDirSnapshot(dir, func() error {
+		called = true
+		return nil
+	}, resource.MaxSnapshotSize(15))
+	if called || !errors.Is(err, resource.ErrSnapshotTooLarge) || phaseOf(t, err) != resource.PhaseAcquire {
+		t.Errorf("WithDirSnapshot of 20 bytes = %v, fn called %v, want ErrSnapshotTooLarge", err, called)
+	}
+
+	err = resource.WithDirSnapshot(dir, func() error {
+		called = true
+		return os.Remove(filepath.Join(dir, "a"))
+	}, resource.MaxSnapshotSize(20))
+	if err != nil || !called || readFile(t, filepath.Join(dir, "a")) != "0123456789" {
+		t.Errorf("WithDirSnapshot of 20 bytes at most = %v, fn called %v", err, called)
+	}
+}
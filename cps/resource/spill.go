@@ -0,0 +1,107 @@
+package resource
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// SpillBuffer is a sequence of records kept in memory up to a size, and in a temporary file beyond it.
+// It is not safe for concurrent use.
+type SpillBuffer struct {
+	maxInMemory int
+	inMemory    int
+	records     [][]byte
+
+	file    *LazyHandle[*os.File]
+	spilled *bufio.Writer
+	size    int64
+}
+
+// NewSpillBuffer gives the callback an empty buffer keeping up to maxInMemory bytes of records in memory.
+// The records appended beyond that go to a file of tmp, acquired by the first of them only
+// and released with the buffer, like NewTempFileResource("", "spill-*") whose files are removed.
+func NewSpillBuffer(maxInMemory int, tmp FileResource) Resource[*SpillBuffer] {
+	lazy := Lazy(FromUsable(tmp))
+	return Resource[*SpillBuffer]{
+		Use: func(callback func(b *SpillBuffer) error) error {
+			return lazy.Use(func(file *LazyHandle[*os.File]) error {
+				return callback(&SpillBuffer{maxInMemory: maxInMemory, file: file})
+			})
+		},
+	}
+}
+
+// Append adds a copy of record after the others.
+func (b *SpillBuffer) Append(record []byte) error {
+	if b.spilled == nil && b.inMemory+len(record) <= b.maxInMemory {
+		b.records = append(b.records, append([]byte(nil), record...))
+		b.inMemory += len(record)
+		return nil
+	}
+	if b.spilled == nil {
+		// once a record spilled the next ones follow it, so the file keeps the order
+		file, err := b.file.Get()
+		if err != nil {
+			return err
+		}
+		b.spilled = bufio.NewWriter(io.NewOffsetWriter(file, 0))
+	}
+	n, err := b.spilled.Write(binary.AppendUvarint(nil, uint64(len(record))))
+	b.size += int64(n)
+	if err != nil {
+		return err
+	}
+	n, err = b.spilled.Write(record)
+	b.size += int64(n)
+	return err
+}
+
+// Iterate calls fn with every record in the order they were appended, stopping at its first error.
+// The record is only valid until fn returns.
+func (b *SpillBuffer) Iterate(fn func(record []byte) error) error {
+	for _, record := range b.records {
+		err := fn(record)
+		if err != nil {
+			return err
+		}
+	}
+	if b.spilled == nil {
+		return nil
+	}
+	err := b.spilled.Flush()
+	if err != nil {
+		return err
+	}
+	file, err := b.file.Get()
+	if err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(io.NewSectionReader(file, 0, b.size))
+	var record []byte
+	for {
+		n, err := binary.ReadUvarint(r)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("spill buffer: %w", err)
+		}
+		if uint64(cap(record)) < n {
+			record = make([]byte, n)
+		}
+		record = record[:n]
+		_, err = io.ReadFull(r, record)
+		if err != nil {
+			return fmt.Errorf("spill buffer: %w", err)
+		}
+		err = fn(record)
+		if err != nil {
+			return err
+		}
+	}
+}
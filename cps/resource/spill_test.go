@@ -0,0 +1,137 @@
+package resource_test
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+// spilled returns copies of the records of b.
+func spilled(b *resource.SpillBuffer) ([]string, error) {
+	var records []string
+	err := b.Iterate(func(record []byte) error {
+		records = append(records, string(record))
+		return nil
+	})
+	return records, err
+}
+
+func TestSpillBufferKeepsOrderAcrossTheSpill(t *testing.T) {
+	dir := t.TempDir()
+	const threshold = 1000
+
+	var want []string
+	err := resource.NewSpillBuffer(threshold, resource.NewTempFileResource(dir, "spill-*")).Use(func(b *resource.SpillBuffer) error {
+		size := 0
+		for i := 0; size < 10*threshold; i++ {
+			record := fmt.Sprintf("record %d %s", i, strings.Repeat("x", i%50))
+			if i%7 == 0 {
+				record = "" // empty records are kept too
+			}
+			err := b.Append([]byte(record))
+			if err != nil {
+				return err
+			}
+			want = append(want, record)
+			size += len(record)
+		}
+		if entries := dirEntries(t, dir); len(entries) != 1 {
+			t.Errorf("temporary files = %q, want one spill file", entries)
+		}
+
+		for range 2 {
+			got, err := spilled(b)
+			if err != nil {
+				return err
+			}
+			if !slices.Equal(got, want) {
+				t.Errorf("%d records iterated, want the %d appended in order", len(got), len(want))
+			}
+		}
+
+		// appending after iterating goes on at the end
+		err := b.Append([]byte("last"))
+		if err != nil {
+			return err
+		}
+		want = append(want, "last")
+		got, err := spilled(b)
+		if err != nil {
+			return err
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("records after appending again end with %q, want %q", got[len(got)-1], "last")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries := dirEntries(t, dir); len(entries) != 0 {
+		t.Errorf("temporary files after the Use = %q, want none", entries)
+	}
+}
+
+func TestSpillBufferInMemoryCreatesNoFile(t *testing.T) {
+	dir := t.TempDir()
+	err := resource.NewSpillBuffer(1000, resource.NewTempFileResource(dir, "spill-*")).Use(func(b *resource.SpillBuffer) error {
+		for _, record := range []string{"a", "b", "c"} {
+			err := b.Append([]byte(record))
+			if err != nil {
+				return err
+			}
+		}
+		got, err := spilled(b)
+		if !slices.Equal(got, []string{"a", "b", "c"}) {
+			t.Errorf("records = %q", got)
+		}
+		if entries := dirEntries(t, dir); len(entries) != 0 {
+			t.Errorf("temporary files = %q, want none below the threshold", entries)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSpillBufferErrors(t *testing.T) {
+	errStop := errors.New("stop")
+	dir := t.TempDir()
+	err := resource.NewSpillBuffer(4, resource.NewTempFileResource(dir, "spill-*")).Use(func(b *resource.SpillBuffer) error {
+		for _, record := range []string{"ab", "cd", "ef", "gh"} {
+			err := b.Append([]byte(record))
+			if err != nil {
+				return err
+			}
+		}
+		var seen []string
+		err := b.Iterate(func(record []byte) error {
+			seen = append(seen, string(record))
+			if len(seen) == 3 {
+				return errStop
+			}
+			return nil
+		})
+		if !errors.Is(err, errStop) || !slices.Equal(seen, []string{"ab", "cd", "ef"}) {
+			t.Errorf("Iterate = %v after %q, want it stopped at the error", err, seen)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	missing := resource.NewTempFileResource(filepath.Join(dir, "missing"), "spill-*")
+	err = resource.NewSpillBuffer(1, missing).Use(func(b *resource.SpillBuffer) error {
+		return b.Append([]byte("spilled"))
+	})
+	if err == nil {
+		t.Error("Append without a temporary file succeeded")
+	}
+}
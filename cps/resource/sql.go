@@ -0,0 +1,600 @@
+package resource
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DBResource opens a database, passes it to the callback and closes it afterwards.
+//
+// NewDBResource and the other constructors of this package return unexported implementations of it,
+// with a String method telling the same as Describe; SharedDBResource implements it too.
+// FromUsable turns a DBResource into a Resource[*sql.DB] for the generic decorators, and DB turns it back.
+type DBResource interface {
+	Use(callback func(db *sql.DB) error) error
+	// Describe tells which database it is, like "db sqlite3 app.db", without its password.
+	Describe() string
+}
+
+// dbResource is the DBResource of the constructors of this package.
+type dbResource struct {
+	r Resource[*sql.DB]
+}
+
+// DB returns r as a DBResource, described the same way.
+func DB(r Resource[*sql.DB]) DBResource {
+	return dbResource{r}
+}
+
+func (d dbResource) Use(callback func(db *sql.DB) error) error {
+	return d.r.Use(callback)
+}
+
+func (d dbResource) Describe() string {
+	return d.r.Describe()
+}
+
+func (d dbResource) String() string {
+	return d.r.Describe()
+}
+
+func (d dbResource) resource() Resource[*sql.DB] {
+	return d.r
+}
+
+type dbOptions struct {
+	tracer Tracer
+	// rewriteDSN adjust the datasource name to the options, checkOpened verify them on the opened database
+	rewriteDSN  []func(driverName, datasourceName string) (string, error)
+	checkOpened []func(db *sql.DB) error
+	redact      func(err error) error // hides the password of the DSN in acquire errors
+	warmup      int
+	bestEffort  bool // warmup failures are warnings
+}
+
+func (options *dbOptions) acquireError(err error) error {
+	if options.redact != nil {
+		err = options.redact(err)
+	}
+	return err
+}
+
+// DBOption configures NewDBResource.
+type DBOption func(options *dbOptions)
+
+// NewDBResource opens the database with sql.Open for every Use.
+//
+// The datasource is a string or a DSN. The resource is described by the driver name
+// and the datasource without its password, and the acquire errors of a DSN have its password masked.
+func NewDBResource[S string | DSN](driverName string, datasource S, opts ...DBOption) DBResource {
+	var options dbOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	var datasourceName, redacted string
+	switch datasource := any(datasource).(type) {
+	case string:
+		datasourceName = datasource
+		redacted = redactDSN(datasource)
+	case DSN:
+		datasourceName = datasource.String()
+		redacted = datasource.Redacted()
+		if datasource.Password != "" {
+			options.redact = func(err error) error {
+				return &redactedError{err: err, password: datasource.Password}
+			}
+		}
+	}
+	description := "db " + driverName + " " + redacted
+	var optionsErr error
+	for _, rewrite := range options.rewriteDSN {
+		datasourceName, optionsErr = rewrite(driverName, datasourceName)
+		if optionsErr != nil {
+			break
+		}
+	}
+	return DB(Resource[*sql.DB]{
+		Description: description,
+		Use: func(callback func(db *sql.DB) error) error {
+			if optionsErr != nil {
+				return checkResult(describedError(PhaseAcquire, description, options.acquireError(optionsErr)), description)
+			}
+			end := startSpan(options.tracer, "resource.db")
+			err := useDB(driverName, datasourceName, description, &options, callback)
+			end(err)
+			return checkResult(err, description)
+		},
+	})
+}
+
+func useDB(driverName, datasourceName, description string, options *dbOptions, callback func(db *sql.DB) error) error {
+	stats := currentStats("db")
+	db, err := sql.Open(driverName, datasourceName)
+	if err != nil {
+		stats.acquireFailed()
+		return describedError(PhaseAcquire, description, options.acquireError(err))
+	}
+	for _, check := range options.checkOpened {
+		err = check(db)
+		if err != nil {
+			closeErr := db.Close()
+			stats.acquireFailed()
+			err = describedError(PhaseAcquire, description, options.acquireError(err))
+			return secondaryError(err, description, describedError(PhaseRelease, description, closeErr))
+		}
+	}
+	err = options.warmUp(db, description)
+	if err != nil {
+		closeErr := db.Close()
+		stats.acquireFailed()
+		err = describedError(PhaseAcquire, description, options.acquireError(err))
+		return secondaryError(err, description, describedError(PhaseRelease, description, closeErr))
+	}
+	acquired := stats.acquired()
+	open := trackOpenAs("db", description, 0)
+	bindDriver(db, driverName)
+	endUse := startSpan(options.tracer, "resource.db.use")
+	err = useCallback(callback, db)
+	endUse(err)
+	closeErr := db.Close()
+	unbindDriver(db)
+	open.release()
+	stats.released(acquired, err, closeErr)
+	if err != nil {
+		return err
+	}
+	return describedError(PhaseRelease, description, closeErr)
+}
+
+// TxResource runs the callback inside a transaction.
+type TxResource = Resource[*sql.Tx]
+
+type txOptions struct {
+	beforeCommit   []func(tx *sql.Tx) error
+	afterRollback  []func(cause error)
+	reportDryRun   bool
+	logger         *slog.Logger
+	tracer         Tracer
+	deadline       time.Duration
+	values         []txValue
+	idempotencyKey string
+	onUnknown      []func(err *TxOutcomeUnknownError)
+	clock          Clock
+}
+
+type txValue struct {
+	key, value any
+}
+
+// TxOption configures RunTransaction.
+type TxOption func(options *txOptions)
+
+func newTxOptions(opts []TxOption) txOptions {
+	var options txOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
+
+// OnBeforeCommit runs hook inside the transaction right before Commit,
+// an error of the hook rolls the transaction back.
+func OnBeforeCommit(hook func(tx *sql.Tx) error) TxOption {
+	return func(options *txOptions) {
+		options.beforeCommit = append(options.beforeCommit, hook)
+	}
+}
+
+// OnAfterRollback runs hook after the transaction was rolled back, with the error causing it.
+// A failed Commit counts as a rollback too.
+func OnAfterRollback(hook func(cause error)) TxOption {
+	return func(options *txOptions) {
+		options.afterRollback = append(options.afterRollback, hook)
+	}
+}
+
+func (options *txOptions) runBeforeCommit(tx *sql.Tx) error {
+	for _, hook := range options.beforeCommit {
+		err := hook(tx)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (options *txOptions) runAfterRollback(cause error) {
+	for _, hook := range options.afterRollback {
+		hook(cause)
+	}
+}
+
+// RunTransaction begins a transaction for every Use; it is committed when the callback succeeds
+// and rolled back when it fails.
+//
+// A callback which commits or rolls back the transaction itself isn't failed for it:
+// the sql.ErrTxDone of the resource's own Commit or Rollback is dropped, and reported as a WarnDoubleClose warning.
+// A transaction rolled back by database/sql because its context is done (RunTransactionCtx, TxDeadline)
+// fails the Use with a PhaseRelease error wrapping the context error instead: nothing was committed.
+func RunTransaction(db *sql.DB, opts ...TxOption) TxResource {
+	options := newTxOptions(opts)
+	return TxResource{
+		Description: "tx",
+		Use: func(callback func(tx *sql.Tx) error) error {
+			end := startSpan(options.tracer, "resource.tx")
+			err := runTransaction(context.Background(), db, &options, callback)
+			end(err)
+			return checkResult(err, "tx")
+		},
+	}
+}
+
+// txIDs numbers the transactions for their descriptions.
+var txIDs atomic.Int64
+
+func describeTx(id int64) string {
+	return "tx #" + strconv.FormatInt(id, 10)
+}
+
+func runTransaction(ctx context.Context, db *sql.DB, options *txOptions, callback func(tx *sql.Tx) error) error {
+	if options.idempotencyKey != "" {
+		err := useTransaction(ctx, db, options, options.idempotent(callback))
+		return options.alreadyApplied(ctx, db, err)
+	}
+	return useTransaction(ctx, db, options, callback)
+}
+
+func useTransaction(ctx context.Context, db *sql.DB, options *txOptions, callback func(tx *sql.Tx) error) error {
+	started := clockOr(options.clock).Now()
+	id := txIDs.Add(1)
+	ctx, cancel := options.context(ctx)
+	defer cancel()
+	tx, err := db.BeginTx(ctx, nil)
+	options.logBegin(err)
+	if err != nil {
+		return describedError(PhaseAcquire, describeTx(id), err)
+	}
+	open := trackOpenAs("tx", "tx", id)
+	defer open.release()
+	bindDriverOf(tx, db)
+	defer unbindDriver(tx)
+	if ctx != context.Background() {
+		txContexts.Store(tx, ctx)
+		defer txContexts.Delete(tx)
+	}
+	called := false
+	defer func() {
+		if !called {
+			// the callback panicked or called runtime.Goexit: don't keep the connection and its locks
+			_ = tx.Rollback()
+		}
+	}()
+	endUse := startSpan(options.tracer, "resource.tx.use")
+	err = useCallback(callback, tx)
+	called = true
+	endUse(err)
+	if options.deadline > 0 && ctx.Err() != nil && !errors.Is(err, ctx.Err()) {
+		err = errors.Join(err, ctx.Err())
+	} else if errors.Is(err, sql.ErrTxDone) && ctx.Err() != nil && !errors.Is(err, ctx.Err()) {
+		// a statement after database/sql rolled back for the done context: the context is the cause
+		err = errors.Join(err, ctx.Err())
+	}
+	if err == nil {
+		err = options.runBeforeCommit(tx)
+	}
+	if err != nil {
+		endRollback := startSpan(options.tracer, "resource.tx.rollback")
+		rollbackErr := tx.Rollback()
+		if errors.Is(rollbackErr, sql.ErrTxDone) {
+			if ctx.Err() == nil {
+				// not rolled back by database/sql for the cancelled context
+				warn(WarnDoubleClose, describeTx(id))
+			}
+			rollbackErr = nil
+		}
+		endRollback(rollbackErr)
+		options.logEnd("rollback", started, rollbackErr)
+		options.runAfterRollback(err)
+		if unknown := options.outcomeUnknown(describeTx(id), "rollback", rollbackErr); unknown != nil {
+			// never swallowed: the caller has to find out what happened
+			return errors.Join(err, describedError(PhaseRelease, describeTx(id), unknown))
+		}
+		return secondaryError(err, describeTx(id), describedError(PhaseRelease, describeTx(id), rollbackErr))
+	} else {
+		endCommit := startSpan(options.tracer, "resource.tx.commit")
+		err = tx.Commit()
+		if errors.Is(err, sql.ErrTxDone) {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				// rolled back by database/sql for the cancelled context: nothing was committed
+				err = ctxErr
+			} else {
+				// the callback committed or rolled back itself, and didn't fail
+				warn(WarnDoubleClose, describeTx(id))
+				err = nil
+			}
+		}
+		endCommit(err)
+		options.logEnd("commit", started, err)
+		if err != nil {
+			// the transaction is over either way
+			options.runAfterRollback(err)
+			if unknown := options.outcomeUnknown(describeTx(id), "commit", err); unknown != nil {
+				err = unknown
+			}
+			return describedError(PhaseRelease, describeTx(id), err)
+		}
+		return nil
+	}
+}
+
+// TxDeadline gives the whole transaction d to finish: then the statements run with TxContext are
+// cancelled and the transaction is rolled back, even when the callback ignores the context.
+// The callback error is joined with context.DeadlineExceeded.
+func TxDeadline(d time.Duration) TxOption {
+	return func(options *txOptions) {
+		options.deadline = d
+	}
+}
+
+// TxClock makes TxDeadline, the durations logged by WithQueryLogging and the time
+// of the idempotency keys of WithIdempotencyKey come from clock.
+func TxClock(clock Clock) TxOption {
+	return func(options *txOptions) {
+		options.clock = clock
+	}
+}
+
+// TxValue adds a value to the context of the transaction, see TxContext.
+func TxValue(key, value any) TxOption {
+	return func(options *txOptions) {
+		options.values = append(options.values, txValue{key: key, value: value})
+	}
+}
+
+// context derives the context of a transaction from ctx with the TxValue and TxDeadline options.
+func (options *txOptions) context(ctx context.Context) (context.Context, context.CancelFunc) {
+	for _, v := range options.values {
+		ctx = context.WithValue(ctx, v.key, v.value)
+	}
+	if options.deadline > 0 {
+		return withClockTimeout(ctx, clockOr(options.clock), options.deadline)
+	}
+	return ctx, func() {}
+}
+
+// txContexts maps the running transactions to their contexts, when these aren't context.Background().
+var txContexts sync.Map
+
+// TxContext returns the context a transaction of RunTransaction or RunTransactionCtx was begun with,
+// carrying its TxValue values and TxDeadline deadline; context.Background() for other transactions.
+// Pass it to the ExecContext and QueryContext calls of the callback so they can be cancelled.
+func TxContext(tx *sql.Tx) context.Context {
+	ctx, ok := txContexts.Load(tx)
+	if !ok {
+		return context.Background()
+	}
+	return ctx.(context.Context)
+}
+
+var (
+	// ErrDryRun is what a successful dry-run transaction returns with the ReportDryRun option.
+	ErrDryRun = errors.New("dry run: transaction rolled back")
+	// ErrNestedDryRun is returned by a dry-run transaction started while another one runs on the same database.
+	ErrNestedDryRun = errors.New("dry run is already in progress on this database")
+)
+
+// ReportDryRun makes a successful dry-run transaction return ErrDryRun instead of nil,
+// so the calling code can tell that nothing was committed.
+func ReportDryRun() TxOption {
+	return func(options *txOptions) {
+		options.reportDryRun = true
+	}
+}
+
+var dryRuns sync.Map // *sql.DB with a dry-run transaction in progress
+
+// RunTransactionDryRun runs the callback like RunTransaction does, but never commits:
+// the transaction is always rolled back and the callback's error is returned.
+//
+// Only one dry-run transaction at a time is allowed per database: they can't be nested,
+// and a concurrent one fails with ErrNestedDryRun too.
+func RunTransactionDryRun(db *sql.DB, opts ...TxOption) TxResource {
+	options := newTxOptions(opts)
+	tx := RunTransaction(db, append(opts, OnBeforeCommit(func(*sql.Tx) error {
+		return ErrDryRun
+	}))...)
+
+	return TxResource{
+		Use: func(callback func(tx *sql.Tx) error) error {
+			_, running := dryRuns.LoadOrStore(db, struct{}{})
+			if running {
+				return ErrNestedDryRun
+			}
+			defer dryRuns.Delete(db)
+
+			err := tx.Use(callback)
+			if withoutCheck(err) == ErrDryRun && !options.reportDryRun {
+				Observed(err)
+				return nil
+			}
+			return err
+		},
+	}
+}
+
+// RowsResource passes the result of a query to the callback and closes it afterwards.
+type RowsResource = Resource[*sql.Rows]
+
+// Queryer is what *sql.DB, *sql.Tx and *sql.Conn have in common,
+// so the query helpers work both inside and outside of transactions.
+type Queryer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// QueryRows runs the query with q (usually a *sql.Tx) for every Use.
+//
+// The callback may close the rows itself: *sql.Rows can be closed more than once.
+// That can't be told apart from rows closed by reaching their end, so there is no WarnDoubleClose.
+func QueryRows(q Queryer, query string, args ...interface{}) RowsResource {
+	description := describeQuery(query)
+	return RowsResource{
+		Description: description,
+		Use: func(callback func(rows *sql.Rows) error) error {
+			rows, err := q.QueryContext(context.Background(), query, args...)
+			if err != nil {
+				return checkResult(describedError(PhaseAcquire, description, err), description)
+			}
+			open := trackOpenAs("rows", description, 0)
+			defer open.release()
+			err = useCallback(callback, rows)
+			if err != nil {
+				err = secondaryError(err, description, describedError(PhaseRelease, description, rows.Close()))
+			} else {
+				err = describedError(PhaseRelease, description, rows.Close())
+			}
+			return checkResult(err, description)
+		},
+	}
+}
+
+// describeQuery is the description of a rows resource, with the query shortened to one line of 60 characters.
+func describeQuery(query string) string {
+	return "rows " + truncateQuery(query)
+}
+
+// truncateQuery returns query on one line, shortened to 60 bytes.
+func truncateQuery(query string) string {
+	query = strings.Join(strings.Fields(query), " ")
+	if len(query) > 60 {
+		query = query[:57] + "..."
+	}
+	return query
+}
+
+// NewConnResource reserves a single connection of db for every Use and returns it to the pool afterwards,
+// for session state like temporary tables or SQLite pragmas.
+// A connection closed by the callback is reported as WarnDoubleClose, not as an error.
+func NewConnResource(db *sql.DB) Resource[*sql.Conn] {
+	return Resource[*sql.Conn]{
+		Use: func(callback func(conn *sql.Conn) error) error {
+			conn, err := db.Conn(context.Background())
+			if err != nil {
+				return phaseError(PhaseAcquire, err)
+			}
+			bindDriverOf(conn, db)
+			err = useCallback(callback, conn)
+			unbindDriver(conn)
+			closeErr := conn.Close()
+			if errors.Is(closeErr, sql.ErrConnDone) {
+				warn(WarnDoubleClose, "conn")
+				closeErr = nil
+			}
+			return errors.Join(err, phaseError(PhaseRelease, closeErr))
+		},
+	}
+}
+
+// ErrDBShutdown is returned by SharedDBResource.Use after Shutdown.
+var ErrDBShutdown = errors.New("shared db resource is shut down")
+
+// SharedDBResource is a DBResource whose concurrent and nested Use calls share one *sql.DB,
+// so the connection pool of database/sql is not thrown away after every Use.
+//
+// The database is opened by the first Use and closed when the last active Use returns;
+// the close error goes to that last Use.
+type SharedDBResource struct {
+	driverName, datasourceName string
+
+	mu       sync.Mutex
+	db       *sql.DB
+	refs     int
+	shutdown bool
+}
+
+func NewSharedDBResource(driverName, datasourceName string) *SharedDBResource {
+	return &SharedDBResource{driverName: driverName, datasourceName: datasourceName}
+}
+
+func (r *SharedDBResource) Use(callback func(db *sql.DB) error) (err error) {
+	db, err := r.acquire()
+	if err != nil {
+		return err
+	}
+	// deferred, so a callback panicking or calling runtime.Goexit doesn't keep the database open forever
+	defer func() {
+		err = errors.Join(err, r.release())
+	}()
+	return useCallback(callback, db)
+}
+
+// Describe returns "shared db" and the driver name, for SharedDBResource to be a DBResource:
+// the datasource isn't shown, it may contain a password.
+func (r *SharedDBResource) Describe() string {
+	return "shared db " + r.driverName
+}
+
+// DBResource returns r, which is a DBResource itself.
+//
+// Deprecated: use r as a DBResource.
+func (r *SharedDBResource) DBResource() DBResource {
+	return r
+}
+
+// Shutdown rejects further Use calls with ErrDBShutdown.
+// The database is closed right away if it's not in use, otherwise by the last active Use.
+func (r *SharedDBResource) Shutdown() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.shutdown = true
+	if r.refs == 0 && r.db != nil {
+		db := r.db
+		r.db = nil
+		unbindDriver(db)
+		return db.Close()
+	}
+	return nil
+}
+
+func (r *SharedDBResource) acquire() (*sql.DB, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.shutdown {
+		return nil, ErrDBShutdown
+	}
+	if r.db == nil {
+		db, err := sql.Open(r.driverName, r.datasourceName)
+		if err != nil {
+			return nil, err
+		}
+		bindDriver(db, r.driverName)
+		r.db = db
+	}
+	r.refs++
+	return r.db, nil
+}
+
+func (r *SharedDBResource) release() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.refs--
+	if r.refs > 0 {
+		return nil
+	}
+	// closing under the lock: a concurrent Use waits and opens a fresh one
+	db := r.db
+	r.db = nil
+	unbindDriver(db)
+	return db.Close()
+}
@@ -0,0 +1,640 @@
+package resource_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+func insertItem(tx *sql.Tx, name string) error {
+	_, err := tx.Exec("INSERT INTO items (name) VALUES (?)", name)
+	return err
+}
+
+func TestRunTransactionCommits(t *testing.T) {
+	db := openDB(t)
+	warnings := captureWarnings(t)
+	err := resource.RunTransaction(db).Use(func(tx *sql.Tx) error {
+		return insertItem(tx, "a")
+	})
+	if err != nil {
+		t.Fatalf("Use: %v", err)
+	}
+	if n := countItems(t, db); n != 1 {
+		t.Errorf("%d rows committed, want 1", n)
+	}
+	if len(warnings()) != 0 {
+		t.Errorf("warnings %v, want none", warnings())
+	}
+}
+
+func TestRunTransactionCallbackCommitsItself(t *testing.T) {
+	db := openDB(t)
+	warnings := captureWarnings(t)
+	err := resource.RunTransaction(db).Use(func(tx *sql.Tx) error {
+		err := insertItem(tx, "a")
+		if err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+	if err != nil {
+		t.Fatalf("Use: %v, want nil", err)
+	}
+	if n := countItems(t, db); n != 1 {
+		t.Errorf("%d rows committed, want 1", n)
+	}
+	if !hasWarning(warnings(), resource.WarnDoubleClose) {
+		t.Errorf("no WarnDoubleClose in %v", warnings())
+	}
+}
+
+func TestRunTransactionCallbackRollsBackItself(t *testing.T) {
+	db := openDB(t)
+	warnings := captureWarnings(t)
+	err := resource.RunTransaction(db).Use(func(tx *sql.Tx) error {
+		err := insertItem(tx, "a")
+		if err != nil {
+			return err
+		}
+		return tx.Rollback()
+	})
+	if err != nil {
+		t.Fatalf("Use: %v, want nil", err)
+	}
+	if n := countItems(t, db); n != 0 {
+		t.Errorf("%d rows committed, want 0", n)
+	}
+	if !hasWarning(warnings(), resource.WarnDoubleClose) {
+		t.Errorf("no WarnDoubleClose in %v", warnings())
+	}
+}
+
+func TestRunTransactionCallbackFailsAfterRollingBack(t *testing.T) {
+	db := openDB(t)
+	boom := errors.New("boom")
+	err := resource.RunTransaction(db).Use(func(tx *sql.Tx) error {
+		tx.Rollback()
+		return boom
+	})
+	if !errors.Is(err, boom) {
+		t.Fatalf("Use: %v, want boom", err)
+	}
+	if errors.Is(err, sql.ErrTxDone) {
+		t.Errorf("Use: %v, want no sql.ErrTxDone", err)
+	}
+}
+
+func TestRunTransactionCtxCancelledBeforeCommit(t *testing.T) {
+	db := openDB(t)
+	warnings := captureWarnings(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	err := resource.RunTransactionCtx(ctx, db).Use(func(tx *sql.Tx) error {
+		err := insertItem(tx, "a")
+		if err != nil {
+			return err
+		}
+		cancel()
+		// wait for database/sql to roll back, the resource's Commit then gets sql.ErrTxDone
+		for !errors.Is(insertItem(tx, "b"), sql.ErrTxDone) {
+			time.Sleep(time.Millisecond)
+		}
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Use: %v, want context.Canceled", err)
+	}
+	var resourceErr *resource.ResourceError
+	if !errors.As(err, &resourceErr) || resourceErr.Phase != resource.PhaseRelease {
+		t.Errorf("Use: %v, want a release *ResourceError", err)
+	}
+	if n := countItems(t, db); n != 0 {
+		t.Errorf("%d rows committed, want 0", n)
+	}
+	if hasWarning(warnings(), resource.WarnDoubleClose) {
+		t.Errorf("WarnDoubleClose reported for a cancelled context")
+	}
+}
+
+func TestTxDeadlineOnClock(t *testing.T) {
+	db := openDB(t)
+	clock := newFakeClock()
+	err := resource.RunTransaction(db, resource.TxDeadline(time.Minute), resource.TxClock(clock)).Use(func(tx *sql.Tx) error {
+		ctx := resource.TxContext(tx)
+		clock.Advance(time.Minute)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want context.DeadlineExceeded", err)
+	}
+}
+
+// slowQuery counts the rows of a cross join big enough to run for minutes.
+const slowQuery = `
+	WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM c WHERE x < 100000)
+	SELECT COUNT(*) FROM c AS a, c AS b`
+
+func TestTxDeadlineInterruptsSlowQuery(t *testing.T) {
+	db := openDB(t)
+	start := time.Now()
+	err := resource.RunTransaction(db, resource.TxDeadline(50*time.Millisecond)).Use(func(tx *sql.Tx) error {
+		err := insertItem(tx, "rolled back")
+		if err != nil {
+			return err
+		}
+		var n int64
+		return tx.QueryRowContext(resource.TxContext(tx), slowQuery).Scan(&n)
+	})
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("the query ran for %v, want it interrupted at the deadline", elapsed)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want context.DeadlineExceeded", err)
+	}
+	if n := countItems(t, db); n != 0 {
+		t.Errorf("%d items after the deadline, want the transaction rolled back", n)
+	}
+}
+
+func TestTxDeadlineRollsBackLateCallback(t *testing.T) {
+	db := openDB(t)
+	err := resource.RunTransaction(db, resource.TxDeadline(20*time.Millisecond)).Use(func(tx *sql.Tx) error {
+		err := insertItem(tx, "rolled back")
+		if err != nil {
+			return err
+		}
+		time.Sleep(100 * time.Millisecond) // ignoring the context
+		return nil
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want context.DeadlineExceeded", err)
+	}
+	if n := countItems(t, db); n != 0 {
+		t.Errorf("%d items after the deadline, want the transaction rolled back", n)
+	}
+}
+
+func TestTxValue(t *testing.T) {
+	type key string
+	db := openDB(t)
+	parent := context.WithValue(context.Background(), key("request"), "r-1")
+	err := resource.RunTransactionCtx(parent, db, resource.TxValue(key("tenant"), "acme"), resource.TxDeadline(time.Minute)).Use(func(tx *sql.Tx) error {
+		ctx := resource.TxContext(tx)
+		if ctx.Value(key("tenant")) != "acme" || ctx.Value(key("request")) != "r-1" {
+			t.Errorf("context values = %v, %v, want the TxValue and the parent value", ctx.Value(key("tenant")), ctx.Value(key("request")))
+		}
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("context without the TxDeadline")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSharedDBResourceNested(t *testing.T) {
+	driver, name := countingSQLite(t)
+	shared := resource.NewSharedDBResource(name, filepath.Join(t.TempDir(), "test.db"))
+	defer shared.Shutdown()
+
+	var outer *sql.DB
+	err := shared.Use(func(db *sql.DB) error {
+		outer = db
+		if err := db.Ping(); err != nil {
+			return err
+		}
+		return shared.Use(func(inner *sql.DB) error {
+			if inner != db {
+				t.Error("nested Use got another *sql.DB")
+			}
+			return inner.Ping()
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts := driver.Counts(); counts.Opens != 1 || counts.Open() != 0 {
+		t.Errorf("counts = %+v, want one connection, closed", counts)
+	}
+	if err := outer.Ping(); err == nil {
+		t.Error("database still open after the last Use")
+	}
+}
+
+func TestSharedDBResourceConcurrent(t *testing.T) {
+	driver, name := countingSQLite(t)
+	shared := resource.NewSharedDBResource(name, filepath.Join(t.TempDir(), "test.db"))
+	defer shared.Shutdown()
+
+	hold := make(chan struct{})
+	holding := make(chan *sql.DB)
+	go shared.Use(func(db *sql.DB) error {
+		holding <- db
+		<-hold
+		return nil
+	})
+	held := <-holding
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := shared.Use(func(db *sql.DB) error {
+				if db != held {
+					t.Error("concurrent Use got another *sql.DB")
+				}
+				var one int
+				return db.QueryRow("SELECT 1").Scan(&one)
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if err := held.Ping(); err != nil {
+		t.Errorf("database closed while a Use is active: %v", err)
+	}
+	close(hold)
+	eventually(t, func() bool { return held.Ping() != nil })
+	if counts := driver.Counts(); counts.Open() != 0 {
+		t.Errorf("counts = %+v, connections left open", counts)
+	}
+}
+
+func TestSharedDBResourceShutdown(t *testing.T) {
+	_, name := countingSQLite(t)
+	shared := resource.NewSharedDBResource(name, filepath.Join(t.TempDir(), "test.db"))
+	err := shared.Use(func(db *sql.DB) error {
+		return db.Ping()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := shared.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+	err = shared.Use(func(db *sql.DB) error {
+		t.Error("callback called after Shutdown")
+		return nil
+	})
+	if !errors.Is(err, resource.ErrDBShutdown) {
+		t.Errorf("Use after Shutdown = %v, want %v", err, resource.ErrDBShutdown)
+	}
+}
+
+func TestSharedDBResourceReleasedOnPanicAndGoexit(t *testing.T) {
+	driver, name := countingSQLite(t)
+	shared := resource.NewSharedDBResource(name, filepath.Join(t.TempDir(), "test.db"))
+
+	var panicked *sql.DB
+	func() {
+		defer func() {
+			if p := recover(); p != "boom" {
+				t.Errorf("recovered %v, want the panic of the callback", p)
+			}
+		}()
+		_ = shared.Use(func(db *sql.DB) error {
+			panicked = db
+			if err := db.Ping(); err != nil {
+				return err
+			}
+			panic("boom")
+		})
+	}()
+	if err := panicked.Ping(); err == nil {
+		t.Error("database still open after the panicking Use")
+	}
+
+	// like t.Fatal in the callback
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = shared.Use(func(db *sql.DB) error {
+			if err := db.Ping(); err != nil {
+				return err
+			}
+			runtime.Goexit()
+			return nil
+		})
+	}()
+	<-done
+
+	if err := shared.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+	if counts := driver.Counts(); counts.Opens != 2 || counts.Open() != 0 {
+		t.Errorf("counts = %+v, want the connections of both Uses closed", counts)
+	}
+}
+
+func TestTransactionHooks(t *testing.T) {
+	errCallback, errHook := errors.New("callback"), errors.New("hook")
+	tests := []struct {
+		name        string
+		callback    func(tx *sql.Tx) error
+		hookErr     error
+		events      []string
+		wantErr     error
+		wantRelease bool
+		committed   int
+	}{
+		{"commit", func(tx *sql.Tx) error { return insertItem(tx, "a") }, nil,
+			[]string{"callback", "before commit"}, nil, false, 2},
+		{"callback fails", func(tx *sql.Tx) error { insertItem(tx, "a"); return errCallback }, nil,
+			[]string{"callback", "after rollback: callback"}, errCallback, false, 0},
+		{"before commit hook fails", func(tx *sql.Tx) error { return insertItem(tx, "a") }, errHook,
+			[]string{"callback", "before commit", "after rollback: hook"}, errHook, false, 0},
+		{"commit fails", func(tx *sql.Tx) error {
+			_, err := tx.Exec("INSERT INTO children (parent) VALUES (42)") // checked at commit
+			return err
+		}, nil, []string{"callback", "before commit", "after rollback: FOREIGN KEY constraint failed"}, nil, true, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db")+"?_foreign_keys=1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			_, err = db.Exec(`
+				CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT NOT NULL);
+				CREATE TABLE children (parent INTEGER REFERENCES items (id) DEFERRABLE INITIALLY DEFERRED);
+			`)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var events []string
+			tx := resource.RunTransaction(db,
+				resource.OnBeforeCommit(func(tx *sql.Tx) error {
+					events = append(events, "before commit")
+					if test.hookErr != nil {
+						return test.hookErr
+					}
+					return insertItem(tx, "outbox") // inside the transaction
+				}),
+				resource.OnAfterRollback(func(cause error) {
+					events = append(events, "after rollback: "+cause.Error())
+				}),
+			)
+			err = tx.Use(func(tx *sql.Tx) error {
+				events = append(events, "callback")
+				return test.callback(tx)
+			})
+
+			if !slices.Equal(events, test.events) {
+				t.Errorf("events = %q, want %q", events, test.events)
+			}
+			switch {
+			case test.wantRelease:
+				if phaseOf(t, err) != resource.PhaseRelease {
+					t.Errorf("Use = %v, want a release error", err)
+				}
+			case test.wantErr != nil:
+				if !errors.Is(err, test.wantErr) {
+					t.Errorf("Use = %v, want %v", err, test.wantErr)
+				}
+			case err != nil:
+				t.Errorf("Use = %v", err)
+			}
+			if n := countItems(t, db); n != test.committed {
+				t.Errorf("%d rows committed, want %d", n, test.committed)
+			}
+		})
+	}
+}
+
+func TestRunTransactionDryRunRollsBack(t *testing.T) {
+	db := openDB(t)
+	err := resource.RunTransactionDryRun(db).Use(func(tx *sql.Tx) error {
+		err := insertItem(tx, "a")
+		if err != nil {
+			return err
+		}
+		var n int
+		err = tx.QueryRow("SELECT COUNT(*) FROM items").Scan(&n)
+		if n != 1 {
+			t.Errorf("%d rows inside the dry run, want 1", n)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Use: %v", err)
+	}
+	if n := countItems(t, db); n != 0 {
+		t.Errorf("%d rows committed by a dry run", n)
+	}
+}
+
+func TestRunTransactionDryRunErrors(t *testing.T) {
+	db := openDB(t)
+	errBoom := errors.New("boom")
+
+	err := resource.RunTransactionDryRun(db).Use(func(tx *sql.Tx) error {
+		insertItem(tx, "a")
+		return errBoom
+	})
+	if !errors.Is(err, errBoom) {
+		t.Errorf("failed dry run = %v, want %v", err, errBoom)
+	}
+
+	err = resource.RunTransactionDryRun(db, resource.ReportDryRun()).Use(func(tx *sql.Tx) error {
+		return insertItem(tx, "a")
+	})
+	if !errors.Is(err, resource.ErrDryRun) {
+		t.Errorf("dry run with ReportDryRun = %v, want %v", err, resource.ErrDryRun)
+	}
+
+	err = resource.RunTransactionDryRun(db).Use(func(*sql.Tx) error {
+		return resource.RunTransactionDryRun(db).Use(func(tx *sql.Tx) error {
+			t.Error("nested dry run started")
+			return nil
+		})
+	})
+	if !errors.Is(err, resource.ErrNestedDryRun) {
+		t.Errorf("nested dry run = %v, want %v", err, resource.ErrNestedDryRun)
+	}
+	if n := countItems(t, db); n != 0 {
+		t.Errorf("%d rows committed by a dry run", n)
+	}
+
+	err = resource.RunTransactionDryRun(db).Use(func(*sql.Tx) error { return nil })
+	if err != nil {
+		t.Errorf("dry run after the others = %v", err)
+	}
+}
+
+func TestRowsClosedByCallback(t *testing.T) {
+	db := openDB(t)
+	warnings := captureWarnings(t)
+	err := resource.QueryRows(db, "SELECT id FROM items").Use(func(rows *sql.Rows) error {
+		return rows.Close()
+	})
+	if err != nil {
+		t.Errorf("Use = %v, want nil", err)
+	}
+	if len(warnings()) != 0 {
+		t.Errorf("warnings %v, closing rows twice is fine", warnings())
+	}
+}
+
+func TestConnClosedByCallback(t *testing.T) {
+	db := openDB(t)
+	warnings := captureWarnings(t)
+	err := resource.NewConnResource(db).Use(func(conn *sql.Conn) error {
+		_, err := conn.ExecContext(context.Background(), "INSERT INTO items (name) VALUES ('a')")
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	})
+	if err != nil {
+		t.Errorf("Use = %v, want nil", err)
+	}
+	if n := countWarnings(warnings(), resource.WarnDoubleClose); n != 1 {
+		t.Errorf("%d WarnDoubleClose in %v, want one", n, warnings())
+	}
+	if n := countItems(t, db); n != 1 {
+		t.Errorf("%d rows, want 1", n)
+	}
+}
+
+func TestDBResourceConcurrentUses(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db := resource.NewDBResource("sqlite3", path)
+	var mu sync.Mutex
+	seen := make(map[*sql.DB]bool)
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := db.Use(func(db *sql.DB) error {
+				mu.Lock()
+				seen[db] = true
+				mu.Unlock()
+				return db.Ping()
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if len(seen) != 10 {
+		t.Errorf("%d distinct databases for 10 Uses, want every Use to open its own", len(seen))
+	}
+}
+
+func TestDBResourceClosesOncePerUse(t *testing.T) {
+	driver, name := countingSQLite(t)
+	db := resource.NewDBResource(name, filepath.Join(t.TempDir(), "test.db"))
+	errCallback := errors.New("callback")
+	for i := range 6 {
+		err := db.Use(func(db *sql.DB) error {
+			if err := db.Ping(); err != nil {
+				return err
+			}
+			if i%2 == 1 {
+				return errCallback
+			}
+			return nil
+		})
+		if i%2 == 1 && !errors.Is(err, errCallback) || i%2 == 0 && err != nil {
+			t.Errorf("Use %d = %v", i, err)
+		}
+	}
+	if counts := driver.Counts(); counts.Opens != 6 || counts.Closes != 6 {
+		t.Errorf("counts = %+v, want 6 connections opened and closed", counts)
+	}
+}
+
+func TestRunTransactionReleasesOnEveryPath(t *testing.T) {
+	errCallback, errHook := errors.New("callback"), errors.New("hook")
+	tests := []struct {
+		name     string
+		opts     []resource.TxOption
+		callback func(tx *sql.Tx) error
+	}{
+		{"commit", nil, func(tx *sql.Tx) error { return insertItem(tx, "a") }},
+		{"callback fails", nil, func(tx *sql.Tx) error { insertItem(tx, "a"); return errCallback }},
+		{"callback commits itself", nil, func(tx *sql.Tx) error { return tx.Commit() }},
+		{"callback rolls back itself", nil, func(tx *sql.Tx) error { return tx.Rollback() }},
+		{"callback panics", nil, func(tx *sql.Tx) error { panic("boom") }},
+		{"before commit hook fails", []resource.TxOption{
+			resource.OnBeforeCommit(func(tx *sql.Tx) error { return errHook }),
+		}, func(tx *sql.Tx) error { return insertItem(tx, "a") }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			driver, name := countingSQLite(t)
+			db, err := sql.Open(name, filepath.Join(t.TempDir(), "test.db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			_, err = db.Exec("CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT NOT NULL)")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for range 3 {
+				resource.RecoverToError(resource.RunTransaction(db, test.opts...)).Use(test.callback)
+			}
+			counts := driver.Counts()
+			if counts.Begins != 3 || counts.Commits+counts.Rollbacks != counts.Begins {
+				t.Errorf("counts = %+v, want every transaction ended once", counts)
+			}
+			if inUse := db.Stats().InUse; inUse != 0 {
+				t.Errorf("%d connections still in use", inUse)
+			}
+		})
+	}
+}
+
+func TestDBResourceForms(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "forms.db")
+	db := resource.NewDBResource("sqlite3", path)
+	if got, want := fmt.Sprint(db), "db sqlite3 "+path; got != want || db.Describe() != want {
+		t.Errorf("String = %q, Describe = %q, want %q", got, db.Describe(), want)
+	}
+
+	// FromUsable and DB go between the interface and the Resource of the generic decorators
+	r := resource.FromUsable(db)
+	if r.Describe() != db.Describe() {
+		t.Errorf("Description of FromUsable = %q, want %q", r.Describe(), db.Describe())
+	}
+	back := resource.DB(resource.WithRetry(context.Background(), r, resource.FixedDelay(0, 1)))
+	err := back.Use(func(db *sql.DB) error {
+		_, err := db.Exec("CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT NOT NULL)")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	shared := resource.NewSharedDBResource("sqlite3", path)
+	defer shared.Shutdown()
+	for name, dbr := range map[string]resource.DBResource{"db": db, "shared": shared} {
+		_, err := resource.Exec(resource.FromUsable(dbr), "INSERT INTO items (name) VALUES (?)", name)
+		if err != nil {
+			t.Errorf("Exec through the %s resource = %v", name, err)
+		}
+	}
+	if shared.Describe() != "shared db sqlite3" {
+		t.Errorf("Describe of the shared resource = %q", shared.Describe())
+	}
+}
@@ -0,0 +1,87 @@
+package resource
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SQLiteOptions are the per-connection settings sqlite needs under concurrency.
+// Zero fields are left to the driver's defaults.
+type SQLiteOptions struct {
+	// BusyTimeout is how long a connection waits for a lock before failing with SQLITE_BUSY.
+	BusyTimeout time.Duration
+	// JournalMode is like "WAL" or "DELETE"; WAL lets readers run concurrently with a writer.
+	JournalMode string
+	ForeignKeys bool
+}
+
+// WithSQLiteOptions applies o to every connection of the pool, through the DSN parameters
+// of github.com/mattn/go-sqlite3, registered as "sqlite3", and checks with PRAGMAs that they took effect.
+// Other drivers fail at Use.
+func WithSQLiteOptions(o SQLiteOptions) DBOption {
+	return func(options *dbOptions) {
+		options.rewriteDSN = append(options.rewriteDSN, o.rewriteDSN)
+		options.checkOpened = append(options.checkOpened, o.check)
+	}
+}
+
+func (o SQLiteOptions) rewriteDSN(driverName, datasourceName string) (string, error) {
+	if driverName != "sqlite3" {
+		return "", fmt.Errorf("sqlite options: driver %q is not sqlite3", driverName)
+	}
+	var params []string
+	if o.BusyTimeout > 0 {
+		params = append(params, "_busy_timeout="+strconv.FormatInt(o.BusyTimeout.Milliseconds(), 10))
+	}
+	if o.JournalMode != "" {
+		params = append(params, "_journal_mode="+o.JournalMode)
+	}
+	if o.ForeignKeys {
+		params = append(params, "_foreign_keys=1")
+	}
+	if len(params) == 0 {
+		return datasourceName, nil
+	}
+	separator := "?"
+	if strings.Contains(datasourceName, "?") {
+		separator = "&"
+	}
+	return datasourceName + separator + strings.Join(params, "&"), nil
+}
+
+func (o SQLiteOptions) check(db *sql.DB) error {
+	if o.BusyTimeout > 0 {
+		var ms int64
+		err := db.QueryRow("PRAGMA busy_timeout").Scan(&ms)
+		if err != nil {
+			return err
+		}
+		if ms != o.BusyTimeout.Milliseconds() {
+			return fmt.Errorf("sqlite options: busy_timeout is %dms, not %dms", ms, o.BusyTimeout.Milliseconds())
+		}
+	}
+	if o.JournalMode != "" {
+		var mode string
+		err := db.QueryRow("PRAGMA journal_mode").Scan(&mode)
+		if err != nil {
+			return err
+		}
+		if !strings.EqualFold(mode, o.JournalMode) {
+			return fmt.Errorf("sqlite options: journal_mode is %s, not %s", mode, o.JournalMode)
+		}
+	}
+	if o.ForeignKeys {
+		var on bool
+		err := db.QueryRow("PRAGMA foreign_keys").Scan(&on)
+		if err != nil {
+			return err
+		}
+		if !on {
+			return fmt.Errorf("sqlite options: foreign_keys is off")
+		}
+	}
+	return nil
+}
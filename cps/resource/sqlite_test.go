@@ -0,0 +1,118 @@
+package resource_test
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+	"github.com/Q69K/using-cps-in-golang/cps/sqlerr"
+)
+
+func TestSQLiteOptionsApplied(t *testing.T) {
+	options := resource.SQLiteOptions{BusyTimeout: 2 * time.Second, JournalMode: "WAL", ForeignKeys: true}
+	db := resource.NewDBResource("sqlite3", filepath.Join(t.TempDir(), "test.db"), resource.WithSQLiteOptions(options))
+	err := db.Use(func(db *sql.DB) error {
+		db.SetMaxIdleConns(0) // every statement on a new connection
+		var ms int64
+		var mode string
+		var foreignKeys bool
+		for range 3 {
+			err := db.QueryRow("PRAGMA busy_timeout").Scan(&ms)
+			if err == nil {
+				err = db.QueryRow("PRAGMA journal_mode").Scan(&mode)
+			}
+			if err == nil {
+				err = db.QueryRow("PRAGMA foreign_keys").Scan(&foreignKeys)
+			}
+			if err != nil {
+				return err
+			}
+			if ms != 2000 || mode != "wal" || !foreignKeys {
+				t.Errorf("busy_timeout %d, journal_mode %s, foreign_keys %v on a connection", ms, mode, foreignKeys)
+			}
+		}
+
+		_, err := db.Exec(`
+			CREATE TABLE parents (id INTEGER PRIMARY KEY);
+			CREATE TABLE children (parent INTEGER REFERENCES parents (id));
+		`)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec("INSERT INTO children VALUES (42)")
+		if !sqlerr.IsForeignKeyViolation(err) {
+			t.Errorf("insert of a missing parent = %v, want a foreign key violation", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSQLiteOptionsChecked(t *testing.T) {
+	// the DSN parameter wins over the one of the option, the check tells
+	path := filepath.Join(t.TempDir(), "test.db") + "?_busy_timeout=0"
+	err := resource.NewDBResource("sqlite3", path, resource.WithSQLiteOptions(resource.SQLiteOptions{BusyTimeout: time.Second})).Use(func(*sql.DB) error {
+		t.Error("callback called with options not in effect")
+		return nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "busy_timeout is 0ms") {
+		t.Errorf("Use = %v, want the busy_timeout check to fail", err)
+	}
+}
+
+func TestSQLiteOptionsOtherDriver(t *testing.T) {
+	err := resource.NewDBResource("recording", t.TempDir(), resource.WithSQLiteOptions(resource.SQLiteOptions{ForeignKeys: true})).Use(func(*sql.DB) error {
+		t.Error("callback called for another driver")
+		return nil
+	})
+	if err == nil || !strings.Contains(err.Error(), `driver "recording" is not sqlite3`) {
+		t.Errorf("Use = %v, want the driver rejected", err)
+	}
+}
+
+// writeWhileLocked inserts into the database of path while a transaction of another connection holds its write lock
+// for 50ms, returning the insert error.
+func writeWhileLocked(t *testing.T, path string, writer resource.DBResource) error {
+	t.Helper()
+	holder := resource.NewDBResource("sqlite3", path)
+	locked, unlocked := make(chan struct{}), make(chan error, 1)
+	go func() {
+		unlocked <- holder.Use(func(db *sql.DB) error {
+			return resource.RunTransaction(db).Use(func(tx *sql.Tx) error {
+				_, err := tx.Exec("INSERT INTO items (name) VALUES ('holder')")
+				close(locked)
+				time.Sleep(50 * time.Millisecond)
+				return err
+			})
+		})
+	}()
+	<-locked
+	_, err := resource.Exec(resource.FromUsable(writer), "INSERT INTO items (name) VALUES ('writer')")
+	if err := <-unlocked; err != nil {
+		t.Fatal(err)
+	}
+	return err
+}
+
+func TestSQLiteBusyTimeoutTwoWriters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	_, err := resource.Exec(resource.FromUsable(resource.NewDBResource("sqlite3", path)), "CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT NOT NULL)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// sqlite itself doesn't wait for locks, the driver's default of 5s is a DSN parameter
+	err = writeWhileLocked(t, path, resource.NewDBResource("sqlite3", path+"?_busy_timeout=0"))
+	if !sqlerr.IsBusy(err) {
+		t.Errorf("insert without a busy timeout = %v, want SQLITE_BUSY", err)
+	}
+	err = writeWhileLocked(t, path, resource.NewDBResource("sqlite3", path, resource.WithSQLiteOptions(resource.SQLiteOptions{BusyTimeout: time.Second})))
+	if err != nil {
+		t.Errorf("insert with a busy timeout = %v, want it to wait for the lock", err)
+	}
+}
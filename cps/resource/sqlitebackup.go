@@ -0,0 +1,147 @@
+package resource
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// BackupSQLite writes a consistent copy of the sqlite database of db to destPath, which is replaced atomically:
+// it never contains a partial backup.
+//
+// It uses VACUUM INTO, which reads in a transaction of its own so concurrent writers can't tear the copy.
+// Old sqlite versions without it get a copy of the database file made inside a read transaction,
+// which is consistent in rollback journal mode but misses what a WAL file holds.
+func BackupSQLite(db DBResource, destPath string) error {
+	return db.Use(func(db *sql.DB) error {
+		return NewTempDirResource(filepath.Dir(destPath), ".backup-*").Use(func(dir string) error {
+			backup := filepath.Join(dir, filepath.Base(destPath))
+			_, err := db.Exec("VACUUM INTO ?", backup)
+			if err != nil && strings.Contains(err.Error(), "syntax error") {
+				err = copySQLiteFile(db, backup)
+			}
+			if err != nil {
+				return err
+			}
+			err = os.Rename(backup, destPath)
+			if err != nil {
+				return err
+			}
+			return syncDir(filepath.Dir(destPath))
+		})
+	})
+}
+
+func copySQLiteFile(db *sql.DB, dest string) error {
+	return RunTransaction(db).Use(func(tx *sql.Tx) error {
+		var path string
+		// reading takes the shared lock, writers can't commit until the transaction ends
+		err := tx.QueryRow("SELECT file FROM pragma_database_list WHERE name = 'main'").Scan(&path)
+		if err != nil {
+			return err
+		}
+		if path == "" {
+			return fmt.Errorf("backup: in-memory database can't be copied")
+		}
+		return NewReadFileResource(path).Use(func(r io.Reader) error {
+			return NewAtomicFileResource(dest, 0600, Sync()).Use(func(fd *os.File) error {
+				_, err := io.Copy(fd, r)
+				return err
+			})
+		})
+	})
+}
+
+// RestoreSQLite replaces the tables of the sqlite database of db with the tables of the backup at srcPath,
+// with their indexes and AUTOINCREMENT counters, all in one transaction.
+// Tables of db missing from the backup are left alone.
+func RestoreSQLite(srcPath string, db DBResource) error {
+	if _, err := os.Stat(srcPath); err != nil {
+		return err // ATTACH would create an empty database
+	}
+	return db.Use(func(db *sql.DB) error {
+		// ATTACH is per connection and not allowed inside a transaction
+		return NewConnResource(db).Use(func(conn *sql.Conn) error {
+			ctx := context.Background()
+			_, err := conn.ExecContext(ctx, "ATTACH DATABASE ? AS backup", srcPath)
+			if err != nil {
+				return err
+			}
+			err = restoreAttached(ctx, conn)
+			_, detachErr := conn.ExecContext(ctx, "DETACH DATABASE backup")
+			return errors.Join(err, detachErr)
+		})
+	})
+}
+
+func restoreAttached(ctx context.Context, conn *sql.Conn) (err error) {
+	type object struct{ kind, name, sql string }
+	var objects []object
+	err = QueryRows(conn, `SELECT type, name, sql FROM backup.sqlite_master
+		WHERE sql IS NOT NULL AND name NOT LIKE 'sqlite_%' ORDER BY type = 'index', rowid`).Use(func(rows *sql.Rows) error {
+		for rows.Next() {
+			var o object
+			err := rows.Scan(&o.kind, &o.name, &o.sql)
+			if err != nil {
+				return err
+			}
+			objects = append(objects, o)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return err
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			err = secondaryError(err, "tx", phaseError(PhaseRelease, tx.Rollback()))
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	for _, o := range objects {
+		name := QuoteIdentifier(o.name)
+		if o.kind == "table" {
+			_, err = tx.Exec("DROP TABLE IF EXISTS main." + name)
+		} else {
+			_, err = tx.Exec("DROP " + o.kind + " IF EXISTS main." + name)
+		}
+		if err != nil {
+			return err
+		}
+		// unqualified, so it creates in main
+		_, err = tx.Exec(o.sql)
+		if err != nil {
+			return err
+		}
+		if o.kind == "table" {
+			_, err = tx.Exec("INSERT INTO main." + name + " SELECT * FROM backup." + name)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	var sequences int
+	err = tx.QueryRow("SELECT COUNT(*) FROM backup.sqlite_master WHERE name = 'sqlite_sequence'").Scan(&sequences)
+	if err != nil || sequences == 0 {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM main.sqlite_sequence WHERE name IN (SELECT name FROM backup.sqlite_sequence)`)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("INSERT INTO main.sqlite_sequence SELECT * FROM backup.sqlite_sequence")
+	return err
+}
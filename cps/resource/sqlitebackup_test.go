@@ -0,0 +1,183 @@
+package resource_test
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/group"
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+	"github.com/Q69K/using-cps-in-golang/cps/sqlerr"
+)
+
+const namesTable = "CREATE TABLE names (id INTEGER PRIMARY KEY AUTOINCREMENT, name VARCHAR NOT NULL)"
+
+// namesDB returns a resource of a new sqlite database with the names table holding names.
+func namesDB(t *testing.T, names ...string) (resource.DBResource, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "names.db")
+	db := resource.NewDBResource("sqlite3", path)
+	err := db.Use(func(db *sql.DB) error {
+		_, err := db.Exec(namesTable)
+		for _, name := range names {
+			if err != nil {
+				return err
+			}
+			_, err = db.Exec("INSERT INTO names (name) VALUES (?)", name)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, path
+}
+
+// names returns the rows of the names table as "id name".
+func names(t *testing.T, db resource.DBResource) []string {
+	t.Helper()
+	var names []string
+	err := db.Use(func(db *sql.DB) error {
+		return resource.QueryRows(db, "SELECT id, name FROM names ORDER BY id").Use(func(rows *sql.Rows) error {
+			for rows.Next() {
+				var id int
+				var name string
+				if err := rows.Scan(&id, &name); err != nil {
+					return err
+				}
+				names = append(names, fmt.Sprint(id, " ", name))
+			}
+			return rows.Err()
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return names
+}
+
+func TestBackupAndRestoreSQLite(t *testing.T) {
+	src, _ := namesDB(t, "alice", "bob", "carol")
+	err := src.Use(func(db *sql.DB) error {
+		_, err := db.Exec("DELETE FROM names WHERE name = 'carol'") // the next id is still 4
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	backup := filepath.Join(dir, "backup.db")
+	if err := resource.BackupSQLite(src, backup); err != nil {
+		t.Fatal(err)
+	}
+	if got := dirEntries(t, dir); !slices.Equal(got, []string{"backup.db"}) {
+		t.Errorf("files %q next to the backup, want only the backup", got)
+	}
+
+	dest, _ := namesDB(t, "someone else")
+	if err := resource.RestoreSQLite(backup, dest); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := names(t, dest), names(t, src); !slices.Equal(got, want) {
+		t.Errorf("restored names %q, want %q", got, want)
+	}
+	err = dest.Use(func(db *sql.DB) error {
+		var id int64
+		id, err := resource.ExecReturningID(db, "INSERT INTO names (name) VALUES ('dave')")
+		if err == nil && id != 4 {
+			err = fmt.Errorf("inserted with id %d, want the AUTOINCREMENT counter of the backup, 4", id)
+		}
+		return err
+	})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBackupSQLiteWithConcurrentWriter(t *testing.T) {
+	src, _ := namesDB(t)
+	dir := t.TempDir()
+	var stop atomic.Bool
+	writer := group.NewSafeWaitGroup()
+	writer.Run(func() {
+		err := src.Use(func(db *sql.DB) error {
+			for !stop.Load() {
+				// every transaction inserts a pair: a consistent copy has an even count
+				err := resource.RunTransaction(db).Use(func(tx *sql.Tx) error {
+					_, err := tx.Exec("INSERT INTO names (name) VALUES ('a'), ('b')")
+					return err
+				})
+				if err != nil && !sqlerr.IsBusy(err) {
+					return err
+				}
+				time.Sleep(100 * time.Microsecond) // lets the backups take the lock
+			}
+			return nil
+		})
+		if err != nil {
+			t.Error(err)
+		}
+	})
+
+	for i := range 5 {
+		time.Sleep(5 * time.Millisecond)
+		backup := filepath.Join(dir, fmt.Sprintf("backup%d.db", i))
+		if err := resource.BackupSQLite(src, backup); err != nil {
+			t.Error(err)
+			continue
+		}
+		err := resource.NewDBResource("sqlite3", backup).Use(func(db *sql.DB) error {
+			var check string
+			var count int
+			err := db.QueryRow("PRAGMA integrity_check").Scan(&check)
+			if err == nil {
+				err = db.QueryRow("SELECT COUNT(*) FROM names").Scan(&count)
+			}
+			if err == nil && (check != "ok" || count%2 != 0) {
+				err = fmt.Errorf("backup %d: integrity %q with %d names", i, check, count)
+			}
+			return err
+		})
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	stop.Store(true)
+	writer.Wait()
+}
+
+func TestBackupSQLiteFailureKeepsDestination(t *testing.T) {
+	dir := t.TempDir()
+	notDB := filepath.Join(dir, "not.db")
+	writeFile(t, notDB, "this is not a database file, sqlite refuses to read it")
+	backup := filepath.Join(dir, "backup.db")
+	writeFile(t, backup, "previous backup")
+
+	err := resource.BackupSQLite(resource.NewDBResource("sqlite3", notDB), backup)
+	if err == nil {
+		t.Fatal("backup of a file which isn't a database succeeded")
+	}
+	if got := readFile(t, backup); got != "previous backup" {
+		t.Errorf("destination = %q, want the previous backup", got)
+	}
+	if got := dirEntries(t, dir); !slices.Equal(got, []string{"backup.db", "not.db"}) {
+		t.Errorf("files %q, want no temporary file left", got)
+	}
+}
+
+func TestRestoreSQLiteMissingBackup(t *testing.T) {
+	dest, _ := namesDB(t, "alice")
+	err := resource.RestoreSQLite(filepath.Join(t.TempDir(), "missing.db"), dest)
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("RestoreSQLite = %v, want fs.ErrNotExist", err)
+	}
+	if got := names(t, dest); !slices.Equal(got, []string{"1 alice"}) {
+		t.Errorf("names = %q, want them untouched", got)
+	}
+}
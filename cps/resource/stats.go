@@ -0,0 +1,165 @@
+package resource
+
+import (
+	"expvar"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HoldTimeBuckets are the upper bounds of the hold time histogram of ResourceStats.
+// Change it only before installing a collector.
+var HoldTimeBuckets = []time.Duration{
+	time.Millisecond, 10 * time.Millisecond, 100 * time.Millisecond, time.Second, 10 * time.Second,
+}
+
+// ResourceStats is a snapshot of the usage of one kind of resource.
+type ResourceStats struct {
+	Acquisitions    int64
+	AcquireFailures int64
+	UseFailures     int64
+	ReleaseFailures int64
+	// DowngradedReleaseErrors counts the release errors WithReleaseErrorPolicy didn't fail the Use for.
+	DowngradedReleaseErrors int64
+	// Open is how many resources are acquired and not released yet.
+	Open int64
+	// HoldTimes[i] counts the resources held for at most HoldTimeBuckets[i],
+	// the last element the ones held for longer.
+	HoldTimes []int64
+}
+
+// StatsCollector counts acquisitions and releases of the resources reporting to it:
+// NewDBResource as "db" and NewFileResource (with what is built on it) as "file".
+type StatsCollector struct {
+	clock Clock
+	kinds sync.Map // kind name to *kindStats
+}
+
+type kindStats struct {
+	acquisitions    atomic.Int64
+	acquireFailures atomic.Int64
+	useFailures     atomic.Int64
+	releaseFailures atomic.Int64
+	downgraded      atomic.Int64
+	open            atomic.Int64
+	holdTimes       []atomic.Int64
+	clock           Clock
+}
+
+var statsCollector atomic.Pointer[StatsCollector]
+
+// StatsOption configures NewStatsCollector.
+type StatsOption func(c *StatsCollector)
+
+// StatsClock makes the collector measure the hold times with clock.
+func StatsClock(clock Clock) StatsOption {
+	return func(c *StatsCollector) {
+		c.clock = clock
+	}
+}
+
+// NewStatsCollector creates an empty collector.
+func NewStatsCollector(opts ...StatsOption) *StatsCollector {
+	c := &StatsCollector{}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.clock = clockOr(c.clock)
+	return c
+}
+
+// SetStatsCollector makes the resources report to c, nil stops the reporting.
+func SetStatsCollector(c *StatsCollector) {
+	statsCollector.Store(c)
+}
+
+// Stats returns the stats of every kind reported so far.
+func (c *StatsCollector) Stats() map[string]ResourceStats {
+	stats := make(map[string]ResourceStats)
+	c.kinds.Range(func(kind, value any) bool {
+		s := value.(*kindStats)
+		holdTimes := make([]int64, len(s.holdTimes))
+		for i := range s.holdTimes {
+			holdTimes[i] = s.holdTimes[i].Load()
+		}
+		stats[kind.(string)] = ResourceStats{
+			Acquisitions:            s.acquisitions.Load(),
+			AcquireFailures:         s.acquireFailures.Load(),
+			UseFailures:             s.useFailures.Load(),
+			ReleaseFailures:         s.releaseFailures.Load(),
+			DowngradedReleaseErrors: s.downgraded.Load(),
+			Open:                    s.open.Load(),
+			HoldTimes:               holdTimes,
+		}
+		return true
+	})
+	return stats
+}
+
+// Publish exposes Stats as the expvar variable name.
+// Like expvar.Publish, it panics if the name is already taken.
+func (c *StatsCollector) Publish(name string) {
+	expvar.Publish(name, expvar.Func(func() any {
+		return c.Stats()
+	}))
+}
+
+// currentStats returns nil when no collector is installed;
+// the methods below do nothing on nil.
+func currentStats(kind string) *kindStats {
+	c := statsCollector.Load()
+	if c == nil {
+		return nil
+	}
+	value, ok := c.kinds.Load(kind)
+	if !ok {
+		value, _ = c.kinds.LoadOrStore(kind, &kindStats{
+			holdTimes: make([]atomic.Int64, len(HoldTimeBuckets)+1),
+			clock:     clockOr(c.clock),
+		})
+	}
+	return value.(*kindStats)
+}
+
+func (s *kindStats) acquireFailed() {
+	if s != nil {
+		s.acquireFailures.Add(1)
+	}
+}
+
+func (s *kindStats) releaseDowngraded() {
+	if s != nil {
+		s.downgraded.Add(1)
+	}
+}
+
+func (s *kindStats) acquired() time.Time {
+	if s == nil {
+		return time.Time{}
+	}
+	s.acquisitions.Add(1)
+	s.open.Add(1)
+	return s.clock.Now()
+}
+
+func (s *kindStats) released(acquired time.Time, useErr, releaseErr error) {
+	if s == nil {
+		return
+	}
+	s.open.Add(-1)
+	if useErr != nil {
+		s.useFailures.Add(1)
+	}
+	if releaseErr != nil {
+		s.releaseFailures.Add(1)
+	}
+	held := s.clock.Now().Sub(acquired)
+	bucket := len(s.holdTimes) - 1
+	for i, limit := range HoldTimeBuckets[:bucket] {
+		if held <= limit {
+			bucket = i
+			break
+		}
+	}
+	s.holdTimes[bucket].Add(1)
+}
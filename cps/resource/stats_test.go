@@ -0,0 +1,162 @@
+package resource_test
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+func TestStatsCollectorHoldTimesOnClock(t *testing.T) {
+	clock := newFakeClock()
+	stats := resource.NewStatsCollector(resource.StatsClock(clock))
+	resource.SetStatsCollector(stats)
+	t.Cleanup(func() {
+		resource.SetStatsCollector(nil)
+	})
+
+	path := filepath.Join(t.TempDir(), "held")
+	err := resource.NewFileResource(path, os.O_CREATE|os.O_WRONLY, 0o644).Use(func(*os.File) error {
+		clock.Advance(5 * time.Second)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// held for 5s: over the 1s bucket, within the 10s one
+	want := make([]int64, len(resource.HoldTimeBuckets)+1)
+	want[slices.Index(resource.HoldTimeBuckets, 10*time.Second)] = 1
+	if got := stats.Stats()["file"]; got.Acquisitions != 1 || !slices.Equal(got.HoldTimes, want) {
+		t.Fatalf("got %+v, want one file held for 5s", got)
+	}
+}
+
+func installStats(t *testing.T) *resource.StatsCollector {
+	t.Helper()
+	stats := resource.NewStatsCollector()
+	resource.SetStatsCollector(stats)
+	t.Cleanup(func() {
+		resource.SetStatsCollector(nil)
+	})
+	return stats
+}
+
+func TestStatsCountUses(t *testing.T) {
+	stats := installStats(t)
+	dir := t.TempDir()
+	errBoom := errors.New("boom")
+
+	// the file demos: write, then read back, with a failed callback and a missing file
+	path := filepath.Join(dir, "hello.txt")
+	uses := []error{
+		resource.NewFileResource(path, os.O_CREATE|os.O_WRONLY, 0o644).Use(func(file *os.File) error {
+			_, err := file.WriteString("hello")
+			return err
+		}),
+		resource.NewFileResource(path, os.O_RDONLY, 0).Use(useFile),
+		resource.NewFileResource(path, os.O_RDONLY, 0).Use(func(*os.File) error { return errBoom }),
+		resource.NewFileResource(filepath.Join(dir, "missing"), os.O_RDONLY, 0).Use(useFile),
+	}
+	// the sql demo, three times
+	for range 3 {
+		uses = append(uses, resource.NewDBResource("sqlite3", filepath.Join(dir, "test.db")).Use(func(db *sql.DB) error {
+			_, err := db.Exec("CREATE TABLE IF NOT EXISTS names (name TEXT)")
+			return err
+		}))
+	}
+	if !errors.Is(uses[2], errBoom) || uses[3] == nil {
+		t.Fatalf("uses = %v", uses)
+	}
+
+	got := stats.Stats()
+	file, db := got["file"], got["db"]
+	if file.Acquisitions != 3 || file.AcquireFailures != 1 || file.UseFailures != 1 || file.ReleaseFailures != 0 || file.Open != 0 {
+		t.Errorf("file stats = %+v, want 3 acquisitions of 4 Uses, 1 failed callback", file)
+	}
+	if db.Acquisitions != 3 || db.AcquireFailures != 0 || db.UseFailures != 0 || db.Open != 0 {
+		t.Errorf("db stats = %+v, want 3 acquisitions", db)
+	}
+	if sum(file.HoldTimes) != file.Acquisitions || sum(db.HoldTimes) != db.Acquisitions {
+		t.Errorf("hold times %v and %v, want one per release", file.HoldTimes, db.HoldTimes)
+	}
+}
+
+func sum(counts []int64) int64 {
+	var n int64
+	for _, c := range counts {
+		n += c
+	}
+	return n
+}
+
+func TestStatsOpenCountConcurrent(t *testing.T) {
+	stats := installStats(t)
+	path := tempFile(t)
+	var wg sync.WaitGroup
+	held := make(chan struct{})
+	release := make(chan struct{})
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resource.NewFileResource(path, os.O_RDONLY, 0).Use(func(*os.File) error {
+				held <- struct{}{}
+				<-release
+				return nil
+			})
+		}()
+	}
+	for range 10 {
+		<-held
+	}
+	if open := stats.Stats()["file"].Open; open != 10 {
+		t.Errorf("%d open while the 10 callbacks run", open)
+	}
+	close(release)
+	wg.Wait()
+	if got := stats.Stats()["file"]; got.Open != 0 || got.Acquisitions != 10 {
+		t.Errorf("stats = %+v after the callbacks returned", got)
+	}
+}
+
+func TestStatsNotReportedWithoutCollector(t *testing.T) {
+	stats := resource.NewStatsCollector()
+	err := resource.NewFileResource(tempFile(t), os.O_RDONLY, 0).Use(useFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := stats.Stats(); len(got) != 0 {
+		t.Errorf("a collector not installed got %v", got)
+	}
+}
+
+var publications atomic.Int64
+
+func TestStatsPublish(t *testing.T) {
+	stats := installStats(t)
+	name := fmt.Sprintf("resource_stats_test_%d", publications.Add(1)) // expvar names can't be reused
+	stats.Publish(name)
+	err := resource.NewFileResource(tempFile(t), os.O_RDONLY, 0).Use(useFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var published map[string]resource.ResourceStats
+	err = json.Unmarshal([]byte(expvar.Get(name).String()), &published)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if published["file"].Acquisitions != 1 {
+		t.Errorf("published %v, want the file acquisition", published)
+	}
+}
@@ -0,0 +1,97 @@
+package resource
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+)
+
+// CachedTx is a transaction preparing every distinct query once:
+// its Exec and Query methods reuse the statement for the rest of the transaction.
+// It is a Queryer, so the query helpers benefit from the cache too.
+type CachedTx struct {
+	*sql.Tx
+
+	mu    sync.Mutex
+	stmts map[string]*sql.Stmt
+}
+
+// RunTransactionStmtCache is RunTransaction giving the callback a CachedTx.
+// The cached statements are closed, close errors joined, before the commit or rollback.
+func RunTransactionStmtCache(db *sql.DB, opts ...TxOption) Resource[*CachedTx] {
+	tx := RunTransaction(db, opts...)
+	return Resource[*CachedTx]{
+		Use: func(callback func(tx *CachedTx) error) error {
+			return tx.Use(func(tx *sql.Tx) error {
+				cached := &CachedTx{Tx: tx, stmts: make(map[string]*sql.Stmt)}
+				err := callback(cached)
+				return errors.Join(err, phaseError(PhaseRelease, cached.closeStmts()))
+			})
+		},
+	}
+}
+
+func (tx *CachedTx) stmt(ctx context.Context, query string) (*sql.Stmt, error) {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	stmt, ok := tx.stmts[query]
+	if ok {
+		return stmt, nil
+	}
+	stmt, err := tx.Tx.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	tx.stmts[query] = stmt
+	return stmt, nil
+}
+
+func (tx *CachedTx) closeStmts() error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	var errs []error
+	for query, stmt := range tx.stmts {
+		errs = append(errs, stmt.Close())
+		delete(tx.stmts, query)
+	}
+	return errors.Join(errs...)
+}
+
+func (tx *CachedTx) Exec(query string, args ...any) (sql.Result, error) {
+	return tx.ExecContext(context.Background(), query, args...)
+}
+
+func (tx *CachedTx) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	stmt, err := tx.stmt(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return stmt.ExecContext(ctx, args...)
+}
+
+func (tx *CachedTx) Query(query string, args ...any) (*sql.Rows, error) {
+	return tx.QueryContext(context.Background(), query, args...)
+}
+
+func (tx *CachedTx) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	stmt, err := tx.stmt(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return stmt.QueryContext(ctx, args...)
+}
+
+func (tx *CachedTx) QueryRow(query string, args ...any) *sql.Row {
+	return tx.QueryRowContext(context.Background(), query, args...)
+}
+
+// QueryRowContext reports a prepare error through the returned row, like sql.Tx does.
+func (tx *CachedTx) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	stmt, err := tx.stmt(ctx, query)
+	if err != nil {
+		// the row of a failed query carries its error
+		return tx.Tx.QueryRowContext(ctx, query, args...)
+	}
+	return stmt.QueryRowContext(ctx, args...)
+}
@@ -0,0 +1,138 @@
+package resource_test
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+	"github.com/Q69K/using-cps-in-golang/cps/resource/resourcetest"
+)
+
+// openCountingDB opens a database with the items table through a new counting driver.
+func openCountingDB(t testing.TB) (*sql.DB, *resourcetest.CountingDriver) {
+	t.Helper()
+	driver, name := countingSQLite(t)
+	db, err := sql.Open(name, filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+	})
+	_, err = db.Exec("CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT NOT NULL)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, driver
+}
+
+func TestStmtCachePreparesOnce(t *testing.T) {
+	db, driver := openCountingDB(t)
+	before := driver.Counts()
+	err := resource.RunTransactionStmtCache(db).Use(func(tx *resource.CachedTx) error {
+		for range 100 {
+			_, err := tx.Exec("INSERT INTO items (name) VALUES (?)", "a")
+			if err != nil {
+				return err
+			}
+		}
+		var n int
+		for range 3 {
+			if err := tx.QueryRow("SELECT COUNT(*) FROM items").Scan(&n); err != nil {
+				return err
+			}
+		}
+		// the helpers taking a Queryer reuse the cached statements too
+		_, err := resource.ExecReturningID(tx, "INSERT INTO items (name) VALUES (?)", "b")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := driver.Counts()
+	if prepared := counts.Prepares - before.Prepares; prepared != 2 {
+		t.Errorf("%d statements prepared for 2 distinct queries", prepared)
+	}
+	if counts.OpenStmts() != 0 {
+		t.Errorf("counts = %+v, want every statement closed", counts)
+	}
+	if n := countItems(t, db); n != 101 {
+		t.Errorf("%d rows committed, want 101", n)
+	}
+}
+
+func TestStmtCacheClosedOnRollback(t *testing.T) {
+	db, driver := openCountingDB(t)
+	errCallback := errors.New("callback")
+	err := resource.RunTransactionStmtCache(db).Use(func(tx *resource.CachedTx) error {
+		_, err := tx.Exec("INSERT INTO items (name) VALUES (?)", "a")
+		if err != nil {
+			return err
+		}
+		rows, err := tx.Query("SELECT name FROM items")
+		if err != nil {
+			return err
+		}
+		rows.Close()
+		return errCallback
+	})
+	if !errors.Is(err, errCallback) {
+		t.Errorf("Use = %v, want the callback error", err)
+	}
+	if counts := driver.Counts(); counts.OpenStmts() != 0 || counts.Rollbacks != 1 {
+		t.Errorf("counts = %+v, want the statements closed and the transaction rolled back", counts)
+	}
+	if n := countItems(t, db); n != 0 {
+		t.Errorf("%d rows committed by the rolled back transaction", n)
+	}
+}
+
+func TestStmtCachePrepareError(t *testing.T) {
+	db, _ := openCountingDB(t)
+	err := resource.RunTransactionStmtCache(db).Use(func(tx *resource.CachedTx) error {
+		var n int
+		if err := tx.QueryRow("SELECT COUNT(*) FROM missing").Scan(&n); err == nil {
+			t.Error("QueryRow of a missing table succeeded")
+		}
+		if _, err := tx.Exec("INSERT INTO missing (name) VALUES (?)", "a"); err == nil {
+			t.Error("Exec into a missing table succeeded")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+const benchmarkInserts = 10_000
+
+func BenchmarkInsertsWithoutStmtCache(b *testing.B) {
+	db := openDB(b)
+	benchmark(b, func() error {
+		return resource.RunTransaction(db).Use(func(tx *sql.Tx) error {
+			for range benchmarkInserts {
+				if err := insertItem(tx, "a"); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
+
+func BenchmarkInsertsWithStmtCache(b *testing.B) {
+	db := openDB(b)
+	benchmark(b, func() error {
+		return resource.RunTransactionStmtCache(db).Use(func(tx *resource.CachedTx) error {
+			for range benchmarkInserts {
+				_, err := tx.Exec("INSERT INTO items (name) VALUES (?)", "a")
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
@@ -0,0 +1,105 @@
+package resource
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrStatementTimeout matches every *StatementTimeoutError with errors.Is.
+var ErrStatementTimeout = errors.New("statement timeout")
+
+// StatementTimeoutError is returned by the Queryer of WithStatementTimeout for a statement
+// which ran out of its own time, the context it was given not being done.
+// It wraps the driver's error, context.DeadlineExceeded usually.
+type StatementTimeoutError struct {
+	// Query is the statement on one line, truncated.
+	Query   string
+	Elapsed time.Duration
+	Err     error
+}
+
+func (e *StatementTimeoutError) Error() string {
+	return fmt.Sprintf("%v after %s: %s: %v", ErrStatementTimeout, e.Elapsed, e.Query, e.Err)
+}
+
+func (e *StatementTimeoutError) Is(target error) bool {
+	return target == ErrStatementTimeout
+}
+
+func (e *StatementTimeoutError) Unwrap() error {
+	return e.Err
+}
+
+type statementTimeoutOptions struct {
+	clock Clock
+}
+
+// StatementTimeoutOption configures WithStatementTimeout.
+type StatementTimeoutOption func(options *statementTimeoutOptions)
+
+// StatementTimeoutClock makes the statements run out of time, and their Elapsed measured, on clock.
+func StatementTimeoutClock(clock Clock) StatementTimeoutOption {
+	return func(options *statementTimeoutOptions) {
+		options.clock = clock
+	}
+}
+
+// WithStatementTimeout returns a decorator of Queryers running every statement with a context
+// done d after it started, sooner if the given one is: a lookup can have a tighter limit than its transaction.
+// Decorators stack, like NewLoggedQueryer(WithStatementTimeout(d)(tx), logger).
+//
+// The rows of Query and QueryRow are read with that context too: they must be read within d.
+// The errors met reading them, like the one of QueryRow, come from *sql.Rows and *sql.Row,
+// which can't be wrapped: they aren't made *StatementTimeoutErrors.
+func WithStatementTimeout(d time.Duration, opts ...StatementTimeoutOption) func(q Queryer) Queryer {
+	var options statementTimeoutOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	clock := clockOr(options.clock)
+	return func(q Queryer) Queryer {
+		return &timeoutQueryer{q: q, timeout: d, clock: clock}
+	}
+}
+
+type timeoutQueryer struct {
+	q       Queryer
+	timeout time.Duration
+	clock   Clock
+}
+
+func (tq *timeoutQueryer) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	stmtCtx, cancel := withClockTimeout(ctx, tq.clock, tq.timeout)
+	defer cancel()
+	started := tq.clock.Now()
+	result, err := tq.q.ExecContext(stmtCtx, query, args...)
+	return result, tq.statementError(ctx, stmtCtx, query, started, err)
+}
+
+// QueryContext doesn't cancel the context of the rows when it returns, which would close them.
+func (tq *timeoutQueryer) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	stmtCtx := tq.rowsContext(ctx)
+	started := tq.clock.Now()
+	rows, err := tq.q.QueryContext(stmtCtx, query, args...)
+	return rows, tq.statementError(ctx, stmtCtx, query, started, err)
+}
+
+func (tq *timeoutQueryer) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return tq.q.QueryRowContext(tq.rowsContext(ctx), query, args...)
+}
+
+// rowsContext is done after the timeout, which releases it too.
+func (tq *timeoutQueryer) rowsContext(ctx context.Context) context.Context {
+	stmtCtx, _ := withClockTimeout(ctx, tq.clock, tq.timeout)
+	return stmtCtx
+}
+
+func (tq *timeoutQueryer) statementError(ctx, stmtCtx context.Context, query string, started time.Time, err error) error {
+	if err == nil || ctx.Err() != nil || !errors.Is(stmtCtx.Err(), context.DeadlineExceeded) {
+		return err
+	}
+	return &StatementTimeoutError{Query: truncateQuery(query), Elapsed: tq.clock.Now().Sub(started), Err: err}
+}
@@ -0,0 +1,116 @@
+package resource_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+// blockingQueryer runs statements which last until their context is done.
+type blockingQueryer struct {
+	running chan struct{}
+}
+
+func (q blockingQueryer) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	q.running <- struct{}{}
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (q blockingQueryer) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	q.running <- struct{}{}
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (q blockingQueryer) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	panic("not used")
+}
+
+func TestWithStatementTimeoutOnClock(t *testing.T) {
+	clock := newFakeClock()
+	running := make(chan struct{})
+	q := resource.WithStatementTimeout(time.Second, resource.StatementTimeoutClock(clock))(blockingQueryer{running: running})
+	go func() {
+		for range 2 {
+			<-running
+			clock.Advance(time.Second)
+		}
+	}()
+
+	_, err := q.ExecContext(context.Background(), "UPDATE items SET name = 'x'")
+	var timeoutErr *resource.StatementTimeoutError
+	if !errors.As(err, &timeoutErr) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want a *StatementTimeoutError", err)
+	}
+	if timeoutErr.Elapsed != time.Second {
+		t.Fatalf("elapsed %v, want the second of the clock", timeoutErr.Elapsed)
+	}
+
+	_, err = q.QueryContext(context.Background(), "SELECT name FROM items")
+	if !errors.Is(err, resource.ErrStatementTimeout) {
+		t.Fatalf("got %v, want ErrStatementTimeout", err)
+	}
+}
+
+func TestWithStatementTimeoutKeepsCallerCancellation(t *testing.T) {
+	clock := newFakeClock()
+	running := make(chan struct{})
+	q := resource.WithStatementTimeout(time.Second, resource.StatementTimeoutClock(clock))(blockingQueryer{running: running})
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-running
+		cancel()
+	}()
+
+	_, err := q.ExecContext(ctx, "UPDATE items SET name = 'x'")
+	if !errors.Is(err, context.Canceled) || errors.Is(err, resource.ErrStatementTimeout) {
+		t.Fatalf("got %v, want the cancellation of the caller", err)
+	}
+}
+
+func TestStatementTimeoutInsideTxDeadline(t *testing.T) {
+	db := openDB(t)
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+	start := time.Now()
+	err := resource.RunTransaction(db, resource.TxDeadline(10*time.Second)).Use(func(tx *sql.Tx) error {
+		// the logger sees the statement timeouts, being outside
+		q := resource.NewLoggedQueryer(resource.WithStatementTimeout(100*time.Millisecond)(tx), logger)
+		ctx := resource.TxContext(tx)
+		_, err := q.ExecContext(ctx, slowQuery)
+		var timeoutErr *resource.StatementTimeoutError
+		if !errors.As(err, &timeoutErr) || !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("slow statement = %v, want a *StatementTimeoutError", err)
+		}
+		if timeoutErr.Elapsed < 100*time.Millisecond || !strings.HasPrefix(timeoutErr.Query, "WITH RECURSIVE c(x)") {
+			t.Errorf("error = %+v, want the elapsed time and the query on one line", timeoutErr)
+		}
+		if ctx.Err() != nil {
+			t.Errorf("the transaction ended with its statement: %v", ctx.Err())
+		}
+
+		// the transaction goes on
+		_, err = q.ExecContext(ctx, "INSERT INTO items (name) VALUES ('after the timeout')")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("ran for %v, want the statement interrupted after 100ms", elapsed)
+	}
+	if n := countItems(t, db); n != 1 {
+		t.Errorf("%d items, want the insert after the timeout committed", n)
+	}
+	if got := logs.String(); !strings.Contains(got, resource.ErrStatementTimeout.Error()) {
+		t.Errorf("logs = %q, want the statement timeout", got)
+	}
+}
@@ -0,0 +1,46 @@
+package resource
+
+import (
+	"errors"
+	"io/fs"
+	"sync/atomic"
+)
+
+var strict atomic.Bool
+
+// StrictMode makes the resources return the secondary errors they drop otherwise,
+// like the close error of a file whose callback failed, or the rollback error of a failed transaction:
+// they are joined with the error returned by Use. Off by default, for tests hunting lurking close failures.
+//
+// Outside of strict mode every dropped error is reported as a WarnSwallowedError warning instead,
+// as are, in strict mode too, the errors which can't be returned, like a rollback after a panic.
+func StrictMode(enabled bool) {
+	strict.Store(enabled)
+}
+
+// secondaryError is err joined with secondary in strict mode; otherwise secondary is reported as swallowed.
+func secondaryError(err error, resource string, secondary error) error {
+	if secondary == nil {
+		return err
+	}
+	if strict.Load() {
+		return errors.Join(err, secondary)
+	}
+	warnErr(WarnSwallowedError, resource, secondary)
+	return err
+}
+
+// swallowedError reports an error which can't be returned.
+func swallowedError(resource string, err error) {
+	if err != nil {
+		warnErr(WarnSwallowedError, resource, err)
+	}
+}
+
+// removeError is the error of removing a temporary file, nil when it was removed already.
+func removeError(err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return phaseError(PhaseRelease, err)
+}
@@ -0,0 +1,87 @@
+package resource_test
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+// strictly runs use outside of strict mode, then in strict mode, checking that the error use drops
+// is swallowed with a warning by the first run and returned by the second.
+func strictly(t *testing.T, want error, use func(t *testing.T) error) {
+	for _, strict := range []bool{false, true} {
+		t.Run(map[bool]string{false: "lenient", true: "strict"}[strict], func(t *testing.T) {
+			warnings := captureWarnings(t)
+			resource.StrictMode(strict)
+			t.Cleanup(func() {
+				resource.StrictMode(false)
+			})
+
+			err := use(t)
+			if want != nil && !errors.Is(err, want) {
+				t.Errorf("Use = %v, want the error of the callback", err)
+			}
+			joined, ok := err.(interface{ Unwrap() []error })
+			returned := err != nil && (want == nil || ok && len(joined.Unwrap()) > 1)
+			if returned != strict {
+				t.Errorf("Use = %v, want the secondary error returned: %v", err, strict)
+			}
+			if swallowed := hasWarning(warnings(), resource.WarnSwallowedError); swallowed == strict {
+				t.Errorf("warnings = %v, want the secondary error swallowed: %v", warnings(), !strict)
+			}
+		})
+	}
+}
+
+// blockRemoval replaces the file at path with a directory which isn't empty, which os.Remove fails on.
+func blockRemoval(t *testing.T, path string) {
+	t.Helper()
+	err := os.Remove(path)
+	if err == nil {
+		err = os.Mkdir(path, 0o755)
+	}
+	if err == nil {
+		err = os.WriteFile(filepath.Join(path, "blocker"), nil, 0o644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStrictModeTempFileRemoval(t *testing.T) {
+	strictly(t, nil, func(t *testing.T) error {
+		return resource.NewTempFileResource(t.TempDir(), "strict-*").Use(func(file *os.File) error {
+			blockRemoval(t, file.Name())
+			return nil
+		})
+	})
+}
+
+func TestStrictModeAtomicFileRemoval(t *testing.T) {
+	errWrite := errors.New("write failed")
+	strictly(t, errWrite, func(t *testing.T) error {
+		return resource.NewAtomicFileResource(filepath.Join(t.TempDir(), "report.txt"), 0o644).Use(func(file *os.File) error {
+			blockRemoval(t, file.Name())
+			return errWrite
+		})
+	})
+}
+
+func TestStrictModeRollback(t *testing.T) {
+	errCallback := errors.New("callback failed")
+	strictly(t, errCallback, func(t *testing.T) error {
+		db := openDB(t)
+		return resource.RunTransaction(db).Use(func(tx *sql.Tx) error {
+			// ends the transaction behind the back of database/sql, failing its rollback
+			_, err := tx.Exec("ROLLBACK")
+			if err != nil {
+				t.Fatal(err)
+			}
+			return errCallback
+		})
+	})
+}
@@ -0,0 +1,194 @@
+package resource
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNoWhereColumns is returned by UpdateStruct called without where columns,
+// which would update the whole table.
+var ErrNoWhereColumns = errors.New("update without where columns")
+
+// ErrNoSetColumns is returned by UpdateStruct when every field of the struct is a where column,
+// leaving nothing to update.
+var ErrNoSetColumns = errors.New("update without columns to set")
+
+type structColumn struct {
+	name  string
+	value any
+}
+
+// InsertStruct inserts the fields of v (a struct or a pointer to one) tagged with `db:"column"` into table.
+//
+// Fields tagged `db:"-"` or not tagged at all are skipped, as are zero-valued fields
+// tagged `db:"column,auto"` (auto-increment keys). Nil pointers are inserted as NULL.
+// It goes through q.ExecContext, so it works inside RunTransaction callbacks,
+// with the placeholder style of the driver of q (see CapabilitiesOf), DefaultPlaceholderStyle when unknown.
+func InsertStruct(q Queryer, table string, v any) (sql.Result, error) {
+	columns, err := structColumns(v)
+	if err != nil {
+		return nil, err
+	}
+
+	style := placeholderStyleOf(q)
+	names := make([]string, len(columns))
+	placeholders := make([]string, len(columns))
+	args := make([]any, len(columns))
+	for i, column := range columns {
+		names[i] = QuoteIdentifier(column.name)
+		placeholders[i] = style.placeholder(i + 1)
+		args[i] = column.value
+	}
+	query := "INSERT INTO " + QuoteIdentifier(table) +
+		" (" + strings.Join(names, ", ") + ") VALUES (" + strings.Join(placeholders, ", ") + ")"
+	return q.ExecContext(context.Background(), query, args...)
+}
+
+// UpdateStruct updates the rows of table matching the whereCols values of v with its other fields.
+// Fields are selected like in InsertStruct; it returns ErrNoSetColumns when they are all where columns.
+func UpdateStruct(q Queryer, table string, v any, whereCols ...string) (sql.Result, error) {
+	if len(whereCols) == 0 {
+		return nil, ErrNoWhereColumns
+	}
+	columns, err := structColumns(v)
+	if err != nil {
+		return nil, err
+	}
+
+	style := placeholderStyleOf(q)
+	isWhere := make(map[string]bool, len(whereCols))
+	for _, name := range whereCols {
+		isWhere[name] = true
+	}
+	var sets, wheres []string
+	var args, whereArgs []any
+	for _, column := range columns {
+		if isWhere[column.name] {
+			continue
+		}
+		args = append(args, column.value)
+		sets = append(sets, QuoteIdentifier(column.name)+" = "+style.placeholder(len(args)))
+	}
+	for _, name := range whereCols {
+		found := false
+		for _, column := range columns {
+			if column.name == name {
+				whereArgs = append(whereArgs, column.value)
+				wheres = append(wheres, QuoteIdentifier(name)+" = "+style.placeholder(len(args)+len(whereArgs)))
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("update %s: where column %q is not a field of %T", table, name, v)
+		}
+	}
+	if len(sets) == 0 {
+		return nil, fmt.Errorf("update %s: %w", table, ErrNoSetColumns)
+	}
+
+	query := "UPDATE " + QuoteIdentifier(table) +
+		" SET " + strings.Join(sets, ", ") + " WHERE " + strings.Join(wheres, " AND ")
+	return q.ExecContext(context.Background(), query, append(args, whereArgs...)...)
+}
+
+// QuoteIdentifier quotes a table or column name with double quotes, the SQL standard way.
+func QuoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// placeholder is the placeholder of the argument at position, from 1.
+func (style PlaceholderStyle) placeholder(position int) string {
+	if style == Dollar {
+		return "$" + strconv.Itoa(position)
+	}
+	return "?"
+}
+
+var (
+	timeType   = reflect.TypeOf(time.Time{})
+	valuerType = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+)
+
+func structColumns(v any) ([]structColumn, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil, fmt.Errorf("struct columns: nil %T", v)
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("struct columns: %T is not a struct", v)
+	}
+
+	var columns []structColumn
+	err := appendStructColumns(&columns, rv)
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("struct columns: %T has no db tagged fields", v)
+	}
+	return columns, nil
+}
+
+func appendStructColumns(columns *[]structColumn, rv reflect.Value) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		tag, tagged := field.Tag.Lookup("db")
+		if !tagged && field.Anonymous && field.Type.Kind() == reflect.Struct {
+			err := appendStructColumns(columns, rv.Field(i))
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if !tagged || tag == "-" || !field.IsExported() {
+			continue
+		}
+
+		name, flags, _ := strings.Cut(tag, ",")
+		fv := rv.Field(i)
+		if flags == "auto" && fv.IsZero() {
+			continue
+		}
+		value, err := columnValue(fv)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", field.Name, err)
+		}
+		*columns = append(*columns, structColumn{name: name, value: value})
+	}
+	return nil
+}
+
+func columnValue(fv reflect.Value) (any, error) {
+	if fv.Type().Implements(valuerType) || fv.Type() == timeType {
+		return fv.Interface(), nil
+	}
+	switch fv.Kind() {
+	case reflect.Pointer:
+		if fv.IsNil() {
+			return nil, nil
+		}
+		return columnValue(fv.Elem())
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return fv.Interface(), nil
+	case reflect.Slice:
+		if fv.Type().Elem().Kind() == reflect.Uint8 {
+			return fv.Bytes(), nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported column type %s", fv.Type())
+}
@@ -0,0 +1,152 @@
+package resource_test
+
+import (
+	"database/sql"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+type name struct {
+	ID   int64  `db:"id,auto"`
+	Name string `db:"name"`
+	Note string `db:"-"`
+}
+
+type event struct {
+	ID      int64          `db:"id"`
+	Title   string         `db:"title"`
+	Comment *string        `db:"comment"`
+	Score   sql.NullInt64  `db:"score"`
+	Place   sql.NullString `db:"place"`
+	At      time.Time      `db:"at"`
+}
+
+func openStructsDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db := openDB(t)
+	_, err := db.Exec(`
+		CREATE TABLE names (id INTEGER PRIMARY KEY AUTOINCREMENT, name VARCHAR NOT NULL);
+		CREATE TABLE events (id INTEGER PRIMARY KEY, title TEXT NOT NULL, comment TEXT, score INTEGER, place TEXT, at TIMESTAMP NOT NULL);
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestInsertStructSkipsAutoKeys(t *testing.T) {
+	db := openStructsDB(t)
+	var id int64
+	err := resource.RunTransaction(db).Use(func(tx *sql.Tx) error {
+		result, err := resource.InsertStruct(tx, "names", name{Name: "alice", Note: "not a column"})
+		if err != nil {
+			return err
+		}
+		id, err = result.LastInsertId()
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got string
+	err = db.QueryRow("SELECT name FROM names WHERE id = ?", id).Scan(&got)
+	if err != nil || got != "alice" {
+		t.Errorf("name %d = %q, %v", id, got, err)
+	}
+
+	_, err = resource.InsertStruct(db, "names", &name{ID: 10, Name: "bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.QueryRow("SELECT name FROM names WHERE id = 10").Scan(&got)
+	if err != nil || got != "bob" {
+		t.Errorf("name 10 = %q, %v", got, err)
+	}
+}
+
+func TestInsertAndUpdateStructWithNulls(t *testing.T) {
+	db := openStructsDB(t)
+	at := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	_, err := resource.InsertStruct(db, "events", event{ID: 1, Title: "launch", Place: sql.NullString{String: "moon", Valid: true}, At: at})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	comment := "went well"
+	_, err = resource.UpdateStruct(db, "events", event{ID: 1, Title: "landing", Comment: &comment, Score: sql.NullInt64{Int64: 7, Valid: true}, At: at.Add(time.Hour)}, "id")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got event
+	err = db.QueryRow("SELECT id, title, comment, score, place, at FROM events").
+		Scan(&got.ID, &got.Title, &got.Comment, &got.Score, &got.Place, &got.At)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Title != "landing" || got.Comment == nil || *got.Comment != comment || got.Score.Int64 != 7 || got.Place.Valid || !got.At.Equal(at.Add(time.Hour)) {
+		t.Errorf("event = %+v", got)
+	}
+}
+
+func TestStructErrors(t *testing.T) {
+	db := openStructsDB(t)
+
+	_, err := resource.UpdateStruct(db, "names", name{ID: 1, Name: "a"})
+	if !errors.Is(err, resource.ErrNoWhereColumns) {
+		t.Errorf("UpdateStruct without where columns = %v", err)
+	}
+	_, err = resource.UpdateStruct(db, "names", name{ID: 1, Name: "a"}, "id", "name")
+	if !errors.Is(err, resource.ErrNoSetColumns) {
+		t.Errorf("UpdateStruct with where columns only = %v", err)
+	}
+	_, err = resource.UpdateStruct(db, "names", name{ID: 1, Name: "a"}, "missing")
+	if err == nil || !strings.Contains(err.Error(), `"missing"`) {
+		t.Errorf("UpdateStruct with an unknown where column = %v", err)
+	}
+
+	for _, v := range []any{
+		42,
+		(*name)(nil),
+		struct{ Untagged int }{},
+		struct {
+			Tags map[string]string `db:"tags"`
+		}{},
+	} {
+		_, err := resource.InsertStruct(db, "names", v)
+		if err == nil {
+			t.Errorf("InsertStruct(%T) succeeded", v)
+		}
+	}
+}
+
+func TestStructsUsePlaceholdersOfDriver(t *testing.T) {
+	dsn := t.TempDir() // unique to this run of the test
+	err := resource.NewDBResource("recording", dsn).Use(func(db *sql.DB) error {
+		_, err := resource.InsertStruct(db, "names", name{Name: "alice"})
+		if err != nil {
+			return err
+		}
+		return resource.RunTransaction(db).Use(func(tx *sql.Tx) error {
+			_, err := resource.UpdateStruct(tx, "events", event{ID: 1, Title: "launch"}, "id")
+			return err
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		`INSERT INTO "names" ("name") VALUES ($1)`,
+		`UPDATE "events" SET "title" = $1, "comment" = $2, "score" = $3, "place" = $4, "at" = $5 WHERE "id" = $6`,
+	}
+	if got := recorder.recorded(dsn); !slices.Equal(got, want) {
+		t.Errorf("queries = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,124 @@
+package resource
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ErrTempQuotaExceeded is returned when acquiring from a TempSpace which is full.
+var ErrTempQuotaExceeded = errors.New("temp space quota exceeded")
+
+// TempSpace hands out temporary files and directories inside a root directory
+// and refuses new ones while those in use take maxBytes or more.
+type TempSpace struct {
+	root     string
+	maxBytes int64
+
+	mu   sync.Mutex
+	live map[string]struct{}
+}
+
+// NewTempSpace creates a temp space inside root (os.TempDir() when empty), which must exist.
+func NewTempSpace(root string, maxBytes int64) *TempSpace {
+	return &TempSpace{root: root, maxBytes: maxBytes, live: make(map[string]struct{})}
+}
+
+// Used returns the size of the files and directories in use, measured now.
+func (s *TempSpace) Used() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.used()
+}
+
+func (s *TempSpace) used() int64 {
+	var used int64
+	for path := range s.live {
+		used += diskUsage(path)
+	}
+	return used
+}
+
+// diskUsage is the size of the files at path, a file or a directory; vanished files count as nothing.
+func diskUsage(path string) int64 {
+	var size int64
+	_ = filepath.WalkDir(path, func(_ string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info, err := entry.Info(); err == nil && info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+// acquire measures the space in use and creates an artifact with create when there is some left.
+func (s *TempSpace) acquire(create func() (string, error)) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.used() >= s.maxBytes {
+		return "", ErrTempQuotaExceeded
+	}
+	path, err := create()
+	if err != nil {
+		return "", err
+	}
+	s.live[path] = struct{}{}
+	return path, nil
+}
+
+func (s *TempSpace) release(path string) error {
+	err := os.RemoveAll(path)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.live, path)
+	return err
+}
+
+// File is NewTempFileResource inside the temp space.
+func (s *TempSpace) File(pattern string) FileResource {
+	return newFileResource("temp file "+filepath.Join(s.root, pattern), func(callback FileResourceCallback) error {
+		var file *os.File
+		_, err := s.acquire(func() (string, error) {
+			var err error
+			file, err = os.CreateTemp(s.root, pattern)
+			if err != nil {
+				return "", err
+			}
+			return file.Name(), nil
+		})
+		if err != nil {
+			return phaseError(PhaseAcquire, err)
+		}
+		err = callback(file)
+		releaseErr := errors.Join(closeFile(file, false), s.release(file.Name()))
+		if releaseErr == nil {
+			return err
+		}
+		return errors.Join(err, phaseError(PhaseRelease, releaseErr))
+	})
+}
+
+// Dir is NewTempDirResource inside the temp space.
+func (s *TempSpace) Dir(pattern string) Resource[string] {
+	return Resource[string]{
+		Use: func(callback func(path string) error) error {
+			path, err := s.acquire(func() (string, error) {
+				return os.MkdirTemp(s.root, pattern)
+			})
+			if err != nil {
+				return phaseError(PhaseAcquire, err)
+			}
+			err = callback(path)
+			releaseErr := s.release(path)
+			if releaseErr == nil {
+				return err
+			}
+			return errors.Join(err, phaseError(PhaseRelease, releaseErr))
+		},
+	}
+}
@@ -0,0 +1,157 @@
+package resource_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/group"
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+// holdTemp fills a file and a directory of space with size bytes each, holding them until release is closed.
+func holdTemp(t *testing.T, g group.Spawner, space *resource.TempSpace, size int, release chan struct{}) {
+	t.Helper()
+	held := make(chan error, 2)
+	g.Run(func() {
+		err := space.File("held-*").Use(func(fd *os.File) error {
+			_, err := fd.WriteString(strings.Repeat("x", size))
+			held <- err
+			<-release
+			return err
+		})
+		if err != nil {
+			t.Error(err)
+		}
+	})
+	g.Run(func() {
+		err := space.Dir("held-*").Use(func(dir string) error {
+			err := os.WriteFile(filepath.Join(dir, "data"), []byte(strings.Repeat("x", size)), 0600)
+			held <- err
+			<-release
+			return err
+		})
+		if err != nil {
+			t.Error(err)
+		}
+	})
+	for range 2 {
+		if err := <-held; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestTempSpaceQuota(t *testing.T) {
+	root := t.TempDir()
+	space := resource.NewTempSpace(root, 1000)
+	holders := group.NewSafeWaitGroup()
+	release := make(chan struct{})
+	holdTemp(t, holders, space, 300, release)
+	if used := space.Used(); used != 600 {
+		t.Errorf("Used = %d, want 600", used)
+	}
+	holdTemp(t, holders, space, 200, release)
+	if used := space.Used(); used != 1000 {
+		t.Fatalf("Used = %d, want the quota", used)
+	}
+
+	var rejected, called atomic.Int64
+	users := group.NewSafeWaitGroup()
+	for i := range 50 {
+		users.Run(func() {
+			var err error
+			if i%2 == 0 {
+				err = space.File("user-*").Use(func(*os.File) error {
+					called.Add(1)
+					return nil
+				})
+			} else {
+				err = space.Dir("user-*").Use(func(string) error {
+					called.Add(1)
+					return nil
+				})
+			}
+			var resourceErr *resource.ResourceError
+			if errors.As(err, &resourceErr) && resourceErr.Phase == resource.PhaseAcquire && errors.Is(err, resource.ErrTempQuotaExceeded) {
+				rejected.Add(1)
+			}
+		})
+	}
+	users.Wait()
+	if rejected.Load() != 50 || called.Load() != 0 {
+		t.Errorf("%d users rejected, %d called, want every one rejected", rejected.Load(), called.Load())
+	}
+
+	close(release)
+	holders.Wait()
+	if used := space.Used(); used != 0 {
+		t.Errorf("Used after the holders = %d, want 0", used)
+	}
+	if got := dirEntries(t, root); len(got) != 0 {
+		t.Errorf("root = %q, want everything cleaned up", got)
+	}
+	err := space.File("again-*").Use(func(*os.File) error { return nil })
+	if err != nil {
+		t.Errorf("File after the holders = %v", err)
+	}
+}
+
+func TestTempSpaceConcurrentUsers(t *testing.T) {
+	root := t.TempDir()
+	space := resource.NewTempSpace(root, 1<<20)
+	errUser := errors.New("user failed")
+
+	var failed atomic.Int64
+	users := group.NewSafeWaitGroup()
+	for i := range 100 {
+		users.Run(func() {
+			err := space.Dir("user-*").Use(func(dir string) error {
+				err := os.WriteFile(filepath.Join(dir, "data"), []byte("some data"), 0600)
+				if err == nil && i%3 == 0 {
+					err = errUser
+				}
+				return err
+			})
+			if err != nil && !errors.Is(err, errUser) {
+				t.Error(err)
+			}
+			if err != nil {
+				failed.Add(1)
+			}
+		})
+	}
+	users.Wait()
+
+	if failed.Load() != 34 {
+		t.Errorf("%d users failed, want 34", failed.Load())
+	}
+	if used := space.Used(); used != 0 {
+		t.Errorf("Used = %d, want 0", used)
+	}
+	if got := dirEntries(t, root); len(got) != 0 {
+		t.Errorf("root = %q, want the failed users cleaned up too", got)
+	}
+}
+
+func TestTempSpaceAcquireFailureReservesNothing(t *testing.T) {
+	root := t.TempDir()
+	space := resource.NewTempSpace(root, 100)
+
+	// a pattern with a path separator makes the creation fail
+	for range 10 {
+		err := space.File("bad/*").Use(func(*os.File) error { return nil })
+		if err == nil || errors.Is(err, resource.ErrTempQuotaExceeded) || phaseOf(t, err) != resource.PhaseAcquire {
+			t.Fatalf("File with a bad pattern = %v, want an acquire error", err)
+		}
+	}
+	err := space.Dir("dir-*").Use(func(dir string) error {
+		return os.WriteFile(filepath.Join(dir, "data"), []byte(strings.Repeat("x", 99)), 0600)
+	})
+	if err != nil || space.Used() != 0 {
+		t.Errorf("Dir after failed acquisitions = %v, Used %d", err, space.Used())
+	}
+}
@@ -0,0 +1,100 @@
+package resource
+
+import (
+	"context"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/group"
+)
+
+type timerOptions struct {
+	clock Clock
+}
+
+// TimerOption configures WithTicker, WithTimer and their Ctx variants.
+type TimerOption func(options *timerOptions)
+
+// TimerClock makes the ticker or timer one of clock.
+func TimerClock(clock Clock) TimerOption {
+	return func(options *timerOptions) {
+		options.clock = clock
+	}
+}
+
+func timerClock(opts []TimerOption) Clock {
+	var options timerOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return clockOr(options.clock)
+}
+
+// WithTicker gives fn the channel of a new ticker, stopped when fn returns.
+func WithTicker(d time.Duration, fn func(ticks <-chan time.Time) error, opts ...TimerOption) error {
+	ticker := timerClock(opts).NewTicker(d)
+	defer ticker.Stop()
+
+	return fn(ticker.C())
+}
+
+// WithTimer gives fn the channel of a new timer, stopped and drained when fn returns.
+func WithTimer(d time.Duration, fn func(fired <-chan time.Time) error, opts ...TimerOption) error {
+	timer := timerClock(opts).NewTimer(d)
+	defer func() {
+		if !timer.Stop() {
+			select {
+			case <-timer.C():
+			default:
+			}
+		}
+	}()
+
+	return fn(timer.C())
+}
+
+// WithTickerCtx is WithTicker whose channel is closed when ctx is done.
+func WithTickerCtx(ctx context.Context, d time.Duration, fn func(ticks <-chan time.Time) error, opts ...TimerOption) error {
+	return WithTicker(d, func(ticks <-chan time.Time) error {
+		return relayUntilDone(ctx, ticks, fn)
+	}, opts...)
+}
+
+// WithTimerCtx is WithTimer whose channel is closed when ctx is done.
+func WithTimerCtx(ctx context.Context, d time.Duration, fn func(fired <-chan time.Time) error, opts ...TimerOption) error {
+	return WithTimer(d, func(fired <-chan time.Time) error {
+		return relayUntilDone(ctx, fired, fn)
+	}, opts...)
+}
+
+// relayUntilDone gives fn a copy of c which is closed when ctx is done;
+// the relaying goroutine is gone when it returns.
+func relayUntilDone(ctx context.Context, c <-chan time.Time, fn func(<-chan time.Time) error) error {
+	relay := make(chan time.Time)
+	done := make(chan struct{})
+	relaying := group.NewSafeWaitGroup()
+	relaying.Run(func() {
+		defer close(relay)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-done:
+				return
+			case t := <-c:
+				select {
+				case relay <- t:
+				case <-ctx.Done():
+					return
+				case <-done:
+					return
+				}
+			}
+		}
+	})
+	defer func() {
+		close(done)
+		relaying.Wait()
+	}()
+
+	return fn(relay)
+}
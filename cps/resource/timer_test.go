@@ -0,0 +1,136 @@
+package resource_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+func TestWithTickerOnClock(t *testing.T) {
+	clock := newFakeClock()
+	err := resource.WithTicker(time.Second, func(ticks <-chan time.Time) error {
+		clock.Advance(time.Second)
+		if tick := <-ticks; !tick.Equal(epoch.Add(time.Second)) {
+			t.Fatalf("ticked at %v, want a second after the start", tick)
+		}
+		return nil
+	}, resource.TimerClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWithTimerOnClock(t *testing.T) {
+	clock := newFakeClock()
+	err := resource.WithTimer(time.Minute, func(fired <-chan time.Time) error {
+		clock.Advance(time.Minute - time.Nanosecond)
+		select {
+		case <-fired:
+			t.Fatal("fired before its time")
+		default:
+		}
+		clock.Advance(time.Nanosecond)
+		<-fired
+		return nil
+	}, resource.TimerClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWithTickerCtxClosesOnDone(t *testing.T) {
+	clock := newFakeClock()
+	ctx, cancel := context.WithCancel(context.Background())
+	err := resource.WithTickerCtx(ctx, time.Second, func(ticks <-chan time.Time) error {
+		clock.Advance(time.Second)
+		<-ticks
+		cancel()
+		for range ticks {
+		}
+		return nil
+	}, resource.TimerClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// quiet fails the test if c delivers anything within 5 periods of d.
+func quiet(t *testing.T, c <-chan time.Time, d time.Duration) {
+	t.Helper()
+	select {
+	case tick, ok := <-c:
+		if ok {
+			t.Fatalf("got %v after Use returned", tick)
+		}
+	case <-time.After(5 * d):
+	}
+}
+
+func TestWithTickerStopsAfterUse(t *testing.T) {
+	const d = 5 * time.Millisecond
+	var kept <-chan time.Time
+	errBoom := errors.New("boom")
+	err := resource.WithTicker(d, func(ticks <-chan time.Time) error {
+		for range 2 {
+			<-ticks
+		}
+		kept = ticks
+		return errBoom
+	})
+	if err != errBoom {
+		t.Fatalf("WithTicker = %v, want the error of fn", err)
+	}
+	quiet(t, kept, d)
+}
+
+func TestWithTimerStopsAndDrainsAfterUse(t *testing.T) {
+	const d = 5 * time.Millisecond
+	var kept <-chan time.Time
+	err := resource.WithTimer(d, func(fired <-chan time.Time) error {
+		kept = fired
+		return nil // before it fired
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	quiet(t, kept, d)
+
+	err = resource.WithTimer(d, func(fired <-chan time.Time) error {
+		kept = fired
+		time.Sleep(5 * d) // fired, never read
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	quiet(t, kept, d)
+}
+
+func TestWithTimerCtxClosesOnDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := resource.WithTimerCtx(ctx, time.Hour, func(fired <-chan time.Time) error {
+		for range fired {
+			t.Error("fired for a done context")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const d = 5 * time.Millisecond
+	var kept <-chan time.Time
+	err = resource.WithTickerCtx(context.Background(), d, func(ticks <-chan time.Time) error {
+		<-ticks
+		kept = ticks
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	quiet(t, kept, d)
+}
@@ -0,0 +1,65 @@
+package resource
+
+// Tracer starts spans around resource lifetimes, so they can be bridged to any tracing system
+// without this package depending on one.
+type Tracer interface {
+	// StartSpan starts the span name and returns what ends it, with the error of the spanned work.
+	StartSpan(name string) func(err error)
+}
+
+func noSpan(error) {}
+
+// startSpan doesn't allocate when tracer is nil.
+func startSpan(tracer Tracer, name string) func(err error) {
+	if tracer == nil {
+		return noSpan
+	}
+	return tracer.StartSpan(name)
+}
+
+// Traced wraps r with the spans "resource.<kind>" around the whole Use
+// and "resource.<kind>.use" around the callback. With a nil tracer r is returned as is.
+//
+// It is how resources without a tracing option are traced, like QueryRows:
+//
+//	Traced(QueryRows(tx, query), tracer, "rows")
+func Traced[T any](r Resource[T], tracer Tracer, kind string) Resource[T] {
+	if tracer == nil {
+		return r
+	}
+	return Resource[T]{
+		Use: func(callback func(value T) error) error {
+			end := tracer.StartSpan("resource." + kind)
+			err := r.Use(func(value T) error {
+				endUse := tracer.StartSpan("resource." + kind + ".use")
+				err := callback(value)
+				endUse(err)
+				return err
+			})
+			end(err)
+			return err
+		},
+	}
+}
+
+// WithFileTracing emits the spans "resource.file" and "resource.file.use" for every Use.
+func WithFileTracing(tracer Tracer) FileOption {
+	return func(options *fileOptions) {
+		options.tracer = tracer
+	}
+}
+
+// WithTxTracing emits the spans "resource.tx", "resource.tx.use",
+// and "resource.tx.commit" or "resource.tx.rollback" for every Use.
+func WithTxTracing(tracer Tracer) TxOption {
+	return func(options *txOptions) {
+		options.tracer = tracer
+	}
+}
+
+// WithDBTracing emits the spans "resource.db" and "resource.db.use" for every Use.
+func WithDBTracing(tracer Tracer) DBOption {
+	return func(options *dbOptions) {
+		options.tracer = tracer
+	}
+}
@@ -0,0 +1,144 @@
+package resource_test
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+	"github.com/Q69K/using-cps-in-golang/cps/resource/resourcetest"
+)
+
+// spanTree describes spans as "name<parent name" lines, with "!" after the ones which failed.
+func spanTree(spans []resourcetest.Span) []string {
+	var lines []string
+	for _, span := range spans {
+		line := span.Name
+		if span.Parent >= 0 {
+			line += "<" + spans[span.Parent].Name
+		}
+		if !span.Ended {
+			line += " (open)"
+		}
+		if span.Err != nil {
+			line += "!"
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func equalTree(t *testing.T, got, want []string) {
+	t.Helper()
+	if !slices.Equal(got, want) {
+		t.Fatalf("spans:\n%q\nwant:\n%q", got, want)
+	}
+}
+
+// helloTraced is helloSql_Cool of the demo, traced in a database of its own, then reading the names back.
+func helloTraced(tracer resource.Tracer, path string) error {
+	db := resource.NewDBResource("sqlite3", path, resource.WithDBTracing(tracer))
+	return db.Use(func(db *sql.DB) error {
+		_, err := db.Exec("CREATE TABLE IF NOT EXISTS names (id INTEGER PRIMARY KEY AUTOINCREMENT, name VARCHAR NOT NULL)")
+		if err != nil {
+			return err
+		}
+		return resource.RunTransaction(db, resource.WithTxTracing(tracer)).Use(func(tx *sql.Tx) error {
+			_, err := resource.ExecReturningID(tx, "INSERT INTO names (name) VALUES (?)", "MessageBird")
+			if err != nil {
+				return err
+			}
+			return resource.Traced(resource.QueryRows(tx, "SELECT name FROM names"), tracer, "rows").Use(func(rows *sql.Rows) error {
+				for rows.Next() {
+				}
+				return rows.Err()
+			})
+		})
+	})
+}
+
+func TestTracingSpansNest(t *testing.T) {
+	var tracer resourcetest.RecordingTracer
+	err := helloTraced(&tracer, filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	equalTree(t, spanTree(tracer.Spans()), []string{
+		"resource.db",
+		"resource.db.use<resource.db",
+		"resource.tx<resource.db.use",
+		"resource.tx.use<resource.tx",
+		"resource.rows<resource.tx.use",
+		"resource.rows.use<resource.rows",
+		"resource.tx.commit<resource.tx",
+	})
+}
+
+func TestTracingRecordsErrors(t *testing.T) {
+	var tracer resourcetest.RecordingTracer
+	db := openDB(t)
+	errBoom := errors.New("boom")
+	err := resource.RunTransaction(db, resource.WithTxTracing(&tracer)).Use(func(*sql.Tx) error {
+		return errBoom
+	})
+	if !errors.Is(err, errBoom) {
+		t.Fatal(err)
+	}
+	equalTree(t, spanTree(tracer.Spans()), []string{
+		"resource.tx!",
+		"resource.tx.use<resource.tx!",
+		"resource.tx.rollback<resource.tx",
+	})
+
+	tracer = resourcetest.RecordingTracer{}
+	missing := filepath.Join(t.TempDir(), "missing")
+	err = resource.NewFileResource(missing, os.O_RDONLY, 0, resource.WithFileTracing(&tracer)).Use(func(*os.File) error {
+		return nil
+	})
+	if err == nil {
+		t.Fatal("opened a missing file")
+	}
+	equalTree(t, spanTree(tracer.Spans()), []string{"resource.file!"})
+
+	tracer = resourcetest.RecordingTracer{}
+	path := tempFile(t)
+	err = resource.NewFileResource(path, os.O_RDONLY, 0, resource.WithFileTracing(&tracer)).Use(useFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	equalTree(t, spanTree(tracer.Spans()), []string{"resource.file", "resource.file.use<resource.file"})
+}
+
+// TestNilTracerAllocations checks that the tracing options with a nil tracer cost no allocation per Use.
+func TestNilTracerAllocations(t *testing.T) {
+	path := tempFile(t)
+	db := openDB(t)
+	file, tracedFile := resource.NewFileResource(path, os.O_RDONLY, 0), resource.NewFileResource(path, os.O_RDONLY, 0, resource.WithFileTracing(nil))
+	tx, tracedTx := resource.RunTransaction(db), resource.RunTransaction(db, resource.WithTxTracing(nil))
+	rows := resource.QueryRows(db, "SELECT id FROM items")
+	tracedRows := resource.Traced(rows, nil, "rows")
+	cases := []struct {
+		name           string
+		plain, tracing func() error
+	}{
+		{"file", func() error { return file.Use(useFile) }, func() error { return tracedFile.Use(useFile) }},
+		{"tx", func() error { return tx.Use(useTx) }, func() error { return tracedTx.Use(useTx) }},
+		{"rows", func() error { return rows.Use(useRows) }, func() error { return tracedRows.Use(useRows) }},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			plain, tracing := allocs(t, c.plain), allocs(t, c.tracing)
+			if tracing > plain {
+				t.Errorf("%v allocations per Use with a nil tracer, %v without", tracing, plain)
+			}
+		})
+	}
+}
+
+func BenchmarkRunTransactionNilTracer(b *testing.B) {
+	tx := resource.RunTransaction(openDB(b), resource.WithTxTracing(nil))
+	benchmark(b, func() error { return tx.Use(useTx) })
+}
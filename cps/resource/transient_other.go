@@ -0,0 +1,9 @@
+//go:build !unix && !windows
+
+package resource
+
+// IsTransientOpenError tells whether opening a file failed for a reason which may go away by itself.
+// No error is known to be on this platform.
+func IsTransientOpenError(err error) bool {
+	return false
+}
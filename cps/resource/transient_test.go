@@ -0,0 +1,102 @@
+//go:build unix
+
+package resource_test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+// failOpens makes the file resources fail to open their files with err the first failures times,
+// counting the attempts.
+func failOpens(t *testing.T, err error, failures int) *int {
+	var attempts int
+	resource.SetOpenFile(t, func(name string, flag int, perm os.FileMode) (*os.File, error) {
+		attempts++
+		if attempts <= failures {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		return os.OpenFile(name, flag, perm)
+	})
+	return &attempts
+}
+
+func TestRetryTransientOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.txt")
+	writeFile(t, path, "hello")
+	attempts := failOpens(t, syscall.EINTR, 2)
+	sleeper := &advancingSleeper{clock: newFakeClock()}
+	policy := resource.ExponentialBackoff(10*time.Millisecond, time.Second, 5, 0)
+	policy.Sleeper = sleeper
+
+	var got []byte
+	err := resource.NewReadFileResource(path, resource.RetryTransientOpen(policy)).Use(func(r io.Reader) error {
+		var err error
+		got, err = io.ReadAll(r)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "hello" || *attempts != 3 {
+		t.Errorf("read %q in %d attempts, want hello in 3", got, *attempts)
+	}
+	if want := []time.Duration{10 * time.Millisecond, 20 * time.Millisecond}; !slices.Equal(sleeper.delays, want) {
+		t.Errorf("delays = %v, want %v", sleeper.delays, want)
+	}
+}
+
+func TestRetryTransientOpenGivesUp(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.txt")
+	writeFile(t, path, "hello")
+	for _, test := range []struct {
+		name     string
+		err      error
+		opt      []resource.FileOption
+		attempts int
+	}{
+		{"transient", syscall.EAGAIN, []resource.FileOption{resource.RetryTransientOpen(resource.FixedDelay(0, 3))}, 3},
+		{"not transient", syscall.EACCES, []resource.FileOption{resource.RetryTransientOpen(resource.FixedDelay(0, 3))}, 1},
+		{"without the option", syscall.EINTR, nil, 1},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			attempts := failOpens(t, test.err, 100)
+			err := resource.NewReadFileResource(path, test.opt...).Use(func(io.Reader) error {
+				t.Error("callback called")
+				return nil
+			})
+			if !errors.Is(err, test.err) || phaseOf(t, err) != resource.PhaseAcquire {
+				t.Errorf("Use = %v, want the acquire error of the open", err)
+			}
+			if *attempts != test.attempts {
+				t.Errorf("%d attempts, want %d", *attempts, test.attempts)
+			}
+		})
+	}
+}
+
+func TestIsTransientOpenError(t *testing.T) {
+	for err, want := range map[error]bool{
+		syscall.EINTR:  true,
+		syscall.EAGAIN: true,
+		&fs.PathError{Op: "open", Path: "f", Err: syscall.EINTR}: true,
+		fmt.Errorf("open: %w", syscall.EAGAIN):                   true,
+		syscall.ENOENT:                                           false,
+		syscall.EACCES:                                           false,
+		errors.New("other"):                                      false,
+	} {
+		if got := resource.IsTransientOpenError(err); got != want {
+			t.Errorf("IsTransientOpenError(%v) = %v, want %v", err, got, want)
+		}
+	}
+}
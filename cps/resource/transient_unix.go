@@ -0,0 +1,14 @@
+//go:build unix
+
+package resource
+
+import (
+	"errors"
+	"syscall"
+)
+
+// IsTransientOpenError tells whether opening a file failed for a reason which may go away by itself.
+// It's EINTR or EAGAIN on unix, a sharing, lock or access violation on Windows.
+func IsTransientOpenError(err error) bool {
+	return errors.Is(err, syscall.EINTR) || errors.Is(err, syscall.EAGAIN)
+}
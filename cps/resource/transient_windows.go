@@ -0,0 +1,21 @@
+//go:build windows
+
+package resource
+
+import (
+	"errors"
+	"syscall"
+)
+
+const (
+	errorSharingViolation syscall.Errno = 32
+	errorLockViolation    syscall.Errno = 33
+)
+
+// IsTransientOpenError tells whether opening a file failed for a reason which may go away by itself.
+// It's EINTR or EAGAIN on unix, a sharing, lock or access violation on Windows: another process,
+// like an antivirus, holding the file is reported as either.
+func IsTransientOpenError(err error) bool {
+	return errors.Is(err, errorSharingViolation) || errors.Is(err, errorLockViolation) ||
+		errors.Is(err, syscall.ERROR_ACCESS_DENIED)
+}
@@ -0,0 +1,84 @@
+package resource
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// ErrAborted is returned by TwoPhase.Use when the callback called Txn.Abort.
+var ErrAborted = errors.New("aborted")
+
+// Txn lets a TwoPhase callback decide the outcome itself instead of through its returned error.
+type Txn struct {
+	mu      sync.Mutex
+	decided bool
+	aborted bool
+	reason  error
+}
+
+// Commit asks for the commit; a later Abort is ignored. It doesn't override a failure:
+// a non-nil error returned by the callback still rolls back.
+func (t *Txn) Commit() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.decided = true
+}
+
+// Abort forces the rollback, even when the callback returns nil, unless Commit or Abort was called before.
+// reason, which may be nil, is wrapped in the error returned by Use.
+func (t *Txn) Abort(reason error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.decided {
+		t.decided = true
+		t.aborted = true
+		t.reason = reason
+	}
+}
+
+func (t *Txn) outcome(err error) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.aborted {
+		return err
+	}
+	abortErr := ErrAborted
+	if t.reason != nil {
+		abortErr = fmt.Errorf("%w: %w", ErrAborted, t.reason)
+	}
+	if err != nil {
+		return errors.Join(abortErr, err)
+	}
+	return abortErr
+}
+
+// TwoPhase is a resource whose release commits or rolls back, and whose callback controls that with a Txn.
+// Without a Txn call it commits on a nil error and rolls back otherwise, like the resource it wraps.
+type TwoPhase[T any] struct {
+	Use func(callback func(value T, txn *Txn) error) error
+}
+
+// NewTwoPhase wraps a resource which commits when its callback returns nil and rolls back otherwise.
+func NewTwoPhase[T any](r Resource[T]) TwoPhase[T] {
+	return TwoPhase[T]{
+		Use: func(callback func(value T, txn *Txn) error) error {
+			return r.Use(func(value T) error {
+				var txn Txn
+				return txn.outcome(callback(value, &txn))
+			})
+		},
+	}
+}
+
+// NewTwoPhaseAtomicFileResource is NewAtomicFileResource with a Txn: an aborted file is never renamed to path.
+func NewTwoPhaseAtomicFileResource(path string, perm os.FileMode, opts ...FileOption) TwoPhase[*os.File] {
+	return NewTwoPhase(FromUsable(NewAtomicFileResource(path, perm, opts...)))
+}
+
+// RunTwoPhaseTransaction is RunTransaction with a Txn: an aborted transaction is rolled back.
+func RunTwoPhaseTransaction(db *sql.DB, opts ...TxOption) TwoPhase[*sql.Tx] {
+	return NewTwoPhase(RunTransaction(db, opts...))
+}
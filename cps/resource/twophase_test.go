@@ -0,0 +1,132 @@
+package resource_test
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+func TestTwoPhaseAtomicFile(t *testing.T) {
+	errChecksum := errors.New("checksum mismatch")
+	errWrite := errors.New("write failed")
+	for _, test := range []struct {
+		name      string
+		callback  func(fd *os.File, txn *resource.Txn) error
+		published bool
+		want      []error
+	}{
+		{
+			name:      "default commit",
+			callback:  func(fd *os.File, txn *resource.Txn) error { return writeHello(fd) },
+			published: true,
+		},
+		{
+			name: "default rollback",
+			callback: func(fd *os.File, txn *resource.Txn) error {
+				writeHello(fd)
+				return errWrite
+			},
+			want: []error{errWrite},
+		},
+		{
+			name: "abort with a nil error",
+			callback: func(fd *os.File, txn *resource.Txn) error {
+				writeHello(fd)
+				txn.Abort(errChecksum)
+				return nil
+			},
+			want: []error{resource.ErrAborted, errChecksum},
+		},
+		{
+			name: "abort without a reason",
+			callback: func(fd *os.File, txn *resource.Txn) error {
+				txn.Abort(nil)
+				return writeHello(fd)
+			},
+			want: []error{resource.ErrAborted},
+		},
+		{
+			name: "commit with an error",
+			callback: func(fd *os.File, txn *resource.Txn) error {
+				writeHello(fd)
+				txn.Commit()
+				return errWrite
+			},
+			want: []error{errWrite},
+		},
+		{
+			name: "abort after commit",
+			callback: func(fd *os.File, txn *resource.Txn) error {
+				txn.Commit()
+				txn.Abort(errChecksum)
+				return writeHello(fd)
+			},
+			published: true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "report.txt")
+			err := resource.NewTwoPhaseAtomicFileResource(path, resource.OwnerRWOnly).Use(test.callback)
+			if len(test.want) == 0 && err != nil {
+				t.Errorf("Use = %v, want nil", err)
+			}
+			for _, want := range test.want {
+				if !errors.Is(err, want) {
+					t.Errorf("Use = %v, want %v", err, want)
+				}
+			}
+			if _, statErr := os.Stat(path); (statErr == nil) != test.published {
+				t.Errorf("published = %v, want %v", statErr == nil, test.published)
+			}
+			if !test.published {
+				if entries := dirEntries(t, dir); len(entries) != 0 {
+					t.Errorf("files = %q, want the temporary file removed", entries)
+				}
+			}
+		})
+	}
+}
+
+func TestTwoPhaseTransaction(t *testing.T) {
+	db := openDB(t)
+	errLate := errors.New("late check failed")
+
+	err := resource.RunTwoPhaseTransaction(db).Use(func(tx *sql.Tx, txn *resource.Txn) error {
+		err := insertItem(tx, "aborted")
+		if err != nil {
+			return err
+		}
+		txn.Abort(errLate)
+		return nil
+	})
+	if !errors.Is(err, resource.ErrAborted) || !errors.Is(err, errLate) {
+		t.Errorf("aborted Use = %v, want ErrAborted with the reason", err)
+	}
+	if n := countItems(t, db); n != 0 {
+		t.Errorf("%d items after the abort, want it rolled back", n)
+	}
+
+	err = resource.RunTwoPhaseTransaction(db).Use(func(tx *sql.Tx, txn *resource.Txn) error {
+		err := insertItem(tx, "failed")
+		if err != nil {
+			return err
+		}
+		txn.Commit()
+		return errLate
+	})
+	if !errors.Is(err, errLate) || countItems(t, db) != 0 {
+		t.Errorf("committed Use failing = %v with %d items, want it rolled back", err, countItems(t, db))
+	}
+
+	err = resource.RunTwoPhaseTransaction(db).Use(func(tx *sql.Tx, txn *resource.Txn) error {
+		return insertItem(tx, "committed")
+	})
+	if err != nil || countItems(t, db) != 1 {
+		t.Errorf("default Use = %v with %d items, want it committed", err, countItems(t, db))
+	}
+}
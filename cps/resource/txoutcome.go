@@ -0,0 +1,54 @@
+package resource
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/Q69K/using-cps-in-golang/cps/sqlerr"
+)
+
+// ErrTxOutcomeUnknown matches every *TxOutcomeUnknownError with errors.Is.
+var ErrTxOutcomeUnknown = errors.New("transaction outcome unknown")
+
+// TxOutcomeUnknownError is returned when the connection was lost while ending a transaction
+// (sqlerr.IsConnectionError): the database may or may not have applied it, so the caller
+// has to find out and reconcile rather than assume either way.
+type TxOutcomeUnknownError struct {
+	Tx  string // the description of the transaction
+	Op  string // "commit" or "rollback"
+	Err error
+}
+
+func (e *TxOutcomeUnknownError) Error() string {
+	return fmt.Sprintf("%v: %s %s: %v", ErrTxOutcomeUnknown, e.Tx, e.Op, e.Err)
+}
+
+func (e *TxOutcomeUnknownError) Is(target error) bool {
+	return target == ErrTxOutcomeUnknown
+}
+
+func (e *TxOutcomeUnknownError) Unwrap() error {
+	return e.Err
+}
+
+// OnOutcomeUnknown runs hook with the *TxOutcomeUnknownError when the outcome of the transaction
+// is unknown, for alerting; OnAfterRollback hooks run too.
+func OnOutcomeUnknown(hook func(err *TxOutcomeUnknownError)) TxOption {
+	return func(options *txOptions) {
+		options.onUnknown = append(options.onUnknown, hook)
+	}
+}
+
+// outcomeUnknown returns the *TxOutcomeUnknownError of the failed end of a transaction, nil when
+// the error isn't a connection one; the hooks of OnOutcomeUnknown are run with it.
+func (options *txOptions) outcomeUnknown(tx, op string, err error) *TxOutcomeUnknownError {
+	if err == nil || errors.Is(err, sql.ErrTxDone) || !sqlerr.IsConnectionError(err) {
+		return nil
+	}
+	unknown := &TxOutcomeUnknownError{Tx: tx, Op: op, Err: err}
+	for _, hook := range options.onUnknown {
+		hook(unknown)
+	}
+	return unknown
+}
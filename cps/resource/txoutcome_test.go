@@ -0,0 +1,127 @@
+package resource_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+// endingConnector opens connections whose transactions end with endErr once the test set it,
+// like a connection dying between the callback and the end of its transaction.
+type endingConnector struct {
+	endErr atomic.Pointer[error]
+}
+
+func (c *endingConnector) Connect(context.Context) (driver.Conn, error) { return endingConn{c}, nil }
+func (c *endingConnector) Driver() driver.Driver                        { return nil }
+
+// end makes the transactions end with err from now on.
+func (c *endingConnector) end(err error) {
+	c.endErr.Store(&err)
+}
+
+func (c *endingConnector) err() error {
+	if err := c.endErr.Load(); err != nil {
+		return *err
+	}
+	return nil
+}
+
+type endingConn struct {
+	connector *endingConnector
+}
+
+func (c endingConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c endingConn) Close() error                        { return nil }
+func (c endingConn) Begin() (driver.Tx, error)           { return endingTx(c), nil }
+
+func (c endingConn) ExecContext(context.Context, string, []driver.NamedValue) (driver.Result, error) {
+	return driver.RowsAffected(1), nil
+}
+
+type endingTx endingConn
+
+func (tx endingTx) Commit() error   { return tx.connector.err() }
+func (tx endingTx) Rollback() error { return tx.connector.err() }
+
+// unknownOutcomes runs the callback in a transaction whose end fails with endErr,
+// returning the error and the errors the OnOutcomeUnknown hook got.
+func unknownOutcomes(t *testing.T, endErr, callbackErr error) (error, []*resource.TxOutcomeUnknownError) {
+	connector := &endingConnector{}
+	db := sql.OpenDB(connector)
+	t.Cleanup(func() {
+		db.Close()
+	})
+	var hooked []*resource.TxOutcomeUnknownError
+	err := resource.RunTransaction(db, resource.OnOutcomeUnknown(func(err *resource.TxOutcomeUnknownError) {
+		hooked = append(hooked, err)
+	})).Use(func(tx *sql.Tx) error {
+		_, err := tx.Exec("UPDATE accounts SET balance = balance - 10")
+		if err != nil {
+			return err
+		}
+		connector.end(endErr)
+		return callbackErr
+	})
+	return err, hooked
+}
+
+// checkOutcomeUnknown checks err is the *TxOutcomeUnknownError of op, the one the hook got.
+func checkOutcomeUnknown(t *testing.T, err error, hooked []*resource.TxOutcomeUnknownError, op string) {
+	t.Helper()
+	var unknown *resource.TxOutcomeUnknownError
+	if !errors.As(err, &unknown) || !errors.Is(err, resource.ErrTxOutcomeUnknown) || !errors.Is(err, driver.ErrBadConn) {
+		t.Fatalf("Use = %v, want a *TxOutcomeUnknownError of the lost connection", err)
+	}
+	if unknown.Op != op || !strings.HasPrefix(unknown.Tx, "tx #") || phaseOf(t, err) != resource.PhaseRelease {
+		t.Errorf("error = %+v, want the release error of the %s", unknown, op)
+	}
+	if want := "transaction outcome unknown: " + unknown.Tx + " " + op + ": driver: bad connection"; unknown.Error() != want {
+		t.Errorf("Error = %q, want %q", unknown.Error(), want)
+	}
+	if len(hooked) != 1 || hooked[0] != unknown {
+		t.Errorf("hook got %v, want the error once", hooked)
+	}
+}
+
+func TestTxOutcomeUnknownOnRollback(t *testing.T) {
+	errCallback := errors.New("callback failed")
+	warnings := captureWarnings(t)
+	// not swallowed, even in lenient mode
+	err, hooked := unknownOutcomes(t, driver.ErrBadConn, errCallback)
+	if !errors.Is(err, errCallback) {
+		t.Errorf("Use = %v, want the callback error too", err)
+	}
+	checkOutcomeUnknown(t, err, hooked, "rollback")
+	if hasWarning(warnings(), resource.WarnSwallowedError) {
+		t.Errorf("warnings = %v, want the rollback error returned instead", warnings())
+	}
+}
+
+func TestTxOutcomeUnknownOnCommit(t *testing.T) {
+	err, hooked := unknownOutcomes(t, driver.ErrBadConn, nil)
+	checkOutcomeUnknown(t, err, hooked, "commit")
+}
+
+func TestTxOutcomeKnown(t *testing.T) {
+	err, hooked := unknownOutcomes(t, nil, nil)
+	if err != nil || len(hooked) != 0 {
+		t.Errorf("Use = %v, hook got %v, want a plain commit", err, hooked)
+	}
+
+	// a rollback failing otherwise is a secondary error
+	errCallback := errors.New("callback failed")
+	strictly(t, errCallback, func(t *testing.T) error {
+		err, hooked := unknownOutcomes(t, errors.New("rollback failed"), errCallback)
+		if errors.Is(err, resource.ErrTxOutcomeUnknown) || len(hooked) != 0 {
+			t.Errorf("Use = %v, hook got %v, want the outcome known", err, hooked)
+		}
+		return err
+	})
+}
@@ -0,0 +1,136 @@
+package resource
+
+import (
+	"fmt"
+	"runtime"
+	"sync/atomic"
+)
+
+var uncheckedDebug atomic.Bool
+
+// DebugUnchecked turns on or off the detection of the errors of Use nobody looked at,
+// like the error of a fr.Use(cb) or db.Use(cb) statement. Every failed Use of NewFileResource, NewDBResource,
+// RunTransaction, RunTransactionCtx and QueryRows then returns its error wrapped, with the call site
+// of the Use; once the wrapper is garbage collected without having been observed,
+// a WarnUncheckedError warning is reported, whose Err is an *UncheckedError.
+//
+// The error is observed by errors.Is, errors.As, its Error method (printing it, or wrapping it with
+// fmt.Errorf) and Observed. Comparing it to nil doesn't count: an error only compared to nil
+// should go through Observed. The wrapper also hides the error from type assertions and ==,
+// use errors.As and errors.Is.
+//
+// Off, the default, it costs one atomic load per failed Use.
+func DebugUnchecked(on bool) {
+	uncheckedDebug.Store(on)
+}
+
+// UncheckedError is the error of a Use which was never checked.
+type UncheckedError struct {
+	Resource string
+	// Site is where the Use was called from.
+	Site string
+	Err  error
+}
+
+func (e *UncheckedError) Error() string {
+	return fmt.Sprintf("error of %s used by %s never checked: %v", e.Resource, e.Site, e.Err)
+}
+
+func (e *UncheckedError) Unwrap() error {
+	return e.Err
+}
+
+// checkedError is a failed Use in DebugUnchecked mode.
+type checkedError struct {
+	err      error
+	resource string
+	site     string
+	observed atomic.Bool
+}
+
+func (e *checkedError) Error() string {
+	Observed(e)
+	return e.err.Error()
+}
+
+func (e *checkedError) Unwrap() error {
+	return e.err
+}
+
+func (e *checkedError) Is(error) bool {
+	Observed(e)
+	return false
+}
+
+func (e *checkedError) As(any) bool {
+	Observed(e)
+	return false
+}
+
+// Observed marks the Use errors in err as checked for DebugUnchecked, and returns err.
+func Observed(err error) error {
+	if !uncheckedDebug.Load() {
+		return err
+	}
+	observe(err)
+	return err
+}
+
+func observe(err error) {
+	switch e := err.(type) {
+	case nil:
+	case *checkedError:
+		if !e.observed.Swap(true) {
+			observe(e.err)
+		}
+	case interface{ Unwrap() error }:
+		observe(e.Unwrap())
+	case interface{ Unwrap() []error }:
+		for _, err := range e.Unwrap() {
+			observe(err)
+		}
+	}
+}
+
+// withoutCheck is err without its DebugUnchecked wrapper, for the comparisons of this package.
+// It doesn't observe err.
+func withoutCheck(err error) error {
+	if checked, ok := err.(*checkedError); ok {
+		return checked.err
+	}
+	return err
+}
+
+// hasChecked tells whether err wraps a checkedError, without observing it like errors.As would.
+func hasChecked(err error) bool {
+	switch e := err.(type) {
+	case *checkedError:
+		return true
+	case interface{ Unwrap() error }:
+		return hasChecked(e.Unwrap())
+	case interface{ Unwrap() []error }:
+		for _, err := range e.Unwrap() {
+			if hasChecked(err) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkResult is err wrapped to detect unchecked errors in DebugUnchecked mode.
+func checkResult(err error, resource string) error {
+	if err == nil || !uncheckedDebug.Load() {
+		return err
+	}
+	if hasChecked(err) {
+		return err // reported by the Use it comes from
+	}
+	checked := &checkedError{err: err, resource: resource, site: callSite()}
+	runtime.SetFinalizer(checked, func(e *checkedError) {
+		if !e.observed.Load() {
+			warnErr(WarnUncheckedError, e.resource, &UncheckedError{Resource: e.resource, Site: e.site, Err: e.err})
+		}
+	})
+	return checked
+}
@@ -0,0 +1,104 @@
+package resource_test
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+func debugUnchecked(t *testing.T) {
+	resource.DebugUnchecked(true)
+	t.Cleanup(func() {
+		resource.DebugUnchecked(false)
+	})
+}
+
+// failingUse is the error of a Use of a file which doesn't exist.
+func failingUse(t *testing.T) error {
+	return resource.NewFileResource(filepath.Join(t.TempDir(), "missing"), os.O_RDONLY, 0).Use(func(*os.File) error {
+		return nil
+	})
+}
+
+// collect runs the garbage collector until the finalizers of the unreachable errors ran.
+func collect() {
+	for range 3 {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDebugUncheckedReportsIgnoredError(t *testing.T) {
+	warnings := captureWarnings(t)
+	debugUnchecked(t)
+	func() {
+		failingUse(t) // ignored on purpose
+	}()
+	collect()
+
+	var unchecked *resource.UncheckedError
+	for _, w := range warnings() {
+		if w.Kind == resource.WarnUncheckedError && errors.As(w.Err, &unchecked) {
+			break
+		}
+	}
+	if unchecked == nil {
+		t.Fatalf("no WarnUncheckedError in %v", warnings())
+	}
+	if unchecked.Site == "" || !errors.Is(unchecked.Err, os.ErrNotExist) {
+		t.Errorf("unchecked error %v, want the site and the error of the Use", unchecked)
+	}
+}
+
+func TestDebugUncheckedIgnoresObservedErrors(t *testing.T) {
+	warnings := captureWarnings(t)
+	debugUnchecked(t)
+	func() {
+		err := failingUse(t)
+		if !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Use: %v, want os.ErrNotExist", err)
+		}
+		var resourceErr *resource.ResourceError
+		if !errors.As(failingUse(t), &resourceErr) {
+			t.Errorf("no *ResourceError")
+		}
+		_ = failingUse(t).Error()
+		resource.Observed(failingUse(t))
+	}()
+	collect()
+	if hasWarning(warnings(), resource.WarnUncheckedError) {
+		t.Errorf("observed errors reported: %v", warnings())
+	}
+}
+
+func TestDebugUncheckedKeepsDescription(t *testing.T) {
+	debugUnchecked(t)
+	err := failingUse(t)
+	var resourceErr *resource.ResourceError
+	if !errors.As(err, &resourceErr) {
+		t.Fatalf("Use: %v, want a *ResourceError", err)
+	}
+	if resourceErr.Phase != resource.PhaseAcquire || resourceErr.Resource == "" {
+		t.Errorf("error %#v, want a described acquire error", resourceErr)
+	}
+}
+
+func TestDebugUncheckedDryRun(t *testing.T) {
+	db := openDB(t)
+	for _, on := range []bool{false, true} {
+		resource.DebugUnchecked(on)
+		err := resource.RunTransactionDryRun(db).Use(func(tx *sql.Tx) error {
+			return insertItem(tx, "a")
+		})
+		resource.DebugUnchecked(false)
+		if err != nil {
+			t.Errorf("DebugUnchecked(%v): dry run Use: %v, want nil", on, err)
+		}
+	}
+}
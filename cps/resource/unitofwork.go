@@ -0,0 +1,57 @@
+package resource
+
+import (
+	"database/sql"
+	"sync"
+)
+
+// UnitOfWork collects database operations to run later in a single transaction.
+// The zero value is empty and ready to use; it's safe for concurrent use.
+type UnitOfWork struct {
+	flushing sync.Mutex
+
+	mu  sync.Mutex
+	ops []func(tx *sql.Tx) error
+}
+
+// Register queues op for the next Flush.
+func (u *UnitOfWork) Register(op func(tx *sql.Tx) error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.ops = append(u.ops, op)
+}
+
+// Flush runs the queued operations in registration order inside one RunTransaction.
+// They are dequeued when the transaction commits; after a failure they stay queued,
+// so flushing again retries all of them. Flushing an empty unit doesn't begin a transaction.
+//
+// Operations registered while a Flush runs are left for the next one.
+func (u *UnitOfWork) Flush(db *sql.DB, opts ...TxOption) error {
+	u.flushing.Lock()
+	defer u.flushing.Unlock()
+
+	u.mu.Lock()
+	ops := u.ops[:len(u.ops):len(u.ops)]
+	u.mu.Unlock()
+	if len(ops) == 0 {
+		return nil
+	}
+
+	err := RunTransaction(db, opts...).Use(func(tx *sql.Tx) error {
+		for _, op := range ops {
+			err := op(tx)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.ops = append([]func(tx *sql.Tx) error(nil), u.ops[len(ops):]...)
+	return nil
+}
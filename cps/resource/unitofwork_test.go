@@ -0,0 +1,137 @@
+package resource_test
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/group"
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+// itemNames returns the names of the items table by id.
+func itemNames(t *testing.T, db *sql.DB) []string {
+	t.Helper()
+	var names []string
+	for name, err := range resource.Rows[string](db, "SELECT name FROM items ORDER BY id") {
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestUnitOfWorkOrder(t *testing.T) {
+	db := openDB(t)
+	var u resource.UnitOfWork
+	for _, name := range []string{"a", "b", "c"} {
+		u.Register(func(tx *sql.Tx) error { return insertItem(tx, name) })
+	}
+	u.Register(func(tx *sql.Tx) error {
+		_, err := tx.Exec("UPDATE items SET name = name || '!' WHERE name = 'b'") // sees the earlier operations
+		return err
+	})
+	if err := u.Flush(db); err != nil {
+		t.Fatal(err)
+	}
+	if got := itemNames(t, db); !slices.Equal(got, []string{"a", "b!", "c"}) {
+		t.Errorf("items = %q, want the operations run in registration order", got)
+	}
+
+	// the queue is empty after a success
+	if err := u.Flush(db); err != nil {
+		t.Fatal(err)
+	}
+	if n := countItems(t, db); n != 3 {
+		t.Errorf("%d rows after a second Flush, want it to do nothing", n)
+	}
+}
+
+func TestUnitOfWorkFailureKeepsQueue(t *testing.T) {
+	db := openDB(t)
+	var u resource.UnitOfWork
+	fail := true
+	errOp := errors.New("op")
+	runs := 0
+	u.Register(func(tx *sql.Tx) error { runs++; return insertItem(tx, "a") })
+	u.Register(func(tx *sql.Tx) error {
+		if fail {
+			return errOp
+		}
+		return insertItem(tx, "b")
+	})
+
+	if err := u.Flush(db); !errors.Is(err, errOp) {
+		t.Fatalf("Flush = %v, want %v", err, errOp)
+	}
+	if n := countItems(t, db); n != 0 {
+		t.Errorf("%d rows after a failed Flush, want the transaction rolled back", n)
+	}
+
+	fail = false
+	if err := u.Flush(db); err != nil {
+		t.Fatal(err)
+	}
+	if got := itemNames(t, db); !slices.Equal(got, []string{"a", "b"}) || runs != 2 {
+		t.Errorf("items = %q after %d runs of the first operation, want the retry to run everything again", got, runs)
+	}
+}
+
+func TestUnitOfWorkConcurrentRegister(t *testing.T) {
+	db := openDB(t)
+	var u resource.UnitOfWork
+	tasks := group.NewSafeWaitGroup()
+	for i := range 50 {
+		tasks.Run(func() {
+			u.Register(func(tx *sql.Tx) error { return insertItem(tx, fmt.Sprint(i)) })
+		})
+	}
+	tasks.Wait()
+	if err := u.Flush(db); err != nil {
+		t.Fatal(err)
+	}
+	if n := countItems(t, db); n != 50 {
+		t.Errorf("%d rows, want the 50 registered operations", n)
+	}
+}
+
+func TestUnitOfWorkRegisterDuringFlush(t *testing.T) {
+	db := openDB(t)
+	var u resource.UnitOfWork
+	u.Register(func(tx *sql.Tx) error {
+		u.Register(func(tx *sql.Tx) error { return insertItem(tx, "next") })
+		return insertItem(tx, "first")
+	})
+	if err := u.Flush(db); err != nil {
+		t.Fatal(err)
+	}
+	if got := itemNames(t, db); !slices.Equal(got, []string{"first"}) {
+		t.Errorf("items = %q, want the operation registered during Flush left for the next one", got)
+	}
+	if err := u.Flush(db); err != nil {
+		t.Fatal(err)
+	}
+	if got := itemNames(t, db); !slices.Equal(got, []string{"first", "next"}) {
+		t.Errorf("items = %q after the next Flush", got)
+	}
+}
+
+func TestUnitOfWorkEmptyFlush(t *testing.T) {
+	driver, name := countingSQLite(t)
+	db, err := sql.Open(name, filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var u resource.UnitOfWork
+	if err := u.Flush(db); err != nil {
+		t.Fatal(err)
+	}
+	if counts := driver.Counts(); counts.Begins != 0 {
+		t.Errorf("counts = %+v, want no transaction for an empty unit", counts)
+	}
+}
@@ -0,0 +1,82 @@
+package resource
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var (
+	// ErrNoChange is returned by the fn of UpdateFile to leave the file as it is.
+	ErrNoChange = errors.New("no change")
+	// ErrUpdateConflict is returned by UpdateFile when the file kept changing under it.
+	ErrUpdateConflict = errors.New("file changed concurrently")
+)
+
+// UpdateFileAttempts is how many times UpdateFile runs fn before giving up with ErrUpdateConflict.
+const UpdateFileAttempts = 10
+
+// updateLocks serializes the UpdateFile calls of this process on the same path.
+var updateLocks sync.Map // absolute path -> *sync.Mutex
+
+// UpdateFile replaces the content of path with what fn makes of the current one
+// (empty when the file doesn't exist), writing it through NewAtomicFileResource with perm.
+//
+// Right before the rename the file is read again: when another process changed it meanwhile
+// the new content is dropped and fn runs again on the fresh one, up to UpdateFileAttempts times.
+// That narrows the race with other processes without closing it; the calls of this process
+// on the same path are serialized, so they never lose updates.
+// fn returning ErrNoChange skips the write, and UpdateFile returns nil.
+func UpdateFile(path string, perm os.FileMode, fn func(current []byte) ([]byte, error)) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	lock, _ := updateLocks.LoadOrStore(abs, new(sync.Mutex))
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	errConflict := errors.New("conflict")
+	for attempt := 0; attempt < UpdateFileAttempts; attempt++ {
+		current, err := readIfExists(path)
+		if err != nil {
+			return phaseError(PhaseAcquire, err)
+		}
+		updated, err := fn(current)
+		if errors.Is(err, ErrNoChange) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		err = NewAtomicFileResource(path, perm, Sync()).Use(func(fd *os.File) error {
+			_, err := fd.Write(updated)
+			if err != nil {
+				return err
+			}
+			now, err := readIfExists(path)
+			if err != nil {
+				return err
+			}
+			if !bytes.Equal(now, current) {
+				return errConflict
+			}
+			return nil
+		})
+		if err != errConflict {
+			return err
+		}
+	}
+	return ErrUpdateConflict
+}
+
+func readIfExists(path string) ([]byte, error) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return content, err
+}
@@ -0,0 +1,111 @@
+package resource_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/group"
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+// increment adds one to the counter in current, zero when empty.
+func increment(current []byte) ([]byte, error) {
+	n := 0
+	if len(current) > 0 {
+		var err error
+		n, err = strconv.Atoi(string(current))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return []byte(strconv.Itoa(n + 1)), nil
+}
+
+func TestUpdateFileConcurrentUpdaters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "counter")
+	g := group.NewSafeWaitGroup()
+	for range 2 {
+		g.Run(func() {
+			for range 100 {
+				err := resource.UpdateFile(path, resource.OwnerRWOnly, increment)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		})
+	}
+	g.Wait()
+
+	if got := readFile(t, path); got != "200" {
+		t.Errorf("counter = %s, want 200", got)
+	}
+}
+
+func TestUpdateFileNoChange(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+	var got []byte
+	err := resource.UpdateFile(path, resource.OwnerRWOnly, func(current []byte) ([]byte, error) {
+		got = current
+		return nil, resource.ErrNoChange
+	})
+	if err != nil || got != nil {
+		t.Errorf("UpdateFile = %v with current %q, want nil for a new file", err, got)
+	}
+	if entries := dirEntries(t, dir); len(entries) != 0 {
+		t.Errorf("files = %q, want nothing written", entries)
+	}
+
+	errBad := errors.New("bad state")
+	writeFile(t, path, "{}")
+	err = resource.UpdateFile(path, resource.OwnerRWOnly, func(current []byte) ([]byte, error) {
+		return []byte("broken"), errBad
+	})
+	if !errors.Is(err, errBad) || readFile(t, path) != "{}" {
+		t.Errorf("UpdateFile failing = %v, content %q, want it untouched", err, readFile(t, path))
+	}
+}
+
+func TestUpdateFileRetriesOnConflict(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "counter")
+	writeFile(t, path, "1")
+
+	calls := 0
+	err := resource.UpdateFile(path, resource.OwnerRWOnly, func(current []byte) ([]byte, error) {
+		calls++
+		if calls == 1 {
+			// another process updates the file meanwhile
+			err := os.WriteFile(path, []byte("5"), 0600)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return increment(current)
+	})
+	if err != nil || calls != 2 {
+		t.Fatalf("UpdateFile = %v after %d calls, want a second one on the fresh content", err, calls)
+	}
+	if got := readFile(t, path); got != "6" {
+		t.Errorf("counter = %s, want the concurrent update kept", got)
+	}
+
+	calls = 0
+	err = resource.UpdateFile(path, resource.OwnerRWOnly, func(current []byte) ([]byte, error) {
+		calls++
+		err := os.WriteFile(path, []byte(strconv.Itoa(100+calls)), 0600)
+		if err != nil {
+			return nil, err
+		}
+		return []byte("lost"), nil
+	})
+	if !errors.Is(err, resource.ErrUpdateConflict) || calls != resource.UpdateFileAttempts {
+		t.Errorf("UpdateFile always conflicting = %v after %d calls, want ErrUpdateConflict after %d", err, calls, resource.UpdateFileAttempts)
+	}
+	if got := readFile(t, path); got == "lost" {
+		t.Error("a conflicting update was written")
+	}
+}
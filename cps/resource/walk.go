@@ -0,0 +1,130 @@
+package resource
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/Q69K/using-cps-in-golang/cps/group"
+)
+
+type walkOptions struct {
+	concurrency  int
+	policy       group.ErrorPolicy
+	checkpointer *Checkpointer
+}
+
+// WalkOption configures ForEachFile.
+type WalkOption func(options *walkOptions)
+
+// WalkConcurrency processes up to n files at a time, 1 by default.
+func WalkConcurrency(n int) WalkOption {
+	return func(options *walkOptions) {
+		options.concurrency = n
+	}
+}
+
+// WalkErrorPolicy sets what ForEachFile does on errors, group.FailFast by default.
+// With group.CollectAll unreadable files and directories are reported and skipped.
+func WalkErrorPolicy(policy group.ErrorPolicy) WalkOption {
+	return func(options *walkOptions) {
+		options.policy = policy
+	}
+}
+
+type pathError struct {
+	path string
+	err  error
+}
+
+var errStopWalk = errors.New("stop walk")
+
+// ForEachFile walks root with filepath.WalkDir and calls fn for every file match accepts,
+// with the file opened read-only and closed before fn's slot goes to the next file.
+// match is called for directories too (returning false doesn't skip them), and nil matches every regular file.
+//
+// Symbolic links are not followed, so there can't be cycles; a link accepted by match is opened
+// like any file, a link to a directory then fails to read.
+// The returned error joins the errors of the failed paths, in path order.
+func ForEachFile(root string, match func(path string, d fs.DirEntry) bool, fn func(path string, r io.Reader) error, opts ...WalkOption) error {
+	options := walkOptions{concurrency: 1, policy: group.FailFast}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if match == nil {
+		match = func(path string, d fs.DirEntry) bool {
+			return d.Type().IsRegular()
+		}
+	}
+
+	var mu sync.Mutex
+	var errs []pathError
+	failed := false
+	fail := func(path string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		errs = append(errs, pathError{path, err})
+		failed = true
+	}
+	stopping := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return failed && options.policy == group.FailFast
+	}
+
+	files := group.NewBoundedSpawner(max(options.concurrency, 1))
+	walkErr := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if stopping() {
+			return errStopWalk
+		}
+		if ctxErr := options.checkpointer.Check(); ctxErr != nil {
+			fail(root, ctxErr)
+			return errStopWalk
+		}
+		if err != nil {
+			fail(path, err)
+			if options.policy == group.FailFast {
+				return errStopWalk
+			}
+			return nil // skips the unreadable directory
+		}
+		if d.IsDir() || !match(path, d) {
+			return nil
+		}
+
+		files.Run(func() {
+			if stopping() {
+				return
+			}
+			err := NewReadFileResource(path).Use(func(r io.Reader) error {
+				return fn(path, r)
+			})
+			if err != nil {
+				fail(path, err)
+			}
+		})
+		return nil
+	})
+	files.Wait()
+	if walkErr != nil && walkErr != errStopWalk {
+		fail(root, walkErr)
+	}
+
+	sort.SliceStable(errs, func(i, j int) bool {
+		return errs[i].path < errs[j].path
+	})
+	joined := make([]error, len(errs))
+	for i, e := range errs {
+		var pathErr *fs.PathError
+		if errors.As(e.err, &pathErr) && pathErr.Path == e.path {
+			joined[i] = e.err // already mentions the path
+		} else {
+			joined[i] = fmt.Errorf("%s: %w", e.path, e.err)
+		}
+	}
+	return errors.Join(joined...)
+}
@@ -0,0 +1,181 @@
+package resource_test
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/group"
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+// walkTree makes a tree with three .txt files, a .log file, a symbolic link to the root and a dangling one.
+func walkTree(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	for _, dir := range []string{"sub/deep", "empty"} {
+		err := os.MkdirAll(filepath.Join(root, dir), 0o755)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"a.txt", "b.log", "sub/c.txt", "sub/deep/d.txt"} {
+		writeFile(t, filepath.Join(root, name), "content of "+name)
+	}
+	err := errors.Join(
+		os.Symlink(root, filepath.Join(root, "sub", "cycle")),
+		os.Symlink(filepath.Join(root, "missing"), filepath.Join(root, "dangling")),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+func txtFiles(path string, d fs.DirEntry) bool {
+	return strings.HasSuffix(path, ".txt")
+}
+
+// walked calls ForEachFile, returning the relative paths processed with their content.
+func walked(t *testing.T, root string, match func(string, fs.DirEntry) bool, opts ...resource.WalkOption) (map[string]string, error) {
+	t.Helper()
+	var mu sync.Mutex
+	files := make(map[string]string)
+	err := resource.ForEachFile(root, match, func(path string, r io.Reader) error {
+		content, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		files[filepath.ToSlash(rel)] = string(content)
+		return nil
+	}, opts...)
+	return files, err
+}
+
+func TestForEachFileMatches(t *testing.T) {
+	root := walkTree(t)
+	for _, concurrency := range []int{1, 4} {
+		files, err := walked(t, root, txtFiles, resource.WalkConcurrency(concurrency))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]string{"a.txt": "content of a.txt", "sub/c.txt": "content of sub/c.txt", "sub/deep/d.txt": "content of sub/deep/d.txt"}
+		if len(files) != len(want) {
+			t.Errorf("concurrency %d: files = %q, want %q", concurrency, files, want)
+		}
+		for name, content := range want {
+			if files[name] != content {
+				t.Errorf("concurrency %d: %s = %q, want %q", concurrency, name, files[name], content)
+			}
+		}
+	}
+
+	files, err := walked(t, root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 4 || files["b.log"] == "" {
+		t.Errorf("files = %q, want the four regular files, without following the links", files)
+	}
+}
+
+func TestForEachFileConcurrency(t *testing.T) {
+	root := t.TempDir()
+	for i := range 20 {
+		writeFile(t, filepath.Join(root, string(rune('a'+i))+".txt"), "x")
+	}
+	var mu sync.Mutex
+	active, most := 0, 0
+	err := resource.ForEachFile(root, nil, func(path string, r io.Reader) error {
+		mu.Lock()
+		active++
+		most = max(most, active)
+		mu.Unlock()
+		_, err := io.ReadAll(r)
+		mu.Lock()
+		active--
+		mu.Unlock()
+		return err
+	}, resource.WalkConcurrency(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if most > 3 {
+		t.Errorf("%d files processed at a time, want at most 3", most)
+	}
+}
+
+func TestForEachFileFailFast(t *testing.T) {
+	root := walkTree(t)
+	errFn := errors.New("fn")
+	calls := 0
+	err := resource.ForEachFile(root, txtFiles, func(path string, r io.Reader) error {
+		calls++
+		return errFn
+	})
+	if !errors.Is(err, errFn) || !strings.Contains(err.Error(), filepath.Join(root, "a.txt")) {
+		t.Errorf("ForEachFile = %v, want the error of a.txt", err)
+	}
+	if calls != 1 {
+		t.Errorf("fn called %d times, want the walk stopped after the first error", calls)
+	}
+}
+
+func TestForEachFileCollectAllLinks(t *testing.T) {
+	root := walkTree(t)
+	files, err := walked(t, root, func(path string, d fs.DirEntry) bool { return true }, resource.WalkErrorPolicy(group.CollectAll))
+	if len(files) != 4 {
+		t.Errorf("files = %q, want the four regular files processed despite the errors", files)
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("ForEachFile = %v, want the dangling link not to exist", err)
+	}
+	errs := err.(interface{ Unwrap() []error }).Unwrap()
+	if len(errs) != 2 || !strings.Contains(errs[0].Error(), filepath.Join(root, "dangling")) || !strings.Contains(errs[1].Error(), filepath.Join(root, "sub", "cycle")) {
+		t.Errorf("errors %q, want the dangling link then the link to a directory", errs)
+	}
+}
+
+func TestForEachFileCollectAllUnreadableDirectory(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root reads every directory")
+	}
+	root := walkTree(t)
+	locked := filepath.Join(root, "sub", "locked")
+	err := os.Mkdir(locked, 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(locked, "e.txt"), "hidden")
+	err = os.Chmod(locked, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.Chmod(locked, 0o755) // for t.TempDir to remove it
+	})
+
+	files, err := walked(t, root, txtFiles, resource.WalkErrorPolicy(group.CollectAll))
+	if len(files) != 3 {
+		t.Errorf("files = %q, want the three readable .txt files", files)
+	}
+	if !errors.Is(err, fs.ErrPermission) || !strings.Contains(err.Error(), locked) {
+		t.Errorf("ForEachFile = %v, want permission denied for %s", err, locked)
+	}
+
+	_, err = walked(t, root, txtFiles)
+	if !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("ForEachFile failing fast = %v, want permission denied", err)
+	}
+}
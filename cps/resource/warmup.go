@@ -0,0 +1,73 @@
+package resource
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+
+	"github.com/Q69K/using-cps-in-golang/cps/group"
+)
+
+// Warmup makes NewDBResource establish n connections before the callback, concurrently,
+// each one running `SELECT 1`, and return them to the pool: the first queries of the callback
+// don't wait for database/sql to dial. The pool keeps up to n idle connections for it.
+// A failed connection fails the acquisition, unless BestEffortWarmup.
+func Warmup(n int) DBOption {
+	return func(options *dbOptions) {
+		options.warmup = n
+	}
+}
+
+// BestEffortWarmup reports the connections Warmup couldn't establish as WarnWarmupFailed warnings
+// instead of failing the acquisition.
+func BestEffortWarmup() DBOption {
+	return func(options *dbOptions) {
+		options.bestEffort = true
+	}
+}
+
+func (options *dbOptions) warmUp(db *sql.DB, description string) error {
+	if options.warmup <= 0 {
+		return nil
+	}
+	err := warmUp(db, options.warmup)
+	if err != nil && options.bestEffort {
+		warnErr(WarnWarmupFailed, description, err)
+		return nil
+	}
+	return err
+}
+
+// warmUp holds n connections at once, so that they're n different ones.
+func warmUp(db *sql.DB, n int) error {
+	if n > 2 { // the default of database/sql, which would close the others
+		db.SetMaxIdleConns(n)
+	}
+	ctx := context.Background()
+	var mu sync.Mutex
+	var errs []error
+	var acquired sync.WaitGroup
+	acquired.Add(n)
+	g := group.NewBoundedSpawner(n)
+	for range n {
+		g.Run(func() {
+			conn, err := db.Conn(ctx)
+			if err == nil {
+				_, err = conn.ExecContext(ctx, "SELECT 1")
+			}
+			acquired.Done()
+			acquired.Wait()
+			if conn != nil {
+				err = errors.Join(err, conn.Close())
+			}
+			if err != nil {
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+			}
+		})
+	}
+	g.Wait()
+	return errors.Join(errs...)
+}
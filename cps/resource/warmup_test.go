@@ -0,0 +1,137 @@
+package resource_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/group"
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+	"github.com/mattn/go-sqlite3"
+)
+
+// capped is the driver "capped": sqlite3 failing to open more than one connection per database.
+var capped = &cappedDriver{opens: make(map[string]int)}
+
+func init() {
+	sql.Register("capped", capped)
+}
+
+type cappedDriver struct {
+	sqlite3.SQLiteDriver
+	mu    sync.Mutex
+	opens map[string]int
+}
+
+func (d *cappedDriver) Open(name string) (driver.Conn, error) {
+	d.mu.Lock()
+	d.opens[name]++
+	opens := d.opens[name]
+	d.mu.Unlock()
+	if opens > 1 {
+		return nil, errors.New("capped: too many connections")
+	}
+	return d.SQLiteDriver.Open(name)
+}
+
+func TestWarmupEstablishesConnections(t *testing.T) {
+	driver, name := countingSQLite(t)
+	err := resource.NewDBResource(name, filepath.Join(t.TempDir(), "test.db"), resource.Warmup(5)).Use(func(db *sql.DB) error {
+		counts := driver.Counts()
+		if counts.Opens != 5 || counts.Open() != 5 {
+			t.Errorf("counts before the callback = %+v, want 5 connections established and open", counts)
+		}
+		// the callback's first queries find them in the pool
+		g := group.NewSafeWaitGroup()
+		for range 5 {
+			g.Run(func() {
+				conn, err := db.Conn(context.Background())
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				defer conn.Close()
+				time.Sleep(5 * time.Millisecond) // holds it while the others take theirs
+			})
+		}
+		g.Wait()
+		if opens := driver.Counts().Opens; opens != 5 {
+			t.Errorf("%d connections established, want no more than the warm ones", opens)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWarmupFailure(t *testing.T) {
+	dir := t.TempDir()
+	err := resource.NewDBResource("capped", filepath.Join(dir, "strict.db"), resource.Warmup(3)).Use(func(*sql.DB) error {
+		t.Error("callback called after a failed warm-up")
+		return nil
+	})
+	if err == nil || phaseOf(t, err) != resource.PhaseAcquire {
+		t.Errorf("Use = %v, want the warm-up failure as an acquire error", err)
+	}
+
+	warnings := captureWarnings(t)
+	called := false
+	err = resource.NewDBResource("capped", filepath.Join(dir, "best-effort.db"), resource.Warmup(3), resource.BestEffortWarmup()).Use(func(db *sql.DB) error {
+		called = true
+		return db.Ping()
+	})
+	if err != nil || !called {
+		t.Errorf("best-effort Use = %v, called %v, want the callback run", err, called)
+	}
+	if !hasWarning(warnings(), resource.WarnWarmupFailed) {
+		t.Errorf("warnings = %v, want WarnWarmupFailed", warnings())
+	}
+}
+
+// BenchmarkFirstQueries times the first 4 concurrent queries of the callback, with and without warm-up.
+func BenchmarkFirstQueries(b *testing.B) {
+	for _, test := range []struct {
+		name string
+		opts []resource.DBOption
+	}{
+		{"cold", nil},
+		{"warm", []resource.DBOption{resource.Warmup(4)}},
+	} {
+		b.Run(test.name, func(b *testing.B) {
+			path := filepath.Join(b.TempDir(), "test.db")
+			for range b.N {
+				b.StopTimer()
+				err := resource.NewDBResource("sqlite3", path, test.opts...).Use(func(db *sql.DB) error {
+					b.StartTimer()
+					defer b.StopTimer()
+					g := group.NewSafeWaitGroup()
+					for range 4 {
+						g.Run(func() {
+							conn, err := db.Conn(context.Background())
+							if err != nil {
+								b.Error(err)
+								return
+							}
+							defer conn.Close()
+							_, err = conn.ExecContext(context.Background(), "SELECT 1")
+							if err != nil {
+								b.Error(err)
+							}
+						})
+					}
+					g.Wait()
+					return nil
+				})
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package resource
+
+import (
+	"sync/atomic"
+)
+
+// WarningKind tells what went wrong in a Warning.
+type WarningKind int
+
+const (
+	// WarnDoubleClose is reported when the callback closed the handle itself,
+	// so the resource's own close was skipped.
+	WarnDoubleClose WarningKind = iota
+	// WarnJournalFailed is reported when WithJournal or FallbackJournal couldn't write its record;
+	// the journaled Use isn't failed for it.
+	WarnJournalFailed
+	// WarnLockOrder is reported in debug mode when a lock is acquired in an order
+	// conflicting with an earlier acquisition; Err is a *LockOrderError.
+	WarnLockOrder
+	// WarnSwallowedError is reported when a secondary error is dropped, see StrictMode.
+	WarnSwallowedError
+	// WarnWarmupFailed is reported when the connections of BestEffortWarmup couldn't all be established.
+	WarnWarmupFailed
+	// WarnReleaseError is reported for a release error WithReleaseErrorPolicy downgraded to a warning.
+	WarnReleaseError
+	// WarnUncheckedError is reported in DebugUnchecked mode for the error of a Use nobody observed,
+	// from the goroutine running the finalizers; Err is an *UncheckedError.
+	WarnUncheckedError
+)
+
+func (kind WarningKind) String() string {
+	switch kind {
+	case WarnDoubleClose:
+		return "double close"
+	case WarnJournalFailed:
+		return "journal write failed"
+	case WarnLockOrder:
+		return "lock order cycle"
+	case WarnSwallowedError:
+		return "swallowed error"
+	case WarnWarmupFailed:
+		return "warmup failed"
+	case WarnReleaseError:
+		return "release error"
+	case WarnUncheckedError:
+		return "unchecked error"
+	default:
+		return "unknown warning"
+	}
+}
+
+// Warning is a misuse of a resource which the resource recovered from, so Use didn't fail.
+type Warning struct {
+	Kind WarningKind
+	// Resource describes the resource, like "file /tmp/data.txt".
+	Resource string
+	// Err is the error recovered from, if any.
+	Err error
+}
+
+var warningHandler atomic.Pointer[func(w Warning)]
+
+// SetWarningHandler makes the resources report warnings to handler, nil stops the reporting.
+// The handler is called by the goroutine running Use.
+func SetWarningHandler(handler func(w Warning)) {
+	if handler == nil {
+		warningHandler.Store(nil)
+		return
+	}
+	warningHandler.Store(&handler)
+}
+
+func warn(kind WarningKind, resource string) {
+	warnErr(kind, resource, nil)
+}
+
+// warnErr observes err for DebugUnchecked: reporting it is handling it.
+func warnErr(kind WarningKind, resource string, err error) {
+	Observed(err)
+	if handler := warningHandler.Load(); handler != nil {
+		(*handler)(Warning{Kind: kind, Resource: resource, Err: err})
+	}
+}
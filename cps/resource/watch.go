@@ -0,0 +1,79 @@
+package resource
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"time"
+)
+
+type watchOptions struct {
+	waitForCreate bool
+	clock         Clock
+}
+
+// WatchOption configures WatchFile.
+type WatchOption func(options *watchOptions)
+
+// WaitForCreate makes WatchFile wait for a missing file instead of failing with fs.ErrNotExist,
+// at start and when the file is removed; a removal is reported to onChange with a nil FileInfo.
+func WaitForCreate() WatchOption {
+	return func(options *watchOptions) {
+		options.waitForCreate = true
+	}
+}
+
+// WatchClock makes WatchFile tick with clock.
+func WatchClock(clock Clock) WatchOption {
+	return func(options *watchOptions) {
+		options.clock = clock
+	}
+}
+
+// WatchFile checks the modification time and size of path every interval
+// and calls onChange with the new FileInfo when one of them changed.
+// It returns the error of onChange or of os.Stat, or ctx.Err() when ctx is done.
+func WatchFile(ctx context.Context, path string, interval time.Duration, onChange func(info fs.FileInfo) error, opts ...WatchOption) error {
+	var options watchOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	stat := func() (fs.FileInfo, error) {
+		info, err := os.Stat(path)
+		if errors.Is(err, fs.ErrNotExist) && options.waitForCreate {
+			return nil, nil
+		}
+		return info, err
+	}
+	last, err := stat()
+	if err != nil {
+		return err
+	}
+
+	return WithTickerCtx(ctx, interval, func(ticks <-chan time.Time) error {
+		for range ticks {
+			info, err := stat()
+			if err != nil {
+				return err
+			}
+			if sameFileState(last, info) {
+				continue
+			}
+			last = info
+			err = onChange(info)
+			if err != nil {
+				return err
+			}
+		}
+		return ctx.Err()
+	}, TimerClock(options.clock))
+}
+
+func sameFileState(a, b fs.FileInfo) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.ModTime().Equal(b.ModTime()) && a.Size() == b.Size()
+}
@@ -0,0 +1,150 @@
+package resource_test
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+const watchInterval = 2 * time.Millisecond
+
+// watch runs WatchFile in a goroutine, sending the changes it reports to the returned channel
+// and its error to done after cancel is called or onChange fails.
+func watch(t *testing.T, path string, onChange func(info fs.FileInfo) error, opts ...resource.WatchOption) (changes <-chan fs.FileInfo, done <-chan error, cancel func()) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	changed, finished := make(chan fs.FileInfo, 100), make(chan error, 1)
+	go func() {
+		finished <- resource.WatchFile(ctx, path, watchInterval, func(info fs.FileInfo) error {
+			changed <- info
+			if onChange != nil {
+				return onChange(info)
+			}
+			return nil
+		}, opts...)
+	}()
+	t.Cleanup(func() {
+		cancel()
+	})
+	return changed, finished, cancel
+}
+
+// changeUntilSeen appends to path until the watcher reports the last write, as the first write
+// may happen before WatchFile read the initial state.
+func changeUntilSeen(t *testing.T, path string, changes <-chan fs.FileInfo) fs.FileInfo {
+	t.Helper()
+	deadline := time.After(time.Second)
+	for content := "x"; ; content += "x" {
+		writeFile(t, path, content)
+		retry := time.After(5 * watchInterval)
+		for waiting := true; waiting; {
+			select {
+			case info := <-changes:
+				if info != nil && info.Size() == int64(len(content)) {
+					return info
+				}
+			case <-retry:
+				waiting = false
+			case <-deadline:
+				t.Fatal("no change reported after a second")
+			}
+		}
+	}
+}
+
+func TestWatchFileReportsChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "watched.txt")
+	writeFile(t, path, "")
+	changes, done, cancel := watch(t, path, nil)
+
+	info := changeUntilSeen(t, path, changes)
+	if info == nil || info.Size() == 0 || info.Name() != "watched.txt" {
+		t.Errorf("change reported %v, want the new state", info)
+	}
+	select {
+	case info := <-changes:
+		t.Errorf("change %v reported without a change", info)
+	case <-time.After(10 * watchInterval):
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("WatchFile = %v, want context.Canceled", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("WatchFile still running a second after the cancel")
+	}
+}
+
+func TestWatchFileOnChangeError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "watched.txt")
+	writeFile(t, path, "")
+	errChange := errors.New("change")
+	_, done, _ := watch(t, path, func(fs.FileInfo) error { return errChange })
+	deadline := time.After(time.Second)
+	for content := "x"; ; content += "x" {
+		writeFile(t, path, content)
+		select {
+		case err := <-done:
+			if !errors.Is(err, errChange) {
+				t.Errorf("WatchFile = %v, want the error of onChange", err)
+			}
+			return
+		case <-time.After(5 * watchInterval):
+		case <-deadline:
+			t.Fatal("WatchFile still running a second after the changes")
+		}
+	}
+}
+
+func TestWatchFileMissing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "watched.txt")
+	err := resource.WatchFile(context.Background(), path, watchInterval, func(fs.FileInfo) error {
+		t.Error("onChange called for a missing file")
+		return nil
+	})
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("WatchFile = %v, want fs.ErrNotExist", err)
+	}
+
+	writeFile(t, path, "")
+	changes, done, _ := watch(t, path, nil)
+	changeUntilSeen(t, path, changes)
+	os.Remove(path)
+	if err := <-done; !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("WatchFile of a removed file = %v, want fs.ErrNotExist", err)
+	}
+}
+
+func TestWatchFileWaitForCreate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "watched.txt")
+	changes, done, cancel := watch(t, path, nil, resource.WaitForCreate())
+
+	if info := changeUntilSeen(t, path, changes); info == nil {
+		t.Fatal("creation reported as a removal")
+	}
+	err := os.Remove(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info := <-changes; info != nil {
+		t.Errorf("removal reported as %v, want a nil FileInfo", info)
+	}
+	writeFile(t, path, "again")
+	if info := <-changes; info == nil || info.Size() != int64(len("again")) {
+		t.Errorf("recreation reported as %v", info)
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("WatchFile = %v, want context.Canceled", err)
+	}
+}
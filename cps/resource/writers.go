@@ -0,0 +1,69 @@
+package resource
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"io"
+)
+
+// NewBufferedWriteResource buffers the writes to w's writer, the buffer is flushed before w is released.
+func NewBufferedWriteResource(w Resource[io.Writer], size int) Resource[*bufio.Writer] {
+	return Map(w, func(w io.Writer) (*bufio.Writer, func() error, error) {
+		bw := bufio.NewWriterSize(w, size)
+		return bw, bw.Flush, nil
+	})
+}
+
+// NewGzipWriteResource compresses the writes to w's writer, the gzip stream is closed before w is released.
+func NewGzipWriteResource(w Resource[io.Writer], level int) Resource[*gzip.Writer] {
+	return Map(w, func(w io.Writer) (*gzip.Writer, func() error, error) {
+		zw, err := gzip.NewWriterLevel(w, level)
+		if err != nil {
+			return nil, nil, err
+		}
+		return zw, zw.Close, nil
+	})
+}
+
+// TeeWriters gives the callback one writer writing to the writers of all of rs,
+// like io.MultiWriter. The writers are acquired in order and released in reverse order;
+// when one fails to acquire, the ones already acquired are released.
+//
+// A failed write fails every later write too, and is returned even when the callback ignores it.
+// The sinks before the failing one may have got the data, the ones after it haven't.
+func TeeWriters(rs ...Resource[io.Writer]) Resource[io.Writer] {
+	return Resource[io.Writer]{
+		Use: func(callback func(w io.Writer) error) error {
+			return useTee(rs, nil, callback)
+		},
+	}
+}
+
+func useTee(rs []Resource[io.Writer], acquired []io.Writer, callback func(w io.Writer) error) error {
+	if len(rs) > 0 {
+		return rs[0].Use(func(w io.Writer) error {
+			return useTee(rs[1:], append(acquired, w), callback)
+		})
+	}
+	tee := &teeWriter{w: io.MultiWriter(acquired...)}
+	err := callback(tee)
+	if tee.err != nil && !errors.Is(err, tee.err) {
+		err = errors.Join(err, tee.err)
+	}
+	return err
+}
+
+type teeWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (t *teeWriter) Write(p []byte) (int, error) {
+	if t.err != nil {
+		return 0, t.err
+	}
+	n, err := t.w.Write(p)
+	t.err = err
+	return n, err
+}
@@ -0,0 +1,103 @@
+package resource_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"slices"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+// sink is a writer resource recording its lifecycle in events, failing the write failWrite
+// (counting from 1) or the acquisition when failAcquire.
+type sink struct {
+	name        string
+	events      *[]string
+	failWrite   int
+	failAcquire bool
+	content     bytes.Buffer
+	writes      int
+}
+
+var errSink = errors.New("sink failed")
+
+func (s *sink) Write(p []byte) (int, error) {
+	s.writes++
+	if s.writes == s.failWrite {
+		return 0, errSink
+	}
+	return s.content.Write(p)
+}
+
+func (s *sink) resource() resource.Resource[io.Writer] {
+	return resource.Resource[io.Writer]{
+		Use: func(callback func(w io.Writer) error) error {
+			if s.failAcquire {
+				*s.events = append(*s.events, "acquire "+s.name+" failed")
+				return errSink
+			}
+			*s.events = append(*s.events, "acquire "+s.name)
+			err := callback(s)
+			*s.events = append(*s.events, "release "+s.name)
+			return err
+		},
+	}
+}
+
+func TestTeeWriters(t *testing.T) {
+	var events []string
+	a, b, c := &sink{name: "a", events: &events}, &sink{name: "b", events: &events}, &sink{name: "c", events: &events}
+	err := resource.TeeWriters(a.resource(), b.resource(), c.resource()).Use(func(w io.Writer) error {
+		_, err := io.WriteString(w, "hello")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []*sink{a, b, c} {
+		if s.content.String() != "hello" {
+			t.Errorf("sink %s got %q", s.name, s.content.String())
+		}
+	}
+	if want := []string{"acquire a", "acquire b", "acquire c", "release c", "release b", "release a"}; !slices.Equal(events, want) {
+		t.Errorf("events = %q, want %q", events, want)
+	}
+}
+
+func TestTeeWritersMiddleSinkFails(t *testing.T) {
+	var events []string
+	a, b, c := &sink{name: "a", events: &events}, &sink{name: "b", events: &events, failWrite: 2}, &sink{name: "c", events: &events}
+	err := resource.TeeWriters(a.resource(), b.resource(), c.resource()).Use(func(w io.Writer) error {
+		io.WriteString(w, "one ")
+		io.WriteString(w, "two ") // fails in b, errors ignored
+		io.WriteString(w, "three")
+		return nil
+	})
+	if !errors.Is(err, errSink) {
+		t.Errorf("Use = %v, want the write error even though the callback ignored it", err)
+	}
+	if want := []string{"acquire a", "acquire b", "acquire c", "release c", "release b", "release a"}; !slices.Equal(events, want) {
+		t.Errorf("events = %q, want every sink released, in reverse order", events)
+	}
+	// a got the failed write, c didn't, and nothing was written after the failure
+	if a.content.String() != "one two " || b.content.String() != "one " || c.content.String() != "one " {
+		t.Errorf("sinks got %q, %q and %q", a.content.String(), b.content.String(), c.content.String())
+	}
+}
+
+func TestTeeWritersAcquireFails(t *testing.T) {
+	var events []string
+	a, b, c := &sink{name: "a", events: &events}, &sink{name: "b", events: &events, failAcquire: true}, &sink{name: "c", events: &events}
+	err := resource.TeeWriters(a.resource(), b.resource(), c.resource()).Use(func(io.Writer) error {
+		t.Error("callback called without all the sinks")
+		return nil
+	})
+	if !errors.Is(err, errSink) {
+		t.Errorf("Use = %v, want the acquire error", err)
+	}
+	if want := []string{"acquire a", "acquire b failed", "release a"}; !slices.Equal(events, want) {
+		t.Errorf("events = %q, want %q", events, want)
+	}
+}
@@ -0,0 +1,65 @@
+package resource
+
+import (
+	"archive/zip"
+	"errors"
+	"io"
+	"os"
+)
+
+// ErrZipEntryActive is returned by ZipWriter.Entry used inside another entry callback.
+var ErrZipEntryActive = errors.New("zip: previous entry is still being written")
+
+// ZipWriter is a zip.Writer which can also create entries in CPS style.
+type ZipWriter struct {
+	*zip.Writer
+	entryActive bool
+}
+
+// Entry creates a new file in the archive, the callback writes its content.
+// Entries can't be nested: zip.Writer finishes an entry when the next one is created.
+func (zw *ZipWriter) Entry(name string) Resource[io.Writer] {
+	return Resource[io.Writer]{
+		Use: func(callback func(w io.Writer) error) error {
+			if zw.entryActive {
+				return phaseError(PhaseAcquire, ErrZipEntryActive)
+			}
+			w, err := zw.Create(name)
+			if err != nil {
+				return phaseError(PhaseAcquire, err)
+			}
+
+			zw.entryActive = true
+			defer func() {
+				zw.entryActive = false
+			}()
+
+			err = useCallback(callback, w)
+			if err != nil {
+				return phaseError(PhaseUse, err)
+			}
+			return phaseError(PhaseRelease, zw.Flush())
+		},
+	}
+}
+
+// NewZipFileResource gives the callback a zip writer for a new archive at path.
+//
+// Three lifetimes are nested here: every entry is finished before the next one starts,
+// the zip.Writer is closed before the file, and the file is written atomically,
+// so a failed callback leaves no partial archive behind.
+func NewZipFileResource(path string, perm os.FileMode) Resource[*ZipWriter] {
+	file := NewAtomicFileResource(path, perm)
+	return Resource[*ZipWriter]{
+		Use: func(callback func(zw *ZipWriter) error) error {
+			return file.Use(func(fd *os.File) error {
+				zw := &ZipWriter{Writer: zip.NewWriter(fd)}
+				err := useCallback(callback, zw)
+				if err != nil {
+					return err
+				}
+				return phaseError(PhaseRelease, zw.Close())
+			})
+		},
+	}
+}
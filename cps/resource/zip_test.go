@@ -0,0 +1,89 @@
+package resource_test
+
+import (
+	"archive/zip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+func writeEntry(zw *resource.ZipWriter, name, content string) error {
+	return zw.Entry(name).Use(func(w io.Writer) error {
+		_, err := io.WriteString(w, content)
+		return err
+	})
+}
+
+func TestZipFileResource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "archive.zip")
+	err := resource.NewZipFileResource(path, 0o644).Use(func(zw *resource.ZipWriter) error {
+		err := writeEntry(zw, "a.txt", "first")
+		if err != nil {
+			return err
+		}
+		return writeEntry(zw, "dir/b.txt", "second")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	want := map[string]string{"a.txt": "first", "dir/b.txt": "second"}
+	if len(r.File) != len(want) {
+		t.Fatalf("%d entries, want %d", len(r.File), len(want))
+	}
+	for _, f := range r.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil || string(content) != want[f.Name] {
+			t.Errorf("%s = %q, %v, want %q", f.Name, content, err, want[f.Name])
+		}
+	}
+}
+
+func TestZipFileResourceRemovesFailedArchive(t *testing.T) {
+	errBoom := errors.New("boom")
+	dir := t.TempDir()
+	path := filepath.Join(dir, "archive.zip")
+	err := resource.NewZipFileResource(path, 0o644).Use(func(zw *resource.ZipWriter) error {
+		err := writeEntry(zw, "a.txt", "first")
+		if err != nil {
+			return err
+		}
+		return zw.Entry("b.txt").Use(func(w io.Writer) error {
+			io.WriteString(w, "half")
+			return errBoom
+		})
+	})
+	if !errors.Is(err, errBoom) || phaseOf(t, err) != resource.PhaseUse {
+		t.Errorf("Use = %v", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 0 {
+		t.Errorf("%d files left by a failed archive, %v", len(entries), err)
+	}
+}
+
+func TestZipEntriesCantNest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "archive.zip")
+	err := resource.NewZipFileResource(path, 0o644).Use(func(zw *resource.ZipWriter) error {
+		return zw.Entry("outer").Use(func(w io.Writer) error {
+			return writeEntry(zw, "inner", "nested")
+		})
+	})
+	if !errors.Is(err, resource.ErrZipEntryActive) {
+		t.Errorf("nested Entry = %v, want %v", err, resource.ErrZipEntryActive)
+	}
+}
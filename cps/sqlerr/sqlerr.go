@@ -0,0 +1,79 @@
+// Package sqlerr classifies the errors of database drivers without matching their messages.
+//
+// The errors of github.com/mattn/go-sqlite3 are classified by their codes: with the sqlite3 build tag
+// (go build -tags sqlite3) through the types of the driver, and without it by reflection,
+// so this package doesn't depend on a driver otherwise; Register the classifiers of other drivers.
+package sqlerr
+
+import (
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"sync"
+)
+
+// Classifier tells the classes of the errors of a driver; a nil func classifies nothing.
+// The funcs get the error as returned, wrapped or joined: use errors.As to find the typed driver error.
+type Classifier struct {
+	// Unique is a unique or primary key constraint violation.
+	Unique func(err error) bool
+	// Busy is a locked database or table, worth retrying.
+	Busy func(err error) bool
+	// ForeignKey is a foreign key constraint violation.
+	ForeignKey func(err error) bool
+	// Connection is a lost connection to the database, see IsConnectionError.
+	Connection func(err error) bool
+}
+
+var classifiers struct {
+	sync.RWMutex
+	list []Classifier
+}
+
+// Register adds the classifier of a driver; an error is of a class when any classifier says it is.
+func Register(c Classifier) {
+	classifiers.Lock()
+	defer classifiers.Unlock()
+	classifiers.list = append(classifiers.list, c)
+}
+
+func classify(err error, class func(c Classifier) func(err error) bool) bool {
+	if err == nil {
+		return false
+	}
+	classifiers.RLock()
+	defer classifiers.RUnlock()
+	for _, c := range classifiers.list {
+		if is := class(c); is != nil && is(err) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsUniqueViolation tells whether err is a unique or primary key constraint violation.
+func IsUniqueViolation(err error) bool {
+	return classify(err, func(c Classifier) func(err error) bool { return c.Unique })
+}
+
+// IsBusy tells whether err is a locked database or table, which a retry may get past.
+func IsBusy(err error) bool {
+	return classify(err, func(c Classifier) func(err error) bool { return c.Busy })
+}
+
+// IsForeignKeyViolation tells whether err is a foreign key constraint violation.
+func IsForeignKeyViolation(err error) bool {
+	return classify(err, func(c Classifier) func(err error) bool { return c.ForeignKey })
+}
+
+// IsConnectionError tells whether err is a lost connection to the database, after which
+// the server side of a transaction can't be told: driver.ErrBadConn, an unexpected EOF or a network error,
+// whatever the driver, and what the registered classifiers say.
+func IsConnectionError(err error) bool {
+	var netErr net.Error
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, io.ErrUnexpectedEOF) || errors.As(err, &netErr) {
+		return true
+	}
+	return classify(err, func(c Classifier) func(err error) bool { return c.Connection })
+}
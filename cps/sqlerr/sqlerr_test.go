@@ -0,0 +1,117 @@
+package sqlerr_test
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/Q69K/using-cps-in-golang/cps/sqlerr"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// The tests run with and without the sqlite3 build tag: go test -tags sqlite3 ./cps/sqlerr
+
+func openDB(t *testing.T, path string) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", path+"?_busy_timeout=0&_foreign_keys=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+	})
+	return db
+}
+
+func TestIsBusy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db := openDB(t, path)
+	_, err := db.Exec("CREATE TABLE items (id INTEGER PRIMARY KEY)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	locker, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer locker.Rollback()
+	_, err = locker.Exec("INSERT INTO items (id) VALUES (1)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = openDB(t, path).Exec("INSERT INTO items (id) VALUES (2)")
+	if err == nil {
+		t.Fatal("insert in a locked database succeeded")
+	}
+	if !sqlerr.IsBusy(err) || !sqlerr.IsBusy(fmt.Errorf("insert: %w", err)) || !sqlerr.IsBusy(errors.Join(errors.New("a"), err)) {
+		t.Errorf("IsBusy(%v) = false", err)
+	}
+	if sqlerr.IsUniqueViolation(err) {
+		t.Errorf("IsUniqueViolation(%v) = true", err)
+	}
+}
+
+func TestIsUniqueAndForeignKeyViolation(t *testing.T) {
+	db := openDB(t, filepath.Join(t.TempDir(), "test.db"))
+	_, err := db.Exec(`
+		CREATE TABLE parents (id INTEGER PRIMARY KEY, name TEXT UNIQUE);
+		CREATE TABLE children (id INTEGER PRIMARY KEY, parent INTEGER REFERENCES parents (id));
+		INSERT INTO parents (id, name) VALUES (1, 'a');
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, query := range []string{
+		"INSERT INTO parents (id, name) VALUES (1, 'b')",
+		"INSERT INTO parents (id, name) VALUES (2, 'a')",
+	} {
+		_, err = db.Exec(query)
+		if !sqlerr.IsUniqueViolation(err) || sqlerr.IsBusy(err) || sqlerr.IsForeignKeyViolation(err) {
+			t.Errorf("%s: %v not classified as a unique violation only", query, err)
+		}
+	}
+
+	_, err = db.Exec("INSERT INTO children (id, parent) VALUES (1, 2)")
+	if !sqlerr.IsForeignKeyViolation(err) || sqlerr.IsUniqueViolation(err) {
+		t.Errorf("%v not classified as a foreign key violation only", err)
+	}
+}
+
+func TestNotClassified(t *testing.T) {
+	for _, err := range []error{nil, errors.New("database is locked")} {
+		if sqlerr.IsBusy(err) || sqlerr.IsUniqueViolation(err) || sqlerr.IsForeignKeyViolation(err) {
+			t.Errorf("%v classified", err)
+		}
+	}
+}
+
+func TestIsConnectionError(t *testing.T) {
+	errReset := errors.New("server closed the connection")
+	sqlerr.Register(sqlerr.Classifier{Connection: func(err error) bool {
+		return errors.Is(err, errReset)
+	}})
+	for err, want := range map[error]bool{
+		driver.ErrBadConn: true,
+		fmt.Errorf("commit: %w", driver.ErrBadConn): true,
+		io.ErrUnexpectedEOF:                         true,
+		&net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}: true,
+		errors.Join(errors.New("rollback"), errReset):                                     true,
+		io.EOF:                     false,
+		sql.ErrTxDone:              false,
+		errors.New("syntax error"): false,
+	} {
+		if got := sqlerr.IsConnectionError(err); got != want {
+			t.Errorf("IsConnectionError(%v) = %v, want %v", err, got, want)
+		}
+	}
+	if sqlerr.IsConnectionError(nil) {
+		t.Error("IsConnectionError(nil) = true")
+	}
+}
@@ -0,0 +1,60 @@
+//go:build !sqlite3
+
+package sqlerr
+
+import "reflect"
+
+// Without the sqlite3 build tag, the errors of github.com/mattn/go-sqlite3 are still told
+// by their codes, read from the fields of sqlite3.Error by reflection instead of importing the driver.
+func init() {
+	Register(Classifier{
+		Unique: func(err error) bool {
+			code, ok := sqliteCode(err, "ExtendedCode")
+			return ok && (code == sqliteConstraintUnique || code == sqliteConstraintPrimaryKey)
+		},
+		Busy: func(err error) bool {
+			code, ok := sqliteCode(err, "Code")
+			return ok && (code == sqliteBusy || code == sqliteLocked)
+		},
+		ForeignKey: func(err error) bool {
+			code, ok := sqliteCode(err, "ExtendedCode")
+			return ok && code == sqliteConstraintForeignKey
+		},
+	})
+}
+
+// the result codes of sqlite, https://www.sqlite.org/rescode.html
+const (
+	sqliteBusy                 = 5
+	sqliteLocked               = 6
+	sqliteConstraintForeignKey = 787
+	sqliteConstraintPrimaryKey = 1555
+	sqliteConstraintUnique     = 2067
+)
+
+const sqlitePkgPath = "github.com/mattn/go-sqlite3"
+
+// sqliteCode finds the first sqlite3.Error in the tree of err, as errors.As would, and returns its field.
+func sqliteCode(err error, field string) (int64, bool) {
+	if err == nil {
+		return 0, false
+	}
+	v := reflect.ValueOf(err)
+	if t := v.Type(); t.PkgPath() == sqlitePkgPath && t.Name() == "Error" && t.Kind() == reflect.Struct {
+		f := v.FieldByName(field)
+		if f.IsValid() && f.CanInt() {
+			return f.Int(), true
+		}
+	}
+	switch wrapped := err.(type) {
+	case interface{ Unwrap() error }:
+		return sqliteCode(wrapped.Unwrap(), field)
+	case interface{ Unwrap() []error }:
+		for _, err := range wrapped.Unwrap() {
+			if code, ok := sqliteCode(err, field); ok {
+				return code, true
+			}
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,81 @@
+package examples
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+// printTracer prints the spans it ends.
+type printTracer struct {
+	out io.Writer
+}
+
+func (t printTracer) StartSpan(name string) func(err error) {
+	return func(err error) {
+		if err != nil {
+			fmt.Fprintf(t.out, "span %s failed: %v\n", name, err)
+			return
+		}
+		fmt.Fprintf(t.out, "span %s\n", name)
+	}
+}
+
+// StackedDecorators opens an in-memory sqlite database through four decorators, from the inside out:
+// WithFaults failing the first acquisitions like a flaky network would, WithContext giving up
+// once timeout is over, Traced printing the spans, and WithRetry retrying the failed acquisitions.
+// The callback runs once, after the retries.
+//
+// With a timeout long enough it prints:
+//
+//	fault injected at acquire
+//	span resource.db failed: acquire: injected fault
+//	fault injected at acquire
+//	span resource.db failed: acquire: injected fault
+//	span resource.db.use
+//	span resource.db
+//	1 callback after 3 attempts: sqlite 3
+func StackedDecorators(timeout time.Duration, out io.Writer) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	attempts := 0
+	faulty := resource.WithFaults(resource.FromUsable(resource.NewDBResource("sqlite3", ":memory:")), resource.FaultConfig{
+		Seed:           1,
+		AcquireFailure: 0.5,
+		OnFault: func(f resource.Fault) {
+			fmt.Fprintf(out, "fault injected at %s\n", f.Phase)
+		},
+	})
+	counted := resource.Resource[*sql.DB]{
+		Use: func(callback func(db *sql.DB) error) error {
+			attempts++
+			return faulty.Use(callback)
+		},
+	}
+	timed := resource.WithContext(ctx, counted)
+	traced := resource.Traced(timed, printTracer{out}, "db")
+	db := resource.WithRetry(ctx, traced, resource.RetryPolicy{
+		Attempts: 5,
+		Classify: func(err error) bool {
+			return errors.Is(err, resource.ErrInjectedFault)
+		},
+	})
+
+	callbacks := 0
+	var version string
+	err := db.Use(func(db *sql.DB) error {
+		callbacks++
+		return db.QueryRow("SELECT sqlite_version()").Scan(&version)
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "%d callback after %d attempts: sqlite %.1s\n", callbacks, attempts, version)
+	return nil
+}
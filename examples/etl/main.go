@@ -0,0 +1,83 @@
+// Command etl exports the items table of a sqlite database to a CSV file named after its checksum,
+// seeding the table first when -seed is set. SIGINT or SIGTERM stop the export between two batches,
+// leaving no partial file. With -check it also runs the other flows of package examples.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+	"github.com/Q69K/using-cps-in-golang/examples"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func main() {
+	if err := mainErr(os.Args[1:]); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(1)
+	}
+}
+
+func mainErr(args []string) error {
+	flags := flag.NewFlagSet("etl", flag.ContinueOnError)
+	dbPath := flags.String("db", "etl.sqlite", "sqlite database path")
+	outDir := flags.String("out", ".", "directory of the CSV file")
+	seed := flags.Int("seed", 0, "items to create in the database before exporting")
+	batchSize := flags.Int("batch", 100, "rows fetched per batch")
+	workers := flags.Int("workers", 4, "goroutines transforming a batch")
+	check := flags.Bool("check", false, "also run the other flows of package examples")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	err = resource.WithSignalContext(os.Interrupt, syscall.SIGTERM).Use(func(ctx context.Context) error {
+		return resource.NewDBResource("sqlite3", *dbPath).Use(func(db *sql.DB) error {
+			if *seed > 0 {
+				err := examples.SeedItems(db, *seed)
+				if err != nil {
+					return err
+				}
+			}
+			path, err := examples.ExportCSV(ctx, db, *outDir, *batchSize, *workers, os.Stdout)
+			if err != nil {
+				return err
+			}
+			fmt.Println(path)
+			return nil
+		})
+	})
+	if err != nil || !*check {
+		return err
+	}
+	return runFlows()
+}
+
+// runFlows runs the other flows, the offline one in a temporary directory.
+func runFlows() error {
+	err := examples.StackedDecorators(time.Minute, os.Stdout)
+	if err != nil {
+		return fmt.Errorf("stacked decorators: %w", err)
+	}
+	err = examples.ApplyEvents(examples.SampleEvents(), os.Stdout)
+	if err != nil {
+		return fmt.Errorf("apply events: %w", err)
+	}
+	return resource.NewTempDirResource("", "etl-*").Use(func(dir string) error {
+		err := examples.OfflineNotes(filepath.Clean(dir), os.Stdout)
+		if err != nil {
+			return fmt.Errorf("offline notes: %w", err)
+		}
+		return nil
+	})
+}
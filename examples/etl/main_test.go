@@ -0,0 +1,26 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMainErrExportsAndChecks(t *testing.T) {
+	dir := t.TempDir()
+	err := mainErr([]string{"-db", filepath.Join(dir, "etl.sqlite"), "-out", dir, "-seed", "10", "-batch", "4", "-workers", "3", "-check"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = os.Stat(filepath.Join(dir, "items-c88ab44c.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMainErrRejectsUnknownFlag(t *testing.T) {
+	err := mainErr([]string{"-unknown"})
+	if err == nil {
+		t.Fatal("got no error for an unknown flag")
+	}
+}
@@ -0,0 +1,110 @@
+package examples
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/group"
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+// Event changes the balance of an account.
+type Event struct {
+	Account string
+	Amount  int64
+}
+
+// ErrOverdrawn is the error of an event taking an account below zero.
+var ErrOverdrawn = errors.New("overdrawn")
+
+// SampleEvents are events of three accounts, one of them overdrawing bob's.
+func SampleEvents() []Event {
+	return []Event{
+		{"alice", 100}, {"bob", 50}, {"carol", 5}, {"alice", -20},
+		{"bob", -30}, {"bob", -50}, {"alice", -10}, {"bob", 0},
+	}
+}
+
+// ApplyEvents applies the events to the accounts table of an in-memory sqlite database:
+// the events of an account one after the other, in their order, with a group.KeyedSpawner,
+// and the accounts in parallel. The balance updates are committed in batches of up to 8
+// by a resource.MicroBatcher, every event waiting for its batch to commit.
+// An event taking its account below zero is rejected, the next events of the account still apply.
+//
+// For SampleEvents it prints:
+//
+//	bob: rejected -50: overdrawn
+//	alice: 70
+//	bob: 20
+//	carol: 5
+func ApplyEvents(events []Event, out io.Writer) error {
+	return resource.NewDBResource("sqlite3", "file:events?mode=memory&cache=shared").Use(func(db *sql.DB) error {
+		_, err := db.Exec("CREATE TABLE accounts (name TEXT PRIMARY KEY, balance INTEGER NOT NULL)")
+		if err != nil {
+			return err
+		}
+
+		batcher := resource.NewMicroBatcher(db, 8, 10*time.Millisecond, func(tx *sql.Tx, items []any) error {
+			for _, item := range items {
+				event := item.(Event)
+				_, err := tx.Exec(`INSERT INTO accounts (name, balance) VALUES (?, ?)
+					ON CONFLICT (name) DO UPDATE SET balance = balance + excluded.balance`, event.Account, event.Amount)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+
+		// the events of an account run one at a time, so checking and updating its balance is one step
+		var mu sync.Mutex
+		balances := make(map[string]int64)
+		errs := make([]error, len(events))
+		spawner := group.NewKeyedSpawner(4)
+		for i, event := range events {
+			spawner.RunKeyed(event.Account, func() {
+				mu.Lock()
+				balance := balances[event.Account]
+				mu.Unlock()
+				if balance+event.Amount < 0 {
+					errs[i] = ErrOverdrawn
+					return
+				}
+				errs[i] = batcher.Submit(context.Background(), event)
+				if errs[i] == nil {
+					mu.Lock()
+					balances[event.Account] += event.Amount
+					mu.Unlock()
+				}
+			})
+		}
+		spawner.Wait()
+		err = batcher.Close(context.Background())
+		if err != nil {
+			return err
+		}
+
+		for i, err := range errs {
+			if errors.Is(err, ErrOverdrawn) {
+				fmt.Fprintf(out, "%s: rejected %d: %v\n", events[i].Account, events[i].Amount, err)
+			} else if err != nil {
+				return err
+			}
+		}
+		return resource.ForEachRow(db, "SELECT name, balance FROM accounts ORDER BY name", nil,
+			func(scan func(dest ...any) error) (Event, error) {
+				var account Event
+				err := scan(&account.Account, &account.Amount)
+				return account, err
+			},
+			func(account Event) error {
+				_, err := fmt.Fprintf(out, "%s: %d\n", account.Account, account.Amount)
+				return err
+			})
+	})
+}
@@ -0,0 +1,91 @@
+package examples_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+	"github.com/Q69K/using-cps-in-golang/examples"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func ExampleExportCSV() {
+	err := resource.NewTempDirResource("", "export-*").Use(func(dir string) error {
+		return resource.NewDBResource("sqlite3", filepath.Join(dir, "items.db")).Use(func(db *sql.DB) error {
+			err := examples.SeedItems(db, 10)
+			if err != nil {
+				return err
+			}
+			path, err := examples.ExportCSV(context.Background(), db, dir, 4, 3, os.Stdout)
+			if err != nil {
+				return err
+			}
+			data, err := os.ReadFile(path)
+			fmt.Print(string(data))
+			return err
+		})
+	})
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// batch of 4 items
+	// batch of 4 items
+	// batch of 2 items
+	// exported 10 items to items-c88ab44c.csv
+	// id,name,slug
+	// 1,item 1,item-1
+	// 2,item 2,item-2
+	// 3,item 3,item-3
+	// 4,item 4,item-4
+	// 5,item 5,item-5
+	// 6,item 6,item-6
+	// 7,item 7,item-7
+	// 8,item 8,item-8
+	// 9,item 9,item-9
+	// 10,item 10,item-10
+}
+
+func ExampleStackedDecorators() {
+	err := examples.StackedDecorators(time.Minute, os.Stdout)
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// fault injected at acquire
+	// span resource.db failed: acquire: injected fault
+	// fault injected at acquire
+	// span resource.db failed: acquire: injected fault
+	// span resource.db.use
+	// span resource.db
+	// 1 callback after 3 attempts: sqlite 3
+}
+
+func ExampleApplyEvents() {
+	err := examples.ApplyEvents(examples.SampleEvents(), os.Stdout)
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// bob: rejected -50: overdrawn
+	// alice: 70
+	// bob: 20
+	// carol: 5
+}
+
+func ExampleOfflineNotes() {
+	err := resource.NewTempDirResource("", "notes-*").Use(func(dir string) error {
+		return examples.OfflineNotes(dir, os.Stdout)
+	})
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// primary unreachable, writing to the fallback
+	// wrote 3 notes offline
+	// replayed 3 writes: first note, second note, third note
+}
@@ -0,0 +1,123 @@
+// Package examples composes the pieces of cps/resource and cps/group into complete flows,
+// using their exported API only. Every flow writes what it did to out, deterministically,
+// and examples/etl runs the first one as a command.
+package examples
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Q69K/using-cps-in-golang/cps/group"
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+// Item is a row of the items table of SeedItems.
+type Item struct {
+	ID   int64
+	Name string
+}
+
+// SeedItems creates the items table in db, if needed, with n items.
+func SeedItems(db *sql.DB, n int) error {
+	return resource.RunTransaction(db).Use(func(tx *sql.Tx) error {
+		_, err := tx.Exec("CREATE TABLE IF NOT EXISTS items (id INTEGER PRIMARY KEY, name TEXT NOT NULL)")
+		if err != nil {
+			return err
+		}
+		for i := 1; i <= n; i++ {
+			_, err = tx.Exec("INSERT OR IGNORE INTO items (id, name) VALUES (?, ?)", i, "item "+strconv.Itoa(i))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func decodeItem(scan func(dest ...any) error) (Item, error) {
+	var item Item
+	err := scan(&item.ID, &item.Name)
+	return item, err
+}
+
+// ExportCSV fetches the items of db in batches of batchSize, transforms every batch with workers
+// goroutines, and writes the results to a CSV file of dir named after its SHA-256, atomically:
+// the file only appears once complete. Cancelling ctx stops the export between two batches
+// and leaves no file. It returns the path of the file.
+//
+// For the 10 items of SeedItems, in batches of 4 with 3 workers, it prints:
+//
+//	batch of 4 items
+//	batch of 4 items
+//	batch of 2 items
+//	exported 10 items to items-c88ab44c.csv
+func ExportCSV(ctx context.Context, db *sql.DB, dir string, batchSize, workers int, out io.Writer) (string, error) {
+	var path string
+	err := resource.TempThenPromote(func(f *os.File) (string, error) {
+		digest := sha256.New()
+		w := csv.NewWriter(io.MultiWriter(f, digest))
+		exported, err := exportBatches(ctx, db, w, batchSize, workers, out)
+		if err != nil {
+			return "", err
+		}
+		w.Flush()
+		err = w.Error()
+		if err != nil {
+			return "", err
+		}
+		path = filepath.Join(dir, "items-"+shortSum(digest)+".csv")
+		fmt.Fprintf(out, "exported %d items to %s\n", exported, filepath.Base(path))
+		return path, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+func exportBatches(ctx context.Context, db *sql.DB, w *csv.Writer, batchSize, workers int, out io.Writer) (int, error) {
+	exported := 0
+	err := w.Write([]string{"id", "name", "slug"})
+	if err != nil {
+		return 0, err
+	}
+	err = resource.ForEachBatch(db, "SELECT id, name FROM items ORDER BY id", nil, batchSize, decodeItem, func(batch []Item) error {
+		err := ctx.Err()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "batch of %d items\n", len(batch))
+
+		// the workers fill their own index, the batch keeps its order
+		records := make([][]string, len(batch))
+		spawner := group.NewBoundedSpawner(workers)
+		for i, item := range batch {
+			spawner.Run(func() {
+				records[i] = []string{strconv.FormatInt(item.ID, 10), item.Name, slug(item.Name)}
+			})
+		}
+		spawner.Wait()
+
+		exported += len(records)
+		return w.WriteAll(records)
+	})
+	return exported, err
+}
+
+func slug(name string) string {
+	return strings.ReplaceAll(strings.ToLower(name), " ", "-")
+}
+
+func shortSum(digest hash.Hash) string {
+	return hex.EncodeToString(digest.Sum(nil))[:8]
+}
@@ -0,0 +1,81 @@
+package examples
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Q69K/using-cps-in-golang/cps/resource"
+)
+
+var notesMigrations = []resource.Migration{
+	{Version: 1, Name: "notes", Up: "CREATE TABLE notes (id INTEGER PRIMARY KEY, text TEXT NOT NULL)"},
+}
+
+// OfflineNotes writes notes while the primary database of dir can't be opened: they go to an in-memory
+// fallback seeded with the migrations, and every committed write is journaled. Once the primary database
+// exists, the journal is replayed into it, migrated too, and removed.
+//
+// It prints:
+//
+//	primary unreachable, writing to the fallback
+//	wrote 3 notes offline
+//	replayed 3 writes: first note, second note, third note
+func OfflineNotes(dir string, out io.Writer) error {
+	primaryPath := filepath.Join(dir, "notes.db")
+	journal := filepath.Join(dir, "offline.jsonl")
+	// mode=rw doesn't create the database, standing in for a server which is down
+	primary := resource.DBConfig{DriverName: "sqlite3", DatasourceName: "file:" + primaryPath + "?mode=rw"}
+	fallback := func() (string, string) {
+		return "sqlite3", "file:offline-notes?mode=memory&cache=shared"
+	}
+
+	notes := resource.NewDBResourceWithFallback(primary, fallback,
+		resource.FallbackMigrations(notesMigrations),
+		resource.FallbackJournal(journal),
+		resource.OnFallback(func(error) {
+			fmt.Fprintln(out, "primary unreachable, writing to the fallback")
+		}))
+	err := notes.Use(func(db *sql.DB) error {
+		return resource.RunTransaction(db).Use(func(tx *sql.Tx) error {
+			for _, text := range []string{"first note", "second note", "third note"} {
+				_, err := tx.Exec("INSERT INTO notes (text) VALUES (?)", text)
+				if err != nil {
+					return err
+				}
+			}
+			var count int
+			err := tx.QueryRow("SELECT COUNT(*) FROM notes").Scan(&count)
+			fmt.Fprintf(out, "wrote %d notes offline\n", count)
+			return err
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	// back online
+	return resource.NewDBResource("sqlite3", primaryPath).Use(func(db *sql.DB) error {
+		err := resource.Migrate(db, notesMigrations)
+		if err != nil {
+			return err
+		}
+		replayed, err := resource.ReplayFallbackJournal(db, journal)
+		if err != nil {
+			return err
+		}
+		texts, err := resource.QueryAll(db, "SELECT text FROM notes ORDER BY id", nil, func(scan func(dest ...any) error) (string, error) {
+			var text string
+			err := scan(&text)
+			return text, err
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "replayed %d writes: %s\n", replayed, strings.Join(texts, ", "))
+		return os.Remove(journal)
+	})
+}
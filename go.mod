@@ -0,0 +1,5 @@
+module github.com/Q69K/using-cps-in-golang
+
+go 1.23
+
+require github.com/mattn/go-sqlite3 v1.14.52